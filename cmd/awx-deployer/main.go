@@ -2,61 +2,670 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"awx-deployer/internal/audit"
 	"awx-deployer/internal/config"
 	"awx-deployer/internal/deploy"
+	"awx-deployer/internal/events"
+	"awx-deployer/internal/health"
 	"awx-deployer/internal/k8s"
-	"awx-deployer/internal/operator"
+	"awx-deployer/internal/pipeline"
+	"awx-deployer/internal/state"
+	"awx-deployer/internal/targets"
+	"awx-deployer/internal/tracing"
+	"awx-deployer/internal/version"
 )
 
+// serverVersionTimeout bounds how long version waits for the cluster
+const serverVersionTimeout = 5 * time.Second
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	// Load configuration from environment
-	cfg, err := config.NewConfigFromEnv()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "config":
+			runConfig(os.Args[2:])
+			return
+		case "doctor":
+			runDoctor()
+			return
+		case "uninstall":
+			runUninstall(os.Args[2:])
+			return
+		case "reconcile":
+			runReconcile(os.Args[2:])
+			return
+		case "repair-operator":
+			runRepairOperator(os.Args[2:])
+			return
+		case "plan", "preview":
+			runPlan(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "version", "--version", "-version":
+			runVersion(os.Args[2:])
+			return
+		}
+	}
+
+	runDeploy(os.Args[1:])
+}
+
+// runDeploy performs the full AWX deployment
+func runDeploy(args []string) {
+	fs := flag.NewFlagSet("awx-deployer", flag.ExitOnError)
+	renderTo := fs.String("render-to", "", "write the generated manifests to this directory instead of applying them")
+	patch := fs.String("patch", "", "apply this JSON merge patch or JSON patch to the AWX CR instead of deploying")
+	patchFile := fs.String("patch-file", "", "apply the patch in this file to the AWX CR instead of deploying")
+	targetsFile := fs.String("targets", "", "deploy to every cluster listed in this file")
+	force := fs.Bool("force", false, "deploy even outside AWX_MAINTENANCE_WINDOW or while another deployer holds the deploy lock")
+	eventsFile := outputEventsFileFlag(fs)
+	fs.Parse(args)
+
+	// Load configuration from environment or the configuration ConfigMap
+	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	setAuditFile(cfg, *eventsFile)
+
+	if *renderTo != "" {
+		runRender(cfg, *renderTo)
+		return
+	}
+
+	if err := deploy.NewMaintenanceGuard(cfg).Check(*force); err != nil {
+		log.Fatalf("Refusing to continue: %v", err)
+	}
+
+	if *targetsFile != "" {
+		runTargets(cfg, *targetsFile, targetArgs(*force, *eventsFile))
+		return
+	}
 
 	// Initialize Kubernetes client
-	k8sClient, err := k8s.NewKubernetesClient(cfg.KubeconfigPath)
+	k8sClient, err := k8s.NewKubernetesClient(cfg.KubeconfigPath, cfg.Cluster, cfg.ClientThrottling())
 	if err != nil {
 		log.Fatalf("Failed to initialize Kubernetes client: %v", err)
 	}
+	checkCluster(k8sClient, cfg)
+	k8sClient.SetPreservedPrefixes(cfg.PreservePrefixes)
 
-	ctx := context.Background()
+	auditLog := openAuditLog(k8sClient, cfg, false)
+	defer auditLog.Close()
 
-	log.Println("Starting AWX deployment...")
+	ctx := context.Background()
 
-	// Step 1: Install AWX Operator
-	operatorInstaller := operator.NewOperatorInstaller(k8sClient, cfg)
-	if err := operatorInstaller.Install(ctx); err != nil {
-		log.Fatalf("Failed to install AWX operator: %v", err)
+	if *patch != "" || *patchFile != "" {
+		runPatch(ctx, k8sClient, cfg, *patch, *patchFile, *force)
+		return
 	}
 
-	// Step 2: Apply manifests
-	manifestApplier := deploy.NewManifestApplier(k8sClient, cfg)
-	if err := manifestApplier.Apply(ctx); err != nil {
-		log.Fatalf("Failed to apply manifests: %v", err)
+	tracer, shutdownTracing, err := tracing.NewTracer(ctx, cfg.OTelEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
 	}
 
-	// Step 3: Wait for deployment
-	deploymentWaiter := deploy.NewDeploymentWaiter(k8sClient, cfg)
-	if err := deploymentWaiter.WaitForReady(ctx, 15*time.Minute); err != nil {
-		log.Fatalf("Deployment failed to become ready: %v", err)
+	lock := acquireDeployLock(ctx, k8sClient, cfg, *force)
+	healthServer := startHealthServer(cfg)
+
+	log.Println("Starting AWX deployment...")
+
+	p := pipeline.NewPipeline(k8sClient, cfg, tracer)
+	rendered := renderEvents(p.Events(64), healthServer, deploy.NewEventRecorder(k8sClient, cfg))
+	err = p.Run(ctx)
+	<-rendered
+	releaseDeployLock(ctx, lock)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	if shutdownErr := healthServer.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Printf("Warning: Failed to stop the health server: %v", shutdownErr)
 	}
+	cancel()
 
-	// Step 4: Verify deployment
-	verifier := deploy.NewDeploymentVerifier(k8sClient, cfg)
-	if err := verifier.Verify(ctx); err != nil {
-		log.Fatalf("Deployment verification failed: %v", err)
+	// Flush spans before exiting, including on failure
+	if shutdownErr := shutdownTracing(ctx); shutdownErr != nil {
+		log.Printf("Warning: Failed to flush traces: %v", shutdownErr)
+	}
+	if err != nil {
+		log.Fatalf("AWX deployment failed: %v", err)
 	}
 
 	log.Println("AWX deployment completed successfully!")
-	fmt.Printf("AWX should be accessible at: https://%s\n", cfg.AWXHostname)
+	accessURL, err := deploy.AccessURL(ctx, k8sClient, cfg)
+	if err != nil {
+		log.Printf("Warning: Could not determine the AWX URL: %v", err)
+		accessURL = deploy.FallbackAccessURL(ctx, k8sClient, cfg)
+	}
+	if accessURL != "" {
+		fmt.Printf("AWX should be accessible at: %s\n", accessURL)
+	}
+	if version := p.AWXVersion(); version != "" {
+		fmt.Printf("AWX version: %s\n", version)
+	}
+	if timing := p.ReadyTiming(); len(timing.Components) > 0 {
+		fmt.Printf("Time to ready: %s\n", timing)
+	}
 	fmt.Printf("Admin username: %s\n", cfg.AdminUser)
-	fmt.Printf("Admin password: %s\n", cfg.AdminPassword)
+	printAdminPassword(cfg)
+}
+
+// printAdminPassword tells where the admin password is stored, without
+// printing it
+func printAdminPassword(cfg *config.Config) {
+	secretName, err := deploy.AdminPasswordSecretName(cfg)
+	if err != nil {
+		log.Printf("Warning: Could not determine the admin password secret: %v", err)
+		return
+	}
+	fmt.Printf("Admin password: kubectl get secret -n %s %s -o jsonpath='{.data.password}' | base64 -d\n", cfg.Namespace, secretName)
+}
+
+// checkCluster exits unless the client is connected to the cluster and
+// context that AWX_EXPECTED_CLUSTER and AWX_CONFIRM_CONTEXT name
+func checkCluster(k8sClient *k8s.KubernetesClient, cfg *config.Config) {
+	if err := deploy.NewClusterGuard(k8sClient, cfg).Check(context.Background()); err != nil {
+		log.Fatalf("Refusing to continue: %v", err)
+	}
+}
+
+// outputEventsFileFlag adds the --output-events-file flag to a command
+func outputEventsFileFlag(fs *flag.FlagSet) *string {
+	return fs.String("output-events-file", "", "append a JSONL record of every cluster mutation to this file (overrides AWX_AUDIT_FILE)")
+}
+
+// lockForceFlag defines the --force flag of the commands that take the
+// deploy lock
+func lockForceFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("force", false, "take the deploy lock even while another deployer holds it")
+}
+
+// setAuditFile makes a path given with --output-events-file the audit file
+func setAuditFile(cfg *config.Config, path string) {
+	if path != "" {
+		cfg.AuditFile = path
+	}
+}
+
+// openAuditLog records the mutations of the client in the configured audit
+// file, as would-be mutations in dry-run mode. It returns nil when auditing
+// is disabled.
+func openAuditLog(k8sClient *k8s.KubernetesClient, cfg *config.Config, dryRun bool) *audit.Log {
+	if cfg.AuditFile == "" {
+		return nil
+	}
+
+	auditLog, err := audit.Open(stateStore(k8sClient, cfg), cfg.AuditFile, dryRun)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	k8sClient.SetAuditLog(auditLog)
+	return auditLog
+}
+
+// acquireDeployLock takes the deploy lock when AWX_DEPLOY_LOCK is set, or
+// exits naming its holder. It returns nil when the lock is not used. The
+// namespace of the Lease is created first, as before the first deployment.
+func acquireDeployLock(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config, force bool) *state.DeployLock {
+	if !cfg.DeployLock {
+		return nil
+	}
+
+	if err := deploy.EnsureStateNamespace(ctx, k8sClient, cfg); err != nil {
+		log.Fatalf("Failed to prepare the deploy lock: %v", err)
+	}
+	lock := state.NewDeployLock(k8sClient.Clientset(), cfg.StateStoreNamespace(), state.DeployLockName(cfg.Namespace, cfg.AWXName),
+		state.LockIdentity(), time.Duration(cfg.LockTTL)*time.Second)
+	if err := lock.Acquire(ctx, force); err != nil {
+		log.Fatalf("Refusing to continue: %v", err)
+	}
+	return lock
+}
+
+// releaseDeployLock releases the deploy lock, if taken. A lock that cannot
+// be released expires after AWX_LOCK_TTL.
+func releaseDeployLock(ctx context.Context, lock *state.DeployLock) {
+	if lock == nil {
+		return
+	}
+	if err := lock.Release(ctx); err != nil {
+		log.Printf("Warning: Failed to release the deploy lock: %v", err)
+	}
+}
+
+// stateStore returns the store AWX_STATE_STORE selects. The namespace of a
+// configmap store is created first, so the first write does not fail.
+func stateStore(k8sClient *k8s.KubernetesClient, cfg *config.Config) state.StateStore {
+	if cfg.StateStore == state.BackendConfigMap {
+		if err := deploy.EnsureStateNamespace(context.Background(), k8sClient, cfg); err != nil {
+			log.Fatalf("Failed to prepare the state store: %v", err)
+		}
+		return state.NewConfigMapStore(k8sClient.Clientset(), cfg.StateStoreNamespace(), cfg.StateConfigMap)
+	}
+	return state.NewFileStore()
+}
+
+// startHealthServer starts the health endpoints when AWX_HEALTH_ADDR is set.
+// The deployment goes ahead without them if the address cannot be used.
+func startHealthServer(cfg *config.Config) *health.Server {
+	if cfg.HealthAddr == "" {
+		return nil
+	}
+
+	server := health.NewServer(cfg.HealthAddr)
+	if err := server.Start(); err != nil {
+		log.Printf("Warning: Health endpoints disabled: %v", err)
+		return nil
+	}
+	log.Printf("Serving /healthz and /status on %s", server.Addr())
+	return server
+}
+
+// renderEvents prints a line when a pipeline step starts, completes or fails,
+// and passes every event to the health server and the Kubernetes Event
+// recorder. The returned channel is closed once all events are rendered.
+func renderEvents(stream <-chan events.Event, healthServer *health.Server, recorder *deploy.EventRecorder) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		started := map[string]time.Time{}
+		for event := range stream {
+			healthServer.Observe(event)
+			recorder.Observe(event)
+			switch event.Phase {
+			case events.PhaseStart:
+				started[event.Step] = event.Timestamp
+				fmt.Printf("==> %s\n", event.Step)
+			case events.PhaseComplete:
+				fmt.Printf("==> %s completed in %v\n", event.Step, event.Timestamp.Sub(started[event.Step]).Round(time.Second))
+			case events.PhaseFail:
+				fmt.Printf("==> %s failed: %v\n", event.Step, event.Err)
+			}
+		}
+	}()
+	return done
+}
+
+// targetArgs returns the flags of the deployment the deployers of the
+// targets are started with
+func targetArgs(force bool, eventsFile string) []string {
+	var args []string
+	if force {
+		args = append(args, "--force")
+	}
+	if eventsFile != "" {
+		args = append(args, "--output-events-file", eventsFile)
+	}
+	return args
+}
+
+// runTargets deploys to every target in the targets file, each in its own
+// deployer process, and prints a combined report
+func runTargets(cfg *config.Config, path string, args []string) {
+	targetList, err := targets.Load(path)
+	if err != nil {
+		log.Fatalf("Failed to load targets: %v", err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Failed to locate the deployer executable: %v", err)
+	}
+
+	log.Printf("Deploying AWX to %d targets, %d at a time...", len(targetList), cfg.MaxParallelClusters)
+	report := targets.NewRunner(executable, args, cfg.MaxParallelClusters).Run(context.Background(), targetList)
+	report.Print(os.Stdout)
+
+	if failed := report.Failed(); failed > 0 {
+		log.Fatalf("AWX deployment failed for %d of %d targets", failed, len(targetList))
+	}
+}
+
+// runPatch applies a patch to the AWX CR given inline or in a file, holding
+// the deploy lock
+func runPatch(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config, patch, patchFile string, force bool) {
+	if patch != "" && patchFile != "" {
+		log.Fatalf("Only one of --patch and --patch-file may be given")
+	}
+
+	data := []byte(patch)
+	if patchFile != "" {
+		var err error
+		data, err = os.ReadFile(patchFile)
+		if err != nil {
+			log.Fatalf("Failed to read patch file: %v", err)
+		}
+	}
+
+	lock := acquireDeployLock(ctx, k8sClient, cfg, force)
+	err := deploy.NewAWXPatcher(k8sClient, cfg).Patch(ctx, data)
+	releaseDeployLock(ctx, lock)
+	if err != nil {
+		log.Fatalf("Failed to patch AWX instance: %v", err)
+	}
+	log.Println("AWX instance patched successfully!")
+}
+
+// runRender writes the generated manifests to dir without contacting the cluster
+func runRender(cfg *config.Config, dir string) {
+	generator := deploy.NewManifestGenerator(cfg, deploy.DefaultManifestsPath)
+	paths, err := generator.RenderTo(dir)
+	if err != nil {
+		log.Fatalf("Failed to render manifests: %v", err)
+	}
+
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	log.Printf("Rendered %d manifests to %s", len(paths), dir)
+}
+
+// runDoctor diagnoses an existing installation without changing the cluster
+func runDoctor() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	k8sClient, err := k8s.NewKubernetesClient(cfg.KubeconfigPath, cfg.Cluster, cfg.ClientThrottling())
+	if err != nil {
+		log.Fatalf("Failed to initialize Kubernetes client: %v", err)
+	}
+
+	log.Printf("Diagnosing AWX instance %s in namespace %s...", cfg.AWXName, cfg.Namespace)
+	report := deploy.NewDoctor(k8sClient, cfg).Diagnose(context.Background())
+	report.Print(os.Stdout)
+}
+
+// runPlan prints what a deployment would create or update without changing
+// the cluster
+func runPlan(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	eventsFile := outputEventsFileFlag(fs)
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	setAuditFile(cfg, *eventsFile)
+
+	k8sClient, err := k8s.NewKubernetesClient(cfg.KubeconfigPath, cfg.Cluster, cfg.ClientThrottling())
+	if err != nil {
+		log.Fatalf("Failed to initialize Kubernetes client: %v", err)
+	}
+
+	auditLog := openAuditLog(k8sClient, cfg, true)
+	defer auditLog.Close()
+
+	log.Printf("Planning deployment of AWX instance %s in namespace %s...", cfg.AWXName, cfg.Namespace)
+	steps, err := deploy.NewPlanner(k8sClient, cfg).Plan(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to plan deployment: %v", err)
+	}
+	deploy.PrintPlan(os.Stdout, steps)
+	deploy.RecordPlan(auditLog, steps)
+}
+
+// runExport writes the live AWX deployment to a directory as manifests
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("dir", "", "directory to write the exported manifests to")
+	includeSecrets := fs.Bool("include-secrets", false, "write secret values instead of redacting them")
+	fs.Parse(args)
+
+	if *dir == "" {
+		log.Fatalf("export needs --dir")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	k8sClient, err := k8s.NewKubernetesClient(cfg.KubeconfigPath, cfg.Cluster, cfg.ClientThrottling())
+	if err != nil {
+		log.Fatalf("Failed to initialize Kubernetes client: %v", err)
+	}
+
+	paths, err := deploy.NewExporter(k8sClient, cfg).ExportTo(context.Background(), *dir, *includeSecrets)
+	if err != nil {
+		log.Fatalf("Failed to export AWX deployment: %v", err)
+	}
+
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	log.Printf("Exported %d objects of AWX instance %s to %s", len(paths), cfg.AWXName, *dir)
+}
+
+// runUninstall removes the AWX instance and the objects created for it
+func runUninstall(args []string) {
+	fs := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	force := lockForceFlag(fs)
+	eventsFile := outputEventsFileFlag(fs)
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	setAuditFile(cfg, *eventsFile)
+
+	k8sClient, err := k8s.NewKubernetesClient(cfg.KubeconfigPath, cfg.Cluster, cfg.ClientThrottling())
+	if err != nil {
+		log.Fatalf("Failed to initialize Kubernetes client: %v", err)
+	}
+	checkCluster(k8sClient, cfg)
+	k8sClient.SetDeletePropagation(metav1.DeletionPropagation(cfg.DeletePropagation))
+
+	auditLog := openAuditLog(k8sClient, cfg, false)
+	defer auditLog.Close()
+
+	ctx := context.Background()
+	lock := acquireDeployLock(ctx, k8sClient, cfg, *force)
+	err = deploy.NewUninstaller(k8sClient, cfg).Uninstall(ctx)
+	releaseDeployLock(ctx, lock)
+	if err != nil {
+		log.Fatalf("Failed to uninstall AWX: %v", err)
+	}
+}
+
+// runReconcile applies the manifests and prunes the objects no longer in
+// them, for runs on a schedule. It exits 0 whether or not it corrected drift.
+func runReconcile(args []string) {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	force := lockForceFlag(fs)
+	eventsFile := outputEventsFileFlag(fs)
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	setAuditFile(cfg, *eventsFile)
+
+	k8sClient, err := k8s.NewKubernetesClient(cfg.KubeconfigPath, cfg.Cluster, cfg.ClientThrottling())
+	if err != nil {
+		log.Fatalf("Failed to initialize Kubernetes client: %v", err)
+	}
+	checkCluster(k8sClient, cfg)
+	k8sClient.SetPreservedPrefixes(cfg.PreservePrefixes)
+	k8sClient.SetDeletePropagation(metav1.DeletionPropagation(cfg.DeletePropagation))
+
+	auditLog := openAuditLog(k8sClient, cfg, false)
+	defer auditLog.Close()
+
+	ctx := context.Background()
+	lock := acquireDeployLock(ctx, k8sClient, cfg, *force)
+	_, err = deploy.NewReconciler(k8sClient, cfg).Reconcile(ctx)
+	releaseDeployLock(ctx, lock)
+	if err != nil {
+		log.Fatalf("Failed to reconcile AWX: %v", err)
+	}
+}
+
+// runRepairOperator reports an operator install left partial and, with
+// --to, the fixes that make it fully installed or fully removed. The fixes
+// are only made with --apply.
+func runRepairOperator(args []string) {
+	fs := flag.NewFlagSet("repair-operator", flag.ExitOnError)
+	to := fs.String("to", "", "repair the operator to installed or removed")
+	apply := fs.Bool("apply", false, "make the fixes instead of printing them")
+	eventsFile := outputEventsFileFlag(fs)
+	fs.Parse(args)
+
+	if *apply && *to == "" {
+		log.Fatalf("--apply needs --to %s or --to %s", deploy.RepairInstalled, deploy.RepairRemoved)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	setAuditFile(cfg, *eventsFile)
+
+	k8sClient, err := k8s.NewKubernetesClient(cfg.KubeconfigPath, cfg.Cluster, cfg.ClientThrottling())
+	if err != nil {
+		log.Fatalf("Failed to initialize Kubernetes client: %v", err)
+	}
+	checkCluster(k8sClient, cfg)
+	k8sClient.SetPreservedPrefixes(cfg.PreservePrefixes)
+
+	ctx := context.Background()
+	repairer := deploy.NewOperatorRepairer(k8sClient, cfg)
+	state, err := repairer.Inspect(ctx)
+	if err != nil {
+		log.Fatalf("Failed to inspect the AWX operator: %v", err)
+	}
+
+	var fixes []deploy.RepairFix
+	if *to != "" {
+		fixes, err = repairer.Fixes(ctx, state, *to)
+		if err != nil {
+			log.Fatalf("Failed to plan the repair: %v", err)
+		}
+	}
+	deploy.PrintRepair(os.Stdout, state, *to, fixes)
+	if len(fixes) == 0 {
+		return
+	}
+	if !*apply {
+		fmt.Println("\nRun again with --apply to make these changes")
+		return
+	}
+
+	auditLog := openAuditLog(k8sClient, cfg, false)
+	defer auditLog.Close()
+
+	if err := repairer.Repair(ctx, fixes); err != nil {
+		log.Fatalf("Failed to repair the AWX operator: %v", err)
+	}
+}
+
+// runConfig prints the effective configuration without contacting the cluster
+func runConfig(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	output := fs.String("output", "yaml", "output format: yaml or json")
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	var data []byte
+	switch *output {
+	case "json":
+		data, err = json.MarshalIndent(cfg.Effective(), "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(cfg.Effective())
+	default:
+		log.Fatalf("Unsupported output format %q (expected yaml or json)", *output)
+	}
+	if err != nil {
+		log.Fatalf("Failed to render configuration: %v", err)
+	}
+
+	fmt.Print(string(data))
+}
+
+// runVersion prints the build of the deployer and the version of the target
+// cluster when it can be reached
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	output := fs.String("output", "text", "output format: text or json")
+	fs.Parse(args)
+
+	info := version.Get(config.DefaultOperatorVersion)
+	info.ServerVersion, info.ServerError = serverVersion()
+
+	switch *output {
+	case "json":
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to render version: %v", err)
+		}
+		fmt.Println(string(data))
+	case "text":
+		fmt.Printf("awx-deployer %s\n", info.Version)
+		fmt.Printf("  commit:                   %s\n", info.Commit)
+		fmt.Printf("  build date:               %s\n", info.BuildDate)
+		fmt.Printf("  go:                       %s\n", info.GoVersion)
+		fmt.Printf("  client-go:                %s\n", info.ClientGoVersion)
+		fmt.Printf("  default operator version: %s\n", info.DefaultOperatorVersion)
+		if info.ServerVersion != "" {
+			fmt.Printf("  server version:           %s\n", info.ServerVersion)
+		} else {
+			fmt.Printf("  server version:           unavailable (%s)\n", info.ServerError)
+		}
+	default:
+		log.Fatalf("Unsupported output format %q (expected text or json)", *output)
+	}
+}
+
+// serverVersion returns the Kubernetes version of the target cluster, or why
+// it could not be read
+func serverVersion() (string, string) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err.Error()
+	}
+	k8sClient, err := k8s.NewKubernetesClient(cfg.KubeconfigPath, cfg.Cluster, cfg.ClientThrottling())
+	if err != nil {
+		return "", err.Error()
+	}
+
+	type result struct {
+		version string
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		serverVersion, err := k8sClient.ServerVersion()
+		done <- result{serverVersion, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return "", r.err.Error()
+		}
+		return r.version, ""
+	case <-time.After(serverVersionTimeout):
+		return "", fmt.Sprintf("no answer from the cluster within %v", serverVersionTimeout)
+	}
 }
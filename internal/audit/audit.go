@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"awx-deployer/internal/state"
+)
+
+const (
+	// ResultSuccess is the result of a mutation the API server accepted
+	ResultSuccess = "success"
+	// ResultFailure is the result of a rejected mutation, see Record.Error
+	ResultFailure = "failure"
+)
+
+// Record is one line of the audit log
+type Record struct {
+	Timestamp time.Time `json:"timestamp"`
+	Verb      string    `json:"verb"` // create, update, patch, apply or delete, prefixed with would- in dry-run mode
+	Group     string    `json:"group"`
+	Version   string    `json:"version"`
+	Resource  string    `json:"resource"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	DryRun    bool      `json:"dry_run"`
+}
+
+// Log appends a JSONL record for every cluster mutation to a key of a state
+// store. Every record is written, and with the file store synced to disk,
+// before Record returns, so the trail survives a crash of the deployer. A nil
+// Log records nothing.
+type Log struct {
+	mu     sync.Mutex
+	store  state.StateStore
+	key    string
+	dryRun bool
+}
+
+// Open checks that the audit key of the store can be appended to. With
+// dryRun the records are marked as mutations that would have been made.
+func Open(store state.StateStore, key string, dryRun bool) (*Log, error) {
+	if err := store.Append(context.Background(), key, nil); err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %v", key, err)
+	}
+	return &Log{store: store, key: key, dryRun: dryRun}, nil
+}
+
+// Record appends a record of a mutation with its outcome. Failures to write
+// the audit log are logged as warnings rather than failing the mutation.
+func (l *Log) Record(verb string, gvr schema.GroupVersionResource, namespace, name string, err error) {
+	if l == nil {
+		return
+	}
+
+	record := Record{
+		Timestamp: time.Now().UTC(),
+		Verb:      verb,
+		Group:     gvr.Group,
+		Version:   gvr.Version,
+		Resource:  gvr.Resource,
+		Namespace: namespace,
+		Name:      name,
+		Result:    ResultSuccess,
+		DryRun:    l.dryRun,
+	}
+	if l.dryRun {
+		record.Verb = "would-" + verb
+	}
+	if err != nil {
+		record.Result = ResultFailure
+		record.Error = err.Error()
+	}
+
+	line, marshalErr := json.Marshal(record)
+	if marshalErr != nil {
+		log.Printf("Warning: Could not encode audit record: %v", marshalErr)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.store.Append(context.Background(), l.key, append(line, '\n')); err != nil {
+		log.Printf("Warning: Could not write audit record: %v", err)
+	}
+}
+
+// Close waits for a record being written. The store needs no closing.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return nil
+}
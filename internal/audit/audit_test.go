@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"awx-deployer/internal/state"
+)
+
+func TestLogRecord(t *testing.T) {
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	tests := []struct {
+		name   string
+		dryRun bool
+		err    error
+		want   Record
+	}{
+		{
+			name: "mutation",
+			want: Record{Verb: "create", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "awx", Name: "awx-web", Result: ResultSuccess},
+		},
+		{
+			name: "rejected mutation",
+			err:  errors.New(`deployments.apps "awx-web" is forbidden`),
+			want: Record{Verb: "create", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "awx", Name: "awx-web", Result: ResultFailure, Error: `deployments.apps "awx-web" is forbidden`},
+		},
+		{
+			name:   "dry run",
+			dryRun: true,
+			want:   Record{Verb: "would-create", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "awx", Name: "awx-web", Result: ResultSuccess, DryRun: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			auditLog, err := Open(state.NewFileStore(), path, tt.dryRun)
+			if err != nil {
+				t.Fatalf("Open() failed: %v", err)
+			}
+			auditLog.Record("create", deployments, "awx", "awx-web", tt.err)
+			if err := auditLog.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			records := readRecords(t, path)
+			if len(records) != 1 {
+				t.Fatalf("%d records written, want 1", len(records))
+			}
+			got := records[0]
+			if got.Timestamp.IsZero() {
+				t.Errorf("record has no timestamp")
+			}
+			got.Timestamp = tt.want.Timestamp
+			if got != tt.want {
+				t.Errorf("record = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte(`{"verb":"delete","name":"earlier-run"}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	auditLog, err := Open(state.NewFileStore(), path, false)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	auditLog.Record("update", schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "awx", "awx-admin-password", nil)
+
+	records := readRecords(t, path)
+	if len(records) != 2 || records[0].Name != "earlier-run" || records[1].Name != "awx-admin-password" {
+		t.Errorf("records = %+v, want the earlier record followed by the new one", records)
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var auditLog *Log
+	auditLog.Record("create", schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "awx", "awx-admin-password", nil)
+	if err := auditLog.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+// readRecords parses the JSONL records of an audit file
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
@@ -0,0 +1,245 @@
+package awx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client is a minimal client for the AWX REST API using basic authentication
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+	retry      RetryPolicy
+}
+
+// RetryPolicy bounds how often a request that failed with a connection error
+// or a 5xx response is retried. Responses with other status codes, such as
+// 401, are not retried.
+type RetryPolicy struct {
+	Retries  int           // retries after the first attempt, 0 disables retrying
+	Interval time.Duration // wait before the first retry, doubled before each further one
+}
+
+// User is an AWX user as returned by the API
+type User struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	IsSuperuser bool   `json:"is_superuser"`
+}
+
+// Token is a personal access token as returned by the API. The token value
+// itself is only returned when the token is created.
+type Token struct {
+	ID          int    `json:"id"`
+	Description string `json:"description"`
+	Scope       string `json:"scope"`
+	Token       string `json:"token"`
+	Expires     string `json:"expires"`
+}
+
+// PingStatus is the response of the ping endpoint
+type PingStatus struct {
+	Version    string         `json:"version"`
+	HA         bool           `json:"ha"`
+	ActiveNode string         `json:"active_node"`
+	Instances  []PingInstance `json:"instances"`
+}
+
+// PingInstance is an instance of the cluster as listed by the ping endpoint
+type PingInstance struct {
+	Node      string `json:"node"`
+	Capacity  int    `json:"capacity"`
+	Heartbeat string `json:"heartbeat"`
+}
+
+// ErrMigrating is returned while AWX redirects API requests to its page
+// saying that database migrations are still running
+var ErrMigrating = errors.New("AWX is running database migrations")
+
+// migrationsPath is the page AWX redirects to until its migrations ran
+const migrationsPath = "/migrations_notran/"
+
+// NewClient creates a new AWX API client for the given base URL, e.g.
+// https://awx.example.com. Requests go through the proxy returned by proxy,
+// nil connects directly.
+func NewClient(baseURL, username, password string, proxy func(*url.URL) (*url.URL, error)) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	if proxy != nil {
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}
+}
+
+// SetRetryPolicy makes the client retry requests that fail while AWX or the
+// ingress in front of it is still starting
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = policy
+}
+
+// Ping returns the status of the cluster from the unauthenticated ping
+// endpoint
+func (c *Client) Ping(ctx context.Context) (*PingStatus, error) {
+	var status PingStatus
+	if err := c.do(ctx, http.MethodGet, "/api/v2/ping/", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Me returns the user the client is authenticated as
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	var page struct {
+		Results []User `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v2/me/", nil, &page); err != nil {
+		return nil, err
+	}
+	if len(page.Results) == 0 {
+		return nil, fmt.Errorf("AWX returned no user for %s", c.username)
+	}
+	return &page.Results[0], nil
+}
+
+// UpdateUser patches the given fields of a user
+func (c *Client) UpdateUser(ctx context.Context, id int, fields map[string]string) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/v2/users/%d/", id), fields, nil)
+}
+
+// CreatePersonalToken creates a personal access token of a user with the
+// given scope, read or write
+func (c *Client) CreatePersonalToken(ctx context.Context, userID int, description, scope string) (*Token, error) {
+	body := map[string]interface{}{"description": description, "scope": scope, "application": nil}
+	var token Token
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v2/users/%d/personal_tokens/", userID), body, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// PersonalTokens lists the personal access tokens of a user with the given
+// description
+func (c *Client) PersonalTokens(ctx context.Context, userID int, description string) ([]Token, error) {
+	query := url.Values{"description": {description}, "page_size": {"200"}}
+	var page struct {
+		Results []Token `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v2/users/%d/personal_tokens/?%s", userID, query.Encode()), nil, &page); err != nil {
+		return nil, err
+	}
+	return page.Results, nil
+}
+
+// DeleteToken revokes a token
+func (c *Client) DeleteToken(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v2/tokens/%d/", id), nil, nil)
+}
+
+// SetTokenExpiry sets the lifetime of the access tokens AWX creates from now
+// on. It is a system-wide setting, AWX has no expiry per token.
+func (c *Client) SetTokenExpiry(ctx context.Context, seconds int) error {
+	var settings struct {
+		OAuth2Provider map[string]interface{} `json:"OAUTH2_PROVIDER"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v2/settings/authentication/", nil, &settings); err != nil {
+		return err
+	}
+	if settings.OAuth2Provider == nil {
+		settings.OAuth2Provider = map[string]interface{}{}
+	}
+	settings.OAuth2Provider["ACCESS_TOKEN_EXPIRE_SECONDS"] = seconds
+	return c.do(ctx, http.MethodPatch, "/api/v2/settings/authentication/", settings, nil)
+}
+
+// do sends a JSON request and decodes the JSON response into out, if given.
+// Connection errors and 5xx responses are retried as the retry policy allows,
+// until the context is done.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %v", err)
+		}
+	}
+
+	interval := c.retry.Interval
+	for attempt := 0; ; attempt++ {
+		retriable, err := c.attempt(ctx, method, path, data, out)
+		if err == nil || !retriable {
+			return err
+		}
+		if attempt >= c.retry.Retries {
+			if attempt > 0 {
+				return fmt.Errorf("%v (gave up after %d attempts)", err, attempt+1)
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v (gave up after %d attempts: %v)", err, attempt+1, ctx.Err())
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+// attempt sends a request once and reports whether a failure is worth
+// retrying
+func (c *Client) attempt(ctx context.Context, method, path string, data []byte, out interface{}) (bool, error) {
+	var reader io.Reader
+	if data != nil {
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Accept", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if strings.HasPrefix(resp.Request.URL.Path, migrationsPath) {
+		return false, ErrMigrating
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode >= 500, fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return false, fmt.Errorf("failed to decode response from %s: %v", path, err)
+		}
+	}
+	return false, nil
+}
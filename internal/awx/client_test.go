@@ -0,0 +1,133 @@
+package awx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// statusServer answers the ping endpoint with the given status codes in turn,
+// repeating the last one, and counts the requests
+type statusServer struct {
+	mu       sync.Mutex
+	statuses []int
+	requests int
+}
+
+func (s *statusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	status := s.statuses[len(s.statuses)-1]
+	if s.requests < len(s.statuses) {
+		status = s.statuses[s.requests]
+	}
+	s.requests++
+	s.mu.Unlock()
+
+	w.WriteHeader(status)
+	if status == http.StatusOK {
+		fmt.Fprint(w, `{"version": "24.6.1", "active_node": "awx-web-0"}`)
+		return
+	}
+	fmt.Fprint(w, http.StatusText(status))
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		// timeout bounds the whole request, unbounded if 0
+		timeout      time.Duration
+		wantRequests int
+		wantErr      string
+	}{
+		{
+			name:         "503 twice then 200",
+			statuses:     []int{503, 503, 200},
+			retries:      3,
+			wantRequests: 3,
+		},
+		{
+			name:         "502 from the ingress then 200",
+			statuses:     []int{502, 200},
+			retries:      3,
+			wantRequests: 2,
+		},
+		{
+			name:         "4xx not retried",
+			statuses:     []int{401, 200},
+			retries:      3,
+			wantRequests: 1,
+			wantErr:      "GET /api/v2/ping/ returned 401 Unauthorized",
+		},
+		{
+			name:         "retries used up",
+			statuses:     []int{503},
+			retries:      2,
+			wantRequests: 3,
+			wantErr:      "returned 503 Service Unavailable: Service Unavailable (gave up after 3 attempts)",
+		},
+		{
+			name:         "retrying disabled",
+			statuses:     []int{503, 200},
+			wantRequests: 1,
+			wantErr:      "returned 503 Service Unavailable",
+		},
+		{
+			name:     "timeout ends the retries",
+			statuses: []int{503},
+			retries:  100,
+			timeout:  50 * time.Millisecond,
+			wantErr:  "context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &statusServer{statuses: tt.statuses}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			client := NewClient(ts.URL, "admin", "Admin-Pass-1", nil)
+			client.SetRetryPolicy(RetryPolicy{Retries: tt.retries, Interval: time.Millisecond})
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			status, err := client.Ping(ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Ping() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Ping() failed: %v", err)
+			} else if status.Version != "24.6.1" {
+				t.Errorf("Ping() version = %q, want 24.6.1", status.Version)
+			}
+			if tt.wantRequests > 0 && server.requests != tt.wantRequests {
+				t.Errorf("server got %d requests, want %d", server.requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestClientRetriesConnectionErrors(t *testing.T) {
+	ts := httptest.NewServer(&statusServer{statuses: []int{200}})
+	baseURL := ts.URL
+	ts.Close()
+
+	client := NewClient(baseURL, "admin", "Admin-Pass-1", nil)
+	client.SetRetryPolicy(RetryPolicy{Retries: 2, Interval: time.Millisecond})
+	_, err := client.Ping(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "gave up after 3 attempts") {
+		t.Fatalf("Ping() error = %v, want the connection retried", err)
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of ClusterExpectation
+const (
+	// ExpectServer matches the API server URL
+	ExpectServer = "server"
+	// ExpectNodeLabel matches a label every node carries
+	ExpectNodeLabel = "label"
+	// ExpectConfigMap matches a key of a config map
+	ExpectConfigMap = "configmap"
+)
+
+// clusterExpectationUsage describes the syntax in errors
+const clusterExpectationUsage = "expected a server URL, label:key=value or configmap:namespace/name/key=value, e.g. https://prod.example.com:6443 or label:cluster=prod-sin"
+
+// ClusterExpectation identifies the cluster the tool must be connected to. It
+// is written as the API server URL, as label:key=value for a label on every
+// node, or as configmap:namespace/name/key=value for a key of a config map
+// that names the cluster.
+type ClusterExpectation struct {
+	Kind string
+	// Server is the API server URL of an ExpectServer expectation
+	Server string
+	// Namespace and Name locate the config map of an ExpectConfigMap
+	// expectation
+	Namespace string
+	Name      string
+	// Key and Value are the label or config map key and its expected value
+	Key   string
+	Value string
+}
+
+// ParseClusterExpectation parses AWX_EXPECTED_CLUSTER
+func ParseClusterExpectation(expected string) (ClusterExpectation, error) {
+	expected = strings.TrimSpace(expected)
+	prefix, rest, _ := strings.Cut(expected, ":")
+
+	switch prefix {
+	case ExpectNodeLabel:
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok || key == "" || value == "" {
+			return ClusterExpectation{}, fmt.Errorf("invalid cluster expectation %q (%s)", expected, clusterExpectationUsage)
+		}
+		return ClusterExpectation{Kind: ExpectNodeLabel, Key: key, Value: value}, nil
+	case ExpectConfigMap:
+		target, value, ok := strings.Cut(rest, "=")
+		parts := strings.Split(target, "/")
+		if !ok || value == "" || len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return ClusterExpectation{}, fmt.Errorf("invalid cluster expectation %q (%s)", expected, clusterExpectationUsage)
+		}
+		return ClusterExpectation{Kind: ExpectConfigMap, Namespace: parts[0], Name: parts[1], Key: parts[2], Value: value}, nil
+	}
+
+	if !strings.HasPrefix(expected, "https://") && !strings.HasPrefix(expected, "http://") {
+		return ClusterExpectation{}, fmt.Errorf("invalid cluster expectation %q (%s)", expected, clusterExpectationUsage)
+	}
+	return ClusterExpectation{Kind: ExpectServer, Server: strings.TrimSuffix(expected, "/")}, nil
+}
+
+func (e ClusterExpectation) String() string {
+	switch e.Kind {
+	case ExpectNodeLabel:
+		return fmt.Sprintf("node label %s=%s", e.Key, e.Value)
+	case ExpectConfigMap:
+		return fmt.Sprintf("config map %s/%s key %s=%s", e.Namespace, e.Name, e.Key, e.Value)
+	}
+	return "server " + e.Server
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseClusterExpectation(t *testing.T) {
+	tests := []struct {
+		expected   string
+		want       ClusterExpectation
+		wantString string
+		wantErr    bool
+	}{
+		{
+			expected:   "https://prod.example.com:6443/",
+			want:       ClusterExpectation{Kind: ExpectServer, Server: "https://prod.example.com:6443"},
+			wantString: "server https://prod.example.com:6443",
+		},
+		{
+			expected:   "label:cluster=prod-sin",
+			want:       ClusterExpectation{Kind: ExpectNodeLabel, Key: "cluster", Value: "prod-sin"},
+			wantString: "node label cluster=prod-sin",
+		},
+		{
+			expected:   "configmap:kube-public/cluster-info/name=prod",
+			want:       ClusterExpectation{Kind: ExpectConfigMap, Namespace: "kube-public", Name: "cluster-info", Key: "name", Value: "prod"},
+			wantString: "config map kube-public/cluster-info key name=prod",
+		},
+		{expected: "prod.example.com:6443", wantErr: true},
+		{expected: "label:cluster", wantErr: true},
+		{expected: "label:=prod", wantErr: true},
+		{expected: "configmap:cluster-info/name=prod", wantErr: true},
+		{expected: "configmap:kube-public/cluster-info/name", wantErr: true},
+		{expected: "configmap:kube-public//name=prod", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			got, err := ParseClusterExpectation(tt.expected)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "invalid cluster expectation") {
+					t.Fatalf("ParseClusterExpectation() error = %v, want invalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseClusterExpectation() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseClusterExpectation() = %+v, want %+v", got, tt.want)
+			}
+			if got.String() != tt.wantString {
+				t.Errorf("String() = %q, want %q", got.String(), tt.wantString)
+			}
+		})
+	}
+}
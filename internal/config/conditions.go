@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConditionRule matches an AWX CR status condition by type, status and
+// optionally reason. It is written as Type=Status or Type=Status:Reason,
+// e.g. Running=True or Failure=True:Failed.
+type ConditionRule struct {
+	Type   string
+	Status string
+	Reason string // empty matches any reason
+}
+
+// ParseConditionRule parses a rule written as Type=Status[:Reason]
+func ParseConditionRule(rule string) (ConditionRule, error) {
+	conditionType, rest, ok := strings.Cut(rule, "=")
+	if !ok || strings.TrimSpace(conditionType) == "" {
+		return ConditionRule{}, fmt.Errorf("invalid condition %q (expected Type=Status or Type=Status:Reason)", rule)
+	}
+	status, reason, _ := strings.Cut(rest, ":")
+	if strings.TrimSpace(status) == "" {
+		return ConditionRule{}, fmt.Errorf("invalid condition %q (expected Type=Status or Type=Status:Reason)", rule)
+	}
+
+	return ConditionRule{
+		Type:   strings.TrimSpace(conditionType),
+		Status: strings.TrimSpace(status),
+		Reason: strings.TrimSpace(reason),
+	}, nil
+}
+
+// Matches reports whether the rule matches a condition. Types, statuses and
+// reasons are compared case-insensitively.
+func (r ConditionRule) Matches(conditionType, status, reason string) bool {
+	return strings.EqualFold(r.Type, conditionType) &&
+		strings.EqualFold(r.Status, status) &&
+		(r.Reason == "" || strings.EqualFold(r.Reason, reason))
+}
+
+func (r ConditionRule) String() string {
+	if r.Reason == "" {
+		return r.Type + "=" + r.Status
+	}
+	return r.Type + "=" + r.Status + ":" + r.Reason
+}
+
+// ConditionRules returns the rules of a list like SuccessConditions. The
+// lists are validated when the configuration is loaded, so invalid entries
+// can only come from a Config built by hand and are skipped.
+func ConditionRules(rules []string) []ConditionRule {
+	var parsed []ConditionRule
+	for _, rule := range rules {
+		if condition, err := ParseConditionRule(rule); err == nil {
+			parsed = append(parsed, condition)
+		}
+	}
+	return parsed
+}
+
+// parseConditionRules parses a list of rules, naming the env var in errors
+func parseConditionRules(key string, rules []string) ([]ConditionRule, error) {
+	parsed := make([]ConditionRule, 0, len(rules))
+	for _, rule := range rules {
+		condition, err := ParseConditionRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		parsed = append(parsed, condition)
+	}
+	return parsed, nil
+}
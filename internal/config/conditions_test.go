@@ -0,0 +1,102 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConditionRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    ConditionRule
+		wantErr bool
+	}{
+		{rule: "Running=True", want: ConditionRule{Type: "Running", Status: "True"}},
+		{rule: "Failure=True:Failed", want: ConditionRule{Type: "Failure", Status: "True", Reason: "Failed"}},
+		{rule: " Running = True : Successful ", want: ConditionRule{Type: "Running", Status: "True", Reason: "Successful"}},
+		{rule: "Running", wantErr: true},
+		{rule: "=True", wantErr: true},
+		{rule: "Running=", wantErr: true},
+		{rule: "Running=:Successful", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := ParseConditionRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConditionRule(%q) error = %v, want error %v", tt.rule, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseConditionRule(%q) = %+v, want %+v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionRuleMatches(t *testing.T) {
+	tests := []struct {
+		rule                          string
+		conditionType, status, reason string
+		want                          bool
+	}{
+		{"Running=True", "Running", "True", "Successful", true},
+		{"Running=True", "running", "true", "", true},
+		{"Running=True", "Running", "False", "", false},
+		{"Running=True", "Successful", "True", "", false},
+		{"Running=True:Successful", "Running", "True", "successful", true},
+		{"Running=True:Successful", "Running", "True", "Reconciling", false},
+		{"Running=True:Successful", "Running", "True", "", false},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseConditionRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rule.Matches(tt.conditionType, tt.status, tt.reason); got != tt.want {
+			t.Errorf("%s matches %s=%s:%s = %v, want %v", tt.rule, tt.conditionType, tt.status, tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestConditionSettings(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantSuccess []string
+		wantFailure []string
+		wantErr     bool
+	}{
+		{
+			name:        "defaults",
+			wantSuccess: []string{"Running=True"},
+			wantFailure: []string{"Failure=True"},
+		},
+		{
+			name:        "custom",
+			env:         map[string]string{"AWX_SUCCESS_CONDITIONS": "Successful=True,Running=True:Successful", "AWX_FAILURE_CONDITIONS": "Degraded=True"},
+			wantSuccess: []string{"Successful=True", "Running=True:Successful"},
+			wantFailure: []string{"Degraded=True"},
+		},
+		{name: "invalid success condition", env: map[string]string{"AWX_SUCCESS_CONDITIONS": "Running"}, wantErr: true},
+		{name: "invalid warning condition", env: map[string]string{"AWX_WARNING_CONDITIONS": "Failure=:Transient"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadEnv(t, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConfigFromEnv() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(cfg.SuccessConditions, tt.wantSuccess) {
+				t.Errorf("SuccessConditions = %q, want %q", cfg.SuccessConditions, tt.wantSuccess)
+			}
+			if !reflect.DeepEqual(cfg.FailureConditions, tt.wantFailure) {
+				t.Errorf("FailureConditions = %q, want %q", cfg.FailureConditions, tt.wantFailure)
+			}
+		})
+	}
+}
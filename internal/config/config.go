@@ -2,89 +2,688 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultOperatorVersion is the AWX operator version installed unless
+// AWX_OPERATOR_VERSION or AWX_OPERATOR_VERSION_FILE pin another
+const DefaultOperatorVersion = "2.19.1"
+
+const (
+	// ManifestSourceAuto builds the manifests directory with kustomize when
+	// it holds a kustomization and reads its YAML files otherwise
+	ManifestSourceAuto = "auto"
+	// ManifestSourceFiles reads the YAML files of the manifests directory
+	ManifestSourceFiles = "files"
+	// ManifestSourceKustomize builds the manifests directory with kustomize
+	ManifestSourceKustomize = "kustomize"
+)
+
+const (
+	// AdoptExistingSkip leaves existing objects the deployer does not manage
+	// untouched
+	AdoptExistingSkip = "skip"
+	// AdoptExistingAdopt labels existing objects the deployer does not manage
+	// as its own and updates them
+	AdoptExistingAdopt = "adopt"
+	// AdoptExistingFail stops at the first existing object the deployer does
+	// not manage
+	AdoptExistingFail = "fail"
+)
+
+// minTimeoutMinutes is the shortest timeout accepted for the waits on the
+// operator, CRDs, ingress, certificate, verification and deletions on uninstall
+const minTimeoutMinutes = 1
+
+// Source identifies where a configuration value was resolved from
+type Source string
+
+const (
+	// SourceDefault means the built-in default was used
+	SourceDefault Source = "default"
+	// SourceEnv means the value was read from an environment variable
+	SourceEnv Source = "env"
+	// SourceProfile means the default of the selected AWX_PROFILE was used
+	SourceProfile Source = "profile"
+	// SourceVersionFile means the value was pinned by AWX_OPERATOR_VERSION_FILE
+	SourceVersionFile Source = "version-file"
+	// SourceConfigMap means the value was read from the ConfigMap selected by
+	// AWX_CONFIG_SOURCE=configmap
+	SourceConfigMap Source = "configmap"
 )
 
+// PSSProfileRestricted selects a security context compliant with the
+// PodSecurity "restricted" standard
+const PSSProfileRestricted = "restricted"
+
 // Config holds all configuration values for AWX deployment
 type Config struct {
+	// Profile selects a set of defaults, dev or prod
+	Profile string `env:"AWX_PROFILE"`
+
 	// Kubernetes settings
-	KubeconfigPath string
-	Namespace      string
+	KubeconfigPath  string `env:"KUBECONFIG"`           // colon-separated kubeconfig files, merged like kubectl
+	Cluster         string `env:"AWX_CLUSTER"`          // context or cluster name, empty uses the current context
+	ExpectedCluster string `env:"AWX_EXPECTED_CLUSTER"` // refuse to run unless the cluster matches, see ClusterExpectation
+	ConfirmContext  string `env:"AWX_CONFIRM_CONTEXT"`  // refuse to run unless this is the kubeconfig context in use
+	Namespace       string `env:"AWX_NAMESPACE"`
+	ForceNamespace  string `env:"AWX_FORCE_NAMESPACE"`   // put every namespaced manifest object into this namespace
+	ClientRateLimit string `env:"AWX_CLIENT_RATE_LIMIT"` // default keeps client-go's rate limiter, off disables it
+
+	// MaintenanceWindow is when deployments may change the cluster, see
+	// MaintenanceWindow, empty allows them any time
+	MaintenanceWindow string `env:"AWX_MAINTENANCE_WINDOW"`
+
+	// PreservePrefixes are the label and annotation key prefixes kept from
+	// live objects when they are updated, none keeps nothing
+	PreservePrefixes []string `env:"AWX_PRESERVE_PREFIXES"`
 
 	// AWX settings
-	AWXName       string
-	AWXHostname   string
-	AdminUser     string
-	AdminPassword string
+	AWXName            string   `env:"AWX_NAME"`
+	AWXHostname        string   `env:"AWX_HOSTNAME"`
+	AWXHostnameAliases []string `env:"AWX_HOSTNAME_ALIASES"` // further hosts the ingress answers on
+	AdminUser          string   `env:"AWX_ADMIN_USER"`
+	AdminPassword      string   `env:"AWX_ADMIN_PASSWORD" secret:"true"` // generated when unset
+	RotateAdmin        bool     `env:"AWX_ROTATE_ADMIN"`                 // update admin credentials of an existing install
+	Replicas           int      `env:"AWX_REPLICAS"`                     // web and task replicas, 0 keeps the manifest value
+	ImageVersion       string   `env:"AWX_IMAGE_VERSION"`                // AWX image tag, empty keeps the operator default
+
+	// Password policy settings
+	PasswordPolicy    string `env:"AWX_PASSWORD_POLICY"`     // e.g. min_length=12,min_classes=3
+	AllowWeakPassword bool   `env:"AWX_ALLOW_WEAK_PASSWORD"` // accept an admin password violating the policy
+	StrictPassword    bool   `env:"AWX_STRICT_PASSWORD"`     // reject DefaultAdminPassword even when weak passwords are allowed
+
+	// API token settings
+	EmitAPIToken   bool   `env:"AWX_EMIT_API_TOKEN"`   // create an AWX API token for the admin user once AWX is healthy
+	APITokenScope  string `env:"AWX_API_TOKEN_SCOPE"`  // read or write
+	APITokenExpiry int    `env:"AWX_API_TOKEN_EXPIRY"` // token lifetime in seconds, set system-wide in AWX, 0 keeps the AWX setting
+	APITokenSecret string `env:"AWX_API_TOKEN_SECRET"` // Secret to write the token to, empty prints it as JSON
+
+	// AdminPasswordGenerated is set when no admin password was configured
+	// and a random one was generated
+	AdminPasswordGenerated bool
 
 	// Storage settings
-	StorageClass    string
-	PostgresStorage string
-	ProjectsStorage string
+	StorageClass    string `env:"AWX_STORAGE_CLASS"`
+	PostgresStorage string `env:"AWX_POSTGRES_STORAGE"`
+	ProjectsStorage string `env:"AWX_PROJECTS_STORAGE"`
 
 	// PostgreSQL settings
-	PostgresHost     string
-	PostgresPort     int
-	PostgresDatabase string
-	PostgresUsername string
-	PostgresPassword string
+	PostgresHost     string `env:"AWX_POSTGRES_HOST"`
+	PostgresPort     int    `env:"AWX_POSTGRES_PORT"`
+	PostgresDatabase string `env:"AWX_POSTGRES_DATABASE"`
+	PostgresUsername string `env:"AWX_POSTGRES_USERNAME"`
+	PostgresPassword string `env:"AWX_POSTGRES_PASSWORD" secret:"true"`
+
+	// External Redis settings, used instead of the operator's Redis when enabled
+	RedisExternal bool   `env:"AWX_REDIS_EXTERNAL"`
+	RedisHost     string `env:"AWX_REDIS_HOST"`
+	RedisPort     int    `env:"AWX_REDIS_PORT"`
+	RedisPassword string `env:"AWX_REDIS_PASSWORD" secret:"true"`
+
+	// Managed PostgreSQL settings, empty values keep the operator defaults
+	PostgresVersion       string `env:"AWX_POSTGRES_VERSION"` // major version, used to derive resource names
+	PostgresImage         string `env:"AWX_POSTGRES_IMAGE"`
+	PostgresImageVersion  string `env:"AWX_POSTGRES_IMAGE_VERSION"`
+	PostgresCPURequest    string `env:"AWX_POSTGRES_CPU_REQUEST"`
+	PostgresMemoryRequest string `env:"AWX_POSTGRES_MEMORY_REQUEST"`
+	PostgresCPULimit      string `env:"AWX_POSTGRES_CPU_LIMIT"`
+	PostgresMemoryLimit   string `env:"AWX_POSTGRES_MEMORY_LIMIT"`
+	PostgresRecreate      bool   `env:"AWX_POSTGRES_RECREATE"` // switch the Postgres deployment to the Recreate strategy
+
+	// Image settings
+	ImagePullPolicy string   `env:"AWX_IMAGE_PULL_POLICY"` // empty keeps the manifest and operator defaults
+	RegistryMirrors []string `env:"AWX_REGISTRY_MIRROR"`   // registry=mirror entries, e.g. quay.io=mirror.local/quay
+
+	// Security settings, an empty profile keeps the operator defaults
+	PSSProfile string `env:"AWX_PSS_PROFILE"`
+	PSAEnforce string `env:"AWX_PSA_ENFORCE"` // PodSecurity admission level to label the AWX namespace with, empty sets no label
 
 	// Ingress settings
-	IngressClassName string
-	TLSSecretName    string
-	CertIssuer       string
+	TLS              bool   `env:"AWX_TLS"` // serve the ingress over HTTPS
+	IngressClassName string `env:"AWX_INGRESS_CLASS"`
+	TLSSecretName    string `env:"AWX_TLS_SECRET"`
+	CertIssuer       string `env:"AWX_CERT_ISSUER"`
+	TLSCertFile      string `env:"AWX_TLS_CERT_FILE"`
+	TLSKeyFile       string `env:"AWX_TLS_KEY_FILE"`
+	WaitIngress      bool   `env:"AWX_WAIT_INGRESS"`
+	IngressTimeout   int    `env:"AWX_INGRESS_TIMEOUT"` // in minutes
+	CertTimeout      int    `env:"AWX_CERT_TIMEOUT"`    // in minutes, for the cert-manager Certificate to become Ready
+
+	// IngressController fills in ingress annotations suited to an ingress
+	// controller (nginx, traefik or alb), empty adds none
+	IngressController  string   `env:"AWX_INGRESS_CONTROLLER"`
+	IngressAnnotations []string `env:"AWX_INGRESS_ANNOTATIONS" separator:";"` // key=value entries merged onto the ingress, overriding the controller's
+	IngressPath        string   `env:"AWX_INGRESS_PATH"`                      // serve AWX under this subpath of its hosts, e.g. /awx, empty serves it at /
 
 	// Operator settings
-	OperatorVersion string
-	OperatorTimeout int // in minutes
+	OperatorVersion          string   `env:"AWX_OPERATOR_VERSION"`
+	OperatorVersionFile      string   `env:"AWX_OPERATOR_VERSION_FILE"`      // lockfile pinning the operator and AWX image versions
+	CompatibilityMatrix      string   `env:"AWX_COMPATIBILITY_MATRIX"`       // file of more known-incompatible operator and AWX image versions
+	OperatorManifestPath     string   `env:"AWX_OPERATOR_MANIFEST_PATH"`     // pre-rendered manifest file or bundle directory
+	OperatorKustomizePatches []string `env:"AWX_OPERATOR_KUSTOMIZE_PATCHES"` // patch files layered onto the operator manifests
+	OperatorNamespace        string   `env:"AWX_OPERATOR_NAMESPACE"`
+	OperatorClusterScoped    bool     `env:"AWX_OPERATOR_CLUSTER_SCOPED"` // operator watches all namespaces
+	SkipOperatorInstall      bool     `env:"AWX_SKIP_OPERATOR_INSTALL"`   // use an operator installed by others, only check that it is healthy
+	OperatorPodSelector      string   `env:"AWX_OPERATOR_POD_SELECTOR"`   // label selector of the operator pods
+	OperatorTimeout          int      `env:"AWX_OPERATOR_TIMEOUT"`        // in minutes
+	CRDTimeout               int      `env:"AWX_CRD_TIMEOUT"`             // in minutes
+	ReconcileGracePeriod     int      `env:"AWX_RECONCILE_GRACE_PERIOD"`  // in minutes, time the operator has to pick up the AWX instance
+	WaitTimeout              int      `env:"AWX_WAIT_TIMEOUT"`            // in minutes, for the AWX components to become ready
+	InitialWaitDelay         int      `env:"AWX_INITIAL_WAIT_DELAY"`      // in seconds, time the operator has to create the AWX objects before the wait polls
+	ForceReconcile           bool     `env:"AWX_FORCE_RECONCILE"`         // annotate the AWX CR after applying it so the operator reconciles at once
+
+	// AWX CR status conditions, as Type=Status[:Reason] rules
+	SuccessConditions []string `env:"AWX_SUCCESS_CONDITIONS"` // any of them means the instance is processed
+	FailureConditions []string `env:"AWX_FAILURE_CONDITIONS"` // any of them fails the deployment
+	WarningConditions []string `env:"AWX_WARNING_CONDITIONS"` // only logged, also when they match a failure rule
+
+	// Apply settings
+	ServerSideApply      bool     `env:"AWX_SERVER_SIDE_APPLY"`  // apply manifests with server-side apply
+	RecreateImmutable    bool     `env:"AWX_RECREATE_IMMUTABLE"` // delete and recreate objects with changed immutable fields
+	RecreateVolumeClaims bool     `env:"AWX_RECREATE_PVCS"`      // also allow recreating PVCs, which loses their data
+	KindPriorities       []string `env:"AWX_KIND_PRIORITY"`      // Kind=priority entries overriding the apply order of kinds
+	ManifestSource       string   `env:"AWX_MANIFEST_SOURCE"`    // auto, files or kustomize, auto builds the manifests directory when it has a kustomization
+	AdoptExisting        string   `env:"AWX_ADOPT_EXISTING"`     // skip, adopt or fail on existing objects the deployer does not manage
+
+	// ProtectedFields are Kind/name[:path] entries that updates leave as
+	// they are live, see FieldProtection
+	ProtectedFields []string `env:"AWX_PROTECTED_FIELDS" separator:";"`
+
+	// Uninstall settings
+	UninstallGracePeriod int  `env:"AWX_UNINSTALL_GRACE_PERIOD"` // in minutes, time allowed for finalizers to run
+	ForceDelete          bool `env:"AWX_FORCE_DELETE"`           // remove finalizers still blocking deletion after the grace period
+	DeleteVolumeClaims   bool `env:"AWX_DELETE_PVCS"`            // also delete the instance's PVCs, which loses their data
+	DeleteCRDs           bool `env:"AWX_DELETE_CRDS"`            // also delete the AWX CRDs when no AWX resources are left in the cluster
+
+	// DeletePropagation is the propagation policy of the deletes of the
+	// uninstall and the prune: Background, Foreground or Orphan
+	DeletePropagation string `env:"AWX_DELETE_PROPAGATION"`
+
+	// Verification settings
+	TreatWarningsAsErrors bool     `env:"AWX_TREAT_WARNINGS_AS_ERRORS"`
+	WarnOnlyChecks        []string `env:"AWX_WARN_ONLY_CHECKS"`      // checks that only warn on failure
+	SystemNamespaces      []string `env:"AWX_SYSTEM_NAMESPACES"`     // namespaces AWX should not be deployed into
+	VerifyRedis           bool     `env:"AWX_VERIFY_REDIS"`          // check Redis even if the operator version is not known to run it
+	CheckEgress           bool     `env:"AWX_CHECK_EGRESS"`          // check that the cluster can reach the image registries before installing
+	DeepStorageCheck      bool     `env:"AWX_DEEP_STORAGE_CHECK"`    // write and read back a file on the projects volume during verification
+	VerifyAPI             bool     `env:"AWX_VERIFY_API"`            // ping and log in to the AWX API through the ingress during verification
+	VerifyViaService      bool     `env:"AWX_VERIFY_VIA_SERVICE"`    // reach the AWX API through its service instead of the ingress, for runs inside the cluster
+	VerifyDNS             bool     `env:"AWX_VERIFY_DNS"`            // check that the AWX hosts resolve to the ingress address
+	DNSServer             string   `env:"AWX_DNS_SERVER"`            // host[:port] of the DNS server to resolve with, empty uses the system resolver
+	DNSTimeout            int      `env:"AWX_DNS_TIMEOUT"`           // in seconds, per lookup
+	VerifyMigrations      bool     `env:"AWX_VERIFY_MIGRATIONS"`     // wait for AWX to report its database migrations complete during verification
+	VerifyTimeout         int      `env:"AWX_VERIFY_TIMEOUT"`        // in minutes, bounds the API and migrations checks
+	VerifyRetries         int      `env:"AWX_VERIFY_RETRIES"`        // retries of an API request failing with a connection error or 5xx
+	VerifyRetryInterval   int      `env:"AWX_VERIFY_RETRY_INTERVAL"` // in seconds, doubled before each further retry
+	InstanceSelector      string   `env:"AWX_INSTANCE_SELECTOR"`     // label selector of the AWX instances to verify instead of AWX_NAME
+
+	// Pipeline settings
+	Steps  []string `env:"AWX_STEPS"`   // the pipeline steps to run, in order
+	FailAt string   `env:"AWX_FAIL_AT"` // testing aid only: this step fails on purpose instead of running
+
+	// Retry settings
+	PipelineRetries    int `env:"AWX_PIPELINE_RETRIES"`     // extra attempts after a failed deployment
+	PipelineRetryDelay int `env:"AWX_PIPELINE_RETRY_DELAY"` // in seconds
+
+	// Proxy settings, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honored too
+	ProxyURL       string `env:"AWX_PROXY_URL" secret:"true"` // proxy for outbound HTTP calls, may contain credentials
+	PropagateProxy bool   `env:"AWX_PROPAGATE_PROXY"`         // pass the proxy settings to the AWX web, task and EE containers
+
+	// Multi-cluster settings
+	MaxParallelClusters int `env:"AWX_MAX_PARALLEL_CLUSTERS"` // targets deployed at the same time
+
+	// Observability settings
+	OTelEndpoint string `env:"AWX_OTEL_EXPORTER_OTLP_ENDPOINT"` // OTLP/HTTP endpoint, tracing is disabled when empty
+	AuditFile    string `env:"AWX_AUDIT_FILE"`                  // JSONL file every cluster mutation is appended to
+	HealthAddr   string `env:"AWX_HEALTH_ADDR"`                 // address of the /healthz and /status endpoints, disabled when empty
+	EmitEvents   bool   `env:"AWX_EMIT_K8S_EVENTS"`             // record Kubernetes Events for the pipeline steps on the AWX CR
+
+	// State settings
+	StateStore     string `env:"AWX_STATE_STORE"`     // where state such as the audit log is kept, file or configmap
+	StateConfigMap string `env:"AWX_STATE_CONFIGMAP"` // ConfigMap of the configmap state store
+	StateNamespace string `env:"AWX_STATE_NAMESPACE"` // namespace of that ConfigMap, see StateStoreNamespace
+	DeployLock     bool   `env:"AWX_DEPLOY_LOCK"`     // hold a Lease in that namespace while deploying
+	LockTTL        int    `env:"AWX_LOCK_TTL"`        // seconds a crashed holder keeps the deploy lock
+
+	// CheckOperatorLogs enables scanning the operator logs for reconcile failures
+	CheckOperatorLogs bool `env:"AWX_CHECK_OPERATOR_LOGS"`
+
+	// Extra workloads to wait for, e.g. from site-specific manifests
+	ExtraWaitDeployments []string `env:"AWX_EXTRA_WAIT_DEPLOYMENTS"`              // deployments in the AWX namespace
+	ExtraWaitSelectors   []string `env:"AWX_EXTRA_WAIT_SELECTORS" separator:";"`  // pod label selectors
+	ExtraWaitConditions  []string `env:"AWX_EXTRA_WAIT_CONDITIONS" separator:";"` // field conditions on objects in the AWX namespace, see WaitCondition
+
+	// sources records where each value came from, keyed by env var name
+	sources map[string]Source
 }
 
 // NewConfigFromEnv creates a new Config from environment variables with defaults
 func NewConfigFromEnv() (*Config, error) {
+	return newConfig(newEnvReader())
+}
+
+// newConfig creates a new Config from the values the reader resolves
+func newConfig(env *envReader) (*Config, error) {
+	// The profile provides the defaults of the other settings
+	profile := env.getOrDefault("AWX_PROFILE", "")
+	defaults, err := profileDefaults(profile)
+	if err != nil {
+		return nil, err
+	}
+	env.profile = defaults
+
+	// A version lockfile pins versions below explicit env vars
+	versionFilePath := env.getOrDefault("AWX_OPERATOR_VERSION_FILE", "")
+	if versionFilePath != "" {
+		env.versionFile, err = readVersionFile(versionFilePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	cfg := &Config{
+		Profile: profile,
+
 		// Kubernetes settings
-		KubeconfigPath: getEnvOrDefault("KUBECONFIG", "/kubeconfig"),
-		Namespace:      getEnvOrDefault("AWX_NAMESPACE", "awx"),
+		KubeconfigPath:  env.getOrDefault("KUBECONFIG", "/kubeconfig"),
+		Cluster:         env.getOrDefault("AWX_CLUSTER", ""),
+		ExpectedCluster: env.getOrDefault("AWX_EXPECTED_CLUSTER", ""),
+		ConfirmContext:  env.getOrDefault("AWX_CONFIRM_CONTEXT", ""),
+		Namespace:       env.getOrDefault("AWX_NAMESPACE", "awx"),
+		ForceNamespace:  env.getOrDefault("AWX_FORCE_NAMESPACE", ""),
+		ClientRateLimit: env.getOrDefault("AWX_CLIENT_RATE_LIMIT", "default"),
+
+		MaintenanceWindow: env.getOrDefault("AWX_MAINTENANCE_WINDOW", ""),
 
 		// AWX settings
-		AWXName:       getEnvOrDefault("AWX_NAME", "awx-instance"),
-		AWXHostname:   getEnvOrDefault("AWX_HOSTNAME", "awx.sin.padminisys.com"),
-		AdminUser:     getEnvOrDefault("AWX_ADMIN_USER", "admin"),
-		AdminPassword: getEnvOrDefault("AWX_ADMIN_PASSWORD", "admin123!@#"),
+		AWXName:       env.getOrDefault("AWX_NAME", "awx-instance"),
+		AWXHostname:   env.getOrDefault("AWX_HOSTNAME", "awx.sin.padminisys.com"),
+		AdminUser:     env.getOrDefault("AWX_ADMIN_USER", "admin"),
+		AdminPassword: env.getOrDefault("AWX_ADMIN_PASSWORD", ""),
+		ImageVersion:  env.getOrDefault("AWX_IMAGE_VERSION", ""),
+
+		// Password policy settings
+		PasswordPolicy: env.getOrDefault("AWX_PASSWORD_POLICY", DefaultPasswordPolicy),
+
+		// API token settings
+		APITokenScope:  env.getOrDefault("AWX_API_TOKEN_SCOPE", "write"),
+		APITokenSecret: env.getOrDefault("AWX_API_TOKEN_SECRET", ""),
 
 		// Storage settings
-		StorageClass:    getEnvOrDefault("AWX_STORAGE_CLASS", "hostpath"),
-		PostgresStorage: getEnvOrDefault("AWX_POSTGRES_STORAGE", "8Gi"),
-		ProjectsStorage: getEnvOrDefault("AWX_PROJECTS_STORAGE", "8Gi"),
+		StorageClass:    env.getOrDefault("AWX_STORAGE_CLASS", "hostpath"),
+		PostgresStorage: env.getOrDefault("AWX_POSTGRES_STORAGE", "8Gi"),
+		ProjectsStorage: env.getOrDefault("AWX_PROJECTS_STORAGE", "8Gi"),
 
 		// PostgreSQL settings
-		PostgresHost:     getEnvOrDefault("AWX_POSTGRES_HOST", "awx-instance-postgres-15"),
-		PostgresDatabase: getEnvOrDefault("AWX_POSTGRES_DATABASE", "awx"),
-		PostgresUsername: getEnvOrDefault("AWX_POSTGRES_USERNAME", "awx"),
-		PostgresPassword: getEnvOrDefault("AWX_POSTGRES_PASSWORD", "awxpassword"),
+		PostgresHost:     env.getOrDefault("AWX_POSTGRES_HOST", "awx-instance-postgres-15"),
+		PostgresDatabase: env.getOrDefault("AWX_POSTGRES_DATABASE", "awx"),
+		PostgresUsername: env.getOrDefault("AWX_POSTGRES_USERNAME", "awx"),
+		PostgresPassword: env.getOrDefault("AWX_POSTGRES_PASSWORD", "awxpassword"),
+
+		// External Redis settings
+		RedisHost:     env.getOrDefault("AWX_REDIS_HOST", ""),
+		RedisPassword: env.getOrDefault("AWX_REDIS_PASSWORD", ""),
+
+		// Managed PostgreSQL settings
+		PostgresImage:         env.getOrDefault("AWX_POSTGRES_IMAGE", ""),
+		PostgresImageVersion:  env.getOrDefault("AWX_POSTGRES_IMAGE_VERSION", ""),
+		PostgresCPURequest:    env.getOrDefault("AWX_POSTGRES_CPU_REQUEST", ""),
+		PostgresMemoryRequest: env.getOrDefault("AWX_POSTGRES_MEMORY_REQUEST", ""),
+		PostgresCPULimit:      env.getOrDefault("AWX_POSTGRES_CPU_LIMIT", ""),
+		PostgresMemoryLimit:   env.getOrDefault("AWX_POSTGRES_MEMORY_LIMIT", ""),
+
+		// Image settings
+		ImagePullPolicy: env.getOrDefault("AWX_IMAGE_PULL_POLICY", ""),
+
+		// Security settings
+		PSSProfile: env.getOrDefault("AWX_PSS_PROFILE", ""),
+		PSAEnforce: env.getOrDefault("AWX_PSA_ENFORCE", ""),
 
 		// Ingress settings
-		IngressClassName: getEnvOrDefault("AWX_INGRESS_CLASS", "nginx"),
-		TLSSecretName:    getEnvOrDefault("AWX_TLS_SECRET", "awx-tls"),
-		CertIssuer:       getEnvOrDefault("AWX_CERT_ISSUER", "letsencrypt-prod"),
+		IngressClassName: env.getOrDefault("AWX_INGRESS_CLASS", "nginx"),
+		TLSSecretName:    env.getOrDefault("AWX_TLS_SECRET", "awx-tls"),
+		CertIssuer:       env.getOrDefault("AWX_CERT_ISSUER", "letsencrypt-prod"),
+		TLSCertFile:      env.getOrDefault("AWX_TLS_CERT_FILE", ""),
+		TLSKeyFile:       env.getOrDefault("AWX_TLS_KEY_FILE", ""),
+
+		IngressController: env.getOrDefault("AWX_INGRESS_CONTROLLER", ""),
+		IngressPath:       strings.TrimSuffix(env.getOrDefault("AWX_INGRESS_PATH", ""), "/"),
+
+		// Apply settings
+		ManifestSource: env.getOrDefault("AWX_MANIFEST_SOURCE", ManifestSourceAuto),
+		AdoptExisting:  env.getOrDefault("AWX_ADOPT_EXISTING", AdoptExistingAdopt),
 
 		// Operator settings
-		OperatorVersion: getEnvOrDefault("AWX_OPERATOR_VERSION", "2.19.1"),
+		OperatorVersion:      env.getOrDefault("AWX_OPERATOR_VERSION", DefaultOperatorVersion),
+		OperatorVersionFile:  versionFilePath,
+		CompatibilityMatrix:  env.getOrDefault("AWX_COMPATIBILITY_MATRIX", ""),
+		OperatorManifestPath: env.getOrDefault("AWX_OPERATOR_MANIFEST_PATH", "manifests/awx-operator.yaml"),
+		OperatorPodSelector:  env.getOrDefault("AWX_OPERATOR_POD_SELECTOR", "control-plane=controller-manager"),
+
+		// Proxy settings
+		ProxyURL: env.getOrDefault("AWX_PROXY_URL", ""),
+
+		// Observability settings
+		OTelEndpoint: env.getOrDefault("AWX_OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		AuditFile:    env.getOrDefault("AWX_AUDIT_FILE", ""),
+		HealthAddr:   env.getOrDefault("AWX_HEALTH_ADDR", ""),
+
+		// State settings
+		StateStore:     env.getOrDefault("AWX_STATE_STORE", "file"),
+		StateConfigMap: env.getOrDefault("AWX_STATE_CONFIGMAP", "awx-deployer-state"),
+		StateNamespace: env.getOrDefault("AWX_STATE_NAMESPACE", ""),
+
+		sources: env.sources,
+	}
+
+	// The Postgres major version defaults to the one of the pinned image
+	defaultPostgresVersion := majorVersion(cfg.PostgresImageVersion)
+	if defaultPostgresVersion == "" {
+		defaultPostgresVersion = "15"
+	}
+	cfg.PostgresVersion = env.getOrDefault("AWX_POSTGRES_VERSION", defaultPostgresVersion)
+
+	// The operator is installed next to the AWX instance unless told otherwise
+	cfg.OperatorNamespace = env.getOrDefault("AWX_OPERATOR_NAMESPACE", cfg.Namespace)
+
+	// A forced namespace is where the AWX instance ends up
+	if cfg.ForceNamespace != "" {
+		cfg.Namespace = cfg.ForceNamespace
 	}
 
 	// Parse integer values
-	var err error
-	cfg.PostgresPort, err = strconv.Atoi(getEnvOrDefault("AWX_POSTGRES_PORT", "5432"))
+	cfg.PostgresPort, err = strconv.Atoi(env.getOrDefault("AWX_POSTGRES_PORT", "5432"))
 	if err != nil {
 		return nil, fmt.Errorf("invalid AWX_POSTGRES_PORT: %v", err)
 	}
 
-	cfg.OperatorTimeout, err = strconv.Atoi(getEnvOrDefault("AWX_OPERATOR_TIMEOUT", "15"))
+	cfg.RedisExternal, err = strconv.ParseBool(env.getOrDefault("AWX_REDIS_EXTERNAL", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_REDIS_EXTERNAL: %v", err)
+	}
+
+	cfg.RedisPort, err = strconv.Atoi(env.getOrDefault("AWX_REDIS_PORT", "6379"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_REDIS_PORT: %v", err)
+	}
+
+	cfg.OperatorTimeout, err = strconv.Atoi(env.getOrDefault("AWX_OPERATOR_TIMEOUT", "15"))
 	if err != nil {
 		return nil, fmt.Errorf("invalid AWX_OPERATOR_TIMEOUT: %v", err)
 	}
 
+	cfg.CRDTimeout, err = strconv.Atoi(env.getOrDefault("AWX_CRD_TIMEOUT", "2"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_CRD_TIMEOUT: %v", err)
+	}
+
+	cfg.ForceReconcile, err = strconv.ParseBool(env.getOrDefault("AWX_FORCE_RECONCILE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_FORCE_RECONCILE: %v", err)
+	}
+
+	cfg.CheckOperatorLogs, err = strconv.ParseBool(env.getOrDefault("AWX_CHECK_OPERATOR_LOGS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_CHECK_OPERATOR_LOGS: %v", err)
+	}
+
+	cfg.WaitIngress, err = strconv.ParseBool(env.getOrDefault("AWX_WAIT_INGRESS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_WAIT_INGRESS: %v", err)
+	}
+
+	cfg.IngressTimeout, err = strconv.Atoi(env.getOrDefault("AWX_INGRESS_TIMEOUT", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_INGRESS_TIMEOUT: %v", err)
+	}
+
+	cfg.CertTimeout, err = strconv.Atoi(env.getOrDefault("AWX_CERT_TIMEOUT", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_CERT_TIMEOUT: %v", err)
+	}
+
+	cfg.TLS, err = strconv.ParseBool(env.getOrDefault("AWX_TLS", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_TLS: %v", err)
+	}
+
+	cfg.Replicas, err = strconv.Atoi(env.getOrDefault("AWX_REPLICAS", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_REPLICAS: %v", err)
+	}
+
+	cfg.RotateAdmin, err = strconv.ParseBool(env.getOrDefault("AWX_ROTATE_ADMIN", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_ROTATE_ADMIN: %v", err)
+	}
+
+	cfg.EmitAPIToken, err = strconv.ParseBool(env.getOrDefault("AWX_EMIT_API_TOKEN", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_EMIT_API_TOKEN: %v", err)
+	}
+
+	cfg.APITokenExpiry, err = strconv.Atoi(env.getOrDefault("AWX_API_TOKEN_EXPIRY", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_API_TOKEN_EXPIRY: %v", err)
+	}
+
+	cfg.ServerSideApply, err = strconv.ParseBool(env.getOrDefault("AWX_SERVER_SIDE_APPLY", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_SERVER_SIDE_APPLY: %v", err)
+	}
+
+	cfg.RecreateImmutable, err = strconv.ParseBool(env.getOrDefault("AWX_RECREATE_IMMUTABLE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_RECREATE_IMMUTABLE: %v", err)
+	}
+
+	cfg.RecreateVolumeClaims, err = strconv.ParseBool(env.getOrDefault("AWX_RECREATE_PVCS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_RECREATE_PVCS: %v", err)
+	}
+
+	cfg.OperatorClusterScoped, err = strconv.ParseBool(env.getOrDefault("AWX_OPERATOR_CLUSTER_SCOPED", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_OPERATOR_CLUSTER_SCOPED: %v", err)
+	}
+
+	cfg.ReconcileGracePeriod, err = strconv.Atoi(env.getOrDefault("AWX_RECONCILE_GRACE_PERIOD", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_RECONCILE_GRACE_PERIOD: %v", err)
+	}
+
+	cfg.WaitTimeout, err = strconv.Atoi(env.getOrDefault("AWX_WAIT_TIMEOUT", "15"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_WAIT_TIMEOUT: %v", err)
+	}
+
+	cfg.InitialWaitDelay, err = strconv.Atoi(env.getOrDefault("AWX_INITIAL_WAIT_DELAY", "10"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_INITIAL_WAIT_DELAY: %v", err)
+	}
+
+	cfg.SkipOperatorInstall, err = strconv.ParseBool(env.getOrDefault("AWX_SKIP_OPERATOR_INSTALL", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_SKIP_OPERATOR_INSTALL: %v", err)
+	}
+
+	cfg.UninstallGracePeriod, err = strconv.Atoi(env.getOrDefault("AWX_UNINSTALL_GRACE_PERIOD", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_UNINSTALL_GRACE_PERIOD: %v", err)
+	}
+
+	cfg.ForceDelete, err = strconv.ParseBool(env.getOrDefault("AWX_FORCE_DELETE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_FORCE_DELETE: %v", err)
+	}
+
+	cfg.DeleteVolumeClaims, err = strconv.ParseBool(env.getOrDefault("AWX_DELETE_PVCS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_DELETE_PVCS: %v", err)
+	}
+
+	cfg.DeleteCRDs, err = strconv.ParseBool(env.getOrDefault("AWX_DELETE_CRDS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_DELETE_CRDS: %v", err)
+	}
+	cfg.DeletePropagation = env.getOrDefault("AWX_DELETE_PROPAGATION", "Background")
+
+	cfg.TreatWarningsAsErrors, err = strconv.ParseBool(env.getOrDefault("AWX_TREAT_WARNINGS_AS_ERRORS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_TREAT_WARNINGS_AS_ERRORS: %v", err)
+	}
+
+	cfg.VerifyRedis, err = strconv.ParseBool(env.getOrDefault("AWX_VERIFY_REDIS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_VERIFY_REDIS: %v", err)
+	}
+
+	cfg.CheckEgress, err = strconv.ParseBool(env.getOrDefault("AWX_CHECK_EGRESS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_CHECK_EGRESS: %v", err)
+	}
+
+	cfg.PostgresRecreate, err = strconv.ParseBool(env.getOrDefault("AWX_POSTGRES_RECREATE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_POSTGRES_RECREATE: %v", err)
+	}
+
+	cfg.DeepStorageCheck, err = strconv.ParseBool(env.getOrDefault("AWX_DEEP_STORAGE_CHECK", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_DEEP_STORAGE_CHECK: %v", err)
+	}
+
+	cfg.VerifyAPI, err = strconv.ParseBool(env.getOrDefault("AWX_VERIFY_API", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_VERIFY_API: %v", err)
+	}
+
+	cfg.VerifyViaService, err = strconv.ParseBool(env.getOrDefault("AWX_VERIFY_VIA_SERVICE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_VERIFY_VIA_SERVICE: %v", err)
+	}
+
+	cfg.VerifyDNS, err = strconv.ParseBool(env.getOrDefault("AWX_VERIFY_DNS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_VERIFY_DNS: %v", err)
+	}
+	cfg.DNSServer = env.getOrDefault("AWX_DNS_SERVER", "")
+	cfg.DNSTimeout, err = strconv.Atoi(env.getOrDefault("AWX_DNS_TIMEOUT", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_DNS_TIMEOUT: %v", err)
+	}
+
+	cfg.VerifyMigrations, err = strconv.ParseBool(env.getOrDefault("AWX_VERIFY_MIGRATIONS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_VERIFY_MIGRATIONS: %v", err)
+	}
+
+	cfg.VerifyTimeout, err = strconv.Atoi(env.getOrDefault("AWX_VERIFY_TIMEOUT", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_VERIFY_TIMEOUT: %v", err)
+	}
+
+	cfg.VerifyRetries, err = strconv.Atoi(env.getOrDefault("AWX_VERIFY_RETRIES", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_VERIFY_RETRIES: %v", err)
+	}
+
+	cfg.VerifyRetryInterval, err = strconv.Atoi(env.getOrDefault("AWX_VERIFY_RETRY_INTERVAL", "2"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_VERIFY_RETRY_INTERVAL: %v", err)
+	}
+
+	cfg.PipelineRetries, err = strconv.Atoi(env.getOrDefault("AWX_PIPELINE_RETRIES", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_PIPELINE_RETRIES: %v", err)
+	}
+
+	cfg.PipelineRetryDelay, err = strconv.Atoi(env.getOrDefault("AWX_PIPELINE_RETRY_DELAY", "30"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_PIPELINE_RETRY_DELAY: %v", err)
+	}
+
+	cfg.EmitEvents, err = strconv.ParseBool(env.getOrDefault("AWX_EMIT_K8S_EVENTS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_EMIT_K8S_EVENTS: %v", err)
+	}
+
+	cfg.PropagateProxy, err = strconv.ParseBool(env.getOrDefault("AWX_PROPAGATE_PROXY", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_PROPAGATE_PROXY: %v", err)
+	}
+
+	cfg.MaxParallelClusters, err = strconv.Atoi(env.getOrDefault("AWX_MAX_PARALLEL_CLUSTERS", "2"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_MAX_PARALLEL_CLUSTERS: %v", err)
+	}
+
+	cfg.AllowWeakPassword, err = strconv.ParseBool(env.getOrDefault("AWX_ALLOW_WEAK_PASSWORD", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_ALLOW_WEAK_PASSWORD: %v", err)
+	}
+
+	cfg.StrictPassword, err = strconv.ParseBool(env.getOrDefault("AWX_STRICT_PASSWORD", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_STRICT_PASSWORD: %v", err)
+	}
+	if cfg.AdminPassword == DefaultAdminPassword && !cfg.StrictPassword {
+		log.Printf("Warning: AWX_ADMIN_PASSWORD is the default password of the bundled manifests, anyone who read them can log in. Only use it for development.")
+	}
+
+	cfg.DeployLock, err = strconv.ParseBool(env.getOrDefault("AWX_DEPLOY_LOCK", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_DEPLOY_LOCK: %v", err)
+	}
+	cfg.LockTTL, err = strconv.Atoi(env.getOrDefault("AWX_LOCK_TTL", "120"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWX_LOCK_TTL: %v", err)
+	}
+
+	// Without a configured admin password a random one satisfying the policy is used
+	if cfg.AdminPassword == "" {
+		policy, err := ParsePasswordPolicy(cfg.PasswordPolicy)
+		if err != nil {
+			return nil, err
+		}
+		cfg.AdminPassword, err = policy.Generate()
+		if err != nil {
+			return nil, err
+		}
+		cfg.AdminPasswordGenerated = true
+	}
+
+	if preserve := env.getOrDefault("AWX_PRESERVE_PREFIXES", "kubectl.kubernetes.io/,awx.ansible.com/"); preserve != "none" {
+		cfg.PreservePrefixes = splitList(preserve)
+	}
+	cfg.AWXHostnameAliases = splitList(env.getOrDefault("AWX_HOSTNAME_ALIASES", ""))
+	cfg.SuccessConditions = splitList(env.getOrDefault("AWX_SUCCESS_CONDITIONS", "Running=True"))
+	cfg.FailureConditions = splitList(env.getOrDefault("AWX_FAILURE_CONDITIONS", "Failure=True"))
+	cfg.WarningConditions = splitList(env.getOrDefault("AWX_WARNING_CONDITIONS", ""))
+	cfg.OperatorKustomizePatches = splitList(env.getOrDefault("AWX_OPERATOR_KUSTOMIZE_PATCHES", ""))
+	cfg.Steps = splitList(env.getOrDefault("AWX_STEPS", "preflight,operator,apply,wait,verify"))
+	cfg.FailAt = env.getOrDefault("AWX_FAIL_AT", "")
+	cfg.WarnOnlyChecks = splitList(env.getOrDefault("AWX_WARN_ONLY_CHECKS", "ingress"))
+	cfg.InstanceSelector = env.getOrDefault("AWX_INSTANCE_SELECTOR", "")
+	cfg.KindPriorities = splitList(env.getOrDefault("AWX_KIND_PRIORITY", ""))
+	cfg.RegistryMirrors = splitList(env.getOrDefault("AWX_REGISTRY_MIRROR", ""))
+	cfg.SystemNamespaces = splitList(env.getOrDefault("AWX_SYSTEM_NAMESPACES", "default,kube-system,kube-public,kube-node-lease"))
+	cfg.ExtraWaitDeployments = splitList(env.getOrDefault("AWX_EXTRA_WAIT_DEPLOYMENTS", ""))
+	// annotation values such as ALB listen ports contain commas
+	cfg.IngressAnnotations = splitSelectors(env.getOrDefault("AWX_INGRESS_ANNOTATIONS", ""))
+	// selectors contain commas themselves
+	cfg.ExtraWaitSelectors = splitSelectors(env.getOrDefault("AWX_EXTRA_WAIT_SELECTORS", ""))
+	cfg.ExtraWaitConditions = splitSelectors(env.getOrDefault("AWX_EXTRA_WAIT_CONDITIONS", ""))
+	cfg.ProtectedFields = splitSelectors(env.getOrDefault("AWX_PROTECTED_FIELDS", ""))
+
 	// Validate required fields
 	if err := cfg.validate(); err != nil {
 		return nil, fmt.Errorf("configuration validation failed: %v", err)
@@ -98,19 +697,353 @@ func (c *Config) validate() error {
 	if c.KubeconfigPath == "" {
 		return fmt.Errorf("KUBECONFIG is required")
 	}
+	// A zero timeout would cancel the wait it bounds at once
+	for _, timeout := range []struct {
+		key     string
+		minutes int
+	}{
+		{"AWX_OPERATOR_TIMEOUT", c.OperatorTimeout},
+		{"AWX_CRD_TIMEOUT", c.CRDTimeout},
+		{"AWX_WAIT_TIMEOUT", c.WaitTimeout},
+		{"AWX_INGRESS_TIMEOUT", c.IngressTimeout},
+		{"AWX_CERT_TIMEOUT", c.CertTimeout},
+		{"AWX_VERIFY_TIMEOUT", c.VerifyTimeout},
+		{"AWX_UNINSTALL_GRACE_PERIOD", c.UninstallGracePeriod},
+	} {
+		if timeout.minutes < minTimeoutMinutes {
+			return fmt.Errorf("%s must be at least %d minute(s), got %d", timeout.key, minTimeoutMinutes, timeout.minutes)
+		}
+	}
+	if c.ClientRateLimit != "default" && c.ClientRateLimit != "off" {
+		return fmt.Errorf("invalid AWX_CLIENT_RATE_LIMIT %q (expected default or off)", c.ClientRateLimit)
+	}
 	if c.AWXHostname == "" {
 		return fmt.Errorf("AWX_HOSTNAME is required")
 	}
+	for _, host := range c.Hostnames() {
+		if problems := validation.IsDNS1123Subdomain(host); len(problems) > 0 {
+			return fmt.Errorf("invalid AWX hostname %q: %s", host, strings.Join(problems, "; "))
+		}
+	}
 	if c.AdminPassword == "" {
 		return fmt.Errorf("AWX_ADMIN_PASSWORD is required")
 	}
+	if c.AdminPassword == DefaultAdminPassword && c.StrictPassword {
+		return fmt.Errorf("AWX_ADMIN_PASSWORD is the default password of the bundled manifests, which AWX_STRICT_PASSWORD forbids (set another one, or leave it unset to generate one)")
+	}
+	policy, err := ParsePasswordPolicy(c.PasswordPolicy)
+	if err != nil {
+		return err
+	}
+	if err := policy.Check(c.AdminPassword); err != nil && !c.AllowWeakPassword {
+		return fmt.Errorf("AWX_ADMIN_PASSWORD does not meet AWX_PASSWORD_POLICY: %v (set AWX_ALLOW_WEAK_PASSWORD=true to use it anyway)", err)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("AWX_TLS_CERT_FILE and AWX_TLS_KEY_FILE must be set together")
+	}
+	if major := majorVersion(c.PostgresImageVersion); major != "" && major != c.PostgresVersion {
+		return fmt.Errorf("AWX_POSTGRES_IMAGE_VERSION %s does not match AWX_POSTGRES_VERSION %s", c.PostgresImageVersion, c.PostgresVersion)
+	}
+	if c.PSSProfile != "" && c.PSSProfile != PSSProfileRestricted {
+		return fmt.Errorf("invalid AWX_PSS_PROFILE %q (supported: %s)", c.PSSProfile, PSSProfileRestricted)
+	}
+	switch c.PSAEnforce {
+	case "", "privileged", "baseline", "restricted":
+	default:
+		return fmt.Errorf("invalid AWX_PSA_ENFORCE %q (supported: privileged, baseline, restricted)", c.PSAEnforce)
+	}
+	if !isSemver(c.OperatorVersion) {
+		return fmt.Errorf("invalid AWX_OPERATOR_VERSION %q: not a semantic version (e.g. 2.19.1)", c.OperatorVersion)
+	}
+	if c.ImageVersion != "" && !isSemver(c.ImageVersion) {
+		return fmt.Errorf("invalid AWX_IMAGE_VERSION %q: not a semantic version (e.g. 24.6.1)", c.ImageVersion)
+	}
+	if c.RedisExternal {
+		if c.RedisHost == "" {
+			return fmt.Errorf("AWX_REDIS_HOST is required when AWX_REDIS_EXTERNAL is true")
+		}
+		if c.RedisPort < 1 || c.RedisPort > 65535 {
+			return fmt.Errorf("AWX_REDIS_PORT must be between 1 and 65535")
+		}
+	}
+	if len(c.SuccessConditions) == 0 {
+		return fmt.Errorf("AWX_SUCCESS_CONDITIONS must not be empty")
+	}
+	for _, list := range []struct {
+		key   string
+		rules []string
+	}{
+		{"AWX_SUCCESS_CONDITIONS", c.SuccessConditions},
+		{"AWX_FAILURE_CONDITIONS", c.FailureConditions},
+		{"AWX_WARNING_CONDITIONS", c.WarningConditions},
+	} {
+		if _, err := parseConditionRules(list.key, list.rules); err != nil {
+			return err
+		}
+	}
+	if c.ReconcileGracePeriod < 0 {
+		return fmt.Errorf("AWX_RECONCILE_GRACE_PERIOD must not be negative")
+	}
+	if c.DNSTimeout < 1 {
+		return fmt.Errorf("AWX_DNS_TIMEOUT must be at least 1 second")
+	}
+	if c.InitialWaitDelay < 0 {
+		return fmt.Errorf("AWX_INITIAL_WAIT_DELAY must not be negative")
+	}
+	if c.Replicas < 0 {
+		return fmt.Errorf("AWX_REPLICAS must not be negative")
+	}
+	if c.APITokenScope != "read" && c.APITokenScope != "write" {
+		return fmt.Errorf("invalid AWX_API_TOKEN_SCOPE %q (expected read or write)", c.APITokenScope)
+	}
+	if c.APITokenExpiry < 0 {
+		return fmt.Errorf("AWX_API_TOKEN_EXPIRY must not be negative")
+	}
+	if c.PipelineRetries < 0 || c.PipelineRetryDelay < 0 {
+		return fmt.Errorf("AWX_PIPELINE_RETRIES and AWX_PIPELINE_RETRY_DELAY must not be negative")
+	}
+	if c.StateStore != "file" && c.StateStore != "configmap" {
+		return fmt.Errorf("invalid AWX_STATE_STORE %q (expected file or configmap)", c.StateStore)
+	}
+	switch c.DeletePropagation {
+	case "Background", "Foreground", "Orphan":
+	default:
+		return fmt.Errorf("invalid AWX_DELETE_PROPAGATION %q (supported: Background, Foreground, Orphan)", c.DeletePropagation)
+	}
+	if c.LockTTL < 10 {
+		return fmt.Errorf("AWX_LOCK_TTL must be at least 10 seconds")
+	}
+	if c.VerifyRetries < 0 || c.VerifyRetryInterval < 0 {
+		return fmt.Errorf("AWX_VERIFY_RETRIES and AWX_VERIFY_RETRY_INTERVAL must not be negative")
+	}
+	if strings.TrimSpace(c.OperatorPodSelector) == "" {
+		return fmt.Errorf("AWX_OPERATOR_POD_SELECTOR must not be empty")
+	}
+	if _, err := labels.Parse(c.OperatorPodSelector); err != nil {
+		return fmt.Errorf("invalid AWX_OPERATOR_POD_SELECTOR %q: %v", c.OperatorPodSelector, err)
+	}
+	if _, err := labels.Parse(c.InstanceSelector); err != nil {
+		return fmt.Errorf("invalid AWX_INSTANCE_SELECTOR %q: %v", c.InstanceSelector, err)
+	}
+	for _, selector := range c.ExtraWaitSelectors {
+		if _, err := labels.Parse(selector); err != nil {
+			return fmt.Errorf("invalid selector %q in AWX_EXTRA_WAIT_SELECTORS: %v", selector, err)
+		}
+	}
+	if err := validateProxyURL(c.ProxyURL); err != nil {
+		return err
+	}
+	if c.MaxParallelClusters < 1 {
+		return fmt.Errorf("AWX_MAX_PARALLEL_CLUSTERS must be at least 1")
+	}
+	switch c.ImagePullPolicy {
+	case "", "Always", "IfNotPresent", "Never":
+	default:
+		return fmt.Errorf("invalid AWX_IMAGE_PULL_POLICY %q (supported: Always, IfNotPresent, Never)", c.ImagePullPolicy)
+	}
+	for _, mirror := range c.RegistryMirrors {
+		from, to, ok := strings.Cut(mirror, "=")
+		if !ok || from == "" || to == "" || strings.Contains(from, "/") || strings.Contains(to, "://") {
+			return fmt.Errorf("invalid AWX_REGISTRY_MIRROR entry %q (expected registry=mirror, e.g. quay.io=mirror.local/quay)", mirror)
+		}
+	}
+	switch c.ManifestSource {
+	case ManifestSourceAuto, ManifestSourceFiles, ManifestSourceKustomize:
+	default:
+		return fmt.Errorf("invalid AWX_MANIFEST_SOURCE %q (supported: %s, %s, %s)", c.ManifestSource, ManifestSourceAuto, ManifestSourceFiles, ManifestSourceKustomize)
+	}
+	switch c.AdoptExisting {
+	case AdoptExistingSkip, AdoptExistingAdopt, AdoptExistingFail:
+	default:
+		return fmt.Errorf("invalid AWX_ADOPT_EXISTING %q (supported: %s, %s, %s)", c.AdoptExisting, AdoptExistingSkip, AdoptExistingAdopt, AdoptExistingFail)
+	}
+	if c.IngressPath != "" && (!strings.HasPrefix(c.IngressPath, "/") || strings.ContainsAny(c.IngressPath, " ?#")) {
+		return fmt.Errorf("invalid AWX_INGRESS_PATH %q (expected a path starting with /, e.g. /awx)", c.IngressPath)
+	}
+	switch c.IngressController {
+	case "", "nginx", "traefik", "alb":
+	default:
+		return fmt.Errorf("invalid AWX_INGRESS_CONTROLLER %q (supported: nginx, traefik, alb)", c.IngressController)
+	}
+	for _, entry := range c.IngressAnnotations {
+		key, _, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid AWX_INGRESS_ANNOTATIONS entry %q (expected key=value, e.g. nginx.ingress.kubernetes.io/proxy-body-size=0)", entry)
+		}
+		if problems := validation.IsQualifiedName(strings.ToLower(strings.TrimSpace(key))); len(problems) > 0 {
+			return fmt.Errorf("invalid annotation key %q in AWX_INGRESS_ANNOTATIONS: %s", strings.TrimSpace(key), strings.Join(problems, "; "))
+		}
+	}
+	if c.ExpectedCluster != "" {
+		if _, err := ParseClusterExpectation(c.ExpectedCluster); err != nil {
+			return fmt.Errorf("AWX_EXPECTED_CLUSTER: %v", err)
+		}
+	}
+	if c.MaintenanceWindow != "" {
+		if _, err := ParseMaintenanceWindow(c.MaintenanceWindow); err != nil {
+			return fmt.Errorf("AWX_MAINTENANCE_WINDOW: %v", err)
+		}
+	}
+	for _, entry := range c.ExtraWaitConditions {
+		if _, err := ParseWaitCondition(entry); err != nil {
+			return fmt.Errorf("AWX_EXTRA_WAIT_CONDITIONS: %v", err)
+		}
+	}
+	for _, entry := range c.ProtectedFields {
+		if _, err := ParseFieldProtection(entry); err != nil {
+			return fmt.Errorf("AWX_PROTECTED_FIELDS: %v", err)
+		}
+	}
+	for _, entry := range c.KindPriorities {
+		kind, priority, ok := strings.Cut(entry, "=")
+		if _, err := strconv.Atoi(strings.TrimSpace(priority)); !ok || strings.TrimSpace(kind) == "" || err != nil {
+			return fmt.Errorf("invalid AWX_KIND_PRIORITY entry %q (expected Kind=priority, e.g. Job=15)", entry)
+		}
+	}
+	for key, value := range map[string]string{
+		"AWX_POSTGRES_CPU_REQUEST":    c.PostgresCPURequest,
+		"AWX_POSTGRES_MEMORY_REQUEST": c.PostgresMemoryRequest,
+		"AWX_POSTGRES_CPU_LIMIT":      c.PostgresCPULimit,
+		"AWX_POSTGRES_MEMORY_LIMIT":   c.PostgresMemoryLimit,
+	} {
+		if value == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
 	return nil
 }
 
-// getEnvOrDefault returns environment variable value or default if not set
-func getEnvOrDefault(key, defaultValue string) string {
+// ClientThrottling reports whether the Kubernetes client rate limits its
+// requests, which AWX_CLIENT_RATE_LIMIT=off turns off
+func (c *Config) ClientThrottling() bool {
+	return c.ClientRateLimit != "off"
+}
+
+// PostgresDeploymentName returns the name the operator gives the managed Postgres workload
+func (c *Config) PostgresDeploymentName() string {
+	return fmt.Sprintf("%s-postgres-%s", c.AWXName, c.PostgresVersion)
+}
+
+// KindPriorityMap returns the apply order priorities of AWX_KIND_PRIORITY
+// keyed by kind
+func (c *Config) KindPriorityMap() map[string]int {
+	priorities := make(map[string]int)
+	for _, entry := range c.KindPriorities {
+		if kind, priority, ok := strings.Cut(entry, "="); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(priority)); err == nil {
+				priorities[strings.TrimSpace(kind)] = n
+			}
+		}
+	}
+	return priorities
+}
+
+// RegistryMirrorMap returns the registry mirrors keyed by the registry they replace
+func (c *Config) RegistryMirrorMap() map[string]string {
+	mirrors := make(map[string]string)
+	for _, mirror := range c.RegistryMirrors {
+		if from, to, ok := strings.Cut(mirror, "="); ok {
+			mirrors[strings.TrimSpace(from)] = strings.TrimSpace(to)
+		}
+	}
+	return mirrors
+}
+
+// IngressAnnotationMap returns the annotations of AWX_INGRESS_ANNOTATIONS
+// keyed by annotation
+func (c *Config) IngressAnnotationMap() map[string]string {
+	annotations := make(map[string]string)
+	for _, entry := range c.IngressAnnotations {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			annotations[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return annotations
+}
+
+// majorVersion returns the leading numeric component of an image tag such as
+// "15.4-alpine", or an empty string for tags like "latest"
+func majorVersion(version string) string {
+	end := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		return version
+	}
+	return version[:end]
+}
+
+// Hostnames returns AWX_HOSTNAME followed by AWX_HOSTNAME_ALIASES
+func (c *Config) Hostnames() []string {
+	return append([]string{c.AWXHostname}, c.AWXHostnameAliases...)
+}
+
+// splitList splits a comma-separated value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitSelectors splits a semicolon-separated list of label selectors,
+// dropping empty entries
+func splitSelectors(value string) []string {
+	var selectors []string
+	for _, selector := range strings.Split(value, ";") {
+		if selector = strings.TrimSpace(selector); selector != "" {
+			selectors = append(selectors, selector)
+		}
+	}
+	return selectors
+}
+
+// Configured reports whether a setting was given by its env var or the
+// profile rather than left at the built-in default. Settings the static
+// manifests already contain are only applied to them when configured, so the
+// manifests stay authoritative otherwise.
+func (c *Config) Configured(key string) bool {
+	source, ok := c.sources[key]
+	return ok && source != SourceDefault
+}
+
+// envReader reads environment variables and records the source of each value
+type envReader struct {
+	sources map[string]Source
+	// configMap holds the data of the configuration ConfigMap
+	configMap map[string]string
+	// versionFile holds the versions pinned by the version lockfile
+	versionFile map[string]string
+	// profile holds the defaults of the selected profile
+	profile map[string]string
+}
+
+func newEnvReader() *envReader {
+	return &envReader{sources: make(map[string]Source)}
+}
+
+// getOrDefault returns environment variable value or default if not set
+func (r *envReader) getOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
+		r.sources[key] = SourceEnv
+		return value
+	}
+	if value, ok := r.configMap[key]; ok && value != "" {
+		r.sources[key] = SourceConfigMap
+		return value
+	}
+	if value, ok := r.versionFile[key]; ok {
+		r.sources[key] = SourceVersionFile
+		return value
+	}
+	if value, ok := r.profile[key]; ok {
+		r.sources[key] = SourceProfile
 		return value
 	}
+	r.sources[key] = SourceDefault
 	return defaultValue
 }
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadEnv creates a Config from the given env vars, on top of an
+// environment with every setting unset
+func loadEnv(t *testing.T, env map[string]string) (*Config, error) {
+	t.Helper()
+	for key := range settingKeys() {
+		t.Setenv(key, "")
+	}
+	for _, key := range []string{"AWX_CONFIG_SOURCE", "AWX_CONFIG_MAP", "AWX_CONFIG_MAP_NAMESPACE"} {
+		t.Setenv(key, "")
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	return NewConfigFromEnv()
+}
+
+// mustLoadEnv is loadEnv for env vars that must be valid
+func mustLoadEnv(t *testing.T, env map[string]string) *Config {
+	t.Helper()
+	cfg, err := loadEnv(t, env)
+	if err != nil {
+		t.Fatalf("NewConfigFromEnv() failed: %v", err)
+	}
+	return cfg
+}
+
+// setting returns the effective setting of an env var
+func setting(t *testing.T, cfg *Config, key string) Setting {
+	t.Helper()
+	for _, s := range cfg.Effective() {
+		if s.Env == key {
+			return s
+		}
+	}
+	t.Fatalf("no effective setting for %s", key)
+	return Setting{}
+}
+
+func TestValidateSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "restricted PSS profile", env: map[string]string{"AWX_PSS_PROFILE": "restricted"}},
+		{name: "unknown PSS profile", env: map[string]string{"AWX_PSS_PROFILE": "baseline"}, wantErr: true},
+		{name: "wait timeout", env: map[string]string{"AWX_WAIT_TIMEOUT": "30"}},
+		{name: "zero wait timeout", env: map[string]string{"AWX_WAIT_TIMEOUT": "0"}, wantErr: true},
+		{name: "invalid wait timeout", env: map[string]string{"AWX_WAIT_TIMEOUT": "15m"}, wantErr: true},
+		{name: "image pull policy", env: map[string]string{"AWX_IMAGE_PULL_POLICY": "IfNotPresent"}},
+		{name: "unknown image pull policy", env: map[string]string{"AWX_IMAGE_PULL_POLICY": "ifnotpresent"}, wantErr: true},
+		{name: "registry mirrors", env: map[string]string{"AWX_REGISTRY_MIRROR": "docker.io=mirror.local/docker,quay.io=mirror.local/quay"}},
+		{name: "registry mirror without mirror", env: map[string]string{"AWX_REGISTRY_MIRROR": "quay.io"}, wantErr: true},
+		{name: "registry mirror with empty registry", env: map[string]string{"AWX_REGISTRY_MIRROR": "=mirror.local/quay"}, wantErr: true},
+		{name: "registry mirror of a repository", env: map[string]string{"AWX_REGISTRY_MIRROR": "quay.io/ansible=mirror.local/quay"}, wantErr: true},
+		{name: "registry mirror with scheme", env: map[string]string{"AWX_REGISTRY_MIRROR": "quay.io=https://mirror.local/quay"}, wantErr: true},
+		{name: "external Redis", env: map[string]string{"AWX_REDIS_EXTERNAL": "true", "AWX_REDIS_HOST": "redis.example.com"}},
+		{name: "external Redis without host", env: map[string]string{"AWX_REDIS_EXTERNAL": "true"}, wantErr: true},
+		{name: "external Redis with invalid port", env: map[string]string{"AWX_REDIS_EXTERNAL": "true", "AWX_REDIS_HOST": "redis.example.com", "AWX_REDIS_PORT": "70000"}, wantErr: true},
+		{name: "Redis host unused", env: map[string]string{"AWX_REDIS_HOST": "redis.example.com"}},
+		{name: "extra wait selectors", env: map[string]string{"AWX_EXTRA_WAIT_SELECTORS": "app=ldap-sync;tier in (cache)"}},
+		{name: "invalid extra wait selector", env: map[string]string{"AWX_EXTRA_WAIT_SELECTORS": "app=ldap-sync;tier in cache"}, wantErr: true},
+		{name: "client rate limit off", env: map[string]string{"AWX_CLIENT_RATE_LIMIT": "off"}},
+		{name: "client rate limit default", env: map[string]string{"AWX_CLIENT_RATE_LIMIT": "default"}},
+		{name: "unknown client rate limit", env: map[string]string{"AWX_CLIENT_RATE_LIMIT": "false"}, wantErr: true},
+		{name: "read API token scope", env: map[string]string{"AWX_API_TOKEN_SCOPE": "read"}},
+		{name: "unknown API token scope", env: map[string]string{"AWX_API_TOKEN_SCOPE": "admin"}, wantErr: true},
+		{name: "negative API token expiry", env: map[string]string{"AWX_API_TOKEN_EXPIRY": "-1"}, wantErr: true},
+		{name: "kind priorities", env: map[string]string{"AWX_KIND_PRIORITY": "Job=15,Backup=3000"}},
+		{name: "kind priority without priority", env: map[string]string{"AWX_KIND_PRIORITY": "Job"}, wantErr: true},
+		{name: "kind priority not a number", env: map[string]string{"AWX_KIND_PRIORITY": "Job=first"}, wantErr: true},
+		{name: "force reconcile", env: map[string]string{"AWX_FORCE_RECONCILE": "true"}},
+		{name: "invalid force reconcile", env: map[string]string{"AWX_FORCE_RECONCILE": "always"}, wantErr: true},
+		{name: "extra wait conditions", env: map[string]string{"AWX_EXTRA_WAIT_CONDITIONS": "apps/v1/deployments/ldap-sync:.status.readyReplicas>=2; v1/configmaps/site-config:.data.ready=true"}},
+		{name: "invalid extra wait condition", env: map[string]string{"AWX_EXTRA_WAIT_CONDITIONS": "v1/configmaps/site-config"}, wantErr: true},
+		{name: "expected cluster", env: map[string]string{"AWX_EXPECTED_CLUSTER": "label:cluster=prod-sin"}},
+		{name: "invalid expected cluster", env: map[string]string{"AWX_EXPECTED_CLUSTER": "prod"}, wantErr: true},
+		{name: "API verification", env: map[string]string{"AWX_VERIFY_API": "true", "AWX_VERIFY_RETRIES": "3", "AWX_VERIFY_RETRY_INTERVAL": "1"}},
+		{name: "zero verify timeout", env: map[string]string{"AWX_VERIFY_TIMEOUT": "0"}, wantErr: true},
+		{name: "negative verify retries", env: map[string]string{"AWX_VERIFY_RETRIES": "-1"}, wantErr: true},
+		{name: "migrations verification", env: map[string]string{"AWX_VERIFY_MIGRATIONS": "true"}},
+		{name: "invalid migrations verification", env: map[string]string{"AWX_VERIFY_MIGRATIONS": "once"}, wantErr: true},
+		{name: "PSA enforce level", env: map[string]string{"AWX_PSA_ENFORCE": "baseline"}},
+		{name: "unknown PSA enforce level", env: map[string]string{"AWX_PSA_ENFORCE": "strict"}, wantErr: true},
+		{name: "configmap state store", env: map[string]string{"AWX_STATE_STORE": "configmap", "AWX_STATE_NAMESPACE": "awx-deployer"}},
+		{name: "unknown state store", env: map[string]string{"AWX_STATE_STORE": "s3"}, wantErr: true},
+		{name: "hostname aliases", env: map[string]string{"AWX_HOSTNAME_ALIASES": "awx.internal.example.com,awx-sin.example.com"}},
+		{name: "invalid hostname alias", env: map[string]string{"AWX_HOSTNAME_ALIASES": "awx_internal"}, wantErr: true},
+		{name: "ingress controller preset", env: map[string]string{"AWX_INGRESS_CONTROLLER": "traefik"}},
+		{name: "unknown ingress controller", env: map[string]string{"AWX_INGRESS_CONTROLLER": "haproxy"}, wantErr: true},
+		{name: "ingress annotations", env: map[string]string{"AWX_INGRESS_ANNOTATIONS": "alb.ingress.kubernetes.io/listen-ports=[{\"HTTPS\": 443}]; example.com/owner=platform"}},
+		{name: "ingress annotation without value", env: map[string]string{"AWX_INGRESS_ANNOTATIONS": "example.com/owner"}, wantErr: true},
+		{name: "invalid ingress annotation key", env: map[string]string{"AWX_INGRESS_ANNOTATIONS": "example.com/owner name=platform"}, wantErr: true},
+		{name: "ingress path", env: map[string]string{"AWX_INGRESS_PATH": "/awx/"}},
+		{name: "ingress path without a leading slash", env: map[string]string{"AWX_INGRESS_PATH": "awx"}, wantErr: true},
+		{name: "ingress path with a query", env: map[string]string{"AWX_INGRESS_PATH": "/awx?x=1"}, wantErr: true},
+		{name: "kustomize manifest source", env: map[string]string{"AWX_MANIFEST_SOURCE": "kustomize"}},
+		{name: "unknown manifest source", env: map[string]string{"AWX_MANIFEST_SOURCE": "helm"}, wantErr: true},
+		{name: "skip existing objects", env: map[string]string{"AWX_ADOPT_EXISTING": "skip"}},
+		{name: "unknown adopt policy", env: map[string]string{"AWX_ADOPT_EXISTING": "overwrite"}, wantErr: true},
+		{name: "certificate timeout", env: map[string]string{"AWX_CERT_TIMEOUT": "15"}},
+		{name: "zero certificate timeout", env: map[string]string{"AWX_CERT_TIMEOUT": "0"}, wantErr: true},
+		{name: "protected fields", env: map[string]string{"AWX_PROTECTED_FIELDS": "PersistentVolumeClaim/awx-projects-claim:.spec.resources.requests.storage;Secret/awx-admin-password"}},
+		{name: "invalid protected field", env: map[string]string{"AWX_PROTECTED_FIELDS": "Secret/awx-admin-password;awx-settings"}, wantErr: true},
+		{name: "instance selector", env: map[string]string{"AWX_INSTANCE_SELECTOR": "fleet in (prod,staging)"}},
+		{name: "invalid instance selector", env: map[string]string{"AWX_INSTANCE_SELECTOR": "fleet in prod"}, wantErr: true},
+		{name: "verify via service", env: map[string]string{"AWX_VERIFY_VIA_SERVICE": "true"}},
+		{name: "invalid verify via service", env: map[string]string{"AWX_VERIFY_VIA_SERVICE": "sometimes"}, wantErr: true},
+		{name: "initial wait delay", env: map[string]string{"AWX_INITIAL_WAIT_DELAY": "0"}},
+		{name: "negative initial wait delay", env: map[string]string{"AWX_INITIAL_WAIT_DELAY": "-5"}, wantErr: true},
+		{name: "maintenance window", env: map[string]string{"AWX_MAINTENANCE_WINDOW": "Sat-Sun 02:00-06:00 Europe/Berlin"}},
+		{name: "invalid maintenance window", env: map[string]string{"AWX_MAINTENANCE_WINDOW": "weekends"}, wantErr: true},
+		{name: "Kubernetes Events", env: map[string]string{"AWX_EMIT_K8S_EVENTS": "true"}},
+		{name: "invalid Kubernetes Events", env: map[string]string{"AWX_EMIT_K8S_EVENTS": "sometimes"}, wantErr: true},
+		{name: "DNS verification", env: map[string]string{"AWX_VERIFY_DNS": "true", "AWX_DNS_SERVER": "10.0.0.10", "AWX_DNS_TIMEOUT": "2"}},
+		{name: "zero DNS timeout", env: map[string]string{"AWX_DNS_TIMEOUT": "0"}, wantErr: true},
+		{name: "foreground delete propagation", env: map[string]string{"AWX_DELETE_PROPAGATION": "Foreground"}},
+		{name: "unknown delete propagation", env: map[string]string{"AWX_DELETE_PROPAGATION": "Cascade"}, wantErr: true},
+		{name: "deploy lock", env: map[string]string{"AWX_DEPLOY_LOCK": "true", "AWX_LOCK_TTL": "30"}},
+		{name: "invalid AWX_DEPLOY_LOCK", env: map[string]string{"AWX_DEPLOY_LOCK": "sometimes"}, wantErr: true},
+		{name: "lock TTL under 10 seconds", env: map[string]string{"AWX_LOCK_TTL": "5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadEnv(t, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewConfigFromEnv() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtraWaitLists(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             map[string]string
+		wantDeployments []string
+		wantSelectors   []string
+	}{
+		{name: "unset"},
+		{
+			name:            "deployments",
+			env:             map[string]string{"AWX_EXTRA_WAIT_DEPLOYMENTS": "ldap-sync, metrics-exporter,"},
+			wantDeployments: []string{"ldap-sync", "metrics-exporter"},
+		},
+		{
+			name:          "selectors with commas",
+			env:           map[string]string{"AWX_EXTRA_WAIT_SELECTORS": "app=ldap-sync,tier=backend; app=exporter ;"},
+			wantSelectors: []string{"app=ldap-sync,tier=backend", "app=exporter"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mustLoadEnv(t, tt.env)
+			if !reflect.DeepEqual(cfg.ExtraWaitDeployments, tt.wantDeployments) {
+				t.Errorf("ExtraWaitDeployments = %q, want %q", cfg.ExtraWaitDeployments, tt.wantDeployments)
+			}
+			if !reflect.DeepEqual(cfg.ExtraWaitSelectors, tt.wantSelectors) {
+				t.Errorf("ExtraWaitSelectors = %q, want %q", cfg.ExtraWaitSelectors, tt.wantSelectors)
+			}
+		})
+	}
+}
+
+func TestPreservePrefixes(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{name: "default", want: []string{"kubectl.kubernetes.io/", "awx.ansible.com/"}},
+		{name: "custom", env: map[string]string{"AWX_PRESERVE_PREFIXES": "example.com/, team/"}, want: []string{"example.com/", "team/"}},
+		{name: "none", env: map[string]string{"AWX_PRESERVE_PREFIXES": "none"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mustLoadEnv(t, tt.env)
+			if !reflect.DeepEqual(cfg.PreservePrefixes, tt.want) {
+				t.Errorf("PreservePrefixes = %q, want %q", cfg.PreservePrefixes, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutMinimums(t *testing.T) {
+	keys := []string{"AWX_OPERATOR_TIMEOUT", "AWX_CRD_TIMEOUT", "AWX_INGRESS_TIMEOUT", "AWX_CERT_TIMEOUT", "AWX_VERIFY_TIMEOUT", "AWX_UNINSTALL_GRACE_PERIOD"}
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{name: "zero", value: "0", wantErr: "must be at least 1 minute(s), got 0"},
+		{name: "negative", value: "-5", wantErr: "must be at least 1 minute(s), got -5"},
+		{name: "minimum", value: "1"},
+		{name: "long", value: "120"},
+	}
+
+	for _, key := range keys {
+		for _, tt := range tests {
+			t.Run(key+"/"+tt.name, func(t *testing.T) {
+				_, err := loadEnv(t, map[string]string{key: tt.value})
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), key+" "+tt.wantErr) {
+						t.Fatalf("NewConfigFromEnv() error = %v, want %q", err, key+" "+tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("NewConfigFromEnv() failed: %v", err)
+				}
+			})
+		}
+	}
+}
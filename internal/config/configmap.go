@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// DefaultConfigMapName is the ConfigMap read with AWX_CONFIG_SOURCE=configmap
+// unless AWX_CONFIG_MAP names another
+const DefaultConfigMapName = "awx-deployer"
+
+// podNamespaceFile holds the namespace of the pod the deployer runs in
+const podNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Load creates a Config from the source AWX_CONFIG_SOURCE selects: env
+// variables (env, the default) or a ConfigMap in the cluster the deployer
+// runs in (configmap), see NewConfigFromConfigMap
+func Load() (*Config, error) {
+	switch source := os.Getenv("AWX_CONFIG_SOURCE"); source {
+	case "", "env":
+		return NewConfigFromEnv()
+	case "configmap":
+		restConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("AWX_CONFIG_SOURCE=configmap needs the deployer to run in a cluster: %v", err)
+		}
+		client, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create clientset: %v", err)
+		}
+
+		name := os.Getenv("AWX_CONFIG_MAP")
+		if name == "" {
+			name = DefaultConfigMapName
+		}
+		namespace := os.Getenv("AWX_CONFIG_MAP_NAMESPACE")
+		if namespace == "" {
+			data, err := ioutil.ReadFile(podNamespaceFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the pod namespace, set AWX_CONFIG_MAP_NAMESPACE: %v", err)
+			}
+			namespace = strings.TrimSpace(string(data))
+		}
+		return NewConfigFromConfigMap(client, name, namespace)
+	default:
+		return nil, fmt.Errorf("invalid AWX_CONFIG_SOURCE %q (expected env or configmap)", source)
+	}
+}
+
+// NewConfigFromConfigMap creates a new Config from the keys of a ConfigMap,
+// named like the env vars. Env vars still override the ConfigMap. Secret
+// settings like AWX_ADMIN_PASSWORD are rejected in the ConfigMap; set them
+// from a Secret instead, e.g. through env valueFrom.secretKeyRef.
+func NewConfigFromConfigMap(client kubernetes.Interface, name, namespace string) (*Config, error) {
+	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ConfigMap %s/%s: %v", namespace, name, err)
+	}
+
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	settings := settingKeys()
+	for _, key := range keys {
+		secret, known := settings[key]
+		if !known {
+			log.Printf("Warning: Ignoring unknown key %s in ConfigMap %s/%s", key, namespace, name)
+			continue
+		}
+		if secret {
+			return nil, fmt.Errorf("ConfigMap %s/%s sets %s, which is sensitive and must come from a Secret", namespace, name, key)
+		}
+	}
+
+	env := newEnvReader()
+	env.configMap = configMap.Data
+	return newConfig(env)
+}
+
+// settingKeys returns the env var names of the settings, mapped to whether
+// the setting is secret
+func settingKeys() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if key := field.Tag.Get("env"); key != "" {
+			keys[key] = field.Tag.Get("secret") == "true"
+		}
+	}
+	return keys
+}
+
+// StateStoreNamespace returns the namespace of the configmap state store:
+// AWX_STATE_NAMESPACE, else the namespace of the pod the deployer runs in,
+// else the AWX namespace
+func (c *Config) StateStoreNamespace() string {
+	if c.StateNamespace != "" {
+		return c.StateNamespace
+	}
+	if data, err := ioutil.ReadFile(podNamespaceFile); err == nil {
+		if namespace := strings.TrimSpace(string(data)); namespace != "" {
+			return namespace
+		}
+	}
+	return c.Namespace
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewConfigFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]string
+		env  map[string]string
+		// configMapName is the ConfigMap read, DefaultConfigMapName if empty
+		configMapName string
+		want          func(*Config) bool
+		wantErr       string
+	}{
+		{
+			name: "configmap populates config",
+			data: map[string]string{
+				"AWX_NAMESPACE":             "tower",
+				"AWX_NAME":                  "tower-instance",
+				"AWX_REPLICAS":              "3",
+				"AWX_SKIP_OPERATOR_INSTALL": "true",
+			},
+			want: func(cfg *Config) bool {
+				return cfg.Namespace == "tower" && cfg.AWXName == "tower-instance" && cfg.Replicas == 3 && cfg.SkipOperatorInstall
+			},
+		},
+		{
+			name: "env overrides configmap",
+			data: map[string]string{"AWX_NAMESPACE": "tower", "AWX_REPLICAS": "3"},
+			env:  map[string]string{"AWX_REPLICAS": "1"},
+			want: func(cfg *Config) bool {
+				return cfg.Namespace == "tower" && cfg.Replicas == 1
+			},
+		},
+		{
+			name: "empty env does not override configmap",
+			data: map[string]string{"AWX_NAMESPACE": "tower"},
+			env:  map[string]string{"AWX_NAMESPACE": ""},
+			want: func(cfg *Config) bool { return cfg.Namespace == "tower" },
+		},
+		{
+			name: "unknown keys ignored",
+			data: map[string]string{"AWX_NAMESPACE": "tower", "AWX_NOT_A_SETTING": "x"},
+			want: func(cfg *Config) bool { return cfg.Namespace == "tower" },
+		},
+		{
+			name: "secret from env is kept",
+			data: map[string]string{"AWX_NAMESPACE": "tower"},
+			env:  map[string]string{"AWX_ADMIN_PASSWORD": "Fr0m-the-Secret"},
+			want: func(cfg *Config) bool { return cfg.AdminPassword == "Fr0m-the-Secret" },
+		},
+		{
+			name:    "secret in configmap rejected",
+			data:    map[string]string{"AWX_POSTGRES_PASSWORD": "s3cr3t"},
+			wantErr: "sets AWX_POSTGRES_PASSWORD, which is sensitive and must come from a Secret",
+		},
+		{
+			name:    "invalid value",
+			data:    map[string]string{"AWX_REPLICAS": "many"},
+			wantErr: "AWX_REPLICAS",
+		},
+		{
+			name:          "configmap missing",
+			configMapName: "other",
+			wantErr:       "failed to read ConfigMap deployer/other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadEnv(t, tt.env); err != nil {
+				t.Fatalf("NewConfigFromEnv() failed: %v", err)
+			}
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: DefaultConfigMapName, Namespace: "deployer"},
+				Data:       tt.data,
+			}
+			name := tt.configMapName
+			if name == "" {
+				name = DefaultConfigMapName
+			}
+
+			cfg, err := NewConfigFromConfigMap(fake.NewSimpleClientset(configMap), name, "deployer")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewConfigFromConfigMap() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewConfigFromConfigMap() failed: %v", err)
+			}
+			if !tt.want(cfg) {
+				t.Errorf("NewConfigFromConfigMap() = %+v, not the expected config", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadSource(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr string
+	}{
+		{source: ""},
+		{source: "env"},
+		{source: "configmap", wantErr: "AWX_CONFIG_SOURCE=configmap needs the deployer to run in a cluster"},
+		{source: "vault", wantErr: `invalid AWX_CONFIG_SOURCE "vault"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if _, err := loadEnv(t, map[string]string{"AWX_NAMESPACE": "tower", "AWX_CONFIG_SOURCE": tt.source}); err != nil {
+				t.Fatalf("NewConfigFromEnv() failed: %v", err)
+			}
+			// Not in a cluster, whatever the environment of the test
+			t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+			if cfg.Namespace != "tower" {
+				t.Errorf("Load() namespace = %q, want tower from env", cfg.Namespace)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// redacted replaces secret values in printed configuration
+const redacted = "<redacted>"
+
+// Setting describes a single resolved configuration value
+type Setting struct {
+	Field  string `json:"field"`
+	Env    string `json:"env"`
+	Value  string `json:"value"`
+	Source Source `json:"source"`
+}
+
+// Effective returns the fully-resolved configuration with secrets redacted,
+// in struct field order
+func (c *Config) Effective() []Setting {
+	var settings []Setting
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("env")
+		if key == "" {
+			continue
+		}
+
+		var value string
+		if list, ok := v.Field(i).Interface().([]string); ok {
+			separator := field.Tag.Get("separator")
+			if separator == "" {
+				separator = ","
+			}
+			value = strings.Join(list, separator)
+		} else {
+			value = fmt.Sprintf("%v", v.Field(i).Interface())
+		}
+		if field.Tag.Get("secret") == "true" && value != "" {
+			value = redacted
+		}
+
+		source, ok := c.sources[key]
+		if !ok {
+			source = SourceDefault
+		}
+
+		settings = append(settings, Setting{
+			Field:  field.Name,
+			Env:    key,
+			Value:  value,
+			Source: source,
+		})
+	}
+
+	return settings
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEffectiveSources(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		key        string
+		wantValue  string
+		wantSource Source
+	}{
+		{
+			name:       "default",
+			key:        "AWX_NAMESPACE",
+			wantValue:  "awx",
+			wantSource: SourceDefault,
+		},
+		{
+			name:       "env override",
+			env:        map[string]string{"AWX_NAMESPACE": "tower"},
+			key:        "AWX_NAMESPACE",
+			wantValue:  "tower",
+			wantSource: SourceEnv,
+		},
+		{
+			name:       "profile default",
+			env:        map[string]string{"AWX_PROFILE": "prod"},
+			key:        "AWX_REPLICAS",
+			wantValue:  "2",
+			wantSource: SourceProfile,
+		},
+		{
+			name:       "env overrides profile",
+			env:        map[string]string{"AWX_PROFILE": "prod", "AWX_REPLICAS": "3"},
+			key:        "AWX_REPLICAS",
+			wantValue:  "3",
+			wantSource: SourceEnv,
+		},
+		{
+			name:       "secret redacted",
+			env:        map[string]string{"AWX_POSTGRES_PASSWORD": "s3cr3t-value"},
+			key:        "AWX_POSTGRES_PASSWORD",
+			wantValue:  redacted,
+			wantSource: SourceEnv,
+		},
+		{
+			name:       "empty secret not redacted",
+			key:        "AWX_REDIS_PASSWORD",
+			wantValue:  "",
+			wantSource: SourceDefault,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mustLoadEnv(t, tt.env)
+			got := setting(t, cfg, tt.key)
+			if got.Value != tt.wantValue {
+				t.Errorf("%s value = %q, want %q", tt.key, got.Value, tt.wantValue)
+			}
+			if got.Source != tt.wantSource {
+				t.Errorf("%s source = %q, want %q", tt.key, got.Source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestEffectiveConfigMapSources(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultConfigMapName, Namespace: "deployer"},
+		Data: map[string]string{
+			"AWX_NAMESPACE": "from-configmap",
+			"AWX_REPLICAS":  "4",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		key        string
+		wantValue  string
+		wantSource Source
+	}{
+		{
+			name:       "configmap value",
+			key:        "AWX_NAMESPACE",
+			wantValue:  "from-configmap",
+			wantSource: SourceConfigMap,
+		},
+		{
+			name:       "env overrides configmap",
+			env:        map[string]string{"AWX_REPLICAS": "1"},
+			key:        "AWX_REPLICAS",
+			wantValue:  "1",
+			wantSource: SourceEnv,
+		},
+		{
+			name:       "default when not in configmap",
+			key:        "AWX_NAME",
+			wantValue:  "awx-instance",
+			wantSource: SourceDefault,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadEnv(t, tt.env); err != nil {
+				t.Fatalf("NewConfigFromEnv() failed: %v", err)
+			}
+			cfg, err := NewConfigFromConfigMap(fake.NewSimpleClientset(configMap), DefaultConfigMapName, "deployer")
+			if err != nil {
+				t.Fatalf("NewConfigFromConfigMap() failed: %v", err)
+			}
+			got := setting(t, cfg, tt.key)
+			if got.Value != tt.wantValue || got.Source != tt.wantSource {
+				t.Errorf("%s = %q from %s, want %q from %s", tt.key, got.Value, got.Source, tt.wantValue, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestConfigMapRejectsSecrets(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultConfigMapName, Namespace: "deployer"},
+		Data:       map[string]string{"AWX_ADMIN_PASSWORD": "plaintext"},
+	}
+	mustLoadEnv(t, nil)
+	if _, err := NewConfigFromConfigMap(fake.NewSimpleClientset(configMap), DefaultConfigMapName, "deployer"); err == nil {
+		t.Fatal("NewConfigFromConfigMap() accepted a secret setting")
+	}
+}
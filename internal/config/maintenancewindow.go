@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// the image has no zoneinfo, embed it for the window's timezone
+	_ "time/tzdata"
+)
+
+// maintenanceWindowUsage describes the syntax in errors
+const maintenanceWindowUsage = "expected [days] HH:MM-HH:MM [timezone], e.g. Sat-Sun 02:00-06:00 Europe/Berlin or 22:00-05:00 UTC"
+
+// MaintenanceWindow is the time of day, and optionally the days of the week,
+// deployments may change the cluster. It is written as
+// [days] HH:MM-HH:MM [timezone], where days is a day, a range like Mon-Fri or
+// a comma-separated list like Sat,Sun, and the timezone an IANA name that
+// defaults to UTC. A window ending before it starts runs past midnight into
+// the next day, its days are the days it starts on.
+type MaintenanceWindow struct {
+	// Days are the days of the week the window starts on, all if none is
+	// set
+	Days [7]bool
+	// Start and End are minutes after midnight
+	Start, End int
+	Location   *time.Location
+	spec       string
+}
+
+// ParseMaintenanceWindow parses AWX_MAINTENANCE_WINDOW
+func ParseMaintenanceWindow(window string) (MaintenanceWindow, error) {
+	fields := strings.Fields(window)
+	w := MaintenanceWindow{Location: time.UTC, spec: strings.Join(fields, " ")}
+
+	// the times are the only field with a colon and a dash
+	times := -1
+	for i, field := range fields {
+		if strings.Contains(field, ":") && strings.Contains(field, "-") {
+			times = i
+			break
+		}
+	}
+	if times == -1 || times > 1 || len(fields)-times > 2 {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q (%s)", window, maintenanceWindowUsage)
+	}
+
+	if times == 1 {
+		if err := w.parseDays(fields[0]); err != nil {
+			return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %v", window, err)
+		}
+	} else {
+		for i := range w.Days {
+			w.Days[i] = true
+		}
+	}
+
+	start, end, _ := strings.Cut(fields[times], "-")
+	var err error
+	if w.Start, err = parseTimeOfDay(start); err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %v", window, err)
+	}
+	if w.End, err = parseTimeOfDay(end); err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %v", window, err)
+	}
+	if w.Start == w.End {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: it starts and ends at the same time", window)
+	}
+
+	if times+1 < len(fields) {
+		if w.Location, err = time.LoadLocation(fields[times+1]); err != nil {
+			return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: unknown timezone %s", window, fields[times+1])
+		}
+	}
+	return w, nil
+}
+
+// parseDays sets the days of a day, a range of days or a list of both
+func (w *MaintenanceWindow) parseDays(days string) error {
+	for _, part := range strings.Split(days, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := parseWeekday(first)
+		if err != nil {
+			return err
+		}
+		to := from
+		if isRange {
+			if to, err = parseWeekday(last); err != nil {
+				return err
+			}
+		}
+		// ranges may wrap around the week, e.g. Fri-Mon
+		for day := from; ; day = (day + 1) % 7 {
+			w.Days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseWeekday parses a day name, e.g. Mon or Monday
+func parseWeekday(name string) (int, error) {
+	lower := strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if len(lower) >= 3 && strings.HasPrefix(strings.ToLower(day.String()), lower) {
+			return int(day), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q (expected Mon, Tue, Wed, Thu, Fri, Sat or Sun)", name)
+}
+
+// parseTimeOfDay parses HH:MM into minutes after midnight. 24:00 ends a
+// window at midnight.
+func parseTimeOfDay(value string) (int, error) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	h, err := strconv.Atoi(hours)
+	if !ok || err != nil || len(minutes) != 2 {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", value)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", value)
+	}
+	return h*60 + m, nil
+}
+
+// Contains reports whether t is inside the window
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	local := t.In(w.Location)
+	minute := local.Hour()*60 + local.Minute()
+	today := int(local.Weekday())
+	if w.Start < w.End {
+		return w.Days[today] && minute >= w.Start && minute < w.End
+	}
+	// past midnight: the evening of a window day or the morning after one
+	yesterday := (today + 6) % 7
+	return (w.Days[today] && minute >= w.Start) || (w.Days[yesterday] && minute < w.End)
+}
+
+func (w MaintenanceWindow) String() string {
+	return w.spec
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	tests := []struct {
+		window string
+		// wantDays are the days the window starts on, Sunday first
+		wantDays     string
+		wantStart    int
+		wantEnd      int
+		wantLocation string
+		wantErr      string
+	}{
+		{window: "02:00-06:00", wantDays: "SMTWTFS", wantStart: 120, wantEnd: 360, wantLocation: "UTC"},
+		{window: "Sat-Sun 02:00-06:00 Europe/Berlin", wantDays: "S-----S", wantStart: 120, wantEnd: 360, wantLocation: "Europe/Berlin"},
+		{window: "22:00-05:00 Asia/Singapore", wantDays: "SMTWTFS", wantStart: 1320, wantEnd: 300, wantLocation: "Asia/Singapore"},
+		{window: "Mon-Fri 20:00-24:00", wantDays: "-MTWTF-", wantStart: 1200, wantEnd: 1440, wantLocation: "UTC"},
+		{window: "Fri-Mon 00:00-04:00", wantDays: "SM---FS", wantStart: 0, wantEnd: 240, wantLocation: "UTC"},
+		{window: "tuesday,Thu 01:30-02:45", wantDays: "--T-T--", wantStart: 90, wantEnd: 165, wantLocation: "UTC"},
+		{window: "Sat Sun 02:00-06:00", wantErr: "expected [days] HH:MM-HH:MM [timezone]"},
+		{window: "02:00-06:00 UTC extra", wantErr: "expected [days] HH:MM-HH:MM [timezone]"},
+		{window: "weekends", wantErr: "expected [days] HH:MM-HH:MM [timezone]"},
+		{window: "Sa 02:00-06:00", wantErr: `unknown day "Sa"`},
+		{window: "2:00-6:0", wantErr: `invalid time "6:0"`},
+		{window: "02:00-24:30", wantErr: `invalid time "24:30"`},
+		{window: "02:60-06:00", wantErr: `invalid time "02:60"`},
+		{window: "02:00-02:00", wantErr: "it starts and ends at the same time"},
+		{window: "02:00-06:00 Mars/Olympus", wantErr: "unknown timezone Mars/Olympus"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			got, err := ParseMaintenanceWindow(tt.window)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseMaintenanceWindow() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMaintenanceWindow() failed: %v", err)
+			}
+
+			days := []byte("-------")
+			for day, set := range got.Days {
+				if set {
+					days[day] = "SMTWTFS"[day]
+				}
+			}
+			if string(days) != tt.wantDays || got.Start != tt.wantStart || got.End != tt.wantEnd || got.Location.String() != tt.wantLocation {
+				t.Errorf("ParseMaintenanceWindow() = %s %d-%d %s, want %s %d-%d %s",
+					days, got.Start, got.End, got.Location, tt.wantDays, tt.wantStart, tt.wantEnd, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	// at returns a time on the Friday 2026-10-16 plus days, in UTC
+	at := func(days, hour, minute int) time.Time {
+		return time.Date(2026, 10, 16+days, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		window string
+		at     time.Time
+		want   bool
+	}{
+		{window: "02:00-06:00", at: at(0, 2, 0), want: true},
+		{window: "02:00-06:00", at: at(0, 5, 59), want: true},
+		{window: "02:00-06:00", at: at(0, 6, 0)},
+		{window: "02:00-06:00", at: at(0, 1, 59)},
+		{window: "Sat-Sun 02:00-06:00", at: at(1, 3, 0), want: true},
+		{window: "Sat-Sun 02:00-06:00", at: at(0, 3, 0)},
+		{window: "Sat-Sun 02:00-06:00 Europe/Berlin", at: at(1, 1, 30), want: true},
+		{window: "Sat-Sun 02:00-06:00 Europe/Berlin", at: at(1, 4, 30)},
+		{window: "Fri 22:00-05:00", at: at(0, 23, 0), want: true},
+		{window: "Fri 22:00-05:00", at: at(1, 4, 0), want: true},
+		{window: "Fri 22:00-05:00", at: at(1, 23, 0)},
+		{window: "Fri 22:00-05:00", at: at(0, 4, 0)},
+		{window: "Mon-Fri 20:00-24:00", at: at(0, 23, 59), want: true},
+		{window: "Mon-Fri 20:00-24:00", at: at(1, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.window+" at "+tt.at.Format("Mon 15:04"), func(t *testing.T) {
+			window, err := ParseMaintenanceWindow(tt.window)
+			if err != nil {
+				t.Fatalf("ParseMaintenanceWindow() failed: %v", err)
+			}
+			if got := window.Contains(tt.at); got != tt.want {
+				t.Errorf("Contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
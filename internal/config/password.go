@@ -0,0 +1,173 @@
+package config
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultPasswordPolicy requires 12 characters from three character classes
+// and rejects characters that break shell quoting in the operator
+const DefaultPasswordPolicy = "min_length=12,min_classes=3,forbidden=\"'`\\$"
+
+// DefaultAdminPassword is the admin password of the bundled manifests,
+// known to anyone who has read them
+const DefaultAdminPassword = "admin123!@#"
+
+// generatedPasswordLength is the length of generated admin passwords
+const generatedPasswordLength = 24
+
+// passwordClasses are the character classes a policy counts, with the
+// characters generated passwords are drawn from
+var passwordClasses = []struct {
+	name     string
+	chars    string
+	contains func(rune) bool
+}{
+	{"lowercase", "abcdefghijkmnopqrstuvwxyz", unicode.IsLower},
+	{"uppercase", "ABCDEFGHJKLMNPQRSTUVWXYZ", unicode.IsUpper},
+	{"digit", "23456789", unicode.IsDigit},
+	{"special", "!#%*+-.:=?@^_~", func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+	}},
+}
+
+// PasswordPolicy is the complexity required of the admin password
+type PasswordPolicy struct {
+	MinLength  int
+	MinClasses int    // of lowercase, uppercase, digit and special
+	Forbidden  string // characters that may not appear
+}
+
+// ParsePasswordPolicy parses a policy such as "min_length=12,min_classes=3".
+// Omitted settings are not enforced.
+func ParsePasswordPolicy(value string) (PasswordPolicy, error) {
+	var policy PasswordPolicy
+	for _, entry := range splitList(value) {
+		key, setting, ok := strings.Cut(entry, "=")
+		if !ok {
+			return policy, fmt.Errorf("invalid AWX_PASSWORD_POLICY entry %q (expected key=value)", entry)
+		}
+
+		var err error
+		switch key {
+		case "min_length":
+			policy.MinLength, err = strconv.Atoi(setting)
+		case "min_classes":
+			policy.MinClasses, err = strconv.Atoi(setting)
+			if err == nil && (policy.MinClasses < 0 || policy.MinClasses > len(passwordClasses)) {
+				err = fmt.Errorf("must be between 0 and %d", len(passwordClasses))
+			}
+		case "forbidden":
+			policy.Forbidden = setting
+		default:
+			return policy, fmt.Errorf("unknown AWX_PASSWORD_POLICY setting %q (supported: min_length, min_classes, forbidden)", key)
+		}
+		if err != nil {
+			return policy, fmt.Errorf("invalid AWX_PASSWORD_POLICY %s: %v", key, err)
+		}
+	}
+	return policy, nil
+}
+
+// Check returns an error describing how a password violates the policy. The
+// password itself is never part of the error.
+func (p PasswordPolicy) Check(password string) error {
+	var problems []string
+	if length := len([]rune(password)); length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("has %d characters, at least %d are required", length, p.MinLength))
+	}
+
+	classes := 0
+	for _, class := range passwordClasses {
+		if strings.IndexFunc(password, class.contains) != -1 {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		problems = append(problems, fmt.Sprintf("uses %d of the character classes lowercase, uppercase, digit and special, at least %d are required", classes, p.MinClasses))
+	}
+
+	if p.Forbidden != "" && strings.ContainsAny(password, p.Forbidden) {
+		problems = append(problems, fmt.Sprintf("contains one of the forbidden characters %s", p.Forbidden))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("password %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Generate returns a random password that satisfies the policy. It contains
+// a character of every class, none of the forbidden characters.
+func (p PasswordPolicy) Generate() (string, error) {
+	length := generatedPasswordLength
+	if p.MinLength > length {
+		length = p.MinLength
+	}
+
+	var all []rune
+	var password []rune
+	for _, class := range passwordClasses {
+		chars := []rune(removeChars(class.chars, p.Forbidden))
+		if len(chars) == 0 {
+			continue
+		}
+		all = append(all, chars...)
+
+		// one of every class, so that min_classes is always met
+		c, err := randomRune(chars)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+	if len(all) == 0 {
+		return "", fmt.Errorf("AWX_PASSWORD_POLICY forbids every character passwords are generated from")
+	}
+
+	for len(password) < length {
+		c, err := randomRune(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// shuffle so the class characters are not always first
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %v", err)
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+
+	generated := string(password)
+	if err := p.Check(generated); err != nil {
+		return "", fmt.Errorf("cannot generate a password for AWX_PASSWORD_POLICY: %v", err)
+	}
+	return generated, nil
+}
+
+// randomRune returns a uniformly chosen character
+func randomRune(chars []rune) (rune, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate password: %v", err)
+	}
+	return chars[i.Int64()], nil
+}
+
+// removeChars returns chars without any of the characters in remove
+func removeChars(chars, remove string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(remove, r) {
+			return -1
+		}
+		return r
+	}, chars)
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParsePasswordPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    PasswordPolicy
+		wantErr string
+	}{
+		{value: "", want: PasswordPolicy{}},
+		{value: "min_length=16,min_classes=4", want: PasswordPolicy{MinLength: 16, MinClasses: 4}},
+		{value: DefaultPasswordPolicy, want: PasswordPolicy{MinLength: 12, MinClasses: 3, Forbidden: "\"'`\\$"}},
+		{value: "min_length", wantErr: "expected key=value"},
+		{value: "min_length=twelve", wantErr: "invalid AWX_PASSWORD_POLICY min_length"},
+		{value: "min_classes=5", wantErr: "must be between 0 and 4"},
+		{value: "max_length=64", wantErr: `unknown AWX_PASSWORD_POLICY setting "max_length"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			policy, err := ParsePasswordPolicy(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParsePasswordPolicy(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePasswordPolicy(%q) failed: %v", tt.value, err)
+			}
+			if policy != tt.want {
+				t.Errorf("ParsePasswordPolicy(%q) = %+v, want %+v", tt.value, policy, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 12, MinClasses: 3, Forbidden: "$'"}
+	tests := []struct {
+		name     string
+		password string
+		wantErr  []string
+	}{
+		{name: "strong", password: "Correct-Horse-7"},
+		{name: "three classes", password: "correcthorse7!"},
+		{name: "too short", password: "Sh0rt!", wantErr: []string{"has 6 characters, at least 12 are required"}},
+		{name: "too few classes", password: "correcthorsebattery", wantErr: []string{"uses 1 of the character classes"}},
+		{name: "forbidden character", password: "Correct$Horse7", wantErr: []string{"contains one of the forbidden characters $'"}},
+		{name: "everything wrong", password: "a$", wantErr: []string{"has 2 characters", "uses 2 of the character classes", "forbidden characters"}},
+		{name: "default password", password: DefaultAdminPassword, wantErr: []string{"has 11 characters"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Check() failed: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Check() accepted the password, want errors %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Check() error = %v, want %q", err, want)
+				}
+			}
+			if strings.Contains(err.Error(), tt.password) {
+				t.Errorf("Check() error %v contains the password", err)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyGenerate(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		wantLength int
+		wantErr    bool
+	}{
+		{name: "default policy", policy: DefaultPasswordPolicy, wantLength: generatedPasswordLength},
+		{name: "all classes", policy: "min_length=8,min_classes=4", wantLength: generatedPasswordLength},
+		{name: "longer than generated", policy: "min_length=40,min_classes=4", wantLength: 40},
+		{name: "no special characters", policy: "min_classes=3,forbidden=!#%*+-.:=?@^_~", wantLength: generatedPasswordLength},
+		{name: "every class needed but specials forbidden", policy: "min_classes=4,forbidden=!#%*+-.:=?@^_~", wantErr: true},
+		{name: "every character forbidden", policy: "forbidden=abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789!#%*+-.:=?@^_~", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParsePasswordPolicy(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			seen := map[string]bool{}
+			for i := 0; i < 200; i++ {
+				password, err := policy.Generate()
+				if tt.wantErr {
+					if err == nil {
+						t.Fatalf("Generate() = a password, want an error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Generate() failed: %v", err)
+				}
+				if err := policy.Check(password); err != nil {
+					t.Fatalf("generated password fails the policy: %v", err)
+				}
+				if len(password) != tt.wantLength {
+					t.Errorf("generated password has %d characters, want %d", len(password), tt.wantLength)
+				}
+				if seen[password] {
+					t.Errorf("Generate() returned the same password twice")
+				}
+				seen[password] = true
+			}
+		})
+	}
+}
+
+func TestAdminPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name: "strong password",
+			env:  map[string]string{"AWX_ADMIN_PASSWORD": "Correct-Horse-7"},
+		},
+		{
+			name:    "weak password",
+			env:     map[string]string{"AWX_ADMIN_PASSWORD": "tower2023"},
+			wantErr: "AWX_ADMIN_PASSWORD does not meet AWX_PASSWORD_POLICY: password has 9 characters",
+		},
+		{
+			name: "weak password allowed",
+			env:  map[string]string{"AWX_ADMIN_PASSWORD": "tower2023", "AWX_ALLOW_WEAK_PASSWORD": "true"},
+		},
+		{
+			name:    "stricter policy",
+			env:     map[string]string{"AWX_ADMIN_PASSWORD": "Correct-Horse-7", "AWX_PASSWORD_POLICY": "min_length=20"},
+			wantErr: "has 15 characters, at least 20 are required",
+		},
+		{
+			name:    "invalid policy",
+			env:     map[string]string{"AWX_ADMIN_PASSWORD": "Correct-Horse-7", "AWX_PASSWORD_POLICY": "min_classes=9"},
+			wantErr: "invalid AWX_PASSWORD_POLICY min_classes",
+		},
+		{
+			name: "generated password",
+			env:  map[string]string{"AWX_PASSWORD_POLICY": "min_length=32,min_classes=4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadEnv(t, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewConfigFromEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				if password := tt.env["AWX_ADMIN_PASSWORD"]; strings.Contains(err.Error(), password) {
+					t.Errorf("error %v contains the password", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewConfigFromEnv() failed: %v", err)
+			}
+			if generated := tt.env["AWX_ADMIN_PASSWORD"] == ""; cfg.AdminPasswordGenerated != generated {
+				t.Errorf("AdminPasswordGenerated = %v, want %v", cfg.AdminPasswordGenerated, generated)
+			}
+		})
+	}
+}
+
+func TestDefaultAdminPassword(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantWarning bool
+		wantErr     string
+	}{
+		{
+			name:        "allowed with a warning in dev",
+			env:         map[string]string{"AWX_PROFILE": "dev", "AWX_ADMIN_PASSWORD": DefaultAdminPassword},
+			wantWarning: true,
+		},
+		{
+			name:    "rejected in prod",
+			env:     map[string]string{"AWX_PROFILE": "prod", "AWX_ADMIN_PASSWORD": DefaultAdminPassword},
+			wantErr: "AWX_ADMIN_PASSWORD is the default password of the bundled manifests, which AWX_STRICT_PASSWORD forbids",
+		},
+		{
+			name: "generated in prod when unset",
+			env:  map[string]string{"AWX_PROFILE": "prod"},
+		},
+		{
+			name: "other password in prod",
+			env:  map[string]string{"AWX_PROFILE": "prod", "AWX_ADMIN_PASSWORD": "Correct-Horse-7"},
+		},
+		{
+			name:    "rejected with AWX_STRICT_PASSWORD even when weak passwords are allowed",
+			env:     map[string]string{"AWX_ADMIN_PASSWORD": DefaultAdminPassword, "AWX_ALLOW_WEAK_PASSWORD": "true", "AWX_STRICT_PASSWORD": "true"},
+			wantErr: "which AWX_STRICT_PASSWORD forbids",
+		},
+		{
+			name:        "allowed with a warning without a profile",
+			env:         map[string]string{"AWX_ADMIN_PASSWORD": DefaultAdminPassword, "AWX_ALLOW_WEAK_PASSWORD": "true"},
+			wantWarning: true,
+		},
+		{
+			name:    "invalid AWX_STRICT_PASSWORD",
+			env:     map[string]string{"AWX_STRICT_PASSWORD": "maybe"},
+			wantErr: "invalid AWX_STRICT_PASSWORD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged bytes.Buffer
+			log.SetOutput(&logged)
+			defer log.SetOutput(os.Stderr)
+
+			cfg, err := loadEnv(t, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewConfigFromEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), DefaultAdminPassword) {
+					t.Errorf("error %v contains the password", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewConfigFromEnv() failed: %v", err)
+			}
+			if tt.env["AWX_ADMIN_PASSWORD"] == "" && (!cfg.AdminPasswordGenerated || cfg.AdminPassword == DefaultAdminPassword) {
+				t.Errorf("admin password not generated")
+			}
+			warned := strings.Contains(logged.String(), "AWX_ADMIN_PASSWORD is the default password of the bundled manifests")
+			if warned != tt.wantWarning {
+				t.Errorf("warned = %v, want %v:\n%s", warned, tt.wantWarning, logged.String())
+			}
+		})
+	}
+}
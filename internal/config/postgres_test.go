@@ -0,0 +1,65 @@
+package config
+
+import "testing"
+
+func TestPostgresDeploymentName(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "default version",
+			want: "awx-instance-postgres-15",
+		},
+		{
+			name: "configured version",
+			env:  map[string]string{"AWX_POSTGRES_VERSION": "13"},
+			want: "awx-instance-postgres-13",
+		},
+		{
+			name: "derived from the image version",
+			env:  map[string]string{"AWX_POSTGRES_IMAGE_VERSION": "16.2-alpine"},
+			want: "awx-instance-postgres-16",
+		},
+		{
+			name: "non-numeric image version keeps the default",
+			env:  map[string]string{"AWX_POSTGRES_IMAGE_VERSION": "latest"},
+			want: "awx-instance-postgres-15",
+		},
+		{
+			name: "AWX name",
+			env:  map[string]string{"AWX_NAME": "tower", "AWX_POSTGRES_VERSION": "14"},
+			want: "tower-postgres-14",
+		},
+		{
+			name:    "image version contradicts the version",
+			env:     map[string]string{"AWX_POSTGRES_VERSION": "13", "AWX_POSTGRES_IMAGE_VERSION": "15.4"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid resource quantity",
+			env:     map[string]string{"AWX_POSTGRES_MEMORY_LIMIT": "lots"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadEnv(t, tt.env)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewConfigFromEnv() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewConfigFromEnv() failed: %v", err)
+			}
+			if got := cfg.PostgresDeploymentName(); got != tt.want {
+				t.Errorf("PostgresDeploymentName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// profiles are named sets of defaults, keyed by env var name. Env vars that
+// are set take precedence over the profile.
+var profiles = map[string]map[string]string{
+	// dev is a throwaway single-node install on hostpath volumes without TLS
+	"dev": {
+		"AWX_STORAGE_CLASS":           "hostpath",
+		"AWX_POSTGRES_STORAGE":        "8Gi",
+		"AWX_PROJECTS_STORAGE":        "8Gi",
+		"AWX_REPLICAS":                "1",
+		"AWX_TLS":                     "false",
+		"AWX_ALLOW_WEAK_PASSWORD":     "true",
+		"AWX_STRICT_PASSWORD":         "false",
+		"AWX_POSTGRES_CPU_REQUEST":    "250m",
+		"AWX_POSTGRES_MEMORY_REQUEST": "512Mi",
+		"AWX_POSTGRES_CPU_LIMIT":      "1",
+		"AWX_POSTGRES_MEMORY_LIMIT":   "2Gi",
+	},
+	// prod uses the cluster's default storage class, TLS from cert-manager
+	// and two replicas of the web and task pods
+	"prod": {
+		"AWX_STORAGE_CLASS":           "",
+		"AWX_POSTGRES_STORAGE":        "50Gi",
+		"AWX_PROJECTS_STORAGE":        "20Gi",
+		"AWX_REPLICAS":                "2",
+		"AWX_TLS":                     "true",
+		"AWX_CERT_ISSUER":             "letsencrypt-prod",
+		"AWX_ALLOW_WEAK_PASSWORD":     "false",
+		"AWX_STRICT_PASSWORD":         "true",
+		"AWX_WAIT_INGRESS":            "true",
+		"AWX_POSTGRES_CPU_REQUEST":    "1",
+		"AWX_POSTGRES_MEMORY_REQUEST": "2Gi",
+		"AWX_POSTGRES_CPU_LIMIT":      "2",
+		"AWX_POSTGRES_MEMORY_LIMIT":   "4Gi",
+	},
+}
+
+// profileDefaults returns the defaults of a profile, or nil for no profile
+func profileDefaults(name string) (map[string]string, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	defaults, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for known := range profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown AWX_PROFILE %q (supported: %s)", name, strings.Join(names, ", "))
+	}
+	return defaults, nil
+}
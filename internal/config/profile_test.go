@@ -0,0 +1,164 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// profileSettings are the resolved settings a profile test checks
+type profileSettings struct {
+	StorageClass        string
+	PostgresStorage     string
+	ProjectsStorage     string
+	Replicas            int
+	TLS                 bool
+	CertIssuer          string
+	AllowWeakPassword   bool
+	StrictPassword      bool
+	WaitIngress         bool
+	PostgresCPURequest  string
+	PostgresMemoryLimit string
+}
+
+func resolvedProfile(cfg *Config) profileSettings {
+	return profileSettings{
+		StorageClass:        cfg.StorageClass,
+		PostgresStorage:     cfg.PostgresStorage,
+		ProjectsStorage:     cfg.ProjectsStorage,
+		Replicas:            cfg.Replicas,
+		TLS:                 cfg.TLS,
+		CertIssuer:          cfg.CertIssuer,
+		AllowWeakPassword:   cfg.AllowWeakPassword,
+		StrictPassword:      cfg.StrictPassword,
+		WaitIngress:         cfg.WaitIngress,
+		PostgresCPURequest:  cfg.PostgresCPURequest,
+		PostgresMemoryLimit: cfg.PostgresMemoryLimit,
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want profileSettings
+	}{
+		{
+			name: "dev",
+			env:  map[string]string{"AWX_PROFILE": "dev"},
+			want: profileSettings{
+				StorageClass:        "hostpath",
+				PostgresStorage:     "8Gi",
+				ProjectsStorage:     "8Gi",
+				Replicas:            1,
+				TLS:                 false,
+				CertIssuer:          "letsencrypt-prod",
+				AllowWeakPassword:   true,
+				StrictPassword:      false,
+				PostgresCPURequest:  "250m",
+				PostgresMemoryLimit: "2Gi",
+			},
+		},
+		{
+			name: "prod",
+			env:  map[string]string{"AWX_PROFILE": "prod", "AWX_ADMIN_PASSWORD": "Correct-Horse-Battery-9"},
+			want: profileSettings{
+				StorageClass:        "",
+				PostgresStorage:     "50Gi",
+				ProjectsStorage:     "20Gi",
+				Replicas:            2,
+				TLS:                 true,
+				CertIssuer:          "letsencrypt-prod",
+				AllowWeakPassword:   false,
+				StrictPassword:      true,
+				WaitIngress:         true,
+				PostgresCPURequest:  "1",
+				PostgresMemoryLimit: "4Gi",
+			},
+		},
+		{
+			name: "env overrides prod",
+			env: map[string]string{
+				"AWX_PROFILE":          "prod",
+				"AWX_ADMIN_PASSWORD":   "Correct-Horse-Battery-9",
+				"AWX_STORAGE_CLASS":    "fast-ssd",
+				"AWX_REPLICAS":         "3",
+				"AWX_CERT_ISSUER":      "internal-ca",
+				"AWX_WAIT_INGRESS":     "false",
+				"AWX_POSTGRES_STORAGE": "100Gi",
+			},
+			want: profileSettings{
+				StorageClass:        "fast-ssd",
+				PostgresStorage:     "100Gi",
+				ProjectsStorage:     "20Gi",
+				Replicas:            3,
+				TLS:                 true,
+				CertIssuer:          "internal-ca",
+				AllowWeakPassword:   false,
+				StrictPassword:      true,
+				WaitIngress:         false,
+				PostgresCPURequest:  "1",
+				PostgresMemoryLimit: "4Gi",
+			},
+		},
+		{
+			name: "env overrides dev",
+			env:  map[string]string{"AWX_PROFILE": "dev", "AWX_TLS": "true", "AWX_POSTGRES_MEMORY_LIMIT": "1Gi"},
+			want: profileSettings{
+				StorageClass:        "hostpath",
+				PostgresStorage:     "8Gi",
+				ProjectsStorage:     "8Gi",
+				Replicas:            1,
+				TLS:                 true,
+				CertIssuer:          "letsencrypt-prod",
+				AllowWeakPassword:   true,
+				PostgresCPURequest:  "250m",
+				PostgresMemoryLimit: "1Gi",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolvedProfile(mustLoadEnv(t, tt.env))
+			if got != tt.want {
+				t.Errorf("resolved config = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileDefaults(t *testing.T) {
+	tests := []struct {
+		profile string
+		wantErr string
+	}{
+		{profile: ""},
+		{profile: "dev"},
+		{profile: "prod"},
+		{profile: "staging", wantErr: `unknown AWX_PROFILE "staging" (supported: dev, prod)`},
+		{profile: "Prod", wantErr: `unknown AWX_PROFILE "Prod"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			defaults, err := profileDefaults(tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("profileDefaults(%q) error = %v, want %q", tt.profile, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("profileDefaults(%q) failed: %v", tt.profile, err)
+			}
+			if (defaults == nil) != (tt.profile == "") {
+				t.Errorf("profileDefaults(%q) = %v", tt.profile, defaults)
+			}
+			for key := range defaults {
+				if _, ok := settingKeys()[key]; !ok {
+					t.Errorf("profile %s sets %s, which is not a setting", tt.profile, key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldProtection keeps a field of an existing object from being changed by
+// an update. It is written as Kind/name[:path], e.g.
+// PersistentVolumeClaim/awx-projects-claim:.spec.resources.requests.storage
+// or Secret/awx-admin-password. Without a path the whole object is left as
+// it is once it exists.
+type FieldProtection struct {
+	Kind string
+	Name string
+	// Path is the field, one entry per segment of .a.b[c.d][0], empty for
+	// the whole object
+	Path []string
+}
+
+// fieldProtectionUsage describes the syntax in errors
+const fieldProtectionUsage = "expected Kind/name[:.field.path], e.g. PersistentVolumeClaim/awx-projects-claim:.spec.resources.requests.storage"
+
+// ParseFieldProtection parses a protection written as Kind/name[:path]
+func ParseFieldProtection(protection string) (FieldProtection, error) {
+	target, path, hasPath := strings.Cut(strings.TrimSpace(protection), ":")
+	kind, name, ok := strings.Cut(target, "/")
+	if !ok || kind == "" || name == "" || strings.Contains(name, "/") {
+		return FieldProtection{}, fmt.Errorf("invalid field protection %q (%s)", protection, fieldProtectionUsage)
+	}
+
+	p := FieldProtection{Kind: kind, Name: name}
+	if hasPath {
+		segments, err := parseFieldPath(strings.TrimSpace(path))
+		if err != nil {
+			return FieldProtection{}, fmt.Errorf("invalid field protection %q: %v", protection, err)
+		}
+		p.Path = segments
+	}
+	return p, nil
+}
+
+// Matches reports whether the protection applies to an object of the
+// given kind and name. Kinds are compared case-insensitively.
+func (p FieldProtection) Matches(kind, name string) bool {
+	return strings.EqualFold(p.Kind, kind) && p.Name == name
+}
+
+// FieldPath returns the field path as written, e.g. .data[password], or
+// empty for the whole object
+func (p FieldProtection) FieldPath() string {
+	return formatFieldPath(p.Path)
+}
+
+func (p FieldProtection) String() string {
+	if len(p.Path) == 0 {
+		return p.Kind + "/" + p.Name
+	}
+	return p.Kind + "/" + p.Name + ":" + p.FieldPath()
+}
+
+// FieldProtections returns the protections of AWX_PROTECTED_FIELDS. The
+// list is validated when the configuration is loaded, so invalid entries
+// can only come from a Config built by hand and are skipped.
+func (c *Config) FieldProtections() []FieldProtection {
+	var parsed []FieldProtection
+	for _, entry := range c.ProtectedFields {
+		if protection, err := ParseFieldProtection(entry); err == nil {
+			parsed = append(parsed, protection)
+		}
+	}
+	return parsed
+}
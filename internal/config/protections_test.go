@@ -0,0 +1,83 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFieldProtection(t *testing.T) {
+	tests := []struct {
+		protection string
+		want       FieldProtection
+		wantString string
+		wantErr    string
+	}{
+		{
+			protection: "PersistentVolumeClaim/awx-projects-claim:.spec.resources.requests.storage",
+			want:       FieldProtection{Kind: "PersistentVolumeClaim", Name: "awx-projects-claim", Path: []string{"spec", "resources", "requests", "storage"}},
+			wantString: "PersistentVolumeClaim/awx-projects-claim:.spec.resources.requests.storage",
+		},
+		{
+			protection: "Secret/awx-admin-password",
+			want:       FieldProtection{Kind: "Secret", Name: "awx-admin-password"},
+			wantString: "Secret/awx-admin-password",
+		},
+		{
+			protection: " ConfigMap/awx-settings:.data[settings.py] ",
+			want:       FieldProtection{Kind: "ConfigMap", Name: "awx-settings", Path: []string{"data", "settings.py"}},
+			wantString: "ConfigMap/awx-settings:.data[settings.py]",
+		},
+		{
+			protection: "Deployment/awx-web:.spec.template.spec.containers[0].image",
+			want:       FieldProtection{Kind: "Deployment", Name: "awx-web", Path: []string{"spec", "template", "spec", "containers", "0", "image"}},
+			wantString: "Deployment/awx-web:.spec.template.spec.containers[0].image",
+		},
+		{protection: "awx-admin-password", wantErr: "expected Kind/name[:.field.path]"},
+		{protection: "Secret/", wantErr: "expected Kind/name[:.field.path]"},
+		{protection: "/awx-admin-password", wantErr: "expected Kind/name[:.field.path]"},
+		{protection: "v1/Secret/awx-admin-password", wantErr: "expected Kind/name[:.field.path]"},
+		{protection: "Secret/awx-admin-password:data.password", wantErr: "must start with ."},
+		{protection: "Secret/awx-admin-password:.data[password", wantErr: "unclosed or empty bracket"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.protection, func(t *testing.T) {
+			got, err := ParseFieldProtection(tt.protection)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseFieldProtection() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFieldProtection() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFieldProtection() = %+v, want %+v", got, tt.want)
+			}
+			if got.String() != tt.wantString {
+				t.Errorf("String() = %q, want %q", got.String(), tt.wantString)
+			}
+		})
+	}
+}
+
+func TestFieldProtectionMatches(t *testing.T) {
+	protection := FieldProtection{Kind: "Secret", Name: "awx-admin-password"}
+	tests := []struct {
+		kind, name string
+		want       bool
+	}{
+		{kind: "Secret", name: "awx-admin-password", want: true},
+		{kind: "secret", name: "awx-admin-password", want: true},
+		{kind: "Secret", name: "AWX-admin-password"},
+		{kind: "ConfigMap", name: "awx-admin-password"},
+	}
+
+	for _, tt := range tests {
+		if got := protection.Matches(tt.kind, tt.name); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", tt.kind, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig returns the proxy settings for outbound HTTP calls:
+// AWX_PROXY_URL for both schemes if set, otherwise HTTP_PROXY and
+// HTTPS_PROXY. NO_PROXY is honored either way.
+func (c *Config) ProxyConfig() *httpproxy.Config {
+	proxy := httpproxy.FromEnvironment()
+	if c.ProxyURL != "" {
+		proxy.HTTPProxy = c.ProxyURL
+		proxy.HTTPSProxy = c.ProxyURL
+	}
+	return proxy
+}
+
+// validateProxyURL checks that AWX_PROXY_URL is an absolute proxy URL
+func validateProxyURL(proxyURL string) error {
+	if proxyURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid AWX_PROXY_URL: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("invalid AWX_PROXY_URL %q (expected an http, https or socks5 URL)", u.Redacted())
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid AWX_PROXY_URL %q (missing host)", u.Redacted())
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+// semverPattern matches a semantic version like 2.19.1, 24.6.1-rc1 or
+// v0.10.0, see https://semver.org
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+// versionFile is the version lockfile given by AWX_OPERATOR_VERSION_FILE,
+// e.g.
+//
+//	operator_version: 2.19.1
+//	awx_image_version: 24.6.1
+type versionFile struct {
+	OperatorVersion string `json:"operator_version"`
+	AWXImageVersion string `json:"awx_image_version,omitempty"`
+}
+
+// readVersionFile returns the versions pinned by a version lockfile, keyed
+// by the env var they stand in for
+func readVersionFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWX_OPERATOR_VERSION_FILE: %v", err)
+	}
+
+	var file versionFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse version file %s: %v", path, err)
+	}
+	if file.OperatorVersion == "" {
+		return nil, fmt.Errorf("version file %s does not set operator_version", path)
+	}
+
+	if !isSemver(file.OperatorVersion) {
+		return nil, fmt.Errorf("invalid operator_version %q in version file %s: not a semantic version (e.g. 2.19.1)", file.OperatorVersion, path)
+	}
+	versions := map[string]string{"AWX_OPERATOR_VERSION": file.OperatorVersion}
+
+	if file.AWXImageVersion != "" {
+		if !isSemver(file.AWXImageVersion) {
+			return nil, fmt.Errorf("invalid awx_image_version %q in version file %s: not a semantic version (e.g. 24.6.1)", file.AWXImageVersion, path)
+		}
+		versions["AWX_IMAGE_VERSION"] = file.AWXImageVersion
+	}
+	return versions, nil
+}
+
+// isSemver reports whether a version is a semantic version
+func isSemver(version string) bool {
+	return semverPattern.MatchString(version)
+}
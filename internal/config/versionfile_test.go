@@ -0,0 +1,152 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeVersionFile writes a version lockfile and returns its path
+func writeVersionFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "versions.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVersionFilePrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		// file is the content of the version file, none if empty
+		file               string
+		env                map[string]string
+		wantOperator       string
+		wantOperatorSource Source
+		wantImage          string
+		wantImageSource    Source
+	}{
+		{
+			name:               "no version file",
+			wantOperator:       DefaultOperatorVersion,
+			wantOperatorSource: SourceDefault,
+			wantImageSource:    SourceDefault,
+		},
+		{
+			name:               "operator version from file",
+			file:               "operator_version: 2.18.0\n",
+			wantOperator:       "2.18.0",
+			wantOperatorSource: SourceVersionFile,
+			wantImageSource:    SourceDefault,
+		},
+		{
+			name:               "both versions from file",
+			file:               "operator_version: 2.18.0\nawx_image_version: 24.5.0\n",
+			wantOperator:       "2.18.0",
+			wantOperatorSource: SourceVersionFile,
+			wantImage:          "24.5.0",
+			wantImageSource:    SourceVersionFile,
+		},
+		{
+			name:               "env overrides file",
+			file:               "operator_version: 2.18.0\nawx_image_version: 24.5.0\n",
+			env:                map[string]string{"AWX_OPERATOR_VERSION": "2.19.1"},
+			wantOperator:       "2.19.1",
+			wantOperatorSource: SourceEnv,
+			wantImage:          "24.5.0",
+			wantImageSource:    SourceVersionFile,
+		},
+		{
+			name:               "profile does not override file",
+			file:               "operator_version: 2.18.0\n",
+			env:                map[string]string{"AWX_PROFILE": "dev"},
+			wantOperator:       "2.18.0",
+			wantOperatorSource: SourceVersionFile,
+			wantImageSource:    SourceDefault,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			if tt.file != "" {
+				env["AWX_OPERATOR_VERSION_FILE"] = writeVersionFile(t, tt.file)
+			}
+
+			cfg := mustLoadEnv(t, env)
+			if cfg.OperatorVersion != tt.wantOperator {
+				t.Errorf("OperatorVersion = %q, want %q", cfg.OperatorVersion, tt.wantOperator)
+			}
+			if cfg.ImageVersion != tt.wantImage {
+				t.Errorf("ImageVersion = %q, want %q", cfg.ImageVersion, tt.wantImage)
+			}
+			if got := setting(t, cfg, "AWX_OPERATOR_VERSION").Source; got != tt.wantOperatorSource {
+				t.Errorf("AWX_OPERATOR_VERSION source = %q, want %q", got, tt.wantOperatorSource)
+			}
+			if got := setting(t, cfg, "AWX_IMAGE_VERSION").Source; got != tt.wantImageSource {
+				t.Errorf("AWX_IMAGE_VERSION source = %q, want %q", got, tt.wantImageSource)
+			}
+		})
+	}
+}
+
+func TestReadVersionFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{name: "malformed operator version", file: "operator_version: 2.19\n", wantErr: `invalid operator_version "2.19"`},
+		{name: "latest", file: "operator_version: latest\n", wantErr: `invalid operator_version "latest"`},
+		{name: "leading zero", file: "operator_version: 2.09.1\n", wantErr: `invalid operator_version "2.09.1"`},
+		{name: "malformed image version", file: "operator_version: 2.19.1\nawx_image_version: 24.6\n", wantErr: `invalid awx_image_version "24.6"`},
+		{name: "no operator version", file: "awx_image_version: 24.6.1\n", wantErr: "does not set operator_version"},
+		{name: "unknown field", file: "operator_version: 2.19.1\nawx_version: 24.6.1\n", wantErr: "failed to parse version file"},
+		{name: "not YAML", file: "operator_version: [\n", wantErr: "failed to parse version file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadEnv(t, map[string]string{"AWX_OPERATOR_VERSION_FILE": writeVersionFile(t, tt.file)})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewConfigFromEnv() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := loadEnv(t, map[string]string{"AWX_OPERATOR_VERSION_FILE": filepath.Join(t.TempDir(), "missing.yaml")})
+		if err == nil || !strings.Contains(err.Error(), "failed to read AWX_OPERATOR_VERSION_FILE") {
+			t.Fatalf("NewConfigFromEnv() error = %v, want a read error", err)
+		}
+	})
+}
+
+func TestIsSemver(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"2.19.1", true},
+		{"v0.10.0", true},
+		{"24.6.1-rc1", true},
+		{"1.0.0-alpha.1+build.5", true},
+		{"2.19", false},
+		{"2.19.1.0", false},
+		{"01.2.3", false},
+		{"2.19.1-", false},
+		{"latest", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isSemver(tt.version); got != tt.want {
+			t.Errorf("isSemver(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
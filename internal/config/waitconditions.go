@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// waitConditionOperators are the comparisons of a wait condition, two
+// character ones first so that >= is not read as >
+var waitConditionOperators = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// WaitCondition is a readiness gate on a field of an object in the AWX
+// namespace. It is written as [group/]version/resource/name:path[op value],
+// e.g. apps/v1/deployments/ldap-sync:.status.readyReplicas>=2 or
+// v1/configmaps/site-config:.data.ready=true. Without an operator the field
+// only has to exist.
+type WaitCondition struct {
+	Group    string
+	Version  string
+	Resource string
+	Name     string
+	// Path is the field, one entry per segment of .a.b[c.d][0]
+	Path  []string
+	Op    string // empty when the field only has to exist
+	Value string
+}
+
+// waitConditionUsage describes the syntax in errors
+const waitConditionUsage = "expected [group/]version/resource/name:.field.path[op value] with op one of =, !=, >, >=, <, <=, e.g. apps/v1/deployments/ldap-sync:.status.readyReplicas>=2"
+
+// ParseWaitCondition parses a condition written as
+// [group/]version/resource/name:path[op value]
+func ParseWaitCondition(condition string) (WaitCondition, error) {
+	target, expression, ok := strings.Cut(strings.TrimSpace(condition), ":")
+	if !ok {
+		return WaitCondition{}, fmt.Errorf("invalid wait condition %q (%s)", condition, waitConditionUsage)
+	}
+
+	var c WaitCondition
+	parts := strings.Split(target, "/")
+	switch len(parts) {
+	case 3:
+		c.Version, c.Resource, c.Name = parts[0], parts[1], parts[2]
+	case 4:
+		c.Group, c.Version, c.Resource, c.Name = parts[0], parts[1], parts[2], parts[3]
+	default:
+		return WaitCondition{}, fmt.Errorf("invalid wait condition %q (%s)", condition, waitConditionUsage)
+	}
+	if c.Version == "" || c.Resource == "" || c.Name == "" {
+		return WaitCondition{}, fmt.Errorf("invalid wait condition %q (%s)", condition, waitConditionUsage)
+	}
+
+	path, op, value := splitWaitExpression(expression)
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return WaitCondition{}, fmt.Errorf("invalid wait condition %q: %v", condition, err)
+	}
+	c.Path, c.Op, c.Value = segments, op, strings.TrimSpace(value)
+
+	if c.Op != "" && c.Op != "=" && c.Op != "!=" {
+		if _, err := strconv.ParseFloat(c.Value, 64); err != nil {
+			return WaitCondition{}, fmt.Errorf("invalid wait condition %q: %s needs a number, not %q", condition, c.Op, c.Value)
+		}
+	}
+	return c, nil
+}
+
+// splitWaitExpression splits an expression at the first operator outside
+// brackets into the field path, the operator and the expected value
+func splitWaitExpression(expression string) (string, string, string) {
+	depth := 0
+	for i := 0; i < len(expression); i++ {
+		switch expression[i] {
+		case '[':
+			depth++
+			continue
+		case ']':
+			depth--
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		for _, op := range waitConditionOperators {
+			if strings.HasPrefix(expression[i:], op) {
+				return strings.TrimSpace(expression[:i]), op, expression[i+len(op):]
+			}
+		}
+	}
+	return strings.TrimSpace(expression), "", ""
+}
+
+// parseFieldPath parses a field path such as .status.readyReplicas or
+// .data[settings.py] into its segments. Brackets hold keys containing dots
+// and list indexes.
+func parseFieldPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "[") {
+		return nil, fmt.Errorf("field path %q must start with . (e.g. .status.readyReplicas)", path)
+	}
+
+	var segments []string
+	for rest := path; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			segment := rest[1 : end+1]
+			if segment == "" {
+				return nil, fmt.Errorf("field path %q has an empty segment", path)
+			}
+			segments = append(segments, segment)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end <= 1 {
+				return nil, fmt.Errorf("field path %q has an unclosed or empty bracket", path)
+			}
+			segments = append(segments, rest[1:end])
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("field path %q is invalid at %q", path, rest)
+		}
+	}
+	return segments, nil
+}
+
+// FieldPath returns the field path as written, e.g. .data[settings.py]
+func (c WaitCondition) FieldPath() string {
+	return formatFieldPath(c.Path)
+}
+
+// formatFieldPath writes the segments of a field path the way
+// parseFieldPath reads them. Indexes and keys holding dots, brackets or
+// operator characters go in brackets.
+func formatFieldPath(segments []string) string {
+	var path strings.Builder
+	for _, segment := range segments {
+		if _, err := strconv.Atoi(segment); err == nil || strings.ContainsAny(segment, ".[=!<>") {
+			path.WriteString("[" + segment + "]")
+		} else {
+			path.WriteString("." + segment)
+		}
+	}
+	return path.String()
+}
+
+func (c WaitCondition) String() string {
+	target := c.Version + "/" + c.Resource + "/" + c.Name
+	if c.Group != "" {
+		target = c.Group + "/" + target
+	}
+	return target + ":" + c.FieldPath() + c.Op + c.Value
+}
+
+// WaitConditions returns the conditions of AWX_EXTRA_WAIT_CONDITIONS. The list is
+// validated when the configuration is loaded, so invalid entries can only
+// come from a Config built by hand and are skipped.
+func (c *Config) WaitConditions() []WaitCondition {
+	var parsed []WaitCondition
+	for _, entry := range c.ExtraWaitConditions {
+		if condition, err := ParseWaitCondition(entry); err == nil {
+			parsed = append(parsed, condition)
+		}
+	}
+	return parsed
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWaitCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      WaitCondition
+		wantErr   string
+	}{
+		{
+			condition: "apps/v1/deployments/ldap-sync:.status.readyReplicas>=2",
+			want:      WaitCondition{Group: "apps", Version: "v1", Resource: "deployments", Name: "ldap-sync", Path: []string{"status", "readyReplicas"}, Op: ">=", Value: "2"},
+		},
+		{
+			condition: "v1/configmaps/site-config:.data.ready=true",
+			want:      WaitCondition{Version: "v1", Resource: "configmaps", Name: "site-config", Path: []string{"data", "ready"}, Op: "=", Value: "true"},
+		},
+		{
+			condition: "v1/configmaps/site-config:.data[settings.py]",
+			want:      WaitCondition{Version: "v1", Resource: "configmaps", Name: "site-config", Path: []string{"data", "settings.py"}},
+		},
+		{
+			condition: "apps/v1/deployments/web:.status.conditions[0].status != False",
+			want:      WaitCondition{Group: "apps", Version: "v1", Resource: "deployments", Name: "web", Path: []string{"status", "conditions", "0", "status"}, Op: "!=", Value: "False"},
+		},
+		{
+			condition: "v1/configmaps/site-config:.data[a=b]=c",
+			want:      WaitCondition{Version: "v1", Resource: "configmaps", Name: "site-config", Path: []string{"data", "a=b"}, Op: "=", Value: "c"},
+		},
+		{condition: "v1/configmaps/site-config", wantErr: "expected [group/]version/resource/name:.field.path[op value]"},
+		{condition: "configmaps/site-config:.data", wantErr: "expected [group/]version/resource/name"},
+		{condition: "a/b/c/d/e:.data", wantErr: "expected [group/]version/resource/name"},
+		{condition: "v1//site-config:.data", wantErr: "expected [group/]version/resource/name"},
+		{condition: "v1/configmaps/site-config:data.ready", wantErr: "must start with ."},
+		{condition: "v1/configmaps/site-config:.data..ready", wantErr: "has an empty segment"},
+		{condition: "v1/configmaps/site-config:.data[ready", wantErr: "unclosed or empty bracket"},
+		{condition: "apps/v1/deployments/web:.status.readyReplicas>two", wantErr: `> needs a number, not "two"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			got, err := ParseWaitCondition(tt.condition)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseWaitCondition() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWaitCondition() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseWaitCondition() = %+v, want %+v", got, tt.want)
+			}
+
+			// The condition reads back as written, bar spaces
+			again, err := ParseWaitCondition(got.String())
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("ParseWaitCondition(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+			}
+		})
+	}
+}
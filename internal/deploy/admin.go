@@ -0,0 +1,165 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/awx"
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// AdminRotator updates the admin credentials of an existing AWX install.
+// AWX only reads the admin user and password at bootstrap, so later changes
+// have to go through the API.
+type AdminRotator struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewAdminRotator creates a new admin rotator
+func NewAdminRotator(k8sClient *k8s.KubernetesClient, config *config.Config) *AdminRotator {
+	return &AdminRotator{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Rotate changes the admin username and password of an existing install to
+// the configured ones. It must run before the manifests overwrite the admin
+// password secret, since the current password is read from it.
+func (a *AdminRotator) Rotate(ctx context.Context) error {
+	if !a.config.RotateAdmin {
+		return nil
+	}
+
+	exists, err := a.k8sClient.AWXExists(ctx, a.config.AWXName, a.config.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to check AWX instance: %v", err)
+	}
+	if !exists {
+		log.Println("No existing AWX instance, admin credentials will be set at bootstrap")
+		return nil
+	}
+
+	currentUser, currentPassword, err := a.currentCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]string{}
+	if currentUser != a.config.AdminUser {
+		fields["username"] = a.config.AdminUser
+	}
+	if currentPassword != a.config.AdminPassword {
+		fields["password"] = a.config.AdminPassword
+	}
+	if len(fields) == 0 {
+		log.Println("Admin credentials unchanged, nothing to rotate")
+		return nil
+	}
+
+	client := awx.NewClient(awxBaseURL(a.config), currentUser, currentPassword, a.config.ProxyConfig().ProxyFunc())
+	user, err := client.Me(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate as current admin %s: %v", currentUser, err)
+	}
+
+	if err := client.UpdateUser(ctx, user.ID, fields); err != nil {
+		return fmt.Errorf("failed to update admin user: %v", err)
+	}
+
+	if _, ok := fields["username"]; ok {
+		log.Printf("✓ Renamed AWX admin user %s to %s", currentUser, a.config.AdminUser)
+	}
+	if _, ok := fields["password"]; ok {
+		log.Printf("✓ Rotated password of AWX admin user %s", a.config.AdminUser)
+	}
+	return nil
+}
+
+// KeepGeneratedPassword replaces a generated admin password with the one of
+// an existing install, so that re-runs without a configured password do
+// not change it
+func (a *AdminRotator) KeepGeneratedPassword(ctx context.Context) error {
+	if !a.config.AdminPasswordGenerated {
+		return nil
+	}
+
+	exists, err := a.k8sClient.AWXExists(ctx, a.config.AWXName, a.config.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to check AWX instance: %v", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	_, currentPassword, err := a.currentCredentials(ctx)
+	if err != nil {
+		return err
+	}
+	if currentPassword != "" {
+		log.Println("No admin password configured, keeping the password of the existing install")
+		a.config.AdminPassword = currentPassword
+	}
+	return nil
+}
+
+// AdminPasswordSecretName returns the name of the secret holding the admin
+// password, as referenced by the generated AWX CR
+func AdminPasswordSecretName(cfg *config.Config) (string, error) {
+	manifests, err := NewManifestGenerator(cfg, DefaultManifestsPath).Generate()
+	if err != nil {
+		return "", err
+	}
+	for _, manifest := range manifests {
+		if isAWX(manifest.Object) {
+			return adminPasswordSecretName(manifest.Object, cfg), nil
+		}
+	}
+	return fmt.Sprintf("%s-admin-password", cfg.AWXName), nil
+}
+
+// currentCredentials reads the admin user from the AWX CR and the admin
+// password from the secret the CR references
+func (a *AdminRotator) currentCredentials(ctx context.Context) (string, string, error) {
+	cr, err := a.k8sClient.GetAWX(ctx, a.config.AWXName, a.config.Namespace)
+	if err != nil {
+		return "", "", err
+	}
+
+	user, _, _ := unstructured.NestedString(cr.Object, "spec", "admin_user")
+	if user == "" {
+		user = "admin"
+	}
+
+	secretName := adminPasswordSecretName(cr, a.config)
+	secret, err := a.k8sClient.GetSecret(ctx, secretName, a.config.Namespace)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read current admin password: %v", err)
+	}
+
+	return user, string(secret.Data["password"]), nil
+}
+
+// adminPasswordSecretName returns the admin password secret referenced by the
+// AWX CR, or the operator's default name
+func adminPasswordSecretName(cr *unstructured.Unstructured, cfg *config.Config) string {
+	if name, _, _ := unstructured.NestedString(cr.Object, "spec", "admin_password_secret"); name != "" {
+		return name
+	}
+	return fmt.Sprintf("%s-admin-password", cfg.AWXName)
+}
+
+// awxBaseURL returns the external URL of the AWX API, under AWX_INGRESS_PATH
+func awxBaseURL(cfg *config.Config) string {
+	scheme := "https://"
+	if !cfg.TLS {
+		scheme = "http://"
+	}
+	return scheme + strings.TrimSuffix(cfg.AWXHostname, "/") + cfg.IngressPath
+}
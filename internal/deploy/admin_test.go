@@ -0,0 +1,134 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// mockAWX is an AWX API with a single admin user
+type mockAWX struct {
+	username string
+	password string
+
+	mu      sync.Mutex
+	patches []map[string]string
+}
+
+func (m *mockAWX) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, password, ok := r.BasicAuth(); !ok || user != m.username || password != m.password {
+		http.Error(w, `{"detail": "Authentication credentials were not provided."}`, http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/me/":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]interface{}{{"id": 1, "username": m.username, "is_superuser": true}},
+		})
+	case r.Method == http.MethodPatch && r.URL.Path == "/api/v2/users/1/":
+		var fields map[string]string
+		json.NewDecoder(r.Body).Decode(&fields)
+		m.patches = append(m.patches, fields)
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestAdminRotatorRotate(t *testing.T) {
+	installed := func(user, password string) []runtime.Object {
+		awx := k8stest.AWX("awx", "awx-instance")
+		unstructured.SetNestedField(awx.Object, user, "spec", "admin_user")
+		unstructured.SetNestedField(awx.Object, "awx-admin-password", "spec", "admin_password_secret")
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "awx-admin-password", Namespace: "awx"},
+			Data:       map[string][]byte{"password": []byte(password)},
+		}
+		return []runtime.Object{awx, secret}
+	}
+
+	tests := []struct {
+		name        string
+		objects     []runtime.Object
+		env         map[string]string
+		wantPatches []map[string]string
+		wantErr     string
+	}{
+		{
+			name:    "unchanged credentials",
+			objects: installed("admin", "Old-Admin-Pass-1"),
+			env:     map[string]string{"AWX_ROTATE_ADMIN": "true", "AWX_ADMIN_PASSWORD": "Old-Admin-Pass-1"},
+		},
+		{
+			name:        "rotated password",
+			objects:     installed("admin", "Old-Admin-Pass-1"),
+			env:         map[string]string{"AWX_ROTATE_ADMIN": "true", "AWX_ADMIN_PASSWORD": "New-Admin-Pass-2"},
+			wantPatches: []map[string]string{{"password": "New-Admin-Pass-2"}},
+		},
+		{
+			name:        "renamed user and rotated password",
+			objects:     installed("admin", "Old-Admin-Pass-1"),
+			env:         map[string]string{"AWX_ROTATE_ADMIN": "true", "AWX_ADMIN_USER": "tower", "AWX_ADMIN_PASSWORD": "New-Admin-Pass-2"},
+			wantPatches: []map[string]string{{"username": "tower", "password": "New-Admin-Pass-2"}},
+		},
+		{
+			name:    "rotation disabled",
+			objects: installed("admin", "Old-Admin-Pass-1"),
+			env:     map[string]string{"AWX_ADMIN_PASSWORD": "New-Admin-Pass-2"},
+		},
+		{
+			name: "no existing install",
+			env:  map[string]string{"AWX_ROTATE_ADMIN": "true", "AWX_ADMIN_PASSWORD": "New-Admin-Pass-2"},
+		},
+		{
+			name:    "secret out of sync with AWX",
+			objects: installed("admin", "Stale-Admin-Pass-0"),
+			env:     map[string]string{"AWX_ROTATE_ADMIN": "true", "AWX_ADMIN_PASSWORD": "New-Admin-Pass-2"},
+			wantErr: "failed to authenticate as current admin admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &mockAWX{username: "admin", password: "Old-Admin-Pass-1"}
+			server := httptest.NewServer(api)
+			defer server.Close()
+
+			// AWX is reached at its hostname through the mock as a proxy
+			env := map[string]string{"AWX_TLS": "false", "AWX_HOSTNAME": "awx.example.com", "AWX_PROXY_URL": server.URL}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cluster := k8stest.NewCluster(tt.objects...)
+
+			err := NewAdminRotator(cluster.Client, testConfig(t, env)).Rotate(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Rotate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rotate() failed: %v", err)
+			}
+			if !reflect.DeepEqual(api.patches, tt.wantPatches) {
+				t.Errorf("user updates = %v, want %v", api.patches, tt.wantPatches)
+			}
+		})
+	}
+}
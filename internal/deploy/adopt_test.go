@@ -0,0 +1,118 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// settingsObject returns the ConfigMap awx-settings with the given labels,
+// annotations and data value
+func settingsObject(labels, annotations map[string]string, value string) *unstructured.Unstructured {
+	obj := k8stest.Object("v1", "ConfigMap", "awx", "awx-settings")
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+	unstructured.SetNestedStringMap(obj.Object, map[string]string{"key": value}, "data")
+	return obj
+}
+
+func TestApplyManifestAdoptExisting(t *testing.T) {
+	unmanaged := settingsObject(map[string]string{ManagedByLabel: "helm"}, nil, "other tool")
+	managed := settingsObject(map[string]string{ManagedByLabel: ManagedByValue}, nil, "old")
+	// legacy was applied before the deployer set ManagedByLabel
+	legacy := settingsObject(nil, map[string]string{SourceAnnotation: "10-settings.yaml"}, "old")
+
+	tests := []struct {
+		name     string
+		policy   string
+		existing *unstructured.Unstructured
+		// wantValue is the data value afterwards, wantManager its manager
+		wantValue   string
+		wantManager string
+		wantErr     string
+	}{
+		{name: "adopt unmanaged", policy: "adopt", existing: unmanaged, wantValue: "desired", wantManager: ManagedByValue},
+		{name: "skip unmanaged", policy: "skip", existing: unmanaged, wantValue: "other tool", wantManager: "helm"},
+		{
+			name:        "fail on unmanaged",
+			policy:      "fail",
+			existing:    unmanaged,
+			wantValue:   "other tool",
+			wantManager: "helm",
+			wantErr:     "ConfigMap awx/awx-settings exists and is not managed by awx-deployer, set AWX_ADOPT_EXISTING=adopt to take it over or skip to leave it alone",
+		},
+		{name: "skip updates managed", policy: "skip", existing: managed, wantValue: "desired", wantManager: ManagedByValue},
+		{name: "fail updates managed", policy: "fail", existing: managed, wantValue: "desired", wantManager: ManagedByValue},
+		{name: "fail updates legacy managed", policy: "fail", existing: legacy, wantValue: "desired", wantManager: ManagedByValue},
+		{name: "skip creates missing", policy: "skip", wantValue: "desired", wantManager: ManagedByValue},
+		{name: "fail creates missing", policy: "fail", wantValue: "desired", wantManager: ManagedByValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing != nil {
+				objects = append(objects, tt.existing.DeepCopy())
+			}
+			cluster := k8stest.NewCluster(objects...)
+			applier := NewManifestApplier(cluster.Client, testConfig(t, map[string]string{"AWX_ADOPT_EXISTING": tt.policy}))
+
+			desired := settingsObject(nil, nil, "desired")
+			setManagedBy(desired, "awx.awx-instance")
+			_, err := applier.applyManifest(context.Background(), Manifest{Source: "10-settings.yaml", Object: desired}, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyManifest() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("applyManifest() failed: %v", err)
+			}
+
+			live, err := cluster.Client.GetObject(context.Background(), desired)
+			if err != nil || live == nil {
+				t.Fatalf("GetObject() = %v, %v", live, err)
+			}
+			if value, _, _ := unstructured.NestedString(live.Object, "data", "key"); value != tt.wantValue {
+				t.Errorf("data.key = %q, want %q", value, tt.wantValue)
+			}
+			if manager := live.GetLabels()[ManagedByLabel]; manager != tt.wantManager {
+				t.Errorf("%s = %q, want %q", ManagedByLabel, manager, tt.wantManager)
+			}
+		})
+	}
+}
+
+func TestSetManagedBy(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{name: "unlabeled", want: ManagedByValue},
+		{name: "other labels kept", labels: map[string]string{"app": "awx"}, want: ManagedByValue},
+		{name: "manager named in the manifest", labels: map[string]string{ManagedByLabel: "argocd"}, want: "argocd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := settingsObject(tt.labels, nil, "")
+			setManagedBy(obj, "awx.awx-instance")
+			if got := obj.GetLabels()[ManagedByLabel]; got != tt.want {
+				t.Errorf("%s = %q, want %q", ManagedByLabel, got, tt.want)
+			}
+			if instance, ok := obj.GetLabels()[InstanceLabel]; ok != (tt.want == ManagedByValue) || ok && instance != "awx.awx-instance" {
+				t.Errorf("%s = %q, want it set only when %s is", InstanceLabel, instance, ManagedByValue)
+			}
+			for key, value := range tt.labels {
+				if key != ManagedByLabel && obj.GetLabels()[key] != value {
+					t.Errorf("label %s dropped", key)
+				}
+			}
+		})
+	}
+}
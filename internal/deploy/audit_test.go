@@ -0,0 +1,115 @@
+package deploy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"awx-deployer/internal/audit"
+	"awx-deployer/internal/k8s/k8stest"
+	"awx-deployer/internal/state"
+)
+
+// auditTrail returns the records of an audit file as "verb resource
+// namespace/name result"
+func auditTrail(t *testing.T, path string, wantDryRun bool) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var trail []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		if record.DryRun != wantDryRun {
+			t.Errorf("record %s has dry_run %v, want %v", scanner.Text(), record.DryRun, wantDryRun)
+		}
+		trail = append(trail, record.Verb+" "+record.Resource+" "+record.Namespace+"/"+record.Name+" "+record.Result)
+	}
+	return trail
+}
+
+func TestApplyAuditTrail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(state.NewFileStore(), path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := k8stest.NewCluster()
+	cluster.Client.SetAuditLog(auditLog)
+	applier := NewManifestApplier(cluster.Client, testConfig(t, map[string]string{"AWX_NAMESPACE": "awx"}))
+
+	manifests := func() []Manifest {
+		return []Manifest{
+			{Source: "01-namespace.yaml", Object: k8stest.Object("v1", "Namespace", "", "awx")},
+			{Source: "settings.yaml", Object: k8stest.Object("v1", "ConfigMap", "awx", "settings")},
+		}
+	}
+	// the second run updates the existing objects
+	for run := 0; run < 2; run++ {
+		if _, err := applier.applyAll(context.Background(), manifests()); err != nil {
+			t.Fatalf("applyAll() failed: %v", err)
+		}
+	}
+	if err := cluster.Client.DeleteObject(context.Background(), k8stest.Object("v1", "ConfigMap", "awx", "settings")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"create namespaces /awx success",
+		"create configmaps awx/settings success",
+		"update namespaces /awx success",
+		"update configmaps awx/settings success",
+		"delete configmaps awx/settings success",
+	}
+	if got := auditTrail(t, path, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("audit trail = %q, want %q", got, want)
+	}
+}
+
+func TestRecordPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(state.NewFileStore(), path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []PlanStep{
+		{Verb: PlanSkip, Kind: "Deployment", Namespace: "awx", Name: "awx-operator-controller-manager"},
+		{Verb: PlanUpdate, Kind: "Secret", Namespace: "awx", Name: "awx-admin-password"},
+		{Verb: PlanCreate, Kind: "AWX", Namespace: "awx", Name: "awx-instance"},
+	}
+	cluster := k8stest.NewCluster(k8stest.Object("v1", "Secret", "awx", "awx-admin-password"))
+	cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx"})
+	planner := NewPlanner(cluster.Client, cfg)
+	for i, obj := range []struct{ apiVersion, kind string }{{"v1", "Secret"}, {"awx.ansible.com/v1beta1", "AWX"}} {
+		step, err := planner.planManifest(context.Background(), k8stest.Object(obj.apiVersion, obj.kind, "awx", steps[i+1].Name), false)
+		if err != nil {
+			t.Fatalf("planManifest() failed: %v", err)
+		}
+		if step.Verb != steps[i+1].Verb {
+			t.Errorf("%s planned as %s, want %s", obj.kind, step.Verb, steps[i+1].Verb)
+		}
+		steps[i+1] = step
+	}
+
+	RecordPlan(auditLog, steps)
+
+	want := []string{
+		"would-update secrets awx/awx-admin-password success",
+		"would-create awxs awx/awx-instance success",
+	}
+	if got := auditTrail(t, path, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("audit trail = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"awx-deployer/internal/awx"
+	"awx-deployer/internal/images"
+)
+
+// verifyVersion determines the AWX version actually running, from the ping
+// endpoint when the API check is enabled or else from the image tag of the
+// web pods, and compares it with AWX_IMAGE_VERSION. A different version is
+// logged as a warning, or returned as an error when warnings are treated as
+// errors.
+func (v *DeploymentVerifier) verifyVersion(ctx context.Context) error {
+	version, source, err := v.runningAWXVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		log.Printf("Warning: Could not determine the running AWX version, the web pods' image has no version tag")
+		return nil
+	}
+	v.runningVersion = version
+	log.Printf("✓ AWX %s is running (reported by the %s)", version, source)
+
+	expected := v.config.ImageVersion
+	if expected == "" || strings.TrimPrefix(expected, "v") == strings.TrimPrefix(version, "v") {
+		return nil
+	}
+	problem := fmt.Sprintf("AWX %s is running, but AWX_IMAGE_VERSION is %s", version, expected)
+	if v.config.TreatWarningsAsErrors {
+		return fmt.Errorf("%s", problem)
+	}
+	log.Printf("Warning: %s", problem)
+	return nil
+}
+
+// RunningVersion returns the AWX version the last verification found
+// running, or empty if it was not determined
+func (v *DeploymentVerifier) RunningVersion() string {
+	return v.runningVersion
+}
+
+// runningAWXVersion returns the running AWX version and where it was read.
+// The API is only asked when the API check is enabled, since AWX_HOSTNAME
+// need not be reachable otherwise. If it does not answer the web pods'
+// image tag is used.
+func (v *DeploymentVerifier) runningAWXVersion(ctx context.Context) (string, string, error) {
+	if v.config.VerifyAPI {
+		client, _, baseURL, err := v.apiClient(ctx)
+		var status *awx.PingStatus
+		if err == nil {
+			status, err = client.Ping(ctx)
+		}
+		if err == nil && status.Version != "" {
+			return status.Version, "API", nil
+		}
+		if err != nil {
+			log.Printf("Warning: Could not read the AWX version from the API at %s, using the image tag: %v", baseURL, err)
+		}
+	}
+
+	version, err := v.webImageVersion(ctx)
+	return version, "web pods' image tag", err
+}
+
+// webImageVersion returns the tag of the AWX image of the web pods, or of
+// the web deployment's pod template if no pod exists
+func (v *DeploymentVerifier) webImageVersion(ctx context.Context) (string, error) {
+	deployment, err := findInstanceObject(ctx, v.k8sClient, v.config, deploymentsGVR, roleWeb)
+	if err != nil {
+		return "", err
+	}
+	if deployment == nil {
+		return "", fmt.Errorf("AWX web deployment of instance %s does not exist", v.config.AWXName)
+	}
+
+	pods, err := workloadPods(ctx, v.k8sClient, v.config, deployment)
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods {
+		if image := awxImage(pod.Spec.Containers); image != "" {
+			return images.Tag(image), nil
+		}
+	}
+
+	web, err := v.k8sClient.GetDeployment(ctx, deployment.GetName(), v.config.Namespace)
+	if err != nil {
+		return "", err
+	}
+	return images.Tag(awxImage(web.Spec.Template.Spec.Containers)), nil
+}
+
+// awxImage returns the image of the AWX web container, named <name>-web by
+// the operator, or else of the first container running an image named awx
+func awxImage(containers []corev1.Container) string {
+	for _, container := range containers {
+		if strings.HasSuffix(container.Name, "-web") {
+			return container.Image
+		}
+	}
+	for _, container := range containers {
+		name := container.Image
+		if i := strings.Index(name, "@"); i != -1 {
+			name = name[:i]
+		}
+		if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+			name = name[:i]
+		}
+		if path.Base(name) == "awx" {
+			return container.Image
+		}
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// versionedWeb returns the web deployment of awx-instance running the given
+// AWX image, with a pod unless podImage is empty
+func versionedWeb(templateImage, podImage string) []runtime.Object {
+	web := instanceDeployment("awx", "awx-instance", "web")
+	web.Spec.Template.Spec.Containers = []corev1.Container{{Name: "redis", Image: "redis:7"}, {Name: "awx-instance-web", Image: templateImage}}
+	objects := []runtime.Object{web}
+	if podImage != "" {
+		pod := workloadPod(web, "awx-instance-web-1", corev1.ContainerStatus{Name: "awx-instance-web", Ready: true})
+		pod.Spec.Containers = []corev1.Container{{Name: "redis", Image: "redis:7"}, {Name: "awx-instance-web", Image: podImage}}
+		objects = append(objects, pod)
+	}
+	return objects
+}
+
+func TestVerifyVersion(t *testing.T) {
+	adminPassword := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-instance-admin-password", Namespace: "awx"},
+		Data:       map[string][]byte{"password": []byte("Admin-Pass-1")},
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		objects []runtime.Object
+		// api is the version the ping endpoint reports, or the status it
+		// fails with if pingStatus is set
+		api        string
+		pingStatus int
+		expected   string
+		want       string
+		wantErr    string
+	}{
+		{
+			name:    "reported by the API",
+			env:     map[string]string{"AWX_VERIFY_API": "true"},
+			objects: versionedWeb("quay.io/ansible/awx:24.5.0", "quay.io/ansible/awx:24.5.0"),
+			api:     "24.6.1",
+			want:    "24.6.1",
+		},
+		{
+			name:       "image tag when the API does not answer",
+			env:        map[string]string{"AWX_VERIFY_API": "true"},
+			objects:    versionedWeb("quay.io/ansible/awx:24.5.0", "quay.io/ansible/awx:24.6.1"),
+			pingStatus: http.StatusServiceUnavailable,
+			want:       "24.6.1",
+		},
+		{
+			name:    "image tag without the API check",
+			objects: versionedWeb("quay.io/ansible/awx:24.5.0", "registry.local:5000/ansible/awx:24.6.1"),
+			api:     "24.5.0",
+			want:    "24.6.1",
+		},
+		{
+			name:    "pod template image without pods",
+			objects: versionedWeb("quay.io/ansible/awx:24.6.1", ""),
+			want:    "24.6.1",
+		},
+		{
+			name:    "image by digest only",
+			objects: versionedWeb("quay.io/ansible/awx@sha256:abc", "quay.io/ansible/awx@sha256:abc"),
+		},
+		{
+			name:     "matches the expected version",
+			objects:  versionedWeb("quay.io/ansible/awx:24.6.1", "quay.io/ansible/awx:24.6.1"),
+			expected: "v24.6.1",
+			want:     "24.6.1",
+		},
+		{
+			name:     "differs from the expected version",
+			objects:  versionedWeb("quay.io/ansible/awx:24.6.1", "quay.io/ansible/awx:24.6.1"),
+			expected: "24.5.0",
+			want:     "24.6.1",
+		},
+		{
+			name:     "differs from the expected version in strict mode",
+			env:      map[string]string{"AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			objects:  versionedWeb("quay.io/ansible/awx:24.6.1", "quay.io/ansible/awx:24.6.1"),
+			expected: "24.5.0",
+			want:     "24.6.1",
+			wantErr:  "AWX 24.6.1 is running, but AWX_IMAGE_VERSION is 24.5.0",
+		},
+		{
+			name:    "web deployment missing",
+			wantErr: "AWX web deployment of instance awx-instance does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.pingStatus != 0 {
+					w.WriteHeader(tt.pingStatus)
+					return
+				}
+				fmt.Fprintf(w, `{"version": %q}`, tt.api)
+			}))
+			defer ts.Close()
+
+			env := map[string]string{
+				"AWX_NAMESPACE":      "awx",
+				"AWX_TLS":            "false",
+				"AWX_VERIFY_RETRIES": "0",
+			}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			objects := append([]runtime.Object{k8stest.AWX("awx", "awx-instance"), adminPassword}, tt.objects...)
+			cfg := testConfig(t, env)
+			// a host:port does not pass as AWX_HOSTNAME
+			cfg.AWXHostname = strings.TrimPrefix(ts.URL, "http://")
+			cfg.ImageVersion = tt.expected
+			verifier := NewDeploymentVerifier(k8stest.NewCluster(objects...).Client, cfg)
+
+			err := verifier.verifyVersion(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verifyVersion() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("verifyVersion() failed: %v", err)
+			}
+			if got := verifier.RunningVersion(); got != tt.want {
+				t.Errorf("RunningVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/events"
+	"awx-deployer/internal/k8s"
+)
+
+var (
+	// certificateGVR is the resource of cert-manager Certificates
+	certificateGVR = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+	// challengeGVR is the resource of the ACME challenges cert-manager solves
+	// to issue a certificate
+	challengeGVR = schema.GroupVersionResource{Group: "acme.cert-manager.io", Version: "v1", Resource: "challenges"}
+)
+
+// certificateExpected reports whether cert-manager issues the ingress TLS
+// secret, which it does through a Certificate named after the secret.
+// Certificate files take precedence over the issuer.
+func certificateExpected(cfg *config.Config) bool {
+	return cfg.TLS && cfg.CertIssuer != "" && cfg.TLSCertFile == ""
+}
+
+// waitForCertificate waits up to AWX_CERT_TIMEOUT minutes for the Certificate
+// of the ingress TLS secret to become Ready. Without cert-manager installed
+// there is nothing to wait for. On timeout the error carries why issuance is
+// stuck, from the Certificate's conditions and its ACME challenges.
+func (d *DeploymentWaiter) waitForCertificate(ctx context.Context) error {
+	name := d.config.TLSSecretName
+
+	crd, err := d.k8sClient.CRDName(ctx, certificateGVR.Group, "Certificate")
+	if err != nil {
+		return err
+	}
+	if crd == "" {
+		log.Printf("Warning: cert-manager is not installed, not waiting for certificate %s", name)
+		return nil
+	}
+
+	timeout := time.Duration(d.config.CertTimeout) * time.Minute
+	log.Printf("Waiting for certificate %s to be issued by %s (timeout: %v)...", name, d.config.CertIssuer, timeout)
+	events.Progressf(ctx, "waiting for certificate %s", name)
+
+	var last *unstructured.Unstructured
+	ready := func(cert *unstructured.Unstructured) (bool, error) {
+		last = cert
+		return k8s.HasCondition(cert, "Ready", "True"), nil
+	}
+	if _, err := d.k8sClient.WaitFor(ctx, certificateGVR, name, d.config.Namespace, "condition Ready=True", ready, timeout); err != nil {
+		return fmt.Errorf("certificate %s is not ready after %v: %s", name, timeout, d.certificateFailure(ctx, last))
+	}
+
+	log.Printf("✓ Certificate %s is ready", name)
+	return nil
+}
+
+// certificateFailure describes why a Certificate is not Ready: its
+// conditions that are not True and the reasons of its failing ACME
+// challenges, such as a challenge the ACME server could not reach
+func (d *DeploymentWaiter) certificateFailure(ctx context.Context, cert *unstructured.Unstructured) string {
+	if cert == nil {
+		return fmt.Sprintf("it was never created, check that the ingress names TLS secret %s and carries the %s annotation", d.config.TLSSecretName, certIssuerAnnotation)
+	}
+
+	var reasons []string
+	for _, condition := range awxConditions(cert) {
+		if strings.EqualFold(condition.Status, "True") || (condition.Reason == "" && condition.Message == "") {
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf("%s=%s (%s: %s)", condition.Type, condition.Status, condition.Reason, condition.Message))
+	}
+
+	// Challenges are named after the certificate request, which is named
+	// after the certificate
+	challenges, err := d.k8sClient.ListResources(ctx, challengeGVR.Group, challengeGVR.Version, challengeGVR.Resource, d.config.Namespace)
+	if err != nil {
+		log.Printf("Warning: Could not list ACME challenges: %v", err)
+	}
+	for _, challenge := range challenges {
+		if !strings.HasPrefix(challenge.GetName(), cert.GetName()+"-") {
+			continue
+		}
+		reason, _, _ := unstructured.NestedString(challenge.Object, "status", "reason")
+		if reason == "" {
+			continue
+		}
+		state, _, _ := unstructured.NestedString(challenge.Object, "status", "state")
+		domain, _, _ := unstructured.NestedString(challenge.Object, "spec", "dnsName")
+		reasons = append(reasons, fmt.Sprintf("challenge %s for %s is %s: %s", challenge.GetName(), domain, state, reason))
+	}
+
+	if len(reasons) == 0 {
+		return "cert-manager reports no reason yet"
+	}
+	return strings.Join(reasons, "; ")
+}
@@ -0,0 +1,135 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// certificate returns the cert-manager Certificate awx-tls with the given
+// conditions
+func certificate(conditions ...map[string]interface{}) *unstructured.Unstructured {
+	cert := k8stest.Object("cert-manager.io/v1", "Certificate", "awx", "awx-tls")
+	items := make([]interface{}, 0, len(conditions))
+	for _, condition := range conditions {
+		items = append(items, condition)
+	}
+	unstructured.SetNestedSlice(cert.Object, items, "status", "conditions")
+	return cert
+}
+
+func TestCertificateExpected(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// noIssuer clears the issuer, which AWX_CERT_ISSUER defaults
+		noIssuer bool
+		want     bool
+	}{
+		{name: "issuer", want: true},
+		{name: "TLS disabled", env: map[string]string{"AWX_TLS": "false"}},
+		{name: "no issuer", noIssuer: true},
+		{name: "certificate files", env: map[string]string{"AWX_TLS_CERT_FILE": "tls.crt", "AWX_TLS_KEY_FILE": "tls.key"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, tt.env)
+			if tt.noIssuer {
+				cfg.CertIssuer = ""
+			}
+			if got := certificateExpected(cfg); got != tt.want {
+				t.Errorf("certificateExpected() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForCertificate(t *testing.T) {
+	certificateCRD := servedCRD("cert-manager.io", "certificates", "Certificate")
+	ready := map[string]interface{}{"type": "Ready", "status": "True", "reason": "Ready"}
+	issuing := map[string]interface{}{"type": "Ready", "status": "False", "reason": "DoesNotExist", "message": "Issuing certificate as Secret does not exist"}
+	challenge := k8stest.Object("acme.cert-manager.io/v1", "Challenge", "awx", "awx-tls-1-2793004136-1817512283")
+	unstructured.SetNestedField(challenge.Object, "awx.example.com", "spec", "dnsName")
+	unstructured.SetNestedField(challenge.Object, "pending", "status", "state")
+	unstructured.SetNestedField(challenge.Object, "Waiting for HTTP-01 challenge propagation: connection refused", "status", "reason")
+	// otherChallenge belongs to another certificate
+	otherChallenge := k8stest.Object("acme.cert-manager.io/v1", "Challenge", "awx", "grafana-tls-1-1-1")
+	unstructured.SetNestedField(otherChallenge.Object, "invalid", "status", "state")
+	unstructured.SetNestedField(otherChallenge.Object, "rate limited", "status", "reason")
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		// readyAfter updates the certificate to Ready during the wait
+		readyAfter time.Duration
+		wantErr    string
+	}{
+		{
+			name: "cert-manager not installed",
+		},
+		{
+			name:    "already ready",
+			objects: []runtime.Object{certificateCRD, certificate(ready)},
+		},
+		{
+			name:       "issued during the wait",
+			objects:    []runtime.Object{certificateCRD, certificate(issuing)},
+			readyAfter: 50 * time.Millisecond,
+		},
+		{
+			name:    "ACME challenge failing",
+			objects: []runtime.Object{certificateCRD, certificate(issuing), challenge, otherChallenge},
+			wantErr: "certificate awx-tls is not ready after 1m0s: Ready=False (DoesNotExist: Issuing certificate as Secret does not exist); " +
+				"challenge awx-tls-1-2793004136-1817512283 for awx.example.com is pending: Waiting for HTTP-01 challenge propagation: connection refused",
+		},
+		{
+			name:    "no reason yet",
+			objects: []runtime.Object{certificateCRD, certificate()},
+			wantErr: "cert-manager reports no reason yet",
+		},
+		{
+			name:    "never created",
+			objects: []runtime.Object{certificateCRD},
+			wantErr: "it was never created, check that the ingress names TLS secret awx-tls and carries the cert-manager.io/cluster-issuer annotation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			waiter := NewDeploymentWaiter(cluster.Client, testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_CERT_TIMEOUT": "1"}))
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			if tt.readyAfter > 0 {
+				go func() {
+					time.Sleep(tt.readyAfter)
+					if err := cluster.Dynamic.Tracker().Update(certificateGVR, certificate(ready), "awx"); err != nil {
+						t.Errorf("failed to update the certificate: %v", err)
+					}
+				}()
+			}
+
+			err := waiter.waitForCertificate(ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("waitForCertificate() error = %v, want %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), "rate limited") {
+					t.Errorf("waitForCertificate() error = %v, names a challenge of another certificate", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("waitForCertificate() failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+var (
+	deploymentsGVR  = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	statefulSetsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
+	servicesGVR     = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	ingressesGVR    = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+)
+
+// instanceRole is a part of the AWX instance the operator creates objects
+// for. Its objects are found by the owner reference or labels the operator
+// sets, since their names depend on the operator version and on spec fields
+// such as custom service names.
+type instanceRole struct {
+	description string
+	// matches reports whether the labels of an object of the instance
+	// mark it as one of the role
+	matches func(labels map[string]string) bool
+	// defaultName is the name the operator gives the object by default,
+	// preferred when several objects match and used for objects without
+	// the operator's labels
+	defaultName func(cfg *config.Config) string
+}
+
+// labeledAs matches objects whose app.kubernetes.io/component is one of
+// components or whose app.kubernetes.io/name has part as its first or last
+// dash-separated segment, e.g. awx-web or postgres-15
+func labeledAs(part string, components ...string) func(map[string]string) bool {
+	return func(labels map[string]string) bool {
+		if containsString(components, labels["app.kubernetes.io/component"]) {
+			return true
+		}
+		name := labels["app.kubernetes.io/name"]
+		return name == part || strings.HasSuffix(name, "-"+part) || strings.HasPrefix(name, part+"-")
+	}
+}
+
+var (
+	roleWeb = instanceRole{
+		description: "AWX web",
+		matches:     labeledAs("web", "web"),
+		defaultName: func(cfg *config.Config) string { return cfg.AWXName + "-web" },
+	}
+	roleTask = instanceRole{
+		description: "AWX task",
+		matches:     labeledAs("task", "task"),
+		defaultName: func(cfg *config.Config) string { return cfg.AWXName + "-task" },
+	}
+	rolePostgres = instanceRole{
+		description: "PostgreSQL",
+		matches:     labeledAs("postgres", "database"),
+		defaultName: func(cfg *config.Config) string { return cfg.PostgresDeploymentName() },
+	}
+	roleRedis = instanceRole{
+		description: "Redis",
+		matches:     labeledAs("redis", "redis"),
+		defaultName: func(cfg *config.Config) string { return cfg.AWXName + "-redis" },
+	}
+	// roleService is the service in front of the web pods, any service of
+	// the instance that is not the Postgres or Redis one
+	roleService = instanceRole{
+		description: "AWX",
+		matches: func(labels map[string]string) bool {
+			return !rolePostgres.matches(labels) && !roleRedis.matches(labels)
+		},
+		defaultName: func(cfg *config.Config) string { return cfg.AWXName + "-service" },
+	}
+	// roleIngress is the ingress of the instance, the operator creates one
+	roleIngress = instanceRole{
+		description: "AWX",
+		matches:     func(map[string]string) bool { return true },
+		defaultName: func(cfg *config.Config) string { return cfg.AWXName + "-ingress" },
+	}
+)
+
+// findInstanceObject returns the object of a resource in the AWX namespace
+// that the operator created for the instance in the given role, or nil if
+// there is none yet. Among several matches the one with the default name is
+// taken, then the first by name. An object with the default name but without
+// the operator's labels is still found, unless it is owned by another AWX
+// instance sharing the namespace, which is an error.
+func findInstanceObject(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config, gvr schema.GroupVersionResource, role instanceRole) (*unstructured.Unstructured, error) {
+	items, err := k8sClient.ListResources(ctx, gvr.Group, gvr.Version, gvr.Resource, cfg.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultName := role.defaultName(cfg)
+	var matches []*unstructured.Unstructured
+	var named *unstructured.Unstructured
+	for i := range items {
+		item := &items[i]
+		if item.GetName() == defaultName {
+			named = item
+		}
+		meta := metav1.ObjectMeta{OwnerReferences: item.GetOwnerReferences(), Labels: item.GetLabels()}
+		if ownedByInstance(meta, cfg.AWXName) && role.matches(item.GetLabels()) {
+			matches = append(matches, item)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].GetName() < matches[j].GetName() })
+	for _, match := range matches {
+		if match.GetName() == defaultName {
+			return match, nil
+		}
+	}
+	if len(matches) > 0 {
+		return matches[0], nil
+	}
+	if named != nil {
+		if owner := instanceOwner(named.GetOwnerReferences()); owner != "" && owner != cfg.AWXName {
+			return nil, fmt.Errorf("%s is owned by AWX instance %s, not %s", describeObject(named), owner, cfg.AWXName)
+		}
+	}
+	return named, nil
+}
+
+// workloadPods returns the pods of a deployment or stateful set: those its
+// selector matches whose owner references lead back to it, directly or
+// through one of its replica sets. Pods of another instance that happen to
+// match the selector are left out.
+func workloadPods(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config, workload *unstructured.Unstructured) ([]corev1.Pod, error) {
+	selector, err := podSelector(workload)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := k8sClient.ListPods(ctx, selector, cfg.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := map[types.UID]bool{workload.GetUID(): true}
+	if workload.GetKind() != "StatefulSet" {
+		replicaSets, err := k8sClient.ListResources(ctx, "apps", "v1", "replicasets", cfg.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for i := range replicaSets {
+			if ownedBy(replicaSets[i].GetOwnerReferences(), owners) {
+				owners[replicaSets[i].GetUID()] = true
+			}
+		}
+	}
+
+	var owned []corev1.Pod
+	for _, pod := range pods {
+		if ownedBy(pod.OwnerReferences, owners) {
+			owned = append(owned, pod)
+		}
+	}
+	return owned, nil
+}
+
+// workloadPodStatus returns the aggregate status of the pods of a deployment
+// or stateful set, see workloadPods
+func workloadPodStatus(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config, workload *unstructured.Unstructured) (k8s.PodStatus, error) {
+	pods, err := workloadPods(ctx, k8sClient, cfg, workload)
+	if err != nil {
+		return k8s.PodStatus{}, err
+	}
+	return k8s.SummarizePods(pods), nil
+}
+
+// ownedBy reports whether one of the owner references points at one of the
+// owners, by UID
+func ownedBy(references []metav1.OwnerReference, owners map[types.UID]bool) bool {
+	for _, owner := range references {
+		if owners[owner.UID] {
+			return true
+		}
+	}
+	return false
+}
+
+// podSelector returns the label selector of the pods of a deployment or
+// stateful set
+func podSelector(workload *unstructured.Unstructured) (string, error) {
+	spec, found, _ := unstructured.NestedMap(workload.Object, "spec", "selector")
+	if !found {
+		return "", fmt.Errorf("%s %s has no pod selector", workload.GetKind(), workload.GetName())
+	}
+
+	var selector metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &selector); err != nil {
+		return "", fmt.Errorf("invalid pod selector of %s %s: %v", workload.GetKind(), workload.GetName(), err)
+	}
+	parsed, err := metav1.LabelSelectorAsSelector(&selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid pod selector of %s %s: %v", workload.GetKind(), workload.GetName(), err)
+	}
+	if parsed.Empty() {
+		return "", fmt.Errorf("%s %s has an empty pod selector", workload.GetKind(), workload.GetName())
+	}
+	return parsed.String(), nil
+}
@@ -0,0 +1,213 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// awxOwner is an owner reference to the AWX instance of the given name
+func awxOwner(awxName string) metav1.OwnerReference {
+	return metav1.OwnerReference{APIVersion: k8s.AWXGroup + "/v1beta1", Kind: k8s.AWXKind, Name: awxName, UID: types.UID(awxName + "-uid")}
+}
+
+// namedDeployment returns a deployment in the awx namespace with the given
+// name, labels and owners
+func namedDeployment(name string, labels map[string]string, owners ...metav1.OwnerReference) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       "awx",
+		UID:             types.UID(name + "-uid"),
+		Labels:          labels,
+		OwnerReferences: owners,
+	}}
+}
+
+func TestFindInstanceObject(t *testing.T) {
+	// nameLabels are the labels older operators set, naming the component
+	// in app.kubernetes.io/name
+	nameLabels := func(awxName, name string) map[string]string {
+		return map[string]string{"app.kubernetes.io/managed-by": "awx-operator", "app.kubernetes.io/part-of": awxName, "app.kubernetes.io/name": name}
+	}
+	webComponent := map[string]string{"app.kubernetes.io/component": "web"}
+
+	tests := []struct {
+		name    string
+		gvr     schema.GroupVersionResource
+		role    instanceRole
+		objects []runtime.Object
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "default name",
+			gvr:     deploymentsGVR,
+			role:    roleWeb,
+			objects: []runtime.Object{namedDeployment("awx-instance-task", instanceLabels("awx-instance", "task")), namedDeployment("awx-instance-web", instanceLabels("awx-instance", "web"))},
+			want:    "awx-instance-web",
+		},
+		{
+			name:    "custom name found by component label",
+			gvr:     deploymentsGVR,
+			role:    roleWeb,
+			objects: []runtime.Object{namedDeployment("frontend", instanceLabels("awx-instance", "web")), namedDeployment("workers", instanceLabels("awx-instance", "task"))},
+			want:    "frontend",
+		},
+		{
+			name:    "custom name found by name label",
+			gvr:     deploymentsGVR,
+			role:    roleTask,
+			objects: []runtime.Object{namedDeployment("frontend", nameLabels("awx-instance", "awx-web")), namedDeployment("workers", nameLabels("awx-instance", "awx-task"))},
+			want:    "workers",
+		},
+		{
+			name:    "custom name found by owner reference",
+			gvr:     deploymentsGVR,
+			role:    roleWeb,
+			objects: []runtime.Object{namedDeployment("frontend", webComponent, awxOwner("awx-instance"))},
+			want:    "frontend",
+		},
+		{
+			name: "default name preferred among matches",
+			gvr:  deploymentsGVR,
+			role: roleWeb,
+			objects: []runtime.Object{
+				namedDeployment("awx-instance-canary", instanceLabels("awx-instance", "web")),
+				namedDeployment("awx-instance-web", instanceLabels("awx-instance", "web")),
+			},
+			want: "awx-instance-web",
+		},
+		{
+			name: "first by name among matches",
+			gvr:  deploymentsGVR,
+			role: roleWeb,
+			objects: []runtime.Object{
+				namedDeployment("frontend-b", instanceLabels("awx-instance", "web")),
+				namedDeployment("frontend-a", instanceLabels("awx-instance", "web")),
+			},
+			want: "frontend-a",
+		},
+		{
+			name: "PostgreSQL stateful set with a custom name",
+			gvr:  statefulSetsGVR,
+			role: rolePostgres,
+			objects: []runtime.Object{&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+				Name: "awx-db", Namespace: "awx", Labels: instanceLabels("awx-instance", "database"),
+			}}},
+			want: "awx-db",
+		},
+		{
+			name: "service that is not the database's",
+			gvr:  servicesGVR,
+			role: roleService,
+			objects: []runtime.Object{
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "awx-db", Namespace: "awx", Labels: instanceLabels("awx-instance", "database")}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "awx-http", Namespace: "awx", Labels: instanceLabels("awx-instance", "web")}},
+			},
+			want: "awx-http",
+		},
+		{
+			name:    "default name without the operator's labels",
+			gvr:     deploymentsGVR,
+			role:    roleWeb,
+			objects: []runtime.Object{namedDeployment("awx-instance-web", nil)},
+			want:    "awx-instance-web",
+		},
+		{
+			name:    "object of another instance ignored",
+			gvr:     deploymentsGVR,
+			role:    roleWeb,
+			objects: []runtime.Object{namedDeployment("frontend", instanceLabels("awx-other", "web"))},
+		},
+		{
+			name:    "default name owned by another instance",
+			gvr:     deploymentsGVR,
+			role:    roleWeb,
+			objects: []runtime.Object{namedDeployment("awx-instance-web", webComponent, awxOwner("awx-other"))},
+			wantErr: "Deployment awx/awx-instance-web is owned by AWX instance awx-other, not awx-instance",
+		},
+		{
+			name: "not created yet",
+			gvr:  deploymentsGVR,
+			role: roleWeb,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": "awx-instance"})
+
+			got, err := findInstanceObject(context.Background(), cluster.Client, cfg, tt.gvr, tt.role)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("findInstanceObject() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findInstanceObject() failed: %v", err)
+			}
+			name := ""
+			if got != nil {
+				name = got.GetName()
+			}
+			if name != tt.want {
+				t.Errorf("findInstanceObject() = %q, want %q", name, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkloadPods(t *testing.T) {
+	web := instanceDeployment("awx", "awx-instance", "web")
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:            "frontend-5d8f7c",
+		Namespace:       "awx",
+		UID:             "frontend-5d8f7c-uid",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: web.Name, UID: web.UID}},
+	}}
+	// podOf returns a pod with the labels of the web deployment owned by
+	// the given owner
+	podOf := func(name string, owner metav1.OwnerReference) *corev1.Pod {
+		pod := readyPod("awx", name, web.Labels)
+		pod.OwnerReferences = []metav1.OwnerReference{owner}
+		return pod
+	}
+
+	cluster := k8stest.NewCluster(
+		web,
+		replicaSet,
+		podOf("frontend-5d8f7c-abcde", metav1.OwnerReference{Kind: "ReplicaSet", Name: replicaSet.Name, UID: replicaSet.UID}),
+		podOf("awx-instance-web-direct", metav1.OwnerReference{Kind: "Deployment", Name: web.Name, UID: web.UID}),
+		// matches the selector but belongs to another replica set
+		podOf("stray-1", metav1.OwnerReference{Kind: "ReplicaSet", Name: "stray", UID: "stray-uid"}),
+	)
+	cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": "awx-instance"})
+
+	workload, err := findInstanceObject(context.Background(), cluster.Client, cfg, deploymentsGVR, roleWeb)
+	if err != nil || workload == nil {
+		t.Fatalf("findInstanceObject() = %v, %v", workload, err)
+	}
+	pods, err := workloadPods(context.Background(), cluster.Client, cfg, workload)
+	if err != nil {
+		t.Fatalf("workloadPods() failed: %v", err)
+	}
+	var names []string
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	if strings.Join(names, ",") != "awx-instance-web-direct,frontend-5d8f7c-abcde" {
+		t.Errorf("workloadPods() = %v, want the pods of the deployment and its replica set", names)
+	}
+}
@@ -0,0 +1,112 @@
+package deploy
+
+import (
+	"log"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+)
+
+// awxCondition is a status condition of the AWX CR
+type awxCondition struct {
+	Type    string
+	Status  string
+	Reason  string
+	Message string
+}
+
+// awxConditions returns the status conditions of the AWX CR
+func awxConditions(awx *unstructured.Unstructured) []awxCondition {
+	list, _, _ := unstructured.NestedSlice(awx.Object, "status", "conditions")
+
+	var conditions []awxCondition
+	for _, c := range list {
+		fields, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		condition := awxCondition{}
+		condition.Type, _ = fields["type"].(string)
+		condition.Status, _ = fields["status"].(string)
+		condition.Reason, _ = fields["reason"].(string)
+		condition.Message, _ = fields["message"].(string)
+		conditions = append(conditions, condition)
+	}
+	return conditions
+}
+
+// conditionRules classifies AWX CR conditions by the configured success,
+// failure and warning rules. A condition matching a warning rule is only
+// logged, even if it matches a failure rule too.
+type conditionRules struct {
+	success []config.ConditionRule
+	failure []config.ConditionRule
+	warning []config.ConditionRule
+
+	// warned records the warnings already logged
+	mu     sync.Mutex
+	warned map[awxCondition]bool
+}
+
+// newConditionRules returns the condition rules of the configuration
+func newConditionRules(cfg *config.Config) *conditionRules {
+	return &conditionRules{
+		success: config.ConditionRules(cfg.SuccessConditions),
+		failure: config.ConditionRules(cfg.FailureConditions),
+		warning: config.ConditionRules(cfg.WarningConditions),
+		warned:  make(map[awxCondition]bool),
+	}
+}
+
+// succeeded reports whether any condition matches a success rule
+func (r *conditionRules) succeeded(awx *unstructured.Unstructured) bool {
+	for _, condition := range awxConditions(awx) {
+		if matchesAny(r.success, condition) {
+			return true
+		}
+	}
+	return false
+}
+
+// failed returns the first condition matching a failure rule but no warning
+// rule. Conditions matching a warning rule are logged once.
+func (r *conditionRules) failed(awx *unstructured.Unstructured) (awxCondition, bool) {
+	for _, condition := range awxConditions(awx) {
+		if r.isWarning(condition) {
+			r.warn(awx.GetName(), condition)
+			continue
+		}
+		if matchesAny(r.failure, condition) {
+			return condition, true
+		}
+	}
+	return awxCondition{}, false
+}
+
+// isWarning reports whether a condition matches a warning rule
+func (r *conditionRules) isWarning(condition awxCondition) bool {
+	return matchesAny(r.warning, condition)
+}
+
+// warn logs a warning condition unless it was logged before
+func (r *conditionRules) warn(name string, condition awxCondition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.warned[condition] {
+		return
+	}
+	r.warned[condition] = true
+	log.Printf("Warning: AWX instance %s has condition %s=%s (reason: %s): %s", name, condition.Type, condition.Status, condition.Reason, condition.Message)
+}
+
+// matchesAny reports whether any of the rules matches the condition
+func matchesAny(rules []config.ConditionRule, condition awxCondition) bool {
+	for _, rule := range rules {
+		if rule.Matches(condition.Type, condition.Status, condition.Reason) {
+			return true
+		}
+	}
+	return false
+}
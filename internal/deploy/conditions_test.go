@@ -0,0 +1,103 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// condition returns an AWX CR status condition
+func condition(conditionType, status, reason string) map[string]interface{} {
+	return map[string]interface{}{"type": conditionType, "status": status, "reason": reason}
+}
+
+func TestWaitForAWXInstanceConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		conditions []map[string]interface{}
+		// wantErr is empty when the instance counts as processed
+		wantErr string
+	}{
+		{
+			name:       "default success",
+			conditions: []map[string]interface{}{condition("Running", "True", "Running")},
+		},
+		{
+			name:       "default not running yet",
+			conditions: []map[string]interface{}{condition("Running", "False", "Pending")},
+			wantErr:    "timeout waiting for AWX instance",
+		},
+		{
+			name:       "custom success condition",
+			env:        map[string]string{"AWX_SUCCESS_CONDITIONS": "Successful=True"},
+			conditions: []map[string]interface{}{condition("Successful", "True", "")},
+		},
+		{
+			name:       "custom success condition replaces the default",
+			env:        map[string]string{"AWX_SUCCESS_CONDITIONS": "Successful=True"},
+			conditions: []map[string]interface{}{condition("Running", "True", "Running")},
+			wantErr:    "timeout waiting for AWX instance",
+		},
+		{
+			name:       "success condition with reason",
+			env:        map[string]string{"AWX_SUCCESS_CONDITIONS": "Running=True:Successful"},
+			conditions: []map[string]interface{}{condition("Running", "True", "Reconciling")},
+			wantErr:    "timeout waiting for AWX instance",
+		},
+		{
+			name:       "one of several success conditions",
+			env:        map[string]string{"AWX_SUCCESS_CONDITIONS": "Running=True:Successful,Successful=True"},
+			conditions: []map[string]interface{}{condition("Successful", "true", "")},
+		},
+		{
+			name:       "default failure",
+			conditions: []map[string]interface{}{condition("Failure", "True", "Failed")},
+			wantErr:    "operator reported reconcile failure for awx-instance: condition Failure=True (reason: Failed)",
+		},
+		{
+			name:       "failure tolerated as warning",
+			env:        map[string]string{"AWX_WARNING_CONDITIONS": "Failure=True:Transient"},
+			conditions: []map[string]interface{}{condition("Failure", "True", "Transient"), condition("Running", "True", "Running")},
+		},
+		{
+			name:       "failure with another reason than the warning",
+			env:        map[string]string{"AWX_WARNING_CONDITIONS": "Failure=True:Transient"},
+			conditions: []map[string]interface{}{condition("Failure", "True", "Failed"), condition("Running", "True", "Running")},
+			wantErr:    "operator reported reconcile failure",
+		},
+		{
+			name:       "custom failure condition",
+			env:        map[string]string{"AWX_FAILURE_CONDITIONS": "Degraded=True"},
+			conditions: []map[string]interface{}{condition("Degraded", "True", "ImagePull")},
+			wantErr:    "condition Degraded=True (reason: ImagePull)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_RECONCILE_GRACE_PERIOD": "0"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cluster := k8stest.NewCluster(awxWithConditions("awx", "awx-instance", tt.conditions...))
+			waiter := NewDeploymentWaiter(cluster.Client, testConfig(t, env))
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			err := waiter.waitForAWXInstance(ctx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("waitForAWXInstance() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("waitForAWXInstance() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
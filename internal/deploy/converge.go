@@ -0,0 +1,332 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+const (
+	// DriftCreated marks a desired object that did not exist
+	DriftCreated = "created"
+	// DriftUpdated marks a desired object that differed from its manifest
+	DriftUpdated = "updated"
+	// DriftPruned marks an object the deployer applied earlier that is no
+	// longer desired
+	DriftPruned = "pruned"
+)
+
+// pruneKinds are looked up for objects to prune besides the kinds of the
+// desired objects, so that an object is pruned even when no manifest of its
+// kind is left. Namespaces and CRDs are never pruned, deleting them deletes
+// everything in or of them.
+var pruneKinds = []schema.GroupVersionKind{
+	{Version: "v1", Kind: "ConfigMap"},
+	{Version: "v1", Kind: "Secret"},
+	{Version: "v1", Kind: "Service"},
+	{Version: "v1", Kind: "ServiceAccount"},
+	{Version: "v1", Kind: "PersistentVolumeClaim"},
+	{Version: "v1", Kind: "PersistentVolume"},
+	{Group: "storage.k8s.io", Version: "v1", Kind: "StorageClass"},
+	{Group: "apps", Version: "v1", Kind: "Deployment"},
+	{Group: "batch", Version: "v1", Kind: "Job"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"},
+}
+
+// neverPruned are the kinds prune leaves alone even when they carry
+// ManagedByLabel
+var neverPruned = map[string]bool{
+	"Namespace":                true,
+	"CustomResourceDefinition": true,
+}
+
+// Drift is an object a reconcile changed
+type Drift struct {
+	Change string // DriftCreated, DriftUpdated or DriftPruned
+	Object string
+}
+
+// ReconcileResult is what a reconcile changed
+type ReconcileResult struct {
+	Drift []Drift
+	// Unchanged counts the desired objects that were already as desired
+	Unchanged int
+}
+
+// Converged reports whether the cluster was already as desired
+func (r *ReconcileResult) Converged() bool {
+	return len(r.Drift) == 0
+}
+
+// String summarizes the result, e.g. "1 created, 2 updated, 0 pruned, 14
+// unchanged"
+func (r *ReconcileResult) String() string {
+	counts := map[string]int{}
+	for _, drift := range r.Drift {
+		counts[drift.Change]++
+	}
+	return fmt.Sprintf("%d created, %d updated, %d pruned, %d unchanged", counts[DriftCreated], counts[DriftUpdated], counts[DriftPruned], r.Unchanged)
+}
+
+// Reconciler converges the cluster on the generated manifests in one pass:
+// it applies them and prunes the objects carrying ManagedByLabel that are
+// no longer among them. Running it again without changes does nothing, so
+// it can run on a schedule.
+type Reconciler struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	applier   *ManifestApplier
+}
+
+// NewReconciler creates a new reconciler for the static manifests
+func NewReconciler(k8sClient *k8s.KubernetesClient, config *config.Config) *Reconciler {
+	return &Reconciler{
+		k8sClient: k8sClient,
+		config:    config,
+		applier:   NewManifestApplier(k8sClient, config),
+	}
+}
+
+// Reconcile applies the desired objects, prunes the ones no longer desired
+// and logs what drift it corrected
+func (r *Reconciler) Reconcile(ctx context.Context) (*ReconcileResult, error) {
+	log.Printf("Reconciling AWX instance %s in namespace %s...", r.config.AWXName, r.config.Namespace)
+
+	manifests, err := r.applier.generator.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := r.applier.applyAll(ctx, manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReconcileResult{}
+	for _, manifest := range applied {
+		if manifest.Change == "" {
+			result.Unchanged++
+			continue
+		}
+		result.Drift = append(result.Drift, Drift{Change: manifest.Change, Object: describeObject(manifest.Object)})
+	}
+
+	pruned, err := r.prune(ctx, manifests)
+	if err != nil {
+		return nil, err
+	}
+	result.Drift = append(result.Drift, pruned...)
+
+	if result.Converged() {
+		log.Printf("✓ AWX instance %s is converged, nothing changed (%d objects)", r.config.AWXName, result.Unchanged)
+		return result, nil
+	}
+	for _, drift := range result.Drift {
+		log.Printf("Drift corrected: %s %s", drift.Change, drift.Object)
+	}
+	log.Printf("✓ AWX instance %s reconciled: %s", r.config.AWXName, result)
+	return result, nil
+}
+
+// prune deletes the objects this instance applied that are not among the
+// desired manifests, in reverse apply order. Persistent volumes and claims
+// hold data and are only pruned with AWX_DELETE_PVCS. Cluster-scoped objects
+// still used by objects that are kept, e.g. of another instance, are kept.
+func (r *Reconciler) prune(ctx context.Context, desired []Manifest) ([]Drift, error) {
+	keep := make(map[string]bool)
+	kinds := make(map[schema.GroupKind]schema.GroupVersionKind)
+	namespaces := map[string]bool{r.config.Namespace: true}
+	for _, manifest := range desired {
+		key, err := r.objectKey(manifest.Object)
+		if err != nil {
+			return nil, err
+		}
+		keep[key] = true
+		gvk := manifest.Object.GroupVersionKind()
+		kinds[gvk.GroupKind()] = gvk
+		if namespace := manifest.Object.GetNamespace(); namespace != "" {
+			namespaces[namespace] = true
+		}
+	}
+	for _, gvk := range pruneKinds {
+		if _, ok := kinds[gvk.GroupKind()]; !ok {
+			kinds[gvk.GroupKind()] = gvk
+		}
+	}
+
+	candidates, err := r.pruneCandidates(ctx, kinds, sortedNames(namespaces), keep)
+	if err != nil {
+		return nil, err
+	}
+
+	pruning := make(map[string]bool)
+	for _, candidate := range candidates {
+		if r.keepsData(candidate.Object) {
+			continue
+		}
+		key, err := r.objectKey(candidate.Object)
+		if err != nil {
+			return nil, err
+		}
+		pruning[key] = true
+	}
+
+	var pruned []Drift
+	for i := len(candidates) - 1; i >= 0; i-- {
+		obj := candidates[i].Object
+		if r.keepsData(obj) {
+			log.Printf("Warning: Keeping %s, it is no longer desired but may hold data (set AWX_DELETE_PVCS=true to prune it)", describeObject(obj))
+			continue
+		}
+		if obj.GetNamespace() == "" {
+			user, err := r.usedBy(ctx, obj, pruning)
+			if err != nil {
+				return nil, err
+			}
+			if user != "" {
+				log.Printf("Warning: Keeping %s, it is no longer desired but still used by %s", describeObject(obj), user)
+				continue
+			}
+		}
+
+		log.Printf("Pruning %s, it is no longer desired", describeObject(obj))
+		if err := r.k8sClient.DeleteObject(ctx, obj); err != nil {
+			return nil, fmt.Errorf("failed to prune %s: %v", describeObject(obj), err)
+		}
+		if err := waitForDependents(ctx, r.k8sClient, r.config, obj); err != nil {
+			return nil, err
+		}
+		pruned = append(pruned, Drift{Change: DriftPruned, Object: describeObject(obj)})
+	}
+	return pruned, nil
+}
+
+// pruneCandidates lists the objects of the given kinds in the given
+// namespaces that carry ManagedByLabel and the InstanceLabel of this
+// instance and are not kept, in apply order. Kinds the server does not
+// serve have no objects.
+func (r *Reconciler) pruneCandidates(ctx context.Context, kinds map[schema.GroupKind]schema.GroupVersionKind, namespaces []string, keep map[string]bool) ([]Manifest, error) {
+	selector := ManagedByLabel + "=" + ManagedByValue + "," + InstanceLabel + "=" + instanceLabel(r.config)
+
+	var candidates []Manifest
+	for _, gvk := range kinds {
+		if neverPruned[gvk.Kind] {
+			continue
+		}
+		namespaced, err := r.k8sClient.IsNamespaced(gvk)
+		if err != nil {
+			if k8s.IsDependencyError(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		scopes := namespaces
+		if !namespaced {
+			scopes = []string{""}
+		}
+		for _, namespace := range scopes {
+			items, err := r.k8sClient.ListObjects(ctx, gvk, namespace, selector)
+			if err != nil {
+				if k8s.IsDependencyError(err) {
+					break
+				}
+				return nil, err
+			}
+			for i := range items {
+				obj := &items[i]
+				key, err := r.objectKey(obj)
+				if err != nil {
+					return nil, err
+				}
+				if keep[key] {
+					continue
+				}
+				candidates = append(candidates, Manifest{Source: obj.GetAnnotations()[SourceAnnotation], Object: obj})
+			}
+		}
+	}
+
+	sortByKind(candidates, r.config)
+	return candidates, nil
+}
+
+// keepsData reports whether prune keeps an object because it may hold data
+func (r *Reconciler) keepsData(obj *unstructured.Unstructured) bool {
+	return (obj.GetKind() == "PersistentVolumeClaim" || obj.GetKind() == "PersistentVolume") && !r.config.DeleteVolumeClaims
+}
+
+// usedBy describes an object outside the pruned ones that still uses a
+// cluster-scoped object, such as a claim of another instance bound to a
+// persistent volume or provisioned from a storage class, or returns "" when
+// nothing does
+func (r *Reconciler) usedBy(ctx context.Context, obj *unstructured.Unstructured, pruning map[string]bool) (string, error) {
+	var users []unstructured.Unstructured
+	switch obj.GroupVersionKind().GroupKind() {
+	case schema.GroupKind{Kind: "PersistentVolume"}:
+		namespace, _, _ := unstructured.NestedString(obj.Object, "spec", "claimRef", "namespace")
+		name, _, _ := unstructured.NestedString(obj.Object, "spec", "claimRef", "name")
+		if name == "" {
+			return "", nil
+		}
+		claim := &unstructured.Unstructured{}
+		claim.SetAPIVersion("v1")
+		claim.SetKind("PersistentVolumeClaim")
+		claim.SetNamespace(namespace)
+		claim.SetName(name)
+		live, err := r.k8sClient.GetObject(ctx, claim)
+		if err != nil {
+			return "", err
+		}
+		if live != nil {
+			users = append(users, *live)
+		}
+	case schema.GroupKind{Group: "storage.k8s.io", Kind: "StorageClass"}:
+		for _, kind := range []string{"PersistentVolumeClaim", "PersistentVolume"} {
+			items, err := r.k8sClient.ListObjects(ctx, schema.GroupVersionKind{Version: "v1", Kind: kind}, "", "")
+			if err != nil {
+				return "", err
+			}
+			for _, item := range items {
+				if class, _, _ := unstructured.NestedString(item.Object, "spec", "storageClassName"); class == obj.GetName() {
+					users = append(users, item)
+				}
+			}
+		}
+	}
+
+	for i := range users {
+		key, err := r.objectKey(&users[i])
+		if err != nil {
+			return "", err
+		}
+		if !pruning[key] {
+			return describeObject(&users[i]), nil
+		}
+	}
+	return "", nil
+}
+
+// objectKey identifies an object by its resource, namespace and name,
+// whatever the version it is served at
+func (r *Reconciler) objectKey(obj *unstructured.Unstructured) (string, error) {
+	gvr, namespace, err := r.k8sClient.ObjectResource(obj)
+	if err != nil {
+		if k8s.IsDependencyError(err) {
+			// not served yet, so nothing of it can exist to be pruned
+			return strings.Join([]string{obj.GroupVersionKind().GroupKind().String(), obj.GetNamespace(), obj.GetName()}, "/"), nil
+		}
+		return "", err
+	}
+	return strings.Join([]string{gvr.GroupResource().String(), namespace, obj.GetName()}, "/"), nil
+}
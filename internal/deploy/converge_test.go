@@ -0,0 +1,237 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// reconcileManifests are the manifest files the reconcile tests start from
+var reconcileManifests = map[string]string{
+	"01-namespace.yaml": `apiVersion: v1
+kind: Namespace
+metadata:
+  name: awx
+`,
+	"02-settings.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: awx-settings
+  namespace: awx
+data:
+  log_level: INFO
+`,
+	"03-service-account.yaml": `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: awx-deployer
+  namespace: awx
+`,
+	"04-claim.yaml": `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: awx-backups
+  namespace: awx
+spec:
+  accessModes: [ReadWriteOnce]
+`,
+}
+
+// writeManifests writes manifest files to a new directory
+func writeManifests(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReconcileTwice(t *testing.T) {
+	cluster := k8stest.NewCluster()
+	cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx"})
+	reconciler := NewReconciler(cluster.Client, cfg)
+	reconciler.applier.generator = NewManifestGenerator(cfg, writeManifests(t, reconcileManifests))
+
+	first, err := reconciler.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("first Reconcile() failed: %v", err)
+	}
+	if first.Converged() || first.String() != "4 created, 0 updated, 0 pruned, 0 unchanged" {
+		t.Errorf("first Reconcile() = %s, want every object created", first)
+	}
+
+	second, err := reconciler.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("second Reconcile() failed: %v", err)
+	}
+	if !second.Converged() {
+		t.Errorf("second Reconcile() changed %v, want a no-op", second.Drift)
+	}
+	if second.String() != "0 created, 0 updated, 0 pruned, 4 unchanged" {
+		t.Errorf("second Reconcile() = %s, want every object unchanged", second)
+	}
+}
+
+func TestReconcilePrunes(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// remove are the manifest files removed after the first reconcile
+		remove    []string
+		wantDrift []Drift
+	}{
+		{
+			name:      "removed manifest pruned",
+			remove:    []string{"03-service-account.yaml"},
+			wantDrift: []Drift{{Change: DriftPruned, Object: "ServiceAccount awx/awx-deployer"}},
+		},
+		{
+			name:   "volume claim kept",
+			remove: []string{"04-claim.yaml"},
+		},
+		{
+			name:      "volume claim pruned with AWX_DELETE_PVCS",
+			env:       map[string]string{"AWX_DELETE_PVCS": "true"},
+			remove:    []string{"04-claim.yaml"},
+			wantDrift: []Drift{{Change: DriftPruned, Object: "PersistentVolumeClaim awx/awx-backups"}},
+		},
+		{
+			name:   "namespace never pruned",
+			remove: []string{"01-namespace.yaml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// unmanaged was not applied by the deployer
+			unmanaged := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "backup-agent", Namespace: "awx"}}
+			cluster := k8stest.NewCluster(unmanaged)
+			env := map[string]string{"AWX_NAMESPACE": "awx"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cfg := testConfig(t, env)
+			reconciler := NewReconciler(cluster.Client, cfg)
+			dir := writeManifests(t, reconcileManifests)
+			reconciler.applier.generator = NewManifestGenerator(cfg, dir)
+
+			if _, err := reconciler.Reconcile(context.Background()); err != nil {
+				t.Fatalf("first Reconcile() failed: %v", err)
+			}
+			for _, name := range tt.remove {
+				if err := os.Remove(filepath.Join(dir, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := reconciler.Reconcile(context.Background())
+			if err != nil {
+				t.Fatalf("Reconcile() failed: %v", err)
+			}
+			if !reflect.DeepEqual(result.Drift, tt.wantDrift) {
+				t.Errorf("Reconcile() drift = %v, want %v", result.Drift, tt.wantDrift)
+			}
+			if _, err := cluster.Clientset.CoreV1().ServiceAccounts("awx").Get(context.Background(), "backup-agent", metav1.GetOptions{}); err != nil {
+				t.Errorf("unmanaged service account pruned: %v", err)
+			}
+		})
+	}
+}
+
+func TestReconcilePrunesOwnInstance(t *testing.T) {
+	cluster := k8stest.NewCluster()
+	ctx := context.Background()
+	reconcile := func(t *testing.T, name, dir string) *ReconcileResult {
+		t.Helper()
+		cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": name})
+		reconciler := NewReconciler(cluster.Client, cfg)
+		reconciler.applier.generator = NewManifestGenerator(cfg, dir)
+		result, err := reconciler.Reconcile(ctx)
+		if err != nil {
+			t.Fatalf("Reconcile() of %s failed: %v", name, err)
+		}
+		return result
+	}
+
+	// both instances apply a ConfigMap, and only the claim of awx-b uses
+	// the storage class awx-a applied last
+	dirB := writeManifests(t, map[string]string{
+		"01-settings.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: awx-b-settings
+  namespace: awx
+`,
+		"02-claim.yaml": `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: awx-b-data
+  namespace: awx
+spec:
+  accessModes: [ReadWriteOnce]
+  storageClassName: awx-fast
+`,
+		"03-storage-class.yaml": `apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: awx-fast
+provisioner: kubernetes.io/no-provisioner
+`,
+	})
+	dirA := writeManifests(t, map[string]string{
+		"01-settings.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: awx-a-settings
+  namespace: awx
+`,
+		"02-storage-class.yaml": `apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: awx-fast
+provisioner: kubernetes.io/no-provisioner
+`,
+		"03-service-account.yaml": `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: awx-a
+  namespace: awx
+`,
+	})
+	reconcile(t, "awx-b", dirB)
+	reconcile(t, "awx-a", dirA)
+
+	for _, name := range []string{"01-settings.yaml", "02-storage-class.yaml"} {
+		if err := os.Remove(filepath.Join(dirA, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result := reconcile(t, "awx-a", dirA)
+	wantDrift := []Drift{{Change: DriftPruned, Object: "ConfigMap awx/awx-a-settings"}}
+	if !reflect.DeepEqual(result.Drift, wantDrift) {
+		t.Errorf("Reconcile() drift = %v, want %v", result.Drift, wantDrift)
+	}
+	for _, obj := range []*unstructured.Unstructured{
+		k8stest.Object("v1", "ConfigMap", "awx", "awx-b-settings"),
+		k8stest.Object("storage.k8s.io/v1", "StorageClass", "", "awx-fast"),
+	} {
+		if live, err := cluster.Client.GetObject(ctx, obj); err != nil || live == nil {
+			t.Errorf("%s of the other instance pruned: %v", describeObject(obj), err)
+		}
+	}
+
+	if result := reconcile(t, "awx-b", dirB); !result.Converged() {
+		t.Errorf("Reconcile() of the other instance changed %v, want a no-op", result.Drift)
+	}
+}
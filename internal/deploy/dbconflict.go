@@ -0,0 +1,177 @@
+package deploy
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// DatabaseConflictChecker flags other AWX instances configured with the
+// same external Postgres database as this one. Two instances migrating and
+// writing the same database corrupt each other.
+type DatabaseConflictChecker struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	generator *ManifestGenerator
+}
+
+// NewDatabaseConflictChecker creates a new shared database checker
+func NewDatabaseConflictChecker(k8sClient *k8s.KubernetesClient, config *config.Config) *DatabaseConflictChecker {
+	return &DatabaseConflictChecker{
+		k8sClient: k8sClient,
+		config:    config,
+		generator: NewManifestGenerator(config, DefaultManifestsPath),
+	}
+}
+
+// Check logs a warning for each other AWX instance sharing the database, or
+// returns them as an error when warnings are treated as errors
+func (c *DatabaseConflictChecker) Check(ctx context.Context) error {
+	problems, err := c.Problems(ctx)
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if c.config.TreatWarningsAsErrors {
+		return fmt.Errorf("shared database check failed: %s", strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		log.Printf("Warning: %s", problem)
+	}
+	return nil
+}
+
+// Problems compares the external database of the instance, from the
+// postgres_configuration_secret of the AWX manifest, with those of the other
+// AWX instances in the cluster. Instances with a managed database each run
+// their own and are never in conflict.
+func (c *DatabaseConflictChecker) Problems(ctx context.Context) ([]string, error) {
+	own, err := c.ownDatabase(ctx)
+	if err != nil || own == "" {
+		return nil, err
+	}
+
+	// before the operator is installed there are no AWX instances
+	crd, err := c.k8sClient.CRDName(ctx, k8s.AWXGroup, k8s.AWXKind)
+	if err != nil || crd == "" {
+		return nil, err
+	}
+
+	gvr := c.k8sClient.AWXGroupVersionResource(ctx)
+	instances, err := c.k8sClient.ListResources(ctx, gvr.Group, gvr.Version, gvr.Resource, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list AWX instances: %v", err)
+	}
+
+	var problems []string
+	for i := range instances {
+		awx := &instances[i]
+		if awx.GetNamespace() == c.config.Namespace && awx.GetName() == c.config.AWXName {
+			continue
+		}
+		secretName, _, _ := unstructured.NestedString(awx.Object, "spec", "postgres_configuration_secret")
+		if secretName == "" {
+			continue
+		}
+		secret, err := c.k8sClient.GetObject(ctx, newObject("v1", "Secret", awx.GetNamespace(), secretName))
+		if err != nil {
+			return nil, err
+		}
+		if secret == nil {
+			continue
+		}
+		if database := externalDatabase(secretValues(secret), awx.GetNamespace()); database == own {
+			problems = append(problems, fmt.Sprintf("AWX instance %s/%s uses the same Postgres database %s (secret %s), two instances sharing a database corrupt each other", awx.GetNamespace(), awx.GetName(), own, secretName))
+		}
+	}
+	return problems, nil
+}
+
+// ownDatabase returns the external database of the instance, or empty if
+// the operator manages its database. The secret is taken from the manifests,
+// or from the cluster if the manifests do not include it.
+func (c *DatabaseConflictChecker) ownDatabase(ctx context.Context) (string, error) {
+	manifests, err := c.generator.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	secretName := ""
+	for _, manifest := range manifests {
+		if isAWX(manifest.Object) {
+			secretName, _, _ = unstructured.NestedString(manifest.Object.Object, "spec", "postgres_configuration_secret")
+		}
+	}
+	if secretName == "" {
+		return "", nil
+	}
+
+	for _, manifest := range manifests {
+		obj := manifest.Object
+		if obj.GetKind() == "Secret" && obj.GetName() == secretName {
+			return externalDatabase(secretValues(obj), c.config.Namespace), nil
+		}
+	}
+	secret, err := c.k8sClient.GetObject(ctx, newObject("v1", "Secret", c.config.Namespace, secretName))
+	if err != nil || secret == nil {
+		return "", err
+	}
+	return externalDatabase(secretValues(secret), c.config.Namespace), nil
+}
+
+// secretValues returns the decoded data of a secret, overridden by its
+// stringData as the API server does
+func secretValues(secret *unstructured.Unstructured) map[string]string {
+	values := make(map[string]string)
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "data")
+	for key, encoded := range data {
+		if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			values[key] = string(decoded)
+		}
+	}
+	stringData, _, _ := unstructured.NestedStringMap(secret.Object, "stringData")
+	for key, value := range stringData {
+		values[key] = value
+	}
+	return values
+}
+
+// externalDatabase identifies the database a postgres configuration secret
+// in namespace points at as host:port/database, or returns empty for a
+// database the operator manages. A secret without a type is unmanaged, as
+// the operator reads it. Service names are qualified with the namespace, so
+// the same short name in two namespaces is not taken for one database.
+func externalDatabase(values map[string]string, namespace string) string {
+	if postgresType := values["type"]; postgresType != "" && postgresType != "unmanaged" {
+		return ""
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(values["host"]), "."))
+	if host == "" {
+		return ""
+	}
+	host = strings.TrimSuffix(host, ".cluster.local")
+	if !strings.Contains(host, ".") {
+		host += "." + namespace + ".svc"
+	}
+
+	port := strings.TrimSpace(values["port"])
+	if port == "" {
+		port = "5432"
+	}
+	database := strings.TrimSpace(values["database"])
+	if database == "" {
+		database = "awx"
+	}
+	return fmt.Sprintf("%s:%s/%s", host, port, database)
+}
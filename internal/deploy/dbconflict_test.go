@@ -0,0 +1,218 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// postgresInstance returns an AWX instance using the postgres configuration
+// secret <name>-postgres-configuration with the given values
+func postgresInstance(namespace, name string, values map[string]string) []runtime.Object {
+	secretName := name + "-postgres-configuration"
+	awx := k8stest.AWX(namespace, name)
+	unstructured.SetNestedField(awx.Object, secretName, "spec", "postgres_configuration_secret")
+	data := make(map[string][]byte)
+	for key, value := range values {
+		data[key] = []byte(value)
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: namespace}, Data: data}
+	return []runtime.Object{awx, secret}
+}
+
+// writePostgresManifests writes the manifests of awx/awx-instance using the
+// secret awx-instance-postgres-configuration, including the secret with the
+// given values unless they are nil
+func writePostgresManifests(t *testing.T, values map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	awx := `apiVersion: awx.ansible.com/v1beta1
+kind: AWX
+metadata:
+  name: awx-instance
+  namespace: awx
+spec:
+  postgres_configuration_secret: awx-instance-postgres-configuration
+`
+	if err := os.WriteFile(filepath.Join(dir, "awx-instance.yaml"), []byte(awx), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if values == nil {
+		return dir
+	}
+
+	var secret strings.Builder
+	secret.WriteString("apiVersion: v1\nkind: Secret\nmetadata:\n  name: awx-instance-postgres-configuration\n  namespace: awx\nstringData:\n")
+	for key, value := range values {
+		fmt.Fprintf(&secret, "  %s: %q\n", key, value)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "postgres-configuration.yaml"), []byte(secret.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDatabaseConflictProblems(t *testing.T) {
+	established := map[string]interface{}{"type": "Established", "status": "True"}
+	external := map[string]string{"host": "db.example.com", "port": "5432", "database": "awx", "type": "unmanaged"}
+	with := func(values map[string]string, key, value string) map[string]string {
+		changed := make(map[string]string)
+		for k, v := range values {
+			changed[k] = v
+		}
+		changed[key] = value
+		return changed
+	}
+	sharedProblem := "AWX instance team-b/awx2 uses the same Postgres database db.example.com:5432/awx (secret awx2-postgres-configuration), two instances sharing a database corrupt each other"
+
+	tests := []struct {
+		name string
+		// own are the values of the instance's secret in the manifests, or
+		// in the cluster if ownInCluster is set
+		own          map[string]string
+		ownInCluster bool
+		objects      []runtime.Object
+		want         []string
+	}{
+		{
+			name:    "two instances sharing a database",
+			own:     external,
+			objects: postgresInstance("team-b", "awx2", external),
+			want:    []string{sharedProblem},
+		},
+		{
+			name:    "host compared case-insensitively with defaults",
+			own:     external,
+			objects: postgresInstance("team-b", "awx2", map[string]string{"host": "DB.example.com."}),
+			want:    []string{sharedProblem},
+		},
+		{
+			name:         "own secret only in the cluster",
+			own:          external,
+			ownInCluster: true,
+			objects:      postgresInstance("team-b", "awx2", external),
+			want:         []string{sharedProblem},
+		},
+		{
+			name:    "other database on the same server",
+			own:     external,
+			objects: postgresInstance("team-b", "awx2", with(external, "database", "awx2")),
+		},
+		{
+			name:    "other port",
+			own:     external,
+			objects: postgresInstance("team-b", "awx2", with(external, "port", "5433")),
+		},
+		{
+			name:    "other instance with a managed database",
+			own:     external,
+			objects: postgresInstance("team-b", "awx2", with(external, "type", "managed")),
+		},
+		{
+			name:    "own managed database",
+			own:     with(external, "type", "managed"),
+			objects: postgresInstance("team-b", "awx2", external),
+		},
+		{
+			name:    "same service name in another namespace",
+			own:     with(external, "host", "postgres"),
+			objects: postgresInstance("team-b", "awx2", with(external, "host", "postgres")),
+		},
+		{
+			name:    "service reached across namespaces",
+			own:     with(external, "host", "postgres"),
+			objects: postgresInstance("team-b", "awx2", with(external, "host", "postgres.awx.svc.cluster.local")),
+			want:    []string{"AWX instance team-b/awx2 uses the same Postgres database postgres.awx.svc:5432/awx (secret awx2-postgres-configuration), two instances sharing a database corrupt each other"},
+		},
+		{
+			name:         "own instance not compared",
+			own:          external,
+			ownInCluster: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := append([]runtime.Object{awxCRD(established)}, tt.objects...)
+			dir := writePostgresManifests(t, tt.own)
+			if tt.ownInCluster {
+				dir = writePostgresManifests(t, nil)
+				objects = append(objects, postgresInstance("awx", "awx-instance", tt.own)...)
+			}
+			cluster := k8stest.NewCluster(objects...)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx"})
+			checker := NewDatabaseConflictChecker(cluster.Client, cfg)
+			checker.generator = NewManifestGenerator(cfg, dir)
+
+			problems, err := checker.Problems(context.Background())
+			if err != nil {
+				t.Fatalf("Problems() failed: %v", err)
+			}
+			if !reflect.DeepEqual(problems, tt.want) {
+				t.Errorf("Problems() = %q, want %q", problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatabaseConflictCheck(t *testing.T) {
+	established := map[string]interface{}{"type": "Established", "status": "True"}
+	external := map[string]string{"host": "db.example.com", "type": "unmanaged"}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		objects []runtime.Object
+		wantErr string
+	}{
+		{
+			name:    "shared database warned about",
+			objects: append(postgresInstance("team-b", "awx2", external), awxCRD(established)),
+		},
+		{
+			name:    "shared database fails in strict mode",
+			env:     map[string]string{"AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			objects: append(postgresInstance("team-b", "awx2", external), awxCRD(established)),
+			wantErr: "shared database check failed: AWX instance team-b/awx2 uses the same Postgres database db.example.com:5432/awx",
+		},
+		{
+			name: "operator not installed",
+			env:  map[string]string{"AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_NAMESPACE": "awx"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cluster := k8stest.NewCluster(tt.objects...)
+			cfg := testConfig(t, env)
+			checker := NewDatabaseConflictChecker(cluster.Client, cfg)
+			checker.generator = NewManifestGenerator(cfg, writePostgresManifests(t, external))
+
+			err := checker.Check(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Check() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// manifestsDir is the manifests directory of the repository
+var manifestsDir = filepath.Join("..", "..", "manifests")
+
+// testConfig creates a Config from the given env vars, on top of an
+// environment without any AWX_ variable
+func testConfig(t *testing.T, env map[string]string) *config.Config {
+	t.Helper()
+	for _, entry := range os.Environ() {
+		if key := strings.SplitN(entry, "=", 2)[0]; strings.HasPrefix(key, "AWX_") {
+			t.Setenv(key, "")
+		}
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Fatalf("NewConfigFromEnv() failed: %v", err)
+	}
+	return cfg
+}
+
+// awxManifest returns the AWX CR of the repository's manifests
+func awxManifest(t *testing.T) *unstructured.Unstructured {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(manifestsDir, "07-awx-instance.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read AWX manifest: %v", err)
+	}
+	objs, err := k8s.DecodeManifests(data)
+	if err != nil || len(objs) != 1 {
+		t.Fatalf("failed to decode AWX manifest: %v", err)
+	}
+	return objs[0]
+}
+
+// splitPath splits a dotted field path
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// readyPod returns a running pod whose containers are ready
+func readyPod(namespace, name string, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+// instanceLabels are the labels the operator sets on the objects of a
+// component of an AWX instance
+func instanceLabels(awxName, component string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/managed-by": "awx-operator",
+		"app.kubernetes.io/part-of":    awxName,
+		"app.kubernetes.io/component":  component,
+	}
+}
+
+// instanceDeployment returns the deployment the operator creates for a
+// component of an AWX instance, named after the instance
+func instanceDeployment(namespace, awxName, component string) *appsv1.Deployment {
+	name := awxName + "-" + component
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			UID:       types.UID(name + "-uid"),
+			Labels:    instanceLabels(awxName, component),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: instanceLabels(awxName, component)},
+		},
+	}
+}
+
+// workloadPod returns a pod of a workload with the given containers, ready
+// if all of them are ready
+func workloadPod(workload metav1.Object, name string, containers ...corev1.ContainerStatus) *corev1.Pod {
+	pod := readyPod(workload.GetNamespace(), name, workload.GetLabels())
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "Deployment", Name: workload.GetName(), UID: workload.GetUID()}}
+	pod.Status.ContainerStatuses = containers
+	for _, container := range containers {
+		if !container.Ready {
+			pod.Status.Conditions[0].Status = corev1.ConditionFalse
+		}
+	}
+	return pod
+}
+
+// operatorObjects returns a ready AWX operator with complete RBAC
+func operatorObjects(namespace string) []runtime.Object {
+	labels := map[string]string{"control-plane": "controller-manager"}
+	return []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: operatorDeployment, Namespace: namespace},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					ServiceAccountName: "awx-operator",
+					Containers:         []corev1.Container{{Name: operatorContainer}},
+				}},
+			},
+		},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "awx-operator", Namespace: namespace}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "awx-operator"}},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "awx-operator"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "awx-operator", Namespace: namespace}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "awx-operator"},
+		},
+		readyPod(namespace, "awx-operator-controller-manager-0", labels),
+	}
+}
+
+// awxWithConditions returns an AWX CR with the given status conditions
+func awxWithConditions(namespace, name string, conditions ...map[string]interface{}) *unstructured.Unstructured {
+	awx := k8stest.AWX(namespace, name)
+	var list []interface{}
+	for _, condition := range conditions {
+		list = append(list, condition)
+	}
+	if len(list) > 0 {
+		unstructured.SetNestedSlice(awx.Object, list, "status", "conditions")
+	}
+	return awx
+}
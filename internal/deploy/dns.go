@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"awx-deployer/internal/config"
+)
+
+// hostResolver resolves a host name to its addresses
+type hostResolver func(ctx context.Context, host string) ([]string, error)
+
+// newHostResolver returns a resolver asking AWX_DNS_SERVER, or the system
+// resolver if it is not set, that gives up on a lookup after AWX_DNS_TIMEOUT
+// seconds
+func newHostResolver(cfg *config.Config) hostResolver {
+	lookup := lookupHost
+	if cfg.DNSServer != "" {
+		server := cfg.DNSServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+		lookup = resolver.LookupHost
+	}
+
+	timeout := time.Duration(cfg.DNSTimeout) * time.Second
+	return func(ctx context.Context, host string) ([]string, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return lookup(ctx, host)
+	}
+}
+
+// verifyDNS checks that the AWX hosts resolve to the address the ingress
+// was given when the DNS check is enabled. Records not pointed at the
+// ingress yet, common with external DNS, are logged as a warning, or
+// returned as an error when warnings are treated as errors.
+func (v *DeploymentVerifier) verifyDNS(ctx context.Context) error {
+	if !v.config.VerifyDNS {
+		return nil
+	}
+
+	exposure, err := getExposure(ctx, v.k8sClient, v.config)
+	if err != nil {
+		return fmt.Errorf("failed to determine AWX exposure: %v", err)
+	}
+	if !exposure.HasIngress() || len(exposure.Hostnames) == 0 {
+		log.Printf("AWX instance %s has no ingress host, skipping DNS check", v.config.AWXName)
+		return nil
+	}
+
+	ingress, err := findInstanceObject(ctx, v.k8sClient, v.config, ingressesGVR, roleIngress)
+	if err != nil {
+		return fmt.Errorf("failed to check ingress: %v", err)
+	}
+	address := "Pending"
+	if ingress != nil {
+		if address, err = v.k8sClient.GetIngressStatus(ctx, ingress.GetName(), v.config.Namespace); err != nil {
+			return fmt.Errorf("failed to get ingress status: %v", err)
+		}
+	}
+
+	var problem error
+	if address == "Pending" || address == "" {
+		problem = fmt.Errorf("the ingress of AWX instance %s has no address yet, cannot check that %s resolve to it", v.config.AWXName, strings.Join(exposure.Hostnames, ", "))
+	} else {
+		problem = checkHostsResolve(ctx, newHostResolver(v.config), exposure.Hostnames, address)
+	}
+	if problem == nil {
+		return nil
+	}
+	if v.config.TreatWarningsAsErrors {
+		return problem
+	}
+	log.Printf("Warning: %v", problem)
+	return nil
+}
@@ -0,0 +1,121 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// awxIngress returns the ingress of awx-instance with the given load
+// balancer IP, none if it is empty
+func awxIngress(ip string) *networkingv1.Ingress {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-instance-ingress", Namespace: "awx", Labels: instanceLabels("awx-instance", "")},
+	}
+	if ip != "" {
+		ingress.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: ip}}
+	}
+	return ingress
+}
+
+func TestVerifyDNS(t *testing.T) {
+	records := map[string][]string{"awx.example.com": {"198.51.100.7"}}
+	// blocking lookups only end with their timeout
+	blocking := false
+	lookups := 0
+	defer func(lookup func(context.Context, string) ([]string, error)) { lookupHost = lookup }(lookupHost)
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		if blocking {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		if addresses, ok := records[host]; ok {
+			return addresses, nil
+		}
+		return nil, fmt.Errorf("lookup %s: no such host", host)
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		objects  []runtime.Object
+		blocking bool
+		// wantLookup is whether the hosts were resolved
+		wantLookup bool
+		wantErr    string
+	}{
+		{
+			name:    "disabled",
+			env:     map[string]string{"AWX_VERIFY_DNS": "false", "AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			objects: []runtime.Object{exposedAWX("ingress"), awxIngress("203.0.113.5")},
+		},
+		{
+			name:       "host resolves to the ingress address",
+			env:        map[string]string{"AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			objects:    []runtime.Object{exposedAWX("ingress"), awxIngress("198.51.100.7")},
+			wantLookup: true,
+		},
+		{
+			name:       "mismatch only warns",
+			objects:    []runtime.Object{exposedAWX("ingress"), awxIngress("203.0.113.5")},
+			wantLookup: true,
+		},
+		{
+			name:       "mismatch fails in strict mode",
+			env:        map[string]string{"AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			objects:    []runtime.Object{exposedAWX("ingress"), awxIngress("203.0.113.5")},
+			wantLookup: true,
+			wantErr:    "awx.example.com resolves to 198.51.100.7, not to the ingress address 203.0.113.5",
+		},
+		{
+			name:    "ingress without an address",
+			env:     map[string]string{"AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			objects: []runtime.Object{exposedAWX("ingress"), awxIngress("")},
+			wantErr: "the ingress of AWX instance awx-instance has no address yet, cannot check that awx.example.com resolve to it",
+		},
+		{
+			name:    "no ingress",
+			env:     map[string]string{"AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			objects: []runtime.Object{exposedAWX("none")},
+		},
+		{
+			name:       "lookup timeout",
+			env:        map[string]string{"AWX_TREAT_WARNINGS_AS_ERRORS": "true", "AWX_DNS_TIMEOUT": "1"},
+			objects:    []runtime.Object{exposedAWX("ingress"), awxIngress("198.51.100.7")},
+			blocking:   true,
+			wantLookup: true,
+			wantErr:    "awx.example.com does not resolve: context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocking, lookups = tt.blocking, 0
+			env := map[string]string{"AWX_NAMESPACE": "awx", "AWX_VERIFY_DNS": "true"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			verifier := NewDeploymentVerifier(k8stest.NewCluster(tt.objects...).Client, testConfig(t, env))
+
+			err := verifier.verifyDNS(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verifyDNS() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("verifyDNS() failed: %v", err)
+			}
+			if (lookups > 0) != tt.wantLookup {
+				t.Errorf("verifyDNS() made %d lookups, want lookups %v", lookups, tt.wantLookup)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// Priority ranks how likely a finding is to be the root cause of a failure
+type Priority int
+
+const (
+	// PriorityCritical findings block the deployment outright
+	PriorityCritical Priority = iota
+	// PriorityHigh findings usually explain stuck or crashing pods
+	PriorityHigh
+	// PriorityLow findings are worth a look but rarely the root cause
+	PriorityLow
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityCritical:
+		return "CRITICAL"
+	case PriorityHigh:
+		return "HIGH"
+	default:
+		return "LOW"
+	}
+}
+
+// Finding is a likely root cause identified by the doctor
+type Finding struct {
+	Priority Priority
+	Message  string
+}
+
+// DiagnosticReport holds everything the doctor collected
+type DiagnosticReport struct {
+	// Observations are the raw collected facts, one line each, grouped by collector
+	Observations map[string][]string
+	// Findings are the likely root causes
+	Findings []Finding
+
+	// sections keeps the observation groups in collection order
+	sections []string
+}
+
+// Doctor diagnoses an existing, possibly broken, AWX installation.
+// It only reads from the cluster.
+type Doctor struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewDoctor creates a new doctor
+func NewDoctor(k8sClient *k8s.KubernetesClient, config *config.Config) *Doctor {
+	return &Doctor{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Diagnose runs all collectors and returns the report with findings sorted by priority
+func (d *Doctor) Diagnose(ctx context.Context) *DiagnosticReport {
+	report := &DiagnosticReport{Observations: make(map[string][]string)}
+
+	collectors := []func(context.Context, *DiagnosticReport){
+		d.collectAWXInstance,
+		d.collectPods,
+		d.collectEvents,
+		d.collectPVCs,
+		d.collectIngress,
+		d.collectOperator,
+	}
+
+	for _, collect := range collectors {
+		collect(ctx, report)
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Priority < report.Findings[j].Priority
+	})
+	return report
+}
+
+func (r *DiagnosticReport) observe(section, format string, args ...interface{}) {
+	if _, ok := r.Observations[section]; !ok {
+		r.sections = append(r.sections, section)
+	}
+	r.Observations[section] = append(r.Observations[section], fmt.Sprintf(format, args...))
+}
+
+func (r *DiagnosticReport) find(priority Priority, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, Finding{Priority: priority, Message: fmt.Sprintf(format, args...)})
+}
+
+// collectAWXInstance reports the AWX CR status conditions
+func (d *Doctor) collectAWXInstance(ctx context.Context, report *DiagnosticReport) {
+	const section = "AWX instance"
+
+	awx, err := d.k8sClient.GetAWX(ctx, d.config.AWXName, d.config.Namespace)
+	if err != nil {
+		report.observe(section, "could not get AWX instance: %v", err)
+		report.find(PriorityCritical, "AWX instance %s/%s is missing or unreadable: %v", d.config.Namespace, d.config.AWXName, err)
+		return
+	}
+	if source, ok := awx.GetAnnotations()[SourceAnnotation]; ok {
+		report.observe(section, "applied from %s", source)
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(awx.Object, "status", "conditions")
+	if len(conditions) == 0 {
+		report.observe(section, "no status conditions")
+		if err := NewReconcileChecker(d.k8sClient, d.config).CheckPickedUp(ctx); err != nil {
+			report.find(PriorityCritical, "AWX instance %s has no status, %v", d.config.AWXName, err)
+			return
+		}
+		report.find(PriorityCritical, "AWX instance %s has no status, the operator has not reconciled it", d.config.AWXName)
+		return
+	}
+
+	rules := newConditionRules(d.config)
+	for _, condition := range awxConditions(awx) {
+		report.observe(section, "condition %s=%s reason=%s message=%s", condition.Type, condition.Status, condition.Reason, condition.Message)
+		switch {
+		case rules.isWarning(condition):
+			report.find(PriorityLow, "AWX instance has condition %s=%s (reason: %s): %s", condition.Type, condition.Status, condition.Reason, condition.Message)
+		case matchesAny(rules.failure, condition):
+			report.find(PriorityCritical, "operator reports reconcile failure: %s", condition.Message)
+		}
+	}
+}
+
+// collectPods reports pod phases, waiting reasons and last restart reasons
+func (d *Doctor) collectPods(ctx context.Context, report *DiagnosticReport) {
+	const section = "Pods"
+
+	pods, err := d.k8sClient.ListPods(ctx, "", d.config.Namespace)
+	if err != nil {
+		report.observe(section, "could not list pods: %v", err)
+		return
+	}
+	if len(pods) == 0 {
+		report.observe(section, "no pods in namespace %s", d.config.Namespace)
+		return
+	}
+
+	// events name the Secret or ConfigMap a pod stuck creating waits for
+	events, err := d.k8sClient.ListEvents(ctx, "involvedObject.kind=Pod", d.config.Namespace)
+	if err != nil {
+		report.observe(section, "could not list pod events: %v", err)
+	}
+
+	for _, pod := range pods {
+		report.observe(section, "%s: %s", pod.Name, pod.Status.Phase)
+		if err := podStartupError(pod, events); err != nil {
+			report.find(PriorityHigh, "%v", err)
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Waiting != nil {
+				report.observe(section, "  %s waiting: %s %s", cs.Name, cs.State.Waiting.Reason, cs.State.Waiting.Message)
+				switch cs.State.Waiting.Reason {
+				case "ImagePullBackOff", "ErrImagePull", "InvalidImageName":
+					report.find(PriorityHigh, "pod %s cannot pull image for container %s: %s", pod.Name, cs.Name, cs.State.Waiting.Message)
+				case "CrashLoopBackOff":
+					report.find(PriorityHigh, "container %s in pod %s is crash looping%s", cs.Name, pod.Name, lastTermination(cs))
+				}
+			}
+			if cs.RestartCount > 0 {
+				report.observe(section, "  %s restarted %d times%s", cs.Name, cs.RestartCount, lastTermination(cs))
+				if cs.LastTerminationState.Terminated != nil && cs.LastTerminationState.Terminated.Reason == "OOMKilled" {
+					report.find(PriorityHigh, "container %s in pod %s was OOMKilled, raise its memory limit", cs.Name, pod.Name)
+				}
+			}
+		}
+	}
+}
+
+// lastTermination describes why a container last terminated, if it did
+func lastTermination(cs corev1.ContainerStatus) string {
+	if t := cs.LastTerminationState.Terminated; t != nil {
+		return fmt.Sprintf(" (last exit: %s, code %d)", t.Reason, t.ExitCode)
+	}
+	return ""
+}
+
+// collectEvents reports recent warning events
+func (d *Doctor) collectEvents(ctx context.Context, report *DiagnosticReport) {
+	const section = "Events"
+	const maxEvents = 20
+
+	events, err := d.k8sClient.ListEvents(ctx, "type=Warning", d.config.Namespace)
+	if err != nil {
+		report.observe(section, "could not list events: %v", err)
+		return
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+	if len(events) > maxEvents {
+		events = events[len(events)-maxEvents:]
+	}
+
+	for _, event := range events {
+		object := fmt.Sprintf("%s/%s", strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name)
+		report.observe(section, "%s %s: %s", object, event.Reason, event.Message)
+		switch event.Reason {
+		case "FailedScheduling":
+			report.find(PriorityHigh, "%s cannot be scheduled: %s", object, event.Message)
+		case "FailedMount", "FailedAttachVolume":
+			report.find(PriorityHigh, "%s cannot mount a volume: %s", object, event.Message)
+		case "ProvisioningFailed":
+			report.find(PriorityHigh, "%s volume provisioning failed: %s", object, event.Message)
+		}
+	}
+}
+
+// collectPVCs reports persistent volume claim binding status
+func (d *Doctor) collectPVCs(ctx context.Context, report *DiagnosticReport) {
+	const section = "Persistent volume claims"
+
+	pvcs, err := d.k8sClient.ListPersistentVolumeClaims(ctx, d.config.Namespace)
+	if err != nil {
+		report.observe(section, "could not list persistent volume claims: %v", err)
+		return
+	}
+
+	for _, pvc := range pvcs {
+		report.observe(section, "%s: %s", pvc.Name, pvc.Status.Phase)
+		if pvc.Status.Phase != corev1.ClaimBound {
+			report.find(PriorityHigh, "persistent volume claim %s is %s, check storage class %s", pvc.Name, pvc.Status.Phase, d.config.StorageClass)
+		}
+	}
+}
+
+// collectIngress reports the ingress address
+func (d *Doctor) collectIngress(ctx context.Context, report *DiagnosticReport) {
+	const section = "Ingress"
+
+	ingress, err := findInstanceObject(ctx, d.k8sClient, d.config, ingressesGVR, roleIngress)
+	if err != nil {
+		report.observe(section, "could not look up the ingress: %v", err)
+		return
+	}
+	if ingress == nil {
+		report.observe(section, "AWX instance %s has no ingress", d.config.AWXName)
+		return
+	}
+	ingressName := ingress.GetName()
+	status, err := d.k8sClient.GetIngressStatus(ctx, ingressName, d.config.Namespace)
+	if err != nil {
+		report.observe(section, "could not get ingress %s: %v", ingressName, err)
+		return
+	}
+
+	report.observe(section, "%s address: %s", ingressName, status)
+	if status == "Pending" {
+		report.find(PriorityLow, "ingress %s has no address yet, check the %s ingress controller", ingressName, d.config.IngressClassName)
+	}
+}
+
+// collectOperator reports the operator pod status and the tail of its logs
+func (d *Doctor) collectOperator(ctx context.Context, report *DiagnosticReport) {
+	const section = "Operator"
+	const tailLines = 50
+
+	status, err := d.k8sClient.GetPodStatus(ctx, d.config.OperatorPodSelector, d.config.OperatorNamespace)
+	if err != nil {
+		report.observe(section, "could not get operator pod status: %v", err)
+		return
+	}
+	report.observe(section, "pod selector %s matches %d pod(s)", d.config.OperatorPodSelector, status.Pods)
+	report.observe(section, "pod status: %s", status)
+	if status.Pods == 0 {
+		report.find(PriorityCritical, "no AWX operator pods match %s in namespace %s, check AWX_OPERATOR_NAMESPACE and AWX_OPERATOR_POD_SELECTOR", d.config.OperatorPodSelector, d.config.OperatorNamespace)
+		return
+	}
+	if !status.Ready() {
+		report.find(PriorityCritical, "AWX operator is not ready (status: %s)", status)
+		return
+	}
+
+	problems, err := NewOperatorRBACChecker(d.k8sClient, d.config).Problems(ctx)
+	if err != nil {
+		report.observe(section, "could not check operator RBAC: %v", err)
+	}
+	for _, problem := range problems {
+		report.find(PriorityCritical, "operator RBAC is incomplete: %s", problem)
+	}
+
+	logs, err := d.k8sClient.GetPodLogs(ctx, d.config.OperatorPodSelector, d.config.OperatorNamespace, operatorContainer, tailLines)
+	if err != nil {
+		report.observe(section, "could not read operator logs: %v", err)
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(logs), "\n") {
+		report.observe(section, "  %s", line)
+	}
+
+	if failures, last := findReconcileFailures(logs, d.config.Namespace, d.config.AWXName); failures > 0 {
+		report.find(PriorityCritical, "operator logs show %d failed reconcile tasks, last: %s", failures, last)
+	}
+}
+
+// Print writes the report, most likely root causes first
+func (r *DiagnosticReport) Print(w io.Writer) {
+	fmt.Fprintln(w, "=== Likely root causes ===")
+	if len(r.Findings) == 0 {
+		fmt.Fprintln(w, "No problems detected")
+	}
+	for i, finding := range r.Findings {
+		fmt.Fprintf(w, "%d. [%s] %s\n", i+1, finding.Priority, finding.Message)
+	}
+
+	for _, section := range r.sections {
+		fmt.Fprintf(w, "\n=== %s ===\n", section)
+		for _, line := range r.Observations[section] {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestDoctorDiagnose(t *testing.T) {
+	running := map[string]interface{}{"type": "Running", "status": "True", "reason": "Successful"}
+	healthy := func(objects ...runtime.Object) []runtime.Object {
+		return append(append(operatorObjects("awx"), awxWithConditions("awx", "awx-instance", running)), objects...)
+	}
+
+	imagePull := readyPod("awx", "awx-instance-web-0", nil)
+	imagePull.Status.Phase = corev1.PodPending
+	imagePull.Status.Conditions = nil
+	imagePull.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "awx-web",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "manifest unknown"}},
+	}}
+
+	oomKilled := readyPod("awx", "awx-instance-task-0", nil)
+	oomKilled.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:                 "awx-task",
+		RestartCount:         3,
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+	}}
+
+	pendingClaim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres-15-awx-instance-postgres-15-0", Namespace: "awx"},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+	}
+
+	unschedulable := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "awx-instance-web-0.1", Namespace: "awx"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "awx-instance-web-0"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "FailedScheduling",
+		Message:        "0/3 nodes are available: 3 Insufficient memory.",
+	}
+
+	failure := map[string]interface{}{"type": "Failure", "status": "True", "reason": "Failed", "message": "secret awx-postgres-configuration not found"}
+
+	tests := []struct {
+		name         string
+		objects      []runtime.Object
+		wantPriority Priority
+		wantFinding  string
+	}{
+		{
+			name:         "AWX CR missing",
+			objects:      operatorObjects("awx"),
+			wantPriority: PriorityCritical,
+			wantFinding:  "AWX instance awx/awx-instance is missing",
+		},
+		{
+			name:         "operator reconcile failure",
+			objects:      append(operatorObjects("awx"), awxWithConditions("awx", "awx-instance", failure)),
+			wantPriority: PriorityCritical,
+			wantFinding:  "operator reports reconcile failure: secret awx-postgres-configuration not found",
+		},
+		{
+			name:         "operator missing",
+			objects:      []runtime.Object{awxWithConditions("awx", "awx-instance", running)},
+			wantPriority: PriorityCritical,
+			wantFinding:  "no AWX operator pods match",
+		},
+		{
+			name:         "image pull failure",
+			objects:      healthy(imagePull),
+			wantPriority: PriorityHigh,
+			wantFinding:  "pod awx-instance-web-0 cannot pull image for container awx-web: manifest unknown",
+		},
+		{
+			name:         "OOM killed container",
+			objects:      healthy(oomKilled),
+			wantPriority: PriorityHigh,
+			wantFinding:  "container awx-task in pod awx-instance-task-0 was OOMKilled",
+		},
+		{
+			name:         "unbound claim",
+			objects:      healthy(pendingClaim),
+			wantPriority: PriorityHigh,
+			wantFinding:  "persistent volume claim postgres-15-awx-instance-postgres-15-0 is Pending",
+		},
+		{
+			name:         "unschedulable pod",
+			objects:      healthy(unschedulable),
+			wantPriority: PriorityHigh,
+			wantFinding:  "pod/awx-instance-web-0 cannot be scheduled: 0/3 nodes are available",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			report := NewDoctor(cluster.Client, testConfig(t, nil)).Diagnose(context.Background())
+
+			if len(report.Findings) == 0 {
+				t.Fatal("Diagnose() found no root cause")
+			}
+			top := report.Findings[0]
+			if top.Priority != tt.wantPriority || !strings.Contains(top.Message, tt.wantFinding) {
+				t.Errorf("top finding = %s %q, want %s %q (all findings: %v)", top.Priority, top.Message, tt.wantPriority, tt.wantFinding, report.Findings)
+			}
+
+			for _, action := range cluster.Clientset.Actions() {
+				if verb := action.GetVerb(); verb != "get" && verb != "list" {
+					t.Errorf("Diagnose() mutated the cluster: %s %s", verb, action.GetResource().Resource)
+				}
+			}
+			for _, action := range cluster.Dynamic.Actions() {
+				if verb := action.GetVerb(); verb != "get" && verb != "list" {
+					t.Errorf("Diagnose() mutated the cluster: %s %s", verb, action.GetResource().Resource)
+				}
+			}
+		})
+	}
+}
+
+func TestDoctorHealthyInstall(t *testing.T) {
+	running := map[string]interface{}{"type": "Running", "status": "True", "reason": "Successful"}
+	objects := append(operatorObjects("awx"), awxWithConditions("awx", "awx-instance", running))
+	cluster := k8stest.NewCluster(objects...)
+
+	report := NewDoctor(cluster.Client, testConfig(t, nil)).Diagnose(context.Background())
+	for _, finding := range report.Findings {
+		if finding.Priority != PriorityLow {
+			t.Errorf("unexpected finding on a healthy install: %s %s", finding.Priority, finding.Message)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package deploy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/images"
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/operator"
+)
+
+const (
+	// egressCheckImage runs the probes, it is rewritten like all other images
+	egressCheckImage = "busybox:1.35"
+	// egressCheckTimeout bounds the whole diagnostic pod run
+	egressCheckTimeout = 3 * time.Minute
+	// egressProbeSeconds is the connect timeout of each probe
+	egressProbeSeconds = 5
+)
+
+// operatorDefaultImages are the images the operator uses for AWX CR image
+// fields that are not set
+var operatorDefaultImages = map[string]string{
+	"image":                  "quay.io/ansible/awx",
+	"control_plane_ee_image": "quay.io/ansible/awx-ee",
+	"init_container_image":   "quay.io/ansible/awx-ee",
+	"redis_image":            "docker.io/library/redis",
+	"postgres_image":         "quay.io/sclorg/postgresql-15-c9s",
+}
+
+// egressProbeScript connects to each host:port argument and prints
+// "OK <endpoint>" or "FAIL <endpoint>"
+const egressProbeScript = `for endpoint in "$@"; do
+  if nc -z -w %d "${endpoint%%:*}" "${endpoint##*:}" </dev/null >/dev/null 2>&1; then
+    echo "OK $endpoint"
+  else
+    echo "FAIL $endpoint"
+  fi
+done`
+
+// ReachabilityChecker checks which endpoints the cluster can connect to
+type ReachabilityChecker interface {
+	// Unreachable returns the endpoints, given as host:port, that could not
+	// be reached, mapped to the reason
+	Unreachable(ctx context.Context, endpoints []string) (map[string]string, error)
+}
+
+// EgressChecker checks before installing that the cluster can reach the
+// registries of all images the install pulls
+type EgressChecker struct {
+	config    *config.Config
+	generator *ManifestGenerator
+	checker   ReachabilityChecker
+}
+
+// NewEgressChecker creates a new egress checker probing from a pod in the cluster
+func NewEgressChecker(k8sClient *k8s.KubernetesClient, config *config.Config) *EgressChecker {
+	return NewEgressCheckerWith(config, NewPodReachabilityChecker(k8sClient, config))
+}
+
+// NewEgressCheckerWith creates a new egress checker using the given reachability checker
+func NewEgressCheckerWith(config *config.Config, checker ReachabilityChecker) *EgressChecker {
+	return &EgressChecker{
+		config:    config,
+		generator: NewManifestGenerator(config, DefaultManifestsPath),
+		checker:   checker,
+	}
+}
+
+// Check returns an error listing the registries the cluster cannot reach
+func (e *EgressChecker) Check(ctx context.Context) error {
+	endpoints, err := e.endpoints()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Checking egress to %s...", strings.Join(endpoints, ", "))
+	unreachable, err := e.checker.Unreachable(ctx, endpoints)
+	if err != nil {
+		return fmt.Errorf("egress check failed: %v", err)
+	}
+
+	if len(unreachable) == 0 {
+		log.Printf("✓ All %d registries are reachable", len(endpoints))
+		return nil
+	}
+
+	var problems []string
+	for _, endpoint := range endpoints {
+		if reason, ok := unreachable[endpoint]; ok {
+			problems = append(problems, fmt.Sprintf("%s (%s)", endpoint, reason))
+		}
+	}
+	return fmt.Errorf("cluster cannot reach %s, configure AWX_REGISTRY_MIRROR or allow egress to them", strings.Join(problems, ", "))
+}
+
+// endpoints returns the sorted host:port of every registry that images are
+// pulled from, after mirrors are applied
+func (e *EgressChecker) endpoints() ([]string, error) {
+	settings := images.NewSettings(e.config)
+	refs := []string{settings.Rewrite(egressCheckImage)}
+
+	// an operator installed by others is already running
+	if !e.config.SkipOperatorInstall {
+		operatorImages, err := operator.Images(e.config)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, operatorImages...)
+	}
+
+	manifests, err := e.generator.Generate()
+	if err != nil {
+		return nil, err
+	}
+	for _, manifest := range manifests {
+		refs = append(refs, images.References(manifest.Object)...)
+		if isAWX(manifest.Object) {
+			refs = append(refs, defaultImages(manifest.Object, settings)...)
+		}
+	}
+
+	seen := map[string]bool{}
+	var endpoints []string
+	for _, ref := range refs {
+		endpoint := registryEndpoint(images.Registry(ref))
+		if !seen[endpoint] {
+			seen[endpoint] = true
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Strings(endpoints)
+	return endpoints, nil
+}
+
+// defaultImages returns the operator default images for the image fields
+// the AWX CR leaves unset
+func defaultImages(awx *unstructured.Unstructured, settings images.Settings) []string {
+	var refs []string
+	for field, image := range operatorDefaultImages {
+		if value, _, _ := unstructured.NestedString(awx.Object, "spec", field); value == "" {
+			refs = append(refs, settings.Rewrite(image))
+		}
+	}
+	return refs
+}
+
+// registryEndpoint returns the host:port serving a registry. Docker Hub
+// images are served by registry-1.docker.io.
+func registryEndpoint(registry string) string {
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+	}
+	if _, _, err := net.SplitHostPort(registry); err == nil {
+		return registry
+	}
+	return net.JoinHostPort(registry, "443")
+}
+
+// PodReachabilityChecker probes endpoints from a short-lived pod in the AWX
+// namespace, so the result reflects the cluster's egress rules and DNS
+type PodReachabilityChecker struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewPodReachabilityChecker creates a new pod reachability checker
+func NewPodReachabilityChecker(k8sClient *k8s.KubernetesClient, config *config.Config) *PodReachabilityChecker {
+	return &PodReachabilityChecker{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Unreachable runs the probe pod and parses its output
+func (p *PodReachabilityChecker) Unreachable(ctx context.Context, endpoints []string) (map[string]string, error) {
+	if err := p.k8sClient.EnsureNamespace(ctx, p.config.Namespace, psaLabels(p.config)); err != nil {
+		return nil, err
+	}
+
+	pod := p.probePod(endpoints)
+	if err := p.k8sClient.CreatePod(ctx, pod); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := p.k8sClient.DeletePod(context.Background(), pod.Name, pod.Namespace); err != nil {
+			log.Printf("Warning: Could not delete egress check pod: %v", err)
+		}
+	}()
+
+	if err := p.waitForCompletion(ctx, pod.Name); err != nil {
+		return nil, err
+	}
+
+	logs, err := p.k8sClient.GetPodLogs(ctx, "app.kubernetes.io/name="+pod.Name, pod.Namespace, "probe", int64(len(endpoints)+10))
+	if err != nil {
+		return nil, err
+	}
+	return parseProbeOutput(logs, endpoints), nil
+}
+
+// probePod returns the pod probing the endpoints
+func (p *PodReachabilityChecker) probePod(endpoints []string) *corev1.Pod {
+	// unique per run, a pod of an earlier run may still be terminating
+	name := fmt.Sprintf("%s-egress-check-%d", p.config.AWXName, time.Now().Unix())
+	settings := images.NewSettings(p.config)
+	nonRoot := true
+	noEscalation := false
+	user := int64(65534)
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: p.config.Namespace,
+			Labels:    map[string]string{"app.kubernetes.io/name": name},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot:   &nonRoot,
+				RunAsUser:      &user,
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			Containers: []corev1.Container{{
+				Name:            "probe",
+				Image:           settings.Rewrite(egressCheckImage),
+				ImagePullPolicy: corev1.PullPolicy(settings.PullPolicy),
+				Command:         append([]string{"/bin/sh", "-c", fmt.Sprintf(egressProbeScript, egressProbeSeconds), "egress-check"}, endpoints...),
+				SecurityContext: &corev1.SecurityContext{
+					AllowPrivilegeEscalation: &noEscalation,
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				},
+			}},
+		},
+	}
+}
+
+// waitForCompletion waits for the probe pod to finish. A probe image that
+// cannot be pulled fails the check, since its registry is then unreachable too.
+func (p *PodReachabilityChecker) waitForCompletion(ctx context.Context, name string) error {
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, egressCheckTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		pod, err := p.k8sClient.GetPod(ctxWithTimeout, name, p.config.Namespace)
+		if err != nil {
+			log.Printf("Warning: Could not get egress check pod: %v", err)
+		} else {
+			switch pod.Status.Phase {
+			case corev1.PodSucceeded, corev1.PodFailed:
+				return nil
+			}
+			for _, cs := range pod.Status.ContainerStatuses {
+				if cs.State.Waiting != nil && (cs.State.Waiting.Reason == "ErrImagePull" || cs.State.Waiting.Reason == "ImagePullBackOff") {
+					return fmt.Errorf("cannot pull egress check image %s: %s", cs.Image, cs.State.Waiting.Message)
+				}
+			}
+		}
+
+		select {
+		case <-ctxWithTimeout.Done():
+			return fmt.Errorf("egress check pod did not finish within %v", egressCheckTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseProbeOutput maps the endpoints without an OK line to the reason
+func parseProbeOutput(output string, endpoints []string) map[string]string {
+	reachable := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "OK ") {
+			reachable[strings.TrimPrefix(line, "OK ")] = true
+		}
+	}
+
+	unreachable := map[string]string{}
+	for _, endpoint := range endpoints {
+		if !reachable[endpoint] {
+			unreachable[endpoint] = fmt.Sprintf("no connection within %ds", egressProbeSeconds)
+		}
+	}
+	return unreachable
+}
@@ -0,0 +1,148 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeReachability is a ReachabilityChecker with canned results
+type fakeReachability struct {
+	unreachable map[string]string
+	err         error
+	// checked are the endpoints asked for
+	checked []string
+}
+
+func (f *fakeReachability) Unreachable(_ context.Context, endpoints []string) (map[string]string, error) {
+	f.checked = endpoints
+	return f.unreachable, f.err
+}
+
+func TestEgressCheckerCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		unreachable   map[string]string
+		err           error
+		wantEndpoints []string
+		wantErr       string
+	}{
+		{
+			name:          "all reachable",
+			wantEndpoints: []string{"quay.io:443", "registry-1.docker.io:443"},
+		},
+		{
+			name:          "registry unreachable",
+			unreachable:   map[string]string{"quay.io:443": "no connection within 5s"},
+			wantEndpoints: []string{"quay.io:443", "registry-1.docker.io:443"},
+			wantErr:       "cluster cannot reach quay.io:443 (no connection within 5s), configure AWX_REGISTRY_MIRROR",
+		},
+		{
+			name:          "mirrored registries",
+			env:           map[string]string{"AWX_REGISTRY_MIRROR": "quay.io=mirror.local:5000/quay,docker.io=mirror.local:5000/hub"},
+			wantEndpoints: []string{"mirror.local:5000"},
+		},
+		{
+			name:          "operator installed by others",
+			env:           map[string]string{"AWX_SKIP_OPERATOR_INSTALL": "true", "AWX_REGISTRY_MIRROR": "quay.io=registry.example.com/quay"},
+			wantEndpoints: []string{"registry-1.docker.io:443", "registry.example.com:443"},
+		},
+		{
+			name:          "checker fails",
+			err:           errors.New("egress check pod did not finish within 3m0s"),
+			wantEndpoints: []string{"quay.io:443", "registry-1.docker.io:443"},
+			wantErr:       "egress check failed: egress check pod did not finish within 3m0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_OPERATOR_MANIFEST_PATH": filepath.Join("..", "operator", "testdata", "awx-operator.yaml")}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cfg := testConfig(t, env)
+			checker := &fakeReachability{unreachable: tt.unreachable, err: tt.err}
+			e := NewEgressCheckerWith(cfg, checker)
+			e.generator = NewManifestGenerator(cfg, manifestsDir)
+
+			err := e.Check(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Check() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Check() error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(checker.checked, tt.wantEndpoints) {
+				t.Errorf("checked endpoints = %v, want %v", checker.checked, tt.wantEndpoints)
+			}
+		})
+	}
+}
+
+func TestRegistryEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"quay.io":           "quay.io:443",
+		"docker.io":         "registry-1.docker.io:443",
+		"mirror.local:5000": "mirror.local:5000",
+		"[::1]:5000":        "[::1]:5000",
+	}
+	for registry, want := range tests {
+		if got := registryEndpoint(registry); got != want {
+			t.Errorf("registryEndpoint(%q) = %q, want %q", registry, got, want)
+		}
+	}
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	endpoints := []string{"quay.io:443", "registry-1.docker.io:443", "mirror.local:5000"}
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{
+			name:   "all reachable",
+			output: "OK quay.io:443\nOK registry-1.docker.io:443\nOK mirror.local:5000\n",
+		},
+		{
+			name:   "some fail",
+			output: "OK quay.io:443\nFAIL registry-1.docker.io:443\nFAIL mirror.local:5000\n",
+			want:   []string{"mirror.local:5000", "registry-1.docker.io:443"},
+		},
+		{
+			name:   "probe cut short",
+			output: "OK quay.io:443\n",
+			want:   []string{"mirror.local:5000", "registry-1.docker.io:443"},
+		},
+		{
+			name:   "no output",
+			output: "",
+			want:   []string{"mirror.local:5000", "quay.io:443", "registry-1.docker.io:443"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unreachable := parseProbeOutput(tt.output, endpoints)
+			var got []string
+			for _, endpoint := range endpoints {
+				if reason, ok := unreachable[endpoint]; ok {
+					got = append(got, endpoint)
+					if reason != "no connection within 5s" {
+						t.Errorf("reason for %s = %q", endpoint, reason)
+					}
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unreachable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package deploy
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// redactedValue replaces secret values unless they are exported
+const redactedValue = "<redacted>"
+
+// serverMetadataFields are the metadata fields the API server and
+// controllers manage, which an exported object must not carry
+var serverMetadataFields = []string{
+	"managedFields",
+	"resourceVersion",
+	"uid",
+	"creationTimestamp",
+	"generation",
+	"selfLink",
+	"ownerReferences",
+	"finalizers",
+	"deletionTimestamp",
+	"deletionGracePeriodSeconds",
+}
+
+// transientAnnotations are annotations that only record how an object was
+// last applied
+var transientAnnotations = []string{
+	corev1.LastAppliedConfigAnnotation,
+	ReconcileNonceAnnotation,
+}
+
+// Exporter captures a live AWX deployment as manifests: the AWX CR, the
+// secrets and config maps its spec references and the ingress the operator
+// created for it
+type Exporter struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewExporter creates a new exporter
+func NewExporter(k8sClient *k8s.KubernetesClient, config *config.Config) *Exporter {
+	return &Exporter{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Export reads the deployment from the cluster and returns its objects in
+// apply order, without status and server-managed metadata. Secret values are
+// redacted unless includeSecrets is set.
+func (e *Exporter) Export(ctx context.Context, includeSecrets bool) ([]Manifest, error) {
+	awx, err := e.k8sClient.GetAWX(ctx, e.config.AWXName, e.config.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWX instance %s: %v", e.config.AWXName, err)
+	}
+
+	secretNames, configMapNames := e.references(awx)
+	objs := []*unstructured.Unstructured{awx}
+
+	secrets, err := e.named(ctx, "secrets", secretNames)
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets {
+		if err := exportSecretData(secret, includeSecrets); err != nil {
+			return nil, err
+		}
+	}
+	objs = append(objs, secrets...)
+
+	configMaps, err := e.named(ctx, "configmaps", configMapNames)
+	if err != nil {
+		return nil, err
+	}
+	objs = append(objs, configMaps...)
+
+	ingresses, err := e.k8sClient.ListResources(ctx, "networking.k8s.io", "v1", "ingresses", e.config.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ingresses {
+		ingress := &ingresses[i]
+		if ownedByInstance(metav1.ObjectMeta{OwnerReferences: ingress.GetOwnerReferences(), Labels: ingress.GetLabels()}, e.config.AWXName) {
+			objs = append(objs, ingress)
+		}
+	}
+
+	var manifests []Manifest
+	for _, obj := range objs {
+		cleanExported(obj)
+		manifests = append(manifests, Manifest{Object: obj, Source: "cluster"})
+	}
+	sortByKind(manifests, e.config)
+	return manifests, nil
+}
+
+// ExportTo writes the exported objects to dir, one file each, named like
+// the files of RenderTo, and returns the paths written
+func (e *Exporter) ExportTo(ctx context.Context, dir string, includeSecrets bool) ([]string, error) {
+	manifests, err := e.Export(ctx, includeSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory %s: %v", dir, err)
+	}
+
+	// Secret values may be written, so keep the files private then
+	mode := os.FileMode(0644)
+	if includeSecrets {
+		mode = 0600
+	}
+
+	var paths []string
+	for i, manifest := range manifests {
+		data, err := yaml.Marshal(manifest.Object.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s %s: %v", manifest.Object.GetKind(), manifest.Object.GetName(), err)
+		}
+
+		path := filepath.Join(dir, renderFileName(i, manifest))
+		if err := ioutil.WriteFile(path, data, mode); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// references returns the secrets and config maps the AWX CR spec references,
+// from fields such as admin_password_secret and lists such as
+// extra_settings_files.configmaps. The admin password, Postgres configuration
+// and secret key secrets are included under their default names when the
+// spec does not set them, the operator generates those.
+func (e *Exporter) references(awx *unstructured.Unstructured) ([]string, []string) {
+	secrets := map[string]bool{}
+	configMaps := map[string]bool{}
+
+	spec, _, _ := unstructured.NestedMap(awx.Object, "spec")
+	collectReferences(spec, secrets, configMaps)
+
+	defaults := map[string]string{
+		"admin_password_secret":         "admin-password",
+		"postgres_configuration_secret": "postgres-configuration",
+		"secret_key_secret":             "secret-key",
+	}
+	for field, suffix := range defaults {
+		if name, _, _ := unstructured.NestedString(spec, field); name == "" {
+			secrets[fmt.Sprintf("%s-%s", e.config.AWXName, suffix)] = true
+		}
+	}
+	return sortedNames(secrets), sortedNames(configMaps)
+}
+
+// collectReferences walks a spec value and adds the names of referenced
+// secrets and config maps
+func collectReferences(value interface{}, secrets, configMaps map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if name, ok := field.(string); ok && name != "" {
+				switch {
+				case strings.HasSuffix(key, "_secret"):
+					secrets[name] = true
+				case strings.HasSuffix(key, "_configmap"):
+					configMaps[name] = true
+				}
+				continue
+			}
+			if items, ok := field.([]interface{}); ok && (key == "secrets" || key == "configmaps") {
+				for _, item := range items {
+					entry, _ := item.(map[string]interface{})
+					if name, _ := entry["name"].(string); name != "" {
+						if key == "secrets" {
+							secrets[name] = true
+						} else {
+							configMaps[name] = true
+						}
+					}
+				}
+				continue
+			}
+			collectReferences(field, secrets, configMaps)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectReferences(item, secrets, configMaps)
+		}
+	}
+}
+
+// named returns the objects of a core resource with the given names in the
+// AWX namespace. Missing ones are logged and left out.
+func (e *Exporter) named(ctx context.Context, resource string, names []string) ([]*unstructured.Unstructured, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	items, err := e.k8sClient.ListResources(ctx, "", "v1", resource, e.config.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*unstructured.Unstructured, len(items))
+	for i := range items {
+		byName[items[i].GetName()] = &items[i]
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, name := range names {
+		obj, ok := byName[name]
+		if !ok {
+			log.Printf("Warning: %s/%s of AWX instance %s not found, not exporting it", resource, name, e.config.AWXName)
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// exportSecretData moves the values of a secret to stringData, decoded when
+// they are included and replaced by redactedValue otherwise. Binary values
+// that are included stay base64-encoded in data.
+func exportSecretData(secret *unstructured.Unstructured, includeSecrets bool) error {
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "data")
+	unstructured.RemoveNestedField(secret.Object, "data")
+	if len(data) == 0 {
+		return nil
+	}
+
+	stringData := map[string]interface{}{}
+	binary := map[string]interface{}{}
+	for key, value := range data {
+		if !includeSecrets {
+			stringData[key] = redactedValue
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("failed to decode key %s of secret %s: %v", key, secret.GetName(), err)
+		}
+		if utf8.Valid(decoded) {
+			stringData[key] = string(decoded)
+		} else {
+			binary[key] = value
+		}
+	}
+
+	if len(stringData) > 0 {
+		secret.Object["stringData"] = stringData
+	}
+	if len(binary) > 0 {
+		secret.Object["data"] = binary
+	}
+	return nil
+}
+
+// cleanExported drops the status, server-managed metadata and transient
+// annotations of an object read from the cluster
+func cleanExported(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "status")
+	for _, field := range serverMetadataFields {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+
+	annotations := obj.GetAnnotations()
+	for _, annotation := range transientAnnotations {
+		delete(annotations, annotation)
+	}
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+	} else {
+		obj.SetAnnotations(annotations)
+	}
+}
+
+// sortedNames returns the keys of a set in order
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,174 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// liveDeployment returns the objects of an AWX deployment as read from a
+// cluster, with status and server-managed metadata set
+func liveDeployment() []runtime.Object {
+	awx := k8stest.AWX("awx", "awx-instance")
+	awx.SetUID("6f1c4a52-7d1e-4c55-9a0e-2b8f1d0c3e11")
+	awx.SetResourceVersion("48213")
+	awx.SetGeneration(3)
+	awx.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "awx-deployer", Operation: metav1.ManagedFieldsOperationApply}})
+	awx.SetFinalizers([]string{"awx.ansible.com/finalizer"})
+	awx.SetAnnotations(map[string]string{
+		corev1.LastAppliedConfigAnnotation: `{"kind":"AWX"}`,
+		ReconcileNonceAnnotation:           "2026-10-16T11:45:32Z",
+		"team":                             "platform",
+	})
+	unstructured.SetNestedField(awx.Object, "awx-admin-password", "spec", "admin_password_secret")
+	unstructured.SetNestedField(awx.Object, "ingress", "spec", "service_type")
+	unstructured.SetNestedSlice(awx.Object, []interface{}{
+		map[string]interface{}{"name": "awx-extra-settings", "key": "settings.py"},
+	}, "spec", "extra_settings_files", "configmaps")
+	unstructured.SetNestedField(awx.Object, int64(3), "status", "observedGeneration")
+
+	secret := func(name string, data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "awx", ResourceVersion: "100", UID: types.UID("uid-" + name)},
+			Data:       data,
+		}
+	}
+	ingress := k8stest.Object("networking.k8s.io/v1", "Ingress", "awx", "awx-instance-ingress")
+	ingress.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "awx-operator", "app.kubernetes.io/instance": "awx-instance"})
+	ingress.SetResourceVersion("200")
+	unstructured.SetNestedField(ingress.Object, "nginx", "spec", "ingressClassName")
+	unstructured.SetNestedSlice(ingress.Object, []interface{}{
+		map[string]interface{}{"ip": "10.0.0.1"},
+	}, "status", "loadBalancer", "ingress")
+	other := k8stest.Object("networking.k8s.io/v1", "Ingress", "awx", "grafana")
+
+	return []runtime.Object{
+		awx,
+		secret("awx-admin-password", map[string][]byte{"password": []byte("Live-Admin-Pass-1")}),
+		secret("awx-instance-postgres-configuration", map[string][]byte{"host": []byte("awx-instance-postgres-15"), "password": []byte("pg-pass")}),
+		secret("awx-instance-secret-key", map[string][]byte{"secret_key": {0xff, 0xfe, 0x00}}),
+		secret("unrelated", map[string][]byte{"token": []byte("x")}),
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "awx-extra-settings", Namespace: "awx", ResourceVersion: "300"},
+			Data:       map[string]string{"settings.py": "DEBUG = False\n"},
+		},
+		ingress,
+		other,
+	}
+}
+
+func TestExportTo(t *testing.T) {
+	tests := []struct {
+		name           string
+		includeSecrets bool
+		wantMode       os.FileMode
+	}{
+		{name: "redacted", wantMode: 0644},
+		{name: "include secrets", includeSecrets: true, wantMode: 0600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(liveDeployment()...)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": "awx-instance"})
+			dir := t.TempDir()
+			paths, err := NewExporter(cluster.Client, cfg).ExportTo(context.Background(), dir, tt.includeSecrets)
+			if err != nil {
+				t.Fatalf("ExportTo() failed: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "export", filepath.Base(t.Name()))
+			if *update {
+				os.RemoveAll(golden)
+				if err := os.MkdirAll(golden, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := filepath.Glob(filepath.Join(golden, "*.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !*update && len(want) != len(paths) {
+				t.Errorf("exported %d files, want %d", len(paths), len(want))
+			}
+			for _, path := range paths {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != tt.wantMode {
+					t.Errorf("%s mode = %v, want %v", filepath.Base(path), info.Mode().Perm(), tt.wantMode)
+				}
+				got, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, field := range []string{"status:", "managedFields:", "resourceVersion:", "uid:"} {
+					if strings.Contains(string(got), field) {
+						t.Errorf("%s keeps %s", filepath.Base(path), field)
+					}
+				}
+				goldenPath := filepath.Join(golden, filepath.Base(path))
+				if *update {
+					if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				expected, err := os.ReadFile(goldenPath)
+				if err != nil {
+					t.Errorf("unexpected file %s: %v", filepath.Base(path), err)
+					continue
+				}
+				if string(got) != string(expected) {
+					t.Errorf("%s differs from the golden file:\n%s", filepath.Base(path), got)
+				}
+			}
+		})
+	}
+}
+
+func TestExportMissingInstance(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": "awx-instance"})
+	_, err := NewExporter(k8stest.NewCluster().Client, cfg).Export(context.Background(), false)
+	if err == nil || !strings.Contains(err.Error(), "failed to read AWX instance awx-instance") {
+		t.Fatalf("Export() error = %v, want the AWX instance missing", err)
+	}
+}
+
+func TestExportToIsStable(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": "awx-instance"})
+	var exports [][]byte
+	for run := 0; run < 2; run++ {
+		// A fresh cluster each run, so that map order of the objects read
+		// differs between runs
+		exporter := NewExporter(k8stest.NewCluster(liveDeployment()...).Client, cfg)
+		paths, err := exporter.ExportTo(context.Background(), t.TempDir(), true)
+		if err != nil {
+			t.Fatalf("ExportTo() failed: %v", err)
+		}
+		var all []byte
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(append(all, filepath.Base(path)+"\n"...), data...)
+		}
+		exports = append(exports, all)
+	}
+	if string(exports[0]) != string(exports[1]) {
+		t.Errorf("exports differ:\n%s\n---\n%s", exports[0], exports[1])
+	}
+}
@@ -0,0 +1,230 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// Exposure describes how the AWX service is exposed, as set on the AWX CR
+type Exposure struct {
+	ServiceType string
+	IngressType string
+	Hostname    string
+	// Hostnames are all hosts of the ingress, Hostname first
+	Hostnames []string
+	// TLS is set when the ingress terminates TLS with a certificate secret
+	TLS bool
+	// Path is the subpath AWX is served under on the ingress, empty for /
+	Path string
+}
+
+// HasIngress reports whether the operator creates an Ingress for AWX
+func (e Exposure) HasIngress() bool {
+	return strings.EqualFold(e.IngressType, "ingress")
+}
+
+// getExposure reads the service and ingress types from the AWX CR spec,
+// falling back to the operator defaults for unset fields
+func getExposure(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config) (Exposure, error) {
+	awx, err := k8sClient.GetAWX(ctx, cfg.AWXName, cfg.Namespace)
+	if err != nil {
+		return Exposure{}, err
+	}
+	return exposureOf(awx), nil
+}
+
+// exposureOf reads the service and ingress types from the spec of an AWX CR
+func exposureOf(awx *unstructured.Unstructured) Exposure {
+	exposure := Exposure{ServiceType: "ClusterIP", IngressType: "none"}
+	if value, found, _ := unstructured.NestedString(awx.Object, "spec", "service_type"); found && value != "" {
+		exposure.ServiceType = value
+	}
+	if value, found, _ := unstructured.NestedString(awx.Object, "spec", "ingress_type"); found && value != "" {
+		exposure.IngressType = value
+	}
+	exposure.Hostname, _, _ = unstructured.NestedString(awx.Object, "spec", "hostname")
+	if secret, _, _ := unstructured.NestedString(awx.Object, "spec", "ingress_tls_secret"); secret != "" {
+		exposure.TLS = true
+	}
+	if path, _, _ := unstructured.NestedString(awx.Object, "spec", "ingress_path"); path != "/" {
+		exposure.Path = strings.TrimSuffix(path, "/")
+	}
+	if exposure.Hostname != "" {
+		exposure.Hostnames = append(exposure.Hostnames, exposure.Hostname)
+	}
+
+	// ingress_hosts replaces hostname and ingress_tls_secret in newer operators
+	hosts, _, _ := unstructured.NestedSlice(awx.Object, "spec", "ingress_hosts")
+	for _, item := range hosts {
+		host, _ := item.(map[string]interface{})
+		hostname, _ := host["hostname"].(string)
+		if hostname == "" || containsString(exposure.Hostnames, hostname) {
+			continue
+		}
+		if exposure.Hostname == "" {
+			exposure.Hostname = hostname
+		}
+		exposure.Hostnames = append(exposure.Hostnames, hostname)
+		if secret, _ := host["tls_secret"].(string); secret != "" {
+			exposure.TLS = true
+		}
+	}
+	return exposure
+}
+
+// AccessURL returns how to reach AWX for the way it is exposed: the ingress
+// URL with the scheme matching its TLS setup and its subpath, a node address for NodePort
+// and LoadBalancer services, or a port-forward command for ClusterIP
+func AccessURL(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config) (string, error) {
+	exposure, err := getExposure(ctx, k8sClient, cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine AWX exposure: %v", err)
+	}
+
+	if exposure.HasIngress() {
+		host := exposure.Hostname
+		if host == "" {
+			// without a host rule the ingress answers on its own address
+			ingress, err := findInstanceObject(ctx, k8sClient, cfg, ingressesGVR, roleIngress)
+			if err != nil {
+				return "", err
+			}
+			if ingress == nil {
+				return "", fmt.Errorf("ingress of AWX instance %s does not exist", cfg.AWXName)
+			}
+			status, err := k8sClient.GetIngressStatus(ctx, ingress.GetName(), cfg.Namespace)
+			if err != nil {
+				return "", err
+			}
+			host = status
+		}
+		return ingressURL(host, exposure.TLS) + exposure.Path, nil
+	}
+
+	found, err := findInstanceObject(ctx, k8sClient, cfg, servicesGVR, roleService)
+	if err != nil {
+		return "", err
+	}
+	if found == nil {
+		return "", fmt.Errorf("service of AWX instance %s does not exist", cfg.AWXName)
+	}
+	serviceName := found.GetName()
+	service, err := k8sClient.GetService(ctx, serviceName, cfg.Namespace)
+	if err != nil {
+		return "", err
+	}
+
+	switch service.Spec.Type {
+	case corev1.ServiceTypeLoadBalancer:
+		for _, lb := range service.Status.LoadBalancer.Ingress {
+			address := lb.Hostname
+			if address == "" {
+				address = lb.IP
+			}
+			if address != "" && len(service.Spec.Ports) > 0 {
+				return fmt.Sprintf("http://%s", net.JoinHostPort(address, strconv.Itoa(int(service.Spec.Ports[0].Port)))), nil
+			}
+		}
+		fallthrough
+	case corev1.ServiceTypeNodePort:
+		if len(service.Spec.Ports) == 0 || service.Spec.Ports[0].NodePort == 0 {
+			return "", fmt.Errorf("service %s has no node port", serviceName)
+		}
+		nodeIP, err := nodeAddress(ctx, k8sClient)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("http://%s", net.JoinHostPort(nodeIP, strconv.Itoa(int(service.Spec.Ports[0].NodePort)))), nil
+	default:
+		port, err := servicePort(service)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("http://localhost:8080 (run: kubectl port-forward -n %s svc/%s 8080:%d)", cfg.Namespace, serviceName, port), nil
+	}
+}
+
+// FallbackAccessURL returns the URL to report when AccessURL fails: the
+// AWX_HOSTNAME URL, or empty when the AWX CR exposes AWX without an ingress,
+// which that host would not reach
+func FallbackAccessURL(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config) string {
+	if exposure, err := getExposure(ctx, k8sClient, cfg); err == nil && !exposure.HasIngress() {
+		return ""
+	}
+	return awxBaseURL(cfg)
+}
+
+// serviceURL returns the in-cluster URL of the AWX service, with the port
+// read from the service since it need not be 80. The port named http is
+// used, or the first port if none is.
+func serviceURL(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config) (string, error) {
+	found, err := findInstanceObject(ctx, k8sClient, cfg, servicesGVR, roleService)
+	if err != nil {
+		return "", err
+	}
+	if found == nil {
+		return "", fmt.Errorf("service of AWX instance %s does not exist", cfg.AWXName)
+	}
+	service, err := k8sClient.GetService(ctx, found.GetName(), cfg.Namespace)
+	if err != nil {
+		return "", err
+	}
+
+	port, err := servicePort(service)
+	if err != nil {
+		return "", err
+	}
+	host := fmt.Sprintf("%s.%s.svc", service.Name, service.Namespace)
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// servicePort returns the port of the AWX service, the one named http or
+// else the first one
+func servicePort(service *corev1.Service) (int32, error) {
+	if len(service.Spec.Ports) == 0 {
+		return 0, fmt.Errorf("service %s has no ports", service.Name)
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Name == "http" {
+			return port.Port, nil
+		}
+	}
+	return service.Spec.Ports[0].Port, nil
+}
+
+// ingressURL returns the URL of an ingress host
+func ingressURL(host string, tls bool) string {
+	if tls {
+		return "https://" + host
+	}
+	return "http://" + host
+}
+
+// nodeAddress returns an address of the first node, preferring external IPs
+func nodeAddress(ctx context.Context, k8sClient *k8s.KubernetesClient) (string, error) {
+	nodes, err := k8sClient.ListNodes(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, addressType := range []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeInternalIP} {
+		for _, node := range nodes {
+			for _, address := range node.Status.Addresses {
+				if address.Type == addressType {
+					return address.Address, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("no node with an external or internal IP found")
+}
@@ -0,0 +1,236 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// awxWithSpec returns an AWX CR with the given spec
+func awxWithSpec(namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	awx := k8stest.AWX(namespace, name)
+	awx.Object["spec"] = spec
+	return awx
+}
+
+// awxService returns the service of the AWX instance awx-instance
+func awxService(serviceType corev1.ServiceType, ports ...corev1.ServicePort) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-instance-service", Namespace: "awx", Labels: instanceLabels("awx-instance", "web")},
+		Spec:       corev1.ServiceSpec{Type: serviceType, Ports: ports},
+	}
+}
+
+// node returns a node with the given addresses
+func node(name string, addresses ...corev1.NodeAddress) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: corev1.NodeStatus{Addresses: addresses}}
+}
+
+func TestAccessURL(t *testing.T) {
+	httpPort := corev1.ServicePort{Name: "http", Port: 80, NodePort: 30080}
+	internalIP := corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.5"}
+	externalIP := corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.5"}
+
+	addressedIngress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-instance-ingress", Namespace: "awx", Labels: instanceLabels("awx-instance", "")},
+		Status: networkingv1.IngressStatus{LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+			Ingress: []networkingv1.IngressLoadBalancerIngress{{IP: "198.51.100.7"}},
+		}},
+	}
+	loadBalancer := awxService(corev1.ServiceTypeLoadBalancer, httpPort)
+	loadBalancer.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}}
+
+	tests := []struct {
+		name         string
+		spec         map[string]interface{}
+		objects      []runtime.Object
+		want         string
+		wantErr      string
+		wantFallback string
+	}{
+		{
+			name:         "ingress with TLS",
+			spec:         map[string]interface{}{"ingress_type": "ingress", "hostname": "awx.example.com", "ingress_tls_secret": "awx-tls"},
+			want:         "https://awx.example.com",
+			wantFallback: "http://awx.example.com",
+		},
+		{
+			name:         "ingress without TLS",
+			spec:         map[string]interface{}{"ingress_type": "ingress", "hostname": "awx.example.com"},
+			want:         "http://awx.example.com",
+			wantFallback: "http://awx.example.com",
+		},
+		{
+			name: "ingress hosts with TLS",
+			spec: map[string]interface{}{"ingress_type": "ingress", "ingress_hosts": []interface{}{
+				map[string]interface{}{"hostname": "awx.example.com", "tls_secret": "awx-tls"},
+			}},
+			want:         "https://awx.example.com",
+			wantFallback: "http://awx.example.com",
+		},
+		{
+			name: "ingress hosts with aliases use the first host",
+			spec: map[string]interface{}{"ingress_type": "ingress", "ingress_hosts": []interface{}{
+				map[string]interface{}{"hostname": "awx.example.com", "tls_secret": "awx-tls"},
+				map[string]interface{}{"hostname": "awx.internal.example.com", "tls_secret": "awx-tls"},
+			}},
+			want:         "https://awx.example.com",
+			wantFallback: "http://awx.example.com",
+		},
+		{
+			name:         "ingress under a path",
+			spec:         map[string]interface{}{"ingress_type": "ingress", "hostname": "awx.example.com", "ingress_path": "/awx/"},
+			want:         "http://awx.example.com/awx",
+			wantFallback: "http://awx.example.com",
+		},
+		{
+			name:         "ingress without a host",
+			spec:         map[string]interface{}{"ingress_type": "ingress"},
+			objects:      []runtime.Object{addressedIngress},
+			want:         "http://198.51.100.7",
+			wantFallback: "http://awx.example.com",
+		},
+		{
+			name:    "NodePort prefers the external node IP",
+			spec:    map[string]interface{}{"service_type": "NodePort"},
+			objects: []runtime.Object{awxService(corev1.ServiceTypeNodePort, httpPort), node("node-1", internalIP, externalIP)},
+			want:    "http://203.0.113.5:30080",
+		},
+		{
+			name:    "NodePort on an internal node IP",
+			spec:    map[string]interface{}{"service_type": "NodePort"},
+			objects: []runtime.Object{awxService(corev1.ServiceTypeNodePort, httpPort), node("node-1", internalIP)},
+			want:    "http://10.0.0.5:30080",
+		},
+		{
+			name:    "NodePort without nodes",
+			spec:    map[string]interface{}{"service_type": "NodePort"},
+			objects: []runtime.Object{awxService(corev1.ServiceTypeNodePort, httpPort)},
+			wantErr: "no node with an external or internal IP found",
+		},
+		{
+			name:    "LoadBalancer with an address",
+			spec:    map[string]interface{}{"service_type": "LoadBalancer"},
+			objects: []runtime.Object{loadBalancer},
+			want:    "http://lb.example.com:80",
+		},
+		{
+			name:    "LoadBalancer pending falls back to the node port",
+			spec:    map[string]interface{}{"service_type": "LoadBalancer"},
+			objects: []runtime.Object{awxService(corev1.ServiceTypeLoadBalancer, httpPort), node("node-1", internalIP)},
+			want:    "http://10.0.0.5:30080",
+		},
+		{
+			name:    "ClusterIP port-forward hint",
+			spec:    map[string]interface{}{},
+			objects: []runtime.Object{awxService(corev1.ServiceTypeClusterIP, corev1.ServicePort{Name: "metrics", Port: 9090}, corev1.ServicePort{Name: "http", Port: 8052})},
+			want:    "http://localhost:8080 (run: kubectl port-forward -n awx svc/awx-instance-service 8080:8052)",
+		},
+		{
+			name:    "service missing",
+			spec:    map[string]interface{}{"service_type": "NodePort"},
+			wantErr: "service of AWX instance awx-instance does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := append([]runtime.Object{awxWithSpec("awx", "awx-instance", tt.spec)}, tt.objects...)
+			cluster := k8stest.NewCluster(objects...)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_HOSTNAME": "awx.example.com", "AWX_TLS": "false"})
+
+			got, err := AccessURL(context.Background(), cluster.Client, cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("AccessURL() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("AccessURL() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("AccessURL() = %q, want %q", got, tt.want)
+			}
+
+			// the AWX_HOSTNAME URL would not reach AWX exposed without an ingress
+			if fallback := FallbackAccessURL(context.Background(), cluster.Client, cfg); fallback != tt.wantFallback {
+				t.Errorf("FallbackAccessURL() = %q, want %q", fallback, tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestServiceURL(t *testing.T) {
+	// custom is a service named other than the operator names it
+	custom := awxService(corev1.ServiceTypeClusterIP, corev1.ServicePort{Name: "http", Port: 8080})
+	custom.Name = "awx-frontend"
+
+	tests := []struct {
+		name    string
+		service *corev1.Service
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "default port",
+			service: awxService(corev1.ServiceTypeClusterIP, corev1.ServicePort{Name: "http", Port: 80}),
+			want:    "http://awx-instance-service.awx.svc:80",
+		},
+		{
+			name:    "non-default http port",
+			service: awxService(corev1.ServiceTypeClusterIP, corev1.ServicePort{Name: "metrics", Port: 9090}, corev1.ServicePort{Name: "http", Port: 8052}),
+			want:    "http://awx-instance-service.awx.svc:8052",
+		},
+		{
+			name:    "first port without one named http",
+			service: awxService(corev1.ServiceTypeNodePort, corev1.ServicePort{Name: "web", Port: 8443, NodePort: 30443}),
+			want:    "http://awx-instance-service.awx.svc:8443",
+		},
+		{
+			name:    "custom-named service",
+			service: custom,
+			want:    "http://awx-frontend.awx.svc:8080",
+		},
+		{
+			name:    "no ports",
+			service: awxService(corev1.ServiceTypeClusterIP),
+			wantErr: "service awx-instance-service has no ports",
+		},
+		{
+			name:    "service missing",
+			wantErr: "service of AWX instance awx-instance does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.service != nil {
+				objects = append(objects, tt.service)
+			}
+			cluster := k8stest.NewCluster(objects...)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_VERIFY_VIA_SERVICE": "true"})
+
+			got, err := serviceURL(context.Background(), cluster.Client, cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("serviceURL() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("serviceURL() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("serviceURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package deploy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/images"
+	"awx-deployer/internal/k8s"
+)
+
+const (
+	// SourceAnnotation records the manifest file an applied object came
+	// from, or GeneratedSource
+	SourceAnnotation = "awx-deployer/source"
+	// GeneratedSource marks objects the deployer builds from configuration
+	// rather than loads from a manifest file
+	GeneratedSource = "generated"
+
+	// ManagedByLabel marks the objects the deployer applies, with the value
+	// ManagedByValue
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the value of ManagedByLabel on objects the deployer
+	// applies
+	ManagedByValue = "awx-deployer"
+	// InstanceLabel names the AWX instance, as <namespace>.<awxname>, an
+	// object carrying ManagedByLabel was applied for, so that deployers of
+	// other instances in the cluster do not prune it
+	InstanceLabel = "awx-deployer/instance"
+)
+
+// maxLabelValue is the longest value Kubernetes accepts for a label
+const maxLabelValue = 63
+
+// Manifest is a single Kubernetes object together with the file it was loaded from
+type Manifest struct {
+	Source string
+	Object *unstructured.Unstructured
+}
+
+// ManifestGenerator loads the static manifests and applies configuration to them
+type ManifestGenerator struct {
+	config        *config.Config
+	manifestsPath string
+}
+
+// NewManifestGenerator creates a new manifest generator
+func NewManifestGenerator(config *config.Config, manifestsPath string) *ManifestGenerator {
+	return &ManifestGenerator{
+		config:        config,
+		manifestsPath: manifestsPath,
+	}
+}
+
+// Generate returns all manifest objects in apply order with configuration applied
+func (g *ManifestGenerator) Generate() ([]Manifest, error) {
+	// Check if manifests directory exists
+	if _, err := os.Stat(g.manifestsPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("manifests directory %s does not exist", g.manifestsPath)
+	}
+
+	var manifests []Manifest
+	var err error
+	if g.kustomize() {
+		manifests, err = g.build()
+	} else {
+		manifests, err = g.read()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Objects like secrets are configured based on what the AWX CR references
+	var awx *unstructured.Unstructured
+	for _, manifest := range manifests {
+		if isAWX(manifest.Object) {
+			awx = manifest.Object
+		}
+	}
+
+	// The external Redis secret is applied with the other secrets, before
+	// the AWX CR using it
+	if g.config.RedisExternal && awx != nil {
+		manifests = append(manifests, Manifest{Source: GeneratedSource, Object: redisSecret(g.config, awx)})
+	}
+	sortByKind(manifests, g.config)
+
+	settings := images.NewSettings(g.config)
+	for _, manifest := range manifests {
+		obj := manifest.Object
+		if err := g.customize(obj, awx); err != nil {
+			return nil, fmt.Errorf("failed to configure %s %s from %s: %v", obj.GetKind(), obj.GetName(), manifest.Source, err)
+		}
+		if err := settings.Apply(obj); err != nil {
+			return nil, fmt.Errorf("failed to configure images of %s %s from %s: %v", obj.GetKind(), obj.GetName(), manifest.Source, err)
+		}
+		setSource(obj, manifest.Source)
+		setManagedBy(obj, instanceLabel(g.config))
+	}
+
+	return manifests, nil
+}
+
+// kustomize reports whether the manifests directory is built with kustomize,
+// as set by AWX_MANIFEST_SOURCE or because it holds a kustomization
+func (g *ManifestGenerator) kustomize() bool {
+	switch g.config.ManifestSource {
+	case config.ManifestSourceKustomize:
+		return true
+	case config.ManifestSourceFiles:
+		return false
+	}
+	return k8s.HasKustomization(g.manifestsPath)
+}
+
+// build renders the kustomization of the manifests directory, the same way
+// kustomize build does
+func (g *ManifestGenerator) build() ([]Manifest, error) {
+	objs, err := k8s.RenderKustomization(g.manifestsPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("kustomization in %s renders no objects", g.manifestsPath)
+	}
+
+	source := kustomizeSource(g.manifestsPath)
+	var manifests []Manifest
+	for _, obj := range objs {
+		manifests = append(manifests, Manifest{Source: source, Object: obj})
+	}
+	return manifests, nil
+}
+
+// kustomizeSource names the kustomization of a directory as the source of
+// the objects it renders
+func kustomizeSource(dir string) string {
+	return "kustomize:" + filepath.Base(filepath.Clean(dir))
+}
+
+// read decodes the YAML files of the manifests directory
+func (g *ManifestGenerator) read() ([]Manifest, error) {
+	files, err := filepath.Glob(filepath.Join(g.manifestsPath, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest files: %v", err)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no YAML manifest files found in %s", g.manifestsPath)
+	}
+
+	// Read files in name order, objects are sorted by kind and name later
+	sort.Strings(files)
+
+	var manifests []Manifest
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest file %s: %v", file, err)
+		}
+
+		objs, err := k8s.DecodeManifests(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode manifest %s: %v", file, err)
+		}
+
+		for _, obj := range objs {
+			manifests = append(manifests, Manifest{Source: filepath.Base(file), Object: obj})
+		}
+	}
+	return manifests, nil
+}
+
+// setSource records where an object came from in SourceAnnotation, unless
+// the object already names its source
+func setSource(obj *unstructured.Unstructured, source string) {
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[SourceAnnotation]; ok {
+		return
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[SourceAnnotation] = source
+	obj.SetAnnotations(annotations)
+}
+
+// setManagedBy labels an object as applied by the deployer for the given
+// instance, unless the manifest names another manager
+func setManagedBy(obj *unstructured.Unstructured, instance string) {
+	labels := obj.GetLabels()
+	if _, ok := labels[ManagedByLabel]; ok {
+		return
+	}
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[ManagedByLabel] = ManagedByValue
+	labels[InstanceLabel] = instance
+	obj.SetLabels(labels)
+}
+
+// instanceLabel returns the value of InstanceLabel for the configured
+// instance. Values too long for a label are shortened and made unique by a
+// hash of the full value.
+func instanceLabel(cfg *config.Config) string {
+	value := cfg.Namespace + "." + cfg.AWXName
+	if len(value) <= maxLabelValue {
+		return value
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(value)))[:8]
+	return value[:maxLabelValue-len(hash)-1] + "-" + hash
+}
+
+// managedByDeployer reports whether a live object was applied by the
+// deployer, by its label or, for objects applied before the label was set,
+// by SourceAnnotation
+func managedByDeployer(obj *unstructured.Unstructured) bool {
+	if obj.GetLabels()[ManagedByLabel] == ManagedByValue {
+		return true
+	}
+	_, ok := obj.GetAnnotations()[SourceAnnotation]
+	return ok
+}
+
+// customize applies configuration values to a single object
+func (g *ManifestGenerator) customize(obj, awx *unstructured.Unstructured) error {
+	if isAWX(obj) {
+		return g.customizeAWX(obj)
+	}
+	if obj.GetKind() == "Secret" {
+		return g.customizeSecret(obj, awx)
+	}
+	applyPSALabels(obj, g.config)
+	return nil
+}
+
+// isAWX reports whether an object is an AWX custom resource
+func isAWX(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == k8s.AWXGroup && gvk.Kind == k8s.AWXKind
+}
+
+// customizeSecret fills in configured credentials in the secrets the AWX CR references
+func (g *ManifestGenerator) customizeSecret(obj, awx *unstructured.Unstructured) error {
+	if awx == nil || obj.GetName() != adminPasswordSecretName(awx, g.config) {
+		return nil
+	}
+
+	// stringData takes precedence over data on the API server
+	return unstructured.SetNestedField(obj.Object, g.config.AdminPassword, "stringData", "password")
+}
+
+// customizeAWX applies configuration values to the AWX custom resource spec
+func (g *ManifestGenerator) customizeAWX(obj *unstructured.Unstructured) error {
+	// Admin user, AWX image version and managed PostgreSQL image and resources
+	fields := []struct {
+		value string
+		path  []string
+	}{
+		{g.config.AdminUser, []string{"spec", "admin_user"}},
+		{g.config.ImageVersion, []string{"spec", "image_version"}},
+		{g.config.PostgresImage, []string{"spec", "postgres_image"}},
+		{g.config.PostgresImageVersion, []string{"spec", "postgres_image_version"}},
+		{g.config.PostgresCPURequest, []string{"spec", "postgres_resource_requirements", "requests", "cpu"}},
+		{g.config.PostgresMemoryRequest, []string{"spec", "postgres_resource_requirements", "requests", "memory"}},
+		{g.config.PostgresCPULimit, []string{"spec", "postgres_resource_requirements", "limits", "cpu"}},
+		{g.config.PostgresMemoryLimit, []string{"spec", "postgres_resource_requirements", "limits", "memory"}},
+	}
+
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if err := unstructured.SetNestedField(obj.Object, field.value, field.path...); err != nil {
+			return err
+		}
+	}
+
+	if g.config.RedisExternal {
+		if err := unstructured.SetNestedField(obj.Object, redisSecretName(obj.GetName()), "spec", "redis_configuration_secret"); err != nil {
+			return err
+		}
+	}
+
+	if err := g.applyStorage(obj); err != nil {
+		return err
+	}
+	if g.config.Replicas > 0 {
+		if err := unstructured.SetNestedField(obj.Object, int64(g.config.Replicas), "spec", "replicas"); err != nil {
+			return err
+		}
+	}
+	if err := applyIngressTLS(obj, g.config); err != nil {
+		return err
+	}
+	if err := applyIngressAnnotations(obj, g.config); err != nil {
+		return err
+	}
+	if err := applyIngressHosts(obj, g.config); err != nil {
+		return err
+	}
+	if err := applyIngressPath(obj, g.config); err != nil {
+		return err
+	}
+
+	if err := applyProxyEnv(obj, g.config); err != nil {
+		return err
+	}
+
+	return applySecurityProfile(obj, g.config.PSSProfile)
+}
+
+// applyStorage sets the storage class and sizes of the AWX CR's volumes when
+// they are configured. An empty storage class removes the class fields, so
+// the cluster's default storage class is used.
+func (g *ManifestGenerator) applyStorage(obj *unstructured.Unstructured) error {
+	if g.config.Configured("AWX_STORAGE_CLASS") {
+		for _, field := range []string{"postgres_storage_class", "projects_storage_class"} {
+			if g.config.StorageClass == "" {
+				unstructured.RemoveNestedField(obj.Object, "spec", field)
+				continue
+			}
+			if err := unstructured.SetNestedField(obj.Object, g.config.StorageClass, "spec", field); err != nil {
+				return err
+			}
+		}
+	}
+
+	if g.config.Configured("AWX_POSTGRES_STORAGE") {
+		if err := unstructured.SetNestedField(obj.Object, g.config.PostgresStorage, "spec", "postgres_storage_requirements", "requests", "storage"); err != nil {
+			return err
+		}
+	}
+	if g.config.Configured("AWX_PROJECTS_STORAGE") {
+		if err := unstructured.SetNestedField(obj.Object, g.config.ProjectsStorage, "spec", "projects_storage_size"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestCustomizeAWXPostgres(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want map[string]string
+	}{
+		{
+			name: "manifest defaults",
+			want: map[string]string{
+				"postgres_image": "",
+				"postgres_resource_requirements.requests.cpu":    "0.5",
+				"postgres_resource_requirements.requests.memory": "2Gi",
+				"postgres_resource_requirements.limits.cpu":      "1",
+				"postgres_resource_requirements.limits.memory":   "4Gi",
+			},
+		},
+		{
+			name: "image and resources",
+			env: map[string]string{
+				"AWX_POSTGRES_IMAGE":          "quay.io/sclorg/postgresql-15-c9s",
+				"AWX_POSTGRES_IMAGE_VERSION":  "15.4",
+				"AWX_POSTGRES_CPU_REQUEST":    "250m",
+				"AWX_POSTGRES_MEMORY_REQUEST": "1Gi",
+				"AWX_POSTGRES_CPU_LIMIT":      "2",
+				"AWX_POSTGRES_MEMORY_LIMIT":   "8Gi",
+			},
+			want: map[string]string{
+				"postgres_image":                                 "quay.io/sclorg/postgresql-15-c9s",
+				"postgres_image_version":                         "15.4",
+				"postgres_resource_requirements.requests.cpu":    "250m",
+				"postgres_resource_requirements.requests.memory": "1Gi",
+				"postgres_resource_requirements.limits.cpu":      "2",
+				"postgres_resource_requirements.limits.memory":   "8Gi",
+			},
+		},
+		{
+			name: "only a limit",
+			env:  map[string]string{"AWX_POSTGRES_MEMORY_LIMIT": "6Gi"},
+			want: map[string]string{
+				"postgres_resource_requirements.requests.memory": "2Gi",
+				"postgres_resource_requirements.limits.memory":   "6Gi",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := awxManifest(t)
+			g := NewManifestGenerator(testConfig(t, tt.env), manifestsDir)
+			if err := g.customizeAWX(obj); err != nil {
+				t.Fatalf("customizeAWX() failed: %v", err)
+			}
+			for field, want := range tt.want {
+				got, _, _ := unstructured.NestedString(obj.Object, append([]string{"spec"}, splitPath(field)...)...)
+				if got != want {
+					t.Errorf("spec.%s = %q, want %q", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateImageSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// want are the expected values of fields of generated objects, by
+		// kind and path
+		want map[string]interface{}
+	}{
+		{
+			name: "defaults",
+			want: map[string]interface{}{
+				"Job spec.template.spec.containers.image":           "busybox:1.35",
+				"Job spec.template.spec.containers.imagePullPolicy": nil,
+				"AWX spec.image_pull_policy":                        nil,
+			},
+		},
+		{
+			name: "mirror and pull policy",
+			env: map[string]string{
+				"AWX_IMAGE_PULL_POLICY": "IfNotPresent",
+				"AWX_REGISTRY_MIRROR":   "docker.io=mirror.local/docker",
+			},
+			want: map[string]interface{}{
+				"Job spec.template.spec.containers.image":           "mirror.local/docker/library/busybox:1.35",
+				"Job spec.template.spec.containers.imagePullPolicy": "IfNotPresent",
+				"AWX spec.image_pull_policy":                        "IfNotPresent",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifests, err := NewManifestGenerator(testConfig(t, tt.env), manifestsDir).Generate()
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+			objects := map[string]*unstructured.Unstructured{}
+			for _, manifest := range manifests {
+				objects[manifest.Object.GetKind()] = manifest.Object
+			}
+
+			for field, want := range tt.want {
+				kind, path, _ := strings.Cut(field, " ")
+				obj, ok := objects[kind]
+				if !ok {
+					t.Fatalf("no %s generated", kind)
+				}
+				var got interface{}
+				if strings.HasPrefix(path, "spec.template.spec.containers.") {
+					containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+					got = containers[0].(map[string]interface{})[strings.TrimPrefix(path, "spec.template.spec.containers.")]
+				} else {
+					got, _, _ = unstructured.NestedFieldNoCopy(obj.Object, splitPath(path)...)
+				}
+				if got != want {
+					t.Errorf("%s = %v, want %v", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateSourceAnnotation(t *testing.T) {
+	userSet := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: pinned
+  namespace: awx
+  annotations:
+    awx-deployer/source: gitops/awx/pinned.yaml
+`
+	plain := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: awx
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: extra
+  namespace: awx
+`
+
+	tests := []struct {
+		name string
+		// files are the manifest files, by name, or the repo manifests if nil
+		files map[string]string
+		env   map[string]string
+		// want are the expected sources, by kind and name
+		want map[string]string
+	}{
+		{
+			name: "repo manifests",
+			want: map[string]string{
+				"Namespace awx":                           "01-namespace.yaml",
+				"Secret awx-admin-password":               "06-admin-secret.yaml",
+				"AWX awx-instance":                        "07-awx-instance.yaml",
+				"Job awx-fix-permissions":                 "00-fix-permissions.yaml",
+				"Secret awx-instance-redis-configuration": "",
+			},
+		},
+		{
+			name: "generated external Redis secret",
+			env:  map[string]string{"AWX_REDIS_EXTERNAL": "true", "AWX_REDIS_HOST": "redis.example.com"},
+			want: map[string]string{
+				"AWX awx-instance":                        "07-awx-instance.yaml",
+				"Secret awx-instance-redis-configuration": GeneratedSource,
+			},
+		},
+		{
+			name:  "annotation set in the manifest kept",
+			files: map[string]string{"10-settings.yaml": plain, "20-pinned.yaml": userSet},
+			want: map[string]string{
+				"ConfigMap settings": "10-settings.yaml",
+				"Secret extra":       "10-settings.yaml",
+				"ConfigMap pinned":   "gitops/awx/pinned.yaml",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := manifestsDir
+			if tt.files != nil {
+				dir = t.TempDir()
+				for name, content := range tt.files {
+					if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			cfg := testConfig(t, tt.env)
+			manifests, err := NewManifestGenerator(cfg, dir).Generate()
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+
+			sources := map[string]string{}
+			for _, manifest := range manifests {
+				obj := manifest.Object
+				sources[obj.GetKind()+" "+obj.GetName()] = obj.GetAnnotations()[SourceAnnotation]
+			}
+			for object, want := range tt.want {
+				if got := sources[object]; got != want {
+					t.Errorf("%s source = %q, want %q", object, got, want)
+				}
+			}
+
+			if tt.files == nil {
+				return
+			}
+			// The annotation is applied along with the objects
+			cluster := k8stest.NewCluster()
+			if _, err := NewManifestApplier(cluster.Client, cfg).applyAll(context.Background(), manifests); err != nil {
+				t.Fatalf("applyAll() failed: %v", err)
+			}
+			for _, manifest := range manifests {
+				obj := manifest.Object
+				live, err := cluster.Client.GetObject(context.Background(), obj)
+				if err != nil || live == nil {
+					t.Fatalf("%s %s not applied: %v", obj.GetKind(), obj.GetName(), err)
+				}
+				want := tt.want[obj.GetKind()+" "+obj.GetName()]
+				if got := live.GetAnnotations()[SourceAnnotation]; got != want {
+					t.Errorf("applied %s %s source = %q, want %q", obj.GetKind(), obj.GetName(), got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// ClusterGuard refuses to work on a cluster other than the intended one, so
+// that a stale kubeconfig context does not deploy into production
+type ClusterGuard struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewClusterGuard creates a new cluster guard
+func NewClusterGuard(k8sClient *k8s.KubernetesClient, config *config.Config) *ClusterGuard {
+	return &ClusterGuard{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Check fails when the kubeconfig context in use is not AWX_CONFIRM_CONTEXT
+// or the cluster does not match AWX_EXPECTED_CLUSTER. Either check is skipped
+// when its setting is empty.
+func (g *ClusterGuard) Check(ctx context.Context) error {
+	if g.config.ConfirmContext != "" {
+		actual := g.k8sClient.ContextName()
+		if actual == "" {
+			actual = "none (in-cluster config)"
+		}
+		if actual != g.config.ConfirmContext {
+			return fmt.Errorf("kubeconfig context is %s, AWX_CONFIRM_CONTEXT expects %s", actual, g.config.ConfirmContext)
+		}
+		log.Printf("✓ Kubeconfig context %s confirmed", actual)
+	}
+
+	if g.config.ExpectedCluster == "" {
+		return nil
+	}
+	expected, err := config.ParseClusterExpectation(g.config.ExpectedCluster)
+	if err != nil {
+		return err
+	}
+	actual, err := g.actual(ctx, expected)
+	if err != nil {
+		return fmt.Errorf("could not identify the cluster: %v", err)
+	}
+	if actual != expected.String() {
+		return fmt.Errorf("connected to a cluster with %s, AWX_EXPECTED_CLUSTER expects %s", actual, expected)
+	}
+	log.Printf("✓ Connected to the expected cluster (%s)", expected)
+	return nil
+}
+
+// actual describes the connected cluster the way the expectation is written,
+// so that the two compare equal exactly when the cluster matches
+func (g *ClusterGuard) actual(ctx context.Context, expected config.ClusterExpectation) (string, error) {
+	switch expected.Kind {
+	case config.ExpectNodeLabel:
+		nodes, err := g.k8sClient.ListNodes(ctx)
+		if err != nil {
+			return "", err
+		}
+		if len(nodes) == 0 {
+			return "no nodes", nil
+		}
+		// Every node must carry the label, report the values found otherwise
+		values := map[string]bool{}
+		for _, node := range nodes {
+			value, ok := node.Labels[expected.Key]
+			if !ok {
+				value = "<unset>"
+			}
+			values[value] = true
+		}
+		if len(values) == 1 && values[expected.Value] {
+			return expected.String(), nil
+		}
+		return fmt.Sprintf("node label %s=%s", expected.Key, strings.Join(sortedNames(values), ",")), nil
+	case config.ExpectConfigMap:
+		configMap, err := g.k8sClient.GetResource(ctx, "", "v1", "configmaps", expected.Name, expected.Namespace)
+		if err != nil {
+			return "", err
+		}
+		value, ok, _ := unstructured.NestedString(configMap.Object, "data", expected.Key)
+		if !ok {
+			value = "<unset>"
+		}
+		return config.ClusterExpectation{Kind: config.ExpectConfigMap, Namespace: expected.Namespace, Name: expected.Name, Key: expected.Key, Value: value}.String(), nil
+	}
+	return config.ClusterExpectation{Kind: config.ExpectServer, Server: strings.TrimSuffix(g.k8sClient.Server(), "/")}.String(), nil
+}
@@ -0,0 +1,134 @@
+package deploy
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// labeledNode returns a node with the given labels
+func labeledNode(name string, labels map[string]string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestClusterGuardCheck(t *testing.T) {
+	prodNode := func(name string) *corev1.Node { return labeledNode(name, map[string]string{"cluster": "prod-sin"}) }
+	clusterInfo := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-info", Namespace: "kube-public"},
+		Data:       map[string]string{"name": "staging"},
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		// kubeconfig connects with testdata/kubeconfig/west.yaml of the k8s
+		// package instead of a fake cluster holding objects
+		kubeconfig bool
+		objects    []runtime.Object
+		wantErr    string
+	}{
+		{
+			name:       "no expectation",
+			kubeconfig: true,
+		},
+		{
+			name:       "server matches",
+			env:        map[string]string{"AWX_EXPECTED_CLUSTER": "https://west.example.com:6443/"},
+			kubeconfig: true,
+		},
+		{
+			name:       "server differs",
+			env:        map[string]string{"AWX_EXPECTED_CLUSTER": "https://prod.example.com:6443"},
+			kubeconfig: true,
+			wantErr:    "connected to a cluster with server https://west.example.com:6443, AWX_EXPECTED_CLUSTER expects server https://prod.example.com:6443",
+		},
+		{
+			name:       "context confirmed",
+			env:        map[string]string{"AWX_CONFIRM_CONTEXT": "west"},
+			kubeconfig: true,
+		},
+		{
+			name:       "other context",
+			env:        map[string]string{"AWX_CONFIRM_CONTEXT": "east"},
+			kubeconfig: true,
+			wantErr:    "kubeconfig context is west, AWX_CONFIRM_CONTEXT expects east",
+		},
+		{
+			name:    "context to confirm in-cluster",
+			env:     map[string]string{"AWX_CONFIRM_CONTEXT": "east"},
+			wantErr: "kubeconfig context is none (in-cluster config), AWX_CONFIRM_CONTEXT expects east",
+		},
+		{
+			name:    "every node labeled",
+			env:     map[string]string{"AWX_EXPECTED_CLUSTER": "label:cluster=prod-sin"},
+			objects: []runtime.Object{prodNode("node-1"), prodNode("node-2")},
+		},
+		{
+			name:    "node labeled otherwise",
+			env:     map[string]string{"AWX_EXPECTED_CLUSTER": "label:cluster=prod-sin"},
+			objects: []runtime.Object{prodNode("node-1"), labeledNode("node-2", map[string]string{"cluster": "staging"}), labeledNode("node-3", nil)},
+			wantErr: "connected to a cluster with node label cluster=<unset>,prod-sin,staging, AWX_EXPECTED_CLUSTER expects node label cluster=prod-sin",
+		},
+		{
+			name:    "no nodes",
+			env:     map[string]string{"AWX_EXPECTED_CLUSTER": "label:cluster=prod-sin"},
+			wantErr: "connected to a cluster with no nodes",
+		},
+		{
+			name:    "config map matches",
+			env:     map[string]string{"AWX_EXPECTED_CLUSTER": "configmap:kube-public/cluster-info/name=staging"},
+			objects: []runtime.Object{clusterInfo},
+		},
+		{
+			name:    "config map differs",
+			env:     map[string]string{"AWX_EXPECTED_CLUSTER": "configmap:kube-public/cluster-info/name=prod"},
+			objects: []runtime.Object{clusterInfo},
+			wantErr: "connected to a cluster with config map kube-public/cluster-info key name=staging, AWX_EXPECTED_CLUSTER expects config map kube-public/cluster-info key name=prod",
+		},
+		{
+			name:    "config map key missing",
+			env:     map[string]string{"AWX_EXPECTED_CLUSTER": "configmap:kube-public/cluster-info/id=prod"},
+			objects: []runtime.Object{clusterInfo},
+			wantErr: "key id=<unset>",
+		},
+		{
+			name:    "config map missing",
+			env:     map[string]string{"AWX_EXPECTED_CLUSTER": "configmap:kube-public/cluster-id/name=prod"},
+			wantErr: "could not identify the cluster",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client *k8s.KubernetesClient
+			if tt.kubeconfig {
+				var err error
+				client, err = k8s.NewKubernetesClient(filepath.Join("..", "k8s", "testdata", "kubeconfig", "west.yaml"), "", true)
+				if err != nil {
+					t.Fatalf("NewKubernetesClient() failed: %v", err)
+				}
+			} else {
+				client = k8stest.NewCluster(tt.objects...).Client
+			}
+
+			err := NewClusterGuard(client, testConfig(t, tt.env)).Check(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Check() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"awx-deployer/internal/events"
+)
+
+// waitHint is guidance given once a share of the wait timeout has passed
+// without the deployment becoming ready, along with the signals found for it
+type waitHint struct {
+	fraction float64
+	message  string
+	signals  func(*DeploymentWaiter, context.Context) []string
+}
+
+// waitHints escalate from slow image pulls over storage and scheduling to
+// the operator itself
+var waitHints = []waitHint{
+	{0.25, "still pulling images?", (*DeploymentWaiter).imagePullSignals},
+	{0.50, "check PVC binding and pod scheduling", (*DeploymentWaiter).schedulingSignals},
+	{0.75, "check the operator logs for reconcile errors", (*DeploymentWaiter).operatorSignals},
+}
+
+// hintCheckInterval is how often the elapsed time is compared to the hints
+const hintCheckInterval = 10 * time.Second
+
+// hintSchedule hands out the hints that are due, each once
+type hintSchedule struct {
+	timeout time.Duration
+	next    int
+}
+
+// due returns the hints whose share of the timeout has passed after elapsed
+// time that were not returned before
+func (s *hintSchedule) due(elapsed time.Duration) []waitHint {
+	var due []waitHint
+	for s.next < len(waitHints) && elapsed >= time.Duration(float64(s.timeout)*waitHints[s.next].fraction) {
+		due = append(due, waitHints[s.next])
+		s.next++
+	}
+	return due
+}
+
+// giveHints logs the wait hints as they become due until ctx is done
+func (d *DeploymentWaiter) giveHints(ctx context.Context, timeout time.Duration) {
+	start := d.now()
+	schedule := &hintSchedule{timeout: timeout}
+
+	ticker := time.NewTicker(hintCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, hint := range schedule.due(d.now().Sub(start)) {
+			log.Printf("Hint: %.0f%% of the %v timeout passed, %s", hint.fraction*100, timeout, hint.message)
+			events.Progressf(ctx, "hint: %s", hint.message)
+
+			signals := hint.signals(d, ctx)
+			if len(signals) == 0 {
+				log.Println("  nothing found that points to it yet")
+			}
+			for _, signal := range signals {
+				log.Printf("  - %s", signal)
+			}
+		}
+	}
+}
+
+// imagePullSignals lists containers still waiting for their image or to be
+// created
+func (d *DeploymentWaiter) imagePullSignals(ctx context.Context) []string {
+	pods, err := d.k8sClient.ListPods(ctx, "", d.config.Namespace)
+	if err != nil {
+		return []string{fmt.Sprintf("could not list pods: %v", err)}
+	}
+
+	var signals []string
+	for _, pod := range pods {
+		for _, cs := range pod.Status.ContainerStatuses {
+			waiting := cs.State.Waiting
+			if waiting == nil {
+				continue
+			}
+			switch waiting.Reason {
+			case "ContainerCreating", "PodInitializing", "ErrImagePull", "ImagePullBackOff":
+				signals = append(signals, fmt.Sprintf("pod %s container %s is waiting: %s %s", pod.Name, cs.Name, waiting.Reason, waiting.Message))
+			}
+		}
+	}
+	return signals
+}
+
+// schedulingSignals lists unbound persistent volume claims and pods that
+// cannot be scheduled
+func (d *DeploymentWaiter) schedulingSignals(ctx context.Context) []string {
+	var signals []string
+
+	pvcs, err := d.k8sClient.ListPersistentVolumeClaims(ctx, d.config.Namespace)
+	if err != nil {
+		signals = append(signals, fmt.Sprintf("could not list persistent volume claims: %v", err))
+	}
+	for _, pvc := range pvcs {
+		if pvc.Status.Phase != corev1.ClaimBound {
+			signals = append(signals, fmt.Sprintf("persistent volume claim %s is %s, check storage class %s", pvc.Name, pvc.Status.Phase, d.config.StorageClass))
+		}
+	}
+
+	failed, err := d.k8sClient.ListEvents(ctx, "reason=FailedScheduling", d.config.Namespace)
+	if err != nil {
+		signals = append(signals, fmt.Sprintf("could not list events: %v", err))
+	}
+	reported := make(map[string]bool)
+	for _, event := range failed {
+		if reported[event.InvolvedObject.Name] {
+			continue
+		}
+		reported[event.InvolvedObject.Name] = true
+		signals = append(signals, fmt.Sprintf("pod %s cannot be scheduled: %s", event.InvolvedObject.Name, event.Message))
+	}
+	return signals
+}
+
+// operatorSignals reports an operator that is not ready and failed tasks
+// in its logs
+func (d *DeploymentWaiter) operatorSignals(ctx context.Context) []string {
+	status, err := d.k8sClient.GetPodStatus(ctx, d.config.OperatorPodSelector, d.config.OperatorNamespace)
+	if err != nil {
+		return []string{fmt.Sprintf("could not get operator pod status: %v", err)}
+	}
+	if !status.Ready() {
+		return []string{fmt.Sprintf("AWX operator is not ready (status: %s)", status)}
+	}
+
+	logs, err := d.k8sClient.GetPodLogsSince(ctx, d.config.OperatorPodSelector, d.config.OperatorNamespace, operatorContainer, operatorLogTailLines, d.timing.AppliedAt)
+	if err != nil {
+		return []string{fmt.Sprintf("could not read operator logs: %v", err)}
+	}
+	if failures, last := findReconcileFailures(logs, d.config.Namespace, d.config.AWXName); failures > 0 {
+		return []string{fmt.Sprintf("operator logs show %d failed reconcile tasks, last: %s", failures, last)}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestHintSchedule(t *testing.T) {
+	timeout := 40 * time.Minute
+
+	tests := []struct {
+		name string
+		// elapsed are the times the fake clock is read at, in order
+		elapsed []time.Duration
+		// want are the hints due at each time, by fraction
+		want [][]float64
+	}{
+		{
+			name:    "each hint at its threshold",
+			elapsed: []time.Duration{0, 9*time.Minute + 59*time.Second, 10 * time.Minute, 19 * time.Minute, 20 * time.Minute, 30 * time.Minute, 40 * time.Minute},
+			want:    [][]float64{nil, nil, {0.25}, nil, {0.50}, {0.75}, nil},
+		},
+		{
+			name:    "hints are given once",
+			elapsed: []time.Duration{11 * time.Minute, 12 * time.Minute, 13 * time.Minute},
+			want:    [][]float64{{0.25}, nil, nil},
+		},
+		{
+			name:    "overdue hints come together",
+			elapsed: []time.Duration{5 * time.Minute, 35 * time.Minute},
+			want:    [][]float64{nil, {0.25, 0.50, 0.75}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			clock := start
+			schedule := &hintSchedule{timeout: timeout}
+
+			for i, elapsed := range tt.elapsed {
+				clock = start.Add(elapsed)
+				var fractions []float64
+				for _, hint := range schedule.due(clock.Sub(start)) {
+					fractions = append(fractions, hint.fraction)
+				}
+				if !reflect.DeepEqual(fractions, tt.want[i]) {
+					t.Errorf("due(%v) = %v, want %v", elapsed, fractions, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWaitHintSignals(t *testing.T) {
+	web := instanceDeployment("awx", "awx-instance", "web")
+	pulling := workloadPod(web, "awx-web-1", corev1.ContainerStatus{
+		Name:  "awx-web",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}},
+	})
+	crashing := workloadPod(web, "awx-web-2", corev1.ContainerStatus{
+		Name:  "awx-web",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+	})
+	pendingClaim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres-15-awx-instance-postgres-15-0", Namespace: "awx"},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+	}
+	boundClaim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "projects", Namespace: "awx"},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+	unschedulable := podEvent("awx-instance-postgres-15-0", "FailedScheduling", "0/3 nodes are available: 3 Insufficient memory.")
+	unschedulableAgain := podEvent("awx-instance-postgres-15-0", "FailedScheduling", "0/3 nodes are available: 3 Insufficient memory.")
+	unschedulableAgain.Name += ".2"
+
+	notReadyOperator := operatorObjects("awx")
+	notReadyOperator[4].(*corev1.Pod).Status.Conditions[0].Status = corev1.ConditionFalse
+
+	tests := []struct {
+		name        string
+		objects     []runtime.Object
+		fraction    float64
+		wantSignals []string
+	}{
+		{
+			name:        "image pull back-off",
+			objects:     []runtime.Object{pulling, crashing},
+			fraction:    0.25,
+			wantSignals: []string{"pod awx-web-1 container awx-web is waiting: ImagePullBackOff Back-off pulling image"},
+		},
+		{
+			name:     "images pulled",
+			objects:  []runtime.Object{crashing},
+			fraction: 0.25,
+		},
+		{
+			name:     "pending claim and unschedulable pod",
+			objects:  []runtime.Object{pendingClaim, boundClaim, unschedulable, unschedulableAgain},
+			fraction: 0.50,
+			wantSignals: []string{
+				"persistent volume claim postgres-15-awx-instance-postgres-15-0 is Pending, check storage class fast",
+				"pod awx-instance-postgres-15-0 cannot be scheduled: 0/3 nodes are available: 3 Insufficient memory.",
+			},
+		},
+		{
+			name:     "storage bound and pods scheduled",
+			objects:  []runtime.Object{boundClaim},
+			fraction: 0.50,
+		},
+		{
+			name:        "operator not ready",
+			objects:     notReadyOperator,
+			fraction:    0.75,
+			wantSignals: []string{"AWX operator is not ready"},
+		},
+		{
+			name:     "operator ready without failures",
+			objects:  operatorObjects("awx"),
+			fraction: 0.75,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{
+				"AWX_NAMESPACE":          "awx",
+				"AWX_OPERATOR_NAMESPACE": "awx",
+				"AWX_STORAGE_CLASS":      "fast",
+			})
+			cluster := k8stest.NewCluster(tt.objects...)
+			waiter := NewDeploymentWaiter(cluster.Client, cfg)
+
+			var hint *waitHint
+			for i := range waitHints {
+				if waitHints[i].fraction == tt.fraction {
+					hint = &waitHints[i]
+				}
+			}
+			if hint == nil {
+				t.Fatalf("no hint at %v of the timeout", tt.fraction)
+			}
+
+			signals := hint.signals(waiter, context.Background())
+			if len(signals) != len(tt.wantSignals) {
+				t.Fatalf("signals = %q, want %q", signals, tt.wantSignals)
+			}
+			for i, want := range tt.wantSignals {
+				if !strings.Contains(signals[i], want) {
+					t.Errorf("signal %d = %q, want %q", i, signals[i], want)
+				}
+			}
+		})
+	}
+}
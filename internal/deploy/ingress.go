@@ -0,0 +1,180 @@
+package deploy
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"awx-deployer/internal/config"
+)
+
+const (
+	// certIssuerAnnotation asks cert-manager to issue the ingress TLS secret
+	certIssuerAnnotation = "cert-manager.io/cluster-issuer"
+)
+
+// sslRedirectAnnotations make the nginx ingress controller redirect HTTP to HTTPS
+var sslRedirectAnnotations = []string{
+	"nginx.ingress.kubernetes.io/ssl-redirect",
+	"nginx.ingress.kubernetes.io/force-ssl-redirect",
+}
+
+// applyIngressTLS sets the TLS secret and the cert-manager and redirect
+// annotations of the AWX ingress, or removes them when TLS is disabled. The
+// cert-manager annotation is removed when the secret comes from certificate
+// files, so cert-manager does not overwrite it. The manifest is left alone
+// unless a TLS setting is configured.
+func applyIngressTLS(obj *unstructured.Unstructured, cfg *config.Config) error {
+	if !cfg.Configured("AWX_TLS") && !cfg.Configured("AWX_TLS_SECRET") && !cfg.Configured("AWX_CERT_ISSUER") && cfg.TLSCertFile == "" {
+		return nil
+	}
+
+	annotations, err := ingressAnnotations(obj)
+	if err != nil {
+		return err
+	}
+
+	if cfg.TLS {
+		if err := unstructured.SetNestedField(obj.Object, cfg.TLSSecretName, "spec", "ingress_tls_secret"); err != nil {
+			return err
+		}
+		if cfg.TLSCertFile != "" {
+			delete(annotations, certIssuerAnnotation)
+		} else if cfg.CertIssuer != "" {
+			annotations[certIssuerAnnotation] = cfg.CertIssuer
+		}
+		for _, annotation := range sslRedirectAnnotations {
+			annotations[annotation] = "true"
+		}
+	} else {
+		unstructured.RemoveNestedField(obj.Object, "spec", "ingress_tls_secret")
+		delete(annotations, certIssuerAnnotation)
+		for _, annotation := range sslRedirectAnnotations {
+			delete(annotations, annotation)
+		}
+	}
+	return setIngressAnnotations(obj, annotations)
+}
+
+// ingressControllerAnnotations returns the annotations AWX_INGRESS_CONTROLLER
+// fills in: a body size limit fitting large project and inventory imports
+// for nginx, the entrypoint for traefik and an internet-facing load balancer
+// checking the AWX ping endpoint, under AWX_INGRESS_PATH, for the AWS load
+// balancer controller
+func ingressControllerAnnotations(cfg *config.Config) map[string]string {
+	switch cfg.IngressController {
+	case "nginx":
+		return map[string]string{
+			"nginx.ingress.kubernetes.io/proxy-body-size":    "100m",
+			"nginx.ingress.kubernetes.io/proxy-read-timeout": "300",
+		}
+	case "traefik":
+		if cfg.TLS {
+			return map[string]string{
+				"traefik.ingress.kubernetes.io/router.entrypoints": "websecure",
+				"traefik.ingress.kubernetes.io/router.tls":         "true",
+			}
+		}
+		return map[string]string{"traefik.ingress.kubernetes.io/router.entrypoints": "web"}
+	case "alb":
+		annotations := map[string]string{
+			"alb.ingress.kubernetes.io/scheme":           "internet-facing",
+			"alb.ingress.kubernetes.io/target-type":      "ip",
+			"alb.ingress.kubernetes.io/healthcheck-path": cfg.IngressPath + "/api/v2/ping/",
+			"alb.ingress.kubernetes.io/listen-ports":     `[{"HTTP": 80}]`,
+		}
+		if cfg.TLS {
+			annotations["alb.ingress.kubernetes.io/listen-ports"] = `[{"HTTP": 80}, {"HTTPS": 443}]`
+			annotations["alb.ingress.kubernetes.io/ssl-redirect"] = "443"
+		}
+		return annotations
+	}
+	return nil
+}
+
+// applyIngressAnnotations merges the annotations of AWX_INGRESS_CONTROLLER
+// and then AWX_INGRESS_ANNOTATIONS onto spec.ingress_annotations, so that
+// configured annotations win over the controller's and both over the
+// manifest's
+func applyIngressAnnotations(obj *unstructured.Unstructured, cfg *config.Config) error {
+	if cfg.IngressController == "" && len(cfg.IngressAnnotations) == 0 {
+		return nil
+	}
+
+	annotations, err := ingressAnnotations(obj)
+	if err != nil {
+		return err
+	}
+	for key, value := range ingressControllerAnnotations(cfg) {
+		annotations[key] = value
+	}
+	for key, value := range cfg.IngressAnnotationMap() {
+		annotations[key] = value
+	}
+	return setIngressAnnotations(obj, annotations)
+}
+
+// ingressAnnotations parses spec.ingress_annotations of the AWX CR, which the
+// operator takes as a YAML string
+func ingressAnnotations(obj *unstructured.Unstructured) (map[string]string, error) {
+	annotations := map[string]string{}
+	if existing, _, _ := unstructured.NestedString(obj.Object, "spec", "ingress_annotations"); existing != "" {
+		if err := yaml.Unmarshal([]byte(existing), &annotations); err != nil {
+			return nil, fmt.Errorf("failed to parse spec.ingress_annotations: %v", err)
+		}
+	}
+	return annotations, nil
+}
+
+// setIngressAnnotations writes spec.ingress_annotations, removing the field
+// when there are none
+func setIngressAnnotations(obj *unstructured.Unstructured, annotations map[string]string) error {
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "spec", "ingress_annotations")
+		return nil
+	}
+	data, err := yaml.Marshal(annotations)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(obj.Object, string(data), "spec", "ingress_annotations")
+}
+
+// applyIngressHosts lists AWX_HOSTNAME and AWX_HOSTNAME_ALIASES in
+// spec.ingress_hosts when aliases are configured, so that the operator
+// creates an ingress rule and a TLS entry for each host. The deprecated
+// hostname and ingress_tls_secret fields give way to the list, each host
+// uses the TLS secret they named.
+func applyIngressHosts(obj *unstructured.Unstructured, cfg *config.Config) error {
+	if len(cfg.AWXHostnameAliases) == 0 {
+		return nil
+	}
+
+	tlsSecret, _, _ := unstructured.NestedString(obj.Object, "spec", "ingress_tls_secret")
+	var hosts []interface{}
+	for _, hostname := range cfg.Hostnames() {
+		host := map[string]interface{}{"hostname": hostname}
+		if tlsSecret != "" {
+			host["tls_secret"] = tlsSecret
+		}
+		hosts = append(hosts, host)
+	}
+
+	unstructured.RemoveNestedField(obj.Object, "spec", "hostname")
+	unstructured.RemoveNestedField(obj.Object, "spec", "ingress_tls_secret")
+	return unstructured.SetNestedSlice(obj.Object, hosts, "spec", "ingress_hosts")
+}
+
+// applyIngressPath serves AWX under AWX_INGRESS_PATH by setting ingress_path
+// of the AWX CR, from which the operator builds the path of each ingress
+// rule. The path type is Prefix so that everything below the path matches.
+func applyIngressPath(obj *unstructured.Unstructured, cfg *config.Config) error {
+	if cfg.IngressPath == "" {
+		return nil
+	}
+	if err := unstructured.SetNestedField(obj.Object, cfg.IngressPath, "spec", "ingress_path"); err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(obj.Object, "Prefix", "spec", "ingress_path_type")
+}
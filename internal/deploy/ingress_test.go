@@ -0,0 +1,287 @@
+package deploy
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplyIngressTLS(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeKeyPair(t, dir, "awx.example.com")
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantIssuer string
+		wantSecret string
+		wantSSL    bool
+	}{
+		{
+			name:       "manifest unchanged",
+			wantIssuer: "letsencrypt-prod",
+			wantSecret: "awx-tls",
+			wantSSL:    true,
+		},
+		{
+			name:       "cert-manager issuer",
+			env:        map[string]string{"AWX_CERT_ISSUER": "letsencrypt-staging"},
+			wantIssuer: "letsencrypt-staging",
+			wantSecret: "awx-tls",
+			wantSSL:    true,
+		},
+		{
+			name:       "certificate files drop the issuer",
+			env:        map[string]string{"AWX_TLS_CERT_FILE": cert, "AWX_TLS_KEY_FILE": key},
+			wantSecret: "awx-tls",
+			wantSSL:    true,
+		},
+		{
+			name:       "certificate files with a configured issuer",
+			env:        map[string]string{"AWX_TLS_CERT_FILE": cert, "AWX_TLS_KEY_FILE": key, "AWX_CERT_ISSUER": "letsencrypt-prod", "AWX_TLS_SECRET": "custom-tls"},
+			wantSecret: "custom-tls",
+			wantSSL:    true,
+		},
+		{
+			name: "TLS disabled",
+			env:  map[string]string{"AWX_TLS": "false"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, tt.env)
+			obj := awxManifest(t)
+			if err := applyIngressTLS(obj, cfg); err != nil {
+				t.Fatalf("applyIngressTLS() failed: %v", err)
+			}
+
+			annotations, err := ingressAnnotations(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := annotations[certIssuerAnnotation]; got != tt.wantIssuer {
+				t.Errorf("%s = %q, want %q", certIssuerAnnotation, got, tt.wantIssuer)
+			}
+			if got, _, _ := unstructured.NestedString(obj.Object, "spec", "ingress_tls_secret"); got != tt.wantSecret {
+				t.Errorf("spec.ingress_tls_secret = %q, want %q", got, tt.wantSecret)
+			}
+			for _, annotation := range sslRedirectAnnotations {
+				if _, ok := annotations[annotation]; ok != tt.wantSSL {
+					t.Errorf("%s set = %v, want %v", annotation, ok, tt.wantSSL)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyIngressHosts(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// wantHostname is spec.hostname, left alone without aliases
+		wantHostname string
+		wantHosts    []interface{}
+	}{
+		{
+			name:         "no aliases",
+			env:          map[string]string{"AWX_HOSTNAME": "awx.example.com"},
+			wantHostname: "awx.sin.padminisys.com",
+		},
+		{
+			name: "aliases with TLS",
+			env:  map[string]string{"AWX_HOSTNAME": "awx.example.com", "AWX_HOSTNAME_ALIASES": "awx.internal.example.com, awx-sin.example.com"},
+			wantHosts: []interface{}{
+				map[string]interface{}{"hostname": "awx.example.com", "tls_secret": "awx-tls"},
+				map[string]interface{}{"hostname": "awx.internal.example.com", "tls_secret": "awx-tls"},
+				map[string]interface{}{"hostname": "awx-sin.example.com", "tls_secret": "awx-tls"},
+			},
+		},
+		{
+			name: "aliases without TLS",
+			env:  map[string]string{"AWX_HOSTNAME": "awx.example.com", "AWX_HOSTNAME_ALIASES": "awx.internal.example.com", "AWX_TLS": "false"},
+			wantHosts: []interface{}{
+				map[string]interface{}{"hostname": "awx.example.com"},
+				map[string]interface{}{"hostname": "awx.internal.example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, tt.env)
+			obj := awxManifest(t)
+			if err := applyIngressTLS(obj, cfg); err != nil {
+				t.Fatalf("applyIngressTLS() failed: %v", err)
+			}
+			if err := applyIngressHosts(obj, cfg); err != nil {
+				t.Fatalf("applyIngressHosts() failed: %v", err)
+			}
+
+			if got, _, _ := unstructured.NestedString(obj.Object, "spec", "hostname"); got != tt.wantHostname {
+				t.Errorf("spec.hostname = %q, want %q", got, tt.wantHostname)
+			}
+			hosts, _, _ := unstructured.NestedSlice(obj.Object, "spec", "ingress_hosts")
+			if !reflect.DeepEqual(hosts, tt.wantHosts) {
+				t.Errorf("spec.ingress_hosts = %v, want %v", hosts, tt.wantHosts)
+			}
+			if tt.wantHosts != nil {
+				if _, found, _ := unstructured.NestedString(obj.Object, "spec", "ingress_tls_secret"); found {
+					t.Error("spec.ingress_tls_secret kept next to spec.ingress_hosts")
+				}
+			}
+		})
+	}
+}
+
+func TestApplyIngressPath(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		wantPath     string
+		wantPathType string
+	}{
+		{name: "served at the root"},
+		{name: "subpath", path: "/awx", wantPath: "/awx", wantPathType: "Prefix"},
+		{name: "subpath with a trailing slash", path: "/tools/awx/", wantPath: "/tools/awx", wantPathType: "Prefix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{"AWX_INGRESS_PATH": tt.path})
+			obj := awxManifest(t)
+			if err := applyIngressPath(obj, cfg); err != nil {
+				t.Fatalf("applyIngressPath() failed: %v", err)
+			}
+
+			if got, _, _ := unstructured.NestedString(obj.Object, "spec", "ingress_path"); got != tt.wantPath {
+				t.Errorf("spec.ingress_path = %q, want %q", got, tt.wantPath)
+			}
+			if got, _, _ := unstructured.NestedString(obj.Object, "spec", "ingress_path_type"); got != tt.wantPathType {
+				t.Errorf("spec.ingress_path_type = %q, want %q", got, tt.wantPathType)
+			}
+		})
+	}
+}
+
+func TestApplyIngressAnnotations(t *testing.T) {
+	// manifest are the annotations of the repository's AWX manifest
+	manifest := map[string]string{
+		"cert-manager.io/cluster-issuer":                 "letsencrypt-prod",
+		"nginx.ingress.kubernetes.io/ssl-redirect":       "true",
+		"nginx.ingress.kubernetes.io/force-ssl-redirect": "true",
+	}
+	// withManifest returns the manifest annotations plus the given ones
+	withManifest := func(annotations map[string]string) map[string]string {
+		merged := map[string]string{}
+		for key, value := range manifest {
+			merged[key] = value
+		}
+		for key, value := range annotations {
+			merged[key] = value
+		}
+		return merged
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want map[string]string
+	}{
+		{
+			name: "no controller",
+			want: manifest,
+		},
+		{
+			name: "nginx",
+			env:  map[string]string{"AWX_INGRESS_CONTROLLER": "nginx"},
+			want: withManifest(map[string]string{
+				"nginx.ingress.kubernetes.io/proxy-body-size":    "100m",
+				"nginx.ingress.kubernetes.io/proxy-read-timeout": "300",
+			}),
+		},
+		{
+			name: "traefik with TLS",
+			env:  map[string]string{"AWX_INGRESS_CONTROLLER": "traefik"},
+			want: withManifest(map[string]string{
+				"traefik.ingress.kubernetes.io/router.entrypoints": "websecure",
+				"traefik.ingress.kubernetes.io/router.tls":         "true",
+			}),
+		},
+		{
+			name: "traefik without TLS",
+			env:  map[string]string{"AWX_INGRESS_CONTROLLER": "traefik", "AWX_TLS": "false"},
+			want: map[string]string{"traefik.ingress.kubernetes.io/router.entrypoints": "web"},
+		},
+		{
+			name: "alb with TLS",
+			env:  map[string]string{"AWX_INGRESS_CONTROLLER": "alb"},
+			want: withManifest(map[string]string{
+				"alb.ingress.kubernetes.io/scheme":           "internet-facing",
+				"alb.ingress.kubernetes.io/target-type":      "ip",
+				"alb.ingress.kubernetes.io/healthcheck-path": "/api/v2/ping/",
+				"alb.ingress.kubernetes.io/listen-ports":     `[{"HTTP": 80}, {"HTTPS": 443}]`,
+				"alb.ingress.kubernetes.io/ssl-redirect":     "443",
+			}),
+		},
+		{
+			name: "alb without TLS",
+			env:  map[string]string{"AWX_INGRESS_CONTROLLER": "alb", "AWX_TLS": "false"},
+			want: map[string]string{
+				"alb.ingress.kubernetes.io/scheme":           "internet-facing",
+				"alb.ingress.kubernetes.io/target-type":      "ip",
+				"alb.ingress.kubernetes.io/healthcheck-path": "/api/v2/ping/",
+				"alb.ingress.kubernetes.io/listen-ports":     `[{"HTTP": 80}]`,
+			},
+		},
+		{
+			name: "alb health check under the ingress path",
+			env:  map[string]string{"AWX_INGRESS_CONTROLLER": "alb", "AWX_TLS": "false", "AWX_INGRESS_PATH": "/awx"},
+			want: map[string]string{
+				"alb.ingress.kubernetes.io/scheme":           "internet-facing",
+				"alb.ingress.kubernetes.io/target-type":      "ip",
+				"alb.ingress.kubernetes.io/healthcheck-path": "/awx/api/v2/ping/",
+				"alb.ingress.kubernetes.io/listen-ports":     `[{"HTTP": 80}]`,
+			},
+		},
+		{
+			name: "configured annotations win over the controller's",
+			env: map[string]string{
+				"AWX_INGRESS_CONTROLLER":  "nginx",
+				"AWX_INGRESS_ANNOTATIONS": "nginx.ingress.kubernetes.io/proxy-body-size=0; example.com/owner = platform",
+			},
+			want: withManifest(map[string]string{
+				"nginx.ingress.kubernetes.io/proxy-body-size":    "0",
+				"nginx.ingress.kubernetes.io/proxy-read-timeout": "300",
+				"example.com/owner":                              "platform",
+			}),
+		},
+		{
+			name: "configured annotations win over the manifest's",
+			env:  map[string]string{"AWX_INGRESS_ANNOTATIONS": "cert-manager.io/cluster-issuer=internal-ca"},
+			want: withManifest(map[string]string{"cert-manager.io/cluster-issuer": "internal-ca"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, tt.env)
+			obj := awxManifest(t)
+			if err := applyIngressTLS(obj, cfg); err != nil {
+				t.Fatalf("applyIngressTLS() failed: %v", err)
+			}
+			if err := applyIngressAnnotations(obj, cfg); err != nil {
+				t.Fatalf("applyIngressAnnotations() failed: %v", err)
+			}
+
+			annotations, err := ingressAnnotations(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(annotations, tt.want) {
+				t.Errorf("ingress annotations = %v, want %v", annotations, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// InstanceResult is the verification outcome of one AWX instance, Err is nil
+// if it passed
+type InstanceResult struct {
+	Name string
+	Err  error
+	// Version is the AWX version found running, empty if not determined
+	Version string
+}
+
+// VerifyInstances verifies every AWX instance in the AWX namespace whose
+// labels match AWX_INSTANCE_SELECTOR, one after the other with the checks
+// the configured instance gets, and logs a report with the outcome of each.
+// The operator's objects of each instance are found by their owner
+// reference and labels, and its API at the host of its own spec. It fails if
+// any instance fails or none matches.
+func (v *DeploymentVerifier) VerifyInstances(ctx context.Context) ([]InstanceResult, error) {
+	gvk := schema.GroupVersionKind{Group: k8s.AWXGroup, Version: v.k8sClient.AWXVersion(ctx), Kind: k8s.AWXKind}
+	instances, err := v.k8sClient.ListObjects(ctx, gvk, v.config.Namespace, v.config.InstanceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list AWX instances: %v", err)
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no AWX instance in namespace %s matches AWX_INSTANCE_SELECTOR %s", v.config.Namespace, v.config.InstanceSelector)
+	}
+
+	names := make([]string, 0, len(instances))
+	byName := make(map[string]*unstructured.Unstructured, len(instances))
+	for i := range instances {
+		names = append(names, instances[i].GetName())
+		byName[instances[i].GetName()] = &instances[i]
+	}
+	sort.Strings(names)
+	log.Printf("Verifying %d AWX instances matching %s: %s", len(names), v.config.InstanceSelector, strings.Join(names, ", "))
+
+	var results []InstanceResult
+	var failed []string
+	for i, name := range names {
+		log.Printf("Verifying AWX instance %s (%d of %d)...", name, i+1, len(names))
+		verifier := NewDeploymentVerifier(v.k8sClient, v.instanceConfig(byName[name]))
+		err := verifier.Verify(ctx)
+		results = append(results, InstanceResult{Name: name, Err: err, Version: verifier.RunningVersion()})
+		if err != nil {
+			failed = append(failed, name)
+		}
+	}
+
+	log.Printf("Verification report for AWX instances matching %s:", v.config.InstanceSelector)
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("  ✗ %s: %v", result.Name, result.Err)
+		} else if result.Version != "" {
+			log.Printf("  ✓ %s (AWX %s)", result.Name, result.Version)
+		} else {
+			log.Printf("  ✓ %s", result.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("%d of %d AWX instances failed verification: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// instanceConfig returns the configuration an instance is verified with. Its
+// hostname, TLS and path are taken from its spec rather than AWX_HOSTNAME,
+// AWX_TLS and AWX_INGRESS_PATH, which describe only the configured
+// instance. An instance without an ingress host is reached through its
+// service.
+func (v *DeploymentVerifier) instanceConfig(instance *unstructured.Unstructured) *config.Config {
+	cfg := *v.config
+	cfg.AWXName = instance.GetName()
+
+	exposure := exposureOf(instance)
+	if !exposure.HasIngress() || exposure.Hostname == "" {
+		cfg.VerifyViaService = true
+		return &cfg
+	}
+	cfg.AWXHostname = exposure.Hostname
+	cfg.AWXHostnameAliases = exposure.Hostnames[1:]
+	cfg.TLS = exposure.TLS
+	cfg.IngressPath = exposure.Path
+	return &cfg
+}
@@ -0,0 +1,239 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// healthyInstance returns an AWX instance with the given labels whose
+// components are all running and ready
+func healthyInstance(namespace, name string, labels map[string]string) []runtime.Object {
+	awx := awxWithConditions(namespace, name, map[string]interface{}{"type": "Successful", "status": "True"})
+	awx.SetLabels(labels)
+	objects := []runtime.Object{awx}
+	// the web pods run Redis next to AWX
+	web := instanceDeployment(namespace, name, "web")
+	task := instanceDeployment(namespace, name, "task")
+	webPod := workloadPod(web, web.Name+"-1", corev1.ContainerStatus{Name: "awx-web", Ready: true}, corev1.ContainerStatus{Name: "redis", Ready: true})
+	webPod.Spec.Containers = []corev1.Container{{Name: "awx-web", Image: "quay.io/ansible/awx:24.6.1"}, {Name: "redis", Image: "redis:7"}}
+	objects = append(objects,
+		web, webPod,
+		task, workloadPod(task, task.Name+"-1", corev1.ContainerStatus{Name: "awx-task", Ready: true}),
+	)
+
+	postgresName := name + "-postgres-15"
+	postgres := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name: postgresName, Namespace: namespace, UID: types.UID(postgresName + "-uid"), Labels: instanceLabels(name, "database"),
+	}, Status: appsv1.StatefulSetStatus{Replicas: 1, ReadyReplicas: 1, UpdatedReplicas: 1}}
+	postgresPod := readyPod(namespace, postgresName+"-0", instanceLabels(name, "database"))
+	postgresPod.OwnerReferences = []metav1.OwnerReference{{Kind: "StatefulSet", Name: postgresName, UID: postgres.UID}}
+	objects = append(objects, postgres, postgresPod)
+
+	for _, service := range []struct{ name, component string }{{name + "-service", "web"}, {postgresName, "database"}} {
+		objects = append(objects, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: service.name, Namespace: namespace, Labels: instanceLabels(name, service.component)}})
+	}
+	return objects
+}
+
+func TestVerifyInstances(t *testing.T) {
+	established := map[string]interface{}{"type": "Established", "status": "True"}
+	prod := map[string]string{"fleet": "prod"}
+	// broken is an instance the operator has created nothing for yet
+	broken := func(name string, labels map[string]string) runtime.Object {
+		awx := k8stest.AWX("awx", name)
+		awx.SetLabels(labels)
+		return awx
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		objects  []runtime.Object
+		want     []InstanceResult
+		// wantErrs are the errors of the results in turn, empty for none
+		wantErrs []string
+		wantErr  string
+	}{
+		{
+			name:     "two labeled instances verified",
+			selector: "fleet=prod",
+			objects: concatObjects(
+				healthyInstance("awx", "awx-b", prod),
+				healthyInstance("awx", "awx-a", prod),
+				[]runtime.Object{broken("awx-c", nil)},
+			),
+			want: []InstanceResult{{Name: "awx-a", Version: "24.6.1"}, {Name: "awx-b", Version: "24.6.1"}},
+		},
+		{
+			name:     "set-based selector",
+			selector: "fleet in (prod,staging)",
+			objects: concatObjects(
+				healthyInstance("awx", "awx-a", prod),
+				healthyInstance("awx", "awx-b", map[string]string{"fleet": "staging"}),
+				healthyInstance("awx", "awx-c", map[string]string{"fleet": "dev"}),
+			),
+			want: []InstanceResult{{Name: "awx-a", Version: "24.6.1"}, {Name: "awx-b", Version: "24.6.1"}},
+		},
+		{
+			name:     "one instance failing",
+			selector: "fleet=prod",
+			objects:  concatObjects(healthyInstance("awx", "awx-a", prod), []runtime.Object{broken("awx-b", prod)}),
+			want:     []InstanceResult{{Name: "awx-a", Version: "24.6.1"}, {Name: "awx-b"}},
+			wantErrs: []string{"", "PostgreSQL verification failed: PostgreSQL deployment or stateful set of AWX instance awx-b does not exist"},
+			wantErr:  "1 of 2 AWX instances failed verification: awx-b",
+		},
+		{
+			name:     "no instance matching",
+			selector: "fleet=staging",
+			objects:  healthyInstance("awx", "awx-a", prod),
+			wantErr:  "no AWX instance in namespace awx matches AWX_INSTANCE_SELECTOR fleet=staging",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := append(operatorObjects("awx-operator"), scopedCRD("Namespaced", established))
+			cluster := k8stest.NewCluster(append(objects, tt.objects...)...)
+			// the shared database check reads the manifests from the
+			// working directory
+			dir := t.TempDir()
+			manifests := map[string]string{"namespace.yaml": reconcileManifests["01-namespace.yaml"]}
+			if err := os.Rename(writeManifests(t, manifests), filepath.Join(dir, DefaultManifestsPath)); err != nil {
+				t.Fatal(err)
+			}
+			chdir(t, dir)
+			cfg := testConfig(t, map[string]string{
+				"AWX_NAMESPACE":               "awx",
+				"AWX_OPERATOR_NAMESPACE":      "awx-operator",
+				"AWX_OPERATOR_CLUSTER_SCOPED": "true",
+				"AWX_INSTANCE_SELECTOR":       tt.selector,
+			})
+
+			results, err := NewDeploymentVerifier(cluster.Client, cfg).VerifyInstances(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("VerifyInstances() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("VerifyInstances() failed: %v", err)
+			}
+
+			if len(results) != len(tt.want) {
+				t.Fatalf("VerifyInstances() = %+v, want %+v", results, tt.want)
+			}
+			for i, result := range results {
+				wantErr := ""
+				if i < len(tt.wantErrs) {
+					wantErr = tt.wantErrs[i]
+				}
+				gotErr := ""
+				if result.Err != nil {
+					gotErr = result.Err.Error()
+				}
+				if result.Name != tt.want[i].Name || result.Version != tt.want[i].Version || gotErr != wantErr {
+					t.Errorf("result %d = %s, %q, %v, want %s, %q, %q", i, result.Name, result.Version, result.Err, tt.want[i].Name, tt.want[i].Version, wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestInstanceConfig(t *testing.T) {
+	// withSpec returns an AWX instance with the given spec fields
+	withSpec := func(name string, spec map[string]interface{}) *unstructured.Unstructured {
+		awx := k8stest.AWX("awx", name)
+		for field, value := range spec {
+			if err := unstructured.SetNestedField(awx.Object, value, "spec", field); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return awx
+	}
+
+	tests := []struct {
+		name           string
+		instance       *unstructured.Unstructured
+		wantURL        string
+		wantViaService bool
+	}{
+		{
+			name: "hostname with TLS",
+			instance: withSpec("awx-a", map[string]interface{}{
+				"ingress_type": "ingress", "hostname": "awx-a.example.com", "ingress_tls_secret": "awx-a-tls",
+			}),
+			wantURL: "https://awx-a.example.com",
+		},
+		{
+			name: "ingress host under a path without TLS",
+			instance: withSpec("awx-b", map[string]interface{}{
+				"ingress_type":  "ingress",
+				"ingress_hosts": []interface{}{map[string]interface{}{"hostname": "tools.example.com"}},
+				"ingress_path":  "/awx-b",
+			}),
+			wantURL: "http://tools.example.com/awx-b",
+		},
+		{
+			name:           "no ingress",
+			instance:       withSpec("awx-c", map[string]interface{}{"service_type": "NodePort"}),
+			wantViaService: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{
+				"AWX_NAMESPACE":    "awx",
+				"AWX_HOSTNAME":     "awx.example.com",
+				"AWX_TLS":          "true",
+				"AWX_INGRESS_PATH": "/configured",
+			})
+			got := NewDeploymentVerifier(k8stest.NewCluster().Client, cfg).instanceConfig(tt.instance)
+			if got.AWXName != tt.instance.GetName() {
+				t.Errorf("AWXName = %q, want %q", got.AWXName, tt.instance.GetName())
+			}
+			if got.VerifyViaService != tt.wantViaService {
+				t.Errorf("VerifyViaService = %v, want %v", got.VerifyViaService, tt.wantViaService)
+			}
+			if !tt.wantViaService && awxBaseURL(got) != tt.wantURL {
+				t.Errorf("awxBaseURL() = %q, want %q", awxBaseURL(got), tt.wantURL)
+			}
+			if cfg.AWXName != "awx-instance" || cfg.AWXHostname != "awx.example.com" {
+				t.Errorf("configuration of the configured instance changed to %s at %s", cfg.AWXName, cfg.AWXHostname)
+			}
+		})
+	}
+}
+
+// concatObjects joins lists of objects
+func concatObjects(lists ...[]runtime.Object) []runtime.Object {
+	var objects []runtime.Object
+	for _, list := range lists {
+		objects = append(objects, list...)
+	}
+	return objects
+}
+
+// chdir changes to a directory for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
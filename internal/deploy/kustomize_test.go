@@ -0,0 +1,101 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestGenerateKustomization(t *testing.T) {
+	established := map[string]interface{}{"type": "Established", "status": "True"}
+	// looseFiles is a manifests directory without a kustomization
+	looseFiles := t.TempDir()
+	if err := os.WriteFile(filepath.Join(looseFiles, "namespace.yaml"), []byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: awx\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		dir          string
+		env          map[string]string
+		wantSource   string
+		wantReplicas string
+		wantLabel    string
+		wantErr      string
+	}{
+		{
+			name:         "base detected",
+			dir:          filepath.Join("testdata", "kustomize", "base"),
+			wantSource:   "kustomize:base",
+			wantReplicas: "1",
+		},
+		{
+			name:         "overlay detected",
+			dir:          filepath.Join("testdata", "kustomize", "overlay"),
+			wantSource:   "kustomize:overlay",
+			wantReplicas: "3",
+			wantLabel:    "staging",
+		},
+		{
+			name:         "overlay built as set",
+			dir:          filepath.Join("testdata", "kustomize", "overlay"),
+			env:          map[string]string{"AWX_MANIFEST_SOURCE": "kustomize"},
+			wantSource:   "kustomize:overlay",
+			wantReplicas: "3",
+			wantLabel:    "staging",
+		},
+		{
+			name:    "kustomize set without a kustomization",
+			dir:     looseFiles,
+			env:     map[string]string{"AWX_MANIFEST_SOURCE": "kustomize"},
+			wantErr: "no kustomization file found in " + looseFiles,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, tt.env)
+			manifests, err := NewManifestGenerator(cfg, tt.dir).Generate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Generate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+			for _, manifest := range manifests {
+				if manifest.Object.GetKind() == "Kustomization" {
+					t.Errorf("kustomization file %s decoded as a manifest", manifest.Source)
+				}
+			}
+
+			cluster := k8stest.NewCluster(awxCRD(established))
+			if _, err := NewManifestApplier(cluster.Client, cfg).applyAll(context.Background(), manifests); err != nil {
+				t.Fatalf("applyAll() failed: %v", err)
+			}
+			awx, err := cluster.Client.GetAWX(context.Background(), "awx-instance", "awx")
+			if err != nil {
+				t.Fatalf("AWX CR not applied: %v", err)
+			}
+			// the number type depends on the decoder, compare the printed value
+			if replicas, _, _ := unstructured.NestedFieldNoCopy(awx.Object, "spec", "replicas"); fmt.Sprint(replicas) != tt.wantReplicas {
+				t.Errorf("spec.replicas = %v, want %s", replicas, tt.wantReplicas)
+			}
+			if label := awx.GetLabels()["environment"]; label != tt.wantLabel {
+				t.Errorf("environment label = %q, want %q", label, tt.wantLabel)
+			}
+			if source := awx.GetAnnotations()[SourceAnnotation]; source != tt.wantSource {
+				t.Errorf("%s = %q, want %q", SourceAnnotation, source, tt.wantSource)
+			}
+		})
+	}
+}
@@ -4,27 +4,51 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
-	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"awx-deployer/internal/config"
+	"awx-deployer/internal/events"
 	"awx-deployer/internal/k8s"
 )
 
+// DefaultManifestsPath is the directory the static manifests are loaded from
+const DefaultManifestsPath = "./manifests"
+
+const (
+	// applyPasses bounds how often objects failing on a missing dependency
+	// are applied
+	applyPasses = 5
+	// applyPassDelay is the pause before a pass in which no object could
+	// be applied yet
+	applyPassDelay = 5 * time.Second
+)
+
 // ManifestApplier handles applying Kubernetes manifests
 type ManifestApplier struct {
-	k8sClient     *k8s.KubernetesClient
-	config        *config.Config
-	manifestsPath string
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	generator *ManifestGenerator
+
+	// establishedCRDs caches custom resource kinds known to be served
+	establishedCRDs map[string]bool
+	// crdInterval is how often a missing CRD is looked for
+	crdInterval time.Duration
+	// awxAppliedAt is when the AWX CR was last applied, zero if it was not
+	awxAppliedAt time.Time
 }
 
 // NewManifestApplier creates a new manifest applier
 func NewManifestApplier(k8sClient *k8s.KubernetesClient, config *config.Config) *ManifestApplier {
 	return &ManifestApplier{
-		k8sClient:     k8sClient,
-		config:        config,
-		manifestsPath: "./manifests",
+		k8sClient:       k8sClient,
+		config:          config,
+		generator:       NewManifestGenerator(config, DefaultManifestsPath),
+		establishedCRDs: make(map[string]bool),
+		crdInterval:     5 * time.Second,
 	}
 }
 
@@ -32,34 +56,273 @@ func NewManifestApplier(k8sClient *k8s.KubernetesClient, config *config.Config)
 func (m *ManifestApplier) Apply(ctx context.Context) error {
 	log.Println("Applying AWX manifests from static YAML files...")
 
-	// Check if manifests directory exists
-	if _, err := os.Stat(m.manifestsPath); os.IsNotExist(err) {
-		return fmt.Errorf("manifests directory %s does not exist", m.manifestsPath)
+	manifests, err := m.generator.Generate()
+	if err != nil {
+		return err
 	}
 
-	// Read all YAML files from manifests directory
-	files, err := filepath.Glob(filepath.Join(m.manifestsPath, "*.yaml"))
+	log.Printf("Found %d manifest objects to apply", len(manifests))
+
+	if _, err := m.applyAll(ctx, manifests); err != nil {
+		return err
+	}
+
+	log.Println("All manifests applied successfully")
+	return nil
+}
+
+// AWXAppliedAt returns when Apply applied the AWX CR, or zero if it did not,
+// e.g. because AWX_ADOPT_EXISTING skipped it
+func (m *ManifestApplier) AWXAppliedAt() time.Time {
+	return m.awxAppliedAt
+}
+
+// appliedManifest is a manifest that was applied and how applying it changed
+// the cluster: DriftCreated, DriftUpdated or empty if it did not
+type appliedManifest struct {
+	Manifest
+	Change string
+}
+
+// applyAll applies manifests in order and returns what each changed
+func (m *ManifestApplier) applyAll(ctx context.Context, manifests []Manifest) ([]appliedManifest, error) {
+	if m.config.ForceNamespace != "" {
+		if err := m.k8sClient.EnsureNamespace(ctx, m.config.ForceNamespace, psaLabels(m.config)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Objects that fail because something they need does not exist yet, like
+	// a namespace or CRD applied after them, are retried in further passes
+	var applied []appliedManifest
+	pendingCRDs := crdKinds(manifests)
+	pending := manifests
+	for pass := 1; len(pending) > 0; pass++ {
+		var deferred []Manifest
+		var deferredErrs []error
+		for _, manifest := range pending {
+			change, err := m.applyManifest(ctx, manifest, pendingCRDs)
+			if err == nil {
+				if gk, ok := crdKind(manifest.Object); ok {
+					delete(pendingCRDs, gk)
+				}
+				applied = append(applied, appliedManifest{Manifest: manifest, Change: change})
+				continue
+			}
+			if !k8s.IsDependencyError(err) {
+				return nil, fmt.Errorf("failed to apply manifest %s: %v", manifest.Source, err)
+			}
+			deferred = append(deferred, manifest)
+			deferredErrs = append(deferredErrs, err)
+		}
+
+		if len(deferred) > 0 && pass == applyPasses {
+			return nil, fmt.Errorf("failed to apply manifest %s after %d passes: %v", deferred[0].Source, applyPasses, deferredErrs[0])
+		}
+		for i, manifest := range deferred {
+			log.Printf("Deferring %s %s from %s until its dependencies exist: %v", manifest.Object.GetKind(), manifest.Object.GetName(), manifest.Source, deferredErrs[i])
+		}
+		// only wait when no object succeeded, as the next pass may not
+		// succeed either before the cluster catches up
+		if len(deferred) > 0 && len(deferred) == len(pending) {
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("failed to apply manifest %s: %v", deferred[0].Source, deferredErrs[0])
+			case <-time.After(applyPassDelay):
+			}
+		}
+		pending = deferred
+	}
+	return applied, nil
+}
+
+// applyManifest applies a manifest object and returns DriftCreated or
+// DriftUpdated if that changed the object, told by its resource version,
+// or empty if it was already as desired or skipped. Custom resources whose
+// CRD is among the manifests but not applied yet return a
+// *k8s.DependencyError rather than waiting for the CRD.
+func (m *ManifestApplier) applyManifest(ctx context.Context, manifest Manifest, pendingCRDs map[schema.GroupKind]bool) (string, error) {
+	obj := manifest.Object
+	if gk := obj.GroupVersionKind().GroupKind(); pendingCRDs[gk] {
+		return "", &k8s.DependencyError{Err: fmt.Errorf("CRD for %s is applied later", gk)}
+	}
+	if err := m.waitForCRD(ctx, obj); err != nil {
+		return "", err
+	}
+	if err := forceNamespace(m.k8sClient, m.config, obj); err != nil {
+		return "", err
+	}
+
+	if isAWX(obj) {
+		// apply the AWX CR at the newest version the operator serves
+		obj.SetAPIVersion(k8s.AWXGroup + "/" + m.k8sClient.AWXVersion(ctx))
+	}
+
+	current, err := m.k8sClient.GetObject(ctx, obj)
 	if err != nil {
-		return fmt.Errorf("failed to read manifest files: %v", err)
+		return "", err
+	}
+	apply, err := m.checkOwnership(obj, current)
+	if err != nil || !apply {
+		return "", err
+	}
+	if current != nil && !protectFields(obj, current, m.config.FieldProtections()) {
+		return "", nil
 	}
 
-	if len(files) == 0 {
-		return fmt.Errorf("no YAML manifest files found in %s", m.manifestsPath)
+	log.Printf("Applying %s %s from %s", obj.GetKind(), obj.GetName(), manifest.Source)
+	events.Progressf(ctx, "applying %s %s", obj.GetKind(), obj.GetName())
+	appliedAt := time.Now()
+	if err := m.applyObject(ctx, obj); err != nil {
+		return "", err
+	}
+	if isAWX(obj) {
+		m.awxAppliedAt = appliedAt
 	}
 
-	// Sort files to ensure they are applied in order
-	sort.Strings(files)
+	if current == nil {
+		return DriftCreated, nil
+	}
+	updated, err := m.k8sClient.GetObject(ctx, obj)
+	if err != nil {
+		return "", err
+	}
+	if updated == nil || updated.GetResourceVersion() != current.GetResourceVersion() {
+		return DriftUpdated, nil
+	}
+	return "", nil
+}
+
+// checkOwnership applies AWX_ADOPT_EXISTING to an object that already
+// exists without being managed by the deployer and reports whether to apply
+// it. Adopting takes the object over, since the manifest carries
+// ManagedByLabel.
+func (m *ManifestApplier) checkOwnership(obj, current *unstructured.Unstructured) (bool, error) {
+	apply, err := mayApply(m.config, obj, current)
+	if err == nil && !apply {
+		log.Printf("Warning: Skipping %s, it exists and is not managed by %s (AWX_ADOPT_EXISTING=%s)", describeObject(obj), ManagedByValue, config.AdoptExistingSkip)
+	}
+	return apply, err
+}
+
+// mayApply reports whether AWX_ADOPT_EXISTING lets the deployer apply an
+// object over its current state, or returns an error if it is to fail on it
+func mayApply(cfg *config.Config, obj, current *unstructured.Unstructured) (bool, error) {
+	if cfg.AdoptExisting == config.AdoptExistingAdopt {
+		return true, nil
+	}
+	if current == nil || managedByDeployer(current) {
+		return true, nil
+	}
 
-	log.Printf("Found %d manifest files to apply", len(files))
+	if cfg.AdoptExisting == config.AdoptExistingSkip {
+		return false, nil
+	}
+	return false, fmt.Errorf("%s exists and is not managed by %s, set AWX_ADOPT_EXISTING=%s to take it over or %s to leave it alone", describeObject(obj), ManagedByValue, config.AdoptExistingAdopt, config.AdoptExistingSkip)
+}
 
-	// Apply each manifest file
-	for _, file := range files {
-		log.Printf("Applying manifest: %s", filepath.Base(file))
-		if err := m.k8sClient.Apply(ctx, file); err != nil {
-			return fmt.Errorf("failed to apply manifest %s: %v", file, err)
+// crdKinds returns the kinds defined by the CRDs among the manifests
+func crdKinds(manifests []Manifest) map[schema.GroupKind]bool {
+	kinds := make(map[schema.GroupKind]bool)
+	for _, manifest := range manifests {
+		if gk, ok := crdKind(manifest.Object); ok {
+			kinds[gk] = true
 		}
 	}
+	return kinds
+}
+
+// crdKind returns the kind a CRD defines
+func crdKind(obj *unstructured.Unstructured) (schema.GroupKind, bool) {
+	if obj.GetKind() != "CustomResourceDefinition" || obj.GroupVersionKind().Group != k8s.CRDGroupVersionResource.Group {
+		return schema.GroupKind{}, false
+	}
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+	if group == "" || kind == "" {
+		return schema.GroupKind{}, false
+	}
+	return schema.GroupKind{Group: group, Kind: kind}, true
+}
 
-	log.Println("All manifests applied successfully")
+// applyObject applies an object, recreating it when an update is rejected
+// because of immutable fields and recreation is allowed
+func (m *ManifestApplier) applyObject(ctx context.Context, obj *unstructured.Unstructured) error {
+	var err error
+	if m.config.ServerSideApply {
+		err = m.k8sClient.ApplyServerSide(ctx, obj)
+	} else {
+		err = m.k8sClient.ApplyObject(ctx, obj)
+	}
+	immutableErr, ok := err.(*k8s.ImmutableFieldError)
+	if !ok {
+		return err
+	}
+
+	if !m.config.RecreateImmutable {
+		return fmt.Errorf("%v (set AWX_RECREATE_IMMUTABLE=true to delete and recreate it)", immutableErr)
+	}
+	if obj.GetKind() == "PersistentVolumeClaim" && !m.config.RecreateVolumeClaims {
+		return fmt.Errorf("%v (recreating a PersistentVolumeClaim deletes its data, set AWX_RECREATE_PVCS=true to allow it)", immutableErr)
+	}
+
+	log.Printf("Warning: Recreating %s %s because immutable field(s) %s changed", obj.GetKind(), obj.GetName(), strings.Join(immutableErr.Fields, ", "))
+	return m.k8sClient.RecreateObject(ctx, obj)
+}
+
+// waitForCRD waits until the CRD of a custom resource is Established, since
+// the operator may still be registering it when its resources are applied
+func (m *ManifestApplier) waitForCRD(ctx context.Context, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	if !isCustomGroup(gvk.Group) || m.establishedCRDs[gvk.GroupKind().String()] {
+		return nil
+	}
+
+	timeout := time.Duration(m.config.CRDTimeout) * time.Minute
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	crdName, err := m.waitForCRDName(ctxWithTimeout, gvk.GroupKind())
+	if err != nil {
+		return fmt.Errorf("CRD for %s is not registered after %v, check that the AWX operator is installed and running", gvk.GroupKind(), timeout)
+	}
+
+	log.Printf("Waiting for CRD %s to be established...", crdName)
+	if _, err := m.k8sClient.WaitForCondition(ctxWithTimeout, k8s.CRDGroupVersionResource, crdName, "", "Established", "True", 0); err != nil {
+		return fmt.Errorf("CRD %s is not established after %v, check that the AWX operator is installed and running: %v", crdName, timeout, err)
+	}
+
+	m.establishedCRDs[gvk.GroupKind().String()] = true
 	return nil
 }
+
+// waitForCRDName waits for a CRD of a custom resource to be registered and
+// returns its name
+func (m *ManifestApplier) waitForCRDName(ctx context.Context, groupKind schema.GroupKind) (string, error) {
+	ticker := time.NewTicker(m.crdInterval)
+	defer ticker.Stop()
+
+	for {
+		crdName, err := m.k8sClient.CRDName(ctx, groupKind.Group, groupKind.Kind)
+		if err != nil {
+			log.Printf("Warning: Could not check CRD for %s: %v", groupKind, err)
+		} else if crdName != "" {
+			return crdName, nil
+		} else {
+			log.Printf("Waiting for CRD of %s to be registered...", groupKind)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// isCustomGroup reports whether an API group is provided by a CRD rather than
+// built into Kubernetes. Built-in groups are either unqualified (apps, batch)
+// or end in .k8s.io.
+func isCustomGroup(group string) bool {
+	return strings.Contains(group, ".") && !strings.HasSuffix(group, ".k8s.io")
+}
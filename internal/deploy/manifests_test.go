@@ -0,0 +1,396 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	k8stesting "k8s.io/client-go/testing"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// awxCRD returns the CRD of the AWX kind with the given status conditions
+func awxCRD(conditions ...map[string]interface{}) *unstructured.Unstructured {
+	crd := k8stest.Object("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", k8s.AWXResource+"."+k8s.AWXGroup)
+	unstructured.SetNestedField(crd.Object, k8s.AWXGroup, "spec", "group")
+	unstructured.SetNestedField(crd.Object, "AWX", "spec", "names", "kind")
+	unstructured.SetNestedSlice(crd.Object, []interface{}{
+		map[string]interface{}{"name": k8s.AWXFallbackVersion, "served": true, "storage": true},
+	}, "spec", "versions")
+	var list []interface{}
+	for _, condition := range conditions {
+		list = append(list, condition)
+	}
+	if len(list) > 0 {
+		unstructured.SetNestedSlice(crd.Object, list, "status", "conditions")
+	}
+	return crd
+}
+
+func TestApplyManifestWaitsForCRD(t *testing.T) {
+	established := map[string]interface{}{"type": "Established", "status": "True"}
+
+	tests := []struct {
+		name string
+		// unregisteredLists is how many CRD lists do not find the AWX CRD yet
+		unregisteredLists int
+		crd               *unstructured.Unstructured
+		wantErr           string
+	}{
+		{
+			name: "CRD already established",
+			crd:  awxCRD(established),
+		},
+		{
+			name:              "CRD registered while waiting",
+			unregisteredLists: 3,
+			crd:               awxCRD(established),
+		},
+		{
+			name:    "CRD never established",
+			crd:     awxCRD(),
+			wantErr: "CRD awxs.awx.ansible.com is not established",
+		},
+		{
+			name:              "CRD never registered",
+			unregisteredLists: 1000,
+			crd:               awxCRD(established),
+			wantErr:           "CRD for AWX.awx.ansible.com is not registered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.crd)
+			lists := 0
+			cluster.Dynamic.PrependReactor("list", "customresourcedefinitions", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				lists++
+				if lists <= tt.unregisteredLists {
+					return true, &unstructured.UnstructuredList{}, nil
+				}
+				return false, nil, nil
+			})
+
+			applier := NewManifestApplier(cluster.Client, testConfig(t, nil))
+			applier.crdInterval = 10 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			manifest := Manifest{Source: "07-awx-instance.yaml", Object: awxManifest(t)}
+			_, err := applier.applyManifest(ctx, manifest, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyManifest() error = %v, want %q", err, tt.wantErr)
+				}
+				for _, action := range cluster.Dynamic.Actions() {
+					if action.GetVerb() == "create" && action.GetResource().Resource == k8s.AWXResource {
+						t.Error("AWX CR applied without its CRD")
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyManifest() failed: %v", err)
+			}
+
+			// the CR is only created once a list found the CRD
+			listed := 0
+			for _, action := range cluster.Dynamic.Actions() {
+				if action.GetVerb() == "list" && action.GetResource().Resource == "customresourcedefinitions" {
+					listed++
+				}
+				if action.GetVerb() == "create" && action.GetResource().Resource == k8s.AWXResource && listed <= tt.unregisteredLists {
+					t.Errorf("AWX CR created after %d CRD lists, before its CRD was registered", listed)
+				}
+			}
+			if _, err := cluster.Client.GetAWX(ctx, "awx-instance", "awx"); err != nil {
+				t.Errorf("AWX CR not applied: %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyObjectImmutableFields(t *testing.T) {
+	service := k8stest.Object("v1", "Service", "awx", "awx-instance-service")
+	unstructured.SetNestedField(service.Object, "10.0.0.1", "spec", "clusterIP")
+	claim := k8stest.Object("v1", "PersistentVolumeClaim", "awx", "postgres-15-awx-instance-postgres-15-0")
+	unstructured.SetNestedField(claim.Object, "8Gi", "spec", "resources", "requests", "storage")
+
+	immutable := apierrors.NewInvalid(schema.GroupKind{Kind: "Service"}, "awx-instance-service", field.ErrorList{
+		field.Invalid(field.NewPath("spec", "clusterIP"), "10.0.0.2", "field is immutable"),
+	})
+	shrunk := apierrors.NewInvalid(schema.GroupKind{Kind: "PersistentVolumeClaim"}, "postgres-15-awx-instance-postgres-15-0", field.ErrorList{
+		field.Forbidden(field.NewPath("spec", "resources", "requests", "storage"), "field can not be less than previous value"),
+	})
+
+	tests := []struct {
+		name         string
+		existing     *unstructured.Unstructured
+		resource     string
+		updateErr    error
+		field        []string
+		value        string
+		env          map[string]string
+		wantErr      string
+		wantRecreate bool
+	}{
+		{
+			name:      "immutable service field named",
+			existing:  service,
+			resource:  "services",
+			updateErr: immutable,
+			field:     []string{"spec", "clusterIP"},
+			value:     "10.0.0.2",
+			wantErr:   "immutable field(s) spec.clusterIP changed",
+		},
+		{
+			name:         "immutable service recreated",
+			existing:     service,
+			resource:     "services",
+			updateErr:    immutable,
+			field:        []string{"spec", "clusterIP"},
+			value:        "10.0.0.2",
+			env:          map[string]string{"AWX_RECREATE_IMMUTABLE": "true"},
+			wantRecreate: true,
+		},
+		{
+			name:      "shrunk claim not recreated without AWX_RECREATE_PVCS",
+			existing:  claim,
+			resource:  "persistentvolumeclaims",
+			updateErr: shrunk,
+			field:     []string{"spec", "resources", "requests", "storage"},
+			value:     "4Gi",
+			env:       map[string]string{"AWX_RECREATE_IMMUTABLE": "true"},
+			wantErr:   "recreating a PersistentVolumeClaim deletes its data",
+		},
+		{
+			name:         "shrunk claim recreated with AWX_RECREATE_PVCS",
+			existing:     claim,
+			resource:     "persistentvolumeclaims",
+			updateErr:    shrunk,
+			field:        []string{"spec", "resources", "requests", "storage"},
+			value:        "4Gi",
+			env:          map[string]string{"AWX_RECREATE_IMMUTABLE": "true", "AWX_RECREATE_PVCS": "true"},
+			wantRecreate: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.existing.DeepCopy())
+			cluster.Dynamic.PrependReactor("update", tt.resource, func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, tt.updateErr
+			})
+
+			obj := tt.existing.DeepCopy()
+			unstructured.SetNestedField(obj.Object, tt.value, tt.field...)
+			err := NewManifestApplier(cluster.Client, testConfig(t, tt.env)).applyObject(context.Background(), obj)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyObject() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("applyObject() failed: %v", err)
+			}
+
+			deleted := false
+			for _, action := range cluster.Dynamic.Actions() {
+				deleted = deleted || action.GetVerb() == "delete"
+			}
+			if deleted != tt.wantRecreate {
+				t.Errorf("object deleted = %v, want %v", deleted, tt.wantRecreate)
+			}
+			if tt.wantRecreate {
+				gvr, namespace, _ := cluster.Client.ObjectResource(obj)
+				current, err := cluster.Dynamic.Resource(gvr).Namespace(namespace).Get(context.Background(), obj.GetName(), metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("recreated object not found: %v", err)
+				}
+				if got, _, _ := unstructured.NestedString(current.Object, tt.field...); got != tt.value {
+					t.Errorf("recreated object has %v, want %s", got, tt.value)
+				}
+			}
+		})
+	}
+}
+
+// requireNamespace makes creating objects in a namespace fail as not found
+// until the namespace exists, like the API server does
+func requireNamespace(cluster *k8stest.Cluster, namespace string) {
+	namespaces := schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	cluster.Dynamic.PrependReactor("create", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() != namespace {
+			return false, nil, nil
+		}
+		if _, err := cluster.Dynamic.Tracker().Get(namespaces, "", namespace); err != nil {
+			return true, nil, apierrors.NewNotFound(namespaces.GroupResource(), namespace)
+		}
+		return false, nil, nil
+	})
+}
+
+func TestApplyAllDependencyOrder(t *testing.T) {
+	established := map[string]interface{}{"type": "Established", "status": "True"}
+	secret := Manifest{Source: "10-secret.yaml", Object: k8stest.Object("v1", "Secret", "team", "ldap-bind")}
+	namespace := Manifest{Source: "20-namespace.yaml", Object: k8stest.Object("v1", "Namespace", "", "team")}
+	awx := Manifest{Source: "30-awx.yaml", Object: k8stest.AWX("awx", "awx-instance")}
+	crd := Manifest{Source: "40-crd.yaml", Object: awxCRD(established)}
+
+	tests := []struct {
+		name      string
+		manifests []Manifest
+		// createErr fails creating secrets
+		createErr error
+		timeout   time.Duration
+		// wantOrder are the sources in the order they were applied
+		wantOrder []string
+		wantErr   string
+	}{
+		{
+			name:      "in order",
+			manifests: []Manifest{namespace, secret},
+			wantOrder: []string{"20-namespace.yaml", "10-secret.yaml"},
+		},
+		{
+			name:      "secret before its namespace",
+			manifests: []Manifest{secret, namespace},
+			wantOrder: []string{"20-namespace.yaml", "10-secret.yaml"},
+		},
+		{
+			name:      "custom resource before its CRD",
+			manifests: []Manifest{awx, secret, crd, namespace},
+			wantOrder: []string{"40-crd.yaml", "20-namespace.yaml", "30-awx.yaml", "10-secret.yaml"},
+		},
+		{
+			name:      "other errors fail at once",
+			manifests: []Manifest{secret, namespace},
+			createErr: apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "ldap-bind", nil),
+			wantErr:   "failed to apply manifest 10-secret.yaml",
+		},
+		{
+			name:      "dependency never created",
+			manifests: []Manifest{secret},
+			timeout:   200 * time.Millisecond,
+			wantErr:   "failed to apply manifest 10-secret.yaml: failed to create resource ldap-bind",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster()
+			requireNamespace(cluster, "team")
+			if tt.createErr != nil {
+				cluster.Dynamic.PrependReactor("create", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.createErr
+				})
+			}
+			applier := NewManifestApplier(cluster.Client, testConfig(t, nil))
+			applier.crdInterval = 10 * time.Millisecond
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 5 * time.Second
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			var manifests []Manifest
+			for _, manifest := range tt.manifests {
+				manifests = append(manifests, Manifest{Source: manifest.Source, Object: manifest.Object.DeepCopy()})
+			}
+			applied, err := applier.applyAll(ctx, manifests)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyAll() error = %v, want %q", err, tt.wantErr)
+				}
+				for _, action := range cluster.Dynamic.Actions() {
+					if action.GetVerb() == "create" && action.GetResource().Resource == "namespaces" {
+						t.Error("applying went on after a failure that is not a dependency error")
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyAll() failed: %v", err)
+			}
+
+			var order []string
+			for _, manifest := range applied {
+				order = append(order, manifest.Source)
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("applied %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestAWXAppliedAt(t *testing.T) {
+	settings := reconcileManifests["02-settings.yaml"]
+	awx := `apiVersion: awx.ansible.com/v1beta1
+kind: AWX
+metadata:
+  name: awx-instance
+  namespace: awx
+`
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		existing []runtime.Object
+		env      map[string]string
+		wantSet  bool
+	}{
+		{
+			name:    "AWX CR applied",
+			files:   map[string]string{"10-settings.yaml": settings, "20-awx.yaml": awx},
+			wantSet: true,
+		},
+		{
+			name:  "no AWX CR among the manifests",
+			files: map[string]string{"10-settings.yaml": settings},
+		},
+		{
+			name:     "AWX CR skipped",
+			files:    map[string]string{"10-settings.yaml": settings, "20-awx.yaml": awx},
+			existing: []runtime.Object{k8stest.AWX("awx", "awx-instance")},
+			env:      map[string]string{"AWX_ADOPT_EXISTING": "skip"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, tt.env)
+			established := map[string]interface{}{"type": "Established", "status": "True"}
+			cluster := k8stest.NewCluster(append([]runtime.Object{awxCRD(established)}, tt.existing...)...)
+			applier := NewManifestApplier(cluster.Client, cfg)
+			applier.generator = NewManifestGenerator(cfg, writeManifests(t, tt.files))
+
+			before := time.Now()
+			if err := applier.Apply(context.Background()); err != nil {
+				t.Fatalf("Apply() failed: %v", err)
+			}
+			after := time.Now()
+
+			got := applier.AWXAppliedAt()
+			if !tt.wantSet {
+				if !got.IsZero() {
+					t.Errorf("AWXAppliedAt() = %v, want zero", got)
+				}
+				return
+			}
+			if got.Before(before) || got.After(after) {
+				t.Errorf("AWXAppliedAt() = %v, want between %v and %v", got, before, after)
+			}
+		})
+	}
+}
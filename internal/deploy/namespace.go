@@ -0,0 +1,39 @@
+package deploy
+
+import (
+	"fmt"
+	"log"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// forceNamespace moves a namespaced object into AWX_FORCE_NAMESPACE, if set.
+// Cluster-scoped objects are left alone. This takes precedence over the
+// default namespace used for objects without one.
+func forceNamespace(k8sClient *k8s.KubernetesClient, cfg *config.Config, obj *unstructured.Unstructured) error {
+	if cfg.ForceNamespace == "" || obj.GetNamespace() == cfg.ForceNamespace {
+		return nil
+	}
+
+	namespaced, err := k8sClient.IsNamespaced(obj.GroupVersionKind())
+	if err != nil {
+		if k8s.IsDependencyError(err) {
+			return err
+		}
+		return fmt.Errorf("failed to determine the scope of %s %s: %v", obj.GetKind(), obj.GetName(), err)
+	}
+	if !namespaced {
+		return nil
+	}
+
+	from := obj.GetNamespace()
+	if from == "" {
+		from = "<none>"
+	}
+	log.Printf("Overriding namespace of %s %s: %s -> %s", obj.GetKind(), obj.GetName(), from, cfg.ForceNamespace)
+	obj.SetNamespace(cfg.ForceNamespace)
+	return nil
+}
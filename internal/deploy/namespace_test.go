@@ -0,0 +1,71 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestApplyAllForceNamespace(t *testing.T) {
+	objects := []struct {
+		apiVersion string
+		kind       string
+		namespace  string
+		// wantNamespace is where the object lands with AWX_FORCE_NAMESPACE
+		wantNamespace string
+	}{
+		{apiVersion: "v1", kind: "ConfigMap", namespace: "other", wantNamespace: "awx-test"},
+		{apiVersion: "v1", kind: "Secret", namespace: "", wantNamespace: "awx-test"},
+		{apiVersion: "v1", kind: "ServiceAccount", namespace: "awx", wantNamespace: "awx-test"},
+		{apiVersion: "v1", kind: "Service", namespace: "awx-test", wantNamespace: "awx-test"},
+		{apiVersion: "rbac.authorization.k8s.io/v1", kind: "ClusterRole", namespace: "", wantNamespace: ""},
+	}
+
+	cluster := k8stest.NewCluster()
+	cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_FORCE_NAMESPACE": "awx-test"})
+	applier := NewManifestApplier(cluster.Client, cfg)
+
+	var manifests []Manifest
+	for _, o := range objects {
+		manifests = append(manifests, Manifest{Source: o.kind + ".yaml", Object: k8stest.Object(o.apiVersion, o.kind, o.namespace, "settings")})
+	}
+	if _, err := applier.applyAll(context.Background(), manifests); err != nil {
+		t.Fatalf("applyAll() failed: %v", err)
+	}
+
+	for _, o := range objects {
+		t.Run(o.kind, func(t *testing.T) {
+			obj, err := cluster.Client.GetObject(context.Background(), k8stest.Object(o.apiVersion, o.kind, o.wantNamespace, "settings"))
+			if err != nil || obj == nil {
+				t.Errorf("%s not applied in namespace %q (err %v)", o.kind, o.wantNamespace, err)
+			}
+			if o.namespace != "" && o.namespace != o.wantNamespace {
+				if obj, _ := cluster.Client.GetObject(context.Background(), k8stest.Object(o.apiVersion, o.kind, o.namespace, "settings")); obj != nil {
+					t.Errorf("%s applied in its manifest namespace %s too", o.kind, o.namespace)
+				}
+			}
+		})
+	}
+
+	if _, err := cluster.Clientset.CoreV1().Namespaces().Get(context.Background(), "awx-test", metav1.GetOptions{}); err != nil {
+		t.Errorf("forced namespace not created: %v", err)
+	}
+}
+
+func TestForceNamespaceUnset(t *testing.T) {
+	cluster := k8stest.NewCluster()
+	cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx"})
+
+	for _, namespace := range []string{"", "other"} {
+		obj := k8stest.Object("v1", "ConfigMap", namespace, "settings")
+		if err := forceNamespace(cluster.Client, cfg, obj); err != nil {
+			t.Fatalf("forceNamespace() failed: %v", err)
+		}
+		if obj.GetNamespace() != namespace {
+			t.Errorf("namespace %q changed to %q without AWX_FORCE_NAMESPACE", namespace, obj.GetNamespace())
+		}
+	}
+}
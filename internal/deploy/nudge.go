@@ -0,0 +1,104 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/events"
+	"awx-deployer/internal/k8s"
+)
+
+// ReconcileNonceAnnotation is set to a new value on the AWX CR to make the
+// operator reconcile it. The operator ignores the annotation itself.
+const ReconcileNonceAnnotation = "awx-deployer/reconcile-nonce"
+
+// ReconcileNudger makes the operator reconcile the AWX CR at once instead of
+// on its next periodic resync
+type ReconcileNudger struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	// interval is how often the observed generation is checked
+	interval time.Duration
+}
+
+// NewReconcileNudger creates a new reconcile nudger
+func NewReconcileNudger(k8sClient *k8s.KubernetesClient, config *config.Config) *ReconcileNudger {
+	return &ReconcileNudger{
+		k8sClient: k8sClient,
+		config:    config,
+		interval:  5 * time.Second,
+	}
+}
+
+// Nudge sets ReconcileNonceAnnotation on the AWX CR when AWX_FORCE_RECONCILE
+// is set, then waits up to AWX_OPERATOR_TIMEOUT minutes for the operator to
+// observe the CR's generation. The update event of the annotation triggers
+// the reconcile. The generation only counts spec changes, so the wait covers
+// what was applied or patched before.
+func (n *ReconcileNudger) Nudge(ctx context.Context) error {
+	if !n.config.ForceReconcile {
+		return nil
+	}
+
+	nonce := time.Now().UTC().Format(time.RFC3339Nano)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{ReconcileNonceAnnotation: nonce},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	awx, err := n.k8sClient.PatchAWX(ctx, n.config.AWXName, n.config.Namespace, types.MergePatchType, patch)
+	if err != nil {
+		return fmt.Errorf("failed to annotate AWX instance %s: %v", n.config.AWXName, err)
+	}
+	log.Printf("Set %s=%s on AWX instance %s to trigger a reconcile", ReconcileNonceAnnotation, nonce, n.config.AWXName)
+
+	return n.waitForGeneration(ctx, awx.GetGeneration())
+}
+
+// waitForGeneration waits for status.observedGeneration of the AWX CR to
+// reach the given generation
+func (n *ReconcileNudger) waitForGeneration(ctx context.Context, generation int64) error {
+	events.Progressf(ctx, "waiting for the operator to observe generation %d", generation)
+
+	timeout := time.Duration(n.config.OperatorTimeout) * time.Minute
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	observed := int64(0)
+	for {
+		awx, err := n.k8sClient.GetAWX(ctxWithTimeout, n.config.AWXName, n.config.Namespace)
+		if err != nil {
+			log.Printf("Warning: Could not get AWX instance: %v", err)
+		} else if observed = observedGeneration(awx); observed >= generation {
+			log.Printf("✓ Operator observed generation %d of AWX instance %s", generation, n.config.AWXName)
+			return nil
+		}
+
+		select {
+		case <-ctxWithTimeout.Done():
+			return fmt.Errorf("timeout waiting for the operator to observe generation %d of %s (observed %d)", generation, n.config.AWXName, observed)
+		case <-ticker.C:
+		}
+	}
+}
+
+// observedGeneration returns status.observedGeneration of an object, or 0 if
+// it is not set
+func observedGeneration(obj *unstructured.Unstructured) int64 {
+	generation, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	return generation
+}
@@ -0,0 +1,142 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// awxAtGeneration returns an AWX CR at a generation the operator observed
+// up to observed
+func awxAtGeneration(generation, observed int64) *unstructured.Unstructured {
+	awx := k8stest.AWX("awx", "awx-instance")
+	awx.SetGeneration(generation)
+	unstructured.SetNestedField(awx.Object, observed, "status", "observedGeneration")
+	return awx
+}
+
+// observeAfterNudge makes the fake cluster act like an operator that
+// observes the AWX CR's generation on the given get after the nudge
+func observeAfterNudge(cluster *k8stest.Cluster, gets int) {
+	var mu sync.Mutex
+	nudged, seen := false, 0
+	cluster.Dynamic.PrependReactor("patch", k8s.AWXResource, func(k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		nudged = true
+		mu.Unlock()
+		return false, nil, nil
+	})
+	cluster.Dynamic.PrependReactor("get", k8s.AWXResource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !nudged {
+			return false, nil, nil
+		}
+		if seen++; seen < gets {
+			return false, nil, nil
+		}
+		get := action.(k8stesting.GetAction)
+		obj, err := cluster.Dynamic.Tracker().Get(get.GetResource(), get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		awx := obj.(*unstructured.Unstructured).DeepCopy()
+		unstructured.SetNestedField(awx.Object, awx.GetGeneration(), "status", "observedGeneration")
+		return true, awx, nil
+	})
+}
+
+func TestReconcileNudgerNudge(t *testing.T) {
+	tests := []struct {
+		name    string
+		force   bool
+		objects []runtime.Object
+		// observeOn is the get after the nudge on which the operator has
+		// observed the generation, never if 0
+		observeOn int
+		wantNudge bool
+		wantErr   string
+	}{
+		{
+			name:    "not forced",
+			objects: []runtime.Object{awxAtGeneration(4, 3)},
+		},
+		{
+			name:      "operator catches up",
+			force:     true,
+			objects:   []runtime.Object{awxAtGeneration(4, 3)},
+			observeOn: 3,
+			wantNudge: true,
+		},
+		{
+			name:      "generation already observed",
+			force:     true,
+			objects:   []runtime.Object{awxAtGeneration(4, 4)},
+			wantNudge: true,
+		},
+		{
+			name:      "operator never catches up",
+			force:     true,
+			objects:   []runtime.Object{awxAtGeneration(4, 3)},
+			wantNudge: true,
+			wantErr:   "timeout waiting for the operator to observe generation 4 of awx-instance (observed 3)",
+		},
+		{
+			name:    "AWX instance missing",
+			force:   true,
+			wantErr: "failed to annotate AWX instance awx-instance",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": "awx-instance"}
+			if tt.force {
+				env["AWX_FORCE_RECONCILE"] = "true"
+			}
+			cluster := k8stest.NewCluster(tt.objects...)
+			if tt.observeOn > 0 {
+				observeAfterNudge(cluster, tt.observeOn)
+			}
+			nudger := NewReconcileNudger(cluster.Client, testConfig(t, env))
+			nudger.interval = time.Millisecond
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := nudger.Nudge(ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Nudge() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Nudge() failed: %v", err)
+			}
+			if !tt.wantNudge {
+				for _, action := range cluster.Dynamic.Actions() {
+					if action.Matches("patch", k8s.AWXResource) && !tt.force {
+						t.Errorf("Nudge() patched the AWX instance, want it left alone")
+					}
+				}
+				return
+			}
+
+			awx, err := cluster.Client.GetAWX(context.Background(), "awx-instance", "awx")
+			if err != nil {
+				t.Fatalf("failed to get the AWX instance: %v", err)
+			}
+			nonce := awx.GetAnnotations()[ReconcileNonceAnnotation]
+			if _, err := time.Parse(time.RFC3339Nano, nonce); err != nil {
+				t.Errorf("%s = %q, want a timestamp", ReconcileNonceAnnotation, nonce)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package deploy
+
+import (
+	"sort"
+
+	"awx-deployer/internal/config"
+)
+
+// kindPriorities is the apply order of kinds, lowest first, similar to the
+// install order of Helm: namespaces and CRDs, then what workloads use, then
+// the workloads and finally what exposes them. The gaps leave room for
+// AWX_KIND_PRIORITY to put kinds in between.
+var kindPriorities = map[string]int{
+	"Namespace":                10,
+	"CustomResourceDefinition": 20,
+	"NetworkPolicy":            30,
+	"ResourceQuota":            40,
+	"LimitRange":               50,
+	"PodDisruptionBudget":      60,
+	"ServiceAccount":           70,
+	"Secret":                   80,
+	"ConfigMap":                90,
+	"StorageClass":             100,
+	"PersistentVolume":         110,
+	"PersistentVolumeClaim":    120,
+	"ClusterRole":              130,
+	"ClusterRoleBinding":       140,
+	"Role":                     150,
+	"RoleBinding":              160,
+	"Service":                  170,
+	"DaemonSet":                180,
+	"Pod":                      190,
+	"ReplicationController":    200,
+	"ReplicaSet":               210,
+	"Deployment":               220,
+	"HorizontalPodAutoscaler":  230,
+	"StatefulSet":              240,
+	"Job":                      250,
+	"CronJob":                  260,
+	"IngressClass":             270,
+	"Ingress":                  280,
+	"APIService":               290,
+}
+
+const (
+	// unknownKindPriority orders kinds without a priority, like custom
+	// resources, after the built-in ones
+	unknownKindPriority = 1000
+	// awxKindPriority applies the AWX CR last, once everything it
+	// references exists
+	awxKindPriority = 2000
+)
+
+// sortByKind orders manifests by the priority of their kind, overridden by
+// AWX_KIND_PRIORITY, then by kind, namespace and name, so that the order does
+// not depend on how the objects were read or generated
+func sortByKind(manifests []Manifest, cfg *config.Config) {
+	overrides := cfg.KindPriorityMap()
+	priority := func(m Manifest) int {
+		kind := m.Object.GetKind()
+		if p, ok := overrides[kind]; ok {
+			return p
+		}
+		if isAWX(m.Object) {
+			return awxKindPriority
+		}
+		if p, ok := kindPriorities[kind]; ok {
+			return p
+		}
+		return unknownKindPriority
+	}
+	sort.SliceStable(manifests, func(i, j int) bool {
+		a, b := manifests[i].Object, manifests[j].Object
+		if pa, pb := priority(manifests[i]), priority(manifests[j]); pa != pb {
+			return pa < pb
+		}
+		if a.GetKind() != b.GetKind() {
+			return a.GetKind() < b.GetKind()
+		}
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		return a.GetName() < b.GetName()
+	})
+}
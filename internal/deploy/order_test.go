@@ -0,0 +1,136 @@
+package deploy
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestSortByKind(t *testing.T) {
+	objects := []Manifest{
+		{Source: "a.yaml", Object: k8stest.AWX("awx", "awx-instance")},
+		{Source: "a.yaml", Object: k8stest.Object("apps/v1", "Deployment", "awx", "ldap-sync")},
+		{Source: "b.yaml", Object: k8stest.Object("v1", "Service", "awx", "ldap-sync")},
+		{Source: "b.yaml", Object: k8stest.Object("rbac.authorization.k8s.io/v1", "RoleBinding", "awx", "awx")},
+		{Source: "c.yaml", Object: k8stest.Object("rbac.authorization.k8s.io/v1", "Role", "awx", "awx")},
+		{Source: "c.yaml", Object: k8stest.Object("v1", "ConfigMap", "awx", "settings")},
+		{Source: "d.yaml", Object: k8stest.Object("v1", "Secret", "awx", "awx-postgres-configuration")},
+		{Source: "d.yaml", Object: k8stest.Object("v1", "Secret", "awx", "awx-admin-password")},
+		{Source: "e.yaml", Object: k8stest.Object("v1", "ServiceAccount", "awx", "awx")},
+		{Source: "e.yaml", Object: k8stest.Object("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "backups.example.com")},
+		{Source: "f.yaml", Object: k8stest.Object("example.com/v1", "Backup", "awx", "nightly")},
+		{Source: "f.yaml", Object: k8stest.Object("v1", "Namespace", "", "awx")},
+		{Source: "g.yaml", Object: k8stest.Object("batch/v1", "Job", "awx", "fix-permissions")},
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		// want is the apply order by kind and name
+		want []string
+	}{
+		{
+			name: "built-in priorities",
+			want: []string{
+				"Namespace awx",
+				"CustomResourceDefinition backups.example.com",
+				"ServiceAccount awx",
+				"Secret awx-admin-password",
+				"Secret awx-postgres-configuration",
+				"ConfigMap settings",
+				"Role awx",
+				"RoleBinding awx",
+				"Service ldap-sync",
+				"Deployment ldap-sync",
+				"Job fix-permissions",
+				"Backup nightly",
+				"AWX awx-instance",
+			},
+		},
+		{
+			name: "overridden priorities",
+			env:  map[string]string{"AWX_KIND_PRIORITY": "Job=15,Backup=3000,ConfigMap=75"},
+			want: []string{
+				"Namespace awx",
+				"Job fix-permissions",
+				"CustomResourceDefinition backups.example.com",
+				"ServiceAccount awx",
+				"ConfigMap settings",
+				"Secret awx-admin-password",
+				"Secret awx-postgres-configuration",
+				"Role awx",
+				"RoleBinding awx",
+				"Service ldap-sync",
+				"Deployment ldap-sync",
+				"AWX awx-instance",
+				"Backup nightly",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, tt.env)
+			random := rand.New(rand.NewSource(1))
+			for shuffle := 0; shuffle < 10; shuffle++ {
+				manifests := append([]Manifest{}, objects...)
+				random.Shuffle(len(manifests), func(i, j int) { manifests[i], manifests[j] = manifests[j], manifests[i] })
+
+				sortByKind(manifests, cfg)
+				var order []string
+				for _, manifest := range manifests {
+					order = append(order, manifest.Object.GetKind()+" "+manifest.Object.GetName())
+				}
+				if !reflect.DeepEqual(order, tt.want) {
+					t.Fatalf("order after shuffle %d = %v, want %v", shuffle, order, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateOrderIgnoresFileNames(t *testing.T) {
+	// File names sort opposite to the order the objects need
+	files := map[string]string{
+		"00-awx.yaml": `apiVersion: awx.ansible.com/v1beta1
+kind: AWX
+metadata:
+  name: awx-instance
+  namespace: awx
+`,
+		"01-secret.yaml": `apiVersion: v1
+kind: Secret
+metadata:
+  name: awx-admin-password
+  namespace: awx
+`,
+		"02-namespace.yaml": `apiVersion: v1
+kind: Namespace
+metadata:
+  name: awx
+`,
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifests, err := NewManifestGenerator(testConfig(t, nil), dir).Generate()
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	var order []string
+	for _, manifest := range manifests {
+		order = append(order, manifest.Source)
+	}
+	want := []string{"02-namespace.yaml", "01-secret.yaml", "00-awx.yaml"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("Generate() order = %v, want %v", order, want)
+	}
+}
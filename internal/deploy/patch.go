@@ -0,0 +1,136 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// AWXPatcher applies small changes to an existing AWX CR without
+// re-applying the whole manifest set
+type AWXPatcher struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	reconcile *ReconcileChecker
+	// interval is how often the reconcile is checked
+	interval time.Duration
+}
+
+// NewAWXPatcher creates a new AWX patcher
+func NewAWXPatcher(k8sClient *k8s.KubernetesClient, config *config.Config) *AWXPatcher {
+	return &AWXPatcher{
+		k8sClient: k8sClient,
+		config:    config,
+		reconcile: NewReconcileChecker(k8sClient, config),
+		interval:  10 * time.Second,
+	}
+}
+
+// Patch applies a JSON merge patch (a JSON object) or a JSON patch (a JSON
+// array of operations) to the AWX CR and waits for the operator to reconcile it
+func (p *AWXPatcher) Patch(ctx context.Context, patch []byte) error {
+	patchType, err := detectPatchType(patch)
+	if err != nil {
+		return err
+	}
+
+	exists, err := p.k8sClient.AWXExists(ctx, p.config.AWXName, p.config.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to check AWX instance: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("AWX instance %s does not exist in namespace %s", p.config.AWXName, p.config.Namespace)
+	}
+
+	log.Printf("Patching AWX instance %s...", p.config.AWXName)
+	patchedAt := time.Now()
+	p.reconcile.since = patchedAt
+	if _, err := p.k8sClient.PatchAWX(ctx, p.config.AWXName, p.config.Namespace, patchType, patch); err != nil {
+		return err
+	}
+
+	if err := NewReconcileNudger(p.k8sClient, p.config).Nudge(ctx); err != nil {
+		return fmt.Errorf("failed to force a reconcile: %v", err)
+	}
+
+	return p.waitForReconcile(ctx, patchedAt)
+}
+
+// detectPatchType validates the patch and picks the patch type from its shape
+func detectPatchType(patch []byte) (types.PatchType, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(patch, &decoded); err != nil {
+		return "", fmt.Errorf("patch is not valid JSON: %v", err)
+	}
+
+	switch decoded.(type) {
+	case map[string]interface{}:
+		return types.MergePatchType, nil
+	case []interface{}:
+		return types.JSONPatchType, nil
+	default:
+		return "", fmt.Errorf("patch must be a JSON object (merge patch) or array (JSON patch)")
+	}
+}
+
+// waitForReconcile waits for the operator to report a successful reconcile
+// that completed after the patch was applied
+func (p *AWXPatcher) waitForReconcile(ctx context.Context, since time.Time) error {
+	log.Println("Waiting for the operator to reconcile the change...")
+
+	timeout := time.Duration(p.config.OperatorTimeout) * time.Minute
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctxWithTimeout.Done():
+			return fmt.Errorf("timeout waiting for the operator to reconcile %s", p.config.AWXName)
+		case <-ticker.C:
+			if err := p.reconcile.Check(ctxWithTimeout); err != nil {
+				return err
+			}
+
+			cr, err := p.k8sClient.GetAWX(ctxWithTimeout, p.config.AWXName, p.config.Namespace)
+			if err != nil {
+				log.Printf("Warning: Could not get AWX instance: %v", err)
+				continue
+			}
+
+			if reconciledSince(cr, since) {
+				log.Printf("✓ AWX instance %s reconciled", p.config.AWXName)
+				return nil
+			}
+		}
+	}
+}
+
+// reconciledSince reports whether the CR has a Successful condition that
+// transitioned after the given time
+func reconciledSince(cr *unstructured.Unstructured, since time.Time) bool {
+	conditions, _, _ := unstructured.NestedSlice(cr.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Successful" || condition["status"] != "True" {
+			continue
+		}
+
+		transition, _ := condition["lastTransitionTime"].(string)
+		at, err := time.Parse(time.RFC3339, transition)
+		if err == nil && !at.Before(since.Truncate(time.Second)) {
+			return true
+		}
+	}
+	return false
+}
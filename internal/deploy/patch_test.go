@@ -0,0 +1,147 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// reconcileOnPatch makes the fake cluster act like an operator that
+// reconciles the AWX CR successfully whenever it is patched
+func reconcileOnPatch(cluster *k8stest.Cluster) {
+	var mu sync.Mutex
+	var patchedAt time.Time
+	cluster.Dynamic.PrependReactor("patch", k8s.AWXResource, func(k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		patchedAt = time.Now()
+		mu.Unlock()
+		return false, nil, nil
+	})
+	cluster.Dynamic.PrependReactor("get", k8s.AWXResource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if patchedAt.IsZero() {
+			return false, nil, nil
+		}
+		get := action.(k8stesting.GetAction)
+		obj, err := cluster.Dynamic.Tracker().Get(get.GetResource(), get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		awx := obj.(*unstructured.Unstructured).DeepCopy()
+		unstructured.SetNestedSlice(awx.Object, []interface{}{map[string]interface{}{
+			"type":               "Successful",
+			"status":             "True",
+			"lastTransitionTime": patchedAt.Add(time.Second).UTC().Format(time.RFC3339),
+		}}, "status", "conditions")
+		return true, awx, nil
+	})
+}
+
+func TestAWXPatcherPatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		objects      []runtime.Object
+		patch        string
+		wantReplicas int64
+		wantErr      string
+	}{
+		{
+			name:         "merge patch",
+			objects:      []runtime.Object{k8stest.AWX("awx", "awx-instance")},
+			patch:        `{"spec": {"replicas": 3}}`,
+			wantReplicas: 3,
+		},
+		{
+			name:         "JSON patch",
+			objects:      []runtime.Object{k8stest.AWX("awx", "awx-instance")},
+			patch:        `[{"op": "add", "path": "/spec", "value": {"replicas": 2}}]`,
+			wantReplicas: 2,
+		},
+		{
+			name:    "invalid JSON",
+			objects: []runtime.Object{k8stest.AWX("awx", "awx-instance")},
+			patch:   `{"spec": {"replicas": 3}`,
+			wantErr: "patch is not valid JSON",
+		},
+		{
+			name:    "neither object nor array",
+			objects: []runtime.Object{k8stest.AWX("awx", "awx-instance")},
+			patch:   `"replicas"`,
+			wantErr: "patch must be a JSON object (merge patch) or array (JSON patch)",
+		},
+		{
+			name:    "missing AWX instance",
+			patch:   `{"spec": {"replicas": 3}}`,
+			wantErr: "AWX instance awx-instance does not exist in namespace awx",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			reconcileOnPatch(cluster)
+
+			patcher := NewAWXPatcher(cluster.Client, testConfig(t, nil))
+			patcher.interval = 10 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := patcher.Patch(ctx, []byte(tt.patch))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Patch() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Patch() failed: %v", err)
+			}
+
+			awx, err := cluster.Client.GetAWX(ctx, "awx-instance", "awx")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replicas, _, _ := unstructured.NestedInt64(awx.Object, "spec", "replicas"); replicas != tt.wantReplicas {
+				t.Errorf("spec.replicas = %d, want %d", replicas, tt.wantReplicas)
+			}
+		})
+	}
+}
+
+func TestReconciledSince(t *testing.T) {
+	since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	condition := func(conditionType, status string, at time.Time) map[string]interface{} {
+		return map[string]interface{}{"type": conditionType, "status": status, "lastTransitionTime": at.Format(time.RFC3339)}
+	}
+
+	tests := []struct {
+		name      string
+		condition map[string]interface{}
+		want      bool
+	}{
+		{name: "successful after the patch", condition: condition("Successful", "True", since.Add(time.Minute)), want: true},
+		{name: "successful in the same second", condition: condition("Successful", "True", since), want: true},
+		{name: "successful before the patch", condition: condition("Successful", "True", since.Add(-time.Minute))},
+		{name: "not successful", condition: condition("Successful", "False", since.Add(time.Minute))},
+		{name: "other condition", condition: condition("Running", "True", since.Add(time.Minute))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awx := awxWithConditions("awx", "awx-instance", tt.condition)
+			if got := reconciledSince(awx, since.Add(300*time.Millisecond)); got != tt.want {
+				t.Errorf("reconciledSince() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
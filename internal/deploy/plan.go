@@ -0,0 +1,288 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"awx-deployer/internal/audit"
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/operator"
+)
+
+const (
+	// PlanCreate marks an object that does not exist yet
+	PlanCreate = "create"
+	// PlanUpdate marks an existing object that would be updated in place
+	PlanUpdate = "update"
+	// PlanSkip marks an object the deployment leaves alone
+	PlanSkip = "skip"
+)
+
+// PlanStep is one object a deployment would apply
+type PlanStep struct {
+	Order     int
+	Verb      string // create, update or skip
+	Kind      string
+	Namespace string
+	Name      string
+	Note      string
+	// Resource is what the object is applied as, unset for skipped steps
+	Resource schema.GroupVersionResource
+}
+
+// Planner lists what a deployment would create or change without changing
+// the cluster
+type Planner struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	generator *ManifestGenerator
+}
+
+// NewPlanner creates a new planner for the static manifests
+func NewPlanner(k8sClient *k8s.KubernetesClient, config *config.Config) *Planner {
+	return &Planner{
+		k8sClient: k8sClient,
+		config:    config,
+		generator: NewManifestGenerator(config, DefaultManifestsPath),
+	}
+}
+
+// Plan returns the objects of the operator manifests, the TLS secret and the
+// generated manifests in the order a deployment applies them, each marked as
+// created or updated depending on whether it exists in the cluster
+func (p *Planner) Plan(ctx context.Context) ([]PlanStep, error) {
+	var steps []PlanStep
+	planned := make(map[string]bool)
+	add := func(step PlanStep) {
+		key := step.Kind + "/" + step.Namespace + "/" + step.Name
+		if planned[key] {
+			return
+		}
+		planned[key] = true
+		step.Order = len(steps) + 1
+		steps = append(steps, step)
+	}
+
+	operatorSteps, err := p.operatorSteps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range operatorSteps {
+		add(step)
+	}
+
+	if p.config.TLS && (p.config.TLSCertFile != "" || p.config.TLSKeyFile != "") {
+		for _, obj := range []*unstructured.Unstructured{
+			namespaceObject(p.config.Namespace),
+			newObject("v1", "Secret", p.config.Namespace, p.config.TLSSecretName),
+		} {
+			step, err := p.planObject(ctx, obj, false)
+			if err != nil {
+				return nil, err
+			}
+			add(step)
+		}
+	}
+
+	manifests, err := p.generator.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.config.ForceNamespace != "" {
+		step, err := p.planObject(ctx, namespaceObject(p.config.ForceNamespace), false)
+		if err != nil {
+			return nil, err
+		}
+		add(step)
+	}
+
+	for _, manifest := range manifests {
+		obj := manifest.Object
+		if isAWX(obj) {
+			obj.SetAPIVersion(k8s.AWXGroup + "/" + p.k8sClient.AWXVersion(ctx))
+		}
+
+		step, err := p.planManifest(ctx, obj, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan manifest %s: %v", manifest.Source, err)
+		}
+		add(step)
+	}
+	return steps, nil
+}
+
+// operatorSteps plans the operator manifests, which are skipped as a whole
+// when the operator is already installed. None are listed when the operator
+// is managed by others.
+func (p *Planner) operatorSteps(ctx context.Context) ([]PlanStep, error) {
+	if p.config.SkipOperatorInstall {
+		return nil, nil
+	}
+
+	objs, err := operator.Objects(p.config)
+	if err != nil {
+		return nil, err
+	}
+
+	installed, err := operator.NewOperatorInstaller(p.k8sClient, p.config).Installed(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if operator exists: %v", err)
+	}
+
+	var steps []PlanStep
+	for _, obj := range objs {
+		if installed {
+			steps = append(steps, PlanStep{
+				Verb:      PlanSkip,
+				Kind:      obj.GetKind(),
+				Namespace: obj.GetNamespace(),
+				Name:      obj.GetName(),
+				Note:      "AWX Operator already installed",
+			})
+			continue
+		}
+
+		step, err := p.planManifest(ctx, obj, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan operator manifest: %v", err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// planManifest plans a manifest object. The generated manifests (force set)
+// are moved to AWX_FORCE_NAMESPACE and subject to AWX_ADOPT_EXISTING, as
+// when they are applied. Custom resources whose CRD is not installed yet,
+// like the AWX CR before the operator runs, are planned as created.
+func (p *Planner) planManifest(ctx context.Context, obj *unstructured.Unstructured, force bool) (PlanStep, error) {
+	if _, _, err := p.k8sClient.ObjectResource(obj); err != nil {
+		if !isCustomGroup(obj.GroupVersionKind().Group) {
+			return PlanStep{}, err
+		}
+
+		// the operator's custom resources are namespaced
+		namespace := obj.GetNamespace()
+		if force && p.config.ForceNamespace != "" {
+			namespace = p.config.ForceNamespace
+		} else if namespace == "" {
+			namespace = "default"
+		}
+		// the operator's CRDs name their resources after the kind, e.g. awxs
+		gvk := obj.GroupVersionKind()
+		return PlanStep{
+			Verb:      PlanCreate,
+			Kind:      obj.GetKind(),
+			Namespace: namespace,
+			Name:      obj.GetName(),
+			Note:      "CRD not installed yet",
+			Resource:  gvk.GroupVersion().WithResource(strings.ToLower(gvk.Kind) + "s"),
+		}, nil
+	}
+
+	if force {
+		if err := forceNamespace(p.k8sClient, p.config, obj); err != nil {
+			return PlanStep{}, err
+		}
+	}
+	return p.planObject(ctx, obj, force)
+}
+
+// planObject resolves the namespace an object is applied to and whether it
+// already exists there. With checkOwner, an existing object the deployer
+// does not manage is skipped or fails the plan as AWX_ADOPT_EXISTING says.
+func (p *Planner) planObject(ctx context.Context, obj *unstructured.Unstructured, checkOwner bool) (PlanStep, error) {
+	gvr, namespace, err := p.k8sClient.ObjectResource(obj)
+	if err != nil {
+		return PlanStep{}, err
+	}
+
+	current, err := p.k8sClient.GetObject(ctx, obj)
+	if err != nil {
+		return PlanStep{}, err
+	}
+
+	step := PlanStep{
+		Verb:      PlanCreate,
+		Kind:      obj.GetKind(),
+		Namespace: namespace,
+		Name:      obj.GetName(),
+		Resource:  gvr,
+	}
+	if current == nil {
+		return step, nil
+	}
+	if checkOwner {
+		apply, err := mayApply(p.config, obj, current)
+		if err != nil {
+			return PlanStep{}, err
+		}
+		if !apply {
+			return PlanStep{
+				Verb:      PlanSkip,
+				Kind:      step.Kind,
+				Namespace: namespace,
+				Name:      step.Name,
+				Note:      fmt.Sprintf("not managed by %s, AWX_ADOPT_EXISTING=%s", ManagedByValue, config.AdoptExistingSkip),
+			}, nil
+		}
+	}
+	step.Verb = PlanUpdate
+	if current.GetDeletionTimestamp() != nil {
+		step.Note = "being deleted"
+	}
+	return step, nil
+}
+
+// namespaceObject returns a Namespace object with the given name
+func namespaceObject(name string) *unstructured.Unstructured {
+	return newObject("v1", "Namespace", "", name)
+}
+
+// newObject returns an empty object of the given kind
+func newObject(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+// PrintPlan writes the plan as a table
+func PrintPlan(w io.Writer, steps []PlanStep) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ORDER\tVERB\tKIND\tNAMESPACE/NAME\tNOTE")
+	for _, step := range steps {
+		name := step.Name
+		if step.Namespace != "" {
+			name = step.Namespace + "/" + step.Name
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", step.Order, step.Verb, step.Kind, name, step.Note)
+	}
+	tw.Flush()
+
+	counts := make(map[string]int)
+	for _, step := range steps {
+		counts[step.Verb]++
+	}
+	fmt.Fprintf(w, "\n%d to create, %d to update, %d skipped\n", counts[PlanCreate], counts[PlanUpdate], counts[PlanSkip])
+}
+
+// RecordPlan records the creates and updates of a plan in the audit log,
+// which marks them as would-be mutations when opened in dry-run mode
+func RecordPlan(auditLog *audit.Log, steps []PlanStep) {
+	for _, step := range steps {
+		if step.Verb == PlanCreate || step.Verb == PlanUpdate {
+			auditLog.Record(step.Verb, step.Resource, step.Namespace, step.Name, nil)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestPlannerPlan(t *testing.T) {
+	operatorEnv := map[string]string{"AWX_OPERATOR_MANIFEST_PATH": "../operator/testdata/awx-operator.yaml"}
+	deletedAt := metav1.Now()
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		objects []runtime.Object
+		// want are the verbs of objects by "Kind namespace/name", with the
+		// note if any
+		want map[string]string
+		// wantAbsent are objects that must not be planned
+		wantAbsent []string
+		wantErr    string
+	}{
+		{
+			name: "empty cluster",
+			want: map[string]string{
+				"Deployment awx/awx-operator-controller-manager": "create",
+				"Namespace /awx":                    "create",
+				"Secret awx/awx-admin-password":     "create",
+				"StorageClass /hostpath":            "create",
+				"PersistentVolume /awx-postgres-pv": "create",
+				"AWX awx/awx-instance":              "create",
+			},
+		},
+		{
+			name: "existing objects",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "awx"}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "awx-admin-password", Namespace: "awx"}},
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "hostpath"}},
+				k8stest.AWX("awx", "awx-instance"),
+			},
+			want: map[string]string{
+				"Deployment awx/awx-operator-controller-manager": "create",
+				"Namespace /awx":                        "update",
+				"Secret awx/awx-admin-password":         "update",
+				"Secret awx/awx-postgres-configuration": "create",
+				"StorageClass /hostpath":                "update",
+				"PersistentVolume /awx-postgres-pv":     "create",
+				"AWX awx/awx-instance":                  "update",
+			},
+		},
+		{
+			name: "object being deleted",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "awx", DeletionTimestamp: &deletedAt, Finalizers: []string{"kubernetes"}}},
+			},
+			want: map[string]string{
+				"Namespace /awx":       "update (being deleted)",
+				"AWX awx/awx-instance": "create",
+			},
+		},
+		{
+			name: "operator installed",
+			objects: []runtime.Object{
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: operatorDeployment, Namespace: "awx"}},
+			},
+			want: map[string]string{
+				"ServiceAccount awx/awx-operator-controller-manager": "skip (AWX Operator already installed)",
+				"Deployment awx/awx-operator-controller-manager":     "skip (AWX Operator already installed)",
+				"AWX awx/awx-instance":                               "create",
+			},
+		},
+		{
+			name: "operator managed by others",
+			env:  map[string]string{"AWX_SKIP_OPERATOR_INSTALL": "true"},
+			want: map[string]string{
+				"Namespace /awx":       "create",
+				"AWX awx/awx-instance": "create",
+			},
+			wantAbsent: []string{"ServiceAccount awx/awx-operator-controller-manager", "Deployment awx/awx-operator-controller-manager"},
+		},
+		{
+			name: "forced namespace",
+			env:  map[string]string{"AWX_FORCE_NAMESPACE": "awx-test"},
+			objects: []runtime.Object{
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "awx-admin-password", Namespace: "awx-test"}},
+			},
+			want: map[string]string{
+				"Namespace /awx-test":                "create",
+				"Secret awx-test/awx-admin-password": "update",
+				"AWX awx-test/awx-instance":          "create",
+				"StorageClass /hostpath":             "create",
+			},
+			wantAbsent: []string{"Secret awx/awx-admin-password", "AWX awx/awx-instance"},
+		},
+		{
+			name: "unmanaged object skipped",
+			env:  map[string]string{"AWX_ADOPT_EXISTING": "skip"},
+			objects: []runtime.Object{
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "awx-admin-password", Namespace: "awx"}},
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "hostpath", Labels: map[string]string{ManagedByLabel: ManagedByValue}}},
+			},
+			want: map[string]string{
+				"Secret awx/awx-admin-password": "skip (not managed by awx-deployer, AWX_ADOPT_EXISTING=skip)",
+				"StorageClass /hostpath":        "update",
+				"AWX awx/awx-instance":          "create",
+			},
+		},
+		{
+			name: "unmanaged object fails",
+			env:  map[string]string{"AWX_ADOPT_EXISTING": "fail"},
+			objects: []runtime.Object{
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "awx-admin-password", Namespace: "awx"}},
+			},
+			wantErr: "Secret awx/awx-admin-password exists and is not managed by awx-deployer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for key, value := range operatorEnv {
+				env[key] = value
+			}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cfg := testConfig(t, env)
+			cluster := k8stest.NewCluster(tt.objects...)
+			planner := NewPlanner(cluster.Client, cfg)
+			planner.generator = NewManifestGenerator(cfg, manifestsDir)
+
+			steps, err := planner.Plan(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Plan() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Plan() failed: %v", err)
+			}
+
+			got := make(map[string]string)
+			for i, step := range steps {
+				if step.Order != i+1 {
+					t.Errorf("step %d has order %d", i+1, step.Order)
+				}
+				key := step.Kind + " " + step.Namespace + "/" + step.Name
+				if _, ok := got[key]; ok {
+					t.Errorf("%s planned twice", key)
+				}
+				got[key] = step.Verb
+				if step.Note != "" {
+					got[key] += " (" + step.Note + ")"
+				}
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s planned as %q, want %q", key, got[key], want)
+				}
+			}
+			for _, key := range tt.wantAbsent {
+				if verb, ok := got[key]; ok {
+					t.Errorf("%s planned as %q, want it not planned", key, verb)
+				}
+			}
+
+			// planning only reads the cluster
+			for _, action := range append(cluster.Clientset.Actions(), cluster.Dynamic.Actions()...) {
+				if verb := action.GetVerb(); verb != "get" && verb != "list" {
+					t.Errorf("Plan() called %s on %s", verb, action.GetResource().Resource)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanOrder(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"AWX_OPERATOR_MANIFEST_PATH": "../operator/testdata/awx-operator.yaml"})
+	planner := NewPlanner(k8stest.NewCluster().Client, cfg)
+	planner.generator = NewManifestGenerator(cfg, manifestsDir)
+
+	steps, err := planner.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Plan() failed: %v", err)
+	}
+
+	// the operator comes first, the namespace before what is in it and the
+	// AWX CR last
+	var kinds []string
+	for _, step := range steps {
+		switch step.Kind {
+		case "Deployment", "Namespace", "Secret", "AWX":
+			if len(kinds) == 0 || kinds[len(kinds)-1] != step.Kind {
+				kinds = append(kinds, step.Kind)
+			}
+		}
+	}
+	want := []string{"Deployment", "Namespace", "Secret", "AWX"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("plan order = %v, want %v", kinds, want)
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	steps := []PlanStep{
+		{Order: 1, Verb: PlanSkip, Kind: "Deployment", Namespace: "awx", Name: "awx-operator-controller-manager", Note: "AWX Operator already installed"},
+		{Order: 2, Verb: PlanUpdate, Kind: "Namespace", Name: "awx"},
+		{Order: 3, Verb: PlanCreate, Kind: "AWX", Namespace: "awx", Name: "awx-instance"},
+	}
+
+	var out bytes.Buffer
+	PrintPlan(&out, steps)
+
+	want := []string{
+		"ORDER  VERB    KIND        NAMESPACE/NAME                       NOTE",
+		"1      skip    Deployment  awx/awx-operator-controller-manager  AWX Operator already installed",
+		"2      update  Namespace   awx",
+		"3      create  AWX         awx/awx-instance",
+		"",
+		"1 to create, 1 to update, 1 skipped",
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		got = append(got, strings.TrimRight(line, " "))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PrintPlan() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,103 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podStartupGrace is how long a pod may wait for its volumes and config
+// before it counts as stuck, since the operator may still be creating the
+// objects it references
+const podStartupGrace = 2 * time.Minute
+
+// missingObjectPattern matches kubelet messages about a Secret or ConfigMap
+// that does not exist, e.g. `MountVolume.SetUp failed for volume "x" :
+// secret "y" not found` or `configmap "y" not found`
+var missingObjectPattern = regexp.MustCompile(`(?i)\b(secret|configmap)s? "([^"]+)" not found`)
+
+// podStartupError returns why a pod cannot start when it is stuck creating
+// its containers: a missing Secret or ConfigMap named by its container
+// statuses or by its FailedMount events, or the kubelet's message for an
+// invalid container config. It returns nil when there is no such reason.
+func podStartupError(pod corev1.Pod, events []corev1.Event) error {
+	statuses := append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+
+	creating := pod.Status.Phase == corev1.PodPending
+	for _, cs := range statuses {
+		if cs.State.Waiting == nil {
+			continue
+		}
+		switch cs.State.Waiting.Reason {
+		case "CreateContainerConfigError":
+			if missing := missingObject(cs.State.Waiting.Message); missing != "" {
+				return fmt.Errorf("pod %s cannot start: %s", pod.Name, missing)
+			}
+			return fmt.Errorf("pod %s cannot start: container %s has an invalid config: %s", pod.Name, cs.Name, cs.State.Waiting.Message)
+		case "ContainerCreating", "PodInitializing":
+			creating = true
+		}
+	}
+	if !creating {
+		return nil
+	}
+
+	for _, event := range events {
+		if event.InvolvedObject.Kind != "Pod" || event.InvolvedObject.Name != pod.Name {
+			continue
+		}
+		if event.Reason != "FailedMount" && !strings.Contains(event.Message, "MountVolume") {
+			continue
+		}
+		if missing := missingObject(event.Message); missing != "" {
+			return fmt.Errorf("pod %s cannot start: %s", pod.Name, missing)
+		}
+	}
+	return nil
+}
+
+// missingObject returns "secret y not found" for a kubelet message naming a
+// missing Secret or ConfigMap, or an empty string
+func missingObject(message string) string {
+	match := missingObjectPattern.FindStringSubmatch(message)
+	if match == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %s not found", strings.ToLower(match[1]), match[2])
+}
+
+// checkPodStartup returns an error for the first pod matching the selector
+// that has been stuck starting for longer than podStartupGrace because of a
+// missing Secret or ConfigMap or an invalid container config
+func (d *DeploymentWaiter) checkPodStartup(ctx context.Context, labelSelector string) error {
+	pods, err := d.k8sClient.ListPods(ctx, labelSelector, d.config.Namespace)
+	if err != nil {
+		log.Printf("Warning: Could not list pods to check their startup: %v", err)
+		return nil
+	}
+
+	var events []corev1.Event
+	eventsListed := false
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || time.Since(pod.CreationTimestamp.Time) < podStartupGrace {
+			continue
+		}
+
+		if !eventsListed {
+			events, err = d.k8sClient.ListEvents(ctx, "involvedObject.kind=Pod", d.config.Namespace)
+			if err != nil {
+				log.Printf("Warning: Could not list pod events: %v", err)
+			}
+			eventsListed = true
+		}
+		if err := podStartupError(pod, events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// creatingPod returns a pending AWX web pod whose container waits for the
+// given reason, created an hour ago
+func creatingPod(name, reason, message string) *corev1.Pod {
+	pod := workloadPod(instanceDeployment("awx", "awx-instance", "web"), name, corev1.ContainerStatus{
+		Name:  "awx-web",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}},
+	})
+	pod.Status.Phase = corev1.PodPending
+	pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	return pod
+}
+
+// podEvent returns an event about a pod
+func podEvent(pod, reason, message string) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: pod + "." + strings.ToLower(reason), Namespace: "awx"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: pod, Namespace: "awx"},
+		Reason:         reason,
+		Message:        message,
+	}
+}
+
+func TestPodStartupError(t *testing.T) {
+	tests := []struct {
+		name    string
+		pod     *corev1.Pod
+		events  []*corev1.Event
+		wantErr string
+	}{
+		{
+			name: "missing secret volume",
+			pod:  creatingPod("awx-web-1", "ContainerCreating", ""),
+			events: []*corev1.Event{
+				podEvent("awx-web-1", "FailedMount", `MountVolume.SetUp failed for volume "secret-key" : secret "awx-instance-secret-key" not found`),
+			},
+			wantErr: "pod awx-web-1 cannot start: secret awx-instance-secret-key not found",
+		},
+		{
+			name: "missing configmap volume",
+			pod:  creatingPod("awx-web-1", "ContainerCreating", ""),
+			events: []*corev1.Event{
+				podEvent("awx-web-1", "FailedMount", `MountVolume.SetUp failed for volume "settings" : configmap "awx-instance-awx-configmap" not found`),
+			},
+			wantErr: "pod awx-web-1 cannot start: configmap awx-instance-awx-configmap not found",
+		},
+		{
+			name: "mount message with another reason",
+			pod:  creatingPod("awx-web-1", "PodInitializing", ""),
+			events: []*corev1.Event{
+				podEvent("awx-web-1", "Warning", `MountVolume.SetUp failed for volume "ca" : Secrets "custom-ca" not found`),
+			},
+			wantErr: "pod awx-web-1 cannot start: secret custom-ca not found",
+		},
+		{
+			name:    "missing secret in env",
+			pod:     creatingPod("awx-web-1", "CreateContainerConfigError", `secret "awx-instance-postgres-configuration" not found`),
+			wantErr: "pod awx-web-1 cannot start: secret awx-instance-postgres-configuration not found",
+		},
+		{
+			name:    "invalid container config",
+			pod:     creatingPod("awx-web-1", "CreateContainerConfigError", `couldn't find key password in Secret awx/awx-instance-admin-password`),
+			wantErr: "pod awx-web-1 cannot start: container awx-web has an invalid config: couldn't find key password",
+		},
+		{
+			name: "event of another pod",
+			pod:  creatingPod("awx-web-1", "ContainerCreating", ""),
+			events: []*corev1.Event{
+				podEvent("awx-web-2", "FailedMount", `MountVolume.SetUp failed for volume "secret-key" : secret "awx-instance-secret-key" not found`),
+			},
+		},
+		{
+			name: "unrelated event",
+			pod:  creatingPod("awx-web-1", "ContainerCreating", ""),
+			events: []*corev1.Event{
+				podEvent("awx-web-1", "FailedScheduling", `0/3 nodes are available: secret "x" not found`),
+			},
+		},
+		{
+			name: "pulling image",
+			pod:  creatingPod("awx-web-1", "ErrImagePull", "rpc error"),
+		},
+		{
+			name: "running pod",
+			pod:  workloadPod(instanceDeployment("awx", "awx-instance", "web"), "awx-web-1"),
+			events: []*corev1.Event{
+				podEvent("awx-web-1", "FailedMount", `MountVolume.SetUp failed for volume "secret-key" : secret "awx-instance-secret-key" not found`),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []corev1.Event
+			for _, event := range tt.events {
+				events = append(events, *event)
+			}
+			err := podStartupError(*tt.pod, events)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("podStartupError() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("podStartupError() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckPodStartup(t *testing.T) {
+	missingSecret := podEvent("awx-web-1", "FailedMount", `MountVolume.SetUp failed for volume "secret-key" : secret "awx-instance-secret-key" not found`)
+	youngPod := creatingPod("awx-web-1", "ContainerCreating", "")
+	youngPod.CreationTimestamp = metav1.NewTime(time.Now())
+	deletedPod := creatingPod("awx-web-1", "ContainerCreating", "")
+	deletedAt := metav1.Now()
+	deletedPod.DeletionTimestamp = &deletedAt
+	deletedPod.Finalizers = []string{"test"}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		wantErr string
+	}{
+		{
+			name:    "stuck on missing secret",
+			objects: []runtime.Object{creatingPod("awx-web-1", "ContainerCreating", ""), missingSecret},
+			wantErr: "pod awx-web-1 cannot start: secret awx-instance-secret-key not found",
+		},
+		{
+			name:    "within grace period",
+			objects: []runtime.Object{youngPod, missingSecret},
+		},
+		{
+			name:    "being deleted",
+			objects: []runtime.Object{deletedPod, missingSecret},
+		},
+		{
+			name:    "no events",
+			objects: []runtime.Object{creatingPod("awx-web-1", "ContainerCreating", "")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			waiter := NewDeploymentWaiter(cluster.Client, testConfig(t, nil))
+
+			err := waiter.checkPodStartup(context.Background(), "app.kubernetes.io/component=web")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkPodStartup() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("checkPodStartup() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// Kinds of workload the operator runs the managed Postgres as
+const (
+	postgresDeployment  = "deployment"
+	postgresStatefulSet = "stateful set"
+)
+
+// postgresWorkload returns the kind of workload running the managed Postgres
+// and the workload. Older operator versions run it as a deployment, newer
+// ones as a stateful set. The kind is empty while neither exists.
+func postgresWorkload(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config) (string, *unstructured.Unstructured, error) {
+	workloads := []struct {
+		kind string
+		gvr  schema.GroupVersionResource
+	}{
+		{postgresStatefulSet, statefulSetsGVR},
+		{postgresDeployment, deploymentsGVR},
+	}
+	for _, workload := range workloads {
+		obj, err := findInstanceObject(ctx, k8sClient, cfg, workload.gvr, rolePostgres)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to check PostgreSQL %s: %v", workload.kind, err)
+		}
+		if obj != nil {
+			return workload.kind, obj, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// postgresStatus reports whether the Postgres workload of the given kind is
+// ready and describes its status. A deployment is ready when all its pods
+// are, a stateful set when it has rolled out all its replicas.
+func postgresStatus(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config, kind string, workload *unstructured.Unstructured) (bool, string, error) {
+	name := workload.GetName()
+	if kind == postgresStatefulSet {
+		statefulSet, err := k8sClient.GetStatefulSet(ctx, name, cfg.Namespace)
+		if err != nil {
+			return false, "", err
+		}
+		replicas := int32(1)
+		if statefulSet.Spec.Replicas != nil {
+			replicas = *statefulSet.Spec.Replicas
+		}
+		status := statefulSet.Status
+		return k8s.StatefulSetReady(statefulSet), fmt.Sprintf("stateful set %s has %d/%d replicas ready, %d updated", name, status.ReadyReplicas, replicas, status.UpdatedReplicas), nil
+	}
+
+	status, err := workloadPodStatus(ctx, k8sClient, cfg, workload)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get PostgreSQL pod status: %v", err)
+	}
+	return status.Ready(), fmt.Sprintf("deployment %s pod status: %s", name, status), nil
+}
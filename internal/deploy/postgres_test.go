@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// postgresStatefulSetWith returns the Postgres stateful set of the AWX
+// instance with the given ready and updated replicas of one
+func postgresStatefulSetWith(ready, updated int32, updateRevision string) *appsv1.StatefulSet {
+	replicas := int32(1)
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "awx-instance-postgres-15",
+			Namespace:  "awx",
+			Generation: 2,
+			Labels:     instanceLabels("awx-instance", "database"),
+		},
+		Spec: appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status: appsv1.StatefulSetStatus{
+			ObservedGeneration: 2,
+			ReadyReplicas:      ready,
+			UpdatedReplicas:    updated,
+			CurrentRevision:    "awx-instance-postgres-15-1",
+			UpdateRevision:     updateRevision,
+		},
+	}
+}
+
+func TestVerifyPostgreSQL(t *testing.T) {
+	postgres := instanceDeployment("awx", "awx-instance", "database")
+	postgres.Name = "awx-instance-postgres-15"
+	postgresPod := func(ready bool) *corev1.Pod {
+		return workloadPod(postgres, "awx-instance-postgres-15-abc", corev1.ContainerStatus{Name: "postgres", Ready: ready})
+	}
+
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		wantKind string
+		wantErr  string
+	}{
+		{
+			name:     "stateful set rolled out",
+			objects:  []runtime.Object{postgresStatefulSetWith(1, 1, "awx-instance-postgres-15-1")},
+			wantKind: postgresStatefulSet,
+		},
+		{
+			name:     "stateful set replica not ready",
+			objects:  []runtime.Object{postgresStatefulSetWith(0, 1, "awx-instance-postgres-15-1")},
+			wantKind: postgresStatefulSet,
+			wantErr:  "PostgreSQL is not ready, stateful set awx-instance-postgres-15 has 0/1 replicas ready, 1 updated",
+		},
+		{
+			name:     "stateful set rolling out a new revision",
+			objects:  []runtime.Object{postgresStatefulSetWith(1, 0, "awx-instance-postgres-15-2")},
+			wantKind: postgresStatefulSet,
+			wantErr:  "PostgreSQL is not ready, stateful set awx-instance-postgres-15 has 1/1 replicas ready, 0 updated",
+		},
+		{
+			name:     "deployment with a ready pod",
+			objects:  []runtime.Object{postgres, postgresPod(true)},
+			wantKind: postgresDeployment,
+		},
+		{
+			name:     "deployment with a pod not ready",
+			objects:  []runtime.Object{postgres, postgresPod(false)},
+			wantKind: postgresDeployment,
+			wantErr:  "PostgreSQL is not ready, deployment awx-instance-postgres-15 pod status: Running, 0/1 ready",
+		},
+		{
+			name:     "stateful set preferred over a leftover deployment",
+			objects:  []runtime.Object{postgres, postgresStatefulSetWith(1, 1, "awx-instance-postgres-15-1")},
+			wantKind: postgresStatefulSet,
+		},
+		{
+			name:    "neither exists",
+			wantErr: "PostgreSQL deployment or stateful set of AWX instance awx-instance does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx"})
+
+			kind, _, err := postgresWorkload(context.Background(), cluster.Client, cfg)
+			if err != nil {
+				t.Fatalf("postgresWorkload() failed: %v", err)
+			}
+			if kind != tt.wantKind {
+				t.Errorf("postgresWorkload() kind = %q, want %q", kind, tt.wantKind)
+			}
+
+			err = NewDeploymentVerifier(cluster.Client, cfg).verifyPostgreSQL(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("verifyPostgreSQL() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("verifyPostgreSQL() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
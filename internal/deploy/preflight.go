@@ -0,0 +1,55 @@
+package deploy
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"awx-deployer/internal/config"
+)
+
+// NamespaceChecker flags namespace choices that lead to tangled installs
+type NamespaceChecker struct {
+	config *config.Config
+}
+
+// NewNamespaceChecker creates a new namespace checker
+func NewNamespaceChecker(config *config.Config) *NamespaceChecker {
+	return &NamespaceChecker{config: config}
+}
+
+// Check logs a warning for each problem with the configured namespaces, or
+// returns them as an error when warnings are treated as errors
+func (n *NamespaceChecker) Check() error {
+	problems := namespaceProblems(n.config)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if n.config.TreatWarningsAsErrors {
+		return fmt.Errorf("namespace check failed: %s", strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		log.Printf("Warning: %s", problem)
+	}
+	return nil
+}
+
+// namespaceProblems returns a description of each problem with the AWX and
+// operator namespaces
+func namespaceProblems(cfg *config.Config) []string {
+	var problems []string
+
+	for _, system := range cfg.SystemNamespaces {
+		if cfg.Namespace == system {
+			problems = append(problems, fmt.Sprintf("AWX_NAMESPACE %s is a system namespace, deploy AWX into a dedicated namespace", cfg.Namespace))
+			break
+		}
+	}
+
+	if cfg.OperatorClusterScoped && cfg.Namespace == cfg.OperatorNamespace {
+		problems = append(problems, fmt.Sprintf("AWX_NAMESPACE %s is the namespace of the cluster-scoped operator, set AWX_OPERATOR_NAMESPACE or deploy AWX into another namespace", cfg.Namespace))
+	}
+
+	return problems
+}
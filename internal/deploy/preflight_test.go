@@ -0,0 +1,91 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNamespaceCheckerCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// wantProblems are parts of the expected problems, in order
+		wantProblems []string
+	}{
+		{
+			name: "dedicated namespace with the operator next to AWX",
+			env:  map[string]string{"AWX_NAMESPACE": "awx"},
+		},
+		{
+			name:         "default namespace",
+			env:          map[string]string{"AWX_NAMESPACE": "default"},
+			wantProblems: []string{"AWX_NAMESPACE default is a system namespace"},
+		},
+		{
+			name:         "kube-system namespace",
+			env:          map[string]string{"AWX_NAMESPACE": "kube-system"},
+			wantProblems: []string{"AWX_NAMESPACE kube-system is a system namespace"},
+		},
+		{
+			name:         "configured system namespaces",
+			env:          map[string]string{"AWX_NAMESPACE": "platform", "AWX_SYSTEM_NAMESPACES": "platform,infra"},
+			wantProblems: []string{"AWX_NAMESPACE platform is a system namespace"},
+		},
+		{
+			name: "default allowed when not in the configured list",
+			env:  map[string]string{"AWX_NAMESPACE": "default", "AWX_SYSTEM_NAMESPACES": "kube-system"},
+		},
+		{
+			name:         "cluster-scoped operator in the AWX namespace",
+			env:          map[string]string{"AWX_NAMESPACE": "awx", "AWX_OPERATOR_CLUSTER_SCOPED": "true"},
+			wantProblems: []string{"AWX_NAMESPACE awx is the namespace of the cluster-scoped operator"},
+		},
+		{
+			name: "cluster-scoped operator in its own namespace",
+			env:  map[string]string{"AWX_NAMESPACE": "awx", "AWX_OPERATOR_CLUSTER_SCOPED": "true", "AWX_OPERATOR_NAMESPACE": "awx-operator"},
+		},
+		{
+			name: "both problems",
+			env:  map[string]string{"AWX_NAMESPACE": "default", "AWX_OPERATOR_CLUSTER_SCOPED": "true"},
+			wantProblems: []string{
+				"AWX_NAMESPACE default is a system namespace",
+				"AWX_NAMESPACE default is the namespace of the cluster-scoped operator",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, strict := range []bool{false, true} {
+			name := tt.name
+			if strict {
+				name += " strict"
+			}
+			t.Run(name, func(t *testing.T) {
+				env := map[string]string{}
+				for key, value := range tt.env {
+					env[key] = value
+				}
+				if strict {
+					env["AWX_TREAT_WARNINGS_AS_ERRORS"] = "true"
+				}
+				cfg := testConfig(t, env)
+
+				problems := namespaceProblems(cfg)
+				if len(problems) != len(tt.wantProblems) {
+					t.Fatalf("namespaceProblems() = %q, want %d problems", problems, len(tt.wantProblems))
+				}
+				for i, want := range tt.wantProblems {
+					if !strings.Contains(problems[i], want) {
+						t.Errorf("problem %d = %q, want it to contain %q", i, problems[i], want)
+					}
+				}
+
+				err := NewNamespaceChecker(cfg).Check()
+				wantErr := strict && len(tt.wantProblems) > 0
+				if (err != nil) != wantErr {
+					t.Errorf("Check() error = %v, want error %v", err, wantErr)
+				}
+			})
+		}
+	}
+}
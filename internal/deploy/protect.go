@@ -0,0 +1,102 @@
+package deploy
+
+import (
+	"log"
+	"reflect"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+)
+
+// protectFields applies AWX_PROTECTED_FIELDS to an object about to update
+// current: protected fields the update would change are set back to their
+// live value, or dropped if the live object does not have them, and the
+// skipped change is logged. It reports false if the whole object is
+// protected and must not be updated at all.
+func protectFields(obj, current *unstructured.Unstructured, protections []config.FieldProtection) bool {
+	for _, protection := range protections {
+		if !protection.Matches(obj.GetKind(), obj.GetName()) {
+			continue
+		}
+		if len(protection.Path) == 0 {
+			log.Printf("Warning: Not updating %s, it is protected (AWX_PROTECTED_FIELDS)", describeObject(obj))
+			return false
+		}
+
+		desired, inDesired := fieldValue(obj.Object, protection.Path)
+		live, inLive := fieldValue(current.Object, protection.Path)
+		if inDesired == inLive && reflect.DeepEqual(desired, live) {
+			continue
+		}
+
+		if inLive {
+			setFieldValue(obj.Object, protection.Path, live)
+		} else {
+			removeFieldValue(obj.Object, protection.Path)
+		}
+		if isSecretData(obj, protection.Path) {
+			// stringData would overwrite the live data on write
+			unstructured.RemoveNestedField(obj.Object, "stringData", protection.Path[1])
+		}
+		log.Printf("Warning: Not changing protected field %s of %s (AWX_PROTECTED_FIELDS)", protection.FieldPath(), describeObject(obj))
+	}
+	return true
+}
+
+// isSecretData reports whether a field path names a key of a Secret's data
+func isSecretData(obj *unstructured.Unstructured, path []string) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == "" && gvk.Kind == "Secret" && len(path) == 2 && path[0] == "data"
+}
+
+// setFieldValue sets the field at a path through maps and lists, creating
+// missing maps on the way. A list index out of range leaves the object
+// unchanged.
+func setFieldValue(obj map[string]interface{}, path []string, value interface{}) {
+	var parent interface{} = obj
+	for i, segment := range path {
+		last := i == len(path)-1
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			if last {
+				v[segment] = value
+				return
+			}
+			next, ok := v[segment]
+			if !ok || next == nil {
+				next = map[string]interface{}{}
+				v[segment] = next
+			}
+			parent = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return
+			}
+			if last {
+				v[index] = value
+				return
+			}
+			parent = v[index]
+		default:
+			return
+		}
+	}
+}
+
+// removeFieldValue removes the field at a path through maps and lists.
+// Only map keys are removed, list entries keep their place.
+func removeFieldValue(obj map[string]interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	var parent interface{} = obj
+	if len(path) > 1 {
+		parent, _ = fieldValue(obj, path[:len(path)-1])
+	}
+	if m, ok := parent.(map[string]interface{}); ok {
+		delete(m, path[len(path)-1])
+	}
+}
@@ -0,0 +1,132 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// projectsClaim returns the managed PVC awx-projects-claim with the given
+// storage request and label value
+func projectsClaim(storage, tier string) *unstructured.Unstructured {
+	obj := k8stest.Object("v1", "PersistentVolumeClaim", "awx", "awx-projects-claim")
+	obj.SetLabels(map[string]string{ManagedByLabel: ManagedByValue, "tier": tier})
+	unstructured.SetNestedField(obj.Object, storage, "spec", "resources", "requests", "storage")
+	return obj
+}
+
+// postgresSecret returns the managed Secret awx-postgres-configuration
+// with the given data
+func postgresSecret(data map[string]string) *unstructured.Unstructured {
+	obj := k8stest.Object("v1", "Secret", "awx", "awx-postgres-configuration")
+	obj.SetLabels(map[string]string{ManagedByLabel: ManagedByValue})
+	if data != nil {
+		unstructured.SetNestedStringMap(obj.Object, data, "data")
+	}
+	return obj
+}
+
+func TestApplyManifestProtectedFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		protection string
+		existing   *unstructured.Unstructured
+		desired    *unstructured.Unstructured
+		// want are the field values of the live object afterwards by their
+		// dotted path, nil for a field it must not have
+		want map[string]interface{}
+	}{
+		{
+			name:       "protected field skipped, other fields updated",
+			protection: "PersistentVolumeClaim/awx-projects-claim:.spec.resources.requests.storage",
+			existing:   projectsClaim("8Gi", "standard"),
+			desired:    projectsClaim("20Gi", "fast"),
+			want:       map[string]interface{}{".spec.resources.requests.storage": "8Gi", ".metadata.labels.tier": "fast"},
+		},
+		{
+			name:       "kind matched case-insensitively",
+			protection: "persistentvolumeclaim/awx-projects-claim:.spec.resources.requests.storage",
+			existing:   projectsClaim("8Gi", "standard"),
+			desired:    projectsClaim("20Gi", "fast"),
+			want:       map[string]interface{}{".spec.resources.requests.storage": "8Gi", ".metadata.labels.tier": "fast"},
+		},
+		{
+			name:       "unprotected field updated",
+			protection: "PersistentVolumeClaim/awx-projects-claim:.spec.storageClassName",
+			existing:   projectsClaim("8Gi", "standard"),
+			desired:    projectsClaim("20Gi", "fast"),
+			want:       map[string]interface{}{".spec.resources.requests.storage": "20Gi", ".metadata.labels.tier": "fast"},
+		},
+		{
+			name:       "other object unaffected",
+			protection: "PersistentVolumeClaim/awx-postgres-claim:.spec.resources.requests.storage",
+			existing:   projectsClaim("8Gi", "standard"),
+			desired:    projectsClaim("20Gi", "fast"),
+			want:       map[string]interface{}{".spec.resources.requests.storage": "20Gi"},
+		},
+		{
+			name:       "whole object protected",
+			protection: "PersistentVolumeClaim/awx-projects-claim",
+			existing:   projectsClaim("8Gi", "standard"),
+			desired:    projectsClaim("20Gi", "fast"),
+			want:       map[string]interface{}{".spec.resources.requests.storage": "8Gi", ".metadata.labels.tier": "standard"},
+		},
+		{
+			name:       "protected field missing live left out",
+			protection: "Secret/awx-postgres-configuration:.data[password]",
+			existing:   postgresSecret(map[string]string{"host": "b2xk"}),
+			desired:    postgresSecret(map[string]string{"host": "bmV3", "password": "bmV3"}),
+			want:       map[string]interface{}{".data.host": "bmV3", ".data.password": nil},
+		},
+		{
+			name:       "secret data key protected from stringData",
+			protection: "Secret/awx-postgres-configuration:.data[password]",
+			existing:   postgresSecret(map[string]string{"password": "b2xk"}),
+			desired: func() *unstructured.Unstructured {
+				obj := postgresSecret(nil)
+				unstructured.SetNestedStringMap(obj.Object, map[string]string{"password": "new", "host": "postgres"}, "stringData")
+				return obj
+			}(),
+			want: map[string]interface{}{".data.password": "b2xk", ".stringData.password": nil, ".stringData.host": "postgres"},
+		},
+		{
+			name:       "created despite protection",
+			protection: "PersistentVolumeClaim/awx-projects-claim",
+			desired:    projectsClaim("20Gi", "fast"),
+			want:       map[string]interface{}{".spec.resources.requests.storage": "20Gi"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster()
+			if tt.existing != nil {
+				cluster = k8stest.NewCluster(tt.existing)
+			}
+			applier := NewManifestApplier(cluster.Client, testConfig(t, map[string]string{"AWX_PROTECTED_FIELDS": tt.protection}))
+
+			if _, err := applier.applyManifest(context.Background(), Manifest{Source: "20-storage.yaml", Object: tt.desired}, nil); err != nil {
+				t.Fatalf("applyManifest() failed: %v", err)
+			}
+
+			live, err := cluster.Client.GetObject(context.Background(), tt.desired)
+			if err != nil || live == nil {
+				t.Fatalf("GetObject() = %v, %v", live, err)
+			}
+			for path, want := range tt.want {
+				got, found := fieldValue(live.Object, strings.Split(strings.TrimPrefix(path, "."), "."))
+				if !found {
+					got = nil
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %v, want %v", path, got, want)
+				}
+			}
+		})
+	}
+}
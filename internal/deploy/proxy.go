@@ -0,0 +1,97 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"awx-deployer/internal/config"
+)
+
+// proxyEnvFields are the AWX CR fields holding extra environment variables,
+// as a YAML list, for the web, task and execution environment containers
+var proxyEnvFields = []string{"web_extra_env", "task_extra_env", "ee_extra_env"}
+
+// clusterNoProxy are destinations inside the cluster that must never go
+// through the proxy
+var clusterNoProxy = []string{"localhost", "127.0.0.1", ".svc", ".cluster.local"}
+
+// envVar is an entry of an extra env list
+type envVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// applyProxyEnv adds the proxy settings to the extra environment of the AWX
+// containers when proxy propagation is enabled. Variables the manifest
+// already sets are kept.
+func applyProxyEnv(obj *unstructured.Unstructured, cfg *config.Config) error {
+	if !cfg.PropagateProxy {
+		return nil
+	}
+
+	proxyEnv := proxyEnvVars(cfg)
+	if len(proxyEnv) == 0 {
+		return nil
+	}
+
+	for _, field := range proxyEnvFields {
+		var env []envVar
+		if existing, _, _ := unstructured.NestedString(obj.Object, "spec", field); existing != "" {
+			if err := yaml.Unmarshal([]byte(existing), &env); err != nil {
+				return fmt.Errorf("failed to parse spec.%s: %v", field, err)
+			}
+		}
+
+		set := map[string]bool{}
+		for _, v := range env {
+			set[v.Name] = true
+		}
+		for _, v := range proxyEnv {
+			if !set[v.Name] {
+				env = append(env, v)
+			}
+		}
+
+		data, err := yaml.Marshal(env)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(obj.Object, string(data), "spec", field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proxyEnvVars returns the proxy variables in upper and lower case, since
+// tools disagree on which one they read. NO_PROXY always includes the
+// cluster-internal destinations.
+func proxyEnvVars(cfg *config.Config) []envVar {
+	proxy := cfg.ProxyConfig()
+	if proxy.HTTPProxy == "" && proxy.HTTPSProxy == "" {
+		return nil
+	}
+
+	noProxy := append([]string(nil), clusterNoProxy...)
+	for _, entry := range strings.Split(proxy.NoProxy, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			noProxy = append(noProxy, entry)
+		}
+	}
+
+	var env []envVar
+	for _, v := range []envVar{
+		{"HTTP_PROXY", proxy.HTTPProxy},
+		{"HTTPS_PROXY", proxy.HTTPSProxy},
+		{"NO_PROXY", strings.Join(noProxy, ",")},
+	} {
+		if v.Value == "" {
+			continue
+		}
+		env = append(env, v, envVar{strings.ToLower(v.Name), v.Value})
+	}
+	return env
+}
@@ -0,0 +1,147 @@
+package deploy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// clearProxyEnv unsets the proxy variables of the environment
+func clearProxyEnv(t *testing.T) {
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestApplyProxyEnv(t *testing.T) {
+	proxied := "- name: HTTP_PROXY\n  value: http://proxy.corp.example:8080\n" +
+		"- name: http_proxy\n  value: http://proxy.corp.example:8080\n" +
+		"- name: HTTPS_PROXY\n  value: http://proxy.corp.example:8080\n" +
+		"- name: https_proxy\n  value: http://proxy.corp.example:8080\n" +
+		"- name: NO_PROXY\n  value: localhost,127.0.0.1,.svc,.cluster.local,.corp.example\n" +
+		"- name: no_proxy\n  value: localhost,127.0.0.1,.svc,.cluster.local,.corp.example\n"
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		extraEnv string
+		want     map[string]string
+	}{
+		{
+			name: "not propagated",
+			env:  map[string]string{"AWX_PROXY_URL": "http://proxy.corp.example:8080"},
+			want: map[string]string{"web_extra_env": "", "task_extra_env": "", "ee_extra_env": ""},
+		},
+		{
+			name: "no proxy configured",
+			env:  map[string]string{"AWX_PROPAGATE_PROXY": "true"},
+			want: map[string]string{"web_extra_env": "", "task_extra_env": "", "ee_extra_env": ""},
+		},
+		{
+			name: "propagated",
+			env:  map[string]string{"AWX_PROPAGATE_PROXY": "true", "AWX_PROXY_URL": "http://proxy.corp.example:8080", "NO_PROXY": ".corp.example"},
+			want: map[string]string{"web_extra_env": proxied, "task_extra_env": proxied, "ee_extra_env": proxied},
+		},
+		{
+			name:     "manifest variables are kept",
+			env:      map[string]string{"AWX_PROPAGATE_PROXY": "true", "AWX_PROXY_URL": "http://proxy.corp.example:8080", "NO_PROXY": ".corp.example"},
+			extraEnv: "- name: HTTP_PROXY\n  value: http://other.example:3128\n- name: TZ\n  value: UTC\n",
+			want: map[string]string{
+				"web_extra_env": "- name: HTTP_PROXY\n  value: http://other.example:3128\n- name: TZ\n  value: UTC\n" +
+					strings.SplitN(proxied, "\n", 3)[2],
+				"task_extra_env": proxied,
+				"ee_extra_env":   proxied,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearProxyEnv(t)
+			cfg := testConfig(t, tt.env)
+			obj := k8stest.AWX("awx", "awx-instance")
+			if tt.extraEnv != "" {
+				unstructured.SetNestedField(obj.Object, tt.extraEnv, "spec", "web_extra_env")
+			}
+
+			if err := applyProxyEnv(obj, cfg); err != nil {
+				t.Fatalf("applyProxyEnv() failed: %v", err)
+			}
+			for field, want := range tt.want {
+				if got, _, _ := unstructured.NestedString(obj.Object, "spec", field); got != want {
+					t.Errorf("spec.%s = %q, want %q", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifierAPIClientProxy(t *testing.T) {
+	// proxy answers the ping as AWX, recording the hosts the requests were for
+	var proxiedHosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHosts = append(proxiedHosts, r.URL.Host)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version": "23.0.0"}`))
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantProxied []string
+	}{
+		{
+			name:        "AWX_PROXY_URL",
+			env:         map[string]string{"AWX_HOSTNAME": "awx.example.com", "AWX_PROXY_URL": proxy.URL},
+			wantProxied: []string{"awx.example.com"},
+		},
+		{
+			name:        "HTTP_PROXY",
+			env:         map[string]string{"AWX_HOSTNAME": "awx.example.com", "HTTP_PROXY": proxy.URL},
+			wantProxied: []string{"awx.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearProxyEnv(t)
+			proxiedHosts = nil
+			env := map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": "awx-instance", "AWX_TLS": "false"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cluster := k8stest.NewCluster(
+				k8stest.AWX("awx", "awx-instance"),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "awx-instance-admin-password", Namespace: "awx"},
+					Data:       map[string][]byte{"password": []byte("Admin-Pass-1")},
+				},
+			)
+			v := NewDeploymentVerifier(cluster.Client, testConfig(t, env))
+
+			client, _, _, err := v.apiClient(context.Background())
+			if err != nil {
+				t.Fatalf("apiClient() failed: %v", err)
+			}
+			status, err := client.Ping(context.Background())
+			if err != nil {
+				t.Fatalf("Ping() failed: %v", err)
+			}
+			if status.Version != "23.0.0" {
+				t.Errorf("version = %q, want 23.0.0", status.Version)
+			}
+			if strings.Join(proxiedHosts, ",") != strings.Join(tt.wantProxied, ",") {
+				t.Errorf("proxied requests for %v, want %v", proxiedHosts, tt.wantProxied)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// PSAEnforceLabel is the namespace label PodSecurity admission enforces
+const PSAEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+// psaLevels ranks the PodSecurity levels from least to most strict
+var psaLevels = map[string]int{
+	"privileged": 0,
+	"baseline":   1,
+	"restricted": 2,
+}
+
+// psaLabels returns the PodSecurity labels for namespaces the deployer
+// creates, nil when AWX_PSA_ENFORCE is not set
+func psaLabels(cfg *config.Config) map[string]string {
+	if cfg.PSAEnforce == "" {
+		return nil
+	}
+	return map[string]string{PSAEnforceLabel: cfg.PSAEnforce}
+}
+
+// applyPSALabels adds the PodSecurity labels to a Namespace object
+func applyPSALabels(obj *unstructured.Unstructured, cfg *config.Config) {
+	labels := psaLabels(cfg)
+	if obj.GetKind() != "Namespace" || labels == nil {
+		return
+	}
+
+	merged := obj.GetLabels()
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	obj.SetLabels(merged)
+}
+
+// requiredPSALevel returns the strictest PodSecurity level AWX pods pass.
+// The operator defaults meet baseline, AWX_PSS_PROFILE=restricted makes them
+// meet restricted.
+func requiredPSALevel(cfg *config.Config) string {
+	if cfg.PSSProfile == config.PSSProfileRestricted {
+		return "restricted"
+	}
+	return "baseline"
+}
+
+// PSAChecker flags an AWX namespace whose PodSecurity level would reject the
+// AWX pods
+type PSAChecker struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewPSAChecker creates a new PodSecurity admission checker
+func NewPSAChecker(k8sClient *k8s.KubernetesClient, config *config.Config) *PSAChecker {
+	return &PSAChecker{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Check logs a warning for each PodSecurity problem of the AWX namespace, or
+// returns them as an error when warnings are treated as errors
+func (c *PSAChecker) Check(ctx context.Context) error {
+	problems, err := c.Problems(ctx)
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if c.config.TreatWarningsAsErrors {
+		return fmt.Errorf("PodSecurity check failed: %s", strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		log.Printf("Warning: %s", problem)
+	}
+	return nil
+}
+
+// Problems compares the level AWX pods need with the level the AWX namespace
+// will enforce: AWX_PSA_ENFORCE when set, since the deployer labels the
+// namespace with it, otherwise the label of the existing namespace
+func (c *PSAChecker) Problems(ctx context.Context) ([]string, error) {
+	required := requiredPSALevel(c.config)
+
+	if c.config.PSAEnforce != "" {
+		if psaLevels[c.config.PSAEnforce] > psaLevels[required] {
+			return []string{fmt.Sprintf("AWX_PSA_ENFORCE=%s is stricter than the %s level AWX pods meet, they will be rejected (set AWX_PSS_PROFILE=restricted or a lower AWX_PSA_ENFORCE)", c.config.PSAEnforce, required)}, nil
+		}
+		return nil, nil
+	}
+
+	ns, err := c.k8sClient.GetNamespace(ctx, c.config.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if ns == nil {
+		return nil, nil
+	}
+	level, ok := ns.Labels[PSAEnforceLabel]
+	if !ok {
+		return nil, nil
+	}
+	rank, known := psaLevels[level]
+	if !known {
+		return []string{fmt.Sprintf("namespace %s has unknown PodSecurity level %s=%s", c.config.Namespace, PSAEnforceLabel, level)}, nil
+	}
+	if rank > psaLevels[required] {
+		return []string{fmt.Sprintf("namespace %s enforces PodSecurity level %s, stricter than the %s level AWX pods meet, they will be rejected (set AWX_PSS_PROFILE=restricted or AWX_PSA_ENFORCE=%s)", c.config.Namespace, level, required, required)}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,175 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestGeneratePSALabels(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{name: "not set"},
+		{name: "baseline", env: map[string]string{"AWX_PSA_ENFORCE": "baseline"}, want: "baseline"},
+		{name: "restricted", env: map[string]string{"AWX_PSA_ENFORCE": "restricted", "AWX_PSS_PROFILE": "restricted"}, want: "restricted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifests, err := NewManifestGenerator(testConfig(t, tt.env), manifestsDir).Generate()
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+			namespaces := 0
+			for _, manifest := range manifests {
+				level, ok := manifest.Object.GetLabels()[PSAEnforceLabel]
+				if manifest.Object.GetKind() != "Namespace" {
+					if ok {
+						t.Errorf("%s %s labeled %s=%s, want only namespaces labeled", manifest.Object.GetKind(), manifest.Object.GetName(), PSAEnforceLabel, level)
+					}
+					continue
+				}
+				namespaces++
+				if level != tt.want {
+					t.Errorf("namespace %s %s = %q, want %q", manifest.Object.GetName(), PSAEnforceLabel, level, tt.want)
+				}
+			}
+			if namespaces == 0 {
+				t.Fatal("Generate() returned no namespace")
+			}
+		})
+	}
+}
+
+func TestEnsureNamespacePSALabels(t *testing.T) {
+	existing := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "awx", Labels: map[string]string{PSAEnforceLabel: "restricted"}}}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    map[string]string
+	}{
+		{
+			name: "created with the labels",
+			want: map[string]string{PSAEnforceLabel: "baseline"},
+		},
+		{
+			name:    "existing labels left alone",
+			objects: []runtime.Object{existing},
+			want:    map[string]string{PSAEnforceLabel: "restricted"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_PSA_ENFORCE": "baseline"})
+			client := k8stest.NewCluster(tt.objects...).Client
+			if err := client.EnsureNamespace(context.Background(), "awx", psaLabels(cfg)); err != nil {
+				t.Fatalf("EnsureNamespace() failed: %v", err)
+			}
+			ns, err := client.GetNamespace(context.Background(), "awx")
+			if err != nil || ns == nil {
+				t.Fatalf("GetNamespace() = %v, %v, want the namespace", ns, err)
+			}
+			if !reflect.DeepEqual(ns.Labels, tt.want) {
+				t.Errorf("namespace labels = %v, want %v", ns.Labels, tt.want)
+			}
+		})
+	}
+}
+
+func TestPSAProblems(t *testing.T) {
+	namespace := func(level string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "awx", Labels: map[string]string{PSAEnforceLabel: level}}}
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		objects []runtime.Object
+		want    string
+	}{
+		{
+			name: "no namespace yet",
+		},
+		{
+			name:    "namespace without label",
+			objects: []runtime.Object{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "awx"}}},
+		},
+		{
+			name:    "baseline namespace",
+			objects: []runtime.Object{namespace("baseline")},
+		},
+		{
+			name:    "restricted namespace",
+			objects: []runtime.Object{namespace("restricted")},
+			want:    "namespace awx enforces PodSecurity level restricted, stricter than the baseline level AWX pods meet, they will be rejected (set AWX_PSS_PROFILE=restricted or AWX_PSA_ENFORCE=baseline)",
+		},
+		{
+			name:    "restricted namespace with restricted pods",
+			env:     map[string]string{"AWX_PSS_PROFILE": "restricted"},
+			objects: []runtime.Object{namespace("restricted")},
+		},
+		{
+			name:    "unknown level",
+			objects: []runtime.Object{namespace("strict")},
+			want:    "namespace awx has unknown PodSecurity level pod-security.kubernetes.io/enforce=strict",
+		},
+		{
+			name:    "configured level replaces the namespace label",
+			env:     map[string]string{"AWX_PSA_ENFORCE": "privileged"},
+			objects: []runtime.Object{namespace("restricted")},
+		},
+		{
+			name: "configured level too strict",
+			env:  map[string]string{"AWX_PSA_ENFORCE": "restricted"},
+			want: "AWX_PSA_ENFORCE=restricted is stricter than the baseline level AWX pods meet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_NAMESPACE": "awx"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cfg := testConfig(t, env)
+			checker := NewPSAChecker(k8stest.NewCluster(tt.objects...).Client, cfg)
+
+			problems, err := checker.Problems(context.Background())
+			if err != nil {
+				t.Fatalf("Problems() failed: %v", err)
+			}
+			if tt.want == "" {
+				if len(problems) > 0 {
+					t.Errorf("Problems() = %q, want none", problems)
+				}
+			} else if len(problems) != 1 || !strings.Contains(problems[0], tt.want) {
+				t.Errorf("Problems() = %q, want %q", problems, tt.want)
+			}
+
+			// Problems are warnings unless warnings are treated as errors
+			if err := checker.Check(context.Background()); err != nil {
+				t.Errorf("Check() failed: %v", err)
+			}
+			cfg.TreatWarningsAsErrors = true
+			err = checker.Check(context.Background())
+			if tt.want == "" && err != nil {
+				t.Errorf("strict Check() failed: %v", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), "PodSecurity check failed: "+tt.want)) {
+				t.Errorf("strict Check() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// OperatorRBACChecker checks that the RBAC objects the operator needs are in
+// place. An operator missing them keeps running, but its reconcile fails on
+// permission errors that only show in its logs.
+type OperatorRBACChecker struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewOperatorRBACChecker creates a new operator RBAC checker
+func NewOperatorRBACChecker(k8sClient *k8s.KubernetesClient, config *config.Config) *OperatorRBACChecker {
+	return &OperatorRBACChecker{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Check fails with every missing piece of the operator's RBAC
+func (c *OperatorRBACChecker) Check(ctx context.Context) error {
+	problems, err := c.Problems(ctx)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("operator RBAC is incomplete: %s", strings.Join(problems, "; "))
+	}
+
+	log.Printf("✓ Operator service account and role bindings are in place")
+	return nil
+}
+
+// Problems returns the missing pieces of the operator's RBAC: its service
+// account, a RoleBinding or ClusterRoleBinding referencing the service
+// account, and the roles those bindings refer to. The service account also
+// needs a binding that applies to the AWX namespace, i.e. a RoleBinding there
+// or a ClusterRoleBinding, and a ClusterRoleBinding when the operator is
+// cluster-scoped.
+func (c *OperatorRBACChecker) Problems(ctx context.Context) ([]string, error) {
+	deployment, err := c.k8sClient.GetDeployment(ctx, operatorDeployment, c.config.OperatorNamespace)
+	if err != nil {
+		return nil, err
+	}
+	account := deployment.Spec.Template.Spec.ServiceAccountName
+	if account == "" {
+		account = "default"
+	}
+	subject := c.config.OperatorNamespace + "/" + account
+
+	var problems []string
+	exists, err := c.k8sClient.ResourceExists(ctx, "", "v1", "serviceaccounts", account, c.config.OperatorNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		problems = append(problems, fmt.Sprintf("service account %s does not exist", subject))
+	}
+
+	bindings, err := c.bindings(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if len(bindings) == 0 {
+		return append(problems, fmt.Sprintf("no RoleBinding or ClusterRoleBinding references service account %s", subject)), nil
+	}
+
+	coversAWXNamespace, coversAllNamespaces := false, false
+	for _, binding := range bindings {
+		exists, err := c.roleExists(ctx, binding)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			problems = append(problems, fmt.Sprintf("%s %s references missing %s %s", binding.kind, binding.name, binding.roleRef.Kind, binding.roleRef.Name))
+			continue
+		}
+		if binding.namespace == "" || binding.namespace == c.config.Namespace {
+			coversAWXNamespace = true
+		}
+		if binding.namespace == "" {
+			coversAllNamespaces = true
+		}
+	}
+	if !coversAWXNamespace {
+		problems = append(problems, fmt.Sprintf("no RoleBinding in namespace %s or ClusterRoleBinding grants service account %s access", c.config.Namespace, subject))
+	} else if c.config.OperatorClusterScoped && !coversAllNamespaces {
+		problems = append(problems, fmt.Sprintf("AWX_OPERATOR_CLUSTER_SCOPED is set but only RoleBindings grant service account %s access, a cluster-scoped operator needs a ClusterRoleBinding", subject))
+	}
+	return problems, nil
+}
+
+// roleBinding is a RoleBinding or ClusterRoleBinding. Its namespace is
+// empty for a ClusterRoleBinding.
+type roleBinding struct {
+	kind      string
+	name      string
+	namespace string
+	roleRef   rbacv1.RoleRef
+}
+
+// bindings returns the ClusterRoleBindings and the RoleBindings in the
+// operator and AWX namespaces that reference the operator's service account
+func (c *OperatorRBACChecker) bindings(ctx context.Context, account string) ([]roleBinding, error) {
+	var bindings []roleBinding
+
+	clusterBindings, err := c.k8sClient.ListClusterRoleBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range clusterBindings {
+		if referencesServiceAccount(binding.Subjects, "", c.config.OperatorNamespace, account) {
+			bindings = append(bindings, roleBinding{"ClusterRoleBinding", binding.Name, "", binding.RoleRef})
+		}
+	}
+
+	namespaces := []string{c.config.OperatorNamespace}
+	if c.config.Namespace != c.config.OperatorNamespace {
+		namespaces = append(namespaces, c.config.Namespace)
+	}
+	for _, namespace := range namespaces {
+		namespaceBindings, err := c.k8sClient.ListRoleBindings(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, binding := range namespaceBindings {
+			if referencesServiceAccount(binding.Subjects, namespace, c.config.OperatorNamespace, account) {
+				bindings = append(bindings, roleBinding{"RoleBinding", namespace + "/" + binding.Name, namespace, binding.RoleRef})
+			}
+		}
+	}
+	return bindings, nil
+}
+
+// roleExists reports whether the Role or ClusterRole a binding refers to
+// exists
+func (c *OperatorRBACChecker) roleExists(ctx context.Context, binding roleBinding) (bool, error) {
+	if binding.roleRef.Kind == "ClusterRole" {
+		return c.k8sClient.ResourceExists(ctx, rbacv1.GroupName, "v1", "clusterroles", binding.roleRef.Name, "")
+	}
+	return c.k8sClient.ResourceExists(ctx, rbacv1.GroupName, "v1", "roles", binding.roleRef.Name, binding.namespace)
+}
+
+// referencesServiceAccount reports whether binding subjects include a
+// service account. A service account subject of a RoleBinding without a
+// namespace is in the binding's namespace.
+func referencesServiceAccount(subjects []rbacv1.Subject, bindingNamespace, namespace, name string) bool {
+	for _, subject := range subjects {
+		if subject.Kind != rbacv1.ServiceAccountKind || subject.Name != name {
+			continue
+		}
+		subjectNamespace := subject.Namespace
+		if subjectNamespace == "" {
+			subjectNamespace = bindingNamespace
+		}
+		if subjectNamespace == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// operatorRoleBinding returns a RoleBinding of the operator's service account
+// in the awx-operator namespace to a role
+func operatorRoleBinding(namespace, name, roleKind, role string) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "awx-operator", Namespace: "awx-operator"}},
+		RoleRef:    rbacv1.RoleRef{Kind: roleKind, Name: role},
+	}
+}
+
+// withoutKinds returns the objects that are none of the given types
+func withoutKinds(objects []runtime.Object, drop ...runtime.Object) []runtime.Object {
+	var kept []runtime.Object
+	for _, obj := range objects {
+		dropped := false
+		for _, kind := range drop {
+			dropped = dropped || reflect.TypeOf(obj) == reflect.TypeOf(kind)
+		}
+		if !dropped {
+			kept = append(kept, obj)
+		}
+	}
+	return kept
+}
+
+func TestOperatorRBACProblems(t *testing.T) {
+	complete := operatorObjects("awx-operator")
+	// noClusterBinding returns the complete install without its
+	// ClusterRoleBinding, plus the given objects
+	noClusterBinding := func(extra ...runtime.Object) []runtime.Object {
+		return append(withoutKinds(complete, &rbacv1.ClusterRoleBinding{}), extra...)
+	}
+	namespaceRole := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "awx-operator", Namespace: "awx"}}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		objects []runtime.Object
+		want    []string
+	}{
+		{
+			name:    "complete install",
+			objects: complete,
+		},
+		{
+			name:    "service account missing",
+			objects: withoutKinds(complete, &corev1.ServiceAccount{}),
+			want:    []string{"service account awx-operator/awx-operator does not exist"},
+		},
+		{
+			name:    "no binding",
+			objects: noClusterBinding(),
+			want:    []string{"no RoleBinding or ClusterRoleBinding references service account awx-operator/awx-operator"},
+		},
+		{
+			name:    "cluster role missing",
+			objects: withoutKinds(complete, &rbacv1.ClusterRole{}),
+			want: []string{
+				"ClusterRoleBinding awx-operator references missing ClusterRole awx-operator",
+				"no RoleBinding in namespace awx or ClusterRoleBinding grants service account awx-operator/awx-operator access",
+			},
+		},
+		{
+			name: "binding of a service account in another namespace",
+			objects: noClusterBinding(&rbacv1.ClusterRoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "awx-operator"},
+				Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "awx-operator", Namespace: "default"}},
+				RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "awx-operator"},
+			}),
+			want: []string{"no RoleBinding or ClusterRoleBinding references service account awx-operator/awx-operator"},
+		},
+		{
+			name:    "role binding in the AWX namespace",
+			objects: noClusterBinding(namespaceRole, operatorRoleBinding("awx", "awx-operator", "Role", "awx-operator")),
+		},
+		{
+			name:    "role binding in the operator namespace only",
+			objects: noClusterBinding(operatorRoleBinding("awx-operator", "awx-operator", "ClusterRole", "awx-operator")),
+			want:    []string{"no RoleBinding in namespace awx or ClusterRoleBinding grants service account awx-operator/awx-operator access"},
+		},
+		{
+			name:    "role binding to a missing role",
+			objects: noClusterBinding(operatorRoleBinding("awx", "awx-operator", "Role", "awx-operator")),
+			want: []string{
+				"RoleBinding awx/awx-operator references missing Role awx-operator",
+				"no RoleBinding in namespace awx or ClusterRoleBinding grants service account awx-operator/awx-operator access",
+			},
+		},
+		{
+			name:    "cluster-scoped operator with role bindings only",
+			env:     map[string]string{"AWX_OPERATOR_CLUSTER_SCOPED": "true"},
+			objects: noClusterBinding(namespaceRole, operatorRoleBinding("awx", "awx-operator", "Role", "awx-operator")),
+			want:    []string{"AWX_OPERATOR_CLUSTER_SCOPED is set but only RoleBindings grant service account awx-operator/awx-operator access, a cluster-scoped operator needs a ClusterRoleBinding"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_OPERATOR_NAMESPACE": "awx-operator"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cluster := k8stest.NewCluster(tt.objects...)
+			checker := NewOperatorRBACChecker(cluster.Client, testConfig(t, env))
+
+			problems, err := checker.Problems(context.Background())
+			if err != nil {
+				t.Fatalf("Problems() failed: %v", err)
+			}
+			if !reflect.DeepEqual(problems, tt.want) {
+				t.Errorf("Problems() = %q, want %q", problems, tt.want)
+			}
+
+			err = checker.Check(context.Background())
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Check() failed: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), "operator RBAC is incomplete: "+tt.want[0]) {
+				t.Errorf("Check() error = %v, want %q", err, tt.want[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+const (
+	// operatorDeployment is the AWX operator controller deployment
+	operatorDeployment = "awx-operator-controller-manager"
+	// operatorContainer is the operator container that runs the reconcile playbooks
+	operatorContainer = "awx-manager"
+	// operatorLogTailLines is how much of the operator log is scanned
+	operatorLogTailLines = 500
+	// reconcileFailureThreshold is how many failed tasks count as repeated failures
+	reconcileFailureThreshold = 2
+)
+
+// reconcileFailureMarkers identify failed Ansible task results in operator logs
+var reconcileFailureMarkers = []string{
+	"FAILED!",
+	"failed: True",
+	`"failed": true`,
+}
+
+var (
+	// logNamespacePattern and logNamePattern find the custom resource an
+	// operator log event is about
+	logNamespacePattern = regexp.MustCompile(`"namespace":\s*"([^"]*)"`)
+	logNamePattern      = regexp.MustCompile(`"name":\s*"([^"]*)"`)
+)
+
+// ReconcileChecker detects AWX operator reconcile failures that never surface
+// as pod failures
+type ReconcileChecker struct {
+	k8sClient  *k8s.KubernetesClient
+	config     *config.Config
+	conditions *conditionRules
+	// since is when the apply or wait started, the operator logs before it
+	// are not scanned. Zero scans the whole tail.
+	since time.Time
+}
+
+// NewReconcileChecker creates a new reconcile checker
+func NewReconcileChecker(k8sClient *k8s.KubernetesClient, config *config.Config) *ReconcileChecker {
+	return &ReconcileChecker{
+		k8sClient:  k8sClient,
+		config:     config,
+		conditions: newConditionRules(config),
+	}
+}
+
+// Check returns an error carrying the operator's own message if the AWX CR
+// reports a failure, or if operator log checks are enabled and the logs show
+// repeated failed reconcile tasks
+func (r *ReconcileChecker) Check(ctx context.Context) error {
+	if err := r.checkStatus(ctx); err != nil {
+		return err
+	}
+
+	if r.config.CheckOperatorLogs {
+		if err := r.checkLogs(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkStatus checks the AWX CR status for a failure condition
+func (r *ReconcileChecker) checkStatus(ctx context.Context) error {
+	awx, err := r.k8sClient.GetAWX(ctx, r.config.AWXName, r.config.Namespace)
+	if err != nil {
+		// the CR may not exist yet, which is handled by the callers
+		return nil
+	}
+	return r.conditionFailure(awx)
+}
+
+// conditionFailure returns an error if a status condition of the AWX CR
+// matches AWX_FAILURE_CONDITIONS and not AWX_WARNING_CONDITIONS
+func (r *ReconcileChecker) conditionFailure(awx *unstructured.Unstructured) error {
+	condition, failed := r.conditions.failed(awx)
+	if !failed {
+		return nil
+	}
+
+	message := condition.Message
+	if message == "" {
+		message = fmt.Sprintf("condition %s=%s (reason: %s)", condition.Type, condition.Status, condition.Reason)
+	}
+	return fmt.Errorf("operator reported reconcile failure for %s: %s", awx.GetName(), message)
+}
+
+// checkLogs scans the operator logs since the apply or wait started for
+// failed reconcile tasks of the instance
+func (r *ReconcileChecker) checkLogs(ctx context.Context) error {
+	logs, err := r.k8sClient.GetPodLogsSince(ctx, r.config.OperatorPodSelector, r.config.OperatorNamespace, operatorContainer, operatorLogTailLines, r.since)
+	if err != nil {
+		return fmt.Errorf("failed to read operator logs: %v", err)
+	}
+
+	failures, lastFailure := findReconcileFailures(logs, r.config.Namespace, r.config.AWXName)
+	if failures >= reconcileFailureThreshold {
+		return fmt.Errorf("operator failed %d reconcile tasks, last error: %s", failures, lastFailure)
+	}
+
+	return nil
+}
+
+// CheckPickedUp returns an error naming the likely cause when the AWX CR
+// exists but has no status at all, i.e. the operator never reconciled it:
+// the operator is missing, not ready or not watching the namespace. It
+// returns nil if the CR has a status, does not exist yet, or the operator
+// looks healthy.
+func (r *ReconcileChecker) CheckPickedUp(ctx context.Context) error {
+	awx, err := r.k8sClient.GetAWX(ctx, r.config.AWXName, r.config.Namespace)
+	if err != nil {
+		return nil
+	}
+	if status, _, _ := unstructured.NestedMap(awx.Object, "status"); len(status) > 0 {
+		return nil
+	}
+
+	if cause := r.operatorProblem(ctx); cause != "" {
+		return fmt.Errorf("operator not reconciling namespace %s: %s", r.config.Namespace, cause)
+	}
+	return nil
+}
+
+// operatorProblem describes why the operator cannot reconcile the AWX
+// namespace, or returns an empty string if no problem is found
+func (r *ReconcileChecker) operatorProblem(ctx context.Context) string {
+	exists, err := r.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", operatorDeployment, r.config.OperatorNamespace)
+	if err != nil {
+		return ""
+	}
+	if !exists {
+		return fmt.Sprintf("operator deployment %s not found in namespace %s", operatorDeployment, r.config.OperatorNamespace)
+	}
+
+	status, err := r.k8sClient.GetPodStatus(ctx, r.config.OperatorPodSelector, r.config.OperatorNamespace)
+	if err == nil && !status.Ready() {
+		return fmt.Sprintf("operator is not ready (status: %s, selector %s)", status, r.config.OperatorPodSelector)
+	}
+
+	if problems, err := NewOperatorRBACChecker(r.k8sClient, r.config).Problems(ctx); err == nil && len(problems) > 0 {
+		return fmt.Sprintf("operator RBAC is incomplete: %s", strings.Join(problems, "; "))
+	}
+
+	deployment, err := r.k8sClient.GetDeployment(ctx, operatorDeployment, r.config.OperatorNamespace)
+	if err != nil {
+		return ""
+	}
+	watched, all := watchedNamespaces(deployment, r.config.OperatorNamespace)
+	if all {
+		return ""
+	}
+	for _, namespace := range watched {
+		if namespace == r.config.Namespace {
+			return ""
+		}
+	}
+	return fmt.Sprintf("operator only watches %s (WATCH_NAMESPACE)", strings.Join(watched, ", "))
+}
+
+// watchedNamespaces returns the namespaces the operator reconciles according
+// to the WATCH_NAMESPACE variable of its container, or all when it watches
+// every namespace. WATCH_NAMESPACE taken from the pod's namespace means the
+// operator's own namespace.
+func watchedNamespaces(deployment *appsv1.Deployment, operatorNamespace string) ([]string, bool) {
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name != operatorContainer {
+			continue
+		}
+		for _, env := range container.Env {
+			if env.Name != "WATCH_NAMESPACE" {
+				continue
+			}
+			if env.ValueFrom != nil {
+				if env.ValueFrom.FieldRef != nil && env.ValueFrom.FieldRef.FieldPath == "metadata.namespace" {
+					return []string{operatorNamespace}, false
+				}
+				return nil, true
+			}
+			var namespaces []string
+			for _, namespace := range strings.Split(env.Value, ",") {
+				if namespace = strings.TrimSpace(namespace); namespace != "" {
+					namespaces = append(namespaces, namespace)
+				}
+			}
+			return namespaces, len(namespaces) == 0
+		}
+	}
+	return nil, true
+}
+
+// findReconcileFailures counts the failed task results of the AWX instance
+// in a namespace in operator logs and returns the most recent one. The
+// operator logs the task output of a failure without naming the instance and
+// then an event naming it, so failures are attributed to the next event.
+// Failures of other instances, failures the playbook ignores and failures no
+// event follows yet are not counted.
+func findReconcileFailures(logs, namespace, name string) (int, string) {
+	count := 0
+	last := ""
+	var pending []string
+	for _, line := range strings.Split(logs, "\n") {
+		line = strings.TrimSpace(line)
+		// Ansible prints "...ignoring" after a failed result the playbook
+		// goes on after, and the event of such a result has ignore_errors
+		if strings.HasPrefix(line, "...ignoring") {
+			if len(pending) > 0 {
+				pending = pending[:len(pending)-1]
+			}
+			continue
+		}
+		if strings.Contains(line, `"ignore_errors": true`) {
+			pending = nil
+			continue
+		}
+
+		eventNamespace := logNamespacePattern.FindStringSubmatch(line)
+		eventName := logNamePattern.FindStringSubmatch(line)
+		if eventNamespace == nil || eventName == nil {
+			if containsAny(line, reconcileFailureMarkers) {
+				pending = append(pending, line)
+			}
+			continue
+		}
+
+		failed := pending
+		pending = nil
+		if len(failed) == 0 && containsAny(line, reconcileFailureMarkers) {
+			failed = []string{line}
+		}
+		if eventNamespace[1] == namespace && eventName[1] == name && len(failed) > 0 {
+			count += len(failed)
+			last = failed[len(failed)-1]
+		}
+	}
+
+	// keep the message readable when the operator dumps a whole task result
+	if len(last) > 500 {
+		last = last[:500] + "..."
+	}
+	return count, last
+}
+
+// containsAny reports whether s contains any of the substrings
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
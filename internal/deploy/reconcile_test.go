@@ -0,0 +1,204 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// failedEvent is the operator log event following the task output of a
+// failed task of an AWX instance
+func failedEvent(namespace, name string) string {
+	return `{"level":"error","logger":"logging_event_handler","name":"` + name + `","namespace":"` + namespace + `","gvk":"awx.ansible.com/v1beta1, Kind=AWX","event_type":"runner_on_failed","error":"[playbook task failed]"}`
+}
+
+func TestFindReconcileFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		logs      string
+		wantCount int
+		wantLast  string
+	}{
+		{
+			name:      "no logs",
+			logs:      "",
+			wantCount: 0,
+		},
+		{
+			name: "successful reconcile",
+			logs: strings.Join([]string{
+				"TASK [installer : Apply deployment resources] ****",
+				"ok: [localhost] => {\"changed\": false}",
+				"PLAY RECAP *** localhost : ok=72 changed=0 unreachable=0 failed=0 skipped=40",
+				`{"level":"info","name":"awx-instance","namespace":"awx","event_type":"playbook_on_stats"}`,
+			}, "\n"),
+			wantCount: 0,
+		},
+		{
+			name: "single failure",
+			logs: strings.Join([]string{
+				"TASK [installer : Create Database if no database is specified] ****",
+				"fatal: [localhost]: FAILED! => {\"msg\": \"database unreachable\"}",
+				failedEvent("awx", "awx-instance"),
+			}, "\n"),
+			wantCount: 1,
+			wantLast:  "fatal: [localhost]: FAILED! => {\"msg\": \"database unreachable\"}",
+		},
+		{
+			name: "repeated failures report the last",
+			logs: strings.Join([]string{
+				`{"level":"error","msg":"task failed","name":"awx-instance","namespace":"awx","failed": true}`,
+				"ok: [localhost]",
+				"  failed: True",
+				"fatal: [localhost]: FAILED! => {\"msg\": \"secret awx-admin-password not found\"}",
+				failedEvent("awx", "awx-instance"),
+			}, "\n"),
+			wantCount: 3,
+			wantLast:  "fatal: [localhost]: FAILED! => {\"msg\": \"secret awx-admin-password not found\"}",
+		},
+		{
+			name:      "line with several markers counts once",
+			logs:      "fatal: FAILED! failed: True\n" + failedEvent("awx", "awx-instance"),
+			wantCount: 1,
+			wantLast:  "fatal: FAILED! failed: True",
+		},
+		{
+			name: "ignored failure",
+			logs: strings.Join([]string{
+				"TASK [installer : Check for existing database] ****",
+				"fatal: [localhost]: FAILED! => {\"msg\": \"not found\"}",
+				"...ignoring",
+				`{"level":"info","name":"awx-instance","namespace":"awx","event_type":"runner_on_failed","ignore_errors": true}`,
+			}, "\n"),
+			wantCount: 0,
+		},
+		{
+			name: "failures of other instances",
+			logs: strings.Join([]string{
+				"fatal: [localhost]: FAILED! => {\"msg\": \"other namespace\"}",
+				failedEvent("team-a", "awx-instance"),
+				"fatal: [localhost]: FAILED! => {\"msg\": \"other name\"}",
+				failedEvent("awx", "awx-other"),
+				"fatal: [localhost]: FAILED! => {\"msg\": \"this instance\"}",
+				failedEvent("awx", "awx-instance"),
+			}, "\n"),
+			wantCount: 1,
+			wantLast:  "fatal: [localhost]: FAILED! => {\"msg\": \"this instance\"}",
+		},
+		{
+			name:      "failure without its event yet",
+			logs:      "fatal: [localhost]: FAILED! => {\"msg\": \"database unreachable\"}",
+			wantCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, last := findReconcileFailures(tt.logs, "awx", "awx-instance")
+			if count != tt.wantCount {
+				t.Errorf("count = %d, want %d", count, tt.wantCount)
+			}
+			if last != tt.wantLast {
+				t.Errorf("last = %q, want %q", last, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestFindReconcileFailuresTruncates(t *testing.T) {
+	_, last := findReconcileFailures("FAILED! "+strings.Repeat("x", 1000)+"\n"+failedEvent("awx", "awx-instance"), "awx", "awx-instance")
+	if len(last) != 503 || !strings.HasSuffix(last, "...") {
+		t.Errorf("last failure has %d bytes, want it truncated to 500 and an ellipsis", len(last))
+	}
+}
+
+// watchingOperator returns a ready operator in the awx-operator namespace
+// whose container has the given WATCH_NAMESPACE, unset if nil
+func watchingOperator(watch *corev1.EnvVar) []runtime.Object {
+	objects := operatorObjects("awx-operator")
+	if watch != nil {
+		deployment := objects[0].(*appsv1.Deployment)
+		deployment.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{*watch}
+	}
+	return objects
+}
+
+func TestCheckPickedUp(t *testing.T) {
+	reconciled := awxWithConditions("awx", "awx-instance", map[string]interface{}{"type": "Running", "status": "True"})
+	watch := func(value string) *corev1.EnvVar { return &corev1.EnvVar{Name: "WATCH_NAMESPACE", Value: value} }
+	ownNamespace := &corev1.EnvVar{Name: "WATCH_NAMESPACE", ValueFrom: &corev1.EnvVarSource{
+		FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+	}}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		wantErr string
+	}{
+		{
+			name:    "AWX CR has a status",
+			objects: append(watchingOperator(watch("other")), reconciled),
+		},
+		{
+			name: "AWX CR not created yet",
+		},
+		{
+			name:    "operator watches all namespaces",
+			objects: append(watchingOperator(nil), k8stest.AWX("awx", "awx-instance")),
+		},
+		{
+			name:    "operator watches the AWX namespace",
+			objects: append(watchingOperator(watch("team-a, awx")), k8stest.AWX("awx", "awx-instance")),
+		},
+		{
+			name:    "operator watches other namespaces",
+			objects: append(watchingOperator(watch("team-a,team-b")), k8stest.AWX("awx", "awx-instance")),
+			wantErr: "operator not reconciling namespace awx: operator only watches team-a, team-b (WATCH_NAMESPACE)",
+		},
+		{
+			name:    "operator watches its own namespace",
+			objects: append(watchingOperator(ownNamespace), k8stest.AWX("awx", "awx-instance")),
+			wantErr: "operator not reconciling namespace awx: operator only watches awx-operator (WATCH_NAMESPACE)",
+		},
+		{
+			name:    "operator missing",
+			objects: []runtime.Object{k8stest.AWX("awx", "awx-instance")},
+			wantErr: "operator not reconciling namespace awx: operator deployment awx-operator-controller-manager not found in namespace awx-operator",
+		},
+		{
+			name: "operator not ready",
+			objects: append(watchingOperator(nil)[:4],
+				workloadPod(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+					Namespace: "awx-operator",
+					Labels:    map[string]string{"control-plane": "controller-manager"},
+				}}, "awx-operator-controller-manager-0", corev1.ContainerStatus{Name: operatorContainer}),
+				k8stest.AWX("awx", "awx-instance")),
+			wantErr: "operator not reconciling namespace awx: operator is not ready",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			checker := NewReconcileChecker(cluster.Client, testConfig(t, map[string]string{"AWX_OPERATOR_NAMESPACE": "awx-operator"}))
+
+			err := checker.CheckPickedUp(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckPickedUp() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckPickedUp() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
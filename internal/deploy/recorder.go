@@ -0,0 +1,118 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/events"
+	"awx-deployer/internal/k8s"
+)
+
+// eventComponent is the source of the Kubernetes Events the deployer records
+const eventComponent = "awx-deployer"
+
+// maxEventMessage keeps event messages, which carry step errors, short
+const maxEventMessage = 1024
+
+// EventRecorder records the start, completion and failure of the pipeline
+// steps as Kubernetes Events on the AWX CR, so that kubectl describe awx
+// shows the deployment history. Steps that run before the CR exists, like
+// preflight on a first install, are not recorded. A nil EventRecorder
+// records nothing.
+type EventRecorder struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	// warned is set once a failure to record was logged, later ones are not
+	warned bool
+}
+
+// NewEventRecorder returns a recorder for the AWX instance, or nil unless
+// AWX_EMIT_K8S_EVENTS is set
+func NewEventRecorder(k8sClient *k8s.KubernetesClient, config *config.Config) *EventRecorder {
+	if !config.EmitEvents {
+		return nil
+	}
+	return &EventRecorder{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Observe records a pipeline event. Progress events are not recorded, and
+// failures to record are logged but never fail the deployment.
+func (r *EventRecorder) Observe(event events.Event) {
+	if r == nil || event.Phase == events.PhaseProgress || event.Step == "" {
+		return
+	}
+	if err := r.record(context.Background(), event); err != nil && !r.warned {
+		log.Printf("Warning: Could not record Kubernetes Events on AWX instance %s: %v", r.config.AWXName, err)
+		r.warned = true
+	}
+}
+
+// record creates the Kubernetes Event of a pipeline event on the AWX CR,
+// if it exists
+func (r *EventRecorder) record(ctx context.Context, event events.Event) error {
+	apiVersion := k8s.AWXGroup + "/" + r.k8sClient.AWXVersion(ctx)
+	awx, err := r.k8sClient.GetObject(ctx, newObject(apiVersion, k8s.AWXKind, r.config.Namespace, r.config.AWXName))
+	if err != nil || awx == nil {
+		return err
+	}
+
+	eventType, reason, message := describeStepEvent(event)
+	if len(message) > maxEventMessage {
+		message = message[:maxEventMessage-3] + "..."
+	}
+	timestamp := metav1.NewTime(event.Timestamp)
+	if event.Timestamp.IsZero() {
+		timestamp = metav1.Now()
+	}
+	return r.k8sClient.CreateEvent(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", awx.GetName(), timestamp.UnixNano()),
+			Namespace: awx.GetNamespace(),
+		},
+		InvolvedObject:      objectReference(awx),
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Source:              corev1.EventSource{Component: eventComponent},
+		FirstTimestamp:      timestamp,
+		LastTimestamp:       timestamp,
+		Count:               1,
+		ReportingController: eventComponent,
+	})
+}
+
+// describeStepEvent returns the type, reason and message of the Kubernetes
+// Event of a pipeline event. Reasons name the step and its outcome, e.g.
+// ApplyStarted, WaitSucceeded or VerifyFailed.
+func describeStepEvent(event events.Event) (string, string, string) {
+	step := strings.ToUpper(event.Step[:1]) + event.Step[1:]
+	switch event.Phase {
+	case events.PhaseComplete:
+		return corev1.EventTypeNormal, step + "Succeeded", fmt.Sprintf("Step %s completed", event.Step)
+	case events.PhaseFail:
+		return corev1.EventTypeWarning, step + "Failed", fmt.Sprintf("Step %s failed: %v", event.Step, event.Err)
+	}
+	return corev1.EventTypeNormal, step + "Started", fmt.Sprintf("Step %s started", event.Step)
+}
+
+// objectReference refers to an object in an Event
+func objectReference(obj *unstructured.Unstructured) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		APIVersion:      obj.GetAPIVersion(),
+		Kind:            obj.GetKind(),
+		Namespace:       obj.GetNamespace(),
+		Name:            obj.GetName(),
+		UID:             obj.GetUID(),
+		ResourceVersion: obj.GetResourceVersion(),
+	}
+}
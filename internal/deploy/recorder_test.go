@@ -0,0 +1,134 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/events"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// stepEvents returns the pipeline events of steps that complete, followed
+// by a failure of failed unless it is empty, a second apart
+func stepEvents(steps []string, failed string) []events.Event {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	var stream []events.Event
+	add := func(step string, phase events.Phase, err error) {
+		stream = append(stream, events.Event{Step: step, Phase: phase, Err: err, Timestamp: start.Add(time.Duration(len(stream)) * time.Second)})
+	}
+	for _, step := range steps {
+		add(step, events.PhaseStart, nil)
+		add(step, events.PhaseProgress, nil)
+		add(step, events.PhaseComplete, nil)
+	}
+	if failed != "" {
+		add(failed, events.PhaseStart, nil)
+		add(failed, events.PhaseFail, errors.New("timeout waiting for AWX web"))
+	}
+	return stream
+}
+
+func TestEventRecorder(t *testing.T) {
+	awx := k8stest.AWX("awx", "awx-instance")
+	awx.SetUID("awx-uid")
+
+	tests := []struct {
+		name    string
+		emit    bool
+		objects []runtime.Object
+		stream  []events.Event
+		// want are the recorded events as "type reason: message"
+		want []string
+	}{
+		{
+			name:    "successful run",
+			emit:    true,
+			objects: []runtime.Object{awx},
+			stream:  stepEvents([]string{"apply", "wait", "verify"}, ""),
+			want: []string{
+				"Normal ApplyStarted: Step apply started", "Normal ApplySucceeded: Step apply completed",
+				"Normal WaitStarted: Step wait started", "Normal WaitSucceeded: Step wait completed",
+				"Normal VerifyStarted: Step verify started", "Normal VerifySucceeded: Step verify completed",
+			},
+		},
+		{
+			name:    "failed run",
+			emit:    true,
+			objects: []runtime.Object{awx},
+			stream:  stepEvents([]string{"apply"}, "wait"),
+			want: []string{
+				"Normal ApplyStarted: Step apply started", "Normal ApplySucceeded: Step apply completed",
+				"Normal WaitStarted: Step wait started", "Warning WaitFailed: Step wait failed: timeout waiting for AWX web",
+			},
+		},
+		{
+			name:   "AWX instance not created yet",
+			emit:   true,
+			stream: stepEvents([]string{"preflight"}, ""),
+		},
+		{
+			name:    "disabled",
+			objects: []runtime.Object{awx},
+			stream:  stepEvents([]string{"apply"}, ""),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			env := map[string]string{"AWX_NAMESPACE": "awx"}
+			if tt.emit {
+				env["AWX_EMIT_K8S_EVENTS"] = "true"
+			}
+			recorder := NewEventRecorder(cluster.Client, testConfig(t, env))
+			for _, event := range tt.stream {
+				recorder.Observe(event)
+			}
+
+			list, err := cluster.Clientset.CoreV1().Events("awx").List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, event := range list.Items {
+				got = append(got, event.Type+" "+event.Reason+": "+event.Message)
+				want := corev1.ObjectReference{APIVersion: "awx.ansible.com/v1beta1", Kind: "AWX", Namespace: "awx", Name: "awx-instance", UID: "awx-uid"}
+				event.InvolvedObject.ResourceVersion = ""
+				if event.InvolvedObject != want {
+					t.Errorf("event %s involves %+v, want %+v", event.Name, event.InvolvedObject, want)
+				}
+				if event.Source.Component != "awx-deployer" || event.Count != 1 {
+					t.Errorf("event %s source = %q, count = %d, want awx-deployer, 1", event.Name, event.Source.Component, event.Count)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recorded events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventRecorderTruncatesMessages(t *testing.T) {
+	long := make([]byte, 2*maxEventMessage)
+	for i := range long {
+		long[i] = 'x'
+	}
+	cluster := k8stest.NewCluster(k8stest.AWX("awx", "awx-instance"))
+	recorder := NewEventRecorder(cluster.Client, testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_EMIT_K8S_EVENTS": "true"}))
+	recorder.Observe(events.Event{Step: "wait", Phase: events.PhaseFail, Err: errors.New(string(long)), Timestamp: time.Now()})
+
+	list, err := cluster.Clientset.CoreV1().Events("awx").List(context.Background(), metav1.ListOptions{})
+	if err != nil || len(list.Items) != 1 {
+		t.Fatalf("List() = %v, %v, want one event", list, err)
+	}
+	if message := list.Items[0].Message; len(message) != maxEventMessage {
+		t.Errorf("message length = %d, want %d", len(message), maxEventMessage)
+	}
+}
@@ -0,0 +1,125 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// redisContainer is the name of the Redis sidecar in the AWX web and task pods
+const redisContainer = "redis"
+
+// redisMinOperatorVersion is the first operator release that runs Redis
+var redisMinOperatorVersion = []int{0, 10, 0}
+
+// redisExpected reports whether the AWX install includes Redis, either
+// because it is enabled explicitly or the operator version is known to run it.
+// An external Redis is not part of the install.
+func redisExpected(cfg *config.Config) bool {
+	if cfg.RedisExternal {
+		return false
+	}
+	return cfg.VerifyRedis || versionAtLeast(cfg.OperatorVersion, redisMinOperatorVersion)
+}
+
+// redisSecretName returns the name of the secret holding the external Redis
+// connection settings
+func redisSecretName(awxName string) string {
+	return fmt.Sprintf("%s-redis-configuration", awxName)
+}
+
+// redisSecret returns the secret the AWX CR references for an external
+// Redis, in the format of the PostgreSQL configuration secret
+func redisSecret(cfg *config.Config, awx *unstructured.Unstructured) *unstructured.Unstructured {
+	secret := newObject("v1", "Secret", awx.GetNamespace(), redisSecretName(awx.GetName()))
+	secret.Object["type"] = "Opaque"
+	secret.Object["stringData"] = map[string]interface{}{
+		"host":     cfg.RedisHost,
+		"port":     strconv.Itoa(cfg.RedisPort),
+		"password": cfg.RedisPassword,
+		"type":     "unmanaged",
+	}
+	return secret
+}
+
+// redisStatus reports whether Redis is running, either as a separate
+// deployment or as a sidecar container in the web pods, and describes where
+// it was found
+func redisStatus(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config) (bool, string, error) {
+	redisDeployment, err := findInstanceObject(ctx, k8sClient, cfg, deploymentsGVR, roleRedis)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to check Redis deployment: %v", err)
+	}
+
+	if redisDeployment != nil {
+		status, err := workloadPodStatus(ctx, k8sClient, cfg, redisDeployment)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to get Redis pod status: %v", err)
+		}
+		return status.Ready(), fmt.Sprintf("deployment %s pod status: %s", redisDeployment.GetName(), status), nil
+	}
+
+	webDeployment, err := findInstanceObject(ctx, k8sClient, cfg, deploymentsGVR, roleWeb)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to check AWX web deployment: %v", err)
+	}
+	if webDeployment == nil {
+		return false, "", fmt.Errorf("neither a Redis nor an AWX web deployment of AWX instance %s exists", cfg.AWXName)
+	}
+	pods, err := workloadPods(ctx, k8sClient, cfg, webDeployment)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to list AWX web pods: %v", err)
+	}
+
+	for _, pod := range pods {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name != redisContainer {
+				continue
+			}
+			if cs.Ready {
+				return true, fmt.Sprintf("container %s in pod %s is ready", redisContainer, pod.Name), nil
+			}
+			reason := "not ready"
+			if cs.State.Waiting != nil {
+				reason = cs.State.Waiting.Reason
+			}
+			return false, fmt.Sprintf("container %s in pod %s is %s", redisContainer, pod.Name, reason), nil
+		}
+	}
+
+	return false, "", fmt.Errorf("neither a Redis deployment nor a %s container in the AWX web pods of AWX instance %s was found", redisContainer, cfg.AWXName)
+}
+
+// versionAtLeast reports whether a version such as "2.19.1" or "v0.10.0" is
+// at least min. Versions that do not parse, like "devel", are assumed recent.
+func versionAtLeast(version string, min []int) bool {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	for i, want := range min {
+		got := 0 // missing components count as zero
+		if i < len(parts) {
+			var err error
+			if got, err = strconv.Atoi(leadingDigits(parts[i])); err != nil {
+				return true
+			}
+		}
+		if got != want {
+			return got > want
+		}
+	}
+	return true
+}
+
+// leadingDigits returns the leading digits of a version component such as "1-rc1"
+func leadingDigits(part string) string {
+	end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		return part
+	}
+	return part[:end]
+}
@@ -0,0 +1,204 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestRedisExpected(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{name: "recent operator", env: map[string]string{"AWX_OPERATOR_VERSION": "2.5.0"}, want: true},
+		{name: "first operator with Redis", env: map[string]string{"AWX_OPERATOR_VERSION": "0.10.0"}, want: true},
+		{name: "operator before Redis", env: map[string]string{"AWX_OPERATOR_VERSION": "0.9.1"}},
+		{name: "operator before Redis with AWX_VERIFY_REDIS", env: map[string]string{"AWX_OPERATOR_VERSION": "0.9.1", "AWX_VERIFY_REDIS": "true"}, want: true},
+		{name: "pre-release of the first operator with Redis", env: map[string]string{"AWX_OPERATOR_VERSION": "0.10.0-rc1"}, want: true},
+		{
+			name: "external Redis",
+			env:  map[string]string{"AWX_OPERATOR_VERSION": "2.5.0", "AWX_VERIFY_REDIS": "true", "AWX_REDIS_EXTERNAL": "true", "AWX_REDIS_HOST": "redis.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redisExpected(testConfig(t, tt.env)); got != tt.want {
+				t.Errorf("redisExpected() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRedis(t *testing.T) {
+	redis := instanceDeployment("awx", "awx-instance", "redis")
+	web := instanceDeployment("awx", "awx-instance", "web")
+	ready := corev1.ContainerStatus{Name: "redis", Ready: true}
+	crashing := corev1.ContainerStatus{Name: "redis", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}}
+	webContainer := corev1.ContainerStatus{Name: "awx-web", Ready: true}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		objects []runtime.Object
+		// wantErr is empty when Redis is running or skipped
+		wantErr string
+	}{
+		{
+			name:    "Redis deployment running",
+			objects: []runtime.Object{redis, workloadPod(redis, "awx-instance-redis-0", ready)},
+		},
+		{
+			name:    "Redis deployment not ready",
+			objects: []runtime.Object{redis, workloadPod(redis, "awx-instance-redis-0", crashing)},
+			wantErr: "Redis is not running, deployment awx-instance-redis pod status",
+		},
+		{
+			name:    "Redis sidecar running",
+			objects: []runtime.Object{web, workloadPod(web, "awx-instance-web-0", webContainer, ready)},
+		},
+		{
+			name:    "Redis sidecar crashing",
+			objects: []runtime.Object{web, workloadPod(web, "awx-instance-web-0", webContainer, crashing)},
+			wantErr: "container redis in pod awx-instance-web-0 is CrashLoopBackOff",
+		},
+		{
+			name:    "Redis missing from the web pods",
+			objects: []runtime.Object{web, workloadPod(web, "awx-instance-web-0", webContainer)},
+			wantErr: "neither a Redis deployment nor a redis container in the AWX web pods",
+		},
+		{
+			name:    "Redis and web missing",
+			wantErr: "neither a Redis nor an AWX web deployment of AWX instance awx-instance exists",
+		},
+		{
+			name: "Redis missing but not expected",
+			env:  map[string]string{"AWX_OPERATOR_VERSION": "0.9.0"},
+		},
+		{
+			name: "external Redis",
+			env:  map[string]string{"AWX_REDIS_EXTERNAL": "true", "AWX_REDIS_HOST": "redis.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_NAMESPACE": "awx", "AWX_OPERATOR_VERSION": "2.5.0"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cluster := k8stest.NewCluster(tt.objects...)
+			verifier := NewDeploymentVerifier(cluster.Client, testConfig(t, env))
+
+			err := verifier.verifyRedis(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("verifyRedis() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("verifyRedis() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateExternalRedis(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// wantSecret is the string data of the Redis secret, nil if none is
+		// generated
+		wantSecret map[string]interface{}
+	}{
+		{
+			name: "managed Redis",
+		},
+		{
+			name: "external Redis",
+			env: map[string]string{
+				"AWX_REDIS_EXTERNAL": "true",
+				"AWX_REDIS_HOST":     "redis.example.com",
+				"AWX_REDIS_PASSWORD": "r3d1s-pass",
+			},
+			wantSecret: map[string]interface{}{
+				"host":     "redis.example.com",
+				"port":     "6379",
+				"password": "r3d1s-pass",
+				"type":     "unmanaged",
+			},
+		},
+		{
+			name: "external Redis on another port without password",
+			env: map[string]string{
+				"AWX_REDIS_EXTERNAL": "true",
+				"AWX_REDIS_HOST":     "10.0.0.5",
+				"AWX_REDIS_PORT":     "6380",
+			},
+			wantSecret: map[string]interface{}{
+				"host":     "10.0.0.5",
+				"port":     "6380",
+				"password": "",
+				"type":     "unmanaged",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifests, err := NewManifestGenerator(testConfig(t, tt.env), manifestsDir).Generate()
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+
+			secretAt, awxAt := -1, -1
+			var secret, awx *unstructured.Unstructured
+			for i, manifest := range manifests {
+				switch obj := manifest.Object; {
+				case obj.GetKind() == "Secret" && obj.GetName() == "awx-instance-redis-configuration":
+					secretAt, secret = i, obj
+				case isAWX(obj):
+					awxAt, awx = i, obj
+				}
+			}
+			if awx == nil {
+				t.Fatal("no AWX CR generated")
+			}
+			reference, _, _ := unstructured.NestedString(awx.Object, "spec", "redis_configuration_secret")
+
+			if tt.wantSecret == nil {
+				if secret != nil {
+					t.Errorf("Redis secret generated for a managed Redis")
+				}
+				if reference != "" {
+					t.Errorf("spec.redis_configuration_secret = %q, want unset", reference)
+				}
+				return
+			}
+
+			if secret == nil {
+				t.Fatal("no Redis secret generated")
+			}
+			if secretAt > awxAt {
+				t.Errorf("Redis secret is applied after the AWX CR")
+			}
+			if secret.GetNamespace() != awx.GetNamespace() {
+				t.Errorf("Redis secret namespace = %q, want %q", secret.GetNamespace(), awx.GetNamespace())
+			}
+			data, _, _ := unstructured.NestedMap(secret.Object, "stringData")
+			if !reflect.DeepEqual(data, tt.wantSecret) {
+				t.Errorf("Redis secret data = %v, want %v", data, tt.wantSecret)
+			}
+			if reference != secret.GetName() {
+				t.Errorf("spec.redis_configuration_secret = %q, want %q", reference, secret.GetName())
+			}
+		})
+	}
+}
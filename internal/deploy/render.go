@@ -0,0 +1,115 @@
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"awx-deployer/internal/config"
+)
+
+// renderFilePattern matches the names renderFileName gives files
+var renderFilePattern = regexp.MustCompile(`^[0-9]{3,}-.+\.yaml$`)
+
+// RenderTo writes each generated object to its own YAML file in dir without
+// contacting the cluster, and returns the paths written in apply order.
+// File names are derived from the apply order, kind and name so repeated
+// renders of the same configuration produce identical files. A generated
+// admin password would differ on every render, so it is written redacted.
+// Rendered files of earlier renders that this one did not write are removed,
+// so objects no longer generated do not linger in dir.
+func (g *ManifestGenerator) RenderTo(dir string) ([]string, error) {
+	manifests, err := g.Generate()
+	if err != nil {
+		return nil, err
+	}
+	if g.config.AdminPasswordGenerated {
+		redactGeneratedPassword(manifests, g.config)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create render directory %s: %v", dir, err)
+	}
+
+	var paths []string
+	for i, manifest := range manifests {
+		// sigs.k8s.io/yaml marshals through JSON, which sorts map keys
+		data, err := yaml.Marshal(manifest.Object.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s %s: %v", manifest.Object.GetKind(), manifest.Object.GetName(), err)
+		}
+
+		path := filepath.Join(dir, renderFileName(i, manifest))
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+
+	if err := removeStaleRenders(dir, paths); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// removeStaleRenders removes the files in dir named like rendered files
+// that are not among the paths just written
+func removeStaleRenders(dir string, paths []string) error {
+	written := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		written[filepath.Base(path)] = true
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read render directory %s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || written[entry.Name()] || !renderFilePattern.MatchString(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove stale %s: %v", path, err)
+		}
+		log.Printf("Removed %s, it is no longer rendered", path)
+	}
+	return nil
+}
+
+// renderFileName returns a deterministic file name such as "007-awx-awx-instance.yaml"
+func renderFileName(index int, manifest Manifest) string {
+	kind := strings.ToLower(manifest.Object.GetKind())
+	return fmt.Sprintf("%03d-%s-%s.yaml", index, kind, manifest.Object.GetName())
+}
+
+// redactGeneratedPassword replaces the generated admin password in the admin
+// password secret with redactedValue
+func redactGeneratedPassword(manifests []Manifest, cfg *config.Config) {
+	var awx *unstructured.Unstructured
+	for _, manifest := range manifests {
+		if isAWX(manifest.Object) {
+			awx = manifest.Object
+		}
+	}
+	if awx == nil {
+		return
+	}
+
+	name := adminPasswordSecretName(awx, cfg)
+	for _, manifest := range manifests {
+		if manifest.Object.GetKind() != "Secret" || manifest.Object.GetName() != name {
+			continue
+		}
+		if err := unstructured.SetNestedField(manifest.Object.Object, redactedValue, "stringData", "password"); err == nil {
+			log.Printf("Warning: AWX_ADMIN_PASSWORD is not set, secret %s is rendered with a %s password, set it or fill it in before applying", name, redactedValue)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package deploy
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestRenderTo(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{
+			name: "default",
+			env:  map[string]string{"AWX_ADMIN_PASSWORD": "Golden-Admin-Pass-1"},
+		},
+		{
+			name: "prod",
+			env: map[string]string{
+				"AWX_PROFILE":          "prod",
+				"AWX_ADMIN_PASSWORD":   "Golden-Admin-Pass-1",
+				"AWX_CERT_ISSUER":      "letsencrypt-staging",
+				"AWX_POSTGRES_VERSION": "15",
+			},
+		},
+		{
+			name: "generated password",
+			env:  map[string]string{"AWX_PROFILE": "dev"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewManifestGenerator(testConfig(t, tt.env), filepath.Join("testdata", "render", "manifests"))
+			dir := t.TempDir()
+			paths, err := g.RenderTo(dir)
+			if err != nil {
+				t.Fatalf("RenderTo() failed: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "render", filepath.Base(t.Name()))
+			if *update {
+				os.RemoveAll(golden)
+				if err := os.MkdirAll(golden, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := filepath.Glob(filepath.Join(golden, "*.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !*update && len(want) != len(paths) {
+				t.Errorf("rendered %d files, want %d", len(paths), len(want))
+			}
+			for _, path := range paths {
+				got, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				goldenPath := filepath.Join(golden, filepath.Base(path))
+				if *update {
+					if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				expected, err := os.ReadFile(goldenPath)
+				if err != nil {
+					t.Errorf("unexpected file %s: %v", filepath.Base(path), err)
+					continue
+				}
+				if string(got) != string(expected) {
+					t.Errorf("%s differs from the golden file:\n%s", filepath.Base(path), got)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderToIsStable(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// dir holds the manifests, the test manifests if empty
+		dir string
+	}{
+		{name: "set password", env: map[string]string{"AWX_ADMIN_PASSWORD": "Golden-Admin-Pass-1"}},
+		{name: "generated password", env: map[string]string{"AWX_PROFILE": "dev"}},
+		{name: "repository manifests", env: map[string]string{"AWX_ADMIN_PASSWORD": "Golden-Admin-Pass-1", "AWX_PROFILE": "prod"}, dir: manifestsDir},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tt.dir
+			if dir == "" {
+				dir = filepath.Join("testdata", "render", "manifests")
+			}
+
+			// Each render loads the configuration afresh, like separate runs
+			var renders [][]string
+			for run := 0; run < 2; run++ {
+				paths, err := NewManifestGenerator(testConfig(t, tt.env), dir).RenderTo(t.TempDir())
+				if err != nil {
+					t.Fatalf("RenderTo() failed: %v", err)
+				}
+				renders = append(renders, paths)
+			}
+
+			if len(renders[0]) != len(renders[1]) {
+				t.Fatalf("renders wrote %d and %d files", len(renders[0]), len(renders[1]))
+			}
+			for i, path := range renders[0] {
+				if filepath.Base(path) != filepath.Base(renders[1][i]) {
+					t.Errorf("file %d is %s, then %s", i, filepath.Base(path), filepath.Base(renders[1][i]))
+					continue
+				}
+				a, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := os.ReadFile(renders[1][i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(a) != string(b) {
+					t.Errorf("%s differs between renders:\n%s\n---\n%s", filepath.Base(path), a, b)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderToRemovesStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	stale := []string{"000-namespace-old.yaml", "099-configmap-removed.yaml"}
+	kept := []string{"README.md", "kustomization.yaml", "notes-1.yaml"}
+	for _, name := range append(append([]string{}, stale...), kept...) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("stale\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifests := filepath.Join("testdata", "render", "manifests")
+	paths, err := NewManifestGenerator(testConfig(t, map[string]string{"AWX_ADMIN_PASSWORD": "Golden-Admin-Pass-1"}), manifests).RenderTo(dir)
+	if err != nil {
+		t.Fatalf("RenderTo() failed: %v", err)
+	}
+
+	want := append([]string{}, kept...)
+	for _, path := range paths {
+		want = append(want, filepath.Base(path))
+	}
+	sort.Strings(want)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("render directory holds %v, want %v", got, want)
+	}
+	for _, path := range paths {
+		if data, err := os.ReadFile(path); err != nil || string(data) == "stale\n" {
+			t.Errorf("%s not rendered: %v", filepath.Base(path), err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/operator"
+)
+
+const (
+	// RepairInstalled repairs a partial operator install by creating the
+	// missing objects
+	RepairInstalled = "installed"
+	// RepairRemoved repairs a partial operator install by deleting the
+	// remaining objects
+	RepairRemoved = "removed"
+)
+
+// OperatorState is what exists of the operator install. Namespaces are left
+// out, they may hold AWX itself.
+type OperatorState struct {
+	Present []*unstructured.Unstructured
+	Missing []*unstructured.Unstructured
+	// Problems describes the inconsistencies, empty when the operator is
+	// either fully installed or fully removed
+	Problems []string
+}
+
+// RepairFix is a change that makes the operator install consistent
+type RepairFix struct {
+	Verb   string // create or delete
+	Object *unstructured.Unstructured
+}
+
+// OperatorRepairer detects operator installs left partial, e.g. by a failed
+// uninstall with the operator still running but its CRDs gone, and completes
+// or removes them
+type OperatorRepairer struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewOperatorRepairer creates a new operator repairer
+func NewOperatorRepairer(k8sClient *k8s.KubernetesClient, config *config.Config) *OperatorRepairer {
+	return &OperatorRepairer{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Inspect checks which objects of the operator manifests exist
+func (r *OperatorRepairer) Inspect(ctx context.Context) (*OperatorState, error) {
+	if r.config.SkipOperatorInstall {
+		return nil, fmt.Errorf("AWX_SKIP_OPERATOR_INSTALL is set, the operator is managed by others and not repaired")
+	}
+
+	objs, err := operator.Objects(r.config)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &OperatorState{}
+	for _, obj := range objs {
+		if obj.GetKind() == "Namespace" {
+			continue
+		}
+		current, err := r.k8sClient.GetObject(ctx, obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s: %v", describeObject(obj), err)
+		}
+		if current != nil {
+			state.Present = append(state.Present, obj)
+		} else {
+			state.Missing = append(state.Missing, obj)
+		}
+	}
+	state.Problems = operatorProblems(state)
+	return state, nil
+}
+
+// operatorProblems describes how a partial install is inconsistent: the
+// operator deployment without what it needs, or what the deployment needs
+// left behind without it
+func operatorProblems(state *OperatorState) []string {
+	if len(state.Present) == 0 || len(state.Missing) == 0 {
+		return nil
+	}
+
+	var deployments []*unstructured.Unstructured
+	for _, obj := range state.Present {
+		if obj.GetKind() == "Deployment" {
+			deployments = append(deployments, obj)
+		}
+	}
+
+	var problems []string
+	if len(deployments) > 0 {
+		for _, deployment := range deployments {
+			for _, obj := range state.Missing {
+				problems = append(problems, fmt.Sprintf("operator %s exists but %s is missing", describeObject(deployment), describeObject(obj)))
+			}
+		}
+		return problems
+	}
+
+	for _, obj := range state.Missing {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		var remaining []string
+		for _, present := range state.Present {
+			remaining = append(remaining, describeObject(present))
+		}
+		problems = append(problems, fmt.Sprintf("operator %s is missing but other operator objects are left: %s", describeObject(obj), strings.Join(remaining, ", ")))
+	}
+	if len(problems) == 0 {
+		problems = append(problems, fmt.Sprintf("%d of %d operator objects are missing", len(state.Missing), len(state.Missing)+len(state.Present)))
+	}
+	return problems
+}
+
+// Fixes returns the changes that make an inconsistent install fully
+// installed or fully removed. Removing the CRDs deletes all AWX resources,
+// so that is refused while any exist.
+func (r *OperatorRepairer) Fixes(ctx context.Context, state *OperatorState, direction string) ([]RepairFix, error) {
+	if len(state.Problems) == 0 {
+		return nil, nil
+	}
+
+	var fixes []RepairFix
+	switch direction {
+	case RepairInstalled:
+		for _, obj := range state.Missing {
+			fixes = append(fixes, RepairFix{Verb: "create", Object: obj})
+		}
+	case RepairRemoved:
+		for i := len(state.Present) - 1; i >= 0; i-- {
+			obj := state.Present[i]
+			if obj.GetKind() == "CustomResourceDefinition" {
+				if err := r.checkNoAWXResources(ctx); err != nil {
+					return nil, err
+				}
+			}
+			fixes = append(fixes, RepairFix{Verb: "delete", Object: obj})
+		}
+	default:
+		return nil, fmt.Errorf("invalid repair direction %q (expected %s or %s)", direction, RepairInstalled, RepairRemoved)
+	}
+	return fixes, nil
+}
+
+// checkNoAWXResources returns an error if any AWX resources exist
+func (r *OperatorRepairer) checkNoAWXResources(ctx context.Context) error {
+	crds, err := r.k8sClient.AWXCRDs(ctx)
+	if err != nil {
+		return err
+	}
+	remaining, err := awxResources(ctx, r.k8sClient, crds)
+	if err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("refusing to delete the AWX CRDs, AWX resources still exist: %s (uninstall them first or repair to %s)", strings.Join(remaining, ", "), RepairInstalled)
+	}
+	return nil
+}
+
+// Repair makes the changes
+func (r *OperatorRepairer) Repair(ctx context.Context, fixes []RepairFix) error {
+	for _, fix := range fixes {
+		log.Printf("Repair: %s %s", fix.Verb, describeObject(fix.Object))
+		var err error
+		if fix.Verb == "delete" {
+			err = r.k8sClient.DeleteObject(ctx, fix.Object)
+		} else {
+			err = r.k8sClient.ApplyObject(ctx, fix.Object)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s %s: %v", fix.Verb, describeObject(fix.Object), err)
+		}
+	}
+	log.Printf("✓ Repaired the AWX operator install with %d change(s)", len(fixes))
+	return nil
+}
+
+// PrintRepair prints what was found and the fixes for the repair direction
+func PrintRepair(w io.Writer, state *OperatorState, direction string, fixes []RepairFix) {
+	if len(state.Problems) == 0 {
+		if len(state.Missing) == 0 {
+			fmt.Fprintf(w, "The AWX operator is fully installed (%d objects), nothing to repair\n", len(state.Present))
+		} else {
+			fmt.Fprintf(w, "The AWX operator is fully removed, nothing to repair\n")
+		}
+		return
+	}
+
+	fmt.Fprintln(w, "Found:")
+	for _, problem := range state.Problems {
+		fmt.Fprintf(w, "  - %s\n", problem)
+	}
+	fmt.Fprintf(w, "\nPresent (%d):\n", len(state.Present))
+	for _, obj := range state.Present {
+		fmt.Fprintf(w, "  %s\n", describeObject(obj))
+	}
+	fmt.Fprintf(w, "Missing (%d):\n", len(state.Missing))
+	for _, obj := range state.Missing {
+		fmt.Fprintf(w, "  %s\n", describeObject(obj))
+	}
+
+	if direction == "" {
+		fmt.Fprintf(w, "\nChoose a repair with --to %s or --to %s\n", RepairInstalled, RepairRemoved)
+		return
+	}
+	fmt.Fprintf(w, "\nTo make the operator fully %s:\n", direction)
+	for _, fix := range fixes {
+		fmt.Fprintf(w, "  %s %s\n", fix.Verb, describeObject(fix.Object))
+	}
+}
+
+// describeObject names an object by kind, namespace and name
+func describeObject(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return fmt.Sprintf("%s %s", obj.GetKind(), obj.GetName())
+	}
+	return fmt.Sprintf("%s %s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+}
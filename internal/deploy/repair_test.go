@@ -0,0 +1,212 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestOperatorRepairer(t *testing.T) {
+	crd := func() runtime.Object { return servedCRD(k8s.AWXGroup, k8s.AWXResource, "AWX") }
+	serviceAccount := func() runtime.Object {
+		return k8stest.Object("v1", "ServiceAccount", "awx", "awx-operator-controller-manager")
+	}
+	deployment := func() runtime.Object {
+		return k8stest.Object("apps/v1", "Deployment", "awx", "awx-operator-controller-manager")
+	}
+
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		direction string
+		// wantProblems are substrings of the problems found, in order
+		wantProblems []string
+		// wantFixes are the fixes as "verb object"
+		wantFixes []string
+		// wantAfter are the kinds of operator objects left after the repair
+		wantAfter []string
+		wantErr   string
+	}{
+		{
+			name:      "fully installed",
+			objects:   []runtime.Object{crd(), serviceAccount(), deployment()},
+			direction: RepairRemoved,
+			wantAfter: []string{"CustomResourceDefinition", "ServiceAccount", "Deployment"},
+		},
+		{
+			name:      "fully removed",
+			direction: RepairInstalled,
+		},
+		{
+			name:      "deployment without its CRD repaired to installed",
+			objects:   []runtime.Object{serviceAccount(), deployment()},
+			direction: RepairInstalled,
+			wantProblems: []string{
+				"operator Deployment awx/awx-operator-controller-manager exists but CustomResourceDefinition awxs.awx.ansible.com is missing",
+			},
+			wantFixes: []string{"create CustomResourceDefinition awxs.awx.ansible.com"},
+			wantAfter: []string{"CustomResourceDefinition", "ServiceAccount", "Deployment"},
+		},
+		{
+			name:      "deployment gone repaired to removed",
+			objects:   []runtime.Object{crd(), serviceAccount()},
+			direction: RepairRemoved,
+			wantProblems: []string{
+				"operator Deployment awx/awx-operator-controller-manager is missing but other operator objects are left: CustomResourceDefinition awxs.awx.ansible.com, ServiceAccount awx/awx-operator-controller-manager",
+			},
+			wantFixes: []string{
+				"delete ServiceAccount awx/awx-operator-controller-manager",
+				"delete CustomResourceDefinition awxs.awx.ansible.com",
+			},
+		},
+		{
+			name:      "removal refused while AWX resources exist",
+			objects:   []runtime.Object{crd(), serviceAccount(), k8stest.AWX("awx", "awx")},
+			direction: RepairRemoved,
+			wantProblems: []string{
+				"operator Deployment awx/awx-operator-controller-manager is missing",
+			},
+			wantErr: "refusing to delete the AWX CRDs, AWX resources still exist: AWX awx/awx",
+		},
+		{
+			name:      "invalid direction",
+			objects:   []runtime.Object{serviceAccount(), deployment()},
+			direction: "half",
+			wantProblems: []string{
+				"CustomResourceDefinition awxs.awx.ansible.com is missing",
+			},
+			wantErr: `invalid repair direction "half"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{"AWX_OPERATOR_MANIFEST_PATH": "../operator/testdata/bundle"})
+			client := k8stest.NewCluster(tt.objects...).Client
+			repairer := NewOperatorRepairer(client, cfg)
+			ctx := context.Background()
+
+			state, err := repairer.Inspect(ctx)
+			if err != nil {
+				t.Fatalf("Inspect() failed: %v", err)
+			}
+			if len(state.Problems) != len(tt.wantProblems) {
+				t.Fatalf("Inspect() problems = %q, want %q", state.Problems, tt.wantProblems)
+			}
+			for i, want := range tt.wantProblems {
+				if !strings.Contains(state.Problems[i], want) {
+					t.Errorf("Inspect() problem %d = %q, want %q", i, state.Problems[i], want)
+				}
+			}
+
+			fixes, err := repairer.Fixes(ctx, state, tt.direction)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Fixes() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fixes() failed: %v", err)
+			}
+			var gotFixes []string
+			for _, fix := range fixes {
+				gotFixes = append(gotFixes, fix.Verb+" "+describeObject(fix.Object))
+			}
+			if !reflect.DeepEqual(gotFixes, tt.wantFixes) {
+				t.Errorf("Fixes() = %q, want %q", gotFixes, tt.wantFixes)
+			}
+
+			if err := repairer.Repair(ctx, fixes); err != nil {
+				t.Fatalf("Repair() failed: %v", err)
+			}
+			after, err := repairer.Inspect(ctx)
+			if err != nil {
+				t.Fatalf("Inspect() after repair failed: %v", err)
+			}
+			if len(after.Problems) > 0 {
+				t.Errorf("Inspect() after repair problems = %q, want none", after.Problems)
+			}
+			var kinds []string
+			for _, obj := range after.Present {
+				kinds = append(kinds, obj.GetKind())
+			}
+			if !reflect.DeepEqual(kinds, tt.wantAfter) {
+				t.Errorf("operator objects after repair = %v, want %v", kinds, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestOperatorRepairerSkipInstall(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"AWX_SKIP_OPERATOR_INSTALL": "true"})
+	_, err := NewOperatorRepairer(k8stest.NewCluster().Client, cfg).Inspect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "AWX_SKIP_OPERATOR_INSTALL is set") {
+		t.Fatalf("Inspect() error = %v, want the operator left to others", err)
+	}
+}
+
+func TestPrintRepair(t *testing.T) {
+	crd := servedCRD(k8s.AWXGroup, k8s.AWXResource, "AWX")
+	deployment := k8stest.Object("apps/v1", "Deployment", "awx", "awx-operator-controller-manager")
+	partial := &OperatorState{
+		Present:  []*unstructured.Unstructured{deployment},
+		Missing:  []*unstructured.Unstructured{crd},
+		Problems: []string{"operator Deployment awx/awx-operator-controller-manager exists but CustomResourceDefinition awxs.awx.ansible.com is missing"},
+	}
+
+	tests := []struct {
+		name      string
+		state     *OperatorState
+		direction string
+		fixes     []RepairFix
+		want      []string
+	}{
+		{
+			name:  "fully installed",
+			state: &OperatorState{Present: []*unstructured.Unstructured{crd, deployment}},
+			want:  []string{"The AWX operator is fully installed (2 objects), nothing to repair"},
+		},
+		{
+			name:  "fully removed",
+			state: &OperatorState{Missing: []*unstructured.Unstructured{crd, deployment}},
+			want:  []string{"The AWX operator is fully removed, nothing to repair"},
+		},
+		{
+			name:  "no direction chosen",
+			state: partial,
+			want: []string{
+				"Present (1):\n  Deployment awx/awx-operator-controller-manager",
+				"Missing (1):\n  CustomResourceDefinition awxs.awx.ansible.com",
+				"Choose a repair with --to installed or --to removed",
+			},
+		},
+		{
+			name:      "fixes for the direction",
+			state:     partial,
+			direction: RepairInstalled,
+			fixes:     []RepairFix{{Verb: "create", Object: crd}},
+			want:      []string{"To make the operator fully installed:\n  create CustomResourceDefinition awxs.awx.ansible.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			PrintRepair(&out, tt.state, tt.direction, tt.fixes)
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("PrintRepair() = %q, want %q", out.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// OperatorScopeChecker checks each part of the operator at the scope it lives
+// at. CRDs are cluster-scoped even for an operator that only watches its own
+// namespace, while the operator deployment lives in AWX_OPERATOR_NAMESPACE
+// and must watch the namespaces AWX_OPERATOR_CLUSTER_SCOPED implies.
+type OperatorScopeChecker struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewOperatorScopeChecker creates a new operator scope checker
+func NewOperatorScopeChecker(k8sClient *k8s.KubernetesClient, config *config.Config) *OperatorScopeChecker {
+	return &OperatorScopeChecker{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Check fails with every scope problem of the operator
+func (c *OperatorScopeChecker) Check(ctx context.Context) error {
+	problems, err := c.Problems(ctx)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("operator does not match a %s install: %s", c.mode(), strings.Join(problems, "; "))
+	}
+
+	log.Printf("✓ AWX CRD is registered cluster-wide and the %s operator in namespace %s watches %s", c.mode(), c.config.OperatorNamespace, c.config.Namespace)
+	return nil
+}
+
+// mode names the configured operator scope
+func (c *OperatorScopeChecker) mode() string {
+	if c.config.OperatorClusterScoped {
+		return "cluster-scoped"
+	}
+	return "namespace-scoped"
+}
+
+// Problems returns the scope problems of the operator: the AWX CRD missing
+// at cluster scope, not Established or not for namespaced resources, the
+// deployment missing from the operator namespace, and a WATCH_NAMESPACE that
+// does not match the configured scope or leaves out the AWX namespace
+func (c *OperatorScopeChecker) Problems(ctx context.Context) ([]string, error) {
+	problems, err := c.crdProblems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := c.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", operatorDeployment, c.config.OperatorNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return append(problems, fmt.Sprintf("operator deployment %s not found in namespace %s", operatorDeployment, c.config.OperatorNamespace)), nil
+	}
+	deployment, err := c.k8sClient.GetDeployment(ctx, operatorDeployment, c.config.OperatorNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	watched, all := watchedNamespaces(deployment, c.config.OperatorNamespace)
+	switch {
+	case c.config.OperatorClusterScoped && !all:
+		problems = append(problems, fmt.Sprintf("AWX_OPERATOR_CLUSTER_SCOPED is set but the operator only watches %s (WATCH_NAMESPACE)", strings.Join(watched, ", ")))
+	case !all && !containsString(watched, c.config.Namespace):
+		problems = append(problems, fmt.Sprintf("operator only watches %s (WATCH_NAMESPACE), not %s", strings.Join(watched, ", "), c.config.Namespace))
+	case !c.config.OperatorClusterScoped && all:
+		log.Printf("Warning: operator in namespace %s watches all namespaces, set AWX_OPERATOR_CLUSTER_SCOPED=true", c.config.OperatorNamespace)
+	}
+	return problems, nil
+}
+
+// crdProblems looks the AWX CRD up at cluster scope, where CRDs live
+// whatever the scope of the operator
+func (c *OperatorScopeChecker) crdProblems(ctx context.Context) ([]string, error) {
+	name, err := c.k8sClient.CRDName(ctx, k8s.AWXGroup, k8s.AWXKind)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return []string{fmt.Sprintf("no CRD for %s/%s is registered (CRDs are cluster-wide, also for a namespace-scoped operator)", k8s.AWXGroup, k8s.AWXKind)}, nil
+	}
+	crd, err := c.k8sClient.GetCRD(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if crd == nil {
+		return []string{fmt.Sprintf("CRD %s was removed", name)}, nil
+	}
+
+	var problems []string
+	if !k8s.HasCondition(crd, "Established", "True") {
+		problems = append(problems, fmt.Sprintf("CRD %s is not Established", name))
+	}
+	if scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope"); scope != "Namespaced" {
+		problems = append(problems, fmt.Sprintf("CRD %s has scope %s, AWX instances need Namespaced", name, scope))
+	}
+	return problems, nil
+}
+
+// containsString reports whether a list includes a value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// scopedCRD returns the AWX CRD with the given scope and conditions
+func scopedCRD(scope string, conditions ...map[string]interface{}) *unstructured.Unstructured {
+	crd := awxCRD(conditions...)
+	unstructured.SetNestedField(crd.Object, scope, "spec", "scope")
+	return crd
+}
+
+func TestOperatorScopeProblems(t *testing.T) {
+	established := map[string]interface{}{"type": "Established", "status": "True"}
+	// operatorIn returns the operator of operatorObjects in a namespace
+	// with the given WATCH_NAMESPACE
+	operatorIn := func(namespace, watch string) []runtime.Object {
+		objects := operatorObjects(namespace)
+		deployment := objects[0].(*appsv1.Deployment)
+		deployment.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "WATCH_NAMESPACE", Value: watch}}
+		return objects
+	}
+
+	tests := []struct {
+		name          string
+		clusterScoped bool
+		objects       []runtime.Object
+		want          []string
+	}{
+		{
+			name:    "namespace-scoped operator",
+			objects: append(operatorIn("awx-operator", "awx"), scopedCRD("Namespaced", established)),
+		},
+		{
+			name:    "namespace-scoped operator watching all namespaces",
+			objects: append(operatorIn("awx-operator", ""), scopedCRD("Namespaced", established)),
+		},
+		{
+			name:    "namespace-scoped operator watching another namespace",
+			objects: append(operatorIn("awx-operator", "team-b"), scopedCRD("Namespaced", established)),
+			want:    []string{"operator only watches team-b (WATCH_NAMESPACE), not awx"},
+		},
+		{
+			name:          "cluster-scoped operator",
+			clusterScoped: true,
+			objects:       append(operatorIn("awx-operator", ""), scopedCRD("Namespaced", established)),
+		},
+		{
+			name:          "cluster-scoped setting for a namespace-scoped operator",
+			clusterScoped: true,
+			objects:       append(operatorIn("awx-operator", "awx"), scopedCRD("Namespaced", established)),
+			want:          []string{"AWX_OPERATOR_CLUSTER_SCOPED is set but the operator only watches awx (WATCH_NAMESPACE)"},
+		},
+		{
+			name:    "CRD missing",
+			objects: operatorIn("awx-operator", "awx"),
+			want:    []string{"no CRD for awx.ansible.com/AWX is registered (CRDs are cluster-wide, also for a namespace-scoped operator)"},
+		},
+		{
+			name:    "CRD not established and cluster-scoped",
+			objects: append(operatorIn("awx-operator", "awx"), scopedCRD("Cluster")),
+			want: []string{
+				"CRD awxs.awx.ansible.com is not Established",
+				"CRD awxs.awx.ansible.com has scope Cluster, AWX instances need Namespaced",
+			},
+		},
+		{
+			name:    "operator in another namespace",
+			objects: append(operatorIn("awx", "awx"), scopedCRD("Namespaced", established)),
+			want:    []string{"operator deployment awx-operator-controller-manager not found in namespace awx-operator"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_NAMESPACE": "awx", "AWX_OPERATOR_NAMESPACE": "awx-operator"}
+			if tt.clusterScoped {
+				env["AWX_OPERATOR_CLUSTER_SCOPED"] = "true"
+			}
+			cluster := k8stest.NewCluster(tt.objects...)
+			checker := NewOperatorScopeChecker(cluster.Client, testConfig(t, env))
+
+			problems, err := checker.Problems(context.Background())
+			if err != nil {
+				t.Fatalf("Problems() failed: %v", err)
+			}
+			if !reflect.DeepEqual(problems, tt.want) {
+				t.Errorf("Problems() = %q, want %q", problems, tt.want)
+			}
+
+			err = checker.Check(context.Background())
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Check() failed: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.want[0]) {
+				t.Errorf("Check() error = %v, want %q", err, tt.want[0])
+			}
+		})
+	}
+}
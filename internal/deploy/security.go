@@ -0,0 +1,38 @@
+package deploy
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+)
+
+// restrictedSecurityContext returns a container securityContext that passes
+// the PodSecurity "restricted" standard
+func restrictedSecurityContext() map[string]interface{} {
+	return map[string]interface{}{
+		"runAsNonRoot":             true,
+		"allowPrivilegeEscalation": false,
+		"capabilities": map[string]interface{}{
+			"drop": []interface{}{"ALL"},
+		},
+		"seccompProfile": map[string]interface{}{
+			"type": "RuntimeDefault",
+		},
+	}
+}
+
+// applySecurityProfile sets the AWX and Postgres container security contexts
+// for the configured PodSecurity profile. Without a profile the operator
+// defaults are left untouched.
+func applySecurityProfile(obj *unstructured.Unstructured, profile string) error {
+	if profile != config.PSSProfileRestricted {
+		return nil
+	}
+
+	for _, field := range []string{"security_context_settings", "postgres_security_context_settings"} {
+		if err := unstructured.SetNestedMap(obj.Object, restrictedSecurityContext(), "spec", field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package deploy
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// restrictedViolations checks a container securityContext against the
+// PodSecurity "restricted" standard and returns what it violates
+func restrictedViolations(securityContext map[string]interface{}) []string {
+	var violations []string
+	if nonRoot, _, _ := unstructured.NestedBool(securityContext, "runAsNonRoot"); !nonRoot {
+		violations = append(violations, "runAsNonRoot must be true")
+	}
+	if escalation, found, _ := unstructured.NestedBool(securityContext, "allowPrivilegeEscalation"); !found || escalation {
+		violations = append(violations, "allowPrivilegeEscalation must be false")
+	}
+	drop, _, _ := unstructured.NestedStringSlice(securityContext, "capabilities", "drop")
+	dropsAll := false
+	for _, capability := range drop {
+		dropsAll = dropsAll || capability == "ALL"
+	}
+	if !dropsAll {
+		violations = append(violations, "capabilities must drop ALL")
+	}
+	if add, _, _ := unstructured.NestedStringSlice(securityContext, "capabilities", "add"); len(add) > 0 {
+		violations = append(violations, fmt.Sprintf("capabilities must not add %v", add))
+	}
+	switch seccomp, _, _ := unstructured.NestedString(securityContext, "seccompProfile", "type"); seccomp {
+	case "RuntimeDefault", "Localhost":
+	default:
+		violations = append(violations, "seccompProfile must be RuntimeDefault or Localhost")
+	}
+	return violations
+}
+
+func TestApplySecurityProfile(t *testing.T) {
+	tests := []struct {
+		name          string
+		profile       string
+		wantCompliant bool
+	}{
+		{name: "no profile keeps operator defaults", profile: ""},
+		{name: "restricted", profile: "restricted", wantCompliant: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := awxManifest(t)
+			if err := applySecurityProfile(obj, tt.profile); err != nil {
+				t.Fatalf("applySecurityProfile() failed: %v", err)
+			}
+
+			for _, field := range []string{"security_context_settings", "postgres_security_context_settings"} {
+				securityContext, found, _ := unstructured.NestedMap(obj.Object, "spec", field)
+				if !tt.wantCompliant {
+					if found {
+						t.Errorf("spec.%s set without a profile", field)
+					}
+					continue
+				}
+				if violations := restrictedViolations(securityContext); len(violations) > 0 {
+					t.Errorf("spec.%s violates restricted: %v", field, violations)
+				}
+			}
+		})
+	}
+}
+
+func TestRestrictedViolations(t *testing.T) {
+	tests := []struct {
+		name            string
+		securityContext map[string]interface{}
+		want            int
+	}{
+		{name: "preset", securityContext: restrictedSecurityContext(), want: 0},
+		{name: "empty", securityContext: map[string]interface{}{}, want: 4},
+		{
+			name: "root with added capability",
+			securityContext: map[string]interface{}{
+				"runAsNonRoot":             false,
+				"allowPrivilegeEscalation": false,
+				"capabilities":             map[string]interface{}{"drop": []interface{}{"ALL"}, "add": []interface{}{"NET_ADMIN"}},
+				"seccompProfile":           map[string]interface{}{"type": "Unconfined"},
+			},
+			want: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restrictedViolations(tt.securityContext); len(got) != tt.want {
+				t.Errorf("restrictedViolations() = %v, want %d violations", got, tt.want)
+			}
+		})
+	}
+}
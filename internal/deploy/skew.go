@@ -0,0 +1,173 @@
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"awx-deployer/internal/config"
+)
+
+// versionSkew is a known-incompatible combination of operator and AWX image
+// versions. The versions are ranges like ">=24.0.0", "<2.14.0" or
+// ">=2.0.0 <2.6.0".
+type versionSkew struct {
+	Operator string `json:"operator"`
+	AWX      string `json:"awx"`
+	Reason   string `json:"reason"`
+}
+
+// versionSkews are the known-incompatible combinations. AWX_COMPATIBILITY_MATRIX
+// adds more. Each AWX major release needs the operator release it came with,
+// older operators lack the settings it expects.
+var versionSkews = []versionSkew{
+	{Operator: "<2.0.0", AWX: ">=22.0.0", Reason: "AWX 22 needs operator 2.0.0 or later"},
+	{Operator: "<2.6.0", AWX: ">=23.0.0", Reason: "AWX 23 needs operator 2.6.0 or later"},
+	{Operator: "<2.14.0", AWX: ">=24.0.0", Reason: "AWX 24 needs operator 2.14.0 or later"},
+}
+
+// versionRange is a range of versions, from min up to but excluding below.
+// A nil bound leaves that side open.
+type versionRange struct {
+	min   []int
+	below []int
+}
+
+// parseVersionRange parses space-separated >= and < constraints
+func parseVersionRange(constraints string) (versionRange, error) {
+	var r versionRange
+	fields := strings.Fields(constraints)
+	if len(fields) == 0 {
+		return r, fmt.Errorf("empty version range")
+	}
+	for _, field := range fields {
+		var bound *[]int
+		var version string
+		switch {
+		case strings.HasPrefix(field, ">="):
+			bound, version = &r.min, strings.TrimPrefix(field, ">=")
+		case strings.HasPrefix(field, "<"):
+			bound, version = &r.below, strings.TrimPrefix(field, "<")
+		default:
+			return r, fmt.Errorf("invalid version constraint %q (expected >=VERSION or <VERSION)", field)
+		}
+		parsed, err := parseVersionNumbers(version)
+		if err != nil {
+			return r, fmt.Errorf("invalid version constraint %q: %v", field, err)
+		}
+		*bound = parsed
+	}
+	return r, nil
+}
+
+// parseVersionNumbers parses the major, minor and patch numbers of a version
+// such as "2.19.1" or "v24.0.0"
+func parseVersionNumbers(version string) ([]int, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%q is not a version like 2.19.1", version)
+	}
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a version like 2.19.1", version)
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+
+// contains reports whether a version is in the range
+func (r versionRange) contains(version string) bool {
+	return (r.min == nil || versionAtLeast(version, r.min)) &&
+		(r.below == nil || !versionAtLeast(version, r.below))
+}
+
+// matches reports whether the skew covers the operator and AWX versions
+func (s versionSkew) matches(operatorVersion, awxVersion string) (bool, error) {
+	operatorRange, err := parseVersionRange(s.Operator)
+	if err != nil {
+		return false, fmt.Errorf("invalid operator range %q: %v", s.Operator, err)
+	}
+	awxRange, err := parseVersionRange(s.AWX)
+	if err != nil {
+		return false, fmt.Errorf("invalid awx range %q: %v", s.AWX, err)
+	}
+	return operatorRange.contains(operatorVersion) && awxRange.contains(awxVersion), nil
+}
+
+// VersionSkewChecker flags AWX image versions known not to work with the
+// operator version
+type VersionSkewChecker struct {
+	config *config.Config
+}
+
+// NewVersionSkewChecker creates a new version skew checker
+func NewVersionSkewChecker(config *config.Config) *VersionSkewChecker {
+	return &VersionSkewChecker{config: config}
+}
+
+// Check logs a warning for each known incompatibility of the AWX image
+// version with the operator version, or returns them as an error when
+// warnings are treated as errors. Without an AWX image version the operator
+// picks its own, which is compatible.
+func (c *VersionSkewChecker) Check() error {
+	if c.config.ImageVersion == "" {
+		return nil
+	}
+
+	skews, err := c.skews()
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, skew := range skews {
+		matches, err := skew.matches(c.config.OperatorVersion, c.config.ImageVersion)
+		if err != nil {
+			return err
+		}
+		if matches {
+			problems = append(problems, fmt.Sprintf("AWX image version %s is known not to work with operator %s: %s", c.config.ImageVersion, c.config.OperatorVersion, skew.Reason))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if c.config.TreatWarningsAsErrors {
+		return fmt.Errorf("version check failed: %s", strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		log.Printf("Warning: %s", problem)
+	}
+	return nil
+}
+
+// skews returns the built-in skews and those of AWX_COMPATIBILITY_MATRIX
+func (c *VersionSkewChecker) skews() ([]versionSkew, error) {
+	skews := versionSkews
+	if c.config.CompatibilityMatrix == "" {
+		return skews, nil
+	}
+
+	data, err := ioutil.ReadFile(c.config.CompatibilityMatrix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWX_COMPATIBILITY_MATRIX: %v", err)
+	}
+	var extra []versionSkew
+	if err := yaml.UnmarshalStrict(data, &extra); err != nil {
+		return nil, fmt.Errorf("failed to parse compatibility matrix %s: %v", c.config.CompatibilityMatrix, err)
+	}
+	for _, skew := range extra {
+		if skew.Operator == "" || skew.AWX == "" || skew.Reason == "" {
+			return nil, fmt.Errorf("invalid entry in compatibility matrix %s: operator, awx and reason are required", c.config.CompatibilityMatrix)
+		}
+	}
+	return append(append([]versionSkew{}, skews...), extra...), nil
+}
@@ -0,0 +1,133 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersionSkewCheckerCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// matrix is the content of AWX_COMPATIBILITY_MATRIX, unset if empty
+		matrix  string
+		wantErr string
+	}{
+		{
+			name: "compatible pairing",
+			env:  map[string]string{"AWX_OPERATOR_VERSION": "2.19.1", "AWX_IMAGE_VERSION": "24.6.1", "AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+		},
+		{
+			name: "operator picks the image",
+			env:  map[string]string{"AWX_OPERATOR_VERSION": "1.4.0", "AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+		},
+		{
+			name: "incompatible pairing warns",
+			env:  map[string]string{"AWX_OPERATOR_VERSION": "2.5.0", "AWX_IMAGE_VERSION": "24.0.0"},
+		},
+		{
+			name:    "incompatible pairing fails in strict mode",
+			env:     map[string]string{"AWX_OPERATOR_VERSION": "2.5.0", "AWX_IMAGE_VERSION": "24.0.0", "AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			wantErr: "version check failed: AWX image version 24.0.0 is known not to work with operator 2.5.0: AWX 23 needs operator 2.6.0 or later; AWX image version 24.0.0 is known not to work with operator 2.5.0: AWX 24 needs operator 2.14.0 or later",
+		},
+		{
+			name: "first operator of a major AWX release",
+			env:  map[string]string{"AWX_OPERATOR_VERSION": "2.14.0", "AWX_IMAGE_VERSION": "v24.0.0", "AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+		},
+		{
+			name: "matrix adds a pairing",
+			env:  map[string]string{"AWX_OPERATOR_VERSION": "2.19.1", "AWX_IMAGE_VERSION": "24.6.0", "AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			matrix: `- operator: ">=2.19.0 <2.20.0"
+  awx: ">=24.6.0 <24.6.1"
+  reason: AWX 24.6.0 fails migrations with operator 2.19
+`,
+			wantErr: "AWX 24.6.0 fails migrations with operator 2.19",
+		},
+		{
+			name: "matrix pairing not matched",
+			env:  map[string]string{"AWX_OPERATOR_VERSION": "2.19.1", "AWX_IMAGE_VERSION": "24.6.1", "AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			matrix: `- operator: ">=2.19.0 <2.20.0"
+  awx: ">=24.6.0 <24.6.1"
+  reason: AWX 24.6.0 fails migrations with operator 2.19
+`,
+		},
+		{
+			name:    "matrix entry without reason",
+			env:     map[string]string{"AWX_OPERATOR_VERSION": "2.19.1", "AWX_IMAGE_VERSION": "24.6.1"},
+			matrix:  `- {operator: "<3.0.0", awx: ">=25.0.0"}`,
+			wantErr: "operator, awx and reason are required",
+		},
+		{
+			name:    "matrix with unknown field",
+			env:     map[string]string{"AWX_OPERATOR_VERSION": "2.19.1", "AWX_IMAGE_VERSION": "24.6.1"},
+			matrix:  `- {operator: "<3.0.0", awx: ">=25.0.0", reason: r, severity: high}`,
+			wantErr: "failed to parse compatibility matrix",
+		},
+		{
+			name:    "matrix with invalid range",
+			env:     map[string]string{"AWX_OPERATOR_VERSION": "2.19.1", "AWX_IMAGE_VERSION": "24.6.1"},
+			matrix:  `- {operator: "~2.19", awx: ">=25.0.0", reason: r}`,
+			wantErr: `invalid operator range "~2.19"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			if tt.matrix != "" {
+				path := filepath.Join(t.TempDir(), "matrix.yaml")
+				if err := os.WriteFile(path, []byte(tt.matrix), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				env["AWX_COMPATIBILITY_MATRIX"] = path
+			}
+
+			err := NewVersionSkewChecker(testConfig(t, env)).Check()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Check() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Check() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVersionRangeContains(t *testing.T) {
+	tests := []struct {
+		constraints string
+		version     string
+		want        bool
+		wantErr     bool
+	}{
+		{constraints: ">=2.0.0 <2.6.0", version: "2.0.0", want: true},
+		{constraints: ">=2.0.0 <2.6.0", version: "2.5.9", want: true},
+		{constraints: ">=2.0.0 <2.6.0", version: "2.6.0"},
+		{constraints: ">=2.0.0 <2.6.0", version: "1.9.9"},
+		{constraints: "<2.14.0", version: "0.30.0", want: true},
+		{constraints: ">=24.0.0", version: "v24.0.0", want: true},
+		{constraints: "", wantErr: true},
+		{constraints: "=2.0.0", wantErr: true},
+		{constraints: ">=2.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraints+" "+tt.version, func(t *testing.T) {
+			r, err := parseVersionRange(tt.constraints)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseVersionRange(%q) error = %v, want error %v", tt.constraints, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := r.contains(tt.version); got != tt.want {
+				t.Errorf("%q contains %s = %v, want %v", tt.constraints, tt.version, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package deploy
+
+import (
+	"context"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// EnsureStateNamespace creates the namespace of the configmap state store and
+// the deploy lock if it does not exist yet, as before the first deployment
+// into the AWX namespace. Created as the AWX namespace, it gets its
+// PodSecurity labels.
+func EnsureStateNamespace(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config) error {
+	namespace := cfg.StateStoreNamespace()
+	var labels map[string]string
+	if namespace == cfg.Namespace {
+		labels = psaLabels(cfg)
+	}
+	return k8sClient.EnsureNamespace(ctx, namespace, labels)
+}
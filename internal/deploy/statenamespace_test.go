@@ -0,0 +1,65 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestEnsureStateNamespace(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		objects    []runtime.Object
+		wantName   string
+		wantLabels map[string]string
+	}{
+		{
+			name:       "AWX namespace created with its PodSecurity labels",
+			env:        map[string]string{"AWX_STATE_NAMESPACE": "awx"},
+			wantName:   "awx",
+			wantLabels: map[string]string{PSAEnforceLabel: "baseline"},
+		},
+		{
+			name:     "separate state namespace created without labels",
+			env:      map[string]string{"AWX_STATE_NAMESPACE": "awx-deployer"},
+			wantName: "awx-deployer",
+		},
+		{
+			name:       "existing namespace left alone",
+			env:        map[string]string{"AWX_STATE_NAMESPACE": "awx"},
+			objects:    []runtime.Object{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "awx", Labels: map[string]string{"team": "platform"}}}},
+			wantName:   "awx",
+			wantLabels: map[string]string{"team": "platform"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_NAMESPACE": "awx", "AWX_STATE_STORE": "configmap", "AWX_PSA_ENFORCE": "baseline"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			client := k8stest.NewCluster(tt.objects...).Client
+
+			if err := EnsureStateNamespace(context.Background(), client, testConfig(t, env)); err != nil {
+				t.Fatalf("EnsureStateNamespace() failed: %v", err)
+			}
+			ns, err := client.GetNamespace(context.Background(), tt.wantName)
+			if err != nil || ns == nil {
+				t.Fatalf("GetNamespace() = %v, %v, want namespace %s", ns, err, tt.wantName)
+			}
+			if len(ns.Labels) != 0 || len(tt.wantLabels) != 0 {
+				if !reflect.DeepEqual(ns.Labels, tt.wantLabels) {
+					t.Errorf("namespace labels = %v, want %v", ns.Labels, tt.wantLabels)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/images"
+	"awx-deployer/internal/k8s"
+)
+
+const (
+	// storageCheckTimeout bounds the storage probe job
+	storageCheckTimeout = 3 * time.Minute
+	// storageCheckMarker is printed by the probe once the sentinel file was read back
+	storageCheckMarker = "STORAGE_OK"
+	// storageCheckMountPath is where the probe mounts the claim
+	storageCheckMountPath = "/data"
+	// awxUID is the user AWX runs as, which owns the projects volume
+	awxUID = 1000
+)
+
+// storageProbeScript writes a sentinel file to the volume, reads it back
+// and removes it again
+const storageProbeScript = `set -e
+file=%[1]s/.awx-deployer-storage-check-%[2]s
+echo %[2]s > "$file"
+sync
+test "$(cat "$file")" = %[2]s
+rm -f "$file"
+echo %[3]s`
+
+// JobRunner runs a job to completion and returns its output
+type JobRunner interface {
+	// Run creates the job, waits for it to finish, returns the logs of its
+	// pod and deletes the job, also when it failed
+	Run(ctx context.Context, job *batchv1.Job) (string, error)
+}
+
+// StorageChecker verifies that the projects volume is actually writable by
+// writing and reading back a file from a short-lived job
+type StorageChecker struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	runner    JobRunner
+}
+
+// NewStorageChecker creates a new storage checker running its probe in the cluster
+func NewStorageChecker(k8sClient *k8s.KubernetesClient, config *config.Config) *StorageChecker {
+	return NewStorageCheckerWith(k8sClient, config, NewClusterJobRunner(k8sClient, config.Namespace))
+}
+
+// NewStorageCheckerWith creates a new storage checker using the given job runner
+func NewStorageCheckerWith(k8sClient *k8s.KubernetesClient, config *config.Config, runner JobRunner) *StorageChecker {
+	return &StorageChecker{
+		k8sClient: k8sClient,
+		config:    config,
+		runner:    runner,
+	}
+}
+
+// Check runs the probe against the projects claim
+func (s *StorageChecker) Check(ctx context.Context) error {
+	claim, err := s.projectsClaim(ctx)
+	if err != nil {
+		return err
+	}
+
+	nodeName := s.nodeUsingClaim(ctx, claim)
+	job := s.probeJob(claim, nodeName)
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, storageCheckTimeout+30*time.Second)
+	defer cancel()
+
+	log.Printf("Writing and reading back a file on persistent volume claim %s...", claim)
+	output, err := s.runner.Run(ctxWithTimeout, job)
+	if err != nil {
+		return fmt.Errorf("storage probe on claim %s failed: %v", claim, err)
+	}
+	if !strings.Contains(output, storageCheckMarker) {
+		return fmt.Errorf("storage probe on claim %s did not read back its file: %s", claim, strings.TrimSpace(output))
+	}
+
+	log.Printf("✓ Persistent volume claim %s is writable", claim)
+	return nil
+}
+
+// projectsClaim returns the claim the AWX instance keeps its projects on
+func (s *StorageChecker) projectsClaim(ctx context.Context) (string, error) {
+	awx, err := s.k8sClient.GetAWX(ctx, s.config.AWXName, s.config.Namespace)
+	if err != nil {
+		return "", err
+	}
+
+	if persistent, found, _ := unstructured.NestedBool(awx.Object, "spec", "projects_persistence"); found && !persistent {
+		return "", fmt.Errorf("projects persistence is disabled on %s, there is no volume to check", s.config.AWXName)
+	}
+	if claim, _, _ := unstructured.NestedString(awx.Object, "spec", "projects_existing_claim"); claim != "" {
+		return claim, nil
+	}
+	return fmt.Sprintf("%s-projects-claim", s.config.AWXName), nil
+}
+
+// nodeUsingClaim returns the node of a running pod that mounts the claim, so
+// that a ReadWriteOnce volume can be mounted by the probe as well
+func (s *StorageChecker) nodeUsingClaim(ctx context.Context, claim string) string {
+	pods, err := s.k8sClient.ListPods(ctx, "", s.config.Namespace)
+	if err != nil {
+		log.Printf("Warning: Could not list pods using claim %s: %v", claim, err)
+		return ""
+	}
+
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claim {
+				return pod.Spec.NodeName
+			}
+		}
+	}
+	return ""
+}
+
+// probeJob returns the job probing the claim, on the given node if set
+func (s *StorageChecker) probeJob(claim, nodeName string) *batchv1.Job {
+	token := fmt.Sprintf("%d", time.Now().UnixNano())
+	settings := images.NewSettings(s.config)
+	backoffLimit := int32(0)
+	deadline := int64(storageCheckTimeout.Seconds())
+	ttl := int32(300) // removes the job if the deployer dies before cleaning up
+	user := int64(awxUID)
+	nonRoot := true
+	noEscalation := false
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-storage-check-%d", s.config.AWXName, time.Now().Unix()),
+			Namespace: s.config.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   &deadline,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					NodeName:      nodeName,
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot:   &nonRoot,
+						RunAsUser:      &user,
+						RunAsGroup:     &user,
+						SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+					},
+					Containers: []corev1.Container{{
+						Name:            "probe",
+						Image:           settings.Rewrite(egressCheckImage),
+						ImagePullPolicy: corev1.PullPolicy(settings.PullPolicy),
+						Command:         []string{"/bin/sh", "-c", fmt.Sprintf(storageProbeScript, storageCheckMountPath, token, storageCheckMarker)},
+						VolumeMounts:    []corev1.VolumeMount{{Name: "data", MountPath: storageCheckMountPath}},
+						SecurityContext: &corev1.SecurityContext{
+							AllowPrivilegeEscalation: &noEscalation,
+							Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+						},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "data",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// ClusterJobRunner runs jobs in the cluster
+type ClusterJobRunner struct {
+	k8sClient *k8s.KubernetesClient
+	namespace string
+}
+
+// NewClusterJobRunner creates a new job runner for the namespace
+func NewClusterJobRunner(k8sClient *k8s.KubernetesClient, namespace string) *ClusterJobRunner {
+	return &ClusterJobRunner{
+		k8sClient: k8sClient,
+		namespace: namespace,
+	}
+}
+
+// Run creates the job and waits for it to succeed or fail. The job is
+// deleted afterwards in either case.
+func (r *ClusterJobRunner) Run(ctx context.Context, job *batchv1.Job) (string, error) {
+	job.Namespace = r.namespace
+	if err := r.k8sClient.CreateJob(ctx, job); err != nil {
+		return "", err
+	}
+	defer func() {
+		// clean up even if ctx is already done
+		if err := r.k8sClient.DeleteJob(context.Background(), job.Name, job.Namespace); err != nil {
+			log.Printf("Warning: Could not delete job %s: %v", job.Name, err)
+		}
+	}()
+
+	succeeded, err := r.waitForJob(ctx, job)
+	logs, logErr := r.k8sClient.GetPodLogs(ctx, "job-name="+job.Name, job.Namespace, "", 50)
+	if err != nil {
+		return logs, err
+	}
+	if !succeeded {
+		if logErr != nil {
+			return "", fmt.Errorf("job %s failed, and its logs could not be read: %v", job.Name, logErr)
+		}
+		return logs, fmt.Errorf("job %s failed: %s", job.Name, strings.TrimSpace(logs))
+	}
+	return logs, logErr
+}
+
+// waitForJob waits until the job succeeds or fails and reports which
+func (r *ClusterJobRunner) waitForJob(ctx context.Context, job *batchv1.Job) (bool, error) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		current, err := r.k8sClient.GetJob(ctx, job.Name, job.Namespace)
+		if err != nil {
+			log.Printf("Warning: Could not get job %s: %v", job.Name, err)
+		} else {
+			for _, condition := range current.Status.Conditions {
+				if condition.Status != corev1.ConditionTrue {
+					continue
+				}
+				switch condition.Type {
+				case batchv1.JobComplete:
+					return true, nil
+				case batchv1.JobFailed:
+					return false, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, fmt.Errorf("timeout waiting for job %s", job.Name)
+		case <-ticker.C:
+		}
+	}
+}
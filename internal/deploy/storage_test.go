@@ -0,0 +1,181 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// fakeJobRunner is a JobRunner with a canned result
+type fakeJobRunner struct {
+	output string
+	err    error
+	// jobs are the jobs run
+	jobs []*batchv1.Job
+}
+
+func (f *fakeJobRunner) Run(_ context.Context, job *batchv1.Job) (string, error) {
+	f.jobs = append(f.jobs, job)
+	return f.output, f.err
+}
+
+func TestStorageCheckerCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		spec map[string]interface{}
+		pods []runtime.Object
+		// output and err are the result of the probe job
+		output    string
+		err       error
+		wantErr   string
+		wantClaim string
+		wantNode  string
+	}{
+		{
+			name:      "writable",
+			output:    "STORAGE_OK\n",
+			wantClaim: "awx-instance-projects-claim",
+		},
+		{
+			name:      "existing claim",
+			spec:      map[string]interface{}{"projects_existing_claim": "shared-projects"},
+			output:    "STORAGE_OK\n",
+			wantClaim: "shared-projects",
+		},
+		{
+			name: "on the node of the pod using the claim",
+			pods: []runtime.Object{
+				claimPod("awx-instance-task-0", "node-b", corev1.PodRunning, "awx-instance-projects-claim"),
+				claimPod("awx-instance-task-1", "node-a", corev1.PodPending, "awx-instance-projects-claim"),
+				claimPod("other", "node-c", corev1.PodRunning, "other-claim"),
+			},
+			output:    "STORAGE_OK\n",
+			wantClaim: "awx-instance-projects-claim",
+			wantNode:  "node-b",
+		},
+		{
+			name:      "probe job fails",
+			err:       errors.New("job awx-instance-storage-check-1 failed: sh: can't create /data/.awx-deployer-storage-check: Read-only file system"),
+			wantErr:   "storage probe on claim awx-instance-projects-claim failed: job awx-instance-storage-check-1 failed: sh: can't create",
+			wantClaim: "awx-instance-projects-claim",
+		},
+		{
+			name:      "file not read back",
+			output:    "cat: can't open '/data/.awx-deployer-storage-check': No such file or directory\n",
+			wantErr:   "did not read back its file: cat: can't open",
+			wantClaim: "awx-instance-projects-claim",
+		},
+		{
+			name:    "projects persistence disabled",
+			spec:    map[string]interface{}{"projects_persistence": false},
+			wantErr: "projects persistence is disabled on awx-instance",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awx := k8stest.AWX("awx", "awx-instance")
+			for field, value := range tt.spec {
+				unstructured.SetNestedField(awx.Object, value, "spec", field)
+			}
+			cluster := k8stest.NewCluster(append([]runtime.Object{awx}, tt.pods...)...)
+			runner := &fakeJobRunner{output: tt.output, err: tt.err}
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": "awx-instance"})
+
+			err := NewStorageCheckerWith(cluster.Client, cfg, runner).Check(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Check() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Check() error = %v, want %q", err, tt.wantErr)
+			}
+
+			if tt.wantClaim == "" {
+				if len(runner.jobs) > 0 {
+					t.Errorf("probe job run without a claim to check")
+				}
+				return
+			}
+			if len(runner.jobs) != 1 {
+				t.Fatalf("%d probe jobs run, want 1", len(runner.jobs))
+			}
+			spec := runner.jobs[0].Spec.Template.Spec
+			if claim := spec.Volumes[0].PersistentVolumeClaim.ClaimName; claim != tt.wantClaim {
+				t.Errorf("probe mounts claim %s, want %s", claim, tt.wantClaim)
+			}
+			if spec.NodeName != tt.wantNode {
+				t.Errorf("probe runs on node %q, want %q", spec.NodeName, tt.wantNode)
+			}
+		})
+	}
+}
+
+// claimPod returns a pod on a node mounting a claim
+func claimPod(name, node string, phase corev1.PodPhase, claim string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "awx"},
+		Spec: corev1.PodSpec{
+			NodeName: node,
+			Volumes: []corev1.Volume{{
+				Name:         "projects",
+				VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestClusterJobRunnerRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition batchv1.JobConditionType
+		wantErr   string
+	}{
+		{name: "job succeeds", condition: batchv1.JobComplete},
+		{name: "job fails", condition: batchv1.JobFailed, wantErr: "job probe failed: fake logs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "probe-x7k2p", Namespace: "awx", Labels: map[string]string{"job-name": "probe"}},
+			})
+			// the job finishes as soon as it is created
+			cluster.Clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job).DeepCopy()
+				job.Status.Conditions = []batchv1.JobCondition{{Type: tt.condition, Status: corev1.ConditionTrue}}
+				return true, job, cluster.Clientset.Tracker().Create(action.GetResource(), job, job.Namespace)
+			})
+
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "probe"}}
+			output, err := NewClusterJobRunner(cluster.Client, "awx").Run(context.Background(), job)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Run() failed: %v", err)
+			}
+			// the fake clientset returns "fake logs" for every pod
+			if output != "fake logs" {
+				t.Errorf("output = %q, want the pod logs", output)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+
+			// the job is cleaned up either way
+			_, err = cluster.Clientset.BatchV1().Jobs("awx").Get(context.Background(), "probe", metav1.GetOptions{})
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("job left behind (err %v)", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// recreateStrategyPatch switches a deployment to the Recreate strategy. The
+// rollingUpdate settings must be cleared, the API server rejects them for
+// Recreate.
+const recreateStrategyPatch = `{"spec":{"strategy":{"type":"Recreate","rollingUpdate":null}}}`
+
+// postgresStrategyError returns an error unless the Postgres deployment uses
+// the Recreate strategy. With RollingUpdate the new pod is started while the
+// old one still holds the ReadWriteOnce data volume, so the rollout hangs.
+func postgresStrategyError(deployment *appsv1.Deployment) error {
+	strategy := deployment.Spec.Strategy.Type
+	if strategy == "" {
+		// the API server defaults an empty strategy to RollingUpdate
+		strategy = appsv1.RollingUpdateDeploymentStrategyType
+	}
+	if strategy == appsv1.RecreateDeploymentStrategyType {
+		return nil
+	}
+	return fmt.Errorf("PostgreSQL deployment %s uses the %s strategy, updates will hang waiting for its volume; it must use Recreate (set AWX_POSTGRES_RECREATE=true to switch it)", deployment.Name, strategy)
+}
+
+// verifyPostgresStrategy verifies the Postgres deployment uses the Recreate
+// strategy. A stateful set needs none, it deletes its pod before starting
+// the new one.
+func (v *DeploymentVerifier) verifyPostgresStrategy(ctx context.Context) error {
+	kind, workload, err := postgresWorkload(ctx, v.k8sClient, v.config)
+	if err != nil {
+		return err
+	}
+	if kind == "" {
+		return fmt.Errorf("PostgreSQL deployment or stateful set of AWX instance %s does not exist", v.config.AWXName)
+	}
+	if kind == postgresStatefulSet {
+		log.Printf("✓ PostgreSQL runs as stateful set %s, which needs no Recreate strategy", workload.GetName())
+		return nil
+	}
+
+	deployment, err := v.k8sClient.GetDeployment(ctx, workload.GetName(), v.config.Namespace)
+	if err != nil {
+		return err
+	}
+	if err := postgresStrategyError(deployment); err != nil {
+		return err
+	}
+
+	log.Printf("✓ PostgreSQL deployment %s uses the Recreate strategy", deployment.Name)
+	return nil
+}
+
+// ensurePostgresRecreate switches the Postgres deployment of the given name
+// to the Recreate strategy if it uses another one
+func (d *DeploymentWaiter) ensurePostgresRecreate(ctx context.Context, name string) error {
+	deployment, err := d.k8sClient.GetDeployment(ctx, name, d.config.Namespace)
+	if err != nil {
+		return err
+	}
+	if postgresStrategyError(deployment) == nil {
+		return nil
+	}
+
+	log.Printf("Switching PostgreSQL deployment %s from %s to the Recreate strategy...", name, deployment.Spec.Strategy.Type)
+	if _, err := d.k8sClient.PatchResource(ctx, "apps", "v1", "deployments", name, d.config.Namespace, types.MergePatchType, []byte(recreateStrategyPatch)); err != nil {
+		return fmt.Errorf("failed to set the strategy of deployment %s: %v", name, err)
+	}
+	return nil
+}
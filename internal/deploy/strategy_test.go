@@ -0,0 +1,131 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// postgresWithStrategy returns the Postgres deployment of the AWX instance
+// with the given strategy
+func postgresWithStrategy(strategy appsv1.DeploymentStrategyType) *appsv1.Deployment {
+	deployment := instanceDeployment("awx", "awx-instance", "database")
+	deployment.Name = "awx-instance-postgres-13"
+	deployment.Spec.Strategy.Type = strategy
+	if strategy == appsv1.RollingUpdateDeploymentStrategyType {
+		maxSurge := intstr.FromInt(1)
+		deployment.Spec.Strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{MaxSurge: &maxSurge}
+	}
+	return deployment
+}
+
+func TestVerifyPostgresStrategy(t *testing.T) {
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name:      "awx-instance-postgres-15",
+		Namespace: "awx",
+		Labels:    instanceLabels("awx-instance", "database"),
+	}}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		wantErr string
+	}{
+		{
+			name:    "Recreate",
+			objects: []runtime.Object{postgresWithStrategy(appsv1.RecreateDeploymentStrategyType)},
+		},
+		{
+			name:    "RollingUpdate",
+			objects: []runtime.Object{postgresWithStrategy(appsv1.RollingUpdateDeploymentStrategyType)},
+			wantErr: "PostgreSQL deployment awx-instance-postgres-13 uses the RollingUpdate strategy",
+		},
+		{
+			name:    "defaulted strategy",
+			objects: []runtime.Object{postgresWithStrategy("")},
+			wantErr: "uses the RollingUpdate strategy",
+		},
+		{
+			name:    "stateful set",
+			objects: []runtime.Object{statefulSet},
+		},
+		{
+			name:    "not created",
+			wantErr: "PostgreSQL deployment or stateful set of AWX instance awx-instance does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			v := NewDeploymentVerifier(cluster.Client, testConfig(t, nil))
+
+			err := v.verifyPostgresStrategy(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifyPostgresStrategy() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verifyPostgresStrategy() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnsurePostgresRecreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  appsv1.DeploymentStrategyType
+		wantPatch bool
+	}{
+		{name: "RollingUpdate", strategy: appsv1.RollingUpdateDeploymentStrategyType, wantPatch: true},
+		{name: "defaulted strategy", strategy: "", wantPatch: true},
+		{name: "Recreate", strategy: appsv1.RecreateDeploymentStrategyType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployment := postgresWithStrategy(tt.strategy)
+			cluster := k8stest.NewCluster(deployment)
+			waiter := NewDeploymentWaiter(cluster.Client, testConfig(t, map[string]string{"AWX_POSTGRES_RECREATE": "true"}))
+
+			if err := waiter.ensurePostgresRecreate(context.Background(), deployment.Name); err != nil {
+				t.Fatalf("ensurePostgresRecreate() failed: %v", err)
+			}
+
+			patched := false
+			for _, action := range append(cluster.Clientset.Actions(), cluster.Dynamic.Actions()...) {
+				if action.GetVerb() == "patch" {
+					patched = true
+				}
+			}
+			if patched != tt.wantPatch {
+				t.Errorf("deployment patched = %v, want %v", patched, tt.wantPatch)
+			}
+			if !tt.wantPatch {
+				return
+			}
+
+			obj, err := cluster.Dynamic.Resource(deploymentsGVR).Namespace("awx").Get(context.Background(), deployment.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got appsv1.Deployment
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType || got.Spec.Strategy.RollingUpdate != nil {
+				t.Errorf("strategy = %+v, want Recreate without rollingUpdate", got.Spec.Strategy)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ReadyTiming records when the components of the AWX instance became
+// ready, to tell which part of bringing AWX up after its CR was applied
+// takes longest, such as Postgres provisioning or image pulls
+type ReadyTiming struct {
+	// AppliedAt is when the AWX CR was applied, or when the wait started
+	// if it was not applied in the same run
+	AppliedAt time.Time
+	// Components are in the order they were waited for
+	Components []ComponentTiming
+}
+
+// ComponentTiming is when a component became ready
+type ComponentTiming struct {
+	Name string
+	// ReadyAt is the last transition of the component's ready condition,
+	// or of its pods' readiness, not when the wait got to it. A component
+	// ready since before AppliedAt is ready at AppliedAt.
+	ReadyAt time.Time
+	// Took is the time from AppliedAt to ReadyAt. Components come up in
+	// parallel, so these overlap and the longest is what the apply took.
+	Took time.Duration
+}
+
+// observe records a component ready at the given time
+func (t *ReadyTiming) observe(name string, readyAt time.Time) {
+	t.Components = append(t.Components, ComponentTiming{Name: name, ReadyAt: readyAt, Took: readyAt.Sub(t.AppliedAt)})
+}
+
+// Total returns the time from AppliedAt to the last component being ready
+func (t ReadyTiming) Total() time.Duration {
+	var total time.Duration
+	for _, component := range t.Components {
+		if component.Took > total {
+			total = component.Took
+		}
+	}
+	return total
+}
+
+// String summarizes the durations, e.g. "6m30s (AWX instance 10s,
+// PostgreSQL 1m20s, AWX web 5m50s, AWX task 6m30s)"
+func (t ReadyTiming) String() string {
+	parts := make([]string, 0, len(t.Components))
+	for _, component := range t.Components {
+		parts = append(parts, fmt.Sprintf("%s %s", component.Name, component.Took.Round(time.Second)))
+	}
+	return fmt.Sprintf("%s (%s)", t.Total().Round(time.Second), strings.Join(parts, ", "))
+}
+
+// observe records a component that became ready at since, as reported by
+// its conditions or pods. Without such a time it is taken as ready when the
+// wait saw it.
+func (d *DeploymentWaiter) observe(name string, since time.Time) {
+	switch {
+	case since.IsZero():
+		since = d.now()
+	case since.Before(d.timing.AppliedAt):
+		since = d.timing.AppliedAt
+	}
+	d.timing.observe(name, since)
+}
+
+// awxReadySince returns when a success condition of the AWX CR last
+// changed, zero if it cannot be read
+func (d *DeploymentWaiter) awxReadySince(ctx context.Context) time.Time {
+	awx, err := d.k8sClient.GetAWX(ctx, d.config.AWXName, d.config.Namespace)
+	if err != nil || awx == nil {
+		return time.Time{}
+	}
+	return conditionSince(awx, func(condition awxCondition) bool {
+		return matchesAny(d.reconcile.conditions.success, condition)
+	})
+}
+
+// roleReadySince returns when the deployment of an AWX component became
+// ready, see workloadReadySince
+func (d *DeploymentWaiter) roleReadySince(ctx context.Context, role instanceRole) time.Time {
+	deployment, err := findInstanceObject(ctx, d.k8sClient, d.config, deploymentsGVR, role)
+	if err != nil || deployment == nil {
+		return time.Time{}
+	}
+	return d.workloadReadySince(ctx, deployment)
+}
+
+// postgresReadySince returns when the PostgreSQL deployment or stateful
+// set became ready, see workloadReadySince
+func (d *DeploymentWaiter) postgresReadySince(ctx context.Context) time.Time {
+	_, workload, err := postgresWorkload(ctx, d.k8sClient, d.config)
+	if err != nil || workload == nil {
+		return time.Time{}
+	}
+	return d.workloadReadySince(ctx, workload)
+}
+
+// redisReadySince returns when the Redis deployment became ready, or the
+// AWX web deployment whose pods run Redis without one
+func (d *DeploymentWaiter) redisReadySince(ctx context.Context) time.Time {
+	redis, err := findInstanceObject(ctx, d.k8sClient, d.config, deploymentsGVR, roleRedis)
+	if err != nil {
+		return time.Time{}
+	}
+	if redis == nil {
+		return d.roleReadySince(ctx, roleWeb)
+	}
+	return d.workloadReadySince(ctx, redis)
+}
+
+// extraDeploymentReadySince returns when a deployment of
+// AWX_EXTRA_WAIT_DEPLOYMENTS became ready, see workloadReadySince
+func (d *DeploymentWaiter) extraDeploymentReadySince(ctx context.Context, name string) time.Time {
+	deployment, err := d.k8sClient.GetResource(ctx, "apps", "v1", "deployments", name, d.config.Namespace)
+	if err != nil || deployment == nil {
+		return time.Time{}
+	}
+	return d.workloadReadySince(ctx, deployment)
+}
+
+// selectorReadySince returns when the last of the pods matching a label
+// selector became ready
+func (d *DeploymentWaiter) selectorReadySince(ctx context.Context, selector string) time.Time {
+	pods, err := d.k8sClient.ListPods(ctx, selector, d.config.Namespace)
+	if err != nil {
+		return time.Time{}
+	}
+	return podsReadySince(pods)
+}
+
+// certificateReadySince returns when the Certificate of the ingress TLS
+// secret became Ready
+func (d *DeploymentWaiter) certificateReadySince(ctx context.Context) time.Time {
+	gvr := certificateGVR
+	cert, err := d.k8sClient.GetResource(ctx, gvr.Group, gvr.Version, gvr.Resource, d.config.TLSSecretName, d.config.Namespace)
+	if err != nil || cert == nil {
+		return time.Time{}
+	}
+	return conditionTrueSince(cert, "Ready")
+}
+
+// workloadReadySince returns when a deployment became Available or a
+// stateful set Ready, by the last transition of that condition. A workload
+// that has been so since before the apply, as through a rolling update, or
+// that lacks the condition, as stateful sets mostly do, became ready when
+// the last of its pods did.
+func (d *DeploymentWaiter) workloadReadySince(ctx context.Context, workload *unstructured.Unstructured) time.Time {
+	conditionType := "Ready"
+	if workload.GetKind() == "Deployment" {
+		conditionType = "Available"
+	}
+	since := conditionTrueSince(workload, conditionType)
+	if !since.IsZero() && !since.Before(d.timing.AppliedAt) {
+		return since
+	}
+
+	pods, err := workloadPods(ctx, d.k8sClient, d.config, workload)
+	if err != nil {
+		return since
+	}
+	if podsSince := podsReadySince(pods); !podsSince.IsZero() {
+		return podsSince
+	}
+	return since
+}
+
+// conditionTrueSince returns the last transition of a True status
+// condition of the given type, zero if there is none
+func conditionTrueSince(obj *unstructured.Unstructured, conditionType string) time.Time {
+	return conditionSince(obj, func(condition awxCondition) bool {
+		return strings.EqualFold(condition.Type, conditionType) && strings.EqualFold(condition.Status, "True")
+	})
+}
+
+// conditionSince returns the lastTransitionTime of the first status
+// condition match accepts, zero if none does or its time does not parse
+func conditionSince(obj *unstructured.Unstructured, match func(awxCondition) bool) time.Time {
+	list, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range list {
+		fields, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		condition := awxCondition{}
+		condition.Type, _ = fields["type"].(string)
+		condition.Status, _ = fields["status"].(string)
+		condition.Reason, _ = fields["reason"].(string)
+		if !match(condition) {
+			continue
+		}
+		transition, _ := fields["lastTransitionTime"].(string)
+		if since, err := time.Parse(time.RFC3339, transition); err == nil {
+			return since
+		}
+	}
+	return time.Time{}
+}
+
+// podsReadySince returns when the last of the pods became ready, by the
+// transitions of their Ready conditions. It is zero if a pod is not ready,
+// or if there are no pods.
+func podsReadySince(pods []corev1.Pod) time.Time {
+	var since time.Time
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			// pods of a previous rollout that are shutting down
+			continue
+		}
+		ready := false
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue && !condition.LastTransitionTime.IsZero() {
+				ready = true
+				if condition.LastTransitionTime.After(since) {
+					since = condition.LastTransitionTime.Time
+				}
+			}
+		}
+		if !ready {
+			return time.Time{}
+		}
+	}
+	return since
+}
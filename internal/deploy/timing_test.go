@@ -0,0 +1,128 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestReadyTimingString(t *testing.T) {
+	applied := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	timing := ReadyTiming{AppliedAt: applied}
+	timing.observe("AWX instance", applied.Add(10*time.Second))
+	timing.observe("PostgreSQL", applied.Add(80*time.Second))
+	timing.observe("AWX web", applied.Add(6*time.Minute+30*time.Second))
+	timing.observe("AWX task", applied.Add(5*time.Minute+50*time.Second))
+
+	if got := timing.Total(); got != 6*time.Minute+30*time.Second {
+		t.Errorf("Total() = %s, want 6m30s", got)
+	}
+	want := "6m30s (AWX instance 10s, PostgreSQL 1m20s, AWX web 6m30s, AWX task 5m50s)"
+	if got := timing.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestWaiterReadySince(t *testing.T) {
+	applied := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// at returns the given time after the apply as a condition time
+	at := func(offset time.Duration) metav1.Time { return metav1.NewTime(applied.Add(offset)) }
+	// available returns the web deployment, Available since the given time
+	// after the apply
+	available := func(offset time.Duration) *appsv1.Deployment {
+		web := instanceDeployment("awx", "awx-instance", "web")
+		web.Status.Conditions = []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue, LastTransitionTime: at(-time.Hour)},
+			{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue, LastTransitionTime: at(offset)},
+		}
+		return web
+	}
+	// readySince returns a pod of a workload, Ready since the given time
+	// after the apply
+	readySince := func(workload metav1.Object, name string, offset time.Duration) *corev1.Pod {
+		pod := workloadPod(workload, name)
+		pod.Status.Conditions[0].LastTransitionTime = at(offset)
+		return pod
+	}
+	rolledWeb := available(-time.Hour)
+	postgres := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name:      "awx-instance-postgres-15",
+		Namespace: "awx",
+		UID:       types.UID("awx-instance-postgres-15-uid"),
+		Labels:    instanceLabels("awx-instance", "database"),
+	}}
+	postgres.Spec.Selector = &metav1.LabelSelector{MatchLabels: postgres.Labels}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		since   func(d *DeploymentWaiter, ctx context.Context) time.Time
+		want    time.Duration
+	}{
+		{
+			name: "AWX CR success condition",
+			objects: []runtime.Object{awxWithConditions("awx", "awx-instance",
+				map[string]interface{}{"type": "Running", "status": "True", "lastTransitionTime": applied.Add(10 * time.Second).Format(time.RFC3339)},
+			)},
+			since: func(d *DeploymentWaiter, ctx context.Context) time.Time { return d.awxReadySince(ctx) },
+			want:  10 * time.Second,
+		},
+		{
+			name:    "deployment Available condition",
+			objects: []runtime.Object{available(4 * time.Minute)},
+			since:   func(d *DeploymentWaiter, ctx context.Context) time.Time { return d.roleReadySince(ctx, roleWeb) },
+			want:    4 * time.Minute,
+		},
+		{
+			name: "deployment available throughout a rolling update",
+			objects: []runtime.Object{
+				rolledWeb,
+				readySince(rolledWeb, "awx-instance-web-1", 3*time.Minute),
+				readySince(rolledWeb, "awx-instance-web-2", 5*time.Minute),
+			},
+			since: func(d *DeploymentWaiter, ctx context.Context) time.Time { return d.roleReadySince(ctx, roleWeb) },
+			want:  5 * time.Minute,
+		},
+		{
+			name:    "deployment ready since before the apply",
+			objects: []runtime.Object{rolledWeb, readySince(rolledWeb, "awx-instance-web-1", -time.Hour)},
+			since:   func(d *DeploymentWaiter, ctx context.Context) time.Time { return d.roleReadySince(ctx, roleWeb) },
+		},
+		{
+			name:    "stateful set without a Ready condition",
+			objects: []runtime.Object{postgres, readySince(postgres, "awx-instance-postgres-15-0", 80*time.Second)},
+			since:   func(d *DeploymentWaiter, ctx context.Context) time.Time { return d.postgresReadySince(ctx) },
+			want:    80 * time.Second,
+		},
+		{
+			name:    "no transition known",
+			objects: []runtime.Object{instanceDeployment("awx", "awx-instance", "task")},
+			since:   func(d *DeploymentWaiter, ctx context.Context) time.Time { return d.roleReadySince(ctx, roleTask) },
+			want:    6 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			waiter := NewDeploymentWaiter(cluster.Client, testConfig(t, map[string]string{"AWX_NAMESPACE": "awx"}))
+			// the wait got to the component long after it became ready
+			waiter.now = func() time.Time { return applied.Add(6 * time.Minute) }
+			waiter.SetAppliedAt(applied)
+
+			waiter.observe("component", tt.since(waiter, context.Background()))
+			components := waiter.Timing().Components
+			if len(components) != 1 || components[0].Took != tt.want {
+				t.Errorf("Timing() = %+v, want the component ready after %s", components, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package deploy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// TLSSecretApplier creates the ingress TLS secret from user-provided certificate files
+type TLSSecretApplier struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+}
+
+// NewTLSSecretApplier creates a new TLS secret applier
+func NewTLSSecretApplier(k8sClient *k8s.KubernetesClient, config *config.Config) *TLSSecretApplier {
+	return &TLSSecretApplier{
+		k8sClient: k8sClient,
+		config:    config,
+	}
+}
+
+// Apply creates or updates the TLS secret when certificate files are configured.
+// Without certificate files the secret is left to cert-manager. Nothing is
+// created when TLS is disabled.
+func (t *TLSSecretApplier) Apply(ctx context.Context) error {
+	if !t.config.TLS {
+		return nil
+	}
+	if t.config.TLSCertFile == "" && t.config.TLSKeyFile == "" {
+		if t.config.CertIssuer != "" {
+			log.Printf("TLS secret %s will be issued by cert-manager (%s), skipping", t.config.TLSSecretName, t.config.CertIssuer)
+		}
+		return nil
+	}
+
+	if t.config.CertIssuer != "" {
+		log.Printf("Warning: TLS certificate files are set, they take precedence over cert-manager issuer %s", t.config.CertIssuer)
+	}
+
+	log.Printf("Creating TLS secret %s from %s...", t.config.TLSSecretName, t.config.TLSCertFile)
+
+	certPEM, keyPEM, err := loadTLSKeyPair(t.config.TLSCertFile, t.config.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+
+	if err := t.k8sClient.EnsureNamespace(ctx, t.config.Namespace, psaLabels(t.config)); err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        t.config.TLSSecretName,
+			Namespace:   t.config.Namespace,
+			Annotations: map[string]string{SourceAnnotation: GeneratedSource},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+	if err := t.k8sClient.ApplySecret(ctx, secret); err != nil {
+		return fmt.Errorf("failed to apply TLS secret: %v", err)
+	}
+
+	log.Printf("✓ TLS secret %s created", t.config.TLSSecretName)
+	return nil
+}
+
+// loadTLSKeyPair reads the certificate and key files and checks that they form a valid pair
+func loadTLSKeyPair(certFile, keyFile string) ([]byte, []byte, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read TLS certificate %s: %v", certFile, err)
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read TLS key %s: %v", keyFile, err)
+	}
+
+	// X509KeyPair parses both PEM blocks and verifies the key matches the certificate
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return nil, nil, fmt.Errorf("invalid TLS certificate/key pair: %v", err)
+	}
+
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,160 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"awx-deployer/internal/awx"
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// APITokenIssuer creates an AWX API token for the admin user, so automation
+// can call the AWX API right after the deployment
+type APITokenIssuer struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	out       io.Writer
+}
+
+// NewAPITokenIssuer creates a new API token issuer printing to stdout
+func NewAPITokenIssuer(k8sClient *k8s.KubernetesClient, config *config.Config) *APITokenIssuer {
+	return &APITokenIssuer{
+		k8sClient: k8sClient,
+		config:    config,
+		out:       os.Stdout,
+	}
+}
+
+// apiTokenOutput is the token as printed or stored in the secret
+type apiTokenOutput struct {
+	Token   string `json:"token"`
+	Scope   string `json:"scope"`
+	Expires string `json:"expires"`
+	URL     string `json:"url"`
+}
+
+// Issue creates a personal access token of the admin user with the
+// configured scope and writes it to the configured secret, or prints it as
+// JSON. Tokens from earlier runs are revoked first, so re-runs do not pile
+// them up.
+func (t *APITokenIssuer) Issue(ctx context.Context) error {
+	if !t.config.EmitAPIToken {
+		return nil
+	}
+
+	client, user, err := t.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	if t.config.APITokenExpiry > 0 {
+		if err := client.SetTokenExpiry(ctx, t.config.APITokenExpiry); err != nil {
+			return fmt.Errorf("failed to set the AWX token expiry: %v", err)
+		}
+	}
+
+	if err := t.revokeTokens(ctx, client, user); err != nil {
+		return err
+	}
+
+	token, err := client.CreatePersonalToken(ctx, user.ID, apiTokenDescription(t.config), t.config.APITokenScope)
+	if err != nil {
+		return fmt.Errorf("failed to create AWX API token: %v", err)
+	}
+	output := apiTokenOutput{
+		Token:   token.Token,
+		Scope:   token.Scope,
+		Expires: token.Expires,
+		URL:     awxBaseURL(t.config),
+	}
+
+	if t.config.APITokenSecret == "" {
+		log.Printf("✓ Created AWX API token for %s (scope %s, expires %s)", user.Username, token.Scope, token.Expires)
+		return json.NewEncoder(t.out).Encode(output)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        t.config.APITokenSecret,
+			Namespace:   t.config.Namespace,
+			Annotations: map[string]string{SourceAnnotation: GeneratedSource},
+		},
+		Type: corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			"token":   output.Token,
+			"scope":   output.Scope,
+			"expires": output.Expires,
+			"url":     output.URL,
+		},
+	}
+	if err := t.k8sClient.ApplySecret(ctx, secret); err != nil {
+		return fmt.Errorf("failed to write AWX API token secret: %v", err)
+	}
+	log.Printf("✓ Created AWX API token for %s (scope %s, expires %s) in secret %s", user.Username, token.Scope, token.Expires, t.config.APITokenSecret)
+	return nil
+}
+
+// Revoke revokes the tokens created by Issue and deletes the token secret.
+// The secret is deleted even if AWX cannot be reached to revoke the tokens.
+func (t *APITokenIssuer) Revoke(ctx context.Context) error {
+	if !t.config.EmitAPIToken {
+		return nil
+	}
+
+	client, user, err := t.login(ctx)
+	if err == nil {
+		err = t.revokeTokens(ctx, client, user)
+	}
+
+	if t.config.APITokenSecret != "" {
+		log.Printf("Deleting Secret %s", t.config.APITokenSecret)
+		if deleteErr := t.k8sClient.DeleteSecret(ctx, t.config.APITokenSecret, t.config.Namespace); deleteErr != nil && err == nil {
+			err = deleteErr
+		}
+	}
+	return err
+}
+
+// login authenticates with the admin credentials of the install, which
+// differ from the configured ones when only some steps run
+func (t *APITokenIssuer) login(ctx context.Context) (*awx.Client, *awx.User, error) {
+	username, password, err := NewAdminRotator(t.k8sClient, t.config).currentCredentials(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := awx.NewClient(awxBaseURL(t.config), username, password, t.config.ProxyConfig().ProxyFunc())
+	user, err := client.Me(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to authenticate as admin %s: %v", username, err)
+	}
+	return client, user, nil
+}
+
+// revokeTokens deletes the tokens of the user created by the deployer
+func (t *APITokenIssuer) revokeTokens(ctx context.Context, client *awx.Client, user *awx.User) error {
+	tokens, err := client.PersonalTokens(ctx, user.ID, apiTokenDescription(t.config))
+	if err != nil {
+		return fmt.Errorf("failed to list AWX API tokens: %v", err)
+	}
+	for _, token := range tokens {
+		if err := client.DeleteToken(ctx, token.ID); err != nil {
+			return fmt.Errorf("failed to revoke AWX API token %d: %v", token.ID, err)
+		}
+		log.Printf("Revoked AWX API token %d (%s)", token.ID, token.Description)
+	}
+	return nil
+}
+
+// apiTokenDescription marks the tokens created by the deployer for an instance
+func apiTokenDescription(cfg *config.Config) string {
+	return fmt.Sprintf("awx-deployer %s/%s", cfg.Namespace, cfg.AWXName)
+}
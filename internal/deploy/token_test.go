@@ -0,0 +1,307 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/awx"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// tokenAPI is an AWX API with a single admin user and its personal tokens
+type tokenAPI struct {
+	password string
+
+	mu       sync.Mutex
+	tokens   []awx.Token
+	nextID   int
+	settings map[string]interface{}
+	deleted  []int
+}
+
+func (m *tokenAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != m.password {
+		http.Error(w, `{"detail": "Authentication credentials were not provided."}`, http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/me/":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]interface{}{{"id": 1, "username": "admin", "is_superuser": true}},
+		})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/users/1/personal_tokens/":
+		var results []awx.Token
+		for _, token := range m.tokens {
+			if token.Description == r.URL.Query().Get("description") {
+				results = append(results, token)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2/users/1/personal_tokens/":
+		var body struct {
+			Description string `json:"description"`
+			Scope       string `json:"scope"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		m.nextID++
+		token := awx.Token{ID: m.nextID, Description: body.Description, Scope: body.Scope, Expires: "2025-01-01T00:00:00Z"}
+		m.tokens = append(m.tokens, token)
+		token.Token = fmt.Sprintf("token-%d", token.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(token)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v2/tokens/"):
+		var id int
+		fmt.Sscanf(r.URL.Path, "/api/v2/tokens/%d/", &id)
+		for i, token := range m.tokens {
+			if token.ID == id {
+				m.tokens = append(m.tokens[:i], m.tokens[i+1:]...)
+				m.deleted = append(m.deleted, id)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/settings/authentication/":
+		json.NewEncoder(w).Encode(map[string]interface{}{"OAUTH2_PROVIDER": m.settings})
+	case r.Method == http.MethodPatch && r.URL.Path == "/api/v2/settings/authentication/":
+		var body struct {
+			OAuth2Provider map[string]interface{} `json:"OAUTH2_PROVIDER"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		m.settings = body.OAuth2Provider
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newTokenAPI returns an AWX API whose admin has the given password and
+// tokens, new tokens are numbered after them
+func newTokenAPI(password string, tokens []awx.Token) *tokenAPI {
+	api := &tokenAPI{password: password, tokens: tokens}
+	for _, token := range tokens {
+		if token.ID > api.nextID {
+			api.nextID = token.ID
+		}
+	}
+	return api
+}
+
+// installedAdmin returns the AWX CR and admin password secret of an install
+func installedAdmin(password string) []runtime.Object {
+	cr := k8stest.AWX("awx", "awx-instance")
+	unstructured.SetNestedField(cr.Object, "awx-admin-password", "spec", "admin_password_secret")
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-admin-password", Namespace: "awx"},
+		Data:       map[string][]byte{"password": []byte(password)},
+	}
+	return []runtime.Object{cr, secret}
+}
+
+// tokenEnv returns the env vars reaching AWX through the mock API as a
+// proxy, along with the given ones
+func tokenEnv(server *httptest.Server, env map[string]string) map[string]string {
+	all := map[string]string{"AWX_TLS": "false", "AWX_HOSTNAME": "awx.example.com", "AWX_PROXY_URL": server.URL}
+	for key, value := range env {
+		all[key] = value
+	}
+	return all
+}
+
+func TestAPITokenIssuerIssue(t *testing.T) {
+	description := "awx-deployer awx/awx-instance"
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		password string
+		// tokens exist before the run
+		tokens       []awx.Token
+		settings     map[string]interface{}
+		wantOutput   *apiTokenOutput
+		wantSecret   map[string]string
+		wantDeleted  []int
+		wantSettings map[string]interface{}
+		wantErr      string
+	}{
+		{
+			name:     "disabled",
+			password: "Admin-Pass-1",
+		},
+		{
+			name:       "printed as JSON",
+			env:        map[string]string{"AWX_EMIT_API_TOKEN": "true"},
+			password:   "Admin-Pass-1",
+			wantOutput: &apiTokenOutput{Token: "token-1", Scope: "write", Expires: "2025-01-01T00:00:00Z", URL: "http://awx.example.com"},
+		},
+		{
+			name:     "written to a secret with read scope",
+			env:      map[string]string{"AWX_EMIT_API_TOKEN": "true", "AWX_API_TOKEN_SCOPE": "read", "AWX_API_TOKEN_SECRET": "awx-api-token"},
+			password: "Admin-Pass-1",
+			wantSecret: map[string]string{
+				"token":   "token-1",
+				"scope":   "read",
+				"expires": "2025-01-01T00:00:00Z",
+				"url":     "http://awx.example.com",
+			},
+		},
+		{
+			name:         "expiry set keeping other OAuth2 settings",
+			env:          map[string]string{"AWX_EMIT_API_TOKEN": "true", "AWX_API_TOKEN_EXPIRY": "3600"},
+			password:     "Admin-Pass-1",
+			settings:     map[string]interface{}{"AUTHORIZATION_CODE_EXPIRE_SECONDS": float64(600)},
+			wantOutput:   &apiTokenOutput{Token: "token-1", Scope: "write", Expires: "2025-01-01T00:00:00Z", URL: "http://awx.example.com"},
+			wantSettings: map[string]interface{}{"AUTHORIZATION_CODE_EXPIRE_SECONDS": float64(600), "ACCESS_TOKEN_EXPIRE_SECONDS": float64(3600)},
+		},
+		{
+			name:     "earlier tokens of the deployer revoked",
+			env:      map[string]string{"AWX_EMIT_API_TOKEN": "true"},
+			password: "Admin-Pass-1",
+			tokens: []awx.Token{
+				{ID: 7, Description: description},
+				{ID: 8, Description: "created by hand"},
+			},
+			wantOutput:  &apiTokenOutput{Token: "token-9", Scope: "write", Expires: "2025-01-01T00:00:00Z", URL: "http://awx.example.com"},
+			wantDeleted: []int{7},
+		},
+		{
+			name:     "admin password out of sync",
+			env:      map[string]string{"AWX_EMIT_API_TOKEN": "true"},
+			password: "Stale-Admin-Pass-0",
+			wantErr:  "failed to authenticate as admin admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTokenAPI("Admin-Pass-1", tt.tokens)
+			api.settings = tt.settings
+			server := httptest.NewServer(api)
+			defer server.Close()
+
+			cluster := k8stest.NewCluster(installedAdmin(tt.password)...)
+			issuer := NewAPITokenIssuer(cluster.Client, testConfig(t, tokenEnv(server, tt.env)))
+			var out bytes.Buffer
+			issuer.out = &out
+
+			err := issuer.Issue(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Issue() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Issue() failed: %v", err)
+			}
+
+			if tt.wantOutput == nil && out.Len() > 0 {
+				t.Errorf("Issue() printed %q, want nothing", out.String())
+			}
+			if tt.wantOutput != nil {
+				var output apiTokenOutput
+				if err := json.Unmarshal(out.Bytes(), &output); err != nil {
+					t.Fatalf("Issue() printed %q, not JSON: %v", out.String(), err)
+				}
+				if output != *tt.wantOutput {
+					t.Errorf("Issue() printed %+v, want %+v", output, *tt.wantOutput)
+				}
+			}
+
+			secret, err := cluster.Clientset.CoreV1().Secrets("awx").Get(context.Background(), "awx-api-token", metav1.GetOptions{})
+			if tt.wantSecret == nil && err == nil {
+				t.Errorf("token secret written, want none")
+			}
+			if tt.wantSecret != nil {
+				if err != nil {
+					t.Fatalf("token secret not written: %v", err)
+				}
+				if !reflect.DeepEqual(secret.StringData, tt.wantSecret) {
+					t.Errorf("token secret = %v, want %v", secret.StringData, tt.wantSecret)
+				}
+			}
+
+			if !reflect.DeepEqual(api.deleted, tt.wantDeleted) {
+				t.Errorf("revoked tokens = %v, want %v", api.deleted, tt.wantDeleted)
+			}
+			if tt.wantSettings != nil && !reflect.DeepEqual(api.settings, tt.wantSettings) {
+				t.Errorf("OAuth2 settings = %v, want %v", api.settings, tt.wantSettings)
+			}
+		})
+	}
+}
+
+func TestAPITokenIssuerRevoke(t *testing.T) {
+	description := "awx-deployer awx/awx-instance"
+	tokenSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "awx-api-token", Namespace: "awx"}}
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		password    string
+		wantDeleted []int
+		// wantSecret is whether the token secret is left
+		wantSecret bool
+		wantErr    string
+	}{
+		{
+			name:        "tokens revoked and secret deleted",
+			env:         map[string]string{"AWX_EMIT_API_TOKEN": "true", "AWX_API_TOKEN_SECRET": "awx-api-token"},
+			password:    "Admin-Pass-1",
+			wantDeleted: []int{1},
+		},
+		{
+			name:       "disabled",
+			password:   "Admin-Pass-1",
+			wantSecret: true,
+		},
+		{
+			name:     "secret deleted when AWX rejects the login",
+			env:      map[string]string{"AWX_EMIT_API_TOKEN": "true", "AWX_API_TOKEN_SECRET": "awx-api-token"},
+			password: "Stale-Admin-Pass-0",
+			wantErr:  "failed to authenticate as admin admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTokenAPI("Admin-Pass-1", []awx.Token{{ID: 1, Description: description}, {ID: 2, Description: "created by hand"}})
+			server := httptest.NewServer(api)
+			defer server.Close()
+
+			cluster := k8stest.NewCluster(append(installedAdmin(tt.password), tokenSecret.DeepCopy())...)
+			err := NewAPITokenIssuer(cluster.Client, testConfig(t, tokenEnv(server, tt.env))).Revoke(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Revoke() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Revoke() error = %v, want %q", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(api.deleted, tt.wantDeleted) {
+				t.Errorf("revoked tokens = %v, want %v", api.deleted, tt.wantDeleted)
+			}
+			_, err = cluster.Clientset.CoreV1().Secrets("awx").Get(context.Background(), "awx-api-token", metav1.GetOptions{})
+			if left := !apierrors.IsNotFound(err); left != tt.wantSecret {
+				t.Errorf("token secret left = %v, want %v", left, tt.wantSecret)
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// Uninstaller removes the objects created from the generated manifests
+type Uninstaller struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	generator *ManifestGenerator
+
+	// gracePeriod is how long finalizers get to run, AWX_UNINSTALL_GRACE_PERIOD
+	gracePeriod time.Duration
+}
+
+// NewUninstaller creates a new uninstaller
+func NewUninstaller(k8sClient *k8s.KubernetesClient, config *config.Config) *Uninstaller {
+	return &Uninstaller{
+		k8sClient: k8sClient,
+		config:    config,
+		generator: NewManifestGenerator(config, DefaultManifestsPath),
+
+		gracePeriod: time.Duration(config.UninstallGracePeriod) * time.Minute,
+	}
+}
+
+// Uninstall deletes the AWX CR first, so the operator can run its finalizers
+// while it is still installed, then the PVCs the operator created for the
+// instance if enabled, then the remaining objects in reverse apply order.
+// Only objects from the generated manifests and PVCs verified to belong to
+// the instance are touched, and the AWX CRDs if enabled and no other AWX
+// resources are left.
+func (u *Uninstaller) Uninstall(ctx context.Context) error {
+	log.Println("Uninstalling AWX...")
+
+	manifests, err := u.generator.Generate()
+	if err != nil {
+		return err
+	}
+
+	for _, manifest := range manifests {
+		if err := forceNamespace(u.k8sClient, u.config, manifest.Object); err != nil {
+			return err
+		}
+	}
+
+	// the tokens live in the AWX database, which may outlive the instance
+	if err := NewAPITokenIssuer(u.k8sClient, u.config).Revoke(ctx); err != nil {
+		log.Printf("Warning: Could not revoke the AWX API tokens: %v", err)
+	}
+
+	for _, manifest := range manifests {
+		if isAWX(manifest.Object) {
+			manifest.Object.SetAPIVersion(k8s.AWXGroup + "/" + u.k8sClient.AWXVersion(ctx))
+			if err := u.deleteAWX(ctx, manifest.Object); err != nil {
+				return err
+			}
+		}
+	}
+
+	keptClaims, err := u.cleanupVolumeClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(manifests) - 1; i >= 0; i-- {
+		obj := manifests[i].Object
+		if isAWX(obj) {
+			continue
+		}
+		if obj.GetKind() == "PersistentVolume" {
+			if claim := u.boundClaim(ctx, obj); keptClaims[claim] {
+				log.Printf("Keeping PersistentVolume %s, it is bound to kept claim %s", obj.GetName(), claim)
+				continue
+			}
+		}
+
+		if u.config.AdoptExisting == config.AdoptExistingSkip {
+			current, err := u.k8sClient.GetObject(ctx, obj)
+			if err != nil {
+				return err
+			}
+			if current != nil && !managedByDeployer(current) {
+				log.Printf("Keeping %s, it is not managed by %s (AWX_ADOPT_EXISTING=%s)", describeObject(obj), ManagedByValue, config.AdoptExistingSkip)
+				continue
+			}
+		}
+
+		log.Printf("Deleting %s %s", obj.GetKind(), obj.GetName())
+		if err := u.k8sClient.DeleteObject(ctx, obj); err != nil {
+			return fmt.Errorf("failed to delete manifest %s: %v", manifests[i].Source, err)
+		}
+		if err := waitForDependents(ctx, u.k8sClient, u.config, obj); err != nil {
+			return err
+		}
+	}
+
+	if len(keptClaims) > 0 {
+		var names []string
+		for name := range keptClaims {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Printf("Left behind persistent volume claims with the instance data: %s (set AWX_DELETE_PVCS=true to delete them)", strings.Join(names, ", "))
+	}
+
+	if u.config.DeleteCRDs {
+		if err := u.deleteCRDs(ctx); err != nil {
+			return err
+		}
+	}
+
+	log.Println("AWX uninstalled successfully")
+	return nil
+}
+
+// deleteCRDs deletes the CustomResourceDefinitions of the AWX API group and
+// waits for them to be gone. Deleting a CRD deletes all of its resources
+// cluster-wide, so nothing is deleted while any AWX resources remain.
+func (u *Uninstaller) deleteCRDs(ctx context.Context) error {
+	crds, err := u.k8sClient.AWXCRDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	remaining, err := awxResources(ctx, u.k8sClient, crds)
+	if err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("refusing to delete the AWX CRDs, other AWX resources still exist: %s", strings.Join(remaining, ", "))
+	}
+
+	names := make([]string, 0, len(crds))
+	for _, crd := range crds {
+		log.Printf("Deleting CustomResourceDefinition %s", crd.GetName())
+		if err := u.k8sClient.DeleteCRD(ctx, crd.GetName()); err != nil {
+			return err
+		}
+		names = append(names, crd.GetName())
+	}
+
+	return u.waitForCRDDeletion(ctx, names, u.gracePeriod)
+}
+
+// awxResources lists the resources of the given AWX CRDs in all namespaces,
+// sorted
+func awxResources(ctx context.Context, k8sClient *k8s.KubernetesClient, crds []unstructured.Unstructured) ([]string, error) {
+	var resources []string
+	for i := range crds {
+		list, err := k8sClient.ListCustomResources(ctx, &crds[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to check for remaining AWX resources: %v", err)
+		}
+		for _, resource := range list {
+			resources = append(resources, fmt.Sprintf("%s %s/%s", resource.GetKind(), resource.GetNamespace(), resource.GetName()))
+		}
+	}
+	sort.Strings(resources)
+	return resources, nil
+}
+
+// waitForCRDDeletion waits for the named CRDs to be removed, which happens
+// once the API server has deleted all of their resources
+func (u *Uninstaller) waitForCRDDeletion(ctx context.Context, names []string, timeout time.Duration) error {
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		var remaining []string
+		for _, name := range names {
+			crd, err := u.k8sClient.GetCRD(ctxWithTimeout, name)
+			if err != nil {
+				log.Printf("Warning: Could not check CRD %s: %v", name, err)
+				remaining = append(remaining, name)
+			} else if crd != nil {
+				remaining = append(remaining, name)
+			} else {
+				log.Printf("✓ CustomResourceDefinition %s deleted", name)
+			}
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+		names = remaining
+		log.Printf("Waiting for CRDs %s to be deleted...", strings.Join(names, ", "))
+
+		select {
+		case <-ctxWithTimeout.Done():
+			return fmt.Errorf("CRDs %s are still present after %v", strings.Join(names, ", "), timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanupVolumeClaims deletes the PVCs of the instance when PVC deletion is
+// enabled, and otherwise returns them as kept
+func (u *Uninstaller) cleanupVolumeClaims(ctx context.Context) (map[string]bool, error) {
+	pvcs, err := u.k8sClient.ListPersistentVolumeClaims(ctx, u.config.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := map[string]bool{}
+	for _, pvc := range pvcs {
+		if !ownedByInstance(pvc.ObjectMeta, u.config.AWXName) {
+			continue
+		}
+
+		if !u.config.DeleteVolumeClaims {
+			kept[pvc.Name] = true
+			continue
+		}
+
+		log.Printf("Deleting PersistentVolumeClaim %s", pvc.Name)
+		if err := u.k8sClient.DeletePersistentVolumeClaim(ctx, pvc.Name, pvc.Namespace); err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
+
+// postgresInstanceLabel is the start of the app.kubernetes.io/instance label
+// of the operator's Postgres objects, e.g. postgres-15-<awx name>
+var postgresInstanceLabel = regexp.MustCompile(`^postgres(-[0-9]+)?-`)
+
+// ownedByInstance reports whether an object the operator created belongs to
+// the AWX instance, by an owner reference to the AWX CR or by the labels the
+// operator sets. Postgres claims come from a StatefulSet volume claim
+// template and only carry the labels. An owner reference to another AWX CR
+// wins over labels, and labels must name the instance exactly, so objects of
+// a sibling instance such as prod-awx next to awx are not taken for its own.
+func ownedByInstance(meta metav1.ObjectMeta, awxName string) bool {
+	if owner := instanceOwner(meta.OwnerReferences); owner != "" {
+		return owner == awxName
+	}
+
+	labels := meta.Labels
+	if labels["app.kubernetes.io/managed-by"] != "awx-operator" {
+		return false
+	}
+	instance := labels["app.kubernetes.io/instance"]
+	if prefix := postgresInstanceLabel.FindString(instance); prefix != "" && instance[len(prefix):] == awxName {
+		return true
+	}
+	return labels["app.kubernetes.io/part-of"] == awxName || instance == awxName
+}
+
+// instanceOwner returns the name of the AWX CR among the owner references,
+// empty if there is none
+func instanceOwner(references []metav1.OwnerReference) string {
+	for _, owner := range references {
+		if owner.Kind == k8s.AWXKind && strings.HasPrefix(owner.APIVersion, k8s.AWXGroup+"/") {
+			return owner.Name
+		}
+	}
+	return ""
+}
+
+// boundClaim returns the name of the claim in the AWX namespace that a
+// persistent volume is bound to, if any
+func (u *Uninstaller) boundClaim(ctx context.Context, pv *unstructured.Unstructured) string {
+	current, err := u.k8sClient.GetObject(ctx, pv)
+	if err != nil || current == nil {
+		return ""
+	}
+
+	namespace, _, _ := unstructured.NestedString(current.Object, "spec", "claimRef", "namespace")
+	name, _, _ := unstructured.NestedString(current.Object, "spec", "claimRef", "name")
+	if namespace != u.config.Namespace {
+		return ""
+	}
+	return name
+}
+
+// deleteAWX deletes an AWX CR and waits for its finalizers for the grace
+// period. Finalizers still blocking deletion afterwards are removed only when
+// force deletion is enabled.
+func (u *Uninstaller) deleteAWX(ctx context.Context, obj *unstructured.Unstructured) error {
+	log.Printf("Deleting %s %s", obj.GetKind(), obj.GetName())
+	if err := u.k8sClient.DeleteObject(ctx, obj); err != nil {
+		return err
+	}
+
+	remaining, err := waitForDeletion(ctx, u.k8sClient, obj, u.gracePeriod)
+	if err != nil || remaining == nil {
+		return err
+	}
+
+	finalizers := strings.Join(remaining.GetFinalizers(), ", ")
+	if !u.config.ForceDelete {
+		return fmt.Errorf("%s %s is still terminating after %v, blocked by finalizers %s (set AWX_FORCE_DELETE=true to remove them)", obj.GetKind(), obj.GetName(), u.gracePeriod, finalizers)
+	}
+
+	log.Printf("WARNING: %s %s is still terminating after %v, FORCE-REMOVING finalizers %s", obj.GetKind(), obj.GetName(), u.gracePeriod, finalizers)
+	log.Printf("WARNING: the operator's cleanup for %s %s will NOT run, check for leftover resources", obj.GetKind(), obj.GetName())
+	if err := u.k8sClient.RemoveFinalizers(ctx, obj); err != nil {
+		return err
+	}
+
+	remaining, err = waitForDeletion(ctx, u.k8sClient, obj, time.Minute)
+	if err != nil {
+		return err
+	}
+	if remaining != nil {
+		return fmt.Errorf("%s %s is still present after removing its finalizers", obj.GetKind(), obj.GetName())
+	}
+	return nil
+}
+
+// waitForDependents waits for a deleted object to be gone when deletes
+// propagate in the foreground, so that its dependents are gone before the
+// next object is deleted. It fails if the object is still there after the
+// uninstall grace period.
+func waitForDependents(ctx context.Context, k8sClient *k8s.KubernetesClient, cfg *config.Config, obj *unstructured.Unstructured) error {
+	if k8sClient.DeletePropagation() != metav1.DeletePropagationForeground {
+		return nil
+	}
+
+	gracePeriod := time.Duration(cfg.UninstallGracePeriod) * time.Minute
+	remaining, err := waitForDeletion(ctx, k8sClient, obj, gracePeriod)
+	if err != nil || remaining == nil {
+		return err
+	}
+	return fmt.Errorf("%s is still waiting for its dependents to be deleted after %v", describeObject(obj), gracePeriod)
+}
+
+// waitForDeletion waits for an object to be gone and returns what is left of
+// it when the timeout expires, or nil once it has been deleted
+func waitForDeletion(ctx context.Context, k8sClient *k8s.KubernetesClient, obj *unstructured.Unstructured, timeout time.Duration) (*unstructured.Unstructured, error) {
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var current *unstructured.Unstructured
+	for {
+		var err error
+		current, err = k8sClient.GetObject(ctxWithTimeout, obj)
+		if err != nil {
+			log.Printf("Warning: Could not check %s %s: %v", obj.GetKind(), obj.GetName(), err)
+		} else if current == nil {
+			log.Printf("✓ %s %s deleted", obj.GetKind(), obj.GetName())
+			return nil, nil
+		} else {
+			log.Printf("Waiting for %s %s to be deleted...", obj.GetKind(), obj.GetName())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("context cancelled waiting for %s %s to be deleted", obj.GetKind(), obj.GetName())
+		case <-ctxWithTimeout.Done():
+			if current == nil {
+				// the last check failed, read the object once more outside the timeout
+				return k8sClient.GetObject(ctx, obj)
+			}
+			return current, nil
+		case <-ticker.C:
+		}
+	}
+}
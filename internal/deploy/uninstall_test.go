@@ -0,0 +1,378 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// stuckAWX returns an AWX CR with a finalizer the operator would remove
+func stuckAWX(namespace, name string) *unstructured.Unstructured {
+	awx := k8stest.AWX(namespace, name)
+	awx.SetFinalizers([]string{"awx.ansible.com/finalizer"})
+	return awx
+}
+
+// honorFinalizers makes the fake cluster keep deleted AWX CRs with
+// finalizers terminating, and complete their deletion once the finalizers
+// are removed, as the API server does without an operator running them
+func honorFinalizers(cluster *k8stest.Cluster) {
+	tracker := cluster.Dynamic.Tracker()
+	cluster.Dynamic.PrependReactor("delete", k8s.AWXResource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		del := action.(k8stesting.DeleteAction)
+		obj, err := tracker.Get(del.GetResource(), del.GetNamespace(), del.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		awx := obj.(*unstructured.Unstructured).DeepCopy()
+		if len(awx.GetFinalizers()) == 0 {
+			return false, nil, nil
+		}
+		now := metav1.Now()
+		awx.SetDeletionTimestamp(&now)
+		return true, nil, tracker.Update(del.GetResource(), awx, del.GetNamespace())
+	})
+	cluster.Dynamic.PrependReactor("patch", k8s.AWXResource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		obj, err := tracker.Get(patch.GetResource(), patch.GetNamespace(), patch.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		awx := obj.(*unstructured.Unstructured).DeepCopy()
+		if awx.GetDeletionTimestamp() == nil || !strings.Contains(string(patch.GetPatch()), `"finalizers":null`) {
+			return false, nil, nil
+		}
+		awx.SetFinalizers(nil)
+		return true, awx, tracker.Delete(patch.GetResource(), patch.GetNamespace(), patch.GetName())
+	})
+}
+
+func TestUninstallerDeleteAWX(t *testing.T) {
+	tests := []struct {
+		name        string
+		awx         *unstructured.Unstructured
+		forceDelete string
+		wantErr     string
+		wantGone    bool
+		wantPatched bool
+	}{
+		{
+			name:     "no finalizers",
+			awx:      k8stest.AWX("awx", "awx-instance"),
+			wantGone: true,
+		},
+		{
+			name:    "stuck without force delete",
+			awx:     stuckAWX("awx", "awx-instance"),
+			wantErr: "blocked by finalizers awx.ansible.com/finalizer (set AWX_FORCE_DELETE=true to remove them)",
+		},
+		{
+			name:        "stuck with force delete",
+			awx:         stuckAWX("awx", "awx-instance"),
+			forceDelete: "true",
+			wantGone:    true,
+			wantPatched: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a sibling instance stuck the same way must be left alone
+			sibling := stuckAWX("awx", "other-awx")
+			now := metav1.Now()
+			sibling.SetDeletionTimestamp(&now)
+
+			cluster := k8stest.NewCluster(tt.awx, sibling)
+			honorFinalizers(cluster)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_FORCE_DELETE": tt.forceDelete})
+			u := NewUninstaller(cluster.Client, cfg)
+			u.gracePeriod = 50 * time.Millisecond
+
+			err := u.deleteAWX(context.Background(), k8stest.AWX("awx", "awx-instance"))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("deleteAWX() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("deleteAWX() error = %v, want %q", err, tt.wantErr)
+			}
+
+			current, err := cluster.Client.GetObject(context.Background(), k8stest.AWX("awx", "awx-instance"))
+			if err != nil {
+				t.Fatalf("GetObject() failed: %v", err)
+			}
+			if (current == nil) != tt.wantGone {
+				t.Errorf("AWX CR gone = %v, want %v", current == nil, tt.wantGone)
+			}
+			if current != nil && len(current.GetFinalizers()) == 0 {
+				t.Errorf("finalizers of the AWX CR were removed without AWX_FORCE_DELETE")
+			}
+
+			patched := false
+			for _, action := range cluster.Dynamic.Actions() {
+				if !action.Matches("patch", k8s.AWXResource) {
+					continue
+				}
+				if name := action.(k8stesting.PatchAction).GetName(); name != "awx-instance" {
+					t.Errorf("patched AWX CR %s, want only awx-instance", name)
+				}
+				patched = true
+			}
+			if patched != tt.wantPatched {
+				t.Errorf("finalizers removed = %v, want %v", patched, tt.wantPatched)
+			}
+
+			other, err := cluster.Client.GetObject(context.Background(), k8stest.AWX("awx", "other-awx"))
+			if err != nil || other == nil || len(other.GetFinalizers()) != 1 {
+				t.Errorf("sibling AWX CR = %v (err %v), want it untouched", other, err)
+			}
+		})
+	}
+}
+
+// volumeClaim returns a PVC in the awx namespace with the given labels and
+// owner AWX CR, if any
+func volumeClaim(name string, labels map[string]string, ownerAWX string) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "awx", Labels: labels},
+	}
+	if ownerAWX != "" {
+		pvc.OwnerReferences = []metav1.OwnerReference{{APIVersion: k8s.AWXGroup + "/v1beta1", Kind: k8s.AWXKind, Name: ownerAWX}}
+	}
+	return pvc
+}
+
+func TestUninstallerCleanupVolumeClaims(t *testing.T) {
+	claims := []runtime.Object{
+		volumeClaim("postgres-15-awx-instance-postgres-15-0", map[string]string{
+			"app.kubernetes.io/managed-by": "awx-operator",
+			"app.kubernetes.io/instance":   "postgres-15-awx-instance",
+		}, ""),
+		volumeClaim("awx-instance-projects-claim", nil, "awx-instance"),
+		// a sibling instance and an unrelated claim are never touched
+		volumeClaim("postgres-15-prod-awx-instance-postgres-15-0", map[string]string{
+			"app.kubernetes.io/managed-by": "awx-operator",
+			"app.kubernetes.io/instance":   "postgres-15-prod-awx-instance",
+		}, ""),
+		volumeClaim("prod-projects-claim", map[string]string{"app.kubernetes.io/part-of": "awx-instance"}, "prod-awx-instance"),
+		volumeClaim("data", nil, ""),
+	}
+	instanceClaims := []string{"awx-instance-projects-claim", "postgres-15-awx-instance-postgres-15-0"}
+	otherClaims := []string{"data", "postgres-15-prod-awx-instance-postgres-15-0", "prod-projects-claim"}
+
+	tests := []struct {
+		name       string
+		deletePVCs string
+		wantKept   []string
+		wantLeft   []string
+	}{
+		{
+			name:     "keep by default",
+			wantKept: instanceClaims,
+			wantLeft: append(append([]string(nil), instanceClaims...), otherClaims...),
+		},
+		{
+			name:       "delete",
+			deletePVCs: "true",
+			wantLeft:   otherClaims,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(claims...)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_NAME": "awx-instance", "AWX_DELETE_PVCS": tt.deletePVCs})
+			u := NewUninstaller(cluster.Client, cfg)
+
+			kept, err := u.cleanupVolumeClaims(context.Background())
+			if err != nil {
+				t.Fatalf("cleanupVolumeClaims() failed: %v", err)
+			}
+			var keptNames []string
+			for name := range kept {
+				keptNames = append(keptNames, name)
+			}
+			sort.Strings(keptNames)
+			if !reflect.DeepEqual(keptNames, tt.wantKept) {
+				t.Errorf("kept claims = %v, want %v", keptNames, tt.wantKept)
+			}
+
+			pvcs, err := cluster.Client.ListPersistentVolumeClaims(context.Background(), "awx")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var left []string
+			for _, pvc := range pvcs {
+				left = append(left, pvc.Name)
+			}
+			sort.Strings(left)
+			wantLeft := append([]string(nil), tt.wantLeft...)
+			sort.Strings(wantLeft)
+			if !reflect.DeepEqual(left, wantLeft) {
+				t.Errorf("claims left = %v, want %v", left, wantLeft)
+			}
+		})
+	}
+}
+
+func TestOwnedByInstance(t *testing.T) {
+	operatorLabels := func(instance string) map[string]string {
+		return map[string]string{"app.kubernetes.io/managed-by": "awx-operator", "app.kubernetes.io/instance": instance}
+	}
+	tests := []struct {
+		name string
+		meta metav1.ObjectMeta
+		want bool
+	}{
+		{name: "owner reference", meta: volumeClaim("c", nil, "awx").ObjectMeta, want: true},
+		{name: "owner reference to a sibling wins over labels", meta: volumeClaim("c", operatorLabels("awx"), "prod-awx").ObjectMeta},
+		{name: "instance label", meta: metav1.ObjectMeta{Labels: operatorLabels("awx")}, want: true},
+		{name: "postgres instance label", meta: metav1.ObjectMeta{Labels: operatorLabels("postgres-15-awx")}, want: true},
+		{name: "unversioned postgres instance label", meta: metav1.ObjectMeta{Labels: operatorLabels("postgres-awx")}, want: true},
+		{name: "postgres label of a sibling", meta: metav1.ObjectMeta{Labels: operatorLabels("postgres-15-prod-awx")}},
+		{name: "instance label of a sibling", meta: metav1.ObjectMeta{Labels: operatorLabels("prod-awx")}},
+		{name: "not managed by the operator", meta: metav1.ObjectMeta{Labels: map[string]string{"app.kubernetes.io/instance": "awx"}}},
+		{name: "no labels"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ownedByInstance(tt.meta, "awx"); got != tt.want {
+				t.Errorf("ownedByInstance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForDependents(t *testing.T) {
+	web := instanceDeployment("awx", "awx-instance", "web")
+
+	tests := []struct {
+		name    string
+		policy  metav1.DeletionPropagation
+		objects []runtime.Object
+		wantErr string
+	}{
+		{
+			name:    "background deletes do not wait",
+			policy:  metav1.DeletePropagationBackground,
+			objects: []runtime.Object{web},
+		},
+		{
+			name:   "foreground delete done",
+			policy: metav1.DeletePropagationForeground,
+		},
+		{
+			name:    "foreground delete still waiting for dependents",
+			policy:  metav1.DeletePropagationForeground,
+			objects: []runtime.Object{web},
+			wantErr: "context cancelled waiting for Deployment awx-instance-web to be deleted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			cluster.Client.SetDeletePropagation(tt.policy)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			obj := k8stest.Object("apps/v1", "Deployment", "awx", web.Name)
+			err := waitForDependents(ctx, cluster.Client, testConfig(t, nil), obj)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("waitForDependents() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("waitForDependents() failed: %v", err)
+			}
+		})
+	}
+}
+
+// servedCRD returns the CRD of a kind served at v1beta1
+func servedCRD(group, plural, kind string) *unstructured.Unstructured {
+	crd := k8stest.Object("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", plural+"."+group)
+	unstructured.SetNestedField(crd.Object, group, "spec", "group")
+	unstructured.SetNestedField(crd.Object, plural, "spec", "names", "plural")
+	unstructured.SetNestedField(crd.Object, kind, "spec", "names", "kind")
+	unstructured.SetNestedSlice(crd.Object, []interface{}{
+		map[string]interface{}{"name": "v1beta1", "served": true, "storage": true},
+	}, "spec", "versions")
+	return crd
+}
+
+func TestUninstallerDeleteCRDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []runtime.Object
+		wantErr   string
+	}{
+		{
+			name: "no AWX resources left",
+		},
+		{
+			name:      "AWX instance in another namespace",
+			resources: []runtime.Object{k8stest.AWX("team-b", "awx")},
+			wantErr:   "refusing to delete the AWX CRDs, other AWX resources still exist: AWX team-b/awx",
+		},
+		{
+			name: "backups left",
+			resources: []runtime.Object{
+				k8stest.Object(k8s.AWXGroup+"/v1beta1", "AWXBackup", "awx", "nightly"),
+				k8stest.AWX("team-b", "awx"),
+			},
+			wantErr: "other AWX resources still exist: AWX team-b/awx, AWXBackup awx/nightly",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crds := []runtime.Object{
+				servedCRD(k8s.AWXGroup, k8s.AWXResource, "AWX"),
+				servedCRD(k8s.AWXGroup, "awxbackups", "AWXBackup"),
+				servedCRD("cert-manager.io", "certificates", "Certificate"),
+			}
+			cluster := k8stest.NewCluster(append(crds, tt.resources...)...)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_DELETE_CRDS": "true"})
+			u := NewUninstaller(cluster.Client, cfg)
+			u.gracePeriod = 50 * time.Millisecond
+
+			err := u.deleteCRDs(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("deleteCRDs() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("deleteCRDs() error = %v, want %q", err, tt.wantErr)
+			}
+
+			awxCRDs, err := cluster.Client.AWXCRDs(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantLeft := 0
+			if tt.wantErr != "" {
+				wantLeft = 2
+			}
+			if len(awxCRDs) != wantLeft {
+				t.Errorf("%d AWX CRDs left, want %d", len(awxCRDs), wantLeft)
+			}
+			if crd, err := cluster.Client.GetCRD(context.Background(), "certificates.cert-manager.io"); err != nil || crd == nil {
+				t.Errorf("CRD of another group deleted (err %v)", err)
+			}
+		})
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"strings"
+	"time"
 
+	"awx-deployer/internal/awx"
 	"awx-deployer/internal/config"
+	"awx-deployer/internal/events"
 	"awx-deployer/internal/k8s"
 )
 
@@ -14,6 +18,9 @@ import (
 type DeploymentVerifier struct {
 	k8sClient *k8s.KubernetesClient
 	config    *config.Config
+
+	// runningVersion is the AWX version the version check found
+	runningVersion string
 }
 
 // NewDeploymentVerifier creates a new deployment verifier
@@ -24,48 +31,102 @@ func NewDeploymentVerifier(k8sClient *k8s.KubernetesClient, config *config.Confi
 	}
 }
 
-// Verify verifies that the AWX deployment is working correctly
+// verification is a single named verification check
+type verification struct {
+	name        string
+	description string
+	run         func(context.Context) error
+}
+
+// checks returns all verification checks in the order they run
+func (v *DeploymentVerifier) checks() []verification {
+	return []verification{
+		{"instance", "AWX instance", v.verifyAWXInstance},
+		{"operator-scope", "operator scope", NewOperatorScopeChecker(v.k8sClient, v.config).Check},
+		{"operator-rbac", "operator RBAC", NewOperatorRBACChecker(v.k8sClient, v.config).Check},
+		{"reconcile", "operator reconcile", NewReconcileChecker(v.k8sClient, v.config).Check},
+		{"postgres", "PostgreSQL", v.verifyPostgreSQL},
+		{"postgres-strategy", "PostgreSQL update strategy", v.verifyPostgresStrategy},
+		{"postgres-conflicts", "PostgreSQL sharing", NewDatabaseConflictChecker(v.k8sClient, v.config).Check},
+		{"web", "AWX web", v.verifyAWXWeb},
+		{"task", "AWX task", v.verifyAWXTask},
+		{"redis", "Redis", v.verifyRedis},
+		{"services", "Services", v.verifyServices},
+		{"ingress", "Ingress", v.verifyIngress},
+		{"dns", "DNS", v.verifyDNS},
+		{"storage", "Projects storage", v.verifyStorage},
+		{"api", "AWX API", v.verifyAPI},
+		{"migrations", "AWX database migrations", v.verifyMigrations},
+		{"version", "AWX version", v.verifyVersion},
+	}
+}
+
+// Verify verifies that the AWX deployment is working correctly.
+// Failures of warn-only checks are logged as warnings unless warnings are
+// treated as errors.
 func (v *DeploymentVerifier) Verify(ctx context.Context) error {
 	log.Println("Verifying AWX deployment...")
 
-	// Verify AWX instance exists
-	if err := v.verifyAWXInstance(ctx); err != nil {
-		return fmt.Errorf("AWX instance verification failed: %v", err)
+	if err := v.run(ctx, v.checks()); err != nil {
+		return err
 	}
 
-	// Verify PostgreSQL is running
-	if err := v.verifyPostgreSQL(ctx); err != nil {
-		return fmt.Errorf("PostgreSQL verification failed: %v", err)
-	}
+	log.Println("AWX deployment verification completed successfully!")
+	return nil
+}
 
-	// Verify AWX web is running
-	if err := v.verifyAWXWeb(ctx); err != nil {
-		return fmt.Errorf("AWX web verification failed: %v", err)
+// run runs the checks in order and returns the first failure that is not
+// warn-only
+func (v *DeploymentVerifier) run(ctx context.Context, checks []verification) error {
+	if err := v.validateWarnOnlyChecks(checks); err != nil {
+		return err
 	}
 
-	// Verify AWX task manager is running
-	if err := v.verifyAWXTask(ctx); err != nil {
-		return fmt.Errorf("AWX task verification failed: %v", err)
-	}
+	for _, check := range checks {
+		err := check.run(ctx)
+		if err == nil {
+			continue
+		}
 
-	// Verify services exist
-	if err := v.verifyServices(ctx); err != nil {
-		return fmt.Errorf("Services verification failed: %v", err)
+		if v.isWarnOnly(check.name) && !v.config.TreatWarningsAsErrors {
+			log.Printf("Warning: %s verification failed: %v", check.description, err)
+			continue
+		}
+		return fmt.Errorf("%s verification failed: %v", check.description, err)
 	}
+	return nil
+}
 
-	// Verify ingress (if configured)
-	if err := v.verifyIngress(ctx); err != nil {
-		log.Printf("Warning: Ingress verification failed: %v", err)
-		// Don't fail verification for ingress issues, just warn
+// isWarnOnly reports whether a check's failure only produces a warning
+func (v *DeploymentVerifier) isWarnOnly(name string) bool {
+	for _, warnOnly := range v.config.WarnOnlyChecks {
+		if warnOnly == name {
+			return true
+		}
 	}
+	return false
+}
 
-	log.Println("AWX deployment verification completed successfully!")
+// validateWarnOnlyChecks rejects unknown names in the warn-only check list
+func (v *DeploymentVerifier) validateWarnOnlyChecks(checks []verification) error {
+	for _, warnOnly := range v.config.WarnOnlyChecks {
+		known := false
+		for _, check := range checks {
+			if check.name == warnOnly {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown check %q in AWX_WARN_ONLY_CHECKS", warnOnly)
+		}
+	}
 	return nil
 }
 
 // verifyAWXInstance verifies the AWX custom resource exists
 func (v *DeploymentVerifier) verifyAWXInstance(ctx context.Context) error {
-	exists, err := v.k8sClient.ResourceExists(ctx, "awx.ansible.com", "v1beta1", "awxs", v.config.AWXName, v.config.Namespace)
+	exists, err := v.k8sClient.AWXExists(ctx, v.config.AWXName, v.config.Namespace)
 	if err != nil {
 		return fmt.Errorf("failed to check AWX instance: %v", err)
 	}
@@ -78,124 +139,243 @@ func (v *DeploymentVerifier) verifyAWXInstance(ctx context.Context) error {
 	return nil
 }
 
-// verifyPostgreSQL verifies PostgreSQL deployment and pods
-func (v *DeploymentVerifier) verifyPostgreSQL(ctx context.Context) error {
-	// Check PostgreSQL deployment
-	postgresDeployment := fmt.Sprintf("%s-postgres-15", v.config.AWXName)
-	exists, err := v.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", postgresDeployment, v.config.Namespace)
-	if err != nil {
-		return fmt.Errorf("failed to check PostgreSQL deployment: %v", err)
+// verifyStorage writes and reads back a file on the projects volume when
+// the deep storage check is enabled
+func (v *DeploymentVerifier) verifyStorage(ctx context.Context) error {
+	if !v.config.DeepStorageCheck {
+		return nil
 	}
+	return NewStorageChecker(v.k8sClient, v.config).Check(ctx)
+}
 
-	if !exists {
-		return fmt.Errorf("PostgreSQL deployment %s does not exist", postgresDeployment)
+// verifyAPI pings the AWX API through the ingress and logs in as the admin
+// user when the API check is enabled. Requests are retried while the backend
+// behind a new ingress warms up, for at most AWX_VERIFY_TIMEOUT minutes.
+func (v *DeploymentVerifier) verifyAPI(ctx context.Context) error {
+	if !v.config.VerifyAPI {
+		return nil
 	}
 
-	// Check PostgreSQL pod status
-	labelSelector := fmt.Sprintf("app.kubernetes.io/name=postgres,app.kubernetes.io/instance=%s", v.config.AWXName)
-	status, err := v.k8sClient.GetPodStatus(ctx, labelSelector, v.config.Namespace)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(v.config.VerifyTimeout)*time.Minute)
+	defer cancel()
+
+	client, user, baseURL, err := v.apiClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get PostgreSQL pod status: %v", err)
+		return err
 	}
 
-	if !strings.Contains(status, "Running") {
-		return fmt.Errorf("PostgreSQL pod is not running, status: %s", status)
+	if _, err := client.Ping(ctx); err != nil {
+		return fmt.Errorf("AWX API at %s is not answering: %v", baseURL, err)
+	}
+	if _, err := client.Me(ctx); err != nil {
+		return fmt.Errorf("failed to log in to the AWX API as %s: %v", user, err)
 	}
 
-	log.Printf("✓ PostgreSQL is running")
+	log.Printf("✓ AWX API at %s answers and accepts the admin login", baseURL)
 	return nil
 }
 
-// verifyAWXWeb verifies that the AWX web deployment is running
-func (v *DeploymentVerifier) verifyAWXWeb(ctx context.Context) error {
-	// Check AWX web deployment
-	webDeployment := fmt.Sprintf("%s-web", v.config.AWXName)
-	exists, err := v.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", webDeployment, v.config.Namespace)
+// verifyMigrations waits for AWX to finish its database migrations when the
+// migrations check is enabled. Pods are Ready while migrations still run.
+func (v *DeploymentVerifier) verifyMigrations(ctx context.Context) error {
+	if !v.config.VerifyMigrations {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(v.config.VerifyTimeout)*time.Minute)
+	defer cancel()
+
+	client, _, _, err := v.apiClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to check AWX web deployment: %v", err)
+		return err
 	}
+	return waitForMigrations(ctx, client, migrationPollInterval)
+}
 
-	if !exists {
-		return fmt.Errorf("AWX web deployment %s does not exist", webDeployment)
+// migrationPollInterval is how often the ping endpoint is polled while AWX
+// migrates its database
+const migrationPollInterval = 10 * time.Second
+
+// waitForMigrations polls the ping endpoint until AWX stops redirecting to
+// its migrations page and lists a registered instance, which it only does
+// once the migrations ran
+func waitForMigrations(ctx context.Context, client *awx.Client, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	state := "not checked"
+	for {
+		status, err := client.Ping(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return fmt.Errorf("timeout waiting for AWX database migrations to complete (%s)", state)
+		case err == awx.ErrMigrating:
+			state = "migrations running"
+		case err != nil:
+			state = err.Error()
+		case len(status.Instances) == 0:
+			state = "no instance registered yet"
+		default:
+			log.Printf("✓ AWX %s finished its database migrations, %d instance(s) registered", status.Version, len(status.Instances))
+			return nil
+		}
+		events.Progressf(ctx, "waiting for AWX database migrations: %s", state)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for AWX database migrations to complete (%s)", state)
+		case <-ticker.C:
+		}
+	}
+}
+
+// apiClient returns a client of the AWX API at AWX_HOSTNAME, or at the AWX
+// service with AWX_VERIFY_VIA_SERVICE, authenticated as the admin user of the
+// AWX CR, the name of that user and the URL of the API
+func (v *DeploymentVerifier) apiClient(ctx context.Context) (*awx.Client, string, string, error) {
+	user, password, err := NewAdminRotator(v.k8sClient, v.config).currentCredentials(ctx)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	baseURL := awxBaseURL(v.config)
+	if v.config.VerifyViaService {
+		if baseURL, err = serviceURL(ctx, v.k8sClient, v.config); err != nil {
+			return nil, "", "", fmt.Errorf("failed to determine the AWX service URL: %v", err)
+		}
+	}
+
+	client := awx.NewClient(baseURL, user, password, v.config.ProxyConfig().ProxyFunc())
+	client.SetRetryPolicy(awx.RetryPolicy{
+		Retries:  v.config.VerifyRetries,
+		Interval: time.Duration(v.config.VerifyRetryInterval) * time.Second,
+	})
+	return client, user, baseURL, nil
+}
+
+// verifyPostgreSQL verifies the PostgreSQL deployment or stateful set
+func (v *DeploymentVerifier) verifyPostgreSQL(ctx context.Context) error {
+	kind, workload, err := postgresWorkload(ctx, v.k8sClient, v.config)
+	if err != nil {
+		return err
+	}
+
+	if kind == "" {
+		return fmt.Errorf("PostgreSQL deployment or stateful set of AWX instance %s does not exist", v.config.AWXName)
 	}
 
-	// Check AWX web pod status
-	labelSelector := fmt.Sprintf("app.kubernetes.io/name=awx-web,app.kubernetes.io/instance=%s", v.config.AWXName)
-	status, err := v.k8sClient.GetPodStatus(ctx, labelSelector, v.config.Namespace)
+	ready, status, err := postgresStatus(ctx, v.k8sClient, v.config, kind, workload)
 	if err != nil {
-		return fmt.Errorf("failed to get AWX web pod status: %v", err)
+		return err
 	}
 
-	if !strings.Contains(status, "Running") {
-		return fmt.Errorf("AWX web pod is not running, status: %s", status)
+	if !ready {
+		return fmt.Errorf("PostgreSQL is not ready, %s", status)
 	}
 
-	log.Printf("✓ AWX web deployment %s is running", webDeployment)
+	log.Printf("✓ PostgreSQL is ready (%s)", status)
 	return nil
 }
 
+// verifyAWXWeb verifies that the AWX web deployment is running
+func (v *DeploymentVerifier) verifyAWXWeb(ctx context.Context) error {
+	return v.verifyComponent(ctx, roleWeb)
+}
+
 // verifyAWXTask verifies that the AWX task deployment is running
 func (v *DeploymentVerifier) verifyAWXTask(ctx context.Context) error {
-	// Check AWX task deployment
-	taskDeployment := fmt.Sprintf("%s-task", v.config.AWXName)
-	exists, err := v.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", taskDeployment, v.config.Namespace)
+	return v.verifyComponent(ctx, roleTask)
+}
+
+// verifyComponent verifies that the deployment of an AWX component exists
+// and its pods are ready
+func (v *DeploymentVerifier) verifyComponent(ctx context.Context, role instanceRole) error {
+	deployment, err := findInstanceObject(ctx, v.k8sClient, v.config, deploymentsGVR, role)
 	if err != nil {
-		return fmt.Errorf("failed to check AWX task deployment: %v", err)
+		return fmt.Errorf("failed to check %s deployment: %v", role.description, err)
 	}
 
-	if !exists {
-		return fmt.Errorf("AWX task deployment %s does not exist", taskDeployment)
+	if deployment == nil {
+		return fmt.Errorf("%s deployment of AWX instance %s does not exist", role.description, v.config.AWXName)
 	}
 
-	// Check AWX task pod status
-	labelSelector := fmt.Sprintf("app.kubernetes.io/name=awx-task,app.kubernetes.io/instance=%s", v.config.AWXName)
-	status, err := v.k8sClient.GetPodStatus(ctx, labelSelector, v.config.Namespace)
+	status, err := workloadPodStatus(ctx, v.k8sClient, v.config, deployment)
 	if err != nil {
-		return fmt.Errorf("failed to get AWX task pod status: %v", err)
+		return fmt.Errorf("failed to get %s pod status: %v", role.description, err)
 	}
 
-	if !strings.Contains(status, "Running") {
-		return fmt.Errorf("AWX task pod is not running, status: %s", status)
+	if !status.Ready() {
+		return fmt.Errorf("%s pod is not ready, status: %s", role.description, status)
 	}
 
-	log.Printf("✓ AWX task deployment %s is running", taskDeployment)
+	log.Printf("✓ %s deployment %s is ready", role.description, deployment.GetName())
 	return nil
 }
 
-// verifyServices verifies that the required services exist
-func (v *DeploymentVerifier) verifyServices(ctx context.Context) error {
-	services := []string{
-		fmt.Sprintf("%s-service", v.config.AWXName),
-		fmt.Sprintf("%s-postgres-15", v.config.AWXName),
+// verifyRedis verifies that Redis is running when the install includes it
+func (v *DeploymentVerifier) verifyRedis(ctx context.Context) error {
+	if v.config.RedisExternal {
+		log.Printf("Redis is external (%s:%d), skipping check", v.config.RedisHost, v.config.RedisPort)
+		return nil
+	}
+	if !redisExpected(v.config) {
+		log.Printf("Operator %s does not run Redis, skipping check (set AWX_VERIFY_REDIS=true to force it)", v.config.OperatorVersion)
+		return nil
+	}
+
+	running, status, err := redisStatus(ctx, v.k8sClient, v.config)
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		return fmt.Errorf("Redis is not running, %s", status)
 	}
 
-	for _, service := range services {
-		exists, err := v.k8sClient.ResourceExists(ctx, "", "v1", "services", service, v.config.Namespace)
+	log.Printf("✓ Redis is running (%s)", status)
+	return nil
+}
+
+// verifyServices verifies that the required services exist
+func (v *DeploymentVerifier) verifyServices(ctx context.Context) error {
+	for _, role := range []instanceRole{roleService, rolePostgres} {
+		service, err := findInstanceObject(ctx, v.k8sClient, v.config, servicesGVR, role)
 		if err != nil {
-			return fmt.Errorf("failed to check service %s: %v", service, err)
+			return fmt.Errorf("failed to check %s service: %v", role.description, err)
 		}
 
-		if !exists {
-			return fmt.Errorf("service %s does not exist", service)
+		if service == nil {
+			return fmt.Errorf("%s service of AWX instance %s does not exist", role.description, v.config.AWXName)
 		}
-		log.Printf("✓ Service %s exists", service)
+		log.Printf("✓ Service %s exists", service.GetName())
 	}
 
 	return nil
 }
 
-// verifyIngress verifies the ingress resource exists and gets its status
+// verifyIngress verifies the ingress resource exists and gets its status.
+// AWX exposed through its service alone has no ingress to check, how to
+// reach it is logged instead.
 func (v *DeploymentVerifier) verifyIngress(ctx context.Context) error {
-	ingressName := fmt.Sprintf("%s-ingress", v.config.AWXName)
-	exists, err := v.k8sClient.ResourceExists(ctx, "networking.k8s.io", "v1", "ingresses", ingressName, v.config.Namespace)
+	exposure, err := getExposure(ctx, v.k8sClient, v.config)
+	if err != nil {
+		return fmt.Errorf("failed to determine AWX exposure: %v", err)
+	}
+	if !exposure.HasIngress() {
+		v.logServiceAccess(ctx, exposure)
+		return nil
+	}
+
+	ingress, err := findInstanceObject(ctx, v.k8sClient, v.config, ingressesGVR, roleIngress)
 	if err != nil {
 		return fmt.Errorf("failed to check ingress: %v", err)
 	}
 
-	if !exists {
-		log.Printf("Ingress %s not configured, skipping status check.", ingressName)
+	if ingress == nil {
+		log.Printf("Ingress of AWX instance %s not configured, skipping status check.", v.config.AWXName)
 		return nil
 	}
+	ingressName := ingress.GetName()
 
 	status, err := v.k8sClient.GetIngressStatus(ctx, ingressName, v.config.Namespace)
 	if err != nil {
@@ -203,5 +383,62 @@ func (v *DeploymentVerifier) verifyIngress(ctx context.Context) error {
 	}
 
 	log.Printf("✓ Ingress status for %s: %s", ingressName, status)
+
+	// the dns check resolves the hosts itself
+	if !v.config.WaitIngress || v.config.VerifyDNS || status == "Pending" {
+		return nil
+	}
+	return checkHostsResolve(ctx, newHostResolver(v.config), exposure.Hostnames, status)
+}
+
+// logServiceAccess reports how to reach AWX exposed through its service
+// alone, which has no ingress to check
+func (v *DeploymentVerifier) logServiceAccess(ctx context.Context, exposure Exposure) {
+	accessURL, err := AccessURL(ctx, v.k8sClient, v.config)
+	if err != nil {
+		log.Printf("AWX is exposed via %s service without an ingress, skipping ingress check (access method unknown: %v)", exposure.ServiceType, err)
+		return
+	}
+	log.Printf("AWX is exposed via %s service without an ingress, skipping ingress check. Access: %s", exposure.ServiceType, accessURL)
+}
+
+// lookupHost resolves a host name, replaced in tests
+var lookupHost = net.DefaultResolver.LookupHost
+
+// checkHostsResolve checks that every host resolves to the address of the
+// ingress, which is an IP or a host name resolved in turn
+func checkHostsResolve(ctx context.Context, resolve hostResolver, hosts []string, address string) error {
+	want := []string{address}
+	if net.ParseIP(address) == nil {
+		resolved, err := resolve(ctx, address)
+		if err != nil {
+			return fmt.Errorf("failed to resolve ingress address %s: %v", address, err)
+		}
+		want = resolved
+	}
+
+	var problems []string
+	for _, host := range hosts {
+		addresses, err := resolve(ctx, host)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s does not resolve: %v", host, err))
+			continue
+		}
+		matched := false
+		for _, a := range addresses {
+			if containsString(want, a) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			problems = append(problems, fmt.Sprintf("%s resolves to %s, not to the ingress address %s", host, strings.Join(addresses, ", "), strings.Join(want, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("AWX hosts do not all point at the ingress: %s", strings.Join(problems, "; "))
+	}
+
+	log.Printf("✓ %s resolve to the ingress address %s", strings.Join(hosts, ", "), address)
 	return nil
 }
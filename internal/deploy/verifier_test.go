@@ -0,0 +1,452 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/awx"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+func TestVerifyWarnOnlyChecks(t *testing.T) {
+	pass := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("no address") }
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		ingress func(context.Context) error
+		api     func(context.Context) error
+		wantErr string
+	}{
+		{
+			name:    "all checks pass",
+			ingress: pass,
+			api:     pass,
+		},
+		{
+			name:    "ingress failure only warns by default",
+			ingress: fail,
+			api:     pass,
+		},
+		{
+			name:    "ingress failure fails in strict mode",
+			env:     map[string]string{"AWX_TREAT_WARNINGS_AS_ERRORS": "true"},
+			ingress: fail,
+			api:     pass,
+			wantErr: "Ingress verification failed: no address",
+		},
+		{
+			name:    "ingress failure fails when not warn-only",
+			env:     map[string]string{"AWX_WARN_ONLY_CHECKS": "api"},
+			ingress: fail,
+			api:     pass,
+			wantErr: "Ingress verification failed",
+		},
+		{
+			name:    "overridden warn-only check only warns",
+			env:     map[string]string{"AWX_WARN_ONLY_CHECKS": "ingress,api"},
+			ingress: pass,
+			api:     fail,
+		},
+		{
+			name:    "other check failures always fail",
+			ingress: pass,
+			api:     fail,
+			wantErr: "AWX API verification failed",
+		},
+		{
+			name:    "unknown warn-only check",
+			env:     map[string]string{"AWX_WARN_ONLY_CHECKS": "ingres"},
+			ingress: pass,
+			api:     pass,
+			wantErr: `unknown check "ingres" in AWX_WARN_ONLY_CHECKS`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewDeploymentVerifier(nil, testConfig(t, tt.env))
+			checks := []verification{
+				{"ingress", "Ingress", tt.ingress},
+				{"api", "AWX API", tt.api},
+			}
+
+			err := v.run(context.Background(), checks)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("run() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("run() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyComponentReadiness(t *testing.T) {
+	web := instanceDeployment("awx", "awx-instance", "web")
+	// Running, but its container has not passed its readiness probe
+	notReady := workloadPod(web, "awx-instance-web-1", corev1.ContainerStatus{Name: "awx-web"})
+	// frontend is the web deployment under a name the operator does not
+	// give it by default
+	frontend := instanceDeployment("awx", "awx-instance", "web")
+	frontend.Name, frontend.UID = "frontend", "frontend-uid"
+	// sibling is the web deployment of another instance in the namespace,
+	// whose pods share the name pattern and the labels awx-instance selects
+	sibling := instanceDeployment("awx", "awx-instance-2", "web")
+	siblingPod := func(ready bool) *corev1.Pod {
+		pod := workloadPod(sibling, "awx-instance-2-web-1", corev1.ContainerStatus{Name: "awx-web", Ready: ready})
+		pod.Labels = map[string]string{}
+		for key, value := range web.Labels {
+			pod.Labels[key] = value
+		}
+		return pod
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		wantErr string
+	}{
+		{
+			name:    "ready pod",
+			objects: []runtime.Object{web, workloadPod(web, "awx-instance-web-1", corev1.ContainerStatus{Name: "awx-web", Ready: true})},
+		},
+		{
+			name:    "ready pod of a custom-named deployment",
+			objects: []runtime.Object{frontend, workloadPod(frontend, "frontend-1", corev1.ContainerStatus{Name: "awx-web", Ready: true})},
+		},
+		{
+			name:    "running pod failing its readiness probe",
+			objects: []runtime.Object{web, notReady},
+			wantErr: "AWX web pod is not ready, status: Running, 0/1 ready",
+		},
+		{
+			name:    "ready pod next to a failing pod of another instance",
+			objects: []runtime.Object{web, workloadPod(web, "awx-instance-web-1", corev1.ContainerStatus{Name: "awx-web", Ready: true}), sibling, siblingPod(false)},
+		},
+		{
+			name:    "failing pod next to a ready pod of another instance",
+			objects: []runtime.Object{web, notReady, sibling, siblingPod(true)},
+			wantErr: "AWX web pod is not ready, status: Running, 0/1 ready",
+		},
+		{
+			name:    "only pods of another instance",
+			objects: []runtime.Object{web, sibling, siblingPod(true)},
+			wantErr: "AWX web pod is not ready, status: No pods found",
+		},
+		{
+			name:    "no pods",
+			objects: []runtime.Object{web},
+			wantErr: "AWX web pod is not ready, status: No pods found",
+		},
+		{
+			name:    "no deployment",
+			wantErr: "AWX web deployment of AWX instance awx-instance does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			verifier := NewDeploymentVerifier(cluster.Client, testConfig(t, map[string]string{"AWX_NAMESPACE": "awx"}))
+
+			err := verifier.verifyComponent(context.Background(), roleWeb)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("verifyComponent() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("verifyComponent() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIngress(t *testing.T) {
+	httpPort := corev1.ServicePort{Name: "http", Port: 80, NodePort: 30080}
+	internalIP := corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.5"}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		wantLog string
+	}{
+		{
+			name: "NodePort",
+			objects: []runtime.Object{
+				awxWithSpec("awx", "awx-instance", map[string]interface{}{"service_type": "NodePort"}),
+				awxService(corev1.ServiceTypeNodePort, httpPort),
+				node("node-1", internalIP),
+			},
+			wantLog: "AWX is exposed via NodePort service without an ingress, skipping ingress check. Access: http://10.0.0.5:30080",
+		},
+		{
+			name: "ClusterIP",
+			objects: []runtime.Object{
+				awxWithSpec("awx", "awx-instance", map[string]interface{}{"service_type": "ClusterIP"}),
+				awxService(corev1.ServiceTypeClusterIP, corev1.ServicePort{Name: "http", Port: 80}),
+			},
+			wantLog: "AWX is exposed via ClusterIP service without an ingress, skipping ingress check. Access: http://localhost:8080 (run: kubectl port-forward -n awx svc/awx-instance-service 8080:80)",
+		},
+		{
+			name:    "ClusterIP service missing",
+			objects: []runtime.Object{awxWithSpec("awx", "awx-instance", map[string]interface{}{"service_type": "ClusterIP"})},
+			wantLog: "AWX is exposed via ClusterIP service without an ingress, skipping ingress check (access method unknown: service of AWX instance awx-instance does not exist)",
+		},
+		{
+			name:    "ingress",
+			objects: []runtime.Object{exposedAWX("ingress"), awxIngress("198.51.100.7")},
+			wantLog: "✓ Ingress status for awx-instance-ingress",
+		},
+		{
+			name:    "ingress not created",
+			objects: []runtime.Object{exposedAWX("ingress")},
+			wantLog: "Ingress of AWX instance awx-instance not configured, skipping status check.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			cluster := k8stest.NewCluster(tt.objects...)
+			verifier := NewDeploymentVerifier(cluster.Client, testConfig(t, map[string]string{"AWX_NAMESPACE": "awx"}))
+
+			if err := verifier.verifyIngress(context.Background()); err != nil {
+				t.Fatalf("verifyIngress() failed: %v", err)
+			}
+			if !strings.Contains(buf.String(), tt.wantLog) {
+				t.Errorf("log = %q, want %q", buf.String(), tt.wantLog)
+			}
+			if strings.Contains(buf.String(), "Warning") {
+				t.Errorf("log = %q, want no warning", buf.String())
+			}
+		})
+	}
+}
+
+// migratingAPI answers the ping endpoint in phases: it redirects to the
+// migrations page for the first migrating requests, then lists no instance
+// for the next unregistered requests, then lists one
+type migratingAPI struct {
+	mu           sync.Mutex
+	migrating    int
+	unregistered int
+	requests     int
+}
+
+func (a *migratingAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/migrations_notran/") {
+		fmt.Fprint(w, "AWX is currently upgrading.")
+		return
+	}
+
+	a.mu.Lock()
+	request := a.requests
+	a.requests++
+	a.mu.Unlock()
+
+	switch {
+	case request < a.migrating:
+		http.Redirect(w, r, "/migrations_notran/", http.StatusFound)
+	case request < a.migrating+a.unregistered:
+		fmt.Fprint(w, `{"version": "24.6.1", "instances": []}`)
+	default:
+		fmt.Fprint(w, `{"version": "24.6.1", "instances": [{"node": "awx-task-0", "capacity": 100}]}`)
+	}
+}
+
+func TestWaitForMigrations(t *testing.T) {
+	tests := []struct {
+		name         string
+		api          *migratingAPI
+		wantRequests int
+		wantErr      string
+	}{
+		{
+			name:         "migrated",
+			api:          &migratingAPI{},
+			wantRequests: 1,
+		},
+		{
+			name:         "migrating then ready",
+			api:          &migratingAPI{migrating: 2},
+			wantRequests: 3,
+		},
+		{
+			name:         "migrated before the instance registers",
+			api:          &migratingAPI{migrating: 1, unregistered: 2},
+			wantRequests: 4,
+		},
+		{
+			name:    "still migrating",
+			api:     &migratingAPI{migrating: 1000},
+			wantErr: "timeout waiting for AWX database migrations to complete (migrations running)",
+		},
+		{
+			name:    "instance never registers",
+			api:     &migratingAPI{unregistered: 1000},
+			wantErr: "(no instance registered yet)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(tt.api)
+			defer ts.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			client := awx.NewClient(ts.URL, "admin", "Admin-Pass-1", nil)
+
+			err := waitForMigrations(ctx, client, 5*time.Millisecond)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("waitForMigrations() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("waitForMigrations() failed: %v", err)
+			}
+			if tt.api.requests != tt.wantRequests {
+				t.Errorf("API got %d ping requests, want %d", tt.api.requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestAPIClientIngressPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		ingressPath string
+		wantPath    string
+	}{
+		{name: "served at the root", wantPath: "/api/v2/ping/"},
+		{name: "served under a subpath", ingressPath: "/awx", wantPath: "/awx/api/v2/ping/"},
+		{name: "subpath with a trailing slash", ingressPath: "/tools/awx/", wantPath: "/tools/awx/api/v2/ping/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.Path)
+				fmt.Fprint(w, `{"version": "24.6.1"}`)
+			}))
+			defer ts.Close()
+
+			cluster := k8stest.NewCluster(
+				k8stest.AWX("awx", "awx-instance"),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "awx-instance-admin-password", Namespace: "awx"},
+					Data:       map[string][]byte{"password": []byte("Admin-Pass-1")},
+				},
+			)
+			cfg := testConfig(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_TLS": "false", "AWX_INGRESS_PATH": tt.ingressPath})
+			// a host:port does not pass as AWX_HOSTNAME
+			cfg.AWXHostname = strings.TrimPrefix(ts.URL, "http://")
+			v := NewDeploymentVerifier(cluster.Client, cfg)
+
+			client, _, baseURL, err := v.apiClient(context.Background())
+			if err != nil {
+				t.Fatalf("apiClient() failed: %v", err)
+			}
+			if want := ts.URL + strings.TrimSuffix(tt.ingressPath, "/"); baseURL != want {
+				t.Errorf("apiClient() URL = %q, want %q", baseURL, want)
+			}
+			if _, err := client.Ping(context.Background()); err != nil {
+				t.Fatalf("Ping() failed: %v", err)
+			}
+			if len(paths) != 1 || paths[0] != tt.wantPath {
+				t.Errorf("API got requests for %v, want %s", paths, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestCheckHostsResolve(t *testing.T) {
+	records := map[string][]string{
+		"awx.example.com":          {"198.51.100.7"},
+		"awx.internal.example.com": {"10.0.0.9", "198.51.100.7"},
+		"lb.example.com":           {"198.51.100.7"},
+		"old.example.com":          {"203.0.113.5"},
+	}
+	lookup := func(ctx context.Context, host string) ([]string, error) {
+		addresses, ok := records[host]
+		if !ok {
+			return nil, fmt.Errorf("lookup %s: no such host", host)
+		}
+		return addresses, nil
+	}
+
+	tests := []struct {
+		name    string
+		hosts   []string
+		address string
+		wantErr string
+	}{
+		{
+			name:    "hosts resolve to the ingress IP",
+			hosts:   []string{"awx.example.com", "awx.internal.example.com"},
+			address: "198.51.100.7",
+		},
+		{
+			name:    "hosts resolve to the ingress host name",
+			hosts:   []string{"awx.example.com", "awx.internal.example.com"},
+			address: "lb.example.com",
+		},
+		{
+			name:    "alias points elsewhere",
+			hosts:   []string{"awx.example.com", "old.example.com"},
+			address: "198.51.100.7",
+			wantErr: "AWX hosts do not all point at the ingress: old.example.com resolves to 203.0.113.5, not to the ingress address 198.51.100.7",
+		},
+		{
+			name:    "alias does not resolve",
+			hosts:   []string{"awx.example.com", "new.example.com"},
+			address: "198.51.100.7",
+			wantErr: "new.example.com does not resolve: lookup new.example.com: no such host",
+		},
+		{
+			name:    "ingress host name does not resolve",
+			hosts:   []string{"awx.example.com"},
+			address: "pending.example.com",
+			wantErr: "failed to resolve ingress address pending.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHostsResolve(context.Background(), lookup, tt.hosts, tt.address)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("checkHostsResolve() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkHostsResolve() failed: %v", err)
+			}
+		})
+	}
+}
@@ -4,10 +4,16 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
 	"awx-deployer/internal/config"
+	"awx-deployer/internal/events"
 	"awx-deployer/internal/k8s"
 )
 
@@ -15,6 +21,16 @@ import (
 type DeploymentWaiter struct {
 	k8sClient *k8s.KubernetesClient
 	config    *config.Config
+	reconcile *ReconcileChecker
+
+	// after is time.After, replaceable to test the initial delay
+	after func(time.Duration) <-chan time.Time
+	// now is time.Now, replaceable to test the timing
+	now func() time.Time
+	// ingressInterval is how often the ingress address is checked
+	ingressInterval time.Duration
+
+	timing ReadyTiming
 }
 
 // NewDeploymentWaiter creates a new deployment waiter
@@ -22,9 +38,25 @@ func NewDeploymentWaiter(k8sClient *k8s.KubernetesClient, config *config.Config)
 	return &DeploymentWaiter{
 		k8sClient: k8sClient,
 		config:    config,
+		reconcile: NewReconcileChecker(k8sClient, config),
+		after:     time.After,
+		now:       time.Now,
+
+		ingressInterval: 10 * time.Second,
 	}
 }
 
+// SetAppliedAt sets when the AWX CR was applied, from which the timing of
+// the components is measured instead of from the start of the wait
+func (d *DeploymentWaiter) SetAppliedAt(appliedAt time.Time) {
+	d.timing.AppliedAt = appliedAt
+}
+
+// Timing returns when the components were seen ready by the last wait
+func (d *DeploymentWaiter) Timing() ReadyTiming {
+	return d.timing
+}
+
 // WaitForReady waits for the AWX deployment to be fully ready
 func (d *DeploymentWaiter) WaitForReady(ctx context.Context, timeout time.Duration) error {
 	log.Printf("Waiting for AWX deployment to be ready (timeout: %v)...", timeout)
@@ -32,99 +64,231 @@ func (d *DeploymentWaiter) WaitForReady(ctx context.Context, timeout time.Durati
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	if d.timing.AppliedAt.IsZero() {
+		d.timing.AppliedAt = d.now()
+	}
+	d.reconcile.since = d.timing.AppliedAt
+	d.timing.Components = nil
+
+	// Point at likely causes while the wait drags on
+	go d.giveHints(ctxWithTimeout, timeout)
+
+	if err := d.settle(ctxWithTimeout); err != nil {
+		return err
+	}
+
 	// Wait for AWX instance to exist and be processed
 	if err := d.waitForAWXInstance(ctxWithTimeout); err != nil {
 		return fmt.Errorf("AWX instance not ready: %v", err)
 	}
+	d.observe("AWX instance", d.awxReadySince(ctxWithTimeout))
 
 	// Wait for PostgreSQL to be ready
 	if err := d.waitForPostgreSQL(ctxWithTimeout); err != nil {
 		return fmt.Errorf("PostgreSQL not ready: %v", err)
 	}
+	d.observe("PostgreSQL", d.postgresReadySince(ctxWithTimeout))
 
 	// Wait for AWX web deployment to be ready
 	if err := d.waitForAWXWeb(ctxWithTimeout); err != nil {
 		return fmt.Errorf("AWX web not ready: %v", err)
 	}
+	d.observe("AWX web", d.roleReadySince(ctxWithTimeout, roleWeb))
 
 	// Wait for AWX task manager to be ready
 	if err := d.waitForAWXTask(ctxWithTimeout); err != nil {
 		return fmt.Errorf("AWX task manager not ready: %v", err)
 	}
+	d.observe("AWX task", d.roleReadySince(ctxWithTimeout, roleTask))
+
+	// Wait for Redis to be ready when the install includes it
+	if redisExpected(d.config) {
+		if err := d.waitForRedis(ctxWithTimeout); err != nil {
+			return fmt.Errorf("Redis not ready: %v", err)
+		}
+		d.observe("Redis", d.redisReadySince(ctxWithTimeout))
+	}
+
+	// Wait for site-specific workloads from extra manifests
+	for _, name := range d.config.ExtraWaitDeployments {
+		if err := d.waitForExtraDeployment(ctxWithTimeout, name); err != nil {
+			return fmt.Errorf("deployment %s not ready: %v", name, err)
+		}
+		d.observe("deployment "+name, d.extraDeploymentReadySince(ctxWithTimeout, name))
+	}
+	for _, selector := range d.config.ExtraWaitSelectors {
+		if err := d.waitForExtraSelector(ctxWithTimeout, selector); err != nil {
+			return fmt.Errorf("pods matching %s not ready: %v", selector, err)
+		}
+		d.observe("pods "+selector, d.selectorReadySince(ctxWithTimeout, selector))
+	}
+	for _, condition := range d.config.WaitConditions() {
+		if err := d.waitForExtraCondition(ctxWithTimeout, condition); err != nil {
+			return fmt.Errorf("wait condition %s not met: %v", condition, err)
+		}
+		// a watched field has no transition time, it held when seen
+		d.observe(condition.String(), time.Time{})
+	}
+
+	// Optionally wait for the ingress to be given an address
+	if d.config.WaitIngress {
+		if err := d.waitForIngress(ctx); err != nil {
+			return fmt.Errorf("AWX ingress not ready: %v", err)
+		}
+		// nor does the ingress address
+		d.observe("ingress", time.Time{})
+	}
+
+	// The ingress only serves HTTPS once cert-manager issued its certificate
+	if certificateExpected(d.config) {
+		if err := d.waitForCertificate(ctx); err != nil {
+			return fmt.Errorf("AWX TLS certificate not ready: %v", err)
+		}
+		d.observe("TLS certificate", d.certificateReadySince(ctx))
+	}
 
 	log.Println("AWX deployment is ready!")
+	log.Printf("Time from applying the AWX CR to ready: %s", d.timing)
 	return nil
 }
 
-// waitForAWXInstance waits for the AWX custom resource to be processed
+// settle gives the operator AWX_INITIAL_WAIT_DELAY to pick up the AWX
+// instance and create its objects before the wait starts polling, so that
+// the first polls do not just report them missing
+func (d *DeploymentWaiter) settle(ctx context.Context) error {
+	delay := time.Duration(d.config.InitialWaitDelay) * time.Second
+	if delay <= 0 {
+		return nil
+	}
+
+	log.Printf("Giving the operator %v to create the AWX objects...", delay)
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("timeout waiting for the operator to create the AWX objects")
+	case <-d.after(delay):
+		return nil
+	}
+}
+
+// logNotCreated reports an object the operator has not created yet. The
+// first check of an object only emits a progress event, as the operator may
+// just not have got to it, later ones log it too.
+func logNotCreated(ctx context.Context, firstCheck bool, format string, args ...interface{}) {
+	if firstCheck {
+		events.Progressf(ctx, format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// waitForAWXInstance waits for the AWX custom resource to be processed,
+// which the operator reports with the Running condition
 func (d *DeploymentWaiter) waitForAWXInstance(ctx context.Context) error {
 	log.Println("Waiting for AWX instance to be processed...")
+	events.Progressf(ctx, "waiting for AWX instance to be processed")
 
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	gvr := d.k8sClient.AWXGroupVersionResource(ctx)
+	description := "condition " + strings.Join(d.config.SuccessConditions, " or ")
 
-	for {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("timeout waiting for AWX instance")
-		case <-ticker.C:
-			exists, err := d.k8sClient.ResourceExists(ctx, "awx.ansible.com", "v1beta1", "awxs", d.config.AWXName, d.config.Namespace)
-			if err != nil {
-				log.Printf("Warning: Could not check AWX instance: %v", err)
-				continue
-			}
+	// A failure condition ends the wait right away
+	var failure error
+	processed := func(awx *unstructured.Unstructured) (bool, error) {
+		if failure = d.reconcile.conditionFailure(awx); failure != nil {
+			return false, failure
+		}
+		return d.reconcile.conditions.succeeded(awx), nil
+	}
 
-			if exists {
-				log.Println("AWX instance exists and is being processed")
-				return nil
-			}
+	// Give the operator a grace period to pick up the instance before
+	// checking why it has not
+	if grace := time.Duration(d.config.ReconcileGracePeriod) * time.Minute; grace > 0 {
+		_, err := d.k8sClient.WaitFor(ctx, gvr, d.config.AWXName, d.config.Namespace, description, processed, grace)
+		if err == nil {
+			log.Println("AWX instance exists and is being processed")
+			return nil
+		}
+		if failure != nil {
+			return failure
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("timeout waiting for AWX instance: %v", err)
+		}
+		if err := d.reconcile.CheckPickedUp(ctx); err != nil {
+			return err
+		}
+		log.Printf("Warning: AWX instance %s is not running after %v, waiting...", d.config.AWXName, grace)
+	}
 
-			log.Println("Waiting for AWX instance to be created...")
+	if _, err := d.k8sClient.WaitFor(ctx, gvr, d.config.AWXName, d.config.Namespace, description, processed, 0); err != nil {
+		if failure != nil {
+			return failure
 		}
+		return fmt.Errorf("timeout waiting for AWX instance: %v", err)
 	}
+
+	log.Println("AWX instance exists and is being processed")
+	return nil
 }
 
 // waitForPostgreSQL waits for PostgreSQL to be ready
 func (d *DeploymentWaiter) waitForPostgreSQL(ctx context.Context) error {
 	log.Println("Waiting for PostgreSQL to be ready...")
-
-	// Expected PostgreSQL deployment name based on AWX instance name
-	postgresDeployment := fmt.Sprintf("%s-postgres-15", d.config.AWXName)
+	events.Progressf(ctx, "waiting for PostgreSQL")
 
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	for {
+	strategyChecked := !d.config.PostgresRecreate
+	for checks := 0; ; checks++ {
 		select {
 		case <-ctx.Done():
 			return fmt.Errorf("timeout waiting for PostgreSQL")
 		case <-ticker.C:
-			log.Printf("Checking for deployment %s...", postgresDeployment)
-			exists, err := d.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", postgresDeployment, d.config.Namespace)
+			// Fail fast if the operator keeps failing to reconcile
+			if err := d.reconcile.Check(ctx); err != nil {
+				return err
+			}
+
+			kind, workload, err := postgresWorkload(ctx, d.k8sClient, d.config)
 			if err != nil {
-				log.Printf("Warning: Could not check for PostgreSQL deployment: %v", err)
+				log.Printf("Warning: Could not check for PostgreSQL workload: %v", err)
 				continue
 			}
 
-			if !exists {
-				log.Printf("Waiting for PostgreSQL deployment %s to be created...", postgresDeployment)
+			if kind == "" {
+				logNotCreated(ctx, checks == 0, "Waiting for PostgreSQL deployment or stateful set to be created...")
 				continue
 			}
 
-			// Check PostgreSQL pod status
-			labelSelector := fmt.Sprintf("app.kubernetes.io/name=postgres,app.kubernetes.io/instance=%s", d.config.AWXName)
-			status, err := d.k8sClient.GetPodStatus(ctx, labelSelector, d.config.Namespace)
+			// A RollingUpdate rollout of a deployment would hang on the
+			// ReadWriteOnce volume, a stateful set replaces its pod in place
+			if !strategyChecked && kind == postgresDeployment {
+				if err := d.ensurePostgresRecreate(ctx, workload.GetName()); err != nil {
+					log.Printf("Warning: Could not switch PostgreSQL to the Recreate strategy: %v", err)
+				} else {
+					strategyChecked = true
+				}
+			}
+
+			ready, status, err := postgresStatus(ctx, d.k8sClient, d.config, kind, workload)
 			if err != nil {
-				log.Printf("Warning: Could not get PostgreSQL pod status: %v", err)
+				log.Printf("Warning: Could not get PostgreSQL status: %v", err)
 				continue
 			}
 
-			if strings.Contains(status, "Running") {
-				log.Println("PostgreSQL is running")
+			if ready {
+				log.Println("PostgreSQL is ready")
 				return nil
 			}
 
-			log.Printf("PostgreSQL pod status: %s, waiting...", status)
+			// Fail fast if a pod waits for a Secret or ConfigMap that does not exist
+			if selector, err := podSelector(workload); err == nil {
+				if err := d.checkPodStartup(ctx, selector); err != nil {
+					return err
+				}
+			}
+
+			log.Printf("PostgreSQL %s, waiting...", status)
 		}
 	}
 }
@@ -132,54 +296,89 @@ func (d *DeploymentWaiter) waitForPostgreSQL(ctx context.Context) error {
 // waitForAWXWeb waits for AWX web deployment to be ready
 func (d *DeploymentWaiter) waitForAWXWeb(ctx context.Context) error {
 	log.Println("Waiting for AWX web to be ready...")
+	events.Progressf(ctx, "waiting for AWX web")
+	return d.waitForComponent(ctx, roleWeb)
+}
 
-	// Expected AWX web deployment name
-	webDeployment := fmt.Sprintf("%s-web", d.config.AWXName)
+// waitForAWXTask waits for the AWX task manager to be ready
+func (d *DeploymentWaiter) waitForAWXTask(ctx context.Context) error {
+	log.Println("Waiting for AWX task manager to be ready...")
+	events.Progressf(ctx, "waiting for AWX task manager")
+	return d.waitForComponent(ctx, roleTask)
+}
 
+// waitForComponent waits for the deployment of an AWX component to exist
+// and its pods to be ready. The deployment is looked up by the operator's
+// labels and its pods by its selector and owner references, whatever their
+// names.
+func (d *DeploymentWaiter) waitForComponent(ctx context.Context, role instanceRole) error {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	for {
+	for checks := 0; ; checks++ {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("timeout waiting for AWX web")
+			return fmt.Errorf("timeout waiting for %s", role.description)
 		case <-ticker.C:
-			// Check if web deployment exists
-			exists, err := d.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", webDeployment, d.config.Namespace)
+			// Fail fast if the operator keeps failing to reconcile
+			if err := d.reconcile.Check(ctx); err != nil {
+				return err
+			}
+
+			deployment, err := findInstanceObject(ctx, d.k8sClient, d.config, deploymentsGVR, role)
 			if err != nil {
-				log.Printf("Warning: Could not check AWX web deployment: %v", err)
+				log.Printf("Warning: Could not check %s deployment: %v", role.description, err)
 				continue
 			}
 
-			if !exists {
-				log.Printf("Waiting for AWX web deployment %s to be created...", webDeployment)
+			if deployment == nil {
+				logNotCreated(ctx, checks == 0, "Waiting for %s deployment to be created...", role.description)
 				continue
 			}
 
-			// Check web pod status
-			labelSelector := fmt.Sprintf("app.kubernetes.io/name=%s,app.kubernetes.io/component=web", d.config.AWXName)
-			status, err := d.k8sClient.GetPodStatus(ctx, labelSelector, d.config.Namespace)
+			labelSelector, err := podSelector(deployment)
+			if err != nil {
+				log.Printf("Warning: %v", err)
+				continue
+			}
+			status, err := workloadPodStatus(ctx, d.k8sClient, d.config, deployment)
 			if err != nil {
-				log.Printf("Warning: Could not get AWX web pod status: %v", err)
+				log.Printf("Warning: Could not get %s pod status: %v", role.description, err)
 				continue
 			}
 
-			if strings.Contains(status, "Running") {
-				log.Println("AWX web is running")
+			if status.Ready() {
+				log.Printf("%s is ready", role.description)
 				return nil
 			}
 
-			log.Printf("AWX web pod status: %s, waiting...", status)
+			// Fail fast if a pod waits for a Secret or ConfigMap that does not exist
+			if err := d.checkPodStartup(ctx, labelSelector); err != nil {
+				return err
+			}
+
+			d.logRollout(ctx, role.description, deployment.GetName(), status)
 		}
 	}
 }
 
-// waitForAWXTask waits for the AWX task manager to be ready
-func (d *DeploymentWaiter) waitForAWXTask(ctx context.Context) error {
-	log.Println("Waiting for AWX task manager to be ready...")
+// logRollout logs the rollout status of a deployment that is not ready yet
+// next to the status of its pods
+func (d *DeploymentWaiter) logRollout(ctx context.Context, component, deployment string, pods k8s.PodStatus) {
+	rollout, _, err := d.k8sClient.RolloutStatus(ctx, deployment, d.config.Namespace)
+	if err != nil {
+		log.Printf("Warning: %s: %v", component, err)
+		log.Printf("%s pod status: %s, waiting...", component, pods)
+		return
+	}
+	log.Printf("%s: %s (pods: %s)", component, rollout, pods)
+	events.Progressf(ctx, "%s: %s", component, rollout)
+}
 
-	// Expected AWX task deployment name
-	taskDeployment := fmt.Sprintf("%s-task", d.config.AWXName)
+// waitForRedis waits for the Redis deployment or sidecar to be ready
+func (d *DeploymentWaiter) waitForRedis(ctx context.Context) error {
+	log.Println("Waiting for Redis to be ready...")
+	events.Progressf(ctx, "waiting for Redis")
 
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -187,34 +386,265 @@ func (d *DeploymentWaiter) waitForAWXTask(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("timeout waiting for AWX task manager")
+			return fmt.Errorf("timeout waiting for Redis")
 		case <-ticker.C:
-			// Check if task deployment exists
-			exists, err := d.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", taskDeployment, d.config.Namespace)
+			running, status, err := redisStatus(ctx, d.k8sClient, d.config)
 			if err != nil {
-				log.Printf("Warning: Could not check AWX task deployment: %v", err)
+				log.Printf("Warning: Could not get Redis status: %v", err)
 				continue
 			}
 
-			if !exists {
-				log.Printf("Waiting for AWX task deployment %s to be created...", taskDeployment)
+			if running {
+				log.Println("Redis is running")
+				return nil
+			}
+
+			log.Printf("Redis %s, waiting...", status)
+		}
+	}
+}
+
+// waitForExtraDeployment waits for a deployment the AWX install does not
+// know about to exist and for the pods its selector matches to be ready
+func (d *DeploymentWaiter) waitForExtraDeployment(ctx context.Context, name string) error {
+	log.Printf("Waiting for deployment %s to be ready...", name)
+	events.Progressf(ctx, "waiting for deployment %s", name)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		// the core components are ready by now, so check right away
+		ready, err := d.extraDeploymentReady(ctx, name)
+		if err != nil {
+			return err
+		}
+		if ready {
+			log.Printf("Deployment %s is ready", name)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for deployment %s", name)
+		case <-ticker.C:
+		}
+	}
+}
+
+// extraDeploymentReady reports whether a deployment exists and all of its
+// pods are ready. Only an invalid selector and pods that cannot start are
+// returned as errors, other failures are retried.
+func (d *DeploymentWaiter) extraDeploymentReady(ctx context.Context, name string) (bool, error) {
+	exists, err := d.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", name, d.config.Namespace)
+	if err != nil {
+		log.Printf("Warning: Could not check deployment %s: %v", name, err)
+		return false, nil
+	}
+	if !exists {
+		log.Printf("Waiting for deployment %s to be created...", name)
+		return false, nil
+	}
+
+	deployment, err := d.k8sClient.GetDeployment(ctx, name, d.config.Namespace)
+	if err != nil {
+		log.Printf("Warning: Could not get deployment %s: %v", name, err)
+		return false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid selector: %v", err)
+	}
+
+	status, err := d.k8sClient.GetPodStatus(ctx, selector.String(), d.config.Namespace)
+	if err != nil {
+		log.Printf("Warning: Could not get pod status of deployment %s: %v", name, err)
+		return false, nil
+	}
+	if status.Ready() {
+		return true, nil
+	}
+	if err := d.checkPodStartup(ctx, selector.String()); err != nil {
+		return false, err
+	}
+	log.Printf("Deployment %s pod status: %s, waiting...", name, status)
+	return false, nil
+}
+
+// waitForExtraSelector waits for the pods matching a label selector to be ready
+func (d *DeploymentWaiter) waitForExtraSelector(ctx context.Context, selector string) error {
+	log.Printf("Waiting for pods matching %s to be ready...", selector)
+	events.Progressf(ctx, "waiting for pods matching %s", selector)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		status, err := d.k8sClient.GetPodStatus(ctx, selector, d.config.Namespace)
+		if err != nil {
+			log.Printf("Warning: Could not get status of pods matching %s: %v", selector, err)
+		} else if status.Ready() {
+			log.Printf("Pods matching %s are ready", selector)
+			return nil
+		} else if err := d.checkPodStartup(ctx, selector); err != nil {
+			return err
+		} else {
+			log.Printf("Pods matching %s: %s, waiting...", selector, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for pods matching %s", selector)
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitForExtraCondition watches an object in the AWX namespace until the
+// field of an AWX_EXTRA_WAIT_CONDITIONS entry holds
+func (d *DeploymentWaiter) waitForExtraCondition(ctx context.Context, condition config.WaitCondition) error {
+	log.Printf("Waiting for %s...", condition)
+	events.Progressf(ctx, "waiting for %s", condition)
+
+	gvr := schema.GroupVersionResource{Group: condition.Group, Version: condition.Version, Resource: condition.Resource}
+	met := func(obj *unstructured.Unstructured) (bool, error) {
+		return waitConditionMet(obj, condition)
+	}
+	description := condition.FieldPath() + condition.Op + condition.Value
+	if _, err := d.k8sClient.WaitFor(ctx, gvr, condition.Name, d.config.Namespace, description, met, 0); err != nil {
+		return err
+	}
+
+	log.Printf("Condition %s is met", condition)
+	return nil
+}
+
+// waitConditionMet reports whether the field of a wait condition holds for
+// an object. A missing field is not met yet. Numbers are compared as
+// numbers, other values as text.
+func waitConditionMet(obj *unstructured.Unstructured, condition config.WaitCondition) (bool, error) {
+	value, found := fieldValue(obj.Object, condition.Path)
+	if !found {
+		return false, nil
+	}
+	if condition.Op == "" {
+		return true, nil
+	}
+
+	actual := fmt.Sprint(value)
+	switch condition.Op {
+	case "=":
+		return valuesEqual(actual, condition.Value), nil
+	case "!=":
+		return !valuesEqual(actual, condition.Value), nil
+	}
+
+	got, err := strconv.ParseFloat(actual, 64)
+	if err != nil {
+		return false, fmt.Errorf("field %s is %q, which is not a number", condition.FieldPath(), actual)
+	}
+	want, _ := strconv.ParseFloat(condition.Value, 64)
+	switch condition.Op {
+	case ">":
+		return got > want, nil
+	case ">=":
+		return got >= want, nil
+	case "<":
+		return got < want, nil
+	default:
+		return got <= want, nil
+	}
+}
+
+// valuesEqual compares a field value with an expected one, as numbers if
+// both are numbers so that 2 equals 2.0
+func valuesEqual(actual, expected string) bool {
+	a, errA := strconv.ParseFloat(actual, 64)
+	b, errB := strconv.ParseFloat(expected, 64)
+	if errA == nil && errB == nil {
+		return a == b
+	}
+	return actual == expected
+}
+
+// fieldValue follows a field path through maps and lists
+func fieldValue(value interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, value != nil
+}
+
+// waitForIngress waits for the AWX ingress to be assigned an external address
+func (d *DeploymentWaiter) waitForIngress(ctx context.Context) error {
+	exposure, err := getExposure(ctx, d.k8sClient, d.config)
+	if err != nil {
+		return fmt.Errorf("failed to determine AWX exposure: %v", err)
+	}
+
+	if !exposure.HasIngress() {
+		log.Printf("AWX is exposed via %s service without an ingress, no address to wait for", exposure.ServiceType)
+		return nil
+	}
+
+	timeout := time.Duration(d.config.IngressTimeout) * time.Minute
+	log.Printf("Waiting for AWX ingress address (timeout: %v)...", timeout)
+	events.Progressf(ctx, "waiting for AWX ingress address")
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ingressName := ""
+
+	ticker := time.NewTicker(d.ingressInterval)
+	defer ticker.Stop()
+
+	for checks := 0; ; checks++ {
+		select {
+		case <-ctxWithTimeout.Done():
+			if ingressName == "" {
+				return fmt.Errorf("timeout waiting for the ingress of AWX instance %s to be created", d.config.AWXName)
+			}
+			return fmt.Errorf("timeout waiting for ingress %s to get an address", ingressName)
+		case <-ticker.C:
+			ingress, err := findInstanceObject(ctxWithTimeout, d.k8sClient, d.config, ingressesGVR, roleIngress)
+			if err != nil {
+				log.Printf("Warning: Could not check for the AWX ingress: %v", err)
+				continue
+			}
+			if ingress == nil {
+				logNotCreated(ctx, checks == 0, "Waiting for the ingress of AWX instance %s to be created...", d.config.AWXName)
 				continue
 			}
+			ingressName = ingress.GetName()
 
-			// Check task pod status
-			labelSelector := fmt.Sprintf("app.kubernetes.io/name=%s,app.kubernetes.io/component=task", d.config.AWXName)
-			status, err := d.k8sClient.GetPodStatus(ctx, labelSelector, d.config.Namespace)
+			status, err := d.k8sClient.GetIngressStatus(ctxWithTimeout, ingressName, d.config.Namespace)
 			if err != nil {
-				log.Printf("Warning: Could not get AWX task pod status: %v", err)
+				log.Printf("Warning: Could not get ingress status: %v", err)
 				continue
 			}
 
-			if strings.Contains(status, "Running") {
-				log.Println("AWX task manager is running")
+			if status != "Pending" && status != "" {
+				log.Printf("AWX ingress %s is reachable at %s", ingressName, status)
 				return nil
 			}
 
-			log.Printf("AWX task pod status: %s, waiting...", status)
+			log.Printf("Ingress %s has no address yet, waiting...", ingressName)
 		}
 	}
 }
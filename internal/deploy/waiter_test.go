@@ -0,0 +1,451 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+
+	"awx-deployer/internal/events"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// exposedAWX returns an AWX CR exposed through the given ingress type
+func exposedAWX(ingressType string) *unstructured.Unstructured {
+	awx := k8stest.AWX("awx", "awx-instance")
+	unstructured.SetNestedField(awx.Object, "ClusterIP", "spec", "service_type")
+	unstructured.SetNestedField(awx.Object, ingressType, "spec", "ingress_type")
+	unstructured.SetNestedField(awx.Object, "awx.example.com", "spec", "hostname")
+	return awx
+}
+
+func TestWaitForIngress(t *testing.T) {
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "awx-instance-ingress", Namespace: "awx"}}
+
+	tests := []struct {
+		name string
+		// objects are in the cluster
+		objects []runtime.Object
+		// pendingChecks is how many status reads find no address
+		pendingChecks int
+		timeout       time.Duration
+		wantErr       string
+	}{
+		{
+			name:          "pending then addressed",
+			objects:       []runtime.Object{exposedAWX("ingress"), ingress},
+			pendingChecks: 2,
+			timeout:       5 * time.Second,
+		},
+		{
+			name:          "already addressed",
+			objects:       []runtime.Object{exposedAWX("ingress"), ingress},
+			pendingChecks: 0,
+			timeout:       5 * time.Second,
+		},
+		{
+			name:          "never addressed",
+			objects:       []runtime.Object{exposedAWX("ingress"), ingress},
+			pendingChecks: 1000,
+			timeout:       200 * time.Millisecond,
+			wantErr:       "timeout waiting for ingress awx-instance-ingress to get an address",
+		},
+		{
+			name:    "ingress never created",
+			objects: []runtime.Object{exposedAWX("ingress")},
+			timeout: 200 * time.Millisecond,
+			wantErr: "timeout waiting for the ingress of AWX instance awx-instance to be created",
+		},
+		{
+			name:    "no ingress expected",
+			objects: []runtime.Object{exposedAWX("none")},
+			timeout: 200 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			checks := 0
+			cluster.Clientset.PrependReactor("get", "ingresses", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				checks++
+				status := ingress.DeepCopy()
+				if checks > tt.pendingChecks {
+					status.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "203.0.113.10"}}
+				}
+				return true, status, nil
+			})
+
+			waiter := NewDeploymentWaiter(cluster.Client, testConfig(t, nil))
+			waiter.ingressInterval = 10 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			err := waiter.waitForIngress(ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("waitForIngress() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("waitForIngress() failed: %v", err)
+			}
+			if tt.pendingChecks > 0 && checks != tt.pendingChecks+1 {
+				t.Errorf("ingress status read %d times, want %d", checks, tt.pendingChecks+1)
+			}
+		})
+	}
+}
+
+// extraDeployment returns a site-specific deployment selecting its pods by
+// app label
+func extraDeployment(name string) *appsv1.Deployment {
+	labels := map[string]string{"app": name}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "awx", UID: types.UID(name + "-uid"), Labels: labels},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}
+}
+
+// stuckPod returns a pod of a workload that has been failing to create its
+// container for longer than podStartupGrace
+func stuckPod(workload metav1.Object, name, message string) *corev1.Pod {
+	pod := workloadPod(workload, name, corev1.ContainerStatus{
+		Name:  "main",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CreateContainerConfigError", Message: message}},
+	})
+	pod.Status.Phase = corev1.PodPending
+	pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	return pod
+}
+
+func TestWaitForExtraDeployment(t *testing.T) {
+	ldapSync := extraDeployment("ldap-sync")
+	notReady := corev1.ContainerStatus{Name: "main", Ready: false}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		wantErr string
+	}{
+		{
+			name:    "ready",
+			objects: []runtime.Object{ldapSync, workloadPod(ldapSync, "ldap-sync-1", corev1.ContainerStatus{Name: "main", Ready: true})},
+		},
+		{
+			name:    "pods not ready",
+			objects: []runtime.Object{ldapSync, workloadPod(ldapSync, "ldap-sync-1", notReady)},
+			wantErr: "timeout waiting for deployment ldap-sync",
+		},
+		{
+			name:    "one of two pods not ready",
+			objects: []runtime.Object{ldapSync, workloadPod(ldapSync, "ldap-sync-1"), workloadPod(ldapSync, "ldap-sync-2", notReady)},
+			wantErr: "timeout waiting for deployment ldap-sync",
+		},
+		{
+			name:    "not created",
+			wantErr: "timeout waiting for deployment ldap-sync",
+		},
+		{
+			name:    "pod cannot start",
+			objects: []runtime.Object{ldapSync, stuckPod(ldapSync, "ldap-sync-1", `secret "ldap-bind" not found`)},
+			wantErr: "pod ldap-sync-1 cannot start: secret ldap-bind not found",
+		},
+		{
+			name: "other deployment ready",
+			objects: []runtime.Object{
+				ldapSync, workloadPod(ldapSync, "ldap-sync-1", notReady),
+				extraDeployment("exporter"), workloadPod(extraDeployment("exporter"), "exporter-1"),
+			},
+			wantErr: "timeout waiting for deployment ldap-sync",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			cfg := testConfig(t, map[string]string{"AWX_EXTRA_WAIT_DEPLOYMENTS": "ldap-sync"})
+			waiter := NewDeploymentWaiter(cluster.Client, cfg)
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			err := waiter.waitForExtraDeployment(ctx, cfg.ExtraWaitDeployments[0])
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("waitForExtraDeployment() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("waitForExtraDeployment() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestWaitForExtraSelector(t *testing.T) {
+	ldapSync := extraDeployment("ldap-sync")
+
+	tests := []struct {
+		name     string
+		selector string
+		objects  []runtime.Object
+		wantErr  string
+	}{
+		{
+			name:     "ready",
+			selector: "app=ldap-sync",
+			objects:  []runtime.Object{workloadPod(ldapSync, "ldap-sync-1")},
+		},
+		{
+			name:     "not ready",
+			selector: "app=ldap-sync",
+			objects:  []runtime.Object{workloadPod(ldapSync, "ldap-sync-1", corev1.ContainerStatus{Name: "main"})},
+			wantErr:  "timeout waiting for pods matching app=ldap-sync",
+		},
+		{
+			name:     "no pods",
+			selector: "app=exporter",
+			objects:  []runtime.Object{workloadPod(ldapSync, "ldap-sync-1")},
+			wantErr:  "timeout waiting for pods matching app=exporter",
+		},
+		{
+			name:     "pod cannot start",
+			selector: "app=ldap-sync",
+			objects:  []runtime.Object{stuckPod(ldapSync, "ldap-sync-1", `configmap "ldap-config" not found`)},
+			wantErr:  "pod ldap-sync-1 cannot start: configmap ldap-config not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			waiter := NewDeploymentWaiter(cluster.Client, testConfig(t, nil))
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			err := waiter.waitForExtraSelector(ctx, tt.selector)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("waitForExtraSelector() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("waitForExtraSelector() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestWaitForExtraCondition(t *testing.T) {
+	siteConfig := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "site-config", Namespace: "awx"},
+		Data:       map[string]string{"settings.py": "DEBUG = False\n", "ready": "false", "mode": "ldap"},
+	}
+	ldapSync := extraDeployment("ldap-sync")
+	ldapSync.Status.ReadyReplicas = 1
+
+	tests := []struct {
+		name      string
+		condition string
+		objects   []runtime.Object
+		// update changes the site config during the wait, if set
+		update  map[string]string
+		wantErr string
+	}{
+		{
+			name:      "key exists",
+			condition: "v1/configmaps/site-config:.data[settings.py]",
+			objects:   []runtime.Object{siteConfig},
+		},
+		{
+			name:      "value equals",
+			condition: "v1/configmaps/site-config:.data.mode=ldap",
+			objects:   []runtime.Object{siteConfig},
+		},
+		{
+			name:      "value differs",
+			condition: "v1/configmaps/site-config:.data.mode!=local",
+			objects:   []runtime.Object{siteConfig},
+		},
+		{
+			name:      "ready replicas reached",
+			condition: "apps/v1/deployments/ldap-sync:.status.readyReplicas>=1",
+			objects:   []runtime.Object{ldapSync},
+		},
+		{
+			name:      "met during the wait",
+			condition: "v1/configmaps/site-config:.data.ready=true",
+			objects:   []runtime.Object{siteConfig},
+			update:    map[string]string{"ready": "true"},
+		},
+		{
+			name:      "ready replicas not reached",
+			condition: "apps/v1/deployments/ldap-sync:.status.readyReplicas>=2",
+			objects:   []runtime.Object{ldapSync},
+			wantErr:   "timeout waiting for deployments ldap-sync to have .status.readyReplicas>=2",
+		},
+		{
+			name:      "key missing",
+			condition: "v1/configmaps/site-config:.data.token",
+			objects:   []runtime.Object{siteConfig},
+			wantErr:   "timeout waiting for configmaps site-config to have .data.token",
+		},
+		{
+			name:      "object missing",
+			condition: "v1/configmaps/other:.data.ready=true",
+			objects:   []runtime.Object{siteConfig},
+			wantErr:   "timeout waiting for configmaps other",
+		},
+		{
+			name:      "field not a number",
+			condition: "v1/configmaps/site-config:.data.mode>1",
+			objects:   []runtime.Object{siteConfig},
+			wantErr:   `field .data.mode is "ldap", which is not a number`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			cfg := testConfig(t, map[string]string{"AWX_EXTRA_WAIT_CONDITIONS": tt.condition})
+			waiter := NewDeploymentWaiter(cluster.Client, cfg)
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			if tt.update != nil {
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					data := map[string]string{}
+					for key, value := range siteConfig.Data {
+						data[key] = value
+					}
+					for key, value := range tt.update {
+						data[key] = value
+					}
+					updated := k8stest.Object("v1", "ConfigMap", "awx", "site-config")
+					unstructured.SetNestedStringMap(updated.Object, data, "data")
+					configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+					if err := cluster.Dynamic.Tracker().Update(configMaps, updated, "awx"); err != nil {
+						t.Errorf("failed to update the site config: %v", err)
+					}
+				}()
+			}
+
+			conditions := cfg.WaitConditions()
+			if len(conditions) != 1 {
+				t.Fatalf("WaitConditions() = %v, want one condition", conditions)
+			}
+			err := waiter.waitForExtraCondition(ctx, conditions[0])
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("waitForExtraCondition() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("waitForExtraCondition() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestSettle(t *testing.T) {
+	tests := []struct {
+		name  string
+		delay string
+		// cancel ends the wait before the delay is over
+		cancel bool
+		// wantDelay is the delay waited for, 0 for none
+		wantDelay time.Duration
+		wantErr   string
+	}{
+		{name: "default delay", wantDelay: 10 * time.Second},
+		{name: "configured delay", delay: "3", wantDelay: 3 * time.Second},
+		{name: "no delay", delay: "0"},
+		{
+			name:      "timeout during the delay",
+			delay:     "30",
+			cancel:    true,
+			wantDelay: 30 * time.Second,
+			wantErr:   "timeout waiting for the operator to create the AWX objects",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			if tt.delay != "" {
+				env["AWX_INITIAL_WAIT_DELAY"] = tt.delay
+			}
+			waiter := NewDeploymentWaiter(nil, testConfig(t, env))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// the fake clock fires at once unless the wait is to time out
+			var waited time.Duration
+			waiter.after = func(delay time.Duration) <-chan time.Time {
+				waited = delay
+				fired := make(chan time.Time, 1)
+				if tt.cancel {
+					cancel()
+				} else {
+					fired <- time.Now().Add(delay)
+				}
+				return fired
+			}
+
+			err := waiter.settle(ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("settle() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("settle() failed: %v", err)
+			}
+			if waited != tt.wantDelay {
+				t.Errorf("settle() waited %v, want %v", waited, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestLogNotCreated(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	emitter := events.NewEmitter(2)
+	ctx := events.WithStep(context.Background(), emitter, "wait")
+	for checks := 0; checks < 2; checks++ {
+		logNotCreated(ctx, checks == 0, "Waiting for %s deployment to be created...", "AWX web")
+	}
+	emitter.Close()
+
+	var progress []string
+	for event := range emitter.Events() {
+		progress = append(progress, event.Message)
+	}
+	want := "Waiting for AWX web deployment to be created..."
+	if len(progress) != 1 || progress[0] != want {
+		t.Errorf("progress events = %q, want only the first check's", progress)
+	}
+	if got := strings.Count(logged.String(), want); got != 1 {
+		t.Errorf("logged %d times, want only the second check:\n%s", got, logged.String())
+	}
+}
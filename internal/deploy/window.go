@@ -0,0 +1,49 @@
+package deploy
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"awx-deployer/internal/config"
+)
+
+// MaintenanceGuard refuses to change the cluster outside
+// AWX_MAINTENANCE_WINDOW, so that a change-controlled cluster is not
+// deployed to during business hours by accident
+type MaintenanceGuard struct {
+	config *config.Config
+	// now is time.Now, replaceable to test the window
+	now func() time.Time
+}
+
+// NewMaintenanceGuard creates a new maintenance window guard
+func NewMaintenanceGuard(config *config.Config) *MaintenanceGuard {
+	return &MaintenanceGuard{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// Check fails outside the maintenance window unless force is set, in which
+// case it only warns. Without a window it always passes.
+func (g *MaintenanceGuard) Check(force bool) error {
+	if g.config.MaintenanceWindow == "" {
+		return nil
+	}
+	window, err := config.ParseMaintenanceWindow(g.config.MaintenanceWindow)
+	if err != nil {
+		return err
+	}
+
+	now := g.now().In(window.Location)
+	if window.Contains(now) {
+		log.Printf("✓ Inside the maintenance window %s", window)
+		return nil
+	}
+	if force {
+		log.Printf("Warning: Outside the maintenance window %s (it is %s), going ahead because of --force", window, now.Format("Mon 15:04 MST"))
+		return nil
+	}
+	return fmt.Errorf("outside maintenance window %s (it is %s), use --force to deploy anyway", window, now.Format("Mon 15:04 MST"))
+}
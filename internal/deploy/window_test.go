@@ -0,0 +1,55 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceGuardCheck(t *testing.T) {
+	// saturday is inside the Sat-Sun window, friday outside it
+	saturday := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+	friday := time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		window  string
+		now     time.Time
+		force   bool
+		wantErr string
+	}{
+		{name: "no window", now: friday},
+		{name: "inside the window", window: "Sat-Sun 02:00-06:00", now: saturday},
+		{
+			name:    "outside the window",
+			window:  "Sat-Sun 02:00-06:00",
+			now:     friday,
+			wantErr: "outside maintenance window Sat-Sun 02:00-06:00 (it is Fri 14:30 UTC), use --force to deploy anyway",
+		},
+		{name: "outside the window with --force", window: "Sat-Sun 02:00-06:00", now: friday, force: true},
+		{
+			name:    "outside the window in its timezone",
+			window:  "Sat-Sun 02:00-06:00 Asia/Singapore",
+			now:     saturday,
+			wantErr: "(it is Sat 11:00 +08)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := NewMaintenanceGuard(testConfig(t, map[string]string{"AWX_MAINTENANCE_WINDOW": tt.window}))
+			guard.now = func() time.Time { return tt.now }
+
+			err := guard.Check(tt.force)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Check() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() failed: %v", err)
+			}
+		})
+	}
+}
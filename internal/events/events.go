@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Phase is the stage of a step an event reports
+type Phase string
+
+const (
+	// PhaseStart is emitted when a step starts
+	PhaseStart Phase = "start"
+	// PhaseProgress reports what a running step is doing
+	PhaseProgress Phase = "progress"
+	// PhaseComplete is emitted when a step succeeds
+	PhaseComplete Phase = "complete"
+	// PhaseFail is emitted when a step fails, with the error
+	PhaseFail Phase = "fail"
+)
+
+// Event is a progress update of a deployment step
+type Event struct {
+	Step      string
+	Phase     Phase
+	Message   string
+	Timestamp time.Time
+	Err       error
+}
+
+// Emitter publishes events on a buffered channel. Sends block when the
+// buffer is full, so the subscriber must keep reading until the channel is
+// closed. A nil Emitter drops all events.
+type Emitter struct {
+	ch     chan Event
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewEmitter creates an emitter with a channel of the given buffer size
+func NewEmitter(buffer int) *Emitter {
+	return &Emitter{ch: make(chan Event, buffer)}
+}
+
+// Events returns the channel events are published on
+func (e *Emitter) Events() <-chan Event {
+	return e.ch
+}
+
+// Emit publishes an event, setting its timestamp if unset. Events emitted
+// after Close are dropped.
+func (e *Emitter) Emit(event Event) {
+	if e == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.closed {
+		e.ch <- event
+	}
+}
+
+// Close closes the channel. It is safe to call more than once.
+func (e *Emitter) Close() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.closed {
+		e.closed = true
+		close(e.ch)
+	}
+}
+
+// stepKey is the context key of the running step
+type stepKey struct{}
+
+// stepContext is the emitter and name of the running step
+type stepContext struct {
+	emitter *Emitter
+	step    string
+}
+
+// WithStep returns a context that attributes progress events to step
+func WithStep(ctx context.Context, emitter *Emitter, step string) context.Context {
+	return context.WithValue(ctx, stepKey{}, stepContext{emitter: emitter, step: step})
+}
+
+// Progressf emits a progress event for the step running in ctx. Without a
+// step in ctx nothing is emitted.
+func Progressf(ctx context.Context, format string, args ...interface{}) {
+	current, ok := ctx.Value(stepKey{}).(stepContext)
+	if !ok {
+		return
+	}
+	current.emitter.Emit(Event{Step: current.step, Phase: PhaseProgress, Message: fmt.Sprintf(format, args...)})
+}
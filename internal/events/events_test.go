@@ -0,0 +1,78 @@
+package events
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEmitter(t *testing.T) {
+	stamp := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		emit func(e *Emitter)
+		want []Event
+	}{
+		{
+			name: "events in order",
+			emit: func(e *Emitter) {
+				e.Emit(Event{Step: "apply", Phase: PhaseStart, Timestamp: stamp})
+				e.Emit(Event{Step: "apply", Phase: PhaseComplete, Timestamp: stamp})
+			},
+			want: []Event{
+				{Step: "apply", Phase: PhaseStart, Timestamp: stamp},
+				{Step: "apply", Phase: PhaseComplete, Timestamp: stamp},
+			},
+		},
+		{
+			name: "progress of the running step",
+			emit: func(e *Emitter) {
+				ctx := WithStep(context.Background(), e, "wait")
+				Progressf(ctx, "waiting for %s", "Redis")
+				// without a step nothing is emitted
+				Progressf(context.Background(), "lost")
+			},
+			want: []Event{{Step: "wait", Phase: PhaseProgress, Message: "waiting for Redis"}},
+		},
+		{
+			name: "events after close are dropped",
+			emit: func(e *Emitter) {
+				e.Emit(Event{Step: "verify", Phase: PhaseStart, Timestamp: stamp})
+				e.Close()
+				e.Emit(Event{Step: "verify", Phase: PhaseComplete, Timestamp: stamp})
+			},
+			want: []Event{{Step: "verify", Phase: PhaseStart, Timestamp: stamp}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEmitter(10)
+			tt.emit(e)
+			// closing twice is fine
+			e.Close()
+
+			var got []Event
+			for event := range e.Events() {
+				if event.Timestamp.IsZero() {
+					t.Errorf("event %v has no timestamp", event)
+				}
+				if event.Timestamp != stamp {
+					event.Timestamp = time.Time{}
+				}
+				got = append(got, event)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilEmitter(t *testing.T) {
+	var e *Emitter
+	e.Emit(Event{Step: "apply", Phase: PhaseStart})
+	Progressf(WithStep(context.Background(), e, "apply"), "dropped")
+	e.Close()
+}
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"awx-deployer/internal/events"
+)
+
+// Status is the progress of the deployment reported by /status
+type Status struct {
+	Step               string    `json:"step"`  // empty before the first step starts
+	Phase              string    `json:"phase"` // start, progress, complete or fail
+	Message            string    `json:"message,omitempty"`
+	Error              string    `json:"error,omitempty"` // set when the step failed
+	StartedAt          time.Time `json:"started_at"`
+	ElapsedSeconds     int64     `json:"elapsed_seconds"`
+	StepElapsedSeconds int64     `json:"step_elapsed_seconds"`
+}
+
+// Server reports that the deployer is alive on /healthz and the current
+// step on /status. A nil Server does nothing.
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+
+	mu          sync.Mutex
+	started     time.Time
+	stepStarted time.Time
+	current     events.Event
+}
+
+// NewServer creates a health server listening on addr, e.g. :8081
+func NewServer(addr string) *Server {
+	s := &Server{started: time.Now()}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/status", s.status)
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Start listens on the address and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", s.server.Addr, err)
+	}
+	s.listener = listener
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Warning: Health server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.server.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Observe records a pipeline event as the current status
+func (s *Server) Observe(event events.Event) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.Phase == events.PhaseStart || event.Step != s.current.Step {
+		s.stepStarted = event.Timestamp
+	}
+	s.current = event
+}
+
+// Status returns the current status
+func (s *Server) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	status := Status{
+		Step:           s.current.Step,
+		Phase:          string(s.current.Phase),
+		Message:        s.current.Message,
+		StartedAt:      s.started,
+		ElapsedSeconds: int64(now.Sub(s.started).Seconds()),
+	}
+	if s.current.Err != nil {
+		status.Error = s.current.Err.Error()
+	}
+	if !s.stepStarted.IsZero() {
+		status.StepElapsedSeconds = int64(now.Sub(s.stepStarted).Seconds())
+	}
+	return status
+}
+
+// Shutdown stops the server, waiting for running requests to finish
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s == nil || s.listener == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
+
+// healthz answers 200 as long as the deployer is running
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "ok")
+}
+
+// status answers the current status as JSON
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Status()); err != nil {
+		log.Printf("Warning: Could not write health status: %v", err)
+	}
+}
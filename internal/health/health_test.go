@@ -0,0 +1,136 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"awx-deployer/internal/events"
+)
+
+func TestServerStatus(t *testing.T) {
+	started := time.Now()
+
+	tests := []struct {
+		name   string
+		events []events.Event
+		want   Status
+		// wantStepElapsed is the minimum step elapsed time in seconds
+		wantStepElapsed int64
+	}{
+		{
+			name: "before the first step",
+			want: Status{},
+		},
+		{
+			name:   "step started",
+			events: []events.Event{{Step: "preflight", Phase: events.PhaseStart, Timestamp: started}},
+			want:   Status{Step: "preflight", Phase: "start"},
+		},
+		{
+			name: "step progress",
+			events: []events.Event{
+				{Step: "preflight", Phase: events.PhaseStart, Timestamp: started},
+				{Step: "preflight", Phase: events.PhaseComplete, Timestamp: started},
+				{Step: "wait", Phase: events.PhaseStart, Timestamp: started.Add(-90 * time.Second)},
+				{Step: "wait", Phase: events.PhaseProgress, Message: "waiting for PostgreSQL", Timestamp: started},
+			},
+			want:            Status{Step: "wait", Phase: "progress", Message: "waiting for PostgreSQL"},
+			wantStepElapsed: 90,
+		},
+		{
+			name: "step failed",
+			events: []events.Event{
+				{Step: "apply", Phase: events.PhaseStart, Timestamp: started},
+				{Step: "apply", Phase: events.PhaseFail, Err: errors.New("invalid AWX spec"), Timestamp: started},
+			},
+			want: Status{Step: "apply", Phase: "fail", Error: "invalid AWX spec"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer("127.0.0.1:0")
+			for _, event := range tt.events {
+				s.Observe(event)
+			}
+
+			got := s.Status()
+			if got.StartedAt.IsZero() {
+				t.Error("status has no start time")
+			}
+			if got.StepElapsedSeconds < tt.wantStepElapsed {
+				t.Errorf("step elapsed = %ds, want at least %ds", got.StepElapsedSeconds, tt.wantStepElapsed)
+			}
+			got.StartedAt, got.ElapsedSeconds, got.StepElapsedSeconds = time.Time{}, 0, 0
+			if got != tt.want {
+				t.Errorf("Status() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerEndpoints(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	base := "http://" + s.Addr()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/healthz"); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("/healthz = %d %q, want 200 ok", code, body)
+	}
+
+	// /status follows the pipeline from step to step
+	for _, event := range []events.Event{
+		{Step: "operator", Phase: events.PhaseStart, Timestamp: time.Now()},
+		{Step: "apply", Phase: events.PhaseStart, Timestamp: time.Now()},
+		{Step: "apply", Phase: events.PhaseProgress, Message: "applying manifests", Timestamp: time.Now()},
+	} {
+		s.Observe(event)
+		code, body := get("/status")
+		if code != http.StatusOK {
+			t.Fatalf("/status = %d, want 200", code)
+		}
+		var status Status
+		if err := json.Unmarshal([]byte(body), &status); err != nil {
+			t.Fatalf("/status is not JSON: %v: %s", err, body)
+		}
+		if status.Step != event.Step || status.Phase != string(event.Phase) || status.Message != event.Message {
+			t.Errorf("/status = %+v after %s %s", status, event.Step, event.Phase)
+		}
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if _, err := http.Get(base + "/healthz"); err == nil {
+		t.Error("server still answers after Shutdown()")
+	}
+}
+
+func TestNilServer(t *testing.T) {
+	var s *Server
+	s.Observe(events.Event{Step: "apply", Phase: events.PhaseStart})
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() of nil server = %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package images
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+)
+
+// defaultRegistry is the registry of image references without one
+const defaultRegistry = "docker.io"
+
+// awxImageFields are the image references on the AWX CR spec
+var awxImageFields = []string{"image", "redis_image", "postgres_image", "init_container_image", "control_plane_ee_image"}
+
+// Settings rewrites image references and sets the pull policy on objects
+type Settings struct {
+	// PullPolicy is set on every container, empty keeps the manifest value
+	PullPolicy string
+	// Mirrors maps a registry such as quay.io to a mirror prefix
+	Mirrors map[string]string
+}
+
+// NewSettings returns the configured image pull policy and registry mirrors
+func NewSettings(cfg *config.Config) Settings {
+	return Settings{PullPolicy: cfg.ImagePullPolicy, Mirrors: cfg.RegistryMirrorMap()}
+}
+
+// Apply rewrites the image references of an object and sets the pull policy.
+// Pod templates of workloads and of deployments in an operator
+// ClusterServiceVersion are rewritten, and the image fields of the AWX CR,
+// which the operator passes on to the pods it creates.
+func (s Settings) Apply(obj *unstructured.Unstructured) error {
+	switch obj.GetKind() {
+	case k8s.AWXKind:
+		return s.applyAWX(obj)
+	case "Deployment", "StatefulSet", "DaemonSet", "Job":
+		return s.applyPodTemplate(obj.Object, "spec", "template", "spec")
+	case "ClusterServiceVersion":
+		deployments, _, _ := unstructured.NestedSlice(obj.Object, "spec", "install", "spec", "deployments")
+		for _, d := range deployments {
+			if deployment, ok := d.(map[string]interface{}); ok {
+				if err := s.applyPodTemplate(deployment, "spec", "template", "spec"); err != nil {
+					return err
+				}
+			}
+		}
+		if len(deployments) > 0 {
+			return unstructured.SetNestedSlice(obj.Object, deployments, "spec", "install", "spec", "deployments")
+		}
+	}
+	return nil
+}
+
+// applyAWX rewrites the image fields of the AWX CR spec
+func (s Settings) applyAWX(obj *unstructured.Unstructured) error {
+	for _, field := range awxImageFields {
+		image, found, _ := unstructured.NestedString(obj.Object, "spec", field)
+		if !found || image == "" {
+			continue
+		}
+		if err := unstructured.SetNestedField(obj.Object, s.Rewrite(image), "spec", field); err != nil {
+			return err
+		}
+	}
+
+	eeImages, _, _ := unstructured.NestedSlice(obj.Object, "spec", "ee_images")
+	for _, e := range eeImages {
+		if ee, ok := e.(map[string]interface{}); ok {
+			if image, ok := ee["image"].(string); ok {
+				ee["image"] = s.Rewrite(image)
+			}
+		}
+	}
+	if len(eeImages) > 0 {
+		if err := unstructured.SetNestedSlice(obj.Object, eeImages, "spec", "ee_images"); err != nil {
+			return err
+		}
+	}
+
+	if s.PullPolicy != "" {
+		return unstructured.SetNestedField(obj.Object, s.PullPolicy, "spec", "image_pull_policy")
+	}
+	return nil
+}
+
+// applyPodTemplate rewrites the containers of the pod spec at path
+func (s Settings) applyPodTemplate(obj map[string]interface{}, path ...string) error {
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, found, _ := unstructured.NestedSlice(obj, append(path, field)...)
+		if !found {
+			continue
+		}
+
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if image, ok := container["image"].(string); ok {
+				container["image"] = s.Rewrite(image)
+			}
+			if s.PullPolicy != "" {
+				container["imagePullPolicy"] = s.PullPolicy
+			}
+		}
+
+		if err := unstructured.SetNestedSlice(obj, containers, append(path, field)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// References returns the image references of an object, from the same
+// fields that Apply rewrites
+func References(obj *unstructured.Unstructured) []string {
+	var refs []string
+	switch obj.GetKind() {
+	case k8s.AWXKind:
+		for _, field := range awxImageFields {
+			if image, _, _ := unstructured.NestedString(obj.Object, "spec", field); image != "" {
+				refs = append(refs, image)
+			}
+		}
+		eeImages, _, _ := unstructured.NestedSlice(obj.Object, "spec", "ee_images")
+		for _, e := range eeImages {
+			if ee, ok := e.(map[string]interface{}); ok {
+				if image, ok := ee["image"].(string); ok && image != "" {
+					refs = append(refs, image)
+				}
+			}
+		}
+	case "Deployment", "StatefulSet", "DaemonSet", "Job":
+		refs = podTemplateReferences(obj.Object, "spec", "template", "spec")
+	case "ClusterServiceVersion":
+		deployments, _, _ := unstructured.NestedSlice(obj.Object, "spec", "install", "spec", "deployments")
+		for _, d := range deployments {
+			if deployment, ok := d.(map[string]interface{}); ok {
+				refs = append(refs, podTemplateReferences(deployment, "spec", "template", "spec")...)
+			}
+		}
+	}
+	return refs
+}
+
+// podTemplateReferences returns the container images of the pod spec at path
+func podTemplateReferences(obj map[string]interface{}, path ...string) []string {
+	var refs []string
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(obj, append(path, field)...)
+		for _, c := range containers {
+			if container, ok := c.(map[string]interface{}); ok {
+				if image, ok := container["image"].(string); ok && image != "" {
+					refs = append(refs, image)
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// Registry returns the registry host of an image reference
+func Registry(image string) string {
+	registry, _ := splitRegistry(image)
+	return registry
+}
+
+// Rewrite replaces the registry of an image reference with its mirror.
+// References without a registry, like busybox:1.35, are on docker.io.
+func (s Settings) Rewrite(image string) string {
+	registry, repository := splitRegistry(image)
+	mirror, ok := s.Mirrors[registry]
+	if !ok {
+		return image
+	}
+
+	if registry == defaultRegistry && !strings.Contains(repository, "/") {
+		// official images live under library/
+		repository = "library/" + repository
+	}
+	return strings.TrimSuffix(mirror, "/") + "/" + repository
+}
+
+// Tag returns the tag of an image reference, or empty if it has none, like
+// references by digest only
+func Tag(image string) string {
+	_, rest := splitRegistry(image)
+	if i := strings.Index(rest, "@"); i != -1 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndex(rest, ":"); i != -1 {
+		return rest[i+1:]
+	}
+	return ""
+}
+
+// splitRegistry splits an image reference into its registry and the rest.
+// The first component is a registry if it looks like a host name.
+func splitRegistry(image string) (string, string) {
+	i := strings.Index(image, "/")
+	if i == -1 {
+		return defaultRegistry, image
+	}
+
+	host := image[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return defaultRegistry, image
+	}
+	if host == "index.docker.io" {
+		host = defaultRegistry
+	}
+	return host, image[i+1:]
+}
@@ -0,0 +1,207 @@
+package images
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRewrite(t *testing.T) {
+	settings := Settings{Mirrors: map[string]string{
+		"docker.io": "mirror.local/docker",
+		"quay.io":   "mirror.local/quay/",
+	}}
+
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "busybox:1.35", want: "mirror.local/docker/library/busybox:1.35"},
+		{image: "bitnami/redis:7", want: "mirror.local/docker/bitnami/redis:7"},
+		{image: "docker.io/bitnami/redis:7", want: "mirror.local/docker/bitnami/redis:7"},
+		{image: "index.docker.io/library/busybox", want: "mirror.local/docker/library/busybox"},
+		{image: "quay.io/ansible/awx:23.0.0", want: "mirror.local/quay/ansible/awx:23.0.0"},
+		{image: "quay.io/ansible/awx-ee@sha256:abc", want: "mirror.local/quay/ansible/awx-ee@sha256:abc"},
+		{image: "ghcr.io/org/tool:1", want: "ghcr.io/org/tool:1"},
+		{image: "localhost/awx:dev", want: "localhost/awx:dev"},
+		{image: "registry.local:5000/awx:dev", want: "registry.local:5000/awx:dev"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := settings.Rewrite(tt.image); got != tt.want {
+				t.Errorf("Rewrite(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryAndTag(t *testing.T) {
+	tests := []struct {
+		image        string
+		wantRegistry string
+		wantTag      string
+	}{
+		{image: "busybox", wantRegistry: "docker.io"},
+		{image: "busybox:1.35", wantRegistry: "docker.io", wantTag: "1.35"},
+		{image: "quay.io/ansible/awx:23.0.0", wantRegistry: "quay.io", wantTag: "23.0.0"},
+		{image: "registry.local:5000/awx:dev", wantRegistry: "registry.local:5000", wantTag: "dev"},
+		{image: "registry.local:5000/awx", wantRegistry: "registry.local:5000"},
+		{image: "quay.io/ansible/awx@sha256:abc", wantRegistry: "quay.io"},
+		{image: "quay.io/ansible/awx:23.0.0@sha256:abc", wantRegistry: "quay.io", wantTag: "23.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := Registry(tt.image); got != tt.wantRegistry {
+				t.Errorf("Registry(%q) = %q, want %q", tt.image, got, tt.wantRegistry)
+			}
+			if got := Tag(tt.image); got != tt.wantTag {
+				t.Errorf("Tag(%q) = %q, want %q", tt.image, got, tt.wantTag)
+			}
+		})
+	}
+}
+
+// container returns a container spec with an image
+func container(name, image string) interface{} {
+	return map[string]interface{}{"name": name, "image": image}
+}
+
+func TestApply(t *testing.T) {
+	mirrors := map[string]string{"quay.io": "mirror.local/quay", "docker.io": "mirror.local/docker"}
+
+	tests := []struct {
+		name     string
+		settings Settings
+		obj      map[string]interface{}
+		// want are the expected values of fields, by path
+		want map[string]interface{}
+	}{
+		{
+			name:     "deployment containers",
+			settings: Settings{PullPolicy: "IfNotPresent", Mirrors: mirrors},
+			obj: map[string]interface{}{
+				"kind": "Deployment",
+				"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+					"initContainers": []interface{}{container("init", "busybox:1.35")},
+					"containers":     []interface{}{container("manager", "quay.io/ansible/awx-operator:2.5.0")},
+				}}},
+			},
+			want: map[string]interface{}{
+				"spec.template.spec.initContainers": []interface{}{map[string]interface{}{"name": "init", "image": "mirror.local/docker/library/busybox:1.35", "imagePullPolicy": "IfNotPresent"}},
+				"spec.template.spec.containers":     []interface{}{map[string]interface{}{"name": "manager", "image": "mirror.local/quay/ansible/awx-operator:2.5.0", "imagePullPolicy": "IfNotPresent"}},
+			},
+		},
+		{
+			name:     "job without pull policy",
+			settings: Settings{Mirrors: mirrors},
+			obj: map[string]interface{}{
+				"kind": "Job",
+				"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+					"containers": []interface{}{container("fix", "busybox:1.35")},
+				}}},
+			},
+			want: map[string]interface{}{
+				"spec.template.spec.containers": []interface{}{map[string]interface{}{"name": "fix", "image": "mirror.local/docker/library/busybox:1.35"}},
+			},
+		},
+		{
+			name:     "AWX CR image fields",
+			settings: Settings{PullPolicy: "Always", Mirrors: mirrors},
+			obj: map[string]interface{}{
+				"kind": "AWX",
+				"spec": map[string]interface{}{
+					"image":          "quay.io/ansible/awx",
+					"redis_image":    "docker.io/redis",
+					"postgres_image": "ghcr.io/org/postgres",
+					"ee_images":      []interface{}{map[string]interface{}{"name": "ee", "image": "quay.io/ansible/awx-ee:latest"}},
+				},
+			},
+			want: map[string]interface{}{
+				"spec.image":             "mirror.local/quay/ansible/awx",
+				"spec.redis_image":       "mirror.local/docker/library/redis",
+				"spec.postgres_image":    "ghcr.io/org/postgres",
+				"spec.ee_images":         []interface{}{map[string]interface{}{"name": "ee", "image": "mirror.local/quay/ansible/awx-ee:latest"}},
+				"spec.image_pull_policy": "Always",
+			},
+		},
+		{
+			name:     "AWX CR without settings",
+			settings: Settings{},
+			obj: map[string]interface{}{
+				"kind": "AWX",
+				"spec": map[string]interface{}{"image": "quay.io/ansible/awx"},
+			},
+			want: map[string]interface{}{
+				"spec.image":             "quay.io/ansible/awx",
+				"spec.image_pull_policy": nil,
+			},
+		},
+		{
+			name:     "operator ClusterServiceVersion",
+			settings: Settings{PullPolicy: "Never", Mirrors: mirrors},
+			obj: map[string]interface{}{
+				"kind": "ClusterServiceVersion",
+				"spec": map[string]interface{}{"install": map[string]interface{}{"spec": map[string]interface{}{
+					"deployments": []interface{}{map[string]interface{}{
+						"name": "awx-operator-controller-manager",
+						"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+							"containers": []interface{}{container("manager", "quay.io/ansible/awx-operator:2.5.0")},
+						}}},
+					}},
+				}}},
+			},
+			want: map[string]interface{}{
+				"spec.install.spec.deployments": []interface{}{map[string]interface{}{
+					"name": "awx-operator-controller-manager",
+					"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+						"containers": []interface{}{map[string]interface{}{"name": "manager", "image": "mirror.local/quay/ansible/awx-operator:2.5.0", "imagePullPolicy": "Never"}},
+					}}},
+				}},
+			},
+		},
+		{
+			name:     "other kinds untouched",
+			settings: Settings{PullPolicy: "Never", Mirrors: mirrors},
+			obj: map[string]interface{}{
+				"kind": "ConfigMap",
+				"data": map[string]interface{}{"image": "quay.io/ansible/awx"},
+			},
+			want: map[string]interface{}{"data.image": "quay.io/ansible/awx"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: tt.obj}
+			before := References(obj.DeepCopy())
+			if err := tt.settings.Apply(obj); err != nil {
+				t.Fatalf("Apply() failed: %v", err)
+			}
+			for path, want := range tt.want {
+				got, _, _ := unstructured.NestedFieldNoCopy(obj.Object, splitPath(path)...)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %v, want %v", path, got, want)
+				}
+			}
+
+			after := References(obj)
+			if len(after) != len(before) {
+				t.Fatalf("References() = %v after Apply, want %d references", after, len(before))
+			}
+			for i, image := range before {
+				if after[i] != tt.settings.Rewrite(image) {
+					t.Errorf("reference %d = %q, want %q", i, after[i], tt.settings.Rewrite(image))
+				}
+			}
+		})
+	}
+}
+
+// splitPath splits a dotted field path
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
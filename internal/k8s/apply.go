@@ -0,0 +1,118 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
+)
+
+// FieldManager is the field manager name used for server-side apply
+const FieldManager = "awx-deployer"
+
+// clientSideManagers are the field managers that own fields written by
+// create/update calls: kubectl, this tool before it used server-side apply,
+// and the placeholder the API server records for objects without managed fields
+var clientSideManagers = sets.New("kubectl-client-side-apply", "kubectl", "kubectl-create", FieldManager, "before-first-apply")
+
+// ApplyServerSide applies an object with server-side apply.
+// Objects created client-side are adopted first: the fields owned by
+// client-side managers are moved to FieldManager and the last-applied
+// annotation is cleared, so the first server-side apply does not conflict
+// with field values this tool set itself. Adoption happens only once, before
+// FieldManager has applied the object for the first time.
+// An apply rejected because it changes immutable fields returns an
+// *ImmutableFieldError, an object whose kind or namespace does not exist
+// yet a *DependencyError.
+func (k *KubernetesClient) ApplyServerSide(ctx context.Context, obj *unstructured.Unstructured) error {
+	resource, err := k.resourceFor(obj)
+	if err != nil {
+		return err
+	}
+
+	existing, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get existing resource %s: %v", obj.GetName(), err)
+	}
+	if err == nil {
+		if err := k.adoptClientSideFields(ctx, resource, existing); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return fmt.Errorf("failed to encode resource %s: %v", obj.GetName(), err)
+	}
+
+	_, err = resource.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+	k.record("apply", resource, obj.GetName(), err)
+	if err != nil {
+		if fields := immutableFields(err); len(fields) > 0 {
+			return &ImmutableFieldError{Kind: obj.GetKind(), Name: obj.GetName(), Fields: fields, Err: err}
+		}
+		return dependencyError(err, fmt.Errorf("failed to apply resource %s: %v", obj.GetName(), err))
+	}
+	return nil
+}
+
+// adoptClientSideFields moves the fields owned by client-side managers to
+// FieldManager and clears the last-applied annotation, unless FieldManager
+// has already applied the object
+func (k *KubernetesClient) adoptClientSideFields(ctx context.Context, resource *objectResource, existing *unstructured.Unstructured) error {
+	for _, entry := range existing.GetManagedFields() {
+		if entry.Manager == FieldManager && entry.Operation == metav1.ManagedFieldsOperationApply {
+			return nil
+		}
+	}
+
+	var patch []map[string]interface{}
+
+	upgrade, err := csaupgrade.UpgradeManagedFieldsPatch(existing, clientSideManagers, FieldManager)
+	if err != nil {
+		return fmt.Errorf("failed to compute field ownership upgrade for %s: %v", existing.GetName(), err)
+	}
+	if upgrade != nil {
+		if err := json.Unmarshal(upgrade, &patch); err != nil {
+			return fmt.Errorf("failed to decode field ownership upgrade for %s: %v", existing.GetName(), err)
+		}
+	}
+
+	if _, ok := existing.GetAnnotations()[corev1.LastAppliedConfigAnnotation]; ok {
+		patch = append(patch, map[string]interface{}{
+			"op":   "remove",
+			"path": "/metadata/annotations/" + escapeJSONPointer(corev1.LastAppliedConfigAnnotation),
+		})
+	}
+
+	if len(patch) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to encode field ownership upgrade for %s: %v", existing.GetName(), err)
+	}
+
+	log.Printf("Adopting client-side managed fields of %s %s for server-side apply", existing.GetKind(), existing.GetName())
+	_, err = resource.Patch(ctx, existing.GetName(), types.JSONPatchType, data, metav1.PatchOptions{})
+	k.record("patch", resource, existing.GetName(), err)
+	if err != nil {
+		return fmt.Errorf("failed to adopt client-side managed fields of %s: %v", existing.GetName(), err)
+	}
+	return nil
+}
+
+// escapeJSONPointer escapes a key for use in a JSON patch path
+func escapeJSONPointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
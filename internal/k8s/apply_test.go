@@ -0,0 +1,177 @@
+package k8s_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// configMap returns a ConfigMap with the given data value and field managers
+func configMap(value string, managers ...metav1.ManagedFieldsEntry) *unstructured.Unstructured {
+	obj := k8stest.Object("v1", "ConfigMap", "awx", "awx-settings")
+	unstructured.SetNestedStringMap(obj.Object, map[string]string{"key": value}, "data")
+	obj.SetManagedFields(managers)
+	return obj
+}
+
+// clientSideManager is the field manager entry kubectl apply records
+func clientSideManager(manager string) metav1.ManagedFieldsEntry {
+	return metav1.ManagedFieldsEntry{
+		Manager:    manager,
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		APIVersion: "v1",
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:data":{".":{},"f:key":{}}}`)},
+	}
+}
+
+// serverSideManager is the field manager entry of a server-side apply
+func serverSideManager(manager string) metav1.ManagedFieldsEntry {
+	entry := clientSideManager(manager)
+	entry.Operation = metav1.ManagedFieldsOperationApply
+	return entry
+}
+
+// simulateServerSideApply makes the fake cluster answer server-side apply
+// patches of ConfigMaps, which it does not support itself. Like the API
+// server, an apply conflicts with fields another manager updated, and with
+// the last-applied annotation a later kubectl apply would diff against.
+func simulateServerSideApply(cluster *k8stest.Cluster) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	tracker := cluster.Dynamic.Tracker()
+	cluster.Dynamic.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj, err := tracker.Get(gvr, patch.GetNamespace(), patch.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		current := obj.(*unstructured.Unstructured).DeepCopy()
+
+		owned := false
+		for _, entry := range current.GetManagedFields() {
+			if entry.Manager != k8s.FieldManager && entry.Operation == metav1.ManagedFieldsOperationUpdate {
+				return true, nil, errors.NewConflict(gvr.GroupResource(), patch.GetName(), nil)
+			}
+			owned = owned || entry.Manager == k8s.FieldManager
+		}
+		if _, ok := current.GetAnnotations()[corev1.LastAppliedConfigAnnotation]; ok {
+			return true, nil, errors.NewConflict(gvr.GroupResource(), patch.GetName(), nil)
+		}
+
+		var applied map[string]interface{}
+		if err := json.Unmarshal(patch.GetPatch(), &applied); err != nil {
+			return true, nil, err
+		}
+		current.Object["data"] = applied["data"]
+		if !owned {
+			current.SetManagedFields(append(current.GetManagedFields(), serverSideManager(k8s.FieldManager)))
+		}
+		return true, current, tracker.Update(gvr, current, patch.GetNamespace())
+	})
+}
+
+func TestApplyServerSideAdoptsClientSideFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *unstructured.Unstructured
+		// lastApplied adds the annotation kubectl apply sets
+		lastApplied bool
+		wantAdopted bool
+	}{
+		{
+			name: "new object",
+		},
+		{
+			name:        "created with kubectl apply",
+			existing:    configMap("old", clientSideManager("kubectl-client-side-apply")),
+			lastApplied: true,
+			wantAdopted: true,
+		},
+		{
+			name:        "created with kubectl create",
+			existing:    configMap("old", clientSideManager("kubectl-create")),
+			wantAdopted: true,
+		},
+		{
+			name:        "created by the deployer before server-side apply",
+			existing:    configMap("old", clientSideManager(k8s.FieldManager)),
+			wantAdopted: true,
+		},
+		{
+			name:        "last-applied annotation only",
+			existing:    configMap("old"),
+			lastApplied: true,
+			wantAdopted: true,
+		},
+		{
+			name:     "already applied server-side",
+			existing: configMap("old", serverSideManager(k8s.FieldManager)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing != nil {
+				if tt.lastApplied {
+					tt.existing.SetAnnotations(map[string]string{corev1.LastAppliedConfigAnnotation: `{"data":{"key":"old"}}`})
+				}
+				objects = append(objects, tt.existing)
+			}
+			cluster := k8stest.NewCluster(objects...)
+			simulateServerSideApply(cluster)
+			if tt.existing == nil {
+				cluster.Dynamic.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					// an apply creates a missing object
+					obj := configMap("new", serverSideManager(k8s.FieldManager))
+					return true, obj, cluster.Dynamic.Tracker().Add(obj)
+				})
+			}
+
+			if err := cluster.Client.ApplyServerSide(context.Background(), configMap("new")); err != nil {
+				t.Fatalf("ApplyServerSide() failed: %v", err)
+			}
+
+			adopted := false
+			for _, action := range cluster.Dynamic.Actions() {
+				if patch, ok := action.(k8stesting.PatchAction); ok && patch.GetPatchType() == types.JSONPatchType {
+					adopted = true
+				}
+			}
+			if adopted != tt.wantAdopted {
+				t.Errorf("adopted = %v, want %v", adopted, tt.wantAdopted)
+			}
+
+			current, err := cluster.Client.GetObject(context.Background(), configMap(""))
+			if err != nil || current == nil {
+				t.Fatalf("GetObject() = %v, %v", current, err)
+			}
+			if value, _, _ := unstructured.NestedString(current.Object, "data", "key"); value != "new" {
+				t.Errorf("data.key = %q, want %q", value, "new")
+			}
+			if _, ok := current.GetAnnotations()[corev1.LastAppliedConfigAnnotation]; ok {
+				t.Errorf("last-applied annotation was kept")
+			}
+			for _, entry := range current.GetManagedFields() {
+				if entry.Manager != k8s.FieldManager || entry.Operation != metav1.ManagedFieldsOperationApply {
+					t.Errorf("field manager %s (%s) left after adoption", entry.Manager, entry.Operation)
+				}
+			}
+		})
+	}
+}
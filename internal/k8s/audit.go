@@ -0,0 +1,16 @@
+package k8s
+
+import (
+	"awx-deployer/internal/audit"
+)
+
+// SetAuditLog records every create, update, patch and delete made through
+// the client in the audit log. A nil log disables auditing.
+func (k *KubernetesClient) SetAuditLog(auditLog *audit.Log) {
+	k.auditLog = auditLog
+}
+
+// record audits a mutation of an object resource
+func (k *KubernetesClient) record(verb string, resource *objectResource, name string, err error) {
+	k.auditLog.Record(verb, resource.gvr, resource.namespace, name, err)
+}
@@ -0,0 +1,164 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+const (
+	// AWXGroup is the API group of the AWX custom resource
+	AWXGroup = "awx.ansible.com"
+	// AWXKind is the kind of the AWX custom resource
+	AWXKind = "AWX"
+	// AWXResource is the plural resource name of the AWX custom resource
+	AWXResource = "awxs"
+	// AWXFallbackVersion is used when the served versions cannot be discovered
+	AWXFallbackVersion = "v1beta1"
+)
+
+// AWXVersion returns the newest API version of the AWX CRD that the cluster
+// serves. The result is cached once discovered. Until the CRD is installed
+// AWXFallbackVersion is returned.
+func (k *KubernetesClient) AWXVersion(ctx context.Context) string {
+	k.awxVersionMu.Lock()
+	defer k.awxVersionMu.Unlock()
+
+	if k.awxVersion != "" {
+		return k.awxVersion
+	}
+
+	served, err := k.servedVersions(ctx, AWXResource+"."+AWXGroup)
+	if err != nil || len(served) == 0 {
+		return AWXFallbackVersion
+	}
+
+	k.awxVersion = newestVersion(served)
+	log.Printf("Using AWX API version %s/%s (served: %v)", AWXGroup, k.awxVersion, served)
+	return k.awxVersion
+}
+
+// AWXGroupVersionResource returns the AWX resource at the discovered version
+func (k *KubernetesClient) AWXGroupVersionResource(ctx context.Context) schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: AWXGroup, Version: k.AWXVersion(ctx), Resource: AWXResource}
+}
+
+// GetAWX gets an AWX custom resource at the discovered version
+func (k *KubernetesClient) GetAWX(ctx context.Context, name, namespace string) (*unstructured.Unstructured, error) {
+	return k.GetResource(ctx, AWXGroup, k.AWXVersion(ctx), AWXResource, name, namespace)
+}
+
+// AWXExists checks if an AWX custom resource exists
+func (k *KubernetesClient) AWXExists(ctx context.Context, name, namespace string) (bool, error) {
+	return k.ResourceExists(ctx, AWXGroup, k.AWXVersion(ctx), AWXResource, name, namespace)
+}
+
+// PatchAWX patches an AWX custom resource and returns the patched object
+func (k *KubernetesClient) PatchAWX(ctx context.Context, name, namespace string, patchType types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+	return k.PatchResource(ctx, AWXGroup, k.AWXVersion(ctx), AWXResource, name, namespace, patchType, data)
+}
+
+// servedVersions returns the versions a CustomResourceDefinition serves
+func (k *KubernetesClient) servedVersions(ctx context.Context, crdName string) ([]string, error) {
+	crd, err := k.dynamicClient.Resource(CRDGroupVersionResource).Get(ctx, crdName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get custom resource definition %s: %v", crdName, err)
+	}
+	return crdServedVersions(crd), nil
+}
+
+// crdServedVersions returns the versions a CustomResourceDefinition object serves
+func crdServedVersions(crd *unstructured.Unstructured) []string {
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	var served []string
+	for _, v := range versions {
+		crdVersion, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := crdVersion["name"].(string)
+		if isServed, _ := crdVersion["served"].(bool); isServed && name != "" {
+			served = append(served, name)
+		}
+	}
+	return served
+}
+
+// AWXCRDs lists the CustomResourceDefinitions of the AWX API group, such as
+// those of AWX, AWXBackup and AWXRestore
+func (k *KubernetesClient) AWXCRDs(ctx context.Context) ([]unstructured.Unstructured, error) {
+	crds, err := k.dynamicClient.Resource(CRDGroupVersionResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list custom resource definitions: %v", err)
+	}
+
+	var awxCRDs []unstructured.Unstructured
+	for _, crd := range crds.Items {
+		if group, _, _ := unstructured.NestedString(crd.Object, "spec", "group"); group == AWXGroup {
+			awxCRDs = append(awxCRDs, crd)
+		}
+	}
+	return awxCRDs, nil
+}
+
+// DeleteCRD deletes a CustomResourceDefinition. A CRD that is already gone
+// is not an error.
+func (k *KubernetesClient) DeleteCRD(ctx context.Context, name string) error {
+	err := k.dynamicClient.Resource(CRDGroupVersionResource).Delete(ctx, name, k.deleteOptions())
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	k.auditLog.Record("delete", CRDGroupVersionResource, "", name, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete custom resource definition %s: %v", name, err)
+	}
+	return nil
+}
+
+// GetCRD gets a CustomResourceDefinition, or nil if it does not exist
+func (k *KubernetesClient) GetCRD(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	crd, err := k.dynamicClient.Resource(CRDGroupVersionResource).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get custom resource definition %s: %v", name, err)
+	}
+	return crd, nil
+}
+
+// ListCustomResources lists the resources of a CustomResourceDefinition in
+// all namespaces, at the newest version it serves
+func (k *KubernetesClient) ListCustomResources(ctx context.Context, crd *unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	served := crdServedVersions(crd)
+	if len(served) == 0 {
+		return nil, nil
+	}
+
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	gvr := schema.GroupVersionResource{Group: group, Version: newestVersion(served), Resource: plural}
+	list, err := k.dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", crd.GetName(), err)
+	}
+	return list.Items, nil
+}
+
+// newestVersion returns the newest of Kubernetes-style versions such as
+// v1, v1beta2 and v1alpha1, ranking GA above beta above alpha
+func newestVersion(versions []string) string {
+	sorted := append([]string(nil), versions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return version.CompareKubeAwareVersionStrings(sorted[i], sorted[j]) > 0
+	})
+	return sorted[0]
+}
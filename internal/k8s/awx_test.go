@@ -0,0 +1,90 @@
+package k8s_test
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// awxCRDServing returns the AWX CRD with the given versions, served unless
+// listed in notServed
+func awxCRDServing(versions []string, notServed ...string) *unstructured.Unstructured {
+	crd := k8stest.Object("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", k8s.AWXResource+"."+k8s.AWXGroup)
+	unstructured.SetNestedField(crd.Object, k8s.AWXGroup, "spec", "group")
+	unstructured.SetNestedField(crd.Object, k8s.AWXResource, "spec", "names", "plural")
+	var list []interface{}
+	for _, version := range versions {
+		served := true
+		for _, name := range notServed {
+			served = served && name != version
+		}
+		list = append(list, map[string]interface{}{"name": version, "served": served})
+	}
+	unstructured.SetNestedSlice(crd.Object, list, "spec", "versions")
+	return crd
+}
+
+func TestAWXVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		crd  *unstructured.Unstructured
+		want string
+	}{
+		{name: "CRD not installed", want: "v1beta1"},
+		{name: "only v1beta1", crd: awxCRDServing([]string{"v1beta1"}), want: "v1beta1"},
+		{name: "v1 and v1beta1", crd: awxCRDServing([]string{"v1beta1", "v1"}), want: "v1"},
+		{name: "v1 listed first", crd: awxCRDServing([]string{"v1", "v1beta1"}), want: "v1"},
+		{name: "v1 not served", crd: awxCRDServing([]string{"v1beta1", "v1"}, "v1"), want: "v1beta1"},
+		{name: "beta above alpha", crd: awxCRDServing([]string{"v1alpha1", "v1beta1", "v1beta2"}), want: "v1beta2"},
+		{name: "v2 above v1", crd: awxCRDServing([]string{"v1", "v2beta1", "v2"}), want: "v2"},
+		{name: "no version served", crd: awxCRDServing([]string{"v1beta1"}, "v1beta1"), want: "v1beta1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.crd != nil {
+				objects = append(objects, tt.crd)
+			}
+			cluster := k8stest.NewCluster(objects...)
+
+			if got := cluster.Client.AWXVersion(context.Background()); got != tt.want {
+				t.Errorf("AWXVersion() = %q, want %q", got, tt.want)
+			}
+			gvr := cluster.Client.AWXGroupVersionResource(context.Background())
+			if gvr.Group != k8s.AWXGroup || gvr.Version != tt.want || gvr.Resource != k8s.AWXResource {
+				t.Errorf("AWXGroupVersionResource() = %v, want version %s", gvr, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWXVersionIsCached(t *testing.T) {
+	cluster := k8stest.NewCluster(awxCRDServing([]string{"v1beta1", "v1"}))
+	ctx := context.Background()
+	if got := cluster.Client.AWXVersion(ctx); got != "v1" {
+		t.Fatalf("AWXVersion() = %q, want v1", got)
+	}
+
+	// a version discovered once is kept, a fallback is not
+	if err := cluster.Dynamic.Tracker().Delete(k8s.CRDGroupVersionResource, "", k8s.AWXResource+"."+k8s.AWXGroup); err != nil {
+		t.Fatal(err)
+	}
+	if got := cluster.Client.AWXVersion(ctx); got != "v1" {
+		t.Errorf("AWXVersion() after the CRD is gone = %q, want the cached v1", got)
+	}
+
+	empty := k8stest.NewCluster()
+	empty.Client.AWXVersion(ctx)
+	if err := empty.Dynamic.Tracker().Add(awxCRDServing([]string{"v1beta1", "v1"})); err != nil {
+		t.Fatal(err)
+	}
+	if got := empty.Client.AWXVersion(ctx); got != "v1" {
+		t.Errorf("AWXVersion() after the CRD is installed = %q, want v1", got)
+	}
+}
@@ -0,0 +1,72 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ImmutableFieldError is returned when an update is rejected because it
+// changes fields that cannot be modified after creation
+type ImmutableFieldError struct {
+	Kind   string
+	Name   string
+	Fields []string
+	Err    error
+}
+
+func (e *ImmutableFieldError) Error() string {
+	return fmt.Sprintf("cannot update %s %s: immutable field(s) %s changed: %v", e.Kind, e.Name, strings.Join(e.Fields, ", "), e.Err)
+}
+
+// DependencyError is returned when an object cannot be applied yet because
+// something it needs does not exist, like the CRD serving its kind or its
+// namespace. Applying it again once that exists can succeed.
+type DependencyError struct {
+	Err error
+}
+
+func (e *DependencyError) Error() string {
+	return e.Err.Error()
+}
+
+// IsDependencyError reports whether err is a *DependencyError
+func IsDependencyError(err error) bool {
+	_, ok := err.(*DependencyError)
+	return ok
+}
+
+// dependencyError wraps err in a *DependencyError if the API server
+// rejected a request because something it refers to was not found
+func dependencyError(apiErr error, err error) error {
+	if errors.IsNotFound(apiErr) {
+		return &DependencyError{Err: err}
+	}
+	return err
+}
+
+// immutableFields returns the fields named in an Invalid error as immutable,
+// or as forbidden to shrink like the storage request of a bound
+// PersistentVolumeClaim
+func immutableFields(err error) []string {
+	if !errors.IsInvalid(err) {
+		return nil
+	}
+
+	statusErr, ok := err.(errors.APIStatus)
+	if !ok || statusErr.Status().Details == nil {
+		return nil
+	}
+
+	var fields []string
+	for _, cause := range statusErr.Status().Details.Causes {
+		shrunk := cause.Type == metav1.CauseType(field.ErrorTypeForbidden) && strings.Contains(cause.Message, "less than previous value")
+		if strings.Contains(cause.Message, "immutable") || shrunk {
+			fields = append(fields, cause.Field)
+		}
+	}
+	return fields
+}
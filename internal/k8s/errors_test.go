@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestImmutableFields(t *testing.T) {
+	invalid := func(kind string, errs ...*field.Error) error {
+		return errors.NewInvalid(schema.GroupKind{Kind: kind}, "awx", field.ErrorList(errs))
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{
+			name: "service cluster IP",
+			err:  invalid("Service", field.Invalid(field.NewPath("spec", "clusterIPs").Index(0), "10.0.0.2", "may not change once set"), field.Invalid(field.NewPath("spec", "clusterIP"), "10.0.0.2", "field is immutable")),
+			want: []string{"spec.clusterIP"},
+		},
+		{
+			name: "deployment selector",
+			err:  invalid("Deployment", field.Invalid(field.NewPath("spec", "selector"), nil, "field is immutable")),
+			want: []string{"spec.selector"},
+		},
+		{
+			name: "PVC storage shrink",
+			err:  invalid("PersistentVolumeClaim", field.Forbidden(field.NewPath("spec", "resources", "requests", "storage"), "field can not be less than previous value")),
+			want: []string{"spec.resources.requests.storage"},
+		},
+		{
+			name: "PVC spec change",
+			err:  invalid("PersistentVolumeClaim", field.Forbidden(field.NewPath("spec"), "spec is immutable after creation except resources.requests and volumeAttributesClassName for bound claims")),
+			want: []string{"spec"},
+		},
+		{
+			name: "other invalid value",
+			err:  invalid("Service", field.Invalid(field.NewPath("spec", "ports").Index(0).Child("port"), 0, "must be between 1 and 65535")),
+		},
+		{
+			name: "other forbidden value",
+			err:  invalid("Pod", field.Forbidden(field.NewPath("spec", "hostNetwork"), "host network is not allowed")),
+		},
+		{
+			name: "not an invalid error",
+			err:  errors.NewConflict(schema.GroupResource{Resource: "services"}, "awx", nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := immutableFields(tt.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("immutableFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
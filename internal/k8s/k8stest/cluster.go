@@ -0,0 +1,150 @@
+// Package k8stest provides a fake cluster for testing code that uses the
+// Kubernetes client of the deployer
+package k8stest
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"awx-deployer/internal/k8s"
+)
+
+// resource is a resource the fake cluster serves
+type resource struct {
+	gvr        schema.GroupVersionResource
+	kind       string
+	namespaced bool
+}
+
+// resources are the resources the fake cluster serves, built-in ones and
+// those of the AWX operator and cert-manager
+var resources = []resource{
+	{schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, "Namespace", false},
+	{schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "Pod", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "services"}, "Service", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "Secret", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "ConfigMap", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "events"}, "Event", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}, "ServiceAccount", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}, "PersistentVolumeClaim", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumes"}, "PersistentVolume", false},
+	{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "Deployment", true},
+	{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, "StatefulSet", true},
+	{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}, "ReplicaSet", true},
+	{schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}, "Job", true},
+	{schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}, "Ingress", true},
+	{schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"}, "StorageClass", false},
+	{schema.GroupVersionResource{Group: "coordination.k8s.io", Version: "v1", Resource: "leases"}, "Lease", true},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}, "Role", true},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}, "RoleBinding", true},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}, "ClusterRole", false},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}, "ClusterRoleBinding", false},
+	{k8s.CRDGroupVersionResource, "CustomResourceDefinition", false},
+	{schema.GroupVersionResource{Group: k8s.AWXGroup, Version: k8s.AWXFallbackVersion, Resource: k8s.AWXResource}, "AWX", true},
+	{schema.GroupVersionResource{Group: k8s.AWXGroup, Version: k8s.AWXFallbackVersion, Resource: "awxbackups"}, "AWXBackup", true},
+	{schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}, "Certificate", true},
+	{schema.GroupVersionResource{Group: "acme.cert-manager.io", Version: "v1", Resource: "challenges"}, "Challenge", true},
+}
+
+// Cluster is a fake cluster. Its typed and dynamic clients do not share
+// objects: the objects it is created with are added to both, objects
+// created later only to the client that created them.
+type Cluster struct {
+	Client    *k8s.KubernetesClient
+	Clientset *fake.Clientset
+	Dynamic   *dynamicfake.FakeDynamicClient
+	Discovery *fakediscovery.FakeDiscovery
+}
+
+// NewCluster creates a new fake cluster holding the given objects. Typed
+// objects are added to the typed and the dynamic client, unstructured ones
+// such as AWX CRs only to the dynamic client.
+func NewCluster(objects ...runtime.Object) *Cluster {
+	var typed, dynamic []runtime.Object
+	for _, obj := range objects {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			dynamic = append(dynamic, u)
+			continue
+		}
+		typed = append(typed, obj)
+		dynamic = append(dynamic, toUnstructured(obj))
+	}
+
+	listKinds := make(map[schema.GroupVersionResource]string)
+	for _, r := range resources {
+		listKinds[r.gvr] = r.kind + "List"
+	}
+
+	clientset := fake.NewSimpleClientset(typed...)
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, dynamic...)
+	discoveryClient := clientset.Discovery().(*fakediscovery.FakeDiscovery)
+	discoveryClient.Resources = apiResourceLists()
+
+	return &Cluster{
+		Client:    k8s.NewKubernetesClientForClients(clientset, dynamicClient, discoveryClient),
+		Clientset: clientset,
+		Dynamic:   dynamicClient,
+		Discovery: discoveryClient,
+	}
+}
+
+// apiResourceLists returns the discovery information of the resources
+func apiResourceLists() []*metav1.APIResourceList {
+	var lists []*metav1.APIResourceList
+	byGroupVersion := make(map[string]*metav1.APIResourceList)
+	for _, r := range resources {
+		groupVersion := r.gvr.GroupVersion().String()
+		list, ok := byGroupVersion[groupVersion]
+		if !ok {
+			list = &metav1.APIResourceList{GroupVersion: groupVersion}
+			byGroupVersion[groupVersion] = list
+			lists = append(lists, list)
+		}
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       r.gvr.Resource,
+			Kind:       r.kind,
+			Namespaced: r.namespaced,
+			Verbs:      metav1.Verbs{"get", "list", "watch", "create", "update", "patch", "delete"},
+		})
+	}
+	return lists
+}
+
+// toUnstructured converts a typed object of the client-go scheme
+func toUnstructured(obj runtime.Object) *unstructured.Unstructured {
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil || len(gvks) == 0 {
+		panic(fmt.Sprintf("unknown object type %T: %v", obj, err))
+	}
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		panic(err)
+	}
+	u := &unstructured.Unstructured{Object: data}
+	u.SetGroupVersionKind(gvks[0])
+	return u
+}
+
+// Object creates an unstructured object of a kind the cluster serves, e.g.
+// Object("awx.ansible.com/v1beta1", "AWX", "awx", "awx-instance")
+func Object(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
+
+// AWX creates an AWX CR without status
+func AWX(namespace, name string) *unstructured.Unstructured {
+	return Object(k8s.AWXGroup+"/"+k8s.AWXFallbackVersion, "AWX", namespace, name)
+}
@@ -0,0 +1,90 @@
+package k8s
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// loadKubeconfig merges the kubeconfig files in a colon-separated list, like
+// kubectl does, and returns the client config for the selected cluster.
+// The cluster is matched against context names first, then cluster names.
+// Without a cluster the current context is used. The name of the context
+// used is returned with the config.
+func loadKubeconfig(kubeconfigPaths, cluster string) (*rest.Config, string, error) {
+	paths := filepath.SplitList(kubeconfigPaths)
+	rules := &clientcmd.ClientConfigLoadingRules{Precedence: paths}
+	if len(paths) == 1 {
+		// a single file must exist, as before merging was supported
+		rules = &clientcmd.ClientConfigLoadingRules{ExplicitPath: paths[0]}
+	}
+	merged, err := rules.Load()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig: %v", err)
+	}
+
+	contextName := merged.CurrentContext
+	if cluster != "" {
+		contextName, err = selectContext(merged, cluster)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if contextName == "" {
+		return nil, "", fmt.Errorf("kubeconfig %s has no current context, set AWX_CLUSTER to select one", kubeconfigPaths)
+	}
+	kubeContext, ok := merged.Contexts[contextName]
+	if !ok {
+		return nil, "", fmt.Errorf("context %q not found in kubeconfig %s", contextName, kubeconfigPaths)
+	}
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: contextName}
+	config, err := clientcmd.NewDefaultClientConfig(*merged, overrides).ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to build config from kubeconfig: %v", err)
+	}
+
+	log.Printf("Using context %s (cluster %s, server %s)", contextName, kubeContext.Cluster, config.Host)
+	return config, contextName, nil
+}
+
+// selectContext returns the context named cluster, or the only context
+// pointing at a cluster with that name
+func selectContext(merged *clientcmdapi.Config, cluster string) (string, error) {
+	if _, ok := merged.Contexts[cluster]; ok {
+		return cluster, nil
+	}
+
+	var matches []string
+	for name, kubeContext := range merged.Contexts {
+		if kubeContext.Cluster == cluster {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no context or cluster named %q in kubeconfig (available contexts: %v)", cluster, contextNames(merged))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("cluster %q is used by several contexts %v, set AWX_CLUSTER to one of them", cluster, matches)
+	}
+}
+
+// contextNames returns the sorted context names of a kubeconfig
+func contextNames(merged *clientcmdapi.Config) []string {
+	var names []string
+	for name := range merged.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
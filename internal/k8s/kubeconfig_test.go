@@ -0,0 +1,111 @@
+package k8s
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadKubeconfig(t *testing.T) {
+	east := filepath.Join("testdata", "kubeconfig", "east.yaml")
+	west := filepath.Join("testdata", "kubeconfig", "west.yaml")
+	missing := filepath.Join("testdata", "kubeconfig", "missing.yaml")
+	merged := strings.Join([]string{east, west}, string(filepath.ListSeparator))
+
+	tests := []struct {
+		name        string
+		paths       string
+		cluster     string
+		wantContext string
+		wantHost    string
+		wantToken   string
+		wantErr     string
+	}{
+		{
+			name:        "single file current context",
+			paths:       west,
+			wantContext: "west",
+			wantHost:    "https://west.example.com:6443",
+			wantToken:   "west-token",
+		},
+		{
+			name:        "merged files use the first current context",
+			paths:       merged,
+			wantContext: "east",
+			wantHost:    "https://east.example.com:6443",
+			wantToken:   "east-token",
+		},
+		{
+			name:        "merged files select context by name",
+			paths:       merged,
+			cluster:     "west",
+			wantContext: "west",
+			wantHost:    "https://west.example.com:6443",
+			wantToken:   "west-token",
+		},
+		{
+			name:        "merged files select context by cluster name",
+			paths:       merged,
+			cluster:     "west-cluster",
+			wantContext: "west",
+			wantHost:    "https://west.example.com:6443",
+			wantToken:   "west-token",
+		},
+		{
+			name:        "context name wins over cluster name",
+			paths:       merged,
+			cluster:     "east-readonly",
+			wantContext: "east-readonly",
+			wantHost:    "https://east.example.com:6443",
+			wantToken:   "east-viewer-token",
+		},
+		{
+			name:    "cluster used by several contexts",
+			paths:   merged,
+			cluster: "east-cluster",
+			wantErr: `cluster "east-cluster" is used by several contexts [east east-readonly]`,
+		},
+		{
+			name:    "unknown cluster",
+			paths:   merged,
+			cluster: "north",
+			wantErr: `no context or cluster named "north" in kubeconfig (available contexts: [east east-readonly west])`,
+		},
+		{
+			name:        "missing file in a list is skipped",
+			paths:       strings.Join([]string{missing, west}, string(filepath.ListSeparator)),
+			wantContext: "west",
+			wantHost:    "https://west.example.com:6443",
+			wantToken:   "west-token",
+		},
+		{
+			name:    "missing single file",
+			paths:   missing,
+			wantErr: "failed to load kubeconfig",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, contextName, err := loadKubeconfig(tt.paths, tt.cluster)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadKubeconfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadKubeconfig() failed: %v", err)
+			}
+			if contextName != tt.wantContext {
+				t.Errorf("context = %q, want %q", contextName, tt.wantContext)
+			}
+			if config.Host != tt.wantHost {
+				t.Errorf("host = %q, want %q", config.Host, tt.wantHost)
+			}
+			if config.BearerToken != tt.wantToken {
+				t.Errorf("token = %q, want %q", config.BearerToken, tt.wantToken)
+			}
+		})
+	}
+}
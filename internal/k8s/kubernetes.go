@@ -1,40 +1,74 @@
 package k8s
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"sync"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+
+	"awx-deployer/internal/audit"
 )
 
 // KubernetesClient handles all Kubernetes operations using client-go
 type KubernetesClient struct {
 	clientset       kubernetes.Interface
 	dynamicClient   dynamic.Interface
-	discoveryClient *discovery.DiscoveryClient
+	discoveryClient discovery.DiscoveryInterface
+
+	// awxVersion caches the discovered AWX API version
+	awxVersion   string
+	awxVersionMu sync.Mutex
+
+	// auditLog records every mutation, nil when auditing is disabled
+	auditLog *audit.Log
+
+	// server is the API server URL and contextName the kubeconfig context
+	// used, empty in-cluster
+	server      string
+	contextName string
+
+	// preservedPrefixes are the label and annotation key prefixes kept
+	// from live objects on update
+	preservedPrefixes []string
+
+	// deletePropagation is the propagation policy of DeleteObject,
+	// DeleteCRD and DeletePersistentVolumeClaim, the deletes of the
+	// uninstall and the prune, empty for Background
+	deletePropagation metav1.DeletionPropagation
 }
 
-// NewKubernetesClient creates a new Kubernetes client using client-go
-func NewKubernetesClient(kubeconfigPath string) (*KubernetesClient, error) {
+// NewKubernetesClient creates a new Kubernetes client using client-go.
+// kubeconfigPath may list several colon-separated files which are merged,
+// and cluster selects a context or cluster from them. Without throttle the
+// client does not rate limit its requests.
+func NewKubernetesClient(kubeconfigPath, cluster string, throttle bool) (*KubernetesClient, error) {
 	var config *rest.Config
+	var contextName string
 	var err error
 
 	if kubeconfigPath != "" {
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+		config, contextName, err = loadKubeconfig(kubeconfigPath, cluster)
 		if err != nil {
-			return nil, fmt.Errorf("failed to build config from kubeconfig: %v", err)
+			return nil, err
 		}
 	} else {
 		config, err = rest.InClusterConfig()
@@ -42,6 +76,7 @@ func NewKubernetesClient(kubeconfigPath string) (*KubernetesClient, error) {
 			return nil, fmt.Errorf("failed to get in-cluster config: %v", err)
 		}
 	}
+	setRateLimit(config, throttle)
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -59,70 +94,310 @@ func NewKubernetesClient(kubeconfigPath string) (*KubernetesClient, error) {
 	}
 
 	return &KubernetesClient{
-		clientset:       clientset,
-		dynamicClient:   dynamicClient,
-		discoveryClient: discoveryClient,
+		clientset:         clientset,
+		dynamicClient:     dynamicClient,
+		discoveryClient:   discoveryClient,
+		server:            config.Host,
+		contextName:       contextName,
+		preservedPrefixes: DefaultPreservedPrefixes,
 	}, nil
 }
 
-// Apply applies a YAML manifest file
+// NewKubernetesClientForClients creates a new Kubernetes client on top of
+// existing clients, such as the fakes of client-go
+func NewKubernetesClientForClients(clientset kubernetes.Interface, dynamicClient dynamic.Interface, discoveryClient discovery.DiscoveryInterface) *KubernetesClient {
+	return &KubernetesClient{
+		clientset:         clientset,
+		dynamicClient:     dynamicClient,
+		discoveryClient:   discoveryClient,
+		preservedPrefixes: DefaultPreservedPrefixes,
+	}
+}
+
+// Clientset returns the typed clientset the client uses
+func (k *KubernetesClient) Clientset() kubernetes.Interface {
+	return k.clientset
+}
+
+// Server returns the URL of the API server the client talks to
+func (k *KubernetesClient) Server() string {
+	return k.server
+}
+
+// ContextName returns the kubeconfig context the client uses, or an empty
+// string when it runs in-cluster
+func (k *KubernetesClient) ContextName() string {
+	return k.contextName
+}
+
+// Apply applies all objects in a YAML manifest file
 func (k *KubernetesClient) Apply(ctx context.Context, manifestPath string) error {
 	manifestData, err := ioutil.ReadFile(manifestPath)
 	if err != nil {
 		return fmt.Errorf("failed to read manifest file %s: %v", manifestPath, err)
 	}
 
-	decoder := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
-	obj := &unstructured.Unstructured{}
-	_, gvk, err := decoder.Decode(manifestData, nil, obj)
+	objs, err := DecodeManifests(manifestData)
 	if err != nil {
 		return fmt.Errorf("failed to decode manifest %s: %v", manifestPath, err)
 	}
 
-	gvr, err := k.gvrForGVK(gvk)
-	if err != nil {
-		return fmt.Errorf("failed to get GVR for GVK %s: %v", gvk.String(), err)
+	for _, obj := range objs {
+		if err := k.ApplyObject(ctx, obj); err != nil {
+			return err
+		}
 	}
 
-	namespace := obj.GetNamespace()
-	if namespace == "" {
-		// some resources are cluster-wide and don't have a namespace
-		if gvr.Resource != "namespaces" && gvr.Resource != "persistentvolumes" {
-			namespace = "default"
+	return nil
+}
+
+// DecodeManifests decodes every YAML document in data into an unstructured object
+func DecodeManifests(data []byte) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		doc := map[string]interface{}{}
+		if err := decoder.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if len(doc) == 0 {
+			// empty document between separators
+			continue
 		}
+
+		obj := &unstructured.Unstructured{Object: doc}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("object %q is missing apiVersion or kind", obj.GetName())
+		}
+		objs = append(objs, obj)
 	}
 
-	var resource dynamic.ResourceInterface
-	if namespace != "" {
-		resource = k.dynamicClient.Resource(gvr).Namespace(namespace)
-	} else {
-		resource = k.dynamicClient.Resource(gvr)
+	return objs, nil
+}
+
+// ApplyObject creates an object or updates it if it already exists.
+// Secrets are merged with the existing secret, see OwnedKeysAnnotation, and
+// labels and annotations with a preserved prefix are kept from the existing
+// object, see SetPreservedPrefixes.
+// An update rejected because it changes immutable fields returns an
+// *ImmutableFieldError, an object whose kind or namespace does not exist
+// yet a *DependencyError.
+func (k *KubernetesClient) ApplyObject(ctx context.Context, obj *unstructured.Unstructured) error {
+	resource, err := k.resourceFor(obj)
+	if err != nil {
+		return err
+	}
+
+	if isSecret(obj) {
+		markOwnedSecretKeys(obj)
 	}
 
 	_, createErr := resource.Create(ctx, obj, metav1.CreateOptions{})
+	if !errors.IsAlreadyExists(createErr) {
+		k.record("create", resource, obj.GetName(), createErr)
+	}
 	if createErr != nil {
 		if errors.IsAlreadyExists(createErr) {
 			existingObj, getErr := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
 			if getErr != nil {
 				return fmt.Errorf("failed to get existing resource %s: %v", obj.GetName(), getErr)
 			}
+			if isSecret(obj) {
+				// keep keys added by others, like the operator
+				if err := mergeSecretData(obj, existingObj); err != nil {
+					return fmt.Errorf("failed to merge secret %s: %v", obj.GetName(), err)
+				}
+			}
+			labels, annotations := k.preserveMetadata(obj.GetLabels(), existingObj.GetLabels(), obj.GetAnnotations(), existingObj.GetAnnotations())
+			obj.SetLabels(labels)
+			obj.SetAnnotations(annotations)
 			obj.SetResourceVersion(existingObj.GetResourceVersion())
 			_, updateErr := resource.Update(ctx, obj, metav1.UpdateOptions{})
+			k.record("update", resource, obj.GetName(), updateErr)
 			if updateErr != nil {
+				if fields := immutableFields(updateErr); len(fields) > 0 {
+					return &ImmutableFieldError{Kind: obj.GetKind(), Name: obj.GetName(), Fields: fields, Err: updateErr}
+				}
 				return fmt.Errorf("failed to update resource %s: %v", obj.GetName(), updateErr)
 			}
 			return nil
 		}
-		return fmt.Errorf("failed to create resource %s: %v", obj.GetName(), createErr)
+		return dependencyError(createErr, fmt.Errorf("failed to create resource %s: %v", obj.GetName(), createErr))
+	}
+
+	return nil
+}
+
+// RecreateObject deletes an existing object, waits for it to be gone and
+// creates it again. This is the only way to change immutable fields.
+func (k *KubernetesClient) RecreateObject(ctx context.Context, obj *unstructured.Unstructured) error {
+	resource, err := k.resourceFor(obj)
+	if err != nil {
+		return err
+	}
+
+	if err := k.deleteResource(ctx, resource, obj.GetName(), metav1.DeleteOptions{}); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	timeout := time.After(2 * time.Minute)
+
+	for {
+		_, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return fmt.Errorf("timeout waiting for resource %s to be deleted", obj.GetName())
+		case <-ctx.Done():
+			return fmt.Errorf("context cancelled waiting for resource %s to be deleted", obj.GetName())
+		}
+	}
+
+	obj.SetResourceVersion("")
+	_, err = resource.Create(ctx, obj, metav1.CreateOptions{})
+	k.record("create", resource, obj.GetName(), err)
+	if err != nil {
+		return fmt.Errorf("failed to recreate resource %s: %v", obj.GetName(), err)
+	}
+	return nil
+}
+
+// DeleteObject deletes an object. An object that is already gone is not an error.
+func (k *KubernetesClient) DeleteObject(ctx context.Context, obj *unstructured.Unstructured) error {
+	resource, err := k.resourceFor(obj)
+	if err != nil {
+		return err
+	}
+	return k.deleteResource(ctx, resource, obj.GetName(), k.deleteOptions())
+}
+
+// deleteResource deletes and audits a resource. A resource that is already
+// gone is not an error and not audited.
+func (k *KubernetesClient) deleteResource(ctx context.Context, resource *objectResource, name string, options metav1.DeleteOptions) error {
+	err := resource.Delete(ctx, name, options)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	k.record("delete", resource, name, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete resource %s: %v", name, err)
+	}
+	return nil
+}
+
+// GetObject gets the current state of an object, or nil if it does not exist
+func (k *KubernetesClient) GetObject(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	resource, err := k.resourceFor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get resource %s: %v", obj.GetName(), err)
+	}
+	return current, nil
+}
+
+// RemoveFinalizers clears the finalizers of an object so a pending deletion
+// can complete without the controller that owns them
+func (k *KubernetesClient) RemoveFinalizers(ctx context.Context, obj *unstructured.Unstructured) error {
+	resource, err := k.resourceFor(obj)
+	if err != nil {
+		return err
 	}
 
+	patch := []byte(`{"metadata":{"finalizers":null}}`)
+	_, err = resource.Patch(ctx, obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	k.record("patch", resource, obj.GetName(), err)
+	if err != nil {
+		return fmt.Errorf("failed to remove finalizers of resource %s: %v", obj.GetName(), err)
+	}
 	return nil
 }
 
-func (k *KubernetesClient) gvrForGVK(gvk *schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+// objectResource is the dynamic client interface for an object's resource
+// and namespace, with the resource and namespace it addresses
+type objectResource struct {
+	dynamic.ResourceInterface
+	gvr       schema.GroupVersionResource
+	namespace string
+}
+
+// resourceFor returns the dynamic client interface for an object's resource
+// and namespace
+func (k *KubernetesClient) resourceFor(obj *unstructured.Unstructured) (*objectResource, error) {
+	gvk := obj.GroupVersionKind()
+	gvr, namespaced, err := k.gvrForGVK(&gvk)
+	if err != nil {
+		if IsDependencyError(err) {
+			return nil, &DependencyError{Err: fmt.Errorf("failed to get GVR for GVK %s: %v", gvk.String(), err)}
+		}
+		return nil, fmt.Errorf("failed to get GVR for GVK %s: %v", gvk.String(), err)
+	}
+
+	// cluster-wide resources don't have a namespace
+	namespace := ""
+	if namespaced {
+		namespace = obj.GetNamespace()
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+
+	if namespace != "" {
+		return &objectResource{k.dynamicClient.Resource(gvr).Namespace(namespace), gvr, namespace}, nil
+	}
+	return &objectResource{k.dynamicClient.Resource(gvr), gvr, ""}, nil
+}
+
+// ObjectResource returns the resource and namespace an object is applied to
+func (k *KubernetesClient) ObjectResource(obj *unstructured.Unstructured) (schema.GroupVersionResource, string, error) {
+	resource, err := k.resourceFor(obj)
+	if err != nil {
+		return schema.GroupVersionResource{}, "", err
+	}
+	return resource.gvr, resource.namespace, nil
+}
+
+// IsNamespaced reports whether objects of a kind live in a namespace. A
+// kind the server does not serve returns a *DependencyError.
+func (k *KubernetesClient) IsNamespaced(gvk schema.GroupVersionKind) (bool, error) {
+	apiResourceList, err := k.discoveryClient.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	if err != nil {
+		return false, dependencyError(err, fmt.Errorf("failed to discover resources of %s: %v", gvk.GroupVersion(), err))
+	}
+
+	for _, apiResource := range apiResourceList.APIResources {
+		if apiResource.Kind == gvk.Kind {
+			return apiResource.Namespaced, nil
+		}
+	}
+	return false, &DependencyError{Err: fmt.Errorf("resource not found for GVK %s", gvk.String())}
+}
+
+// gvrForGVK returns the resource of a kind and whether it is namespaced. A
+// kind the server does not serve returns a *DependencyError.
+func (k *KubernetesClient) gvrForGVK(gvk *schema.GroupVersionKind) (schema.GroupVersionResource, bool, error) {
 	apiResourceList, err := k.discoveryClient.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
 	if err != nil {
-		return schema.GroupVersionResource{}, err
+		return schema.GroupVersionResource{}, false, dependencyError(err, err)
 	}
 
 	for _, apiResource := range apiResourceList.APIResources {
@@ -131,11 +406,11 @@ func (k *KubernetesClient) gvrForGVK(gvk *schema.GroupVersionKind) (schema.Group
 				Group:    gvk.Group,
 				Version:  gvk.Version,
 				Resource: apiResource.Name,
-			}, nil
+			}, apiResource.Namespaced, nil
 		}
 	}
 
-	return schema.GroupVersionResource{}, fmt.Errorf("resource not found for GVK %s", gvk.String())
+	return schema.GroupVersionResource{}, false, &DependencyError{Err: fmt.Errorf("resource not found for GVK %s", gvk.String())}
 }
 
 // ApplyKustomize is deprecated and will be removed.
@@ -162,55 +437,167 @@ func (k *KubernetesClient) ResourceExists(ctx context.Context, group, version, r
 	return true, nil
 }
 
-// WaitForDeployment waits for a deployment to be ready
-func (k *KubernetesClient) WaitForDeployment(ctx context.Context, deploymentName, namespace string) error {
-	watcher, err := k.clientset.AppsV1().Deployments(namespace).Watch(ctx, metav1.ListOptions{FieldSelector: "metadata.name=" + deploymentName})
+// WaitForDeployment waits up to timeout for a deployment to be Available
+func (k *KubernetesClient) WaitForDeployment(ctx context.Context, deploymentName, namespace string, timeout time.Duration) error {
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	_, err := k.WaitForCondition(ctx, gvr, deploymentName, namespace, string(appsv1.DeploymentAvailable), "True", timeout)
+	return err
+}
+
+// WaitForStatefulSet waits up to timeout for a stateful set to have all its
+// replicas ready on its current revision, see StatefulSetReady
+func (k *KubernetesClient) WaitForStatefulSet(ctx context.Context, statefulSetName, namespace string, timeout time.Duration) error {
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
+	ready := func(obj *unstructured.Unstructured) (bool, error) {
+		statefulSet := &appsv1.StatefulSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, statefulSet); err != nil {
+			return false, fmt.Errorf("failed to decode stateful set %s: %v", statefulSetName, err)
+		}
+		return StatefulSetReady(statefulSet), nil
+	}
+	_, err := k.WaitFor(ctx, gvr, statefulSetName, namespace, "all replicas ready", ready, timeout)
+	return err
+}
+
+// StatefulSetReady reports whether a stateful set has rolled out: the
+// controller has seen its latest spec and all replicas are ready and on the
+// update revision. A stateful set scaled to zero is not ready.
+func StatefulSetReady(statefulSet *appsv1.StatefulSet) bool {
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	status := statefulSet.Status
+	return replicas > 0 &&
+		status.ObservedGeneration >= statefulSet.Generation &&
+		status.ReadyReplicas == replicas &&
+		status.UpdatedReplicas == replicas &&
+		status.CurrentRevision == status.UpdateRevision
+}
+
+// PodStatus aggregates the status of the pods matching a selector
+type PodStatus struct {
+	// Phase is the phase of the first pod that is not ready, or Running
+	// when all pods are ready
+	Phase string
+	// Pods is the number of pods, excluding terminating ones
+	Pods int
+	// ReadyPods is the number of pods whose PodReady condition is True
+	ReadyPods int
+}
+
+// Ready reports whether there is at least one pod and every pod passes its
+// readiness probes. A Running pod is not ready until all its containers are.
+func (s PodStatus) Ready() bool {
+	return s.Pods > 0 && s.ReadyPods == s.Pods
+}
+
+func (s PodStatus) String() string {
+	if s.Pods == 0 {
+		return "No pods found"
+	}
+	return fmt.Sprintf("%s, %d/%d ready", s.Phase, s.ReadyPods, s.Pods)
+}
+
+// GetDeployment gets a deployment by name
+func (k *KubernetesClient) GetDeployment(ctx context.Context, name, namespace string) (*appsv1.Deployment, error) {
+	deployment, err := k.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to watch deployment: %v", err)
+		return nil, fmt.Errorf("failed to get deployment %s: %v", name, err)
 	}
-	defer watcher.Stop()
+	return deployment, nil
+}
 
-	ch := watcher.ResultChan()
-	timeout := time.After(15 * time.Minute) // 15 minute timeout, configurable?
+// RolloutStatus describes the rollout of a deployment like kubectl rollout
+// status, e.g. "Waiting for deployment rollout to finish: 1 of 2 updated
+// replicas are available...", and reports whether it has finished. A
+// rollout past its progress deadline is returned as an error.
+func (k *KubernetesClient) RolloutStatus(ctx context.Context, name, namespace string) (string, bool, error) {
+	deployment, err := k.GetDeployment(ctx, name, namespace)
+	if err != nil {
+		return "", false, err
+	}
+	return deploymentRolloutStatus(deployment)
+}
 
-	for {
-		select {
-		case event, ok := <-ch:
-			if !ok {
-				// Channel closed, something went wrong.
-				return fmt.Errorf("watcher channel closed for deployment %s", deploymentName)
-			}
-			deployment, ok := event.Object.(*appsv1.Deployment)
-			if !ok {
-				continue
-			}
+// deploymentRolloutStatus computes the rollout status of a deployment from
+// its status fields
+func deploymentRolloutStatus(deployment *appsv1.Deployment) (string, bool, error) {
+	status := deployment.Status
+	if deployment.Generation > status.ObservedGeneration {
+		return "Waiting for deployment spec update to be observed...", false, nil
+	}
 
-			for _, cond := range deployment.Status.Conditions {
-				if cond.Type == appsv1.DeploymentAvailable && cond.Status == "True" {
-					return nil
-				}
-			}
-		case <-timeout:
-			return fmt.Errorf("timeout waiting for deployment %s to be ready", deploymentName)
-		case <-ctx.Done():
-			return fmt.Errorf("context cancelled waiting for deployment to be ready")
+	for _, condition := range status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return "", false, fmt.Errorf("deployment %s exceeded its progress deadline", deployment.Name)
 		}
 	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	switch {
+	case status.UpdatedReplicas < replicas:
+		return fmt.Sprintf("Waiting for deployment rollout to finish: %d out of %d new replicas have been updated...", status.UpdatedReplicas, replicas), false, nil
+	case status.Replicas > status.UpdatedReplicas:
+		return fmt.Sprintf("Waiting for deployment rollout to finish: %d old replicas are pending termination...", status.Replicas-status.UpdatedReplicas), false, nil
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		return fmt.Sprintf("Waiting for deployment rollout to finish: %d of %d updated replicas are available...", status.AvailableReplicas, status.UpdatedReplicas), false, nil
+	}
+	return fmt.Sprintf("deployment %s successfully rolled out", deployment.Name), true, nil
 }
 
-// GetPodStatus gets the status of pods with a given label selector
-func (k *KubernetesClient) GetPodStatus(ctx context.Context, labelSelector, namespace string) (string, error) {
+// GetStatefulSet gets a stateful set by name
+func (k *KubernetesClient) GetStatefulSet(ctx context.Context, name, namespace string) (*appsv1.StatefulSet, error) {
+	statefulSet, err := k.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stateful set %s: %v", name, err)
+	}
+	return statefulSet, nil
+}
+
+// GetPodStatus gets the aggregate status of pods with a given label selector
+func (k *KubernetesClient) GetPodStatus(ctx context.Context, labelSelector, namespace string) (PodStatus, error) {
 	pods, err := k.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
 	if err != nil {
-		return "", fmt.Errorf("failed to list pods: %v", err)
+		return PodStatus{}, fmt.Errorf("failed to list pods: %v", err)
 	}
+	return SummarizePods(pods.Items), nil
+}
 
-	if len(pods.Items) == 0 {
-		return "No pods found", nil
+// SummarizePods returns the aggregate status of pods
+func SummarizePods(pods []corev1.Pod) PodStatus {
+	status := PodStatus{Phase: string(corev1.PodRunning)}
+	notReadyPhase := ""
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			// pods of a previous rollout that are shutting down
+			continue
+		}
+
+		status.Pods++
+		if podReady(pod) {
+			status.ReadyPods++
+		} else if notReadyPhase == "" {
+			notReadyPhase = string(pod.Status.Phase)
+		}
 	}
+	if notReadyPhase != "" {
+		status.Phase = notReadyPhase
+	}
+	return status
+}
 
-	// For simplicity, returning the phase of the first pod.
-	return string(pods.Items[0].Status.Phase), nil
+// podReady reports whether a pod's PodReady condition is True
+func podReady(pod corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
 }
 
 // GetIngressStatus gets the status of an ingress
@@ -221,8 +608,374 @@ func (k *KubernetesClient) GetIngressStatus(ctx context.Context, ingressName, na
 	}
 
 	if len(ingress.Status.LoadBalancer.Ingress) > 0 {
-		return ingress.Status.LoadBalancer.Ingress[0].Hostname, nil
+		lb := ingress.Status.LoadBalancer.Ingress[0]
+		if lb.Hostname != "" {
+			return lb.Hostname, nil
+		}
+		return lb.IP, nil
 	}
 
 	return "Pending", nil
 }
+
+// EnsureNamespace creates the namespace with the given labels if it does not
+// already exist. The labels of an existing namespace are left alone.
+func (k *KubernetesClient) EnsureNamespace(ctx context.Context, name string, labels map[string]string) error {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	_, err := k.clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	k.auditLog.Record("create", corev1.SchemeGroupVersion.WithResource("namespaces"), "", name, err)
+	if err != nil {
+		return fmt.Errorf("failed to create namespace %s: %v", name, err)
+	}
+	return nil
+}
+
+// GetNamespace gets a namespace by name, or returns nil if it does not exist
+func (k *KubernetesClient) GetNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	ns, err := k.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace %s: %v", name, err)
+	}
+	return ns, nil
+}
+
+// ApplySecret creates a secret or updates it if it already exists. Keys of
+// the existing secret that were not written by the deployer are kept.
+func (k *KubernetesClient) ApplySecret(ctx context.Context, secret *corev1.Secret) error {
+	secrets := k.clientset.CoreV1().Secrets(secret.Namespace)
+	markOwnedTypedSecretKeys(secret)
+
+	secretsResource := corev1.SchemeGroupVersion.WithResource("secrets")
+	_, createErr := secrets.Create(ctx, secret, metav1.CreateOptions{})
+	if !errors.IsAlreadyExists(createErr) {
+		k.auditLog.Record("create", secretsResource, secret.Namespace, secret.Name, createErr)
+	}
+	if createErr == nil {
+		return nil
+	}
+	if !errors.IsAlreadyExists(createErr) {
+		return fmt.Errorf("failed to create secret %s: %v", secret.Name, createErr)
+	}
+
+	existing, err := secrets.Get(ctx, secret.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get existing secret %s: %v", secret.Name, err)
+	}
+	mergeTypedSecretData(secret, existing)
+	secret.Labels, secret.Annotations = k.preserveMetadata(secret.Labels, existing.Labels, secret.Annotations, existing.Annotations)
+	secret.ResourceVersion = existing.ResourceVersion
+	_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	k.auditLog.Record("update", secretsResource, secret.Namespace, secret.Name, err)
+	if err != nil {
+		return fmt.Errorf("failed to update secret %s: %v", secret.Name, err)
+	}
+	return nil
+}
+
+// GetResource gets a Kubernetes resource as an unstructured object
+func (k *KubernetesClient) GetResource(ctx context.Context, group, version, resource, name, namespace string) (*unstructured.Unstructured, error) {
+	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
+	var obj *unstructured.Unstructured
+	var err error
+	if namespace != "" {
+		obj, err = k.dynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	} else {
+		obj, err = k.dynamicClient.Resource(gvr).Get(ctx, name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource %s/%s: %v", resource, name, err)
+	}
+	return obj, nil
+}
+
+// ListResources lists the Kubernetes resources of a kind in a namespace, or
+// in all namespaces if namespace is empty
+func (k *KubernetesClient) ListResources(ctx context.Context, group, version, resource, namespace string) ([]unstructured.Unstructured, error) {
+	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
+	list, err := k.dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", resource, err)
+	}
+	return list.Items, nil
+}
+
+// ListObjects lists the objects of a kind matching a label selector, in a
+// namespace or cluster-wide for cluster-scoped kinds. A kind the server does
+// not serve returns a *DependencyError.
+func (k *KubernetesClient) ListObjects(ctx context.Context, gvk schema.GroupVersionKind, namespace, labelSelector string) ([]unstructured.Unstructured, error) {
+	gvr, namespaced, err := k.gvrForGVK(&gvk)
+	if err != nil {
+		if IsDependencyError(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get GVR for GVK %s: %v", gvk.String(), err)
+	}
+
+	var resource dynamic.ResourceInterface = k.dynamicClient.Resource(gvr)
+	if namespaced {
+		resource = k.dynamicClient.Resource(gvr).Namespace(namespace)
+	}
+	list, err := resource.List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", gvr.Resource, err)
+	}
+	return list.Items, nil
+}
+
+// GetPodLogs returns the last tailLines lines of a container's logs from the
+// first pod matching the label selector
+func (k *KubernetesClient) GetPodLogs(ctx context.Context, labelSelector, namespace, container string, tailLines int64) (string, error) {
+	return k.GetPodLogsSince(ctx, labelSelector, namespace, container, tailLines, time.Time{})
+}
+
+// GetPodLogsSince is GetPodLogs for the lines logged since a time, or all
+// of them if it is zero
+func (k *KubernetesClient) GetPodLogsSince(ctx context.Context, labelSelector, namespace, container string, tailLines int64, since time.Time) (string, error) {
+	pods, err := k.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return "", fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("no pods found for selector %s", labelSelector)
+	}
+
+	opts := &corev1.PodLogOptions{Container: container, TailLines: &tailLines}
+	if !since.IsZero() {
+		opts.SinceTime = &metav1.Time{Time: since}
+	}
+	data, err := k.clientset.CoreV1().Pods(namespace).GetLogs(pods.Items[0].Name, opts).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs for pod %s: %v", pods.Items[0].Name, err)
+	}
+	return string(data), nil
+}
+
+// ListPods lists the pods in a namespace matching the label selector
+func (k *KubernetesClient) ListPods(ctx context.Context, labelSelector, namespace string) ([]corev1.Pod, error) {
+	pods, err := k.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	return pods.Items, nil
+}
+
+// CreatePod creates a pod
+func (k *KubernetesClient) CreatePod(ctx context.Context, pod *corev1.Pod) error {
+	_, err := k.clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	k.auditLog.Record("create", corev1.SchemeGroupVersion.WithResource("pods"), pod.Namespace, pod.Name, err)
+	if err != nil {
+		return fmt.Errorf("failed to create pod %s: %v", pod.Name, err)
+	}
+	return nil
+}
+
+// CreateEvent records a Kubernetes Event
+func (k *KubernetesClient) CreateEvent(ctx context.Context, event *corev1.Event) error {
+	_, err := k.clientset.CoreV1().Events(event.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	k.auditLog.Record("create", corev1.SchemeGroupVersion.WithResource("events"), event.Namespace, event.Name, err)
+	if err != nil {
+		return fmt.Errorf("failed to create event %s: %v", event.Name, err)
+	}
+	return nil
+}
+
+// GetPod gets a pod by name
+func (k *KubernetesClient) GetPod(ctx context.Context, name, namespace string) (*corev1.Pod, error) {
+	pod, err := k.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s: %v", name, err)
+	}
+	return pod, nil
+}
+
+// DeletePod deletes a pod. A pod that is already gone is not an error.
+func (k *KubernetesClient) DeletePod(ctx context.Context, name, namespace string) error {
+	err := k.clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	k.auditLog.Record("delete", corev1.SchemeGroupVersion.WithResource("pods"), namespace, name, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete pod %s: %v", name, err)
+	}
+	return nil
+}
+
+// CreateJob creates a job
+func (k *KubernetesClient) CreateJob(ctx context.Context, job *batchv1.Job) error {
+	_, err := k.clientset.BatchV1().Jobs(job.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	k.auditLog.Record("create", batchv1.SchemeGroupVersion.WithResource("jobs"), job.Namespace, job.Name, err)
+	if err != nil {
+		return fmt.Errorf("failed to create job %s: %v", job.Name, err)
+	}
+	return nil
+}
+
+// GetJob gets a job by name
+func (k *KubernetesClient) GetJob(ctx context.Context, name, namespace string) (*batchv1.Job, error) {
+	job, err := k.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job %s: %v", name, err)
+	}
+	return job, nil
+}
+
+// DeleteJob deletes a job and its pods. A job that is already gone is not an error.
+func (k *KubernetesClient) DeleteJob(ctx context.Context, name, namespace string) error {
+	propagation := metav1.DeletePropagationBackground
+	err := k.clientset.BatchV1().Jobs(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	k.auditLog.Record("delete", batchv1.SchemeGroupVersion.WithResource("jobs"), namespace, name, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete job %s: %v", name, err)
+	}
+	return nil
+}
+
+// ListEvents lists the events in a namespace matching the field selector
+func (k *KubernetesClient) ListEvents(ctx context.Context, fieldSelector, namespace string) ([]corev1.Event, error) {
+	events, err := k.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: fieldSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %v", err)
+	}
+	return events.Items, nil
+}
+
+// ListPersistentVolumeClaims lists the persistent volume claims in a namespace
+func (k *KubernetesClient) ListPersistentVolumeClaims(ctx context.Context, namespace string) ([]corev1.PersistentVolumeClaim, error) {
+	pvcs, err := k.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volume claims: %v", err)
+	}
+	return pvcs.Items, nil
+}
+
+// DeletePersistentVolumeClaim deletes a persistent volume claim. A claim
+// that is already gone is not an error.
+func (k *KubernetesClient) DeletePersistentVolumeClaim(ctx context.Context, name, namespace string) error {
+	err := k.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, k.deleteOptions())
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	k.auditLog.Record("delete", corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims"), namespace, name, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete persistent volume claim %s: %v", name, err)
+	}
+	return nil
+}
+
+// GetSecret gets a secret by name
+func (k *KubernetesClient) GetSecret(ctx context.Context, name, namespace string) (*corev1.Secret, error) {
+	secret, err := k.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %v", name, err)
+	}
+	return secret, nil
+}
+
+// DeleteSecret deletes a secret. A secret that is already gone is not an
+// error.
+func (k *KubernetesClient) DeleteSecret(ctx context.Context, name, namespace string) error {
+	err := k.clientset.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	k.auditLog.Record("delete", corev1.SchemeGroupVersion.WithResource("secrets"), namespace, name, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete secret %s: %v", name, err)
+	}
+	return nil
+}
+
+// GetService gets a service by name
+func (k *KubernetesClient) GetService(ctx context.Context, name, namespace string) (*corev1.Service, error) {
+	service, err := k.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service %s: %v", name, err)
+	}
+	return service, nil
+}
+
+// ListRoleBindings lists the role bindings in a namespace
+func (k *KubernetesClient) ListRoleBindings(ctx context.Context, namespace string) ([]rbacv1.RoleBinding, error) {
+	bindings, err := k.clientset.RbacV1().RoleBindings(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role bindings: %v", err)
+	}
+	return bindings.Items, nil
+}
+
+// ListClusterRoleBindings lists the cluster role bindings
+func (k *KubernetesClient) ListClusterRoleBindings(ctx context.Context) ([]rbacv1.ClusterRoleBinding, error) {
+	bindings, err := k.clientset.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster role bindings: %v", err)
+	}
+	return bindings.Items, nil
+}
+
+// ListNodes lists the nodes of the cluster
+func (k *KubernetesClient) ListNodes(ctx context.Context) ([]corev1.Node, error) {
+	nodes, err := k.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	return nodes.Items, nil
+}
+
+// CRDGroupVersionResource is the resource of CustomResourceDefinitions
+var CRDGroupVersionResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// CRDName returns the name of the CustomResourceDefinition for the given
+// group and kind, or an empty string if none is registered
+func (k *KubernetesClient) CRDName(ctx context.Context, group, kind string) (string, error) {
+	crds, err := k.dynamicClient.Resource(CRDGroupVersionResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list custom resource definitions: %v", err)
+	}
+
+	for _, crd := range crds.Items {
+		crdGroup, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		crdKind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		if crdGroup == group && crdKind == kind {
+			return crd.GetName(), nil
+		}
+	}
+
+	return "", nil
+}
+
+// PatchResource patches a Kubernetes resource and returns the patched object
+func (k *KubernetesClient) PatchResource(ctx context.Context, group, version, resource, name, namespace string, patchType types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
+	var obj *unstructured.Unstructured
+	var err error
+	if namespace != "" {
+		obj, err = k.dynamicClient.Resource(gvr).Namespace(namespace).Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+	} else {
+		obj, err = k.dynamicClient.Resource(gvr).Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+	}
+	k.auditLog.Record("patch", gvr, namespace, name, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch resource %s/%s: %v", resource, name, err)
+	}
+	return obj, nil
+}
+
+// ServerVersion returns the Kubernetes version of the API server
+func (k *KubernetesClient) ServerVersion() (string, error) {
+	info, err := k.discoveryClient.ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("failed to get server version: %v", err)
+	}
+	return info.GitVersion, nil
+}
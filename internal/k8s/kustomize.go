@@ -0,0 +1,46 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// HasKustomization reports whether dir holds a kustomization file
+func HasKustomization(dir string) bool {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderKustomization builds the kustomization in dir like kustomize build
+// does, with plugins disabled and files outside dir only reachable through
+// its bases, and decodes the result
+func RenderKustomization(dir string) ([]*unstructured.Unstructured, error) {
+	if !HasKustomization(dir) {
+		return nil, fmt.Errorf("no kustomization file found in %s", dir)
+	}
+
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build kustomization %s: %v", dir, err)
+	}
+	data, err := resources.AsYaml()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render kustomization %s: %v", dir, err)
+	}
+
+	objs, err := DecodeManifests(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode kustomization %s: %v", dir, err)
+	}
+	return objs, nil
+}
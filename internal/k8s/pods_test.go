@@ -0,0 +1,105 @@
+package k8s_test
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// webPod returns an AWX web pod in the given phase, with its PodReady
+// condition set to ready unless it is nil
+func webPod(name string, phase corev1.PodPhase, ready *bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "awx", Labels: map[string]string{"app.kubernetes.io/component": "web"}},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+	if ready != nil {
+		status := corev1.ConditionFalse
+		if *ready {
+			status = corev1.ConditionTrue
+		}
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+	}
+	return pod
+}
+
+func TestGetPodStatus(t *testing.T) {
+	ready, notReady := true, false
+	terminating := webPod("awx-web-old", corev1.PodRunning, &notReady)
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+
+	tests := []struct {
+		name      string
+		pods      []runtime.Object
+		want      k8s.PodStatus
+		wantReady bool
+		wantText  string
+	}{
+		{
+			name:     "no pods",
+			want:     k8s.PodStatus{Phase: "Running"},
+			wantText: "No pods found",
+		},
+		{
+			name:      "running and ready",
+			pods:      []runtime.Object{webPod("awx-web-1", corev1.PodRunning, &ready)},
+			want:      k8s.PodStatus{Phase: "Running", Pods: 1, ReadyPods: 1},
+			wantReady: true,
+			wantText:  "Running, 1/1 ready",
+		},
+		{
+			name:     "running but readiness probe failing",
+			pods:     []runtime.Object{webPod("awx-web-1", corev1.PodRunning, &notReady)},
+			want:     k8s.PodStatus{Phase: "Running", Pods: 1},
+			wantText: "Running, 0/1 ready",
+		},
+		{
+			name:     "running without a PodReady condition",
+			pods:     []runtime.Object{webPod("awx-web-1", corev1.PodRunning, nil)},
+			want:     k8s.PodStatus{Phase: "Running", Pods: 1},
+			wantText: "Running, 0/1 ready",
+		},
+		{
+			name: "one of two ready",
+			pods: []runtime.Object{
+				webPod("awx-web-1", corev1.PodRunning, &ready),
+				webPod("awx-web-2", corev1.PodPending, nil),
+			},
+			want:     k8s.PodStatus{Phase: "Pending", Pods: 2, ReadyPods: 1},
+			wantText: "Pending, 1/2 ready",
+		},
+		{
+			name:      "terminating pod of a previous rollout",
+			pods:      []runtime.Object{webPod("awx-web-1", corev1.PodRunning, &ready), terminating},
+			want:      k8s.PodStatus{Phase: "Running", Pods: 1, ReadyPods: 1},
+			wantReady: true,
+			wantText:  "Running, 1/1 ready",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.pods...)
+			status, err := cluster.Client.GetPodStatus(context.Background(), "app.kubernetes.io/component=web", "awx")
+			if err != nil {
+				t.Fatalf("GetPodStatus() failed: %v", err)
+			}
+			if status != tt.want {
+				t.Errorf("GetPodStatus() = %+v, want %+v", status, tt.want)
+			}
+			if status.Ready() != tt.wantReady {
+				t.Errorf("Ready() = %v, want %v", status.Ready(), tt.wantReady)
+			}
+			if status.String() != tt.wantText {
+				t.Errorf("String() = %q, want %q", status.String(), tt.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package k8s
+
+import (
+	"strings"
+)
+
+// DefaultPreservedPrefixes are the label and annotation key prefixes kept
+// from the live object on update unless SetPreservedPrefixes says otherwise
+var DefaultPreservedPrefixes = []string{"kubectl.kubernetes.io/", "awx.ansible.com/"}
+
+// SetPreservedPrefixes sets the label and annotation key prefixes whose
+// entries on a live object survive an update that does not set them. Others
+// would be dropped by the update, like labels added by users or operators.
+func (k *KubernetesClient) SetPreservedPrefixes(prefixes []string) {
+	k.preservedPrefixes = prefixes
+}
+
+// preserveMetadata copies the labels and annotations with a preserved prefix
+// from the live object into the desired ones where the desired object does
+// not set them, and returns the results
+func (k *KubernetesClient) preserveMetadata(desiredLabels, liveLabels, desiredAnnotations, liveAnnotations map[string]string) (map[string]string, map[string]string) {
+	return k.preserveKeys(desiredLabels, liveLabels), k.preserveKeys(desiredAnnotations, liveAnnotations)
+}
+
+// preserveKeys merges the preserved keys of live into desired
+func (k *KubernetesClient) preserveKeys(desired, live map[string]string) map[string]string {
+	for key, value := range live {
+		if _, set := desired[key]; set || !hasAnyPrefix(key, k.preservedPrefixes) {
+			continue
+		}
+		if desired == nil {
+			desired = make(map[string]string)
+		}
+		desired[key] = value
+	}
+	return desired
+}
+
+// hasAnyPrefix reports whether s starts with one of the prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
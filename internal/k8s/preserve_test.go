@@ -0,0 +1,106 @@
+package k8s_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// settingsConfigMap returns the AWX settings ConfigMap with the given labels
+// and annotations
+func settingsConfigMap(labels, annotations map[string]string) *unstructured.Unstructured {
+	obj := k8stest.Object("v1", "ConfigMap", "awx", "awx-settings")
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+	return obj
+}
+
+func TestApplyObjectPreservesMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		// prefixes replace the default preserved prefixes unless nil
+		prefixes        []string
+		live            *unstructured.Unstructured
+		desired         *unstructured.Unstructured
+		wantLabels      map[string]string
+		wantAnnotations map[string]string
+	}{
+		{
+			name:       "new object",
+			desired:    settingsConfigMap(map[string]string{"app": "awx"}, nil),
+			wantLabels: map[string]string{"app": "awx"},
+		},
+		{
+			name: "preserved annotations survive",
+			live: settingsConfigMap(nil, map[string]string{
+				"kubectl.kubernetes.io/restartedAt": "2026-10-01T08:00:00Z",
+				"awx.ansible.com/backup":            "nightly",
+				"team":                              "platform",
+			}),
+			desired: settingsConfigMap(nil, map[string]string{"description": "AWX settings"}),
+			wantAnnotations: map[string]string{
+				"kubectl.kubernetes.io/restartedAt": "2026-10-01T08:00:00Z",
+				"awx.ansible.com/backup":            "nightly",
+				"description":                       "AWX settings",
+			},
+		},
+		{
+			name:       "preserved labels survive",
+			live:       settingsConfigMap(map[string]string{"awx.ansible.com/managed": "yes", "env": "prod"}, nil),
+			desired:    settingsConfigMap(map[string]string{"app": "awx"}, nil),
+			wantLabels: map[string]string{"app": "awx", "awx.ansible.com/managed": "yes"},
+		},
+		{
+			name:            "desired value wins",
+			live:            settingsConfigMap(nil, map[string]string{"awx.ansible.com/backup": "nightly"}),
+			desired:         settingsConfigMap(nil, map[string]string{"awx.ansible.com/backup": "weekly"}),
+			wantAnnotations: map[string]string{"awx.ansible.com/backup": "weekly"},
+		},
+		{
+			name:            "custom prefixes",
+			prefixes:        []string{"example.com/"},
+			live:            settingsConfigMap(nil, map[string]string{"example.com/owner": "ops", "kubectl.kubernetes.io/restartedAt": "2026-10-01T08:00:00Z"}),
+			desired:         settingsConfigMap(nil, nil),
+			wantAnnotations: map[string]string{"example.com/owner": "ops"},
+		},
+		{
+			name:     "preservation disabled",
+			prefixes: []string{},
+			live:     settingsConfigMap(map[string]string{"awx.ansible.com/managed": "yes"}, map[string]string{"kubectl.kubernetes.io/restartedAt": "2026-10-01T08:00:00Z"}),
+			desired:  settingsConfigMap(nil, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.live != nil {
+				objects = append(objects, tt.live)
+			}
+			cluster := k8stest.NewCluster(objects...)
+			if tt.prefixes != nil {
+				cluster.Client.SetPreservedPrefixes(tt.prefixes)
+			}
+
+			if err := cluster.Client.ApplyObject(context.Background(), tt.desired); err != nil {
+				t.Fatalf("ApplyObject() failed: %v", err)
+			}
+
+			current, err := cluster.Client.GetObject(context.Background(), settingsConfigMap(nil, nil))
+			if err != nil || current == nil {
+				t.Fatalf("GetObject() = %v, %v", current, err)
+			}
+			if labels := current.GetLabels(); !reflect.DeepEqual(labels, tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", labels, tt.wantLabels)
+			}
+			if annotations := current.GetAnnotations(); !reflect.DeepEqual(annotations, tt.wantAnnotations) {
+				t.Errorf("annotations = %v, want %v", annotations, tt.wantAnnotations)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package k8s
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SetDeletePropagation sets what the deletes of the uninstall and the prune,
+// DeleteObject, DeleteCRD and DeletePersistentVolumeClaim, do with the
+// dependents of the deleted object: Background, the default, has the
+// garbage collector delete them afterwards, Foreground keeps the object
+// until they are gone and Orphan leaves them behind. The deployer's own
+// cleanup of jobs, pods and secrets is not affected.
+func (k *KubernetesClient) SetDeletePropagation(policy metav1.DeletionPropagation) {
+	k.deletePropagation = policy
+}
+
+// DeletePropagation returns the propagation policy of the deletes of the
+// uninstall and the prune
+func (k *KubernetesClient) DeletePropagation() metav1.DeletionPropagation {
+	if k.deletePropagation == "" {
+		return metav1.DeletePropagationBackground
+	}
+	return k.deletePropagation
+}
+
+// deleteOptions returns the options of the deletes of the uninstall and the
+// prune, with the propagation policy set explicitly since some resources
+// such as Jobs would otherwise orphan their dependents
+func (k *KubernetesClient) deleteOptions() metav1.DeleteOptions {
+	policy := k.DeletePropagation()
+	return metav1.DeleteOptions{PropagationPolicy: &policy}
+}
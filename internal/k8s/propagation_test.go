@@ -0,0 +1,158 @@
+package k8s_test
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	k8stesting "k8s.io/client-go/testing"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// recordingDynamic is a dynamic client recording the options of deletes,
+// which the fake dynamic client does not pass on to its reactors
+type recordingDynamic struct {
+	dynamic.Interface
+	deletes *[]metav1.DeleteOptions
+}
+
+func (d recordingDynamic) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return recordingResource{d.Interface.Resource(gvr), d.deletes}
+}
+
+type recordingResource struct {
+	dynamic.NamespaceableResourceInterface
+	deletes *[]metav1.DeleteOptions
+}
+
+func (r recordingResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return recordingNamespacedResource{r.NamespaceableResourceInterface.Namespace(namespace), r.deletes}
+}
+
+func (r recordingResource) Delete(ctx context.Context, name string, options metav1.DeleteOptions, subresources ...string) error {
+	*r.deletes = append(*r.deletes, options)
+	return r.NamespaceableResourceInterface.Delete(ctx, name, options, subresources...)
+}
+
+type recordingNamespacedResource struct {
+	dynamic.ResourceInterface
+	deletes *[]metav1.DeleteOptions
+}
+
+func (r recordingNamespacedResource) Delete(ctx context.Context, name string, options metav1.DeleteOptions, subresources ...string) error {
+	*r.deletes = append(*r.deletes, options)
+	return r.ResourceInterface.Delete(ctx, name, options, subresources...)
+}
+
+func TestDeletePropagation(t *testing.T) {
+	// deleteObject deletes the AWX web deployment through the dynamic client
+	deleteObject := func(ctx context.Context, client *k8s.KubernetesClient) error {
+		return client.DeleteObject(ctx, k8stest.Object("apps/v1", "Deployment", "awx", "awx-web"))
+	}
+
+	tests := []struct {
+		name string
+		// policy is the configured propagation, unset if empty
+		policy metav1.DeletionPropagation
+		delete func(ctx context.Context, client *k8s.KubernetesClient) error
+		// want is the propagation policy of the delete, empty if unset
+		want metav1.DeletionPropagation
+	}{
+		{
+			name:   "uninstall or prune by default",
+			delete: deleteObject,
+			want:   metav1.DeletePropagationBackground,
+		},
+		{
+			name:   "uninstall or prune in the foreground",
+			policy: metav1.DeletePropagationForeground,
+			delete: deleteObject,
+			want:   metav1.DeletePropagationForeground,
+		},
+		{
+			name:   "uninstall or prune orphaning dependents",
+			policy: metav1.DeletePropagationOrphan,
+			delete: deleteObject,
+			want:   metav1.DeletePropagationOrphan,
+		},
+		{
+			name:   "CRD",
+			policy: metav1.DeletePropagationForeground,
+			delete: func(ctx context.Context, client *k8s.KubernetesClient) error {
+				return client.DeleteCRD(ctx, "awxs.awx.ansible.com")
+			},
+			want: metav1.DeletePropagationForeground,
+		},
+		{
+			name:   "volume claim",
+			policy: metav1.DeletePropagationForeground,
+			delete: func(ctx context.Context, client *k8s.KubernetesClient) error {
+				return client.DeletePersistentVolumeClaim(ctx, "postgres-15-awx-postgres-15-0", "awx")
+			},
+			want: metav1.DeletePropagationForeground,
+		},
+		{
+			name:   "job always in the background",
+			policy: metav1.DeletePropagationOrphan,
+			delete: func(ctx context.Context, client *k8s.KubernetesClient) error {
+				return client.DeleteJob(ctx, "awx-deployer-storage-check", "awx")
+			},
+			want: metav1.DeletePropagationBackground,
+		},
+		{
+			name:   "pod",
+			policy: metav1.DeletePropagationForeground,
+			delete: func(ctx context.Context, client *k8s.KubernetesClient) error {
+				return client.DeletePod(ctx, "awx-deployer-egress-check", "awx")
+			},
+		},
+		{
+			name:   "secret",
+			policy: metav1.DeletePropagationForeground,
+			delete: func(ctx context.Context, client *k8s.KubernetesClient) error {
+				return client.DeleteSecret(ctx, "awx-api-token", "awx")
+			},
+		},
+		{
+			name:   "recreate for an immutable field",
+			policy: metav1.DeletePropagationForeground,
+			delete: func(ctx context.Context, client *k8s.KubernetesClient) error {
+				return client.RecreateObject(ctx, k8stest.Object("v1", "ConfigMap", "awx", "awx-settings"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster()
+			var deletes []metav1.DeleteOptions
+			cluster.Clientset.PrependReactor("delete", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				deletes = append(deletes, action.(k8stesting.DeleteAction).GetDeleteOptions())
+				return false, nil, nil
+			})
+			client := k8s.NewKubernetesClientForClients(cluster.Clientset, recordingDynamic{cluster.Dynamic, &deletes}, cluster.Discovery)
+			if tt.policy != "" {
+				client.SetDeletePropagation(tt.policy)
+			}
+
+			if err := tt.delete(context.Background(), client); err != nil {
+				t.Fatalf("delete failed: %v", err)
+			}
+			if len(deletes) != 1 {
+				t.Fatalf("got %d deletes, want 1", len(deletes))
+			}
+			var got metav1.DeletionPropagation
+			if deletes[0].PropagationPolicy != nil {
+				got = *deletes[0].PropagationPolicy
+			}
+			if got != tt.want {
+				t.Errorf("DeleteOptions.PropagationPolicy = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package k8s
+
+import (
+	"context"
+	"log"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// unthrottled is a rate limiter that never waits
+type unthrottled struct{}
+
+var _ flowcontrol.RateLimiter = unthrottled{}
+
+func (unthrottled) TryAccept() bool                { return true }
+func (unthrottled) Accept()                        {}
+func (unthrottled) Stop()                          {}
+func (unthrottled) QPS() float32                   { return 0 }
+func (unthrottled) Wait(ctx context.Context) error { return nil }
+
+// setRateLimit keeps client-go's default rate limiter unless throttling is
+// disabled, in which case requests are only limited by the API server
+func setRateLimit(config *rest.Config, throttle bool) {
+	if throttle {
+		return
+	}
+	log.Println("Warning: AWX_CLIENT_RATE_LIMIT=off disables client-side throttling, the API server's flow control is all that protects it")
+	config.RateLimiter = unthrottled{}
+}
@@ -0,0 +1,47 @@
+package k8s
+
+import (
+	"path/filepath"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestSetRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		throttle bool
+		// wantUnthrottled is whether requests skip client-side throttling
+		wantUnthrottled bool
+		// wantQPS is the QPS of the limiter the clients use, 0 if unlimited
+		wantQPS float32
+	}{
+		{name: "default limiter", throttle: true, wantQPS: rest.DefaultQPS},
+		{name: "rate limit off", throttle: false, wantUnthrottled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &rest.Config{Host: "https://example.com:6443"}
+			setRateLimit(config, tt.throttle)
+			if _, ok := config.RateLimiter.(unthrottled); ok != tt.wantUnthrottled {
+				t.Errorf("rest.Config rate limiter = %T, want unthrottled %v", config.RateLimiter, tt.wantUnthrottled)
+			}
+
+			client, err := NewKubernetesClient(filepath.Join("testdata", "kubeconfig", "west.yaml"), "", tt.throttle)
+			if err != nil {
+				t.Fatalf("NewKubernetesClient() failed: %v", err)
+			}
+			limiter := client.clientset.CoreV1().RESTClient().GetRateLimiter()
+			if _, ok := limiter.(unthrottled); ok != tt.wantUnthrottled {
+				t.Errorf("clientset rate limiter = %T, want unthrottled %v", limiter, tt.wantUnthrottled)
+			}
+			if limiter.QPS() != tt.wantQPS {
+				t.Errorf("clientset QPS = %v, want %v", limiter.QPS(), tt.wantQPS)
+			}
+			if !limiter.TryAccept() && tt.wantUnthrottled {
+				t.Error("unthrottled limiter rejected a request")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package k8s_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// rollingDeployment returns the AWX web deployment at generation 2 with
+// two replicas and the given status
+func rollingDeployment(status appsv1.DeploymentStatus) *appsv1.Deployment {
+	replicas := int32(2)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-web", Namespace: "awx", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     status,
+	}
+}
+
+func TestRolloutStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		want     string
+		wantDone bool
+		wantErr  string
+	}{
+		{
+			name:    "spec update not observed",
+			objects: []runtime.Object{rollingDeployment(appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2})},
+			want:    "Waiting for deployment spec update to be observed...",
+		},
+		{
+			name:    "replicas being updated",
+			objects: []runtime.Object{rollingDeployment(appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 2})},
+			want:    "Waiting for deployment rollout to finish: 1 out of 2 new replicas have been updated...",
+		},
+		{
+			name:    "old replicas terminating",
+			objects: []runtime.Object{rollingDeployment(appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2})},
+			want:    "Waiting for deployment rollout to finish: 1 old replicas are pending termination...",
+		},
+		{
+			name:    "updated replicas not available",
+			objects: []runtime.Object{rollingDeployment(appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1})},
+			want:    "Waiting for deployment rollout to finish: 1 of 2 updated replicas are available...",
+		},
+		{
+			name:     "rolled out",
+			objects:  []runtime.Object{rollingDeployment(appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2})},
+			want:     "deployment awx-web successfully rolled out",
+			wantDone: true,
+		},
+		{
+			name: "progress deadline exceeded",
+			objects: []runtime.Object{rollingDeployment(appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    1,
+				Conditions: []appsv1.DeploymentCondition{
+					{Type: appsv1.DeploymentProgressing, Status: "False", Reason: "ProgressDeadlineExceeded"},
+				},
+			})},
+			wantErr: "deployment awx-web exceeded its progress deadline",
+		},
+		{
+			name:    "deployment missing",
+			wantErr: "awx-web",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := k8stest.NewCluster(tt.objects...).Client
+
+			got, done, err := client.RolloutStatus(context.Background(), "awx-web", "awx")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RolloutStatus() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RolloutStatus() failed: %v", err)
+			}
+			if got != tt.want || done != tt.wantDone {
+				t.Errorf("RolloutStatus() = %q, %v, want %q, %v", got, done, tt.want, tt.wantDone)
+			}
+		})
+	}
+}
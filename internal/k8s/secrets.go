@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// OwnedKeysAnnotation lists the secret keys written by the deployer. Other
+// keys, like those the operator adds, are kept when a secret is re-applied.
+const OwnedKeysAnnotation = "awx-deployer/owned-keys"
+
+// isSecret reports whether an object is a core Secret
+func isSecret(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == "" && gvk.Kind == "Secret"
+}
+
+// markOwnedSecretKeys records the data and stringData keys of a secret about
+// to be applied in its owned keys annotation
+func markOwnedSecretKeys(obj *unstructured.Unstructured) {
+	var keys []string
+	for _, field := range []string{"data", "stringData"} {
+		values, _, _ := unstructured.NestedMap(obj.Object, field)
+		for key := range values {
+			keys = append(keys, key)
+		}
+	}
+	setOwnedKeys(obj, keys)
+}
+
+// mergeSecretData copies the keys of an existing secret that the deployer did
+// not author into a secret about to replace it. Keys the deployer wrote
+// before but no longer applies are dropped.
+func mergeSecretData(obj, existing *unstructured.Unstructured) error {
+	existingData, _, _ := unstructured.NestedMap(existing.Object, "data")
+	if len(existingData) == 0 {
+		return nil
+	}
+
+	data, _, _ := unstructured.NestedMap(obj.Object, "data")
+	stringData, _, _ := unstructured.NestedMap(obj.Object, "stringData")
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	previouslyOwned := ownedKeys(existing.GetAnnotations())
+	for key, value := range existingData {
+		_, inData := data[key]
+		_, inStringData := stringData[key]
+		if inData || inStringData || previouslyOwned[key] {
+			continue
+		}
+		data[key] = value
+	}
+
+	return unstructured.SetNestedMap(obj.Object, data, "data")
+}
+
+// mergeTypedSecretData is mergeSecretData for typed secrets
+func mergeTypedSecretData(secret, existing *corev1.Secret) {
+	if len(existing.Data) == 0 {
+		return
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+
+	previouslyOwned := ownedKeys(existing.Annotations)
+	for key, value := range existing.Data {
+		_, inData := secret.Data[key]
+		_, inStringData := secret.StringData[key]
+		if inData || inStringData || previouslyOwned[key] {
+			continue
+		}
+		secret.Data[key] = value
+	}
+}
+
+// markOwnedTypedSecretKeys is markOwnedSecretKeys for typed secrets
+func markOwnedTypedSecretKeys(secret *corev1.Secret) {
+	var keys []string
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	for key := range secret.StringData {
+		keys = append(keys, key)
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[OwnedKeysAnnotation] = joinKeys(keys)
+}
+
+// setOwnedKeys sets the owned keys annotation of an object
+func setOwnedKeys(obj *unstructured.Unstructured, keys []string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[OwnedKeysAnnotation] = joinKeys(keys)
+	obj.SetAnnotations(annotations)
+}
+
+// ownedKeys parses the owned keys annotation. Secrets applied before the
+// annotation existed own no keys, so all their keys are kept.
+func ownedKeys(annotations map[string]string) map[string]bool {
+	owned := map[string]bool{}
+	for _, key := range strings.Split(annotations[OwnedKeysAnnotation], ",") {
+		if key != "" {
+			owned[key] = true
+		}
+	}
+	return owned
+}
+
+// joinKeys returns the sorted, de-duplicated keys as an annotation value
+func joinKeys(keys []string) string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	sort.Strings(unique)
+	return strings.Join(unique, ",")
+}
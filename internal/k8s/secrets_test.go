@@ -0,0 +1,143 @@
+package k8s_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// secretTests are re-applies of the admin password secret over an existing
+// one, shared by the typed and the dynamic apply
+var secretTests = []struct {
+	name string
+	// existing is nil when the secret does not exist yet
+	existing     map[string][]byte
+	existingKeys *string
+	applied      map[string][]byte
+	wantData     map[string][]byte
+	wantOwned    string
+}{
+	{
+		name:      "new secret",
+		applied:   map[string][]byte{"password": []byte("new")},
+		wantData:  map[string][]byte{"password": []byte("new")},
+		wantOwned: "password",
+	},
+	{
+		name:         "operator-added key survives",
+		existing:     map[string][]byte{"password": []byte("old"), "secret_key": []byte("operator")},
+		existingKeys: stringPtr("password"),
+		applied:      map[string][]byte{"password": []byte("new")},
+		wantData:     map[string][]byte{"password": []byte("new"), "secret_key": []byte("operator")},
+		wantOwned:    "password",
+	},
+	{
+		name:         "key no longer applied is dropped",
+		existing:     map[string][]byte{"password": []byte("old"), "username": []byte("admin"), "secret_key": []byte("operator")},
+		existingKeys: stringPtr("password,username"),
+		applied:      map[string][]byte{"password": []byte("new")},
+		wantData:     map[string][]byte{"password": []byte("new"), "secret_key": []byte("operator")},
+		wantOwned:    "password",
+	},
+	{
+		name:     "secret applied before keys were tracked keeps its keys",
+		existing: map[string][]byte{"password": []byte("old"), "username": []byte("admin")},
+		applied:  map[string][]byte{"password": []byte("new")},
+		wantData: map[string][]byte{"password": []byte("new"), "username": []byte("admin")},
+		// the next apply drops username if it is still not applied
+		wantOwned: "password",
+	},
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// adminSecret returns the admin password secret with the given data and
+// owned keys annotation, if any. The data is copied, applying merges into it.
+func adminSecret(data map[string][]byte, owned *string) *corev1.Secret {
+	secret := &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-admin-password", Namespace: "awx"},
+		Data:       map[string][]byte{},
+	}
+	for key, value := range data {
+		secret.Data[key] = value
+	}
+	if owned != nil {
+		secret.Annotations = map[string]string{k8s.OwnedKeysAnnotation: *owned}
+	}
+	return secret
+}
+
+func TestApplySecretPreservesOperatorKeys(t *testing.T) {
+	for _, tt := range secretTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing != nil {
+				objects = append(objects, adminSecret(tt.existing, tt.existingKeys))
+			}
+			cluster := k8stest.NewCluster(objects...)
+
+			if err := cluster.Client.ApplySecret(context.Background(), adminSecret(tt.applied, nil)); err != nil {
+				t.Fatalf("ApplySecret() failed: %v", err)
+			}
+
+			secret, err := cluster.Clientset.CoreV1().Secrets("awx").Get(context.Background(), "awx-admin-password", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get secret: %v", err)
+			}
+			if !reflect.DeepEqual(secret.Data, tt.wantData) {
+				t.Errorf("data = %v, want %v", secret.Data, tt.wantData)
+			}
+			if owned := secret.Annotations[k8s.OwnedKeysAnnotation]; owned != tt.wantOwned {
+				t.Errorf("owned keys = %q, want %q", owned, tt.wantOwned)
+			}
+		})
+	}
+}
+
+func TestApplyObjectPreservesOperatorKeys(t *testing.T) {
+	secretsGVR := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	for _, tt := range secretTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing != nil {
+				objects = append(objects, adminSecret(tt.existing, tt.existingKeys))
+			}
+			cluster := k8stest.NewCluster(objects...)
+
+			applied, err := runtime.DefaultUnstructuredConverter.ToUnstructured(adminSecret(tt.applied, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cluster.Client.ApplyObject(context.Background(), &unstructured.Unstructured{Object: applied}); err != nil {
+				t.Fatalf("ApplyObject() failed: %v", err)
+			}
+
+			obj, err := cluster.Dynamic.Resource(secretsGVR).Namespace("awx").Get(context.Background(), "awx-admin-password", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get secret: %v", err)
+			}
+			var secret corev1.Secret
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &secret); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(secret.Data, tt.wantData) {
+				t.Errorf("data = %v, want %v", secret.Data, tt.wantData)
+			}
+			if owned := secret.Annotations[k8s.OwnedKeysAnnotation]; owned != tt.wantOwned {
+				t.Errorf("owned keys = %q, want %q", owned, tt.wantOwned)
+			}
+		})
+	}
+}
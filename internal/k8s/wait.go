@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// WaitForCondition watches an object until its status condition of the given
+// type has the given status, like kubectl wait --for=condition=<type>=<status>,
+// and returns the object at that point. The object does not have to exist
+// yet. Types and statuses are compared case-insensitively. A timeout of zero
+// waits until the context is done.
+func (k *KubernetesClient) WaitForCondition(ctx context.Context, gvr schema.GroupVersionResource, name, namespace, conditionType, status string, timeout time.Duration) (*unstructured.Unstructured, error) {
+	ready := func(obj *unstructured.Unstructured) (bool, error) {
+		return HasCondition(obj, conditionType, status), nil
+	}
+	return k.WaitFor(ctx, gvr, name, namespace, fmt.Sprintf("condition %s=%s", conditionType, status), ready, timeout)
+}
+
+// WaitFor watches an object until ready reports true for it and returns the
+// object at that point. An error from ready ends the wait with that error.
+// The object does not have to exist yet. The description names what is
+// waited for in the timeout error. A timeout of zero waits until the context
+// is done.
+func (k *KubernetesClient) WaitFor(ctx context.Context, gvr schema.GroupVersionResource, name, namespace, description string, ready func(*unstructured.Unstructured) (bool, error), timeout time.Duration) (*unstructured.Unstructured, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var resource dynamic.ResourceInterface = k.dynamicClient.Resource(gvr)
+	if namespace != "" {
+		resource = k.dynamicClient.Resource(gvr).Namespace(namespace)
+	}
+
+	for {
+		obj, done, err := waitOnce(ctx, resource, name, ready)
+		if err != nil || done {
+			return obj, err
+		}
+
+		// the watch ended early, start over from a fresh read
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timeout waiting for %s %s to have %s", gvr.Resource, name, description)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// waitOnce reads the object and then watches it from that version. It
+// returns done as false when the watch ends before the object is ready, so
+// that the caller can start over.
+func waitOnce(ctx context.Context, resource dynamic.ResourceInterface, name string, ready func(*unstructured.Unstructured) (bool, error)) (*unstructured.Unstructured, bool, error) {
+	options := metav1.ListOptions{FieldSelector: "metadata.name=" + name}
+
+	obj, err := resource.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		if done, err := ready(obj); err != nil || done {
+			return obj, true, err
+		}
+		options.ResourceVersion = obj.GetResourceVersion()
+	case errors.IsNotFound(err):
+		// wait for the object to be created
+	case ctx.Err() != nil:
+		return nil, false, nil
+	default:
+		return nil, true, fmt.Errorf("failed to get %s: %v", name, err)
+	}
+
+	watcher, err := resource.Watch(ctx, options)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, false, nil
+		}
+		return nil, true, fmt.Errorf("failed to watch %s: %v", name, err)
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false, nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok || event.Type == watch.Error {
+				// closed by the server or expired resource version
+				return nil, false, nil
+			}
+			if event.Type != watch.Added && event.Type != watch.Modified {
+				continue
+			}
+
+			current, ok := event.Object.(*unstructured.Unstructured)
+			// the name is checked too, as not every server honors field selectors
+			if !ok || current.GetName() != name {
+				continue
+			}
+			if done, err := ready(current); err != nil || done {
+				return current, true, err
+			}
+		}
+	}
+}
+
+// HasCondition reports whether the status conditions of an object include
+// one of the given type with the given status
+func HasCondition(obj *unstructured.Unstructured, conditionType, status string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		currentType, _ := condition["type"].(string)
+		currentStatus, _ := condition["status"].(string)
+		if strings.EqualFold(currentType, conditionType) && strings.EqualFold(currentStatus, status) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+package k8s_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+var deploymentsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+// deploymentWithCondition returns a deployment with a single status
+// condition
+func deploymentWithCondition(name, conditionType, status string) *unstructured.Unstructured {
+	obj := k8stest.Object("apps/v1", "Deployment", "awx", name)
+	unstructured.SetNestedSlice(obj.Object, []interface{}{
+		map[string]interface{}{"type": conditionType, "status": status},
+	}, "status", "conditions")
+	return obj
+}
+
+// afterWatch runs change once the waiter watches, so that the change is not
+// missed between its read and its watch
+func afterWatch(t *testing.T, cluster *k8stest.Cluster, change func() error) {
+	go func() {
+		for {
+			for _, action := range cluster.Dynamic.Actions() {
+				if action.GetVerb() == "watch" {
+					if err := change(); err != nil {
+						t.Errorf("failed to change object: %v", err)
+					}
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+}
+
+func TestWaitForCondition(t *testing.T) {
+	tests := []struct {
+		name          string
+		existing      *unstructured.Unstructured
+		conditionType string
+		status        string
+		// change is applied once the wait watches
+		change  func(cluster *k8stest.Cluster) error
+		wantErr string
+	}{
+		{
+			name:          "already met",
+			existing:      deploymentWithCondition("awx-web", "Available", "True"),
+			conditionType: "Available",
+			status:        "True",
+		},
+		{
+			name:          "met case-insensitively",
+			existing:      deploymentWithCondition("awx-web", "Available", "True"),
+			conditionType: "available",
+			status:        "true",
+		},
+		{
+			name:          "condition changes",
+			existing:      deploymentWithCondition("awx-web", "Available", "False"),
+			conditionType: "Available",
+			status:        "True",
+			change: func(cluster *k8stest.Cluster) error {
+				return cluster.Dynamic.Tracker().Update(deploymentsGVR, deploymentWithCondition("awx-web", "Available", "True"), "awx")
+			},
+		},
+		{
+			name:          "arbitrary condition",
+			existing:      deploymentWithCondition("awx-web", "Progressing", "True"),
+			conditionType: "ReplicaFailure",
+			status:        "False",
+			change: func(cluster *k8stest.Cluster) error {
+				return cluster.Dynamic.Tracker().Update(deploymentsGVR, deploymentWithCondition("awx-web", "ReplicaFailure", "False"), "awx")
+			},
+		},
+		{
+			name:          "object created",
+			conditionType: "Available",
+			status:        "True",
+			change: func(cluster *k8stest.Cluster) error {
+				return cluster.Dynamic.Tracker().Add(deploymentWithCondition("awx-web", "Available", "True"))
+			},
+		},
+		{
+			name:          "other object changes",
+			existing:      deploymentWithCondition("awx-web", "Available", "False"),
+			conditionType: "Available",
+			status:        "True",
+			change: func(cluster *k8stest.Cluster) error {
+				return cluster.Dynamic.Tracker().Add(deploymentWithCondition("awx-task", "Available", "True"))
+			},
+			wantErr: "timeout waiting for deployments awx-web to have condition Available=True",
+		},
+		{
+			name:          "timeout",
+			existing:      deploymentWithCondition("awx-web", "Available", "False"),
+			conditionType: "Available",
+			status:        "True",
+			wantErr:       "timeout waiting for deployments awx-web to have condition Available=True",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing != nil {
+				objects = append(objects, tt.existing)
+			}
+			cluster := k8stest.NewCluster(objects...)
+			if tt.change != nil {
+				afterWatch(t, cluster, func() error { return tt.change(cluster) })
+			}
+
+			obj, err := cluster.Client.WaitForCondition(context.Background(), deploymentsGVR, "awx-web", "awx", tt.conditionType, tt.status, 300*time.Millisecond)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("WaitForCondition() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WaitForCondition() failed: %v", err)
+			}
+			if obj.GetName() != "awx-web" {
+				t.Errorf("WaitForCondition() returned %s, want awx-web", obj.GetName())
+			}
+		})
+	}
+}
+
+func TestWaitForWorkloadTimeout(t *testing.T) {
+	replicas := int32(1)
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-postgres-15", Namespace: "awx"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+	cluster := k8stest.NewCluster(deploymentWithCondition("awx-web", "Available", "False"), statefulSet)
+	ctx := context.Background()
+
+	// the given timeout bounds the wait, not a built-in one
+	for name, wait := range map[string]func(time.Duration) error{
+		"deployment": func(timeout time.Duration) error {
+			return cluster.Client.WaitForDeployment(ctx, "awx-web", "awx", timeout)
+		},
+		"stateful set": func(timeout time.Duration) error {
+			return cluster.Client.WaitForStatefulSet(ctx, "awx-postgres-15", "awx", timeout)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			err := wait(200 * time.Millisecond)
+			if err == nil || !strings.Contains(err.Error(), "timeout waiting for") {
+				t.Fatalf("wait error = %v, want a timeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("wait took %v, want it bounded by the 200ms timeout", elapsed)
+			}
+		})
+	}
+}
+
+// statefulSet returns a stateful set of one replica with the given status
+func statefulSet(status appsv1.StatefulSetStatus) *appsv1.StatefulSet {
+	replicas := int32(1)
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-postgres-15", Namespace: "awx", Generation: 1},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status:     status,
+	}
+}
+
+// rolledOut is the status of a stateful set of one replica that rolled out
+var rolledOut = appsv1.StatefulSetStatus{
+	ObservedGeneration: 1,
+	ReadyReplicas:      1,
+	UpdatedReplicas:    1,
+	CurrentRevision:    "awx-postgres-15-1",
+	UpdateRevision:     "awx-postgres-15-1",
+}
+
+func TestStatefulSetReady(t *testing.T) {
+	zero := int32(0)
+
+	tests := []struct {
+		name   string
+		change func(*appsv1.StatefulSet)
+		want   bool
+	}{
+		{name: "rolled out", want: true},
+		{name: "replica not ready", change: func(s *appsv1.StatefulSet) { s.Status.ReadyReplicas = 0 }},
+		{name: "replica not updated", change: func(s *appsv1.StatefulSet) { s.Status.UpdatedReplicas = 0 }},
+		{name: "new revision", change: func(s *appsv1.StatefulSet) { s.Status.UpdateRevision = "awx-postgres-15-2" }},
+		{name: "spec not observed", change: func(s *appsv1.StatefulSet) { s.Generation = 2 }},
+		{name: "scaled to zero", change: func(s *appsv1.StatefulSet) {
+			s.Spec.Replicas = &zero
+			s.Status.ReadyReplicas = 0
+			s.Status.UpdatedReplicas = 0
+		}},
+		{name: "replicas unset default to one", change: func(s *appsv1.StatefulSet) { s.Spec.Replicas = nil }, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := statefulSet(rolledOut)
+			if tt.change != nil {
+				tt.change(s)
+			}
+			if got := k8s.StatefulSetReady(s); got != tt.want {
+				t.Errorf("StatefulSetReady() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForStatefulSet(t *testing.T) {
+	statefulSetsGVR := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
+
+	tests := []struct {
+		name     string
+		existing *appsv1.StatefulSet
+		// change is applied once the wait watches
+		change  func(cluster *k8stest.Cluster) error
+		wantErr string
+	}{
+		{
+			name:     "already rolled out",
+			existing: statefulSet(rolledOut),
+		},
+		{
+			name:     "replica becomes ready",
+			existing: statefulSet(appsv1.StatefulSetStatus{ObservedGeneration: 1, UpdatedReplicas: 1}),
+			change: func(cluster *k8stest.Cluster) error {
+				obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(statefulSet(rolledOut))
+				if err != nil {
+					return err
+				}
+				return cluster.Dynamic.Tracker().Update(statefulSetsGVR, &unstructured.Unstructured{Object: obj}, "awx")
+			},
+		},
+		{
+			name:     "never ready",
+			existing: statefulSet(appsv1.StatefulSetStatus{ObservedGeneration: 1}),
+			wantErr:  "timeout waiting for statefulsets awx-postgres-15 to have all replicas ready",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.existing)
+			if tt.change != nil {
+				afterWatch(t, cluster, func() error { return tt.change(cluster) })
+			}
+
+			err := cluster.Client.WaitForStatefulSet(context.Background(), "awx-postgres-15", "awx", 300*time.Millisecond)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("WaitForStatefulSet() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WaitForStatefulSet() failed: %v", err)
+			}
+		})
+	}
+}
@@ -3,10 +3,18 @@ package operator
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
 	"awx-deployer/internal/config"
+	"awx-deployer/internal/events"
+	"awx-deployer/internal/images"
 	"awx-deployer/internal/k8s"
 )
 
@@ -14,22 +22,26 @@ import (
 type OperatorInstaller struct {
 	k8sClient *k8s.KubernetesClient
 	config    *config.Config
+
+	// podInterval is how often the operator pods are checked
+	podInterval time.Duration
 }
 
 // NewOperatorInstaller creates a new operator installer
 func NewOperatorInstaller(k8sClient *k8s.KubernetesClient, config *config.Config) *OperatorInstaller {
 	return &OperatorInstaller{
-		k8sClient: k8sClient,
-		config:    config,
+		k8sClient:   k8sClient,
+		config:      config,
+		podInterval: 10 * time.Second,
 	}
 }
 
-// Install installs the AWX operator using the manifest file
+// Install installs the AWX operator from the configured manifest file or bundle directory
 func (o *OperatorInstaller) Install(ctx context.Context) error {
 	log.Println("Installing AWX Operator...")
 
 	// Check if operator is already installed
-	exists, err := o.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", "awx-operator-controller-manager", o.config.Namespace)
+	exists, err := o.Installed(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to check if operator exists: %v", err)
 	}
@@ -39,14 +51,22 @@ func (o *OperatorInstaller) Install(ctx context.Context) error {
 		return nil
 	}
 
-	// Install operator using the manifest file
-	log.Printf("Installing AWX Operator from manifest...")
-	manifestPath := "manifests/awx-operator.yaml"
-	if err := o.k8sClient.Apply(ctx, manifestPath); err != nil {
-		return fmt.Errorf("failed to install AWX operator from manifest: %v", err)
+	// Install operator using the manifest file or bundle directory
+	manifests, err := readManifests(o.config)
+	if err != nil {
+		return err
+	}
+
+	for _, manifest := range manifests {
+		log.Printf("Installing AWX Operator from manifest %s...", manifest.path)
+		events.Progressf(ctx, "installing AWX Operator from %s", manifest.path)
+		if err := o.applyManifest(ctx, manifest); err != nil {
+			return fmt.Errorf("failed to install AWX operator from manifest: %v", err)
+		}
 	}
 
 	log.Println("Waiting for AWX Operator to be ready...")
+	events.Progressf(ctx, "waiting for AWX Operator")
 
 	// Wait for operator deployment to be available
 	if err := o.waitForOperatorReady(ctx); err != nil {
@@ -57,6 +77,171 @@ func (o *OperatorInstaller) Install(ctx context.Context) error {
 	return nil
 }
 
+// Installed reports whether the operator deployment exists, in which case
+// Install leaves the operator alone
+func (o *OperatorInstaller) Installed(ctx context.Context) (bool, error) {
+	return o.k8sClient.ResourceExists(ctx, "apps", "v1", "deployments", "awx-operator-controller-manager", o.config.OperatorNamespace)
+}
+
+// CheckExisting checks that an operator installed by others is usable: its
+// deployment exists, its pods are ready and the AWX CRD is registered
+func (o *OperatorInstaller) CheckExisting(ctx context.Context) error {
+	exists, err := o.Installed(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if operator exists: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("AWX_SKIP_OPERATOR_INSTALL is set but operator deployment awx-operator-controller-manager does not exist in namespace %s (set AWX_OPERATOR_NAMESPACE to the namespace of the existing operator)", o.config.OperatorNamespace)
+	}
+
+	status, err := o.k8sClient.GetPodStatus(ctx, o.config.OperatorPodSelector, o.config.OperatorNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to get operator pod status: %v", err)
+	}
+	log.Printf("Operator pod selector %s matches %d pod(s) in namespace %s", o.config.OperatorPodSelector, status.Pods, o.config.OperatorNamespace)
+	if status.Pods == 0 {
+		return fmt.Errorf("no operator pods match %s in namespace %s (set AWX_OPERATOR_POD_SELECTOR to the labels of the existing operator's pods)", o.config.OperatorPodSelector, o.config.OperatorNamespace)
+	}
+	if !status.Ready() {
+		return fmt.Errorf("existing AWX operator in namespace %s is not ready (status: %s)", o.config.OperatorNamespace, status)
+	}
+
+	crdName, err := o.k8sClient.CRDName(ctx, k8s.AWXGroup, "AWX")
+	if err != nil {
+		return err
+	}
+	if crdName == "" {
+		return fmt.Errorf("AWX CRD is not installed, the existing operator is incomplete")
+	}
+
+	log.Printf("✓ Existing AWX operator in namespace %s is ready", o.config.OperatorNamespace)
+	return nil
+}
+
+// manifestFiles returns the manifest itself, or the YAML and JSON files of a
+// bundle directory in name order
+func manifestFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("operator manifest %s not found: %v", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join(path, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operator bundle %s: %v", path, err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no YAML or JSON manifests found in operator bundle %s", path)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// applyManifest applies the objects of an operator manifest
+func (o *OperatorInstaller) applyManifest(ctx context.Context, manifest manifest) error {
+	for _, obj := range manifest.objs {
+		if err := o.k8sClient.ApplyObject(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manifest is an operator manifest file and its objects
+type manifest struct {
+	path string
+	objs []*unstructured.Unstructured
+}
+
+// readManifests reads the operator manifests, layers the patches of
+// AWX_OPERATOR_KUSTOMIZE_PATCHES onto them and applies the configured image
+// pull policy and registry mirrors
+func readManifests(cfg *config.Config) ([]manifest, error) {
+	manifestPaths, err := manifestFiles(cfg.OperatorManifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []manifest
+	var objs []*unstructured.Unstructured
+	for _, manifestPath := range manifestPaths {
+		manifestObjs, err := readManifest(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest{path: manifestPath, objs: manifestObjs})
+		objs = append(objs, manifestObjs...)
+	}
+
+	patches, err := readPatches(cfg.OperatorKustomizePatches)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyPatches(objs, patches); err != nil {
+		return nil, err
+	}
+
+	settings := images.NewSettings(cfg)
+	for _, obj := range objs {
+		if err := settings.Apply(obj); err != nil {
+			return nil, fmt.Errorf("failed to configure images of %s %s: %v", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return manifests, nil
+}
+
+// readManifest decodes a manifest file
+func readManifest(manifestPath string) ([]*unstructured.Unstructured, error) {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest file %s: %v", manifestPath, err)
+	}
+
+	objs, err := k8s.DecodeManifests(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s: %v", manifestPath, err)
+	}
+	return objs, nil
+}
+
+// Objects returns the objects of the operator manifests in apply order, with
+// the configured patches and image settings applied
+func Objects(cfg *config.Config) ([]*unstructured.Unstructured, error) {
+	manifests, err := readManifests(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, manifest := range manifests {
+		objs = append(objs, manifest.objs...)
+	}
+	return objs, nil
+}
+
+// Images returns the images the operator manifests reference, with the
+// configured patches and registry mirrors applied
+func Images(cfg *config.Config) ([]string, error) {
+	objs, err := Objects(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for _, obj := range objs {
+		refs = append(refs, images.References(obj)...)
+	}
+	return refs, nil
+}
+
 // waitForOperatorReady waits for the operator deployment to be ready
 func (o *OperatorInstaller) waitForOperatorReady(ctx context.Context) error {
 	timeout := time.Duration(o.config.OperatorTimeout) * time.Minute
@@ -64,31 +249,37 @@ func (o *OperatorInstaller) waitForOperatorReady(ctx context.Context) error {
 	defer cancel()
 
 	// Wait for the deployment to be ready
-	if err := o.k8sClient.WaitForDeployment(ctxWithTimeout, "awx-operator-controller-manager", o.config.Namespace); err != nil {
+	if err := o.k8sClient.WaitForDeployment(ctxWithTimeout, "awx-operator-controller-manager", o.config.OperatorNamespace, timeout); err != nil {
 		return fmt.Errorf("operator deployment not ready: %v", err)
 	}
 
-	// Additional check to ensure operator pods are running
-	ticker := time.NewTicker(10 * time.Second)
+	// Additional check to ensure operator pods are ready
+	ticker := time.NewTicker(o.podInterval)
 	defer ticker.Stop()
 
+	selector := o.config.OperatorPodSelector
 	for {
 		select {
 		case <-ctxWithTimeout.Done():
-			return fmt.Errorf("timeout waiting for operator pods to be ready")
+			return fmt.Errorf("timeout waiting for operator pods matching %s to be ready", selector)
 		case <-ticker.C:
-			status, err := o.k8sClient.GetPodStatus(ctxWithTimeout, "control-plane=controller-manager", o.config.Namespace)
+			status, err := o.k8sClient.GetPodStatus(ctxWithTimeout, selector, o.config.OperatorNamespace)
 			if err != nil {
 				log.Printf("Warning: Could not get operator pod status: %v", err)
 				continue
 			}
 
-			if status == "Running" {
-				log.Println("Operator pods are running")
+			if status.Ready() {
+				log.Printf("Operator pods are ready (%d pod(s) match %s)", status.Pods, selector)
 				return nil
 			}
 
-			log.Printf("Operator pod status: %s, waiting...", status)
+			if status.Pods == 0 {
+				// the deployment is available, so its pods have other labels
+				log.Printf("Warning: No pods match operator pod selector %s in namespace %s, check AWX_OPERATOR_POD_SELECTOR", selector, o.config.OperatorNamespace)
+				continue
+			}
+			log.Printf("Operator pod status (selector %s): %s, waiting...", selector, status)
 		}
 	}
 }
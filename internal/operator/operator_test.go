@@ -0,0 +1,293 @@
+package operator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// testConfig creates a Config from the given env vars, on top of an
+// environment without any AWX_ variable
+func testConfig(t *testing.T, env map[string]string) *config.Config {
+	t.Helper()
+	for _, entry := range os.Environ() {
+		if key := strings.SplitN(entry, "=", 2)[0]; strings.HasPrefix(key, "AWX_") {
+			t.Setenv(key, "")
+		}
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Fatalf("NewConfigFromEnv() failed: %v", err)
+	}
+	return cfg
+}
+
+func TestInstallFromLocalManifests(t *testing.T) {
+	manifest := filepath.Join("testdata", "awx-operator.yaml")
+	bundle := filepath.Join("testdata", "bundle")
+
+	tests := []struct {
+		name string
+		path string
+		env  map[string]string
+		// wantFiles are the manifests applied, in order
+		wantFiles  []string
+		wantCRD    bool
+		wantImages []string
+		wantErr    string
+	}{
+		{
+			name:       "manifest file",
+			path:       manifest,
+			wantFiles:  []string{manifest},
+			wantImages: []string{"quay.io/ansible/awx-operator:2.5.0"},
+		},
+		{
+			name:       "bundle directory",
+			path:       bundle,
+			wantFiles:  []string{filepath.Join(bundle, "01-crd.yaml"), filepath.Join(bundle, "02-operator.yml")},
+			wantCRD:    true,
+			wantImages: []string{"quay.io/ansible/awx-operator:2.5.0"},
+		},
+		{
+			name:       "bundle with registry mirror",
+			path:       bundle,
+			env:        map[string]string{"AWX_REGISTRY_MIRROR": "quay.io=mirror.local/quay"},
+			wantFiles:  []string{filepath.Join(bundle, "01-crd.yaml"), filepath.Join(bundle, "02-operator.yml")},
+			wantCRD:    true,
+			wantImages: []string{"mirror.local/quay/ansible/awx-operator:2.5.0"},
+		},
+		{
+			name:    "missing manifest",
+			path:    filepath.Join("testdata", "missing.yaml"),
+			wantErr: "operator manifest testdata/missing.yaml not found",
+		},
+		{
+			name:    "bundle without manifests",
+			path:    filepath.Join("testdata", "empty-bundle"),
+			wantErr: "no YAML or JSON manifests found in operator bundle testdata/empty-bundle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_NAMESPACE": "awx", "AWX_OPERATOR_MANIFEST_PATH": tt.path}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cfg := testConfig(t, env)
+
+			manifests, err := readManifests(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readManifests() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readManifests() failed: %v", err)
+			}
+
+			var files []string
+			for _, m := range manifests {
+				files = append(files, m.path)
+			}
+			if !reflect.DeepEqual(files, tt.wantFiles) {
+				t.Errorf("manifests = %v, want %v", files, tt.wantFiles)
+			}
+			refs, err := Images(cfg)
+			if err != nil {
+				t.Fatalf("Images() failed: %v", err)
+			}
+			if !reflect.DeepEqual(refs, tt.wantImages) {
+				t.Errorf("Images() = %v, want %v", refs, tt.wantImages)
+			}
+
+			cluster := k8stest.NewCluster()
+			installer := NewOperatorInstaller(cluster.Client, cfg)
+			for _, m := range manifests {
+				if err := installer.applyManifest(context.Background(), m); err != nil {
+					t.Fatalf("applyManifest(%s) failed: %v", m.path, err)
+				}
+			}
+
+			installed, err := installer.Installed(context.Background())
+			if err != nil || !installed {
+				t.Errorf("Installed() = %v, %v after applying, want true", installed, err)
+			}
+			crd, err := cluster.Client.GetCRD(context.Background(), "awxs.awx.ansible.com")
+			if err != nil {
+				t.Fatalf("GetCRD() failed: %v", err)
+			}
+			if (crd != nil) != tt.wantCRD {
+				t.Errorf("CRD applied = %v, want %v", crd != nil, tt.wantCRD)
+			}
+		})
+	}
+}
+
+// existingOperator returns the objects of an operator installed by others,
+// with its pod ready or not
+func existingOperator(ready bool) []runtime.Object {
+	status := corev1.ConditionTrue
+	if !ready {
+		status = corev1.ConditionFalse
+	}
+	crd := k8stest.Object("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", k8s.AWXResource+"."+k8s.AWXGroup)
+	unstructured.SetNestedField(crd.Object, k8s.AWXGroup, "spec", "group")
+	unstructured.SetNestedField(crd.Object, "AWX", "spec", "names", "kind")
+	return []runtime.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "awx-operator-controller-manager", Namespace: "platform"}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "awx-operator-controller-manager-0", Namespace: "platform", Labels: map[string]string{"control-plane": "controller-manager"}},
+			Status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		},
+		crd,
+	}
+}
+
+func TestCheckExisting(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "healthy operator",
+			objects: existingOperator(true),
+		},
+		{
+			name:    "no operator",
+			wantErr: "AWX_SKIP_OPERATOR_INSTALL is set but operator deployment awx-operator-controller-manager does not exist in namespace platform",
+		},
+		{
+			name:    "operator not ready",
+			objects: existingOperator(false),
+			wantErr: "existing AWX operator in namespace platform is not ready",
+		},
+		{
+			name:    "pod selector matches no pods",
+			objects: existingOperator(true),
+			env:     map[string]string{"AWX_OPERATOR_POD_SELECTOR": "app=awx-operator"},
+			wantErr: "no operator pods match app=awx-operator in namespace platform",
+		},
+		{
+			name:    "AWX CRD missing",
+			objects: existingOperator(true)[:2],
+			wantErr: "AWX CRD is not installed, the existing operator is incomplete",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_SKIP_OPERATOR_INSTALL": "true", "AWX_OPERATOR_NAMESPACE": "platform"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cluster := k8stest.NewCluster(tt.objects...)
+			installer := NewOperatorInstaller(cluster.Client, testConfig(t, env))
+
+			err := installer.CheckExisting(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckExisting() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckExisting() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWaitForOperatorReadySelector(t *testing.T) {
+	available := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-operator-controller-manager", Namespace: "awx"},
+		Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+		}},
+	}
+	helmLabels := map[string]string{
+		"app.kubernetes.io/name":       "awx-operator",
+		"app.kubernetes.io/instance":   "awx-operator",
+		"app.kubernetes.io/managed-by": "Helm",
+	}
+	helmPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-operator-7d9f-x2k4p", Namespace: "awx", Labels: helmLabels},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		wantErr  string
+	}{
+		{
+			name:    "default selector misses the Helm labels",
+			wantErr: "timeout waiting for operator pods matching control-plane=controller-manager to be ready",
+		},
+		{
+			name:     "custom selector",
+			selector: "app.kubernetes.io/name=awx-operator",
+		},
+		{
+			name:     "custom set-based selector",
+			selector: "app.kubernetes.io/managed-by in (Helm),app.kubernetes.io/instance=awx-operator",
+		},
+		{
+			name:     "custom selector of another release",
+			selector: "app.kubernetes.io/instance=awx-operator-staging",
+			wantErr:  "timeout waiting for operator pods matching app.kubernetes.io/instance=awx-operator-staging",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			if tt.selector != "" {
+				env["AWX_OPERATOR_POD_SELECTOR"] = tt.selector
+			}
+			cluster := k8stest.NewCluster(available.DeepCopy(), helmPod.DeepCopy())
+			installer := NewOperatorInstaller(cluster.Client, testConfig(t, env))
+			installer.podInterval = 10 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			err := installer.waitForOperatorReady(ctx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("waitForOperatorReady() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("waitForOperatorReady() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package operator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// patchTarget selects the objects a patch applies to, like the target of a
+// kustomize patch. Empty fields match any value.
+type patchTarget struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// matches reports whether an object is selected by the target
+func (t patchTarget) matches(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return (t.Group == "" || t.Group == gvk.Group) &&
+		(t.Version == "" || t.Version == gvk.Version) &&
+		(t.Kind == "" || t.Kind == gvk.Kind) &&
+		(t.Name == "" || t.Name == obj.GetName()) &&
+		(t.Namespace == "" || t.Namespace == obj.GetNamespace())
+}
+
+func (t patchTarget) String() string {
+	return fmt.Sprintf("%s %s", t.Kind, t.Name)
+}
+
+// patch is a patch layered onto the operator manifests. A patch file holds
+// one or more YAML documents in the forms kustomize accepts:
+//
+//   - a strategic merge patch: a partial object naming its target by
+//     apiVersion, kind and metadata.name
+//   - a patch with a target: the objects selected by target are patched with
+//     patch, either a list of JSON 6902 operations or a strategic merge patch
+//
+// Kinds the client does not know, like custom resources, get a JSON merge
+// patch instead of a strategic merge patch.
+type patch struct {
+	source string
+	target patchTarget
+	merge  []byte          // strategic merge patch, as JSON
+	ops    jsonpatch.Patch // JSON 6902 operations
+}
+
+// patchWithTarget is a patch document with an explicit target
+type patchWithTarget struct {
+	Target *patchTarget `json:"target"`
+	Patch  string       `json:"patch"`
+}
+
+// readPatches reads the patch files in the given order
+func readPatches(paths []string) ([]patch, error) {
+	var patches []patch
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operator patch %s: %v", path, err)
+		}
+
+		decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+		for {
+			doc := map[string]interface{}{}
+			if err := decoder.Decode(&doc); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("failed to decode operator patch %s: %v", path, err)
+			}
+			if len(doc) == 0 {
+				continue
+			}
+
+			p, err := parsePatch(path, doc)
+			if err != nil {
+				return nil, err
+			}
+			patches = append(patches, p)
+		}
+	}
+	return patches, nil
+}
+
+// parsePatch parses a patch document of a patch file
+func parsePatch(source string, doc map[string]interface{}) (patch, error) {
+	if _, ok := doc["target"]; !ok {
+		return parseMergePatch(source, doc)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return patch{}, fmt.Errorf("failed to encode operator patch %s: %v", source, err)
+	}
+	var withTarget patchWithTarget
+	if err := json.Unmarshal(data, &withTarget); err != nil || withTarget.Target == nil {
+		return patch{}, fmt.Errorf("invalid operator patch %s: expected target and patch", source)
+	}
+	if withTarget.Patch == "" {
+		return patch{}, fmt.Errorf("invalid operator patch %s: patch for %s is empty", source, withTarget.Target)
+	}
+
+	patchJSON, err := yaml.YAMLToJSON([]byte(withTarget.Patch))
+	if err != nil {
+		return patch{}, fmt.Errorf("failed to decode operator patch %s: %v", source, err)
+	}
+	p := patch{source: source, target: *withTarget.Target}
+	if bytes.HasPrefix(bytes.TrimSpace(patchJSON), []byte("[")) {
+		if p.ops, err = jsonpatch.DecodePatch(patchJSON); err != nil {
+			return patch{}, fmt.Errorf("invalid JSON patch in operator patch %s: %v", source, err)
+		}
+	} else {
+		p.merge = patchJSON
+	}
+	return p, nil
+}
+
+// parseMergePatch parses a strategic merge patch, which names its target
+func parseMergePatch(source string, doc map[string]interface{}) (patch, error) {
+	obj := &unstructured.Unstructured{Object: doc}
+	gvk := obj.GroupVersionKind()
+	if gvk.Kind == "" || obj.GetName() == "" {
+		return patch{}, fmt.Errorf("invalid operator patch %s: a strategic merge patch needs apiVersion, kind and metadata.name", source)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return patch{}, fmt.Errorf("failed to encode operator patch %s: %v", source, err)
+	}
+	return patch{
+		source: source,
+		target: patchTarget{
+			Group:     gvk.Group,
+			Version:   gvk.Version,
+			Kind:      gvk.Kind,
+			Name:      obj.GetName(),
+			Namespace: obj.GetNamespace(),
+		},
+		merge: data,
+	}, nil
+}
+
+// applyPatches applies the patches in order to the objects they target.
+// A patch that targets no object or cannot be applied is an error.
+func applyPatches(objs []*unstructured.Unstructured, patches []patch) error {
+	for _, p := range patches {
+		matched := 0
+		for _, obj := range objs {
+			if !p.target.matches(obj) {
+				continue
+			}
+			matched++
+			if err := p.apply(obj); err != nil {
+				return fmt.Errorf("failed to apply operator patch %s to %s %s: %v", p.source, obj.GetKind(), obj.GetName(), err)
+			}
+		}
+		if matched == 0 {
+			return fmt.Errorf("operator patch %s targets %s, which is not in the operator manifests", p.source, p.target)
+		}
+	}
+	return nil
+}
+
+// apply patches an object in place
+func (p patch) apply(obj *unstructured.Unstructured) error {
+	original, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	if p.ops != nil {
+		patched, err = p.ops.Apply(original)
+	} else {
+		patched, err = mergePatch(obj.GroupVersionKind(), original, p.merge)
+	}
+	if err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return err
+	}
+	gvk, name := obj.GroupVersionKind(), obj.GetName()
+	obj.Object = result
+	if obj.GroupVersionKind() != gvk || obj.GetName() != name {
+		return fmt.Errorf("patches must not change the apiVersion, kind or name")
+	}
+	return nil
+}
+
+// mergePatch applies a strategic merge patch for kinds the client knows and
+// a JSON merge patch for others
+func mergePatch(gvk schema.GroupVersionKind, original, patch []byte) ([]byte, error) {
+	typed, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		return jsonpatch.MergePatch(original, patch)
+	}
+	return strategicpatch.StrategicMergePatch(original, patch, typed)
+}
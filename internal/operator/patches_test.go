@@ -0,0 +1,179 @@
+package operator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestOperatorKustomizePatches(t *testing.T) {
+	imagePatch := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: awx-operator-controller-manager
+spec:
+  template:
+    spec:
+      containers:
+      - name: awx-manager
+        image: registry.local/awx-operator:2.5.0-patched
+`
+	jsonPatch := `target:
+  kind: Deployment
+  name: awx-operator-controller-manager
+patch: |
+  - op: replace
+    path: /spec/template/spec/containers/0/image
+    value: registry.local/awx-operator:json
+`
+	labelPatch := `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: awx-operator-controller-manager
+  labels:
+    team: platform
+`
+
+	tests := []struct {
+		name string
+		// patches are the contents of the patch files, in order
+		patches   []string
+		wantImage string
+		wantLabel string
+		wantErr   string
+	}{
+		{
+			name:      "no patches",
+			wantImage: "quay.io/ansible/awx-operator:2.5.0",
+		},
+		{
+			name:      "strategic merge patch changes the image",
+			patches:   []string{imagePatch},
+			wantImage: "registry.local/awx-operator:2.5.0-patched",
+		},
+		{
+			name:      "JSON patch with a target",
+			patches:   []string{jsonPatch},
+			wantImage: "registry.local/awx-operator:json",
+		},
+		{
+			name:      "later patches apply on top",
+			patches:   []string{imagePatch, jsonPatch},
+			wantImage: "registry.local/awx-operator:json",
+		},
+		{
+			name:      "several documents in one file",
+			patches:   []string{imagePatch + "---\n" + labelPatch},
+			wantImage: "registry.local/awx-operator:2.5.0-patched",
+			wantLabel: "platform",
+		},
+		{
+			name: "target not in the manifests",
+			patches: []string{`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: other-operator
+spec:
+  replicas: 2
+`},
+			wantErr: "targets Deployment other-operator, which is not in the operator manifests",
+		},
+		{
+			name: "JSON patch does not apply",
+			patches: []string{`target:
+  kind: Deployment
+patch: |
+  - op: replace
+    path: /spec/template/spec/volumes/0/name
+    value: data
+`},
+			wantErr: "failed to apply operator patch",
+		},
+		{
+			name: "merge patch without a name",
+			patches: []string{`apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: 2
+`},
+			wantErr: "a strategic merge patch needs apiVersion, kind and metadata.name",
+		},
+		{
+			name: "target without a patch",
+			patches: []string{`target:
+  kind: Deployment
+`},
+			wantErr: "is empty",
+		},
+		{
+			name: "patch renames its target",
+			patches: []string{`target:
+  kind: ServiceAccount
+patch: |
+  - op: replace
+    path: /metadata/name
+    value: renamed
+`},
+			wantErr: "patches must not change the apiVersion, kind or name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var paths []string
+			for i, content := range tt.patches {
+				path := filepath.Join(dir, fmt.Sprintf("patch-%d.yaml", i))
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				paths = append(paths, path)
+			}
+			cfg := testConfig(t, map[string]string{
+				"AWX_NAMESPACE":                  "awx",
+				"AWX_OPERATOR_MANIFEST_PATH":     filepath.Join("testdata", "awx-operator.yaml"),
+				"AWX_OPERATOR_KUSTOMIZE_PATCHES": strings.Join(paths, ","),
+			})
+
+			objs, err := Objects(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Objects() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Objects() failed: %v", err)
+			}
+
+			for _, obj := range objs {
+				switch obj.GetKind() {
+				case "Deployment":
+					containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+					if len(containers) != 1 {
+						t.Fatalf("containers = %v, want the manager container only", containers)
+					}
+					image, _, _ := unstructured.NestedString(containers[0].(map[string]interface{}), "image")
+					if image != tt.wantImage {
+						t.Errorf("operator image = %q, want %q", image, tt.wantImage)
+					}
+				case "ServiceAccount":
+					if label := obj.GetLabels()["team"]; label != tt.wantLabel {
+						t.Errorf("ServiceAccount label team = %q, want %q", label, tt.wantLabel)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadPatchesMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := readPatches([]string{path}); err == nil || !strings.Contains(err.Error(), "failed to read operator patch") {
+		t.Errorf("readPatches(%s) error = %v, want a read error", path, err)
+	}
+}
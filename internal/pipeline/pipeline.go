@@ -0,0 +1,428 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/deploy"
+	"awx-deployer/internal/events"
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/operator"
+)
+
+// Step is a single named stage of the deployment
+type Step struct {
+	Name string
+	Run  func(context.Context) error
+
+	// Satisfied checks that what the step provides is already in place, for
+	// when AWX_STEPS leaves it out but a later step needs it. Nil if no step
+	// needs it.
+	Satisfied func(context.Context) error
+}
+
+// stepDependencies maps steps to the step they need to have run before.
+// Verify needs nothing, it checks the whole deployment itself.
+var stepDependencies = map[string]string{
+	"apply": "operator",
+	"wait":  "apply",
+}
+
+// Pipeline runs the deployment steps in order
+type Pipeline struct {
+	k8sClient *k8s.KubernetesClient
+	config    *config.Config
+	tracer    trace.Tracer
+	steps     []Step
+	emitter   *events.Emitter
+
+	// awxVersion is the AWX version the verify step found running
+	awxVersion string
+	// appliedAt is when the apply step applied the AWX CR, zero if it did
+	// not run or did not apply the CR
+	appliedAt time.Time
+	// readyTiming is when the wait step saw the components ready
+	readyTiming deploy.ReadyTiming
+}
+
+// NewPipeline creates the deployment pipeline: preflight, operator install,
+// apply, wait and verify
+func NewPipeline(k8sClient *k8s.KubernetesClient, config *config.Config, tracer trace.Tracer) *Pipeline {
+	p := &Pipeline{
+		k8sClient: k8sClient,
+		config:    config,
+		tracer:    tracer,
+	}
+
+	p.steps = []Step{
+		{Name: "preflight", Run: p.preflight},
+		{Name: "operator", Run: p.installOperator, Satisfied: p.operatorInstalled},
+		{Name: "apply", Run: p.apply, Satisfied: p.awxApplied},
+		{Name: "wait", Run: p.wait},
+		{Name: "verify", Run: p.verify},
+	}
+	return p
+}
+
+// Events returns a channel of progress events for the next Run, buffered
+// with the given size. The subscriber must read until the channel is
+// closed, which Run does when it returns.
+func (p *Pipeline) Events(buffer int) <-chan events.Event {
+	p.emitter = events.NewEmitter(buffer)
+	return p.emitter.Events()
+}
+
+// AWXVersion returns the AWX version the verify step of the last Run found
+// running, or empty if it did not run or could not determine it
+func (p *Pipeline) AWXVersion() string {
+	return p.awxVersion
+}
+
+// ReadyTiming returns when the wait step of the last Run saw each component
+// ready, with no components if it did not run or failed
+func (p *Pipeline) ReadyTiming() deploy.ReadyTiming {
+	return p.readyTiming
+}
+
+// PermanentError marks a failure that retrying the pipeline cannot fix, like
+// a failed preflight check
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Run runs the steps AWX_STEPS selects, stopping at the first failure. A failed run is
+// attempted again up to AWX_PIPELINE_RETRIES times, which is safe because
+// every step skips or updates what earlier attempts created. Permanent
+// errors are not retried. Each step is recorded as a span under a parent
+// span for the whole deployment.
+func (p *Pipeline) Run(ctx context.Context) error {
+	defer p.emitter.Close()
+
+	ctx, span := p.tracer.Start(ctx, "deploy", trace.WithAttributes(p.attributes()...))
+	defer span.End()
+
+	steps, err := p.selectSteps(ctx)
+	if err == nil {
+		err = p.checkFailAt()
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	attempts := p.config.PipelineRetries + 1
+	delay := time.Duration(p.config.PipelineRetryDelay) * time.Second
+
+	for attempt := 1; ; attempt++ {
+		err := p.runSteps(ctx, steps)
+		if err == nil {
+			return nil
+		}
+
+		var permanent *PermanentError
+		if errors.As(err, &permanent) || attempt >= attempts {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		log.Printf("Deployment attempt %d of %d failed: %v", attempt, attempts, err)
+		log.Printf("Retrying in %v...", delay)
+		p.emitter.Emit(events.Event{Step: "deploy", Phase: events.PhaseProgress, Message: fmt.Sprintf("attempt %d of %d failed, retrying in %v", attempt, attempts, delay), Err: err})
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("awx.attempt", attempt), attribute.String("error", err.Error())))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v (retry cancelled: %v)", err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// selectSteps returns the steps AWX_STEPS selects. The names must be known
+// and in pipeline order. A selected step whose dependency is left out runs
+// only if what the dependency provides is already in place, e.g. wait
+// without apply needs an existing AWX instance.
+func (p *Pipeline) selectSteps(ctx context.Context) ([]Step, error) {
+	index := make(map[string]int, len(p.steps))
+	for i, step := range p.steps {
+		index[step.Name] = i
+	}
+
+	if len(p.config.Steps) == 0 {
+		return nil, &PermanentError{Err: fmt.Errorf("AWX_STEPS selects no steps")}
+	}
+	var steps []Step
+	selected := make(map[string]bool)
+	last := -1
+	for _, name := range p.config.Steps {
+		i, ok := index[name]
+		if !ok {
+			return nil, &PermanentError{Err: fmt.Errorf("unknown step %q in AWX_STEPS (expected preflight, operator, apply, wait or verify)", name)}
+		}
+		if selected[name] {
+			return nil, &PermanentError{Err: fmt.Errorf("step %s is listed twice in AWX_STEPS", name)}
+		}
+		if i < last {
+			return nil, &PermanentError{Err: fmt.Errorf("step %s must come before %s in AWX_STEPS", name, p.steps[last].Name)}
+		}
+		last = i
+		selected[name] = true
+		steps = append(steps, p.steps[i])
+	}
+	if len(steps) == len(p.steps) {
+		return steps, nil
+	}
+
+	for _, step := range steps {
+		dependency, ok := stepDependencies[step.Name]
+		if !ok || selected[dependency] {
+			continue
+		}
+		if err := p.steps[index[dependency]].Satisfied(ctx); err != nil {
+			return nil, &PermanentError{Err: fmt.Errorf("step %s needs %s, which AWX_STEPS leaves out: %v", step.Name, dependency, err)}
+		}
+		log.Printf("Skipping step %s, which step %s needs, as it is already in place", dependency, step.Name)
+	}
+
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = step.Name
+	}
+	log.Printf("Running only the steps %s (AWX_STEPS)", strings.Join(names, ", "))
+	return steps, nil
+}
+
+// permanentSteps are the steps whose failures retrying cannot fix, which an
+// injected failure of the step is marked as too
+var permanentSteps = map[string]bool{"preflight": true}
+
+// checkFailAt checks that AWX_FAIL_AT names a step and warns that the run is
+// going to fail on purpose
+func (p *Pipeline) checkFailAt() error {
+	if p.config.FailAt == "" {
+		return nil
+	}
+	for _, step := range p.steps {
+		if step.Name == p.config.FailAt {
+			log.Printf("Warning: AWX_FAIL_AT is set, step %s is going to fail on purpose. It is a testing aid, never set it for a real deployment.", p.config.FailAt)
+			return nil
+		}
+	}
+	return &PermanentError{Err: fmt.Errorf("unknown step %q in AWX_FAIL_AT (expected preflight, operator, apply, wait or verify)", p.config.FailAt)}
+}
+
+// injectedFailure returns the failure AWX_FAIL_AT injects into a step, with
+// the type a real failure of the step has, or nil if the step runs normally
+func (p *Pipeline) injectedFailure(step Step) error {
+	if step.Name != p.config.FailAt {
+		return nil
+	}
+	err := fmt.Errorf("%s failed: injected failure (AWX_FAIL_AT=%s)", step.Name, p.config.FailAt)
+	if permanentSteps[step.Name] {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
+
+// runSteps runs the given steps once, stopping at the first failure
+func (p *Pipeline) runSteps(ctx context.Context, steps []Step) error {
+	for _, step := range steps {
+		if err := p.runStep(ctx, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runStep runs a single step inside its own span and emits its start and
+// its outcome
+func (p *Pipeline) runStep(ctx context.Context, step Step) error {
+	ctx, span := p.tracer.Start(ctx, step.Name, trace.WithAttributes(p.attributes()...))
+	defer span.End()
+
+	p.emitter.Emit(events.Event{Step: step.Name, Phase: events.PhaseStart})
+	err := p.injectedFailure(step)
+	if err == nil {
+		err = step.Run(events.WithStep(ctx, p.emitter, step.Name))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		p.emitter.Emit(events.Event{Step: step.Name, Phase: events.PhaseFail, Message: err.Error(), Err: err})
+		return err
+	}
+	p.emitter.Emit(events.Event{Step: step.Name, Phase: events.PhaseComplete})
+	return nil
+}
+
+// attributes identifies the deployment on every span
+func (p *Pipeline) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("awx.namespace", p.config.Namespace),
+		attribute.String("awx.name", p.config.AWXName),
+		attribute.String("awx.operator_version", p.config.OperatorVersion),
+	}
+}
+
+// preflight checks the namespaces, the AWX image version against the
+// operator version, that the cluster is reachable, the PodSecurity level of
+// the AWX namespace, that no other AWX instance shares its external
+// database and optionally that it can reach the image registries before
+// changing anything
+func (p *Pipeline) preflight(ctx context.Context) error {
+	if err := deploy.NewNamespaceChecker(p.config).Check(); err != nil {
+		return &PermanentError{Err: fmt.Errorf("preflight failed: %v", err)}
+	}
+	if err := deploy.NewVersionSkewChecker(p.config).Check(); err != nil {
+		return &PermanentError{Err: fmt.Errorf("preflight failed: %v", err)}
+	}
+
+	version, err := p.k8sClient.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("preflight failed: cannot reach the cluster: %v", err)
+	}
+	log.Printf("Connected to Kubernetes %s", version)
+
+	if err := deploy.NewPSAChecker(p.k8sClient, p.config).Check(ctx); err != nil {
+		return &PermanentError{Err: fmt.Errorf("preflight failed: %v", err)}
+	}
+	if err := deploy.NewDatabaseConflictChecker(p.k8sClient, p.config).Check(ctx); err != nil {
+		return &PermanentError{Err: fmt.Errorf("preflight failed: %v", err)}
+	}
+
+	if p.config.SkipOperatorInstall {
+		if err := operator.NewOperatorInstaller(p.k8sClient, p.config).CheckExisting(ctx); err != nil {
+			return &PermanentError{Err: fmt.Errorf("preflight failed: %v", err)}
+		}
+		if err := deploy.NewOperatorScopeChecker(p.k8sClient, p.config).Check(ctx); err != nil {
+			return &PermanentError{Err: fmt.Errorf("preflight failed: %v", err)}
+		}
+	}
+
+	if p.config.CheckEgress {
+		if err := deploy.NewEgressChecker(p.k8sClient, p.config).Check(ctx); err != nil {
+			return &PermanentError{Err: fmt.Errorf("preflight failed: %v", err)}
+		}
+	}
+	return nil
+}
+
+// installOperator installs the AWX operator unless it is managed by others
+func (p *Pipeline) installOperator(ctx context.Context) error {
+	if p.config.SkipOperatorInstall {
+		log.Println("AWX_SKIP_OPERATOR_INSTALL is set, using the existing AWX Operator")
+		return nil
+	}
+
+	if err := operator.NewOperatorInstaller(p.k8sClient, p.config).Install(ctx); err != nil {
+		return fmt.Errorf("failed to install AWX operator: %v", err)
+	}
+	return nil
+}
+
+// operatorInstalled checks that the AWX operator is installed
+func (p *Pipeline) operatorInstalled(ctx context.Context) error {
+	installed, err := operator.NewOperatorInstaller(p.k8sClient, p.config).Installed(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if operator exists: %v", err)
+	}
+	if !installed {
+		return fmt.Errorf("operator deployment awx-operator-controller-manager does not exist in namespace %s", p.config.OperatorNamespace)
+	}
+	return nil
+}
+
+// apply creates the TLS secret and applies the manifests, then makes the
+// operator reconcile at once if AWX_FORCE_RECONCILE is set. Admin credentials
+// of an existing install are rotated before the admin password secret is
+// overwritten.
+func (p *Pipeline) apply(ctx context.Context) error {
+	rotator := deploy.NewAdminRotator(p.k8sClient, p.config)
+	if err := rotator.KeepGeneratedPassword(ctx); err != nil {
+		return fmt.Errorf("failed to read the existing admin password: %v", err)
+	}
+	if err := rotator.Rotate(ctx); err != nil {
+		return fmt.Errorf("failed to rotate admin credentials: %v", err)
+	}
+
+	if err := deploy.NewTLSSecretApplier(p.k8sClient, p.config).Apply(ctx); err != nil {
+		return fmt.Errorf("failed to create TLS secret: %v", err)
+	}
+
+	applier := deploy.NewManifestApplier(p.k8sClient, p.config)
+	if err := applier.Apply(ctx); err != nil {
+		return fmt.Errorf("failed to apply manifests: %v", err)
+	}
+	p.appliedAt = applier.AWXAppliedAt()
+
+	if err := deploy.NewReconcileNudger(p.k8sClient, p.config).Nudge(ctx); err != nil {
+		return fmt.Errorf("failed to force a reconcile: %v", err)
+	}
+	return nil
+}
+
+// awxApplied checks that the AWX instance exists
+func (p *Pipeline) awxApplied(ctx context.Context) error {
+	exists, err := p.k8sClient.AWXExists(ctx, p.config.AWXName, p.config.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to check if AWX instance exists: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("AWX instance %s does not exist in namespace %s", p.config.AWXName, p.config.Namespace)
+	}
+	return nil
+}
+
+// wait waits for the AWX deployment to become ready and keeps how long each
+// component took after the apply step
+func (p *Pipeline) wait(ctx context.Context) error {
+	waiter := deploy.NewDeploymentWaiter(p.k8sClient, p.config)
+	waiter.SetAppliedAt(p.appliedAt)
+	if err := waiter.WaitForReady(ctx, time.Duration(p.config.WaitTimeout)*time.Minute); err != nil {
+		return fmt.Errorf("deployment failed to become ready: %v", err)
+	}
+	p.readyTiming = waiter.Timing()
+	return nil
+}
+
+// verify verifies the AWX deployment and then creates an API token if
+// enabled, since that needs a healthy AWX. With AWX_INSTANCE_SELECTOR it
+// verifies each matching instance instead and creates no token.
+func (p *Pipeline) verify(ctx context.Context) error {
+	if p.config.InstanceSelector != "" {
+		if _, err := deploy.NewDeploymentVerifier(p.k8sClient, p.config).VerifyInstances(ctx); err != nil {
+			return fmt.Errorf("deployment verification failed: %v", err)
+		}
+		return nil
+	}
+
+	verifier := deploy.NewDeploymentVerifier(p.k8sClient, p.config)
+	if err := verifier.Verify(ctx); err != nil {
+		return fmt.Errorf("deployment verification failed: %v", err)
+	}
+	p.awxVersion = verifier.RunningVersion()
+
+	if err := deploy.NewAPITokenIssuer(p.k8sClient, p.config).Issue(ctx); err != nil {
+		return fmt.Errorf("failed to emit AWX API token: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,641 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"awx-deployer/internal/config"
+	"awx-deployer/internal/events"
+	"awx-deployer/internal/k8s"
+	"awx-deployer/internal/k8s/k8stest"
+)
+
+// testConfig creates a Config from the given env vars, on top of an
+// environment without any AWX_ variable
+func testConfig(t *testing.T, env map[string]string) *config.Config {
+	t.Helper()
+	for _, entry := range os.Environ() {
+		if key := strings.SplitN(entry, "=", 2)[0]; strings.HasPrefix(key, "AWX_") {
+			t.Setenv(key, "")
+		}
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Fatalf("NewConfigFromEnv() failed: %v", err)
+	}
+	return cfg
+}
+
+// stubPipeline creates a pipeline whose steps only fail the given number of
+// times each, tracing into the returned recorder
+func stubPipeline(t *testing.T, env map[string]string, failures map[string]int) (*Pipeline, *tracetest.SpanRecorder) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	p := NewPipeline(nil, testConfig(t, env), provider.Tracer("test"))
+	for i := range p.steps {
+		name := p.steps[i].Name
+		p.steps[i].Run = func(context.Context) error {
+			if failures[name] > 0 {
+				failures[name]--
+				return errors.New(name + " failed")
+			}
+			return nil
+		}
+	}
+	return p, recorder
+}
+
+func TestRunSpans(t *testing.T) {
+	env := map[string]string{
+		"AWX_NAMESPACE":        "awx-test",
+		"AWX_NAME":             "tower",
+		"AWX_OPERATOR_VERSION": "2.5.0",
+	}
+	wantAttributes := []attribute.KeyValue{
+		attribute.String("awx.namespace", "awx-test"),
+		attribute.String("awx.name", "tower"),
+		attribute.String("awx.operator_version", "2.5.0"),
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		failures map[string]int
+		wantErr  bool
+		// wantSpans are the ended spans in order, with the failed ones
+		wantSpans  []string
+		wantFailed []string
+		wantRetry  bool
+	}{
+		{
+			name:      "all steps succeed",
+			wantSpans: []string{"preflight", "operator", "apply", "wait", "verify", "deploy"},
+		},
+		{
+			name:       "failed step",
+			failures:   map[string]int{"apply": 1},
+			wantErr:    true,
+			wantSpans:  []string{"preflight", "operator", "apply", "deploy"},
+			wantFailed: []string{"apply", "deploy"},
+		},
+		{
+			name:       "failed attempt retried",
+			env:        map[string]string{"AWX_PIPELINE_RETRIES": "1", "AWX_PIPELINE_RETRY_DELAY": "0"},
+			failures:   map[string]int{"wait": 1},
+			wantSpans:  []string{"preflight", "operator", "apply", "wait", "preflight", "operator", "apply", "wait", "verify", "deploy"},
+			wantFailed: []string{"wait"},
+			wantRetry:  true,
+		},
+		{
+			name:      "selected steps only",
+			env:       map[string]string{"AWX_STEPS": "preflight,verify"},
+			wantSpans: []string{"preflight", "verify", "deploy"},
+		},
+		{
+			name:       "invalid step selection",
+			env:        map[string]string{"AWX_STEPS": "verify,preflight"},
+			wantErr:    true,
+			wantSpans:  []string{"deploy"},
+			wantFailed: []string{"deploy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnv := map[string]string{}
+			for key, value := range env {
+				testEnv[key] = value
+			}
+			for key, value := range tt.env {
+				testEnv[key] = value
+			}
+			failures := map[string]int{}
+			for key, value := range tt.failures {
+				failures[key] = value
+			}
+			p, recorder := stubPipeline(t, testEnv, failures)
+
+			err := p.Run(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			spans := recorder.Ended()
+			var names, failed []string
+			for _, span := range spans {
+				names = append(names, span.Name())
+				if span.Status().Code == codes.Error {
+					failed = append(failed, span.Name())
+				}
+				if !reflect.DeepEqual(span.Attributes(), wantAttributes) {
+					t.Errorf("span %s attributes = %v, want %v", span.Name(), span.Attributes(), wantAttributes)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.wantSpans) {
+				t.Errorf("spans = %v, want %v", names, tt.wantSpans)
+			}
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("failed spans = %v, want %v", failed, tt.wantFailed)
+			}
+
+			deploy := spans[len(spans)-1]
+			for _, span := range spans[:len(spans)-1] {
+				if span.Parent().SpanID() != deploy.SpanContext().SpanID() {
+					t.Errorf("span %s is not a child of the deploy span", span.Name())
+				}
+			}
+			retried := false
+			for _, event := range deploy.Events() {
+				if event.Name == "retry" {
+					retried = true
+				}
+			}
+			if retried != tt.wantRetry {
+				t.Errorf("deploy span retry event = %v, want %v", retried, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		retries  string
+		failures map[string]int
+		// permanent makes the apply step fail with a PermanentError
+		permanent    bool
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "succeeds first time",
+			retries:      "2",
+			wantAttempts: 1,
+		},
+		{
+			name:         "fails once then succeeds",
+			retries:      "2",
+			failures:     map[string]int{"apply": 1},
+			wantAttempts: 2,
+		},
+		{
+			name:         "fails on every attempt",
+			retries:      "2",
+			failures:     map[string]int{"wait": 5},
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "no retries",
+			retries:      "0",
+			failures:     map[string]int{"wait": 1},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "permanent error",
+			retries:      "2",
+			permanent:    true,
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWX_PIPELINE_RETRIES": tt.retries, "AWX_PIPELINE_RETRY_DELAY": "0"}
+			failures := map[string]int{}
+			for key, value := range tt.failures {
+				failures[key] = value
+			}
+			p, _ := stubPipeline(t, env, failures)
+
+			attempts := 0
+			for i := range p.steps {
+				switch run := p.steps[i].Run; p.steps[i].Name {
+				case "preflight":
+					p.steps[i].Run = func(ctx context.Context) error {
+						attempts++
+						return run(ctx)
+					}
+				case "apply":
+					if tt.permanent {
+						p.steps[i].Run = func(context.Context) error {
+							return &PermanentError{Err: errors.New("apply failed: invalid AWX spec")}
+						}
+					}
+				}
+			}
+
+			err := p.Run(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, want error %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRunEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		failures map[string]int
+		wantErr  bool
+		// want are the events as "step phase[: message]"
+		want []string
+	}{
+		{
+			name: "all steps succeed",
+			want: []string{
+				"preflight start", "preflight complete",
+				"operator start", "operator complete",
+				"apply start", "apply progress: applying manifests", "apply complete",
+				"wait start", "wait complete",
+				"verify start", "verify complete",
+			},
+		},
+		{
+			name:     "failed step",
+			failures: map[string]int{"wait": 1},
+			wantErr:  true,
+			want: []string{
+				"preflight start", "preflight complete",
+				"operator start", "operator complete",
+				"apply start", "apply progress: applying manifests", "apply complete",
+				"wait start", "wait fail: wait failed",
+			},
+		},
+		{
+			name:     "failed attempt retried",
+			env:      map[string]string{"AWX_PIPELINE_RETRIES": "1", "AWX_PIPELINE_RETRY_DELAY": "0"},
+			failures: map[string]int{"apply": 1},
+			want: []string{
+				"preflight start", "preflight complete",
+				"operator start", "operator complete",
+				"apply start", "apply progress: applying manifests", "apply fail: apply failed",
+				"deploy progress: attempt 1 of 2 failed, retrying in 0s",
+				"preflight start", "preflight complete",
+				"operator start", "operator complete",
+				"apply start", "apply progress: applying manifests", "apply complete",
+				"wait start", "wait complete",
+				"verify start", "verify complete",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := map[string]int{}
+			for key, value := range tt.failures {
+				failures[key] = value
+			}
+			p, _ := stubPipeline(t, tt.env, failures)
+			for i := range p.steps {
+				if run := p.steps[i].Run; p.steps[i].Name == "apply" {
+					p.steps[i].Run = func(ctx context.Context) error {
+						events.Progressf(ctx, "applying manifests")
+						return run(ctx)
+					}
+				}
+			}
+			// a buffer of one makes Run wait for the subscriber
+			ch := p.Events(1)
+
+			var got []string
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for event := range ch {
+					entry := event.Step + " " + string(event.Phase)
+					if event.Message != "" {
+						entry += ": " + event.Message
+					}
+					if event.Timestamp.IsZero() {
+						t.Errorf("event %q has no timestamp", entry)
+					}
+					got = append(got, entry)
+				}
+			}()
+
+			err := p.Run(context.Background())
+			// the channel is closed when Run returns
+			<-done
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// chdir changes to a directory for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestSkipOperatorInstall(t *testing.T) {
+	// preflight reads the static manifests from the working directory
+	chdir(t, "../..")
+
+	crd := k8stest.Object("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", k8s.AWXResource+"."+k8s.AWXGroup)
+	unstructured.SetNestedField(crd.Object, k8s.AWXGroup, "spec", "group")
+	unstructured.SetNestedField(crd.Object, "AWX", "spec", "names", "kind")
+	unstructured.SetNestedField(crd.Object, "Namespaced", "spec", "scope")
+	unstructured.SetNestedSlice(crd.Object, []interface{}{
+		map[string]interface{}{"type": "Established", "status": "True"},
+	}, "status", "conditions")
+	operator := []runtime.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "awx-operator-controller-manager", Namespace: "awx"}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "awx-operator-controller-manager-0", Namespace: "awx", Labels: map[string]string{"control-plane": "controller-manager"}},
+			Status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		},
+		crd,
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		objects []runtime.Object
+		// wantPreflightErr is empty when preflight passes
+		wantPreflightErr string
+	}{
+		{
+			name: "operator installed by the deployer",
+		},
+		{
+			name:    "existing operator",
+			env:     map[string]string{"AWX_SKIP_OPERATOR_INSTALL": "true"},
+			objects: operator,
+		},
+		{
+			name:             "existing operator missing",
+			env:              map[string]string{"AWX_SKIP_OPERATOR_INSTALL": "true"},
+			wantPreflightErr: "AWX_SKIP_OPERATOR_INSTALL is set but operator deployment awx-operator-controller-manager does not exist",
+		},
+		{
+			name:             "existing operator without CRD",
+			env:              map[string]string{"AWX_SKIP_OPERATOR_INSTALL": "true"},
+			objects:          operator[:2],
+			wantPreflightErr: "AWX CRD is not installed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := k8stest.NewCluster(tt.objects...)
+			p := NewPipeline(cluster.Client, testConfig(t, tt.env), nil)
+
+			err := p.preflight(context.Background())
+			if tt.wantPreflightErr != "" {
+				var permanent *PermanentError
+				if err == nil || !strings.Contains(err.Error(), tt.wantPreflightErr) || !errors.As(err, &permanent) {
+					t.Fatalf("preflight() error = %v, want permanent %q", err, tt.wantPreflightErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("preflight() failed: %v", err)
+			}
+			if !p.config.SkipOperatorInstall {
+				return
+			}
+
+			// installing only uses the existing operator
+			cluster.Clientset.ClearActions()
+			cluster.Dynamic.ClearActions()
+			if err := p.installOperator(context.Background()); err != nil {
+				t.Fatalf("installOperator() failed: %v", err)
+			}
+			if actions := append(cluster.Clientset.Actions(), cluster.Dynamic.Actions()...); len(actions) > 0 {
+				t.Errorf("installOperator() called the cluster %d times, want none", len(actions))
+			}
+		})
+	}
+}
+
+func TestRunSelectedSteps(t *testing.T) {
+	operatorDeployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "awx-operator-controller-manager", Namespace: "awx"}}
+	awx := k8stest.AWX("awx", "awx-instance")
+
+	tests := []struct {
+		name    string
+		steps   string
+		objects []runtime.Object
+		// want are the steps that run, in order
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "all steps by default",
+			want: []string{"preflight", "operator", "apply", "wait", "verify"},
+		},
+		{
+			name:  "all steps listed",
+			steps: "preflight,operator,apply,wait,verify",
+			want:  []string{"preflight", "operator", "apply", "wait", "verify"},
+		},
+		{
+			name:  "verify only",
+			steps: "verify",
+			want:  []string{"verify"},
+		},
+		{
+			name:    "preflight and apply with the operator installed",
+			steps:   "preflight,apply",
+			objects: []runtime.Object{operatorDeployment},
+			want:    []string{"preflight", "apply"},
+		},
+		{
+			name:    "apply without the operator",
+			steps:   "preflight,apply",
+			wantErr: "step apply needs operator, which AWX_STEPS leaves out: operator deployment awx-operator-controller-manager does not exist in namespace awx",
+		},
+		{
+			name:    "wait with an existing AWX instance",
+			steps:   "wait,verify",
+			objects: []runtime.Object{awx},
+			want:    []string{"wait", "verify"},
+		},
+		{
+			name:    "wait without an AWX instance",
+			steps:   "wait",
+			wantErr: "step wait needs apply, which AWX_STEPS leaves out: AWX instance awx-instance does not exist in namespace awx",
+		},
+		{
+			name:    "unknown step",
+			steps:   "preflight,deploy",
+			wantErr: `unknown step "deploy" in AWX_STEPS`,
+		},
+		{
+			name:    "step listed twice",
+			steps:   "verify,verify",
+			wantErr: "step verify is listed twice in AWX_STEPS",
+		},
+		{
+			name:    "steps out of order",
+			steps:   "verify,preflight",
+			wantErr: "step preflight must come before verify in AWX_STEPS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := stubPipeline(t, map[string]string{"AWX_NAMESPACE": "awx", "AWX_STEPS": tt.steps}, nil)
+			p.k8sClient = k8stest.NewCluster(tt.objects...).Client
+
+			var ran []string
+			for i := range p.steps {
+				name, run := p.steps[i].Name, p.steps[i].Run
+				p.steps[i].Run = func(ctx context.Context) error {
+					ran = append(ran, name)
+					return run(ctx)
+				}
+			}
+
+			err := p.Run(context.Background())
+			if tt.wantErr != "" {
+				var permanent *PermanentError
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !errors.As(err, &permanent) {
+					t.Fatalf("Run() error = %v, want permanent error %q", err, tt.wantErr)
+				}
+				if len(ran) > 0 {
+					t.Errorf("steps %v ran, want none", ran)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() failed: %v", err)
+			}
+			if !reflect.DeepEqual(ran, tt.want) {
+				t.Errorf("steps run = %v, want %v", ran, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunFailAt(t *testing.T) {
+	tests := []struct {
+		failAt string
+		// want are the steps that ran before the injected failure, on the
+		// last attempt
+		want          []string
+		wantErr       string
+		wantPermanent bool
+		wantAttempts  int
+	}{
+		{
+			failAt:        "preflight",
+			wantErr:       "preflight failed: injected failure (AWX_FAIL_AT=preflight)",
+			wantPermanent: true,
+			wantAttempts:  1,
+		},
+		{
+			failAt:       "operator",
+			want:         []string{"preflight"},
+			wantErr:      "operator failed: injected failure (AWX_FAIL_AT=operator)",
+			wantAttempts: 2,
+		},
+		{
+			failAt:       "apply",
+			want:         []string{"preflight", "operator"},
+			wantErr:      "apply failed: injected failure (AWX_FAIL_AT=apply)",
+			wantAttempts: 2,
+		},
+		{
+			failAt:       "wait",
+			want:         []string{"preflight", "operator", "apply"},
+			wantErr:      "wait failed: injected failure (AWX_FAIL_AT=wait)",
+			wantAttempts: 2,
+		},
+		{
+			failAt:       "verify",
+			want:         []string{"preflight", "operator", "apply", "wait"},
+			wantErr:      "verify failed: injected failure (AWX_FAIL_AT=verify)",
+			wantAttempts: 2,
+		},
+		{
+			failAt:        "install",
+			wantErr:       `unknown step "install" in AWX_FAIL_AT`,
+			wantPermanent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.failAt, func(t *testing.T) {
+			env := map[string]string{"AWX_FAIL_AT": tt.failAt, "AWX_PIPELINE_RETRIES": "1", "AWX_PIPELINE_RETRY_DELAY": "0"}
+			p, recorder := stubPipeline(t, env, nil)
+
+			var ran []string
+			for i := range p.steps {
+				name, run := p.steps[i].Name, p.steps[i].Run
+				p.steps[i].Run = func(ctx context.Context) error {
+					if name == "preflight" {
+						ran = nil
+					}
+					ran = append(ran, name)
+					return run(ctx)
+				}
+			}
+
+			err := p.Run(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+			var permanent *PermanentError
+			if errors.As(err, &permanent) != tt.wantPermanent {
+				t.Errorf("Run() error %v is a PermanentError: %v, want %v", err, !tt.wantPermanent, tt.wantPermanent)
+			}
+			if !reflect.DeepEqual(ran, tt.want) {
+				t.Errorf("steps run = %v, want %v", ran, tt.want)
+			}
+
+			// each attempt ends with the failed span of the step
+			attempts := 0
+			for _, span := range recorder.Ended() {
+				if span.Name() == tt.failAt && span.Status().Code == codes.Error {
+					attempts++
+				}
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
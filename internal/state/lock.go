@@ -0,0 +1,246 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// LockHeldError is returned when another deployer holds the lock
+type LockHeldError struct {
+	Lease   string
+	Holder  string
+	Since   time.Time
+	Expires time.Time
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("deploy lock %s is held by %s since %s, it expires at %s unless renewed (use --force to take it over)",
+		e.Lease, e.Holder, e.Since.Format(time.RFC3339), e.Expires.Format(time.RFC3339))
+}
+
+// DeployLock keeps deployers of the same AWX instance from running at once.
+// It is a coordination.k8s.io Lease the holder renews while it runs, so a
+// holder that crashed loses it once the lease is not renewed for its TTL.
+type DeployLock struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	identity  string
+	ttl       time.Duration
+	now       func() time.Time
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewDeployLock creates a new lock backed by the named Lease, which is
+// created when the lock is first acquired
+func NewDeployLock(client kubernetes.Interface, namespace, name, identity string, ttl time.Duration) *DeployLock {
+	return &DeployLock{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		identity:  identity,
+		ttl:       ttl,
+		now:       time.Now,
+	}
+}
+
+// DeployLockName returns the name of the Lease locking the deployment of an
+// AWX instance
+func DeployLockName(namespace, awxName string) string {
+	return "awx-deployer-" + namespace + "-" + awxName
+}
+
+// LockIdentity identifies this process as a lock holder by host name and
+// process ID
+func LockIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
+
+// Acquire takes the lock and keeps renewing it until Release. It fails with
+// a LockHeldError while another holder's lease has not expired, unless
+// force is set.
+func (l *DeployLock) Acquire(ctx context.Context, force bool) error {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	for attempt := 0; ; attempt++ {
+		now := metav1.NewMicroTime(l.now())
+		lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			lease = &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{Name: l.name, Namespace: l.namespace},
+			}
+			l.hold(lease, now)
+			_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) && attempt == 0 {
+				// Created by another deployer in between, look at its holder
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to create Lease %s/%s: %v", l.namespace, l.name, err)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read Lease %s/%s: %v", l.namespace, l.name, err)
+		}
+
+		if holder := holderOf(lease); holder != "" && holder != l.identity {
+			held := l.heldError(lease)
+			switch {
+			case held.Expires.After(now.Time) && !force:
+				return held
+			case held.Expires.After(now.Time):
+				log.Printf("Warning: Taking over deploy lock %s from %s because of --force", l.name, holder)
+			default:
+				log.Printf("Warning: Taking over deploy lock %s from %s, it expired at %s", l.name, holder, held.Expires.Format(time.RFC3339))
+			}
+		}
+
+		l.hold(lease, now)
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+		if errors.IsConflict(err) && attempt == 0 {
+			// Changed by another deployer in between, look at its holder
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update Lease %s/%s: %v", l.namespace, l.name, err)
+		}
+		break
+	}
+
+	log.Printf("✓ Acquired deploy lock %s/%s as %s", l.namespace, l.name, l.identity)
+	l.mu.Lock()
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.renew(l.stop, l.done)
+	l.mu.Unlock()
+	return nil
+}
+
+// Release stops renewing the lock and deletes the Lease if this process
+// still holds it. Releasing a lock that is not held does nothing.
+func (l *DeployLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	stop, done := l.stop, l.done
+	l.stop, l.done = nil, nil
+	l.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read Lease %s/%s: %v", l.namespace, l.name, err)
+	}
+	if holderOf(lease) != l.identity {
+		log.Printf("Warning: Deploy lock %s was taken over by %s before it was released", l.name, holderOf(lease))
+		return nil
+	}
+
+	// Delete only the lease read above, not one another deployer took since
+	preconditions := metav1.Preconditions{ResourceVersion: &lease.ResourceVersion}
+	err = leases.Delete(ctx, l.name, metav1.DeleteOptions{Preconditions: &preconditions})
+	if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+		return fmt.Errorf("failed to delete Lease %s/%s: %v", l.namespace, l.name, err)
+	}
+	log.Printf("Released deploy lock %s/%s", l.namespace, l.name)
+	return nil
+}
+
+// renew renews the lease every third of its TTL until stop is closed, so
+// one failed renewal does not lose it
+func (l *DeployLock) renew(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+		if err == nil && holderOf(lease) != l.identity {
+			cancel()
+			log.Printf("Warning: Deploy lock %s was taken over by %s, another deployer may now run at the same time", l.name, holderOf(lease))
+			return
+		}
+		if err == nil {
+			renewTime := metav1.NewMicroTime(l.now())
+			lease.Spec.RenewTime = &renewTime
+			_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+		}
+		cancel()
+		if err != nil {
+			log.Printf("Warning: Failed to renew deploy lock %s: %v", l.name, err)
+		}
+	}
+}
+
+// hold makes this process the holder of a lease from now on
+func (l *DeployLock) hold(lease *coordinationv1.Lease, now metav1.MicroTime) {
+	if holderOf(lease) != l.identity {
+		transitions := int32(0)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+		lease.Spec.AcquireTime = &now
+	}
+	identity := l.identity
+	seconds := int32(l.ttl / time.Second)
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+}
+
+// heldError describes the holder of a lease
+func (l *DeployLock) heldError(lease *coordinationv1.Lease) *LockHeldError {
+	held := &LockHeldError{Lease: l.namespace + "/" + l.name, Holder: holderOf(lease)}
+	if lease.Spec.AcquireTime != nil {
+		held.Since = lease.Spec.AcquireTime.Time
+	}
+	renewed := held.Since
+	if lease.Spec.RenewTime != nil {
+		renewed = lease.Spec.RenewTime.Time
+	}
+	ttl := l.ttl
+	if lease.Spec.LeaseDurationSeconds != nil {
+		ttl = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	held.Expires = renewed.Add(ttl)
+	return held
+}
+
+// holderOf returns the holder of a lease, empty if it is free
+func holderOf(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
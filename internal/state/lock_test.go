@@ -0,0 +1,185 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// lockNow is the fixed clock of the locks under test
+var lockNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// heldLease returns the deploy lock lease held by holder, last renewed at
+// renewed with a TTL of ttl seconds
+func heldLease(holder string, renewed time.Time, ttl int32) *coordinationv1.Lease {
+	acquired := metav1.NewMicroTime(renewed.Add(-time.Minute))
+	renewTime := metav1.NewMicroTime(renewed)
+	transitions := int32(2)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "awx-deployer-awx-awx", Namespace: "awx-deployer"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &ttl,
+			AcquireTime:          &acquired,
+			RenewTime:            &renewTime,
+			LeaseTransitions:     &transitions,
+		},
+	}
+}
+
+// testLock returns the deploy lock of runner-a on a fake cluster with a
+// fixed clock. Its TTL is long enough for the lease never to be renewed
+// during a test.
+func testLock(objects ...runtime.Object) (*DeployLock, *fake.Clientset) {
+	client := fake.NewSimpleClientset(objects...)
+	lock := NewDeployLock(client, "awx-deployer", DeployLockName("awx", "awx"), "runner-a", time.Hour)
+	lock.now = func() time.Time { return lockNow }
+	return lock, client
+}
+
+func TestDeployLockAcquire(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		force   bool
+		// wantHolder is the holder of a LockHeldError, empty if acquired
+		wantHolder      string
+		wantTransitions int32
+	}{
+		{
+			name: "free lock",
+		},
+		{
+			name:       "held by another deployer",
+			objects:    []runtime.Object{heldLease("runner-b", lockNow.Add(-time.Minute), 120)},
+			wantHolder: "runner-b",
+		},
+		{
+			name:            "taken over with force",
+			objects:         []runtime.Object{heldLease("runner-b", lockNow.Add(-time.Minute), 120)},
+			force:           true,
+			wantTransitions: 3,
+		},
+		{
+			name:            "taken over after it expired",
+			objects:         []runtime.Object{heldLease("runner-b", lockNow.Add(-3*time.Minute), 120)},
+			wantTransitions: 3,
+		},
+		{
+			name:            "held by this deployer",
+			objects:         []runtime.Object{heldLease("runner-a", lockNow.Add(-time.Minute), 120)},
+			wantTransitions: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock, client := testLock(tt.objects...)
+			defer lock.Release(context.Background())
+
+			err := lock.Acquire(context.Background(), tt.force)
+			if tt.wantHolder != "" {
+				var held *LockHeldError
+				if !errors.As(err, &held) || held.Holder != tt.wantHolder {
+					t.Fatalf("Acquire() error = %v, want the lock held by %s", err, tt.wantHolder)
+				}
+				if want := lockNow.Add(time.Minute); !held.Expires.Equal(want) {
+					t.Errorf("LockHeldError expires at %s, want %s", held.Expires, want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Acquire() failed: %v", err)
+			}
+
+			lease, err := client.CoordinationV1().Leases("awx-deployer").Get(context.Background(), "awx-deployer-awx-awx", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("lease not found: %v", err)
+			}
+			if holder := holderOf(lease); holder != "runner-a" {
+				t.Errorf("lease holder = %q, want runner-a", holder)
+			}
+			if got := *lease.Spec.LeaseDurationSeconds; got != 3600 {
+				t.Errorf("lease duration = %ds, want 3600s", got)
+			}
+			if !lease.Spec.RenewTime.Time.Equal(lockNow) {
+				t.Errorf("lease renewed at %s, want %s", lease.Spec.RenewTime.Time, lockNow)
+			}
+			if got := *lease.Spec.LeaseTransitions; got != tt.wantTransitions {
+				t.Errorf("lease transitions = %d, want %d", got, tt.wantTransitions)
+			}
+		})
+	}
+}
+
+func TestDeployLockRelease(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		acquire bool
+		// takeOver makes runner-b take the lease between Acquire and Release
+		takeOver   bool
+		wantHolder string
+	}{
+		{
+			name:    "lease deleted",
+			acquire: true,
+		},
+		{
+			name:       "taken over before the release",
+			acquire:    true,
+			takeOver:   true,
+			wantHolder: "runner-b",
+		},
+		{
+			name:       "never acquired",
+			objects:    []runtime.Object{heldLease("runner-b", lockNow, 120)},
+			wantHolder: "runner-b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock, client := testLock(tt.objects...)
+			ctx := context.Background()
+			if tt.acquire {
+				if err := lock.Acquire(ctx, false); err != nil {
+					t.Fatalf("Acquire() failed: %v", err)
+				}
+			}
+			if tt.takeOver {
+				other := NewDeployLock(client, "awx-deployer", DeployLockName("awx", "awx"), "runner-b", time.Hour)
+				other.now = lock.now
+				if err := other.Acquire(ctx, true); err != nil {
+					t.Fatalf("Acquire() by runner-b failed: %v", err)
+				}
+				defer other.Release(ctx)
+			}
+
+			if err := lock.Release(ctx); err != nil {
+				t.Fatalf("Release() failed: %v", err)
+			}
+
+			lease, err := client.CoordinationV1().Leases("awx-deployer").Get(ctx, "awx-deployer-awx-awx", metav1.GetOptions{})
+			if tt.wantHolder == "" {
+				if !apierrors.IsNotFound(err) {
+					t.Errorf("lease still exists after Release() (err = %v)", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lease not found: %v", err)
+			}
+			if holder := holderOf(lease); holder != tt.wantHolder {
+				t.Errorf("lease holder = %q, want %s", holder, tt.wantHolder)
+			}
+		})
+	}
+}
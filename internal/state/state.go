@@ -0,0 +1,237 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// maxConfigMapData is how many bytes of keys and values the API server
+// accepts in the data of a ConfigMap
+const maxConfigMapData = 1 << 20
+
+const (
+	// BackendFile keeps state in files on local disk
+	BackendFile = "file"
+	// BackendConfigMap keeps state in a ConfigMap, so it survives restarts
+	// of a deployer pod with an ephemeral filesystem
+	BackendConfigMap = "configmap"
+)
+
+// StateStore keeps the deployer's state, such as the audit trail, under keys.
+// Keys are file paths; backends that cannot hold paths use the base name.
+type StateStore interface {
+	// Get returns the value of a key, or nil if it is not set
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set replaces the value of a key
+	Set(ctx context.Context, key string, value []byte) error
+	// Append adds data to the end of the value of a key, creating it if
+	// needed. Appending nothing checks that the key can be written.
+	Append(ctx context.Context, key string, data []byte) error
+}
+
+// FileStore keeps each key in the file it names
+type FileStore struct{}
+
+// NewFileStore creates a new file store
+func NewFileStore() *FileStore {
+	return &FileStore{}
+}
+
+// Get reads the file of a key
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(key)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return data, nil
+}
+
+// Set replaces the file of a key through a temporary file, so that readers
+// never see a partial value
+func (s *FileStore) Set(ctx context.Context, key string, value []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(key), filepath.Base(key)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", key, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %v", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", key, err)
+	}
+	if err := os.Rename(tmp.Name(), key); err != nil {
+		return fmt.Errorf("failed to write %s: %v", key, err)
+	}
+	return nil
+}
+
+// Append appends to the file of a key and syncs it to disk before returning
+func (s *FileStore) Append(ctx context.Context, key string, data []byte) error {
+	file, err := os.OpenFile(key, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", key, err)
+	}
+	defer file.Close()
+
+	if len(data) == 0 {
+		return nil
+	}
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %v", key, err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %v", key, err)
+	}
+	return nil
+}
+
+// ConfigMapStore keeps each key in the data of a ConfigMap, under the base
+// name of the key. Values must be text, and a ConfigMap holds at most 1 MiB:
+// writes that would grow it past that fail without changing it.
+type ConfigMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapStore creates a new store backed by the named ConfigMap, which
+// is created on the first write
+func NewConfigMapStore(client kubernetes.Interface, namespace, name string) *ConfigMapStore {
+	return &ConfigMapStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// dataKey returns the ConfigMap key of a key
+func (s *ConfigMapStore) dataKey(key string) (string, error) {
+	dataKey := filepath.Base(key)
+	if problems := validation.IsConfigMapKey(dataKey); len(problems) > 0 {
+		return "", fmt.Errorf("invalid state key %s for ConfigMap %s/%s: %s", key, s.namespace, s.name, strings.Join(problems, "; "))
+	}
+	return dataKey, nil
+}
+
+// Get returns the value of a key from the ConfigMap
+func (s *ConfigMapStore) Get(ctx context.Context, key string) ([]byte, error) {
+	dataKey, err := s.dataKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ConfigMap %s/%s: %v", s.namespace, s.name, err)
+	}
+	value, ok := configMap.Data[dataKey]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(value), nil
+}
+
+// Set replaces the value of a key in the ConfigMap
+func (s *ConfigMapStore) Set(ctx context.Context, key string, value []byte) error {
+	return s.update(ctx, key, func(string) string {
+		return string(value)
+	})
+}
+
+// Append appends to the value of a key in the ConfigMap. Appending nothing
+// does not contact the cluster.
+func (s *ConfigMapStore) Append(ctx context.Context, key string, data []byte) error {
+	if len(data) == 0 {
+		_, err := s.dataKey(key)
+		return err
+	}
+	return s.update(ctx, key, func(current string) string {
+		return current + string(data)
+	})
+}
+
+// update changes the value of a key, creating the ConfigMap if needed and
+// retrying when another writer changed it in between
+func (s *ConfigMapStore) update(ctx context.Context, key string, change func(string) string) error {
+	dataKey, err := s.dataKey(key)
+	if err != nil {
+		return err
+	}
+
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+				Data:       map[string]string{dataKey: change("")},
+			}
+			if err := checkSize(configMap); err != nil {
+				return err
+			}
+			_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				// Created by another writer, retry as a conflict
+				return errors.NewConflict(corev1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[dataKey] = change(configMap.Data[dataKey])
+		if err := checkSize(configMap); err != nil {
+			return err
+		}
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s to ConfigMap %s/%s: %v", dataKey, s.namespace, s.name, err)
+	}
+	return nil
+}
+
+// checkSize returns an error if the data of a ConfigMap is more than the API
+// server accepts, so that the write fails before it is sent and says why
+func checkSize(configMap *corev1.ConfigMap) error {
+	size := 0
+	for key, value := range configMap.Data {
+		size += len(key) + len(value)
+	}
+	for key, value := range configMap.BinaryData {
+		size += len(key) + len(value)
+	}
+	if size > maxConfigMapData {
+		return fmt.Errorf("ConfigMap would hold %d bytes, more than the %d a ConfigMap can, use AWX_STATE_STORE=file with a persistent volume for state this large", size, maxConfigMapData)
+	}
+	return nil
+}
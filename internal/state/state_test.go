@@ -0,0 +1,214 @@
+package state
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestStateStoreContract runs the same operations against every backend,
+// which must agree on the results
+func TestStateStoreContract(t *testing.T) {
+	backends := []struct {
+		name string
+		// open returns an empty store and the key to use with it
+		open func(t *testing.T) (StateStore, string)
+	}{
+		{
+			name: BackendFile,
+			open: func(t *testing.T) (StateStore, string) {
+				return NewFileStore(), filepath.Join(t.TempDir(), "audit.jsonl")
+			},
+		},
+		{
+			name: BackendConfigMap,
+			open: func(t *testing.T) (StateStore, string) {
+				return NewConfigMapStore(fake.NewSimpleClientset(), "awx", "awx-deployer-state"), "/var/log/audit.jsonl"
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		// run changes the store, after which the key holds want
+		run  func(ctx context.Context, store StateStore, key string) error
+		want string
+		// wantNil is set when Get must report the key as not set
+		wantNil bool
+	}{
+		{
+			name:    "missing key",
+			run:     func(ctx context.Context, store StateStore, key string) error { return nil },
+			wantNil: true,
+		},
+		{
+			name: "set",
+			run: func(ctx context.Context, store StateStore, key string) error {
+				return store.Set(ctx, key, []byte("first"))
+			},
+			want: "first",
+		},
+		{
+			name: "set replaces",
+			run: func(ctx context.Context, store StateStore, key string) error {
+				if err := store.Set(ctx, key, []byte("first")); err != nil {
+					return err
+				}
+				return store.Set(ctx, key, []byte("second"))
+			},
+			want: "second",
+		},
+		{
+			name: "append creates",
+			run: func(ctx context.Context, store StateStore, key string) error {
+				return store.Append(ctx, key, []byte("line 1\n"))
+			},
+			want: "line 1\n",
+		},
+		{
+			name: "append appends",
+			run: func(ctx context.Context, store StateStore, key string) error {
+				if err := store.Set(ctx, key, []byte("line 1\n")); err != nil {
+					return err
+				}
+				return store.Append(ctx, key, []byte("line 2\n"))
+			},
+			want: "line 1\nline 2\n",
+		},
+		{
+			name: "appending nothing",
+			run: func(ctx context.Context, store StateStore, key string) error {
+				return store.Append(ctx, key, nil)
+			},
+		},
+	}
+
+	for _, backend := range backends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				store, key := backend.open(t)
+				if err := tt.run(ctx, store, key); err != nil {
+					t.Fatalf("failed to change the store: %v", err)
+				}
+
+				got, err := store.Get(ctx, key)
+				if err != nil {
+					t.Fatalf("Get() failed: %v", err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("Get() = %q, want %q", got, tt.want)
+				}
+				if tt.wantNil && got != nil {
+					t.Errorf("Get() = %q, want nil", got)
+				}
+			})
+		}
+	}
+}
+
+func TestConfigMapStore(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *corev1.ConfigMap
+		key      string
+		wantData map[string]string
+		wantErr  string
+	}{
+		{
+			name:     "ConfigMap created",
+			key:      "/var/log/audit.jsonl",
+			wantData: map[string]string{"audit.jsonl": "entry\n"},
+		},
+		{
+			name: "other keys kept",
+			existing: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "awx-deployer-state", Namespace: "awx"},
+				Data:       map[string]string{"plan.jsonl": "step\n"},
+			},
+			key:      "audit.jsonl",
+			wantData: map[string]string{"audit.jsonl": "entry\n", "plan.jsonl": "step\n"},
+		},
+		{
+			name:    "invalid key",
+			key:     "audit log",
+			wantErr: "invalid state key audit log for ConfigMap awx/awx-deployer-state",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clientset := fake.NewSimpleClientset()
+			if tt.existing != nil {
+				clientset = fake.NewSimpleClientset(tt.existing)
+			}
+			store := NewConfigMapStore(clientset, "awx", "awx-deployer-state")
+
+			err := store.Append(ctx, tt.key, []byte("entry\n"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Append() error = %v, want %q", err, tt.wantErr)
+				}
+				if err := store.Append(ctx, tt.key, nil); err == nil {
+					t.Errorf("Append() of nothing accepted invalid key %q", tt.key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Append() failed: %v", err)
+			}
+
+			configMap, err := clientset.CoreV1().ConfigMaps("awx").Get(ctx, "awx-deployer-state", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("ConfigMap not written: %v", err)
+			}
+			if len(configMap.Data) != len(tt.wantData) {
+				t.Errorf("ConfigMap data = %v, want %v", configMap.Data, tt.wantData)
+			}
+			for key, want := range tt.wantData {
+				if configMap.Data[key] != want {
+					t.Errorf("ConfigMap data[%s] = %q, want %q", key, configMap.Data[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigMapStoreFull(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	store := NewConfigMapStore(clientset, "awx", "awx-deployer-state")
+
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	for i := 0; i < maxConfigMapData/len(line)-1; i++ {
+		if err := store.Append(ctx, "audit.jsonl", line); err != nil {
+			t.Fatalf("Append() %d failed: %v", i, err)
+		}
+	}
+	before, err := store.Get(ctx, "audit.jsonl")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+
+	err = store.Append(ctx, "audit.jsonl", line)
+	if err == nil || !strings.Contains(err.Error(), "more than the 1048576 a ConfigMap can") {
+		t.Fatalf("Append() past the limit error = %v, want the ConfigMap full", err)
+	}
+	after, err := store.Get(ctx, "audit.jsonl")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("value has %d bytes after the failed append, want the %d it had", len(after), len(before))
+	}
+
+	if err := store.Set(ctx, "audit.jsonl", line); err != nil {
+		t.Errorf("Set() of a small value after the failed append failed: %v", err)
+	}
+}
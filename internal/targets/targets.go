@@ -0,0 +1,248 @@
+package targets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Target is a cluster to deploy AWX to
+type Target struct {
+	Name       string `json:"name"`
+	Kubeconfig string `json:"kubeconfig"` // overrides KUBECONFIG
+	Context    string `json:"context"`    // overrides AWX_CLUSTER
+	// Config holds environment variables overriding the shared configuration
+	Config map[string]string `json:"config"`
+}
+
+// targetsFile is the layout of a targets file
+type targetsFile struct {
+	Targets []Target `json:"targets"`
+}
+
+// Load reads the targets from a YAML or JSON file. Targets without a name
+// are named after their context.
+func Load(path string) ([]Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets file %s: %v", path, err)
+	}
+
+	var file targetsFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse targets file %s: %v", path, err)
+	}
+	if len(file.Targets) == 0 {
+		return nil, fmt.Errorf("targets file %s lists no targets", path)
+	}
+
+	names := map[string]bool{}
+	for i := range file.Targets {
+		target := &file.Targets[i]
+		if target.Name == "" {
+			target.Name = target.Context
+		}
+		if target.Name == "" {
+			return nil, fmt.Errorf("target %d in %s needs a name or a context", i+1, path)
+		}
+		if names[target.Name] {
+			return nil, fmt.Errorf("target %s is listed twice in %s", target.Name, path)
+		}
+		names[target.Name] = true
+	}
+
+	return file.Targets, nil
+}
+
+// environ returns the environment of the deployer run for the target
+func (t Target) environ(base []string) []string {
+	env := append([]string(nil), base...)
+	if t.Kubeconfig != "" {
+		env = append(env, "KUBECONFIG="+t.Kubeconfig)
+	}
+	if t.Context != "" {
+		env = append(env, "AWX_CLUSTER="+t.Context)
+	}
+
+	keys := make([]string, 0, len(t.Config))
+	for key := range t.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// later entries take precedence over the inherited ones
+		env = append(env, key+"="+t.Config[key])
+	}
+	return env
+}
+
+// Result is the outcome of the deployment to one target
+type Result struct {
+	Target   Target
+	Err      error
+	Duration time.Duration
+}
+
+// Report collects the results of a multi-cluster run in target order
+type Report struct {
+	Results []Result
+}
+
+// Failed returns the number of targets that failed
+func (r Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Print writes the report as a table
+func (r Report) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tSTATUS\tDURATION\tERROR")
+	for _, result := range r.Results {
+		status, message := "OK", ""
+		if result.Err != nil {
+			status, message = "FAILED", result.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Target.Name, status, result.Duration.Round(time.Second), message)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%d of %d targets deployed successfully\n", len(r.Results)-r.Failed(), len(r.Results))
+}
+
+// Runner deploys to several targets, each in its own deployer process so
+// that they get their own Kubernetes client and configuration, and a
+// failing target cannot affect the others
+type Runner struct {
+	executable  string
+	args        []string
+	maxParallel int
+
+	stdout io.Writer
+	stderr io.Writer
+	// outputMu keeps lines from different targets from interleaving
+	outputMu sync.Mutex
+}
+
+// NewRunner creates a runner that starts executable with args for each
+// target, at most maxParallel at a time
+func NewRunner(executable string, args []string, maxParallel int) *Runner {
+	return &Runner{
+		executable:  executable,
+		args:        args,
+		maxParallel: maxParallel,
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+	}
+}
+
+// Run deploys to all targets and reports the result of each
+func (r *Runner) Run(ctx context.Context, targets []Target) Report {
+	results := make([]Result, len(targets))
+	slots := make(chan struct{}, r.maxParallel)
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			results[i] = r.runTarget(ctx, target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	return Report{Results: results}
+}
+
+// runTarget runs the deployer for one target, tagging its output lines
+// with the target name
+func (r *Runner) runTarget(ctx context.Context, target Target) Result {
+	log.Printf("[%s] Starting deployment", target.Name)
+	start := time.Now()
+
+	prefix := "[" + target.Name + "] "
+	stdout := &prefixWriter{w: r.stdout, mu: &r.outputMu, prefix: prefix}
+	stderr := &prefixWriter{w: r.stderr, mu: &r.outputMu, prefix: prefix}
+
+	cmd := exec.CommandContext(ctx, r.executable, r.args...)
+	cmd.Env = target.environ(os.Environ())
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+
+	result := Result{Target: target, Duration: time.Since(start)}
+	if err != nil {
+		// the last log line of a failed run carries the reason
+		if reason := stderr.lastLine; reason != "" {
+			result.Err = fmt.Errorf("%v: %s", err, reason)
+		} else {
+			result.Err = err
+		}
+		log.Printf("[%s] Deployment failed: %v", target.Name, result.Err)
+	} else {
+		log.Printf("[%s] Deployment completed", target.Name)
+	}
+	return result
+}
+
+// prefixWriter writes complete lines with a prefix to a shared writer
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+
+	buf      bytes.Buffer
+	lastLine string
+}
+
+// Write buffers p and writes the complete lines in it
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf.Write(data)
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i == -1 {
+			return len(data), nil
+		}
+		line := string(p.buf.Next(i + 1))
+		p.writeLine(line)
+	}
+}
+
+// Flush writes a trailing line without a newline
+func (p *prefixWriter) Flush() {
+	if p.buf.Len() > 0 {
+		p.writeLine(p.buf.String() + "\n")
+		p.buf.Reset()
+	}
+}
+
+// writeLine writes one line with the prefix
+func (p *prefixWriter) writeLine(line string) {
+	if trimmed := strings.TrimSpace(line); trimmed != "" {
+		p.lastLine = trimmed
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	io.WriteString(p.w, p.prefix+line)
+}
@@ -0,0 +1,201 @@
+package targets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestHelperProcess stands in for the deployer started by the runner. It
+// fails for the cluster named "broken" as a deployer failing to
+// authenticate would.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	cluster := os.Getenv("AWX_CLUSTER")
+	fmt.Printf("Deploying to %s\n", cluster)
+	if name := os.Getenv("AWX_NAME"); name != "" {
+		fmt.Printf("AWX instance %s\n", name)
+	}
+	if cluster == "broken" {
+		fmt.Fprintf(os.Stderr, "Deployment failed: Unauthorized\n")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// helperRunner creates a runner starting TestHelperProcess as the deployer
+func helperRunner(t *testing.T, maxParallel int) (*Runner, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	r := NewRunner(os.Args[0], []string{"-test.run=TestHelperProcess"}, maxParallel)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	r.stdout, r.stderr = stdout, stderr
+	return r, stdout, stderr
+}
+
+func TestRunnerRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		targets     []Target
+		maxParallel int
+		wantFailed  []string
+		wantOutput  []string
+	}{
+		{
+			name: "one target fails",
+			targets: []Target{
+				{Name: "east", Context: "east", Config: map[string]string{"AWX_NAME": "tower-east"}},
+				{Name: "west", Context: "broken"},
+			},
+			maxParallel: 2,
+			wantFailed:  []string{"west"},
+			wantOutput:  []string{"[east] Deploying to east\n", "[east] AWX instance tower-east\n", "[west] Deploying to broken\n"},
+		},
+		{
+			name: "one at a time",
+			targets: []Target{
+				{Name: "a", Context: "a"},
+				{Name: "b", Context: "b"},
+				{Name: "c", Context: "c"},
+			},
+			maxParallel: 1,
+			wantOutput:  []string{"[a] Deploying to a\n", "[b] Deploying to b\n", "[c] Deploying to c\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, stdout, stderr := helperRunner(t, tt.maxParallel)
+
+			report := r.Run(context.Background(), tt.targets)
+
+			if len(report.Results) != len(tt.targets) {
+				t.Fatalf("report has %d results, want %d", len(report.Results), len(tt.targets))
+			}
+			var failed []string
+			for i, result := range report.Results {
+				if result.Target.Name != tt.targets[i].Name {
+					t.Errorf("result %d is for %s, want %s", i, result.Target.Name, tt.targets[i].Name)
+				}
+				if result.Err != nil {
+					failed = append(failed, result.Target.Name)
+					if !strings.Contains(result.Err.Error(), "Deployment failed: Unauthorized") {
+						t.Errorf("error of %s = %v, want the last log line", result.Target.Name, result.Err)
+					}
+				}
+			}
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("failed targets = %v, want %v", failed, tt.wantFailed)
+			}
+			if report.Failed() != len(tt.wantFailed) {
+				t.Errorf("Failed() = %d, want %d", report.Failed(), len(tt.wantFailed))
+			}
+			for _, line := range tt.wantOutput {
+				if !strings.Contains(stdout.String(), line) {
+					t.Errorf("stdout = %q, want it to contain %q", stdout.String(), line)
+				}
+			}
+			for _, name := range tt.wantFailed {
+				if want := "[" + name + "] Deployment failed: Unauthorized\n"; !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr = %q, want it to contain %q", stderr.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			name: "named after context",
+			content: `targets:
+- context: east
+  config:
+    AWX_NAME: tower-east
+- name: west-prod
+  kubeconfig: /etc/kube/west.yaml
+  context: west
+`,
+			wantNames: []string{"east", "west-prod"},
+		},
+		{
+			name:    "no targets",
+			content: "targets: []\n",
+			wantErr: "lists no targets",
+		},
+		{
+			name:    "no name or context",
+			content: "targets:\n- kubeconfig: /etc/kube/east.yaml\n",
+			wantErr: "target 1 in",
+		},
+		{
+			name:    "listed twice",
+			content: "targets:\n- context: east\n- name: east\n",
+			wantErr: "target east is listed twice",
+		},
+		{
+			name:    "unknown field",
+			content: "targets:\n- context: east\n  namespace: awx\n",
+			wantErr: "failed to parse targets file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "targets.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			targets, err := Load(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+			var names []string
+			for _, target := range targets {
+				names = append(names, target.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("target names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestTargetEnviron(t *testing.T) {
+	target := Target{
+		Kubeconfig: "/etc/kube/east.yaml",
+		Context:    "east",
+		Config:     map[string]string{"AWX_NAMESPACE": "awx-east", "AWX_NAME": "tower"},
+	}
+	got := target.environ([]string{"AWX_NAMESPACE=awx", "PATH=/bin"})
+	want := []string{
+		"AWX_NAMESPACE=awx",
+		"PATH=/bin",
+		"KUBECONFIG=/etc/kube/east.yaml",
+		"AWX_CLUSTER=east",
+		"AWX_NAME=tower",
+		"AWX_NAMESPACE=awx-east",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("environ() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serviceName identifies the deployer in exported traces
+const serviceName = "awx-deployer"
+
+// NewTracer returns a tracer exporting spans to the OTLP/HTTP endpoint and a
+// function that flushes and shuts down the exporter. Without an endpoint a
+// no-op tracer is returned so tracing costs nothing.
+func NewTracer(ctx context.Context, endpoint string) (trace.Tracer, func(context.Context) error, error) {
+	if endpoint == "" {
+		return trace.NewNoopTracerProvider().Tracer(serviceName), func(context.Context) error { return nil }, nil
+	}
+
+	options, err := exporterOptions(endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+
+	return provider.Tracer(serviceName), provider.Shutdown, nil
+}
+
+// exporterOptions converts an endpoint URL such as http://collector:4318 into
+// OTLP/HTTP exporter options
+func exporterOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: expected a URL like http://collector:4318", endpoint)
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	switch u.Scheme {
+	case "http":
+		options = append(options, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: scheme must be http or https", endpoint)
+	}
+	if u.Path != "" && u.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(u.Path))
+	}
+	return options, nil
+}
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewTracer(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		wantErr  bool
+		// wantRecording is whether the tracer records spans
+		wantRecording bool
+	}{
+		{name: "no endpoint", endpoint: ""},
+		{name: "http endpoint", endpoint: "http://collector:4318", wantRecording: true},
+		{name: "https endpoint with path", endpoint: "https://collector.example.com/otlp/v1/traces", wantRecording: true},
+		{name: "missing scheme", endpoint: "collector:4318", wantErr: true},
+		{name: "unsupported scheme", endpoint: "grpc://collector:4317", wantErr: true},
+		{name: "not a URL", endpoint: "://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, shutdown, err := NewTracer(context.Background(), tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTracer(%q) error = %v, want error %v", tt.endpoint, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer shutdown(context.Background())
+
+			_, span := tracer.Start(context.Background(), "test")
+			defer span.End()
+			if span.IsRecording() != tt.wantRecording {
+				t.Errorf("span recording = %v, want %v", span.IsRecording(), tt.wantRecording)
+			}
+		})
+	}
+}
+
+func TestExporterOptions(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		// wantOptions is the number of options: endpoint, insecure, path
+		wantOptions int
+		wantErr     bool
+	}{
+		{endpoint: "http://collector:4318", wantOptions: 2},
+		{endpoint: "http://collector:4318/", wantOptions: 2},
+		{endpoint: "https://collector:4318", wantOptions: 1},
+		{endpoint: "https://collector:4318/custom/traces", wantOptions: 2},
+		{endpoint: "http://collector:4318/custom/traces", wantOptions: 3},
+		{endpoint: "collector:4318", wantErr: true},
+		{endpoint: "ftp://collector", wantErr: true},
+		{endpoint: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			options, err := exporterOptions(tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("exporterOptions(%q) error = %v, want error %v", tt.endpoint, err, tt.wantErr)
+			}
+			if len(options) != tt.wantOptions {
+				t.Errorf("exporterOptions(%q) = %d options, want %d", tt.endpoint, len(options), tt.wantOptions)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at build time with e.g.
+//
+//	go build -ldflags "-X awx-deployer/internal/version.Version=1.4.0 -X awx-deployer/internal/version.Commit=$(git rev-parse HEAD)"
+var (
+	// Version is the version of the deployer
+	Version = "dev"
+	// Commit is the git commit the deployer was built from
+	Commit = "unknown"
+	// BuildDate is when the deployer was built, in RFC 3339
+	BuildDate = "unknown"
+)
+
+// clientGoModule is the module path of the Kubernetes client library
+const clientGoModule = "k8s.io/client-go"
+
+// Info describes the build of the deployer and, when it could be reached,
+// the target cluster
+type Info struct {
+	Version                string `json:"version"`
+	Commit                 string `json:"commit"`
+	BuildDate              string `json:"build_date"`
+	GoVersion              string `json:"go_version"`
+	ClientGoVersion        string `json:"client_go_version"`
+	DefaultOperatorVersion string `json:"default_operator_version"`
+	ServerVersion          string `json:"server_version,omitempty"`
+	ServerError            string `json:"server_error,omitempty"` // why the server version is missing
+}
+
+// Get returns the build information. The server version is left to the
+// caller, as it needs a cluster connection.
+func Get(defaultOperatorVersion string) Info {
+	return Info{
+		Version:                Version,
+		Commit:                 Commit,
+		BuildDate:              BuildDate,
+		GoVersion:              runtime.Version(),
+		ClientGoVersion:        moduleVersion(clientGoModule),
+		DefaultOperatorVersion: defaultOperatorVersion,
+	}
+}
+
+// moduleVersion returns the version of a module the binary was built with
+func moduleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,117 @@
+package version
+
+import (
+	"encoding/json"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// setBuild sets the build variables like -ldflags -X would for one test
+func setBuild(t *testing.T, version, commit, buildDate string) {
+	t.Helper()
+	oldVersion, oldCommit, oldBuildDate := Version, Commit, BuildDate
+	t.Cleanup(func() { Version, Commit, BuildDate = oldVersion, oldCommit, oldBuildDate })
+	Version, Commit, BuildDate = version, commit, buildDate
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name                   string
+		version                string
+		commit                 string
+		buildDate              string
+		defaultOperatorVersion string
+	}{
+		{
+			name:                   "injected",
+			version:                "1.4.0",
+			commit:                 "3ed5e95336ddb875be14476f0a48b8a7a8c5445c",
+			buildDate:              "2024-05-01T12:00:00Z",
+			defaultOperatorVersion: "2.5.0",
+		},
+		{
+			name:                   "defaults",
+			version:                "dev",
+			commit:                 "unknown",
+			buildDate:              "unknown",
+			defaultOperatorVersion: "2.5.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setBuild(t, tt.version, tt.commit, tt.buildDate)
+
+			info := Get(tt.defaultOperatorVersion)
+			if info.Version != tt.version || info.Commit != tt.commit || info.BuildDate != tt.buildDate {
+				t.Errorf("Get() build = %s %s %s, want %s %s %s", info.Version, info.Commit, info.BuildDate, tt.version, tt.commit, tt.buildDate)
+			}
+			if info.DefaultOperatorVersion != tt.defaultOperatorVersion {
+				t.Errorf("Get() default operator version = %q, want %q", info.DefaultOperatorVersion, tt.defaultOperatorVersion)
+			}
+			if info.GoVersion != runtime.Version() {
+				t.Errorf("Get() go version = %q, want %q", info.GoVersion, runtime.Version())
+			}
+			if info.ClientGoVersion != "unknown" && !strings.HasPrefix(info.ClientGoVersion, "v") {
+				t.Errorf("Get() client-go version = %q, want a module version", info.ClientGoVersion)
+			}
+			if info.ServerVersion != "" || info.ServerError != "" {
+				t.Errorf("Get() server = %q, %q, want it left to the caller", info.ServerVersion, info.ServerError)
+			}
+		})
+	}
+}
+
+func TestInfoJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     Info
+		wantKeys []string
+	}{
+		{
+			name:     "without server",
+			info:     Info{Version: "1.4.0"},
+			wantKeys: []string{"build_date", "client_go_version", "commit", "default_operator_version", "go_version", "version"},
+		},
+		{
+			name:     "with server version",
+			info:     Info{Version: "1.4.0", ServerVersion: "v1.28.2"},
+			wantKeys: []string{"build_date", "client_go_version", "commit", "default_operator_version", "go_version", "server_version", "version"},
+		},
+		{
+			name:     "server unreachable",
+			info:     Info{Version: "1.4.0", ServerError: "connection refused"},
+			wantKeys: []string{"build_date", "client_go_version", "commit", "default_operator_version", "go_version", "server_error", "version"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.info)
+			if err != nil {
+				t.Fatalf("json.Marshal() failed: %v", err)
+			}
+			fields := map[string]interface{}{}
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("json.Unmarshal() failed: %v", err)
+			}
+			var keys []string
+			for _, key := range tt.wantKeys {
+				if _, ok := fields[key]; ok {
+					keys = append(keys, key)
+				}
+			}
+			if len(fields) != len(tt.wantKeys) || !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("JSON = %s, want keys %v", data, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestModuleVersionUnknown(t *testing.T) {
+	if got := moduleVersion("example.com/not-a-dependency"); got != "unknown" {
+		t.Errorf("moduleVersion() = %q, want unknown", got)
+	}
+}